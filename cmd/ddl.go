@@ -7,6 +7,7 @@ import (
 	"github.com/unionj-cloud/go-doudou/v2/cmd/internal/ddl"
 	"github.com/unionj-cloud/go-doudou/v2/cmd/internal/ddl/config"
 	"github.com/unionj-cloud/go-doudou/v2/toolkit/dotenv"
+	"github.com/unionj-cloud/go-doudou/v2/toolkit/governance"
 	"github.com/unionj-cloud/go-doudou/v2/toolkit/pathutils"
 	"github.com/unionj-cloud/go-doudou/v2/toolkit/yaml"
 )
@@ -17,6 +18,7 @@ var dao bool
 var pre string
 var df string
 var env string
+var governed governance.Columns
 
 // ddlCmd generates entity and dao layer source code from database tables and update tables from entity code
 var ddlCmd = &cobra.Command{
@@ -34,7 +36,7 @@ var ddlCmd = &cobra.Command{
 		if dir, err = pathutils.FixPath(dir, "entity"); err != nil {
 			logrus.Panicln(err)
 		}
-		d := ddl.Ddl{dir, reverse, dao, pre, df, conf}
+		d := ddl.Ddl{dir, reverse, dao, pre, df, conf, governed}
 		d.Exec()
 	},
 }
@@ -56,4 +58,8 @@ func init() {
 	ddlCmd.Flags().StringVar(&env, "env", "dev", "Environment name such as dev, uat, test, prod, default is dev")
 	ddlCmd.Flags().BoolVarP(&reverse, "reverse", "r", false, "If true, generate entity code from database. If false, update or create database tables from entity code.")
 	ddlCmd.Flags().BoolVarP(&dao, "dao", "d", false, "If true, generate dao code.")
+	ddlCmd.Flags().StringVar(&governed.SoftDelete, "soft", governance.DefaultColumns.SoftDelete, "Soft delete column name. Generated dao code excludes soft deleted rows unless context is marked by governance.Unscoped.")
+	ddlCmd.Flags().StringVar(&governed.CreatedBy, "created_by", governance.DefaultColumns.CreatedBy, "Column name filled with context principal on insert.")
+	ddlCmd.Flags().StringVar(&governed.UpdatedBy, "updated_by", governance.DefaultColumns.UpdatedBy, "Column name filled with context principal on insert and update.")
+	ddlCmd.Flags().StringVar(&governed.Version, "lock", governance.DefaultColumns.Version, "Optimistic lock column name. Stale updates return *governance.ConflictError.")
 }
@@ -10,22 +10,37 @@ import (
 
 var naming string
 
+var grpcCheck bool
+
+var grpcHttp bool
+
+var grpcTs bool
+
+var grpcWrappers bool
+
+var grpcClient bool
+
 var grpcCmd = &cobra.Command{
 	Use:   "grpc",
 	Short: "generate grpc service",
 	Long:  ``,
 	Run: func(cmd *cobra.Command, args []string) {
-		s := svc.NewSvc("")
+		s := svc.NewSvc("", svc.WithGrpcCheck(grpcCheck), svc.WithGrpcTs(grpcTs), svc.WithGrpcClient(grpcClient))
 		fn := strcase.ToLowerCamel
 		switch naming {
 		case "snake":
 			fn = strcase.ToSnake
 		}
-		s.Grpc(v3.NewProtoGenerator(v3.WithFieldNamingFunc(fn)))
+		s.Grpc(v3.NewProtoGenerator(v3.WithFieldNamingFunc(fn), v3.WithHttpAnnotation(grpcHttp), v3.WithWrapperTypes(grpcWrappers)))
 	},
 }
 
 func init() {
 	svcCmd.AddCommand(grpcCmd)
 	grpcCmd.Flags().StringVarP(&naming, "naming", "n", "lowerCamel", `protobuf message field naming strategy, only support "lowerCamel" and "snake"`)
+	grpcCmd.Flags().BoolVar(&grpcCheck, "check", false, `only check the proto file to be generated against the existing one, fail on breaking changes such as renumbered or retyped fields and removed rpcs`)
+	grpcCmd.Flags().BoolVar(&grpcHttp, "http", false, `annotate rpcs with google.api.http option derived from http route patterns, and serve them over HTTP/JSON by transcoding. Generated proto file imports google/api/annotations.proto, which should be found by protoc`)
+	grpcCmd.Flags().BoolVar(&grpcTs, "ts", false, `generate TypeScript client stubs of unary and server streaming rpcs to transport/grpc, which call the service from browsers over Connect protocol. The grpc server should be started with GDD_GRPC_WEB_ENABLE=true and GDD_GRPC_HTTP_MODE set`)
+	grpcCmd.Flags().BoolVar(&grpcWrappers, "wrappers", false, `generate pointer to scalar fields as well-known wrapper types such as google.protobuf.StringValue instead of proto3 optional fields`)
+	grpcCmd.Flags().BoolVar(&grpcClient, "client", false, `generate client/grpcclient package implementing the service interface in svc.go by calling the grpc service, which discovers servers by GDD_SERVICE_DISCOVERY_MODE and wraps calls with circuit breaker, timeout and retry`)
 }
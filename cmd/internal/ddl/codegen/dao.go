@@ -1,9 +1,13 @@
 package codegen
 
 import (
+	"bytes"
 	"github.com/iancoleman/strcase"
+	"github.com/pkg/errors"
 	log "github.com/sirupsen/logrus"
 	"github.com/unionj-cloud/go-doudou/v2/toolkit/astutils"
+	"github.com/unionj-cloud/go-doudou/v2/toolkit/caller"
+	"github.com/unionj-cloud/go-doudou/v2/toolkit/governance"
 	"github.com/unionj-cloud/go-doudou/v2/cmd/internal/ddl/table"
 	"github.com/unionj-cloud/go-doudou/v2/version"
 	"os"
@@ -25,6 +29,7 @@ import (
 	"github.com/pkg/errors"
 	"{{.EntityPackage}}"
 	"github.com/unionj-cloud/go-doudou/v2/toolkit/caller"
+	"github.com/unionj-cloud/go-doudou/v2/toolkit/governance"
 	"github.com/unionj-cloud/go-doudou/v2/toolkit/sqlext/query"
 	"github.com/unionj-cloud/go-doudou/v2/toolkit/sqlext/wrapper"
 	"github.com/unionj-cloud/go-doudou/v2/toolkit/reflectutils"
@@ -82,6 +87,34 @@ func (receiver *{{.EntityName}}Dao) AfterDeleteManyHook(ctx context.Context, dat
 func (receiver *{{.EntityName}}Dao) BeforeReadManyHook(ctx context.Context, page *query.Page, where *query.Where) {
 	// implement your business logic
 }
+{{- if .Audited }}
+
+// stamp fills audit columns with the principal carried by ctx
+func (receiver *{{.EntityName}}Dao) stamp(ctx context.Context, data *entity.{{.EntityName}}, create bool) {
+	principal, ok := governance.PrincipalFromContext(ctx)
+	if !ok {
+		return
+	}
+	{{- with .CreatedByCol }}
+	if create {
+		data.{{.Meta.Name}} = {{ if HasPrefix .Meta.Type "*" }}&{{ end }}principal
+	}
+	{{- end }}
+	{{- with .UpdatedByCol }}
+	data.{{.Meta.Name}} = {{ if HasPrefix .Meta.Type "*" }}&{{ end }}principal
+	{{- end }}
+}
+{{- end }}
+{{- if .SoftCol }}
+
+// scope excludes soft deleted rows unless ctx is returned by governance.Unscoped
+func (receiver *{{.EntityName}}Dao) scope(ctx context.Context, where query.Where) query.Where {
+	if governance.IsUnscoped(ctx) {
+		return where
+	}
+	return query.C().Col("{{.SoftCol.Name}}").IsNull().And(where)
+}
+{{- end }}
 
 func (receiver *{{.EntityName}}Dao) Insert(ctx context.Context, data *entity.{{.EntityName}}) (int64, error) {
 	var (
@@ -94,6 +127,9 @@ func (receiver *{{.EntityName}}Dao) Insert(ctx context.Context, data *entity.{{.
 		affected     int64
 	)
 	receiver.BeforeSaveHook(ctx, data)
+	{{- if .Audited }}
+	receiver.stamp(ctx, data, true)
+	{{- end }}
 	if statement, err = templateutils.BlockMysql("{{.EntityName | ToLower}}dao.sql", {{.EntityName | ToLower}}daosql, "Insert{{.EntityName}}", nil); err != nil {
 		return 0, errors.Wrap(err, caller.NewCaller().String())
 	}
@@ -130,6 +166,9 @@ func (receiver *{{.EntityName}}Dao) InsertIgnore(ctx context.Context, data *enti
 		affected     int64
 	)
 	receiver.BeforeSaveHook(ctx, data)
+	{{- if .Audited }}
+	receiver.stamp(ctx, data, true)
+	{{- end }}
 	if statement, err = templateutils.BlockMysql("{{.EntityName | ToLower}}dao.sql", {{.EntityName | ToLower}}daosql, "InsertIgnore{{.EntityName}}", nil); err != nil {
 		return 0, errors.Wrap(err, caller.NewCaller().String())
 	}
@@ -153,6 +192,11 @@ func (receiver *{{.EntityName}}Dao) BulkInsert(ctx context.Context, data []*enti
 		affected     int64
 	)
 	receiver.BeforeBulkSaveHook(ctx, data)
+	{{- if .Audited }}
+	for _, item := range data {
+		receiver.stamp(ctx, item, true)
+	}
+	{{- end }}
 	if statement, err = templateutils.BlockMysql("{{.EntityName | ToLower}}dao.sql", {{.EntityName | ToLower}}daosql, "Insert{{.EntityName}}", nil); err != nil {
 		return 0, errors.Wrap(err, caller.NewCaller().String())
 	}
@@ -191,6 +235,11 @@ func (receiver *{{.EntityName}}Dao) BulkInsertIgnore(ctx context.Context, data [
 		affected     int64
 	)
 	receiver.BeforeBulkSaveHook(ctx, data)
+	{{- if .Audited }}
+	for _, item := range data {
+		receiver.stamp(ctx, item, true)
+	}
+	{{- end }}
 	if statement, err = templateutils.BlockMysql("{{.EntityName | ToLower}}dao.sql", {{.EntityName | ToLower}}daosql, "InsertIgnore{{.EntityName}}", nil); err != nil {
 		return 0, errors.Wrap(err, caller.NewCaller().String())
 	}
@@ -219,6 +268,9 @@ func (receiver *{{.EntityName}}Dao) Upsert(ctx context.Context, data *entity.{{.
 		affected     int64
 	)
 	receiver.BeforeSaveHook(ctx, data)
+	{{- if .Audited }}
+	receiver.stamp(ctx, data, true)
+	{{- end }}
 	if statement, err = templateutils.BlockMysql("{{.EntityName | ToLower}}dao.sql", {{.EntityName | ToLower}}daosql, "Upsert{{.EntityName}}", nil); err != nil {
 		return 0, errors.Wrap(err, caller.NewCaller().String())
 	}
@@ -257,6 +309,11 @@ func (receiver *{{.EntityName}}Dao) BulkUpsert(ctx context.Context, data []*enti
 		args      []interface{}
 	)
 	receiver.BeforeBulkSaveHook(ctx, data)
+	{{- if .Audited }}
+	for _, item := range data {
+		receiver.stamp(ctx, item, true)
+	}
+	{{- end }}
 	if statement, err = templateutils.BlockMysql("{{.EntityName | ToLower}}dao.sql", {{.EntityName | ToLower}}daosql, "Insert{{.EntityName}}", nil); err != nil {
 		return 0, errors.Wrap(err, caller.NewCaller().String())
 	}
@@ -287,6 +344,11 @@ func (receiver *{{.EntityName}}Dao) BulkUpsertSelect(ctx context.Context, data [
 		args      []interface{}
 	)
 	receiver.BeforeBulkSaveHook(ctx, data)
+	{{- if .Audited }}
+	for _, item := range data {
+		receiver.stamp(ctx, item, true)
+	}
+	{{- end }}
 	if statement, err = templateutils.BlockMysql("{{.EntityName | ToLower}}dao.sql", {{.EntityName | ToLower}}daosql, "Insert{{.EntityName}}", nil); err != nil {
 		return 0, errors.Wrap(err, caller.NewCaller().String())
 	}
@@ -322,6 +384,9 @@ func (receiver *{{.EntityName}}Dao) UpsertNoneZero(ctx context.Context, data *en
 		affected     int64
 	)
 	receiver.BeforeSaveHook(ctx, data)
+	{{- if .Audited }}
+	receiver.stamp(ctx, data, true)
+	{{- end }}
 	value := reflectutils.ValueOf(data).Interface()
 	if _, ok := value.(entity.{{.EntityName}}); !ok {
 		return 0, errors.New("underlying type of data should be entity.{{.EntityName}}")
@@ -354,8 +419,10 @@ func (receiver *{{.EntityName}}Dao) UpsertNoneZero(ctx context.Context, data *en
 	return affected, err
 }
 
+// DeleteMany soft deletes rows if the table has soft delete column, call it with governance.Unscoped context to delete rows physically
 func (receiver *{{.EntityName}}Dao) DeleteMany(ctx context.Context, where query.Where) (int64, error) {
 	var (
+		statement string
 		err    error
 		result sql.Result
 		w      string
@@ -363,14 +430,51 @@ func (receiver *{{.EntityName}}Dao) DeleteMany(ctx context.Context, where query.
 		affected int64
 	)
 	receiver.BeforeDeleteManyHook(ctx, nil, &where)
+	{{- if .SoftCol }}
+	if !governance.IsUnscoped(ctx) {
+		w, args = receiver.scope(ctx, where).Sql()
+		args = append([]interface{}{time.Now()}, args...)
+		statement = fmt.Sprintf("update {{.TableName}} set {{.SoftCol.Name}}=? where %s;", w)
+	} else {
+		w, args = where.Sql()
+		statement = fmt.Sprintf("delete from {{.TableName}} where %s;", w)
+	}
+	{{- else }}
 	w, args = where.Sql()
-	if result, err = receiver.db.ExecContext(ctx, receiver.db.Rebind(fmt.Sprintf("delete from {{.TableName}} where %s;", w)), args...); err != nil {
+	statement = fmt.Sprintf("delete from {{.TableName}} where %s;", w)
+	{{- end }}
+	if result, err = receiver.db.ExecContext(ctx, receiver.db.Rebind(statement), args...); err != nil {
+		return 0, errors.Wrap(err, caller.NewCaller().String())
+	}
+	if affected, err = result.RowsAffected(); err == nil {
+		receiver.AfterDeleteManyHook(ctx, nil, &where, affected)
+	}
+	return affected, err
+}
+
+// Deprecated: use DeleteMany, which soft deletes rows if the table has soft delete column
+func (receiver *{{.EntityName}}Dao) DeleteManySoft(ctx context.Context, where query.Where) (int64, error) {
+	{{- if .SoftCol }}
+	var (
+		err      error
+		result   sql.Result
+		w        string
+		args     []interface{}
+		affected int64
+	)
+	receiver.BeforeDeleteManyHook(ctx, nil, &where)
+	w, args = receiver.scope(ctx, where).Sql()
+	args = append([]interface{}{time.Now()}, args...)
+	if result, err = receiver.db.ExecContext(ctx, receiver.db.Rebind(fmt.Sprintf("update {{.TableName}} set {{.SoftCol.Name}}=? where %s;", w)), args...); err != nil {
 		return 0, errors.Wrap(err, caller.NewCaller().String())
 	}
 	if affected, err = result.RowsAffected(); err == nil {
 		receiver.AfterDeleteManyHook(ctx, nil, &where, affected)
 	}
 	return affected, err
+	{{- else }}
+	return 0, errors.New("table {{.TableName}} has no soft delete column")
+	{{- end }}
 }
 
 func (receiver *{{.EntityName}}Dao) Update(ctx context.Context, data *entity.{{.EntityName}}) (int64, error) {
@@ -381,6 +485,9 @@ func (receiver *{{.EntityName}}Dao) Update(ctx context.Context, data *entity.{{.
 		affected  int64
 	)
 	receiver.BeforeSaveHook(ctx, data)
+	{{- if .Audited }}
+	receiver.stamp(ctx, data, false)
+	{{- end }}
 	if statement, err = templateutils.BlockMysql("{{.EntityName | ToLower}}dao.sql", {{.EntityName | ToLower}}daosql, "Update{{.EntityName}}", nil); err != nil {
 		return 0, errors.Wrap(err, caller.NewCaller().String())
 	}
@@ -388,6 +495,12 @@ func (receiver *{{.EntityName}}Dao) Update(ctx context.Context, data *entity.{{.
 		return 0, errors.Wrap(err, caller.NewCaller().String())
 	}
 	if affected, err = result.RowsAffected(); err == nil {
+		{{- with .VersionCol }}
+		if affected == 0 {
+			return 0, errors.WithStack(&governance.ConflictError{Table: "{{.Table}}", Version: data.{{.Meta.Name}}})
+		}
+		data.{{.Meta.Name}}++
+		{{- end }}
 		receiver.AfterSaveHook(ctx, data, 0, affected)
 	}
 	return affected, err
@@ -401,6 +514,9 @@ func (receiver *{{.EntityName}}Dao) UpdateNoneZero(ctx context.Context, data *en
 		affected  int64
 	)
 	receiver.BeforeSaveHook(ctx, data)
+	{{- if .Audited }}
+	receiver.stamp(ctx, data, false)
+	{{- end }}
 	value := reflectutils.ValueOf(data).Interface()
 	if _, ok := value.(entity.{{.EntityName}}); !ok {
 		return 0, errors.New("underlying type of data should be entity.{{.EntityName}}")
@@ -412,6 +528,12 @@ func (receiver *{{.EntityName}}Dao) UpdateNoneZero(ctx context.Context, data *en
 		return 0, errors.Wrap(err, caller.NewCaller().String())
 	}
 	if affected, err = result.RowsAffected(); err == nil {
+		{{- with .VersionCol }}
+		if affected == 0 {
+			return 0, errors.WithStack(&governance.ConflictError{Table: "{{.Table}}", Version: data.{{.Meta.Name}}})
+		}
+		data.{{.Meta.Name}}++
+		{{- end }}
 		receiver.AfterSaveHook(ctx, data, 0, affected)
 	}
 	return affected, err
@@ -429,6 +551,14 @@ func (receiver *{{.EntityName}}Dao) UpdateMany(ctx context.Context, data []*enti
 		affected  int64
 	)
 	receiver.BeforeUpdateManyHook(ctx, data, &where)
+	{{- if .Audited }}
+	for _, item := range data {
+		receiver.stamp(ctx, item, false)
+	}
+	{{- end }}
+	{{- if .SoftCol }}
+	where = receiver.scope(ctx, where)
+	{{- end }}
 	if statement, err = templateutils.BlockMysql("{{.EntityName | ToLower}}dao.sql", {{.EntityName | ToLower}}daosql, "Update{{.EntityName}}s", nil); err != nil {
 		return 0, errors.Wrap(err, caller.NewCaller().String())
 	}
@@ -461,6 +591,14 @@ func (receiver *{{.EntityName}}Dao) UpdateManyNoneZero(ctx context.Context, data
 		affected  int64
 	)
 	receiver.BeforeUpdateManyHook(ctx, data, &where)
+	{{- if .Audited }}
+	for _, item := range data {
+		receiver.stamp(ctx, item, false)
+	}
+	{{- end }}
+	{{- if .SoftCol }}
+	where = receiver.scope(ctx, where)
+	{{- end }}
 	value := reflectutils.ValueOf(data).Interface()
 	if _, ok := value.(entity.{{.EntityName}}); !ok {
 		return 0, errors.New("underlying type of data should be entity.{{.EntityName}}")
@@ -489,12 +627,16 @@ func (receiver *{{.EntityName}}Dao) Get(ctx context.Context, dest *entity.{{.Ent
 	var (
 		statement string
 		err       error
-		{{.EntityName | ToLower}}      entity.{{.EntityName}}
 	)
 	if statement, err = templateutils.BlockMysql("{{.EntityName | ToLower}}dao.sql", {{.EntityName | ToLower}}daosql, "Get{{.EntityName}}", nil); err != nil {
 		return errors.Wrap(err, caller.NewCaller().String())
 	}
-	if err = receiver.db.GetContext(ctx, &{{.EntityName | ToLower}}, receiver.db.Rebind(statement), id); err != nil {
+	{{- if .SoftCol }}
+	if !governance.IsUnscoped(ctx) {
+		statement += " and {{.SoftCol.Name}} is null"
+	}
+	{{- end }}
+	if err = receiver.db.GetContext(ctx, dest, receiver.db.Rebind(statement), id); err != nil {
 		return errors.Wrap(err, caller.NewCaller().String())
 	}
 	return nil
@@ -507,6 +649,9 @@ func (receiver *{{.EntityName}}Dao) SelectMany(ctx context.Context, dest *[]enti
 		args       []interface{}
 	)
 	receiver.BeforeReadManyHook(ctx, nil, &where)
+	{{- if .SoftCol }}
+	where = receiver.scope(ctx, where)
+	{{- end }}
     statements = append(statements, "select * from {{.TableName}}")
 	if !where.IsEmpty() {
 		statements = append(statements, "where")
@@ -529,6 +674,9 @@ func (receiver *{{.EntityName}}Dao) CountMany(ctx context.Context, where query.W
 		args       []interface{}
 	)
 	receiver.BeforeReadManyHook(ctx, nil, &where)
+	{{- if .SoftCol }}
+	where = receiver.scope(ctx, where)
+	{{- end }}
 	statements = append(statements, "select count(1) from {{.TableName}}")
     if !where.IsEmpty() {
 		statements = append(statements, "where")
@@ -558,6 +706,9 @@ func (receiver *{{.EntityName}}Dao) PageMany(ctx context.Context, dest *{{.Entit
 		args       []interface{}
 	)
 	receiver.BeforeReadManyHook(ctx, &page, &where)
+	{{- if .SoftCol }}
+	where = receiver.scope(ctx, where)
+	{{- end }}
 	statements = append(statements, "select * from {{.TableName}}")
     if !where.IsEmpty() {
 		statements = append(statements, "where")
@@ -597,39 +748,20 @@ func (receiver *{{.EntityName}}Dao) PageMany(ctx context.Context, dest *{{.Entit
 		dest.HasNext = true
 	}
 	return nil
-}
-
-func (receiver *{{.EntityName}}Dao) DeleteManySoft(ctx context.Context, where query.Where) (int64, error) {
-	var (
-		err      error
-		result   sql.Result
-		w        string
-		args     []interface{}
-		affected int64
-	)
-	receiver.BeforeDeleteManyHook(ctx, nil, &where)
-	w, args = where.Sql()
-	args = append([]interface{}{time.Now()}, args...)
-	if result, err = receiver.db.ExecContext(ctx, receiver.db.Rebind(fmt.Sprintf("update {{.TableName}} set delete_at=? where %s;", w)), args...); err != nil {
-		return 0, errors.Wrap(err, caller.NewCaller().String())
-	}
-	if affected, err = result.RowsAffected(); err == nil {
-		receiver.AfterDeleteManyHook(ctx, nil, &where, affected)
-	}
-	return affected, err
 }`
 
-// GenDaoGo generates dao layer implementation code
-func GenDaoGo(entityPath string, t table.Table, folder ...string) error {
+// GenDaoGo generates dao layer implementation code.
+// Columns of t named by cols get soft delete scoping, audit and optimistic lock code.
+func GenDaoGo(entityPath string, t table.Table, cols governance.Columns, folder ...string) error {
 	var (
 		err      error
 		dpkg     string
 		daopath  string
-		f        *os.File
 		funcMap  map[string]interface{}
 		tpl      *template.Template
 		pkColumn table.Column
 		df       string
+		buf      bytes.Buffer
 	)
 	df = "dao"
 	if len(folder) > 0 {
@@ -640,13 +772,11 @@ func GenDaoGo(entityPath string, t table.Table, folder ...string) error {
 
 	daofile := filepath.Join(daopath, strings.ToLower(t.Meta.Name)+"dao.go")
 	if _, err = os.Stat(daofile); os.IsNotExist(err) {
-		f, _ = os.Create(daofile)
-		defer f.Close()
-
 		dpkg = astutils.GetImportPath(entityPath)
 		funcMap = make(map[string]interface{})
 		funcMap["ToLower"] = strings.ToLower
 		funcMap["ToSnake"] = strcase.ToSnake
+		funcMap["HasPrefix"] = strings.HasPrefix
 		tpl, _ = template.New("dao.go.tmpl").Funcs(funcMap).Parse(daoTmpl)
 		for _, column := range t.Columns {
 			if column.Pk {
@@ -654,21 +784,26 @@ func GenDaoGo(entityPath string, t table.Table, folder ...string) error {
 				break
 			}
 		}
-		_ = tpl.Execute(f, struct {
+		if err = tpl.Execute(&buf, struct {
 			EntityPackage string
 			EntityName    string
 			TableName     string
 			PkField       astutils.FieldMeta
 			PkCol         table.Column
 			Version       string
+			governedColumns
 		}{
-			EntityPackage: dpkg,
-			EntityName:    t.Meta.Name,
-			TableName:     t.Name,
-			PkField:       pkColumn.Meta,
-			PkCol:         pkColumn,
-			Version:       version.Release,
-		})
+			EntityPackage:   dpkg,
+			EntityName:      t.Meta.Name,
+			TableName:       t.Name,
+			PkField:         pkColumn.Meta,
+			PkCol:           pkColumn,
+			Version:         version.Release,
+			governedColumns: governedColumnsOf(t, cols),
+		}); err != nil {
+			return errors.Wrap(err, caller.NewCaller().String())
+		}
+		astutils.FixImport(buf.Bytes(), daofile)
 	} else {
 		log.Warnf("file %s already exists", daofile)
 	}
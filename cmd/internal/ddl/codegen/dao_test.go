@@ -0,0 +1,86 @@
+package codegen
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/iancoleman/strcase"
+	"github.com/stretchr/testify/require"
+	"github.com/unionj-cloud/go-doudou/v2/cmd/internal/ddl/table"
+	"github.com/unionj-cloud/go-doudou/v2/toolkit/astutils"
+	"github.com/unionj-cloud/go-doudou/v2/toolkit/governance"
+)
+
+func governedTable(softDelete string) table.Table {
+	column := func(name, typ string) table.Column {
+		return table.Column{Table: "book", Name: name, Meta: astutils.FieldMeta{Name: strcase.ToCamel(name), Type: typ}}
+	}
+	id := column("id", "int")
+	id.Pk = true
+	id.Autoincrement = true
+	return table.Table{
+		Name: "book",
+		Pk:   "id",
+		Meta: astutils.StructMeta{Name: "Book"},
+		Columns: []table.Column{
+			id,
+			column("title", "string"),
+			column(softDelete, "*time.Time"),
+			column("created_by", "string"),
+			column("updated_by", "string"),
+			column("version", "int64"),
+		},
+	}
+}
+
+func genDao(t *testing.T, tb table.Table) (string, string, string) {
+	dir := t.TempDir()
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "go.mod"), []byte("module testdata\n"), 0644))
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(dir))
+	defer os.Chdir(wd)
+	entityPath := filepath.Join(dir, "entity")
+	require.NoError(t, GenIDaoGo(entityPath, tb))
+	require.NoError(t, GenDaoGo(entityPath, tb, governance.DefaultColumns))
+	require.NoError(t, GenDaoSQL(entityPath, tb, governance.DefaultColumns))
+	read := func(name string) string {
+		b, err := ioutil.ReadFile(filepath.Join(dir, "dao", name))
+		require.NoError(t, err)
+		return string(b)
+	}
+	// backticks are escaped in the generated raw string literal
+	daosql := strings.ReplaceAll(read("bookdaosql.go"), "` + \"`\" + `", "`")
+	return read("bookdao.go"), daosql, read("ibookdao.go")
+}
+
+func TestGenDaoGoverned(t *testing.T) {
+	dao, daosql, idao := genDao(t, governedTable(governance.DefaultColumns.SoftDelete))
+
+	// soft delete
+	require.Contains(t, dao, `query.C().Col("deleted_at").IsNull().And(where)`)
+	require.Contains(t, dao, "update book set deleted_at=? where %s;")
+	require.Contains(t, dao, "func (receiver *BookDao) DeleteManySoft(")
+	require.Contains(t, idao, "// Deprecated: use DeleteMany")
+	require.Contains(t, idao, "DeleteManySoft(ctx context.Context, where query.Where) (int64, error)")
+	// audit columns
+	require.Contains(t, dao, "data.CreatedBy = principal")
+	require.Contains(t, dao, "data.UpdatedBy = principal")
+	// optimistic lock
+	require.Contains(t, dao, `governance.ConflictError{Table: "book", Version: data.Version}`)
+	require.Contains(t, daosql, "`version`=`version`+1")
+	require.Contains(t, daosql, "AND `version` =:version")
+	require.NotContains(t, daosql, "`created_by`=:created_by")
+}
+
+func TestGenDaoUngoverned(t *testing.T) {
+	dao, daosql, _ := genDao(t, governedTable("removed_at"))
+
+	require.NotContains(t, dao, "IsNull().And(where)")
+	require.NotContains(t, dao, "update book set")
+	require.Contains(t, dao, `errors.New("table book has no soft delete column")`)
+	require.Contains(t, daosql, "`removed_at`=:removed_at")
+}
@@ -5,6 +5,7 @@ import (
 	"github.com/iancoleman/strcase"
 	log "github.com/sirupsen/logrus"
 	"github.com/unionj-cloud/go-doudou/v2/toolkit/astutils"
+	"github.com/unionj-cloud/go-doudou/v2/toolkit/governance"
 	"github.com/unionj-cloud/go-doudou/v2/cmd/internal/ddl/table"
 	"github.com/unionj-cloud/go-doudou/v2/version"
 	"os"
@@ -19,6 +20,9 @@ var daosqltmpl = `{{` + "`" + `{{` + "`" + `}}define "NoneZeroSet"{{` + "`" + `}
 	` + "`" + `{{$co.Name}}` + "`" + `=:{{$co.Name}},
 	{{` + "`" + `{{` + "`" + `}}- end{{` + "`" + `}}` + "`" + `}}
 	{{- end}}
+	{{- with .VersionCol}}
+	` + "`" + `{{.Name}}` + "`" + `=` + "`" + `{{.Name}}` + "`" + `+1,
+	{{- end }}
 {{` + "`" + `{{` + "`" + `}}end{{` + "`" + `}}` + "`" + `}}
 
 {{` + "`" + `{{` + "`" + `}}define "Insert{{.EntityName}}"{{` + "`" + `}}` + "`" + `}}
@@ -40,8 +44,14 @@ SET
 	{{- if $i}},{{end}}
 	` + "`" + `{{$co.Name}}` + "`" + `=:{{$co.Name}}
 	{{- end }}
+	{{- with .VersionCol}},
+	` + "`" + `{{.Name}}` + "`" + `=` + "`" + `{{.Name}}` + "`" + `+1
+	{{- end }}
 WHERE
     ` + "`" + `{{.Pk.Name}}` + "`" + ` =:{{.Pk.Name}}
+	{{- with .VersionCol}}
+    AND ` + "`" + `{{.Name}}` + "`" + ` =:{{.Name}}
+	{{- end }}
 {{` + "`" + `{{` + "`" + `}}end{{` + "`" + `}}` + "`" + `}}
 
 {{` + "`" + `{{` + "`" + `}}define "Update{{.EntityName}}NoneZero"{{` + "`" + `}}` + "`" + `}}
@@ -50,6 +60,9 @@ SET
     {{` + "`" + `{{` + "`" + `}}Eval "NoneZeroSet" . | TrimSuffix ","{{` + "`" + `}}` + "`" + `}}
 WHERE
     ` + "`" + `{{.Pk.Name}}` + "`" + `=:{{.Pk.Name}}
+	{{- with .VersionCol}}
+    AND ` + "`" + `{{.Name}}` + "`" + ` =:{{.Name}}
+	{{- end }}
 {{` + "`" + `{{` + "`" + `}}end{{` + "`" + `}}` + "`" + `}}
 
 {{` + "`" + `{{` + "`" + `}}define "Upsert{{.EntityName}}"{{` + "`" + `}}` + "`" + `}}
@@ -67,6 +80,9 @@ UPDATE
 		{{- if $i}},{{end}}
 		` + "`" + `{{$co.Name}}` + "`" + `=:{{$co.Name}}
 		{{- end }}
+		{{- with .VersionCol}},
+		` + "`" + `{{.Name}}` + "`" + `=` + "`" + `{{.Name}}` + "`" + `+1
+		{{- end }}
 {{` + "`" + `{{` + "`" + `}}end{{` + "`" + `}}` + "`" + `}}
 
 {{` + "`" + `{{` + "`" + `}}define "Upsert{{.EntityName}}NoneZero"{{` + "`" + `}}` + "`" + `}}
@@ -96,6 +112,9 @@ SET
 	{{- if $i}},{{end}}
 	` + "`" + `{{$co.Name}}` + "`" + `=:{{$co.Name}}
 	{{- end }}
+	{{- with .VersionCol}},
+	` + "`" + `{{.Name}}` + "`" + `=` + "`" + `{{.Name}}` + "`" + `+1
+	{{- end }}
 {{` + "`" + `{{` + "`" + `}}end{{` + "`" + `}}` + "`" + `}}
 
 {{` + "`" + `{{` + "`" + `}}define "Update{{.EntityName}}sNoneZero"{{` + "`" + `}}` + "`" + `}}
@@ -123,6 +142,9 @@ UPDATE
 		{{- if $i}},{{end}}
 		` + "`" + `{{$co.Name}}` + "`" + `=VALUES({{$co.Name}})
 		{{- end }}
+		{{- with .VersionCol}},
+		` + "`" + `{{.Name}}` + "`" + `=` + "`" + `{{.Name}}` + "`" + `+1
+		{{- end }}
 {{` + "`" + `{{` + "`" + `}}end{{` + "`" + `}}` + "`" + `}}
 
 {{` + "`" + `{{` + "`" + `}}define "UpdateClauseSelect{{.EntityName}}"{{` + "`" + `}}` + "`" + `}}
@@ -134,8 +156,9 @@ UPDATE
 		{{` + "`" + `{{` + "`" + `}}- end {{` + "`" + `}}` + "`" + `}}
 {{` + "`" + `{{` + "`" + `}}end{{` + "`" + `}}` + "`" + `}}`
 
-// GenDaoSQL generates sql statements used by dao layer
-func GenDaoSQL(entityPath string, t table.Table, folder ...string) error {
+// GenDaoSQL generates sql statements used by dao layer.
+// Columns of t named by cols get optimistic lock conditions and are protected from being overwritten.
+func GenDaoSQL(entityPath string, t table.Table, cols governance.Columns, folder ...string) error {
 	var (
 		err      error
 		daopath  string
@@ -162,11 +185,12 @@ func GenDaoSQL(entityPath string, t table.Table, folder ...string) error {
 		funcMap["ToSnake"] = strcase.ToSnake
 		tpl, _ = template.New("daosql.tmpl").Funcs(funcMap).Parse(daosqltmpl)
 
+		governed := governedColumnsOf(t, cols)
 		for _, co := range t.Columns {
 			if !co.AutoSet {
 				iColumns = append(iColumns, co)
 			}
-			if !co.AutoSet && !co.Pk {
+			if !co.AutoSet && !co.Pk && !governed.skipUpdate(co) {
 				uColumns = append(uColumns, co)
 			}
 		}
@@ -185,6 +209,7 @@ func GenDaoSQL(entityPath string, t table.Table, folder ...string) error {
 			InsertColumns []table.Column
 			UpdateColumns []table.Column
 			Pk            table.Column
+			VersionCol    *table.Column
 		}{
 			Schema:        os.Getenv("DB_SCHEMA"),
 			TableName:     t.Name,
@@ -192,6 +217,7 @@ func GenDaoSQL(entityPath string, t table.Table, folder ...string) error {
 			InsertColumns: iColumns,
 			UpdateColumns: uColumns,
 			Pk:            pkColumn,
+			VersionCol:    governed.VersionCol,
 		})
 		sqlStr := strings.TrimSpace(sqlBuf.String())
 		sqlStr = strings.ReplaceAll(sqlStr, "`", "`"+" + "+`"`+"`"+`"`+" + "+"`")
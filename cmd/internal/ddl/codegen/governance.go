@@ -0,0 +1,54 @@
+package codegen
+
+import (
+	"strings"
+
+	"github.com/unionj-cloud/go-doudou/v2/cmd/internal/ddl/table"
+	"github.com/unionj-cloud/go-doudou/v2/toolkit/governance"
+)
+
+// governedColumns holds columns of a table which are managed by generated dao code
+type governedColumns struct {
+	SoftCol      *table.Column
+	CreatedByCol *table.Column
+	UpdatedByCol *table.Column
+	VersionCol   *table.Column
+}
+
+// Audited reports whether the table has any audit column
+func (g governedColumns) Audited() bool {
+	return g.CreatedByCol != nil || g.UpdatedByCol != nil
+}
+
+// skipUpdate reports whether column c should not be overwritten by update statements
+func (g governedColumns) skipUpdate(c table.Column) bool {
+	return (g.CreatedByCol != nil && g.CreatedByCol.Name == c.Name) || (g.VersionCol != nil && g.VersionCol.Name == c.Name)
+}
+
+func governedColumnsOf(t table.Table, cols governance.Columns) governedColumns {
+	var g governedColumns
+	for i := range t.Columns {
+		co := &t.Columns[i]
+		if co.Pk {
+			continue
+		}
+		fieldType := strings.TrimPrefix(co.Meta.Type, "*")
+		switch co.Name {
+		case cols.SoftDelete:
+			g.SoftCol = co
+		case cols.CreatedBy:
+			if fieldType == "string" {
+				g.CreatedByCol = co
+			}
+		case cols.UpdatedBy:
+			if fieldType == "string" {
+				g.UpdatedByCol = co
+			}
+		case cols.Version:
+			if strings.HasPrefix(co.Meta.Type, "int") || strings.HasPrefix(co.Meta.Type, "uint") {
+				g.VersionCol = co
+			}
+		}
+	}
+	return g
+}
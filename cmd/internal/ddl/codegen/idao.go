@@ -42,6 +42,7 @@ type I{{.EntityName}}Dao interface {
 	SelectMany(ctx context.Context, dest *[]entity.{{.EntityName}}, where query.Where) error
 	CountMany(ctx context.Context, where query.Where) (int, error)
 	PageMany(ctx context.Context, dest *{{.EntityName}}PageRet, page query.Page, where query.Where) error
+	// Deprecated: use DeleteMany, which soft deletes rows if the table has soft delete column
 	DeleteManySoft(ctx context.Context, where query.Where) (int64, error)
 
 	// hooks
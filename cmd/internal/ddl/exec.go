@@ -7,6 +7,7 @@ import (
 	"github.com/sirupsen/logrus"
 	"github.com/unionj-cloud/go-doudou/v2/toolkit/astutils"
 	"github.com/unionj-cloud/go-doudou/v2/toolkit/caller"
+	"github.com/unionj-cloud/go-doudou/v2/toolkit/governance"
 	"os"
 	"path/filepath"
 	"strings"
@@ -29,6 +30,8 @@ type Ddl struct {
 	Pre     string
 	Df      string
 	Conf    config.DbConfig
+	// Governed names soft delete, audit and optimistic lock columns used by generated dao code
+	Governed governance.Columns
 }
 
 // Exec executes the logic for ddl command
@@ -91,10 +94,10 @@ func genDao(d Ddl, tables []table.Table) {
 		if err = codegen.GenIDaoGo(d.Dir, t, d.Df); err != nil {
 			panic(errors.Wrap(err, caller.NewCaller().String()))
 		}
-		if err = codegen.GenDaoGo(d.Dir, t, d.Df); err != nil {
+		if err = codegen.GenDaoGo(d.Dir, t, d.Governed, d.Df); err != nil {
 			panic(errors.Wrap(err, caller.NewCaller().String()))
 		}
-		if err = codegen.GenDaoSQL(d.Dir, t, d.Df); err != nil {
+		if err = codegen.GenDaoSQL(d.Dir, t, d.Governed, d.Df); err != nil {
 			panic(errors.Wrap(err, caller.NewCaller().String()))
 		}
 	}
@@ -65,6 +65,7 @@ func parseSelectorExpr(expr *ast.SelectorExpr) string {
 		!strings.HasPrefix(result, "customtypes.") &&
 		result != "context.Context" &&
 		result != "time.Time" &&
+		result != "time.Duration" &&
 		result != "v3.FileModel" &&
 		result != "multipart.FileHeader" &&
 		result != "decimal.Decimal" &&
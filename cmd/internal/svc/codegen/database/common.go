@@ -122,6 +122,10 @@ func (b *AbstractBaseGenerator) GenService() {
 		envContent += fmt.Sprintf(`GDD_DB_DSN=%s`, b.Dsn)
 		envContent += constants.LineBreak
 	}
+	if !strings.Contains(envContent, "GDD_DB_GOVERNANCE_ENABLE") {
+		envContent += `GDD_DB_GOVERNANCE_ENABLE=true`
+		envContent += constants.LineBreak
+	}
 	ioutil.WriteFile(envfile, []byte(envContent), os.ModePerm)
 
 	b.dto()
@@ -191,6 +195,7 @@ func (b *AbstractBaseGenerator) GenService() {
 			panic(err)
 		}
 		os.Chdir(wd)
+		codegen.GenGrpcConverter(b.Dir, grpcSvc)
 		b.svcImplGrpc(grpcSvc)
 		codegen.GenMainGrpc(b.Dir, ic, grpcSvc)
 		codegen.FixModGrpc(b.Dir)
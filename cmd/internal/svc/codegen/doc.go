@@ -5,10 +5,12 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/iancoleman/strcase"
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"github.com/unionj-cloud/go-doudou/v2/toolkit/astutils"
 	"github.com/unionj-cloud/go-doudou/v2/toolkit/constants"
 	v3 "github.com/unionj-cloud/go-doudou/v2/toolkit/openapi/v3"
+	paginate "github.com/unionj-cloud/go-doudou/v2/toolkit/pagination/gorm"
 	"github.com/unionj-cloud/go-doudou/v2/toolkit/stringutils"
 	"go/ast"
 	"go/parser"
@@ -173,9 +175,65 @@ func operationOf(method astutils.MethodMeta, httpMethod string, config GenDocCon
 
 	ret.Parameters = params
 	ret.Responses = response(method)
+	if hasFilterSchema(method) {
+		filterSchema, err := paginate.FilterSchemaOf(methodAnnotations(method.Annotations), method.Name)
+		if err != nil {
+			panic(errors.Wrapf(err, "invalid filter annotations of method %s", method.Name))
+		}
+		ret.XFilterSchema = filterSchema
+		ret.Responses.Resp400 = filterErrorResponse()
+	}
 	return ret
 }
 
+type methodAnnotations []astutils.Annotation
+
+func (receiver methodAnnotations) GetParams(_ string, annotationName string) []string {
+	var params []string
+	for _, item := range receiver {
+		if item.Name == annotationName {
+			params = append(params, item.Params...)
+		}
+	}
+	return params
+}
+
+func filterErrorResponse() *v3.Response {
+	title := "FilterErrorResp"
+	v3.Schemas[title] = v3.Schema{
+		Type:  v3.ObjectT,
+		Title: title,
+		Properties: map[string]*v3.Schema{
+			"code":    v3.Int,
+			"message": v3.String,
+			"details": {
+				Type: v3.ArrayT,
+				Items: &v3.Schema{
+					Type: v3.ObjectT,
+					Properties: map[string]*v3.Schema{
+						"param":    v3.String,
+						"field":    v3.String,
+						"operator": v3.String,
+						"reason":   v3.String,
+					},
+					Required: []string{"param", "reason"},
+				},
+			},
+		},
+		Required: []string{"code", "message"},
+	}
+	return &v3.Response{
+		Description: "filters or sort not allowed by the endpoint",
+		Content: &v3.Content{
+			JSON: &v3.MediaType{
+				Schema: &v3.Schema{
+					Ref: "#/components/schemas/" + title,
+				},
+			},
+		},
+	}
+}
+
 func response(method astutils.MethodMeta) *v3.Responses {
 	var respContent v3.Content
 	var hasFile bool
@@ -378,15 +436,35 @@ type GenDocConfig struct {
 // GenDoc generates OpenAPI 3.0 description json file.
 // Not support alias type in vo or dto file.
 func GenDoc(dir string, ic astutils.InterfaceCollector, config GenDocConfig) {
+	svcname := ic.Interfaces[0].Name
+	writeDoc(dir, ic, v3.API{
+		Openapi: "3.0.2",
+		Info: &v3.Info{
+			Title:       svcname,
+			Description: strings.Join(ic.Interfaces[0].Comments, "\n"),
+			Version:     fmt.Sprintf("v%s", time.Now().Local().Format(constants.FORMAT10)),
+		},
+		Servers: []v3.Server{
+			{
+				URL: fmt.Sprintf("http://localhost:%d", 6060),
+			},
+		},
+		Paths: pathsOf(ic, config),
+		Components: &v3.Components{
+			Schemas: v3.Schemas,
+		},
+	})
+}
+
+// writeDoc writes api to json file and go file assigning it to rest.Oas
+func writeDoc(dir string, ic astutils.InterfaceCollector, api v3.API) {
 	var (
 		err     error
 		svcname string
 		docfile string
 		gofile  string
 		fi      os.FileInfo
-		api     v3.API
 		data    []byte
-		paths   map[string]v3.Path
 		tpl     *template.Template
 		sqlBuf  bytes.Buffer
 		source  string
@@ -408,24 +486,6 @@ func GenDoc(dir string, ic astutils.InterfaceCollector, config GenDocConfig) {
 	if fi != nil {
 		logrus.Warningln("file " + gofile + " will be overwritten")
 	}
-	paths = pathsOf(ic, config)
-	api = v3.API{
-		Openapi: "3.0.2",
-		Info: &v3.Info{
-			Title:       svcname,
-			Description: strings.Join(ic.Interfaces[0].Comments, "\n"),
-			Version:     fmt.Sprintf("v%s", time.Now().Local().Format(constants.FORMAT10)),
-		},
-		Servers: []v3.Server{
-			{
-				URL: fmt.Sprintf("http://localhost:%d", 6060),
-			},
-		},
-		Paths: paths,
-		Components: &v3.Components{
-			Schemas: v3.Schemas,
-		},
-	}
 	data, err = json.Marshal(api)
 	err = ioutil.WriteFile(docfile, data, os.ModePerm)
 	if err != nil {
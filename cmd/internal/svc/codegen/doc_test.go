@@ -1,6 +1,7 @@
 package codegen
 
 import (
+	"encoding/json"
 	"fmt"
 	. "github.com/smartystreets/goconvey/convey"
 	"github.com/unionj-cloud/go-doudou/v2/toolkit/astutils"
@@ -163,3 +164,34 @@ func Test_pathsOf(t *testing.T) {
 		})
 	}
 }
+
+func TestOperationOfFilterSchema(t *testing.T) {
+	Convey("Operation should describe filter schema declared by annotations", t, func() {
+		method := astutils.MethodMeta{
+			Name: "GetUsers",
+			Params: []astutils.FieldMeta{
+				{Name: "ctx", Type: "context.Context"},
+				{Name: "parameter", Type: "dto.Parameter"},
+			},
+			Results: []astutils.FieldMeta{
+				{Name: "data", Type: "dto.Page"},
+				{Name: "err", Type: "error"},
+			},
+			Annotations: []astutils.Annotation{
+				{Name: "@filter", Params: []string{"name:string:=|like", "age:int:>"}},
+				{Name: "@sort", Params: []string{"name"}},
+				{Name: "@filterdepth", Params: []string{"2"}},
+			},
+		}
+		op := operationOf(method, "GET", GenDocConfig{})
+		So(op.XFilterSchema, ShouldNotBeNil)
+		b, _ := json.Marshal(op.XFilterSchema)
+		So(string(b), ShouldEqual, `{"fields":{"age":{"type":"int","operators":["\u003e"]},"name":{"type":"string","operators":["=","LIKE"]}},"sorts":["name"],"maxDepth":2}`)
+		So(op.Responses.Resp400.Content.JSON.Schema.Ref, ShouldEqual, "#/components/schemas/FilterErrorResp")
+
+		method.Annotations = nil
+		op = operationOf(method, "GET", GenDocConfig{})
+		So(op.XFilterSchema, ShouldBeNil)
+		So(op.Responses.Resp400, ShouldBeNil)
+	})
+}
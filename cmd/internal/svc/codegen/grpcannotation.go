@@ -8,6 +8,7 @@ import (
 	"strings"
 	"text/template"
 
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"github.com/unionj-cloud/go-doudou/v2/toolkit/astutils"
 )
@@ -20,6 +21,7 @@ package grpc
 
 import (
 	"github.com/unionj-cloud/go-doudou/v2/framework"
+	"github.com/unionj-cloud/go-doudou/v2/framework/grpcx/interceptors/grpcx_validator"
 )
 
 var MethodAnnotationStore = framework.AnnotationStore{
@@ -42,8 +44,44 @@ var MethodAnnotationStore = framework.AnnotationStore{
 	{{- end }}
 	{{- end }}
 }
+
+// ValidationRules is built from @validate annotations of method parameters
+var ValidationRules = grpcx_validator.Rules{
+	{{- range $m := .Meta.Methods }}
+	{{- if hasValidateTag $m.Params }}
+	"{{$m.Name}}Rpc": {
+		{{- range $p := $m.Params }}
+		{{- if $p.ValidateTag }}
+		"{{ $p.Name }}": "{{ $p.ValidateTag }}",
+		{{- end }}
+		{{- end }}
+	},
+	{{- end }}
+	{{- end }}
+}
 `
 
+func hasValidateTag(params []astutils.FieldMeta) bool {
+	for _, p := range params {
+		if p.ValidateTag != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// checkAuthAnnotations rejects @role and @permission without params, which would authorize nobody or everybody
+func checkAuthAnnotations(meta astutils.InterfaceMeta) error {
+	for _, m := range meta.Methods {
+		for _, a := range m.Annotations {
+			if (a.Name == "@role" || a.Name == "@permission") && len(a.Params) == 0 {
+				return errors.Errorf("%s annotation of method %s has no params, e.g. %s(admin)", a.Name, m.Name, a.Name)
+			}
+		}
+	}
+	return nil
+}
+
 func GenMethodAnnotationStore(dir string, ic astutils.InterfaceCollector) {
 	var (
 		err            error
@@ -55,6 +93,9 @@ func GenMethodAnnotationStore(dir string, ic astutils.InterfaceCollector) {
 		sqlBuf         bytes.Buffer
 		fi             os.FileInfo
 	)
+	if err = checkAuthAnnotations(ic.Interfaces[0]); err != nil {
+		panic(err)
+	}
 	grpcDir = filepath.Join(dir, "transport/grpc")
 	if err = os.MkdirAll(grpcDir, os.ModePerm); err != nil {
 		panic(err)
@@ -72,7 +113,9 @@ func GenMethodAnnotationStore(dir string, ic astutils.InterfaceCollector) {
 	}
 	defer f.Close()
 
-	if tpl, err = template.New("annotation.go.tmpl").Parse(annotationTmpl); err != nil {
+	funcMap := make(map[string]interface{})
+	funcMap["hasValidateTag"] = hasValidateTag
+	if tpl, err = template.New("annotation.go.tmpl").Funcs(funcMap).Parse(annotationTmpl); err != nil {
 		panic(err)
 	}
 	if err = tpl.Execute(&sqlBuf, struct {
@@ -0,0 +1,56 @@
+package codegen
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/unionj-cloud/go-doudou/v2/toolkit/astutils"
+)
+
+func TestGenMethodAnnotationStore(t *testing.T) {
+	dir := t.TempDir()
+	svcfile := filepath.Join(dir, "svc.go")
+	require.NoError(t, os.WriteFile(svcfile, []byte(`package usersvc
+
+import "context"
+
+type Usersvc interface {
+	// @role(admin)
+	GetUser(ctx context.Context,
+		// @validate(required,gt=0)
+		userId int,
+		photo string) (data string, err error)
+}
+`), 0644))
+	ic := astutils.BuildInterfaceCollector(svcfile, astutils.ExprString)
+	GenMethodAnnotationStore(dir, ic)
+	content, err := ioutil.ReadFile(filepath.Join(dir, "transport", "grpc", "annotation.go"))
+	require.NoError(t, err)
+	require.Contains(t, string(content), `"GetUserRpc": {
+		"userId": "required,gt=0",
+	},`)
+	require.Contains(t, string(content), `Name: "@role",`)
+}
+
+func TestGenMethodAnnotationStoreRoleWithoutParams(t *testing.T) {
+	dir := t.TempDir()
+	svcfile := filepath.Join(dir, "svc.go")
+	require.NoError(t, os.WriteFile(svcfile, []byte(`package usersvc
+
+import "context"
+
+type Usersvc interface {
+	// @role()
+	GetUser(ctx context.Context, userId int) (data string, err error)
+}
+`), 0644))
+	ic := astutils.BuildInterfaceCollector(svcfile, astutils.ExprString)
+	require.PanicsWithError(t, "@role annotation of method GetUser has no params, e.g. @role(admin)", func() {
+		GenMethodAnnotationStore(dir, ic)
+	})
+	_, err := os.Stat(filepath.Join(dir, "transport", "grpc", "annotation.go"))
+	require.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,326 @@
+package codegen
+
+import (
+	"bytes"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/iancoleman/strcase"
+	"github.com/sirupsen/logrus"
+	"github.com/unionj-cloud/go-doudou/v2/toolkit/astutils"
+	v3 "github.com/unionj-cloud/go-doudou/v2/toolkit/protobuf/v3"
+	"github.com/unionj-cloud/go-doudou/v2/version"
+)
+
+var grpcClientTmpl = `/**
+* Generated by go-doudou {{.Version}}.
+* Don't edit!
+*/
+package grpcclient
+
+import (
+	"context"
+	"time"
+
+	"github.com/slok/goresilience"
+	"github.com/slok/goresilience/circuitbreaker"
+	"github.com/slok/goresilience/retry"
+	"github.com/slok/goresilience/timeout"
+	"github.com/unionj-cloud/go-doudou/v2/framework/grpcx/interceptors/grpcx_hedging"
+	"github.com/unionj-cloud/go-doudou/v2/framework/registry"
+	logger "github.com/unionj-cloud/go-doudou/v2/toolkit/zlogger"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/emptypb"
+	{{.ServiceAlias}} "{{.ServicePackage}}"
+	pb "{{.PbPackage}}"
+	{{- range $i := .Imports }}
+	{{$i}}
+	{{- end }}
+)
+
+var _ {{.ServiceAlias}}.{{.Meta.Name}} = (*{{.Meta.Name}}GrpcClient)(nil)
+
+// {{.Meta.Name}}GrpcClient implements {{.ServiceAlias}}.{{.Meta.Name}} by calling {{.GrpcSvc.Name}} over grpc,
+// so it can be used in place of the rest client
+type {{.Meta.Name}}GrpcClient struct {
+	conn        *grpc.ClientConn
+	client      pb.{{.GrpcSvc.Name}}Client
+	runner      goresilience.Runner
+	connOptions []registry.GrpcClientOption
+}
+
+// GrpcClientOption configures {{.Meta.Name}}GrpcClient
+type GrpcClientOption func(*{{.Meta.Name}}GrpcClient)
+
+// WithConn makes the client call the service over conn instead of creating a new connection
+func WithConn(conn *grpc.ClientConn) GrpcClientOption {
+	return func(c *{{.Meta.Name}}GrpcClient) {
+		c.conn = conn
+	}
+}
+
+// WithConnOptions sets discovery mode, load balancing policy and dial options of the connection,
+// e.g. registry.WithDiscoveryMode("etcd"), registry.WithLoadBalancing(registry.LB_WEIGHTED)
+func WithConnOptions(opts ...registry.GrpcClientOption) GrpcClientOption {
+	return func(c *{{.Meta.Name}}GrpcClient) {
+		c.connOptions = append(c.connOptions, opts...)
+	}
+}
+
+// WithRunner sets goresilience runner wrapping each unary call
+func WithRunner(runner goresilience.Runner) GrpcClientOption {
+	return func(c *{{.Meta.Name}}GrpcClient) {
+		c.runner = runner
+	}
+}
+
+// New{{.Meta.Name}}GrpcClient creates a client of service registered by grpc server with name service, i.e. its
+// GDD_SERVICE_NAME suffixed by _grpc, discovered by the mode from GDD_SERVICE_DISCOVERY_MODE by default
+func New{{.Meta.Name}}GrpcClient(service string, opts ...GrpcClientOption) *{{.Meta.Name}}GrpcClient {
+	c := &{{.Meta.Name}}GrpcClient{}
+	for _, opt := range opts {
+		opt(c)
+	}
+	if c.conn == nil {
+		{{- if .Hedged }}
+		// calls of methods annotated by @hedge() are sent again to another instance if they take longer than usual
+		c.connOptions = append([]registry.GrpcClientOption{
+			registry.WithDialOptions(grpc.WithChainUnaryInterceptor(grpcx_hedging.UnaryClientInterceptor(pb.MethodAnnotationStore, nil))),
+		}, c.connOptions...)
+		{{- end }}
+		c.conn = registry.NewGrpcClientConn(service, c.connOptions...)
+	}
+	c.client = pb.New{{.GrpcSvc.Name}}Client(c.conn)
+	if c.runner == nil {
+		c.runner = goresilience.RunnerChain(
+			circuitbreaker.NewMiddleware(circuitbreaker.Config{
+				ErrorPercentThresholdToOpen:        50,
+				MinimumRequestToOpen:               6,
+				SuccessfulRequiredOnHalfOpen:       1,
+				WaitDurationInOpenState:            5 * time.Second,
+				MetricsSlidingWindowBucketQuantity: 10,
+				MetricsBucketDuration:              1 * time.Second,
+			}),
+			timeout.NewMiddleware(timeout.Config{
+				Timeout: 3 * time.Minute,
+			}),
+			retry.NewMiddleware(retry.Config{
+				Times: 3,
+			}),
+		)
+	}
+	return c
+}
+
+// Client returns the underlying client generated by protoc-gen-go-grpc, e.g. for calling streaming rpcs
+func (receiver *{{.Meta.Name}}GrpcClient) Client() pb.{{.GrpcSvc.Name}}Client {
+	return receiver.client
+}
+
+// Close closes the underlying connection
+func (receiver *{{.Meta.Name}}GrpcClient) Close() error {
+	return receiver.conn.Close()
+}
+{{- range $m := .Methods }}
+
+{{ $m }}
+{{- end }}
+`
+
+// grpcClientMethod returns implementation of service interface method calling the rpc
+func grpcClientMethod(c *converter, svcName, alias string, method astutils.MethodMeta, rpc v3.Rpc) string {
+	c.seq = 0
+	ctx := "_ctx"
+	var params, results []string
+	var errResult string
+	method.Params = append([]astutils.FieldMeta(nil), method.Params...)
+	method.Results = append([]astutils.FieldMeta(nil), method.Results...)
+	for i, p := range method.Params {
+		if p.Name == "" {
+			p.Name = "p" + strconv.Itoa(i)
+			method.Params[i] = p
+		}
+		if p.Type == "context.Context" && i == 0 {
+			ctx = p.Name
+		}
+		params = append(params, p.Name+" "+p.Type)
+	}
+	for i, r := range method.Results {
+		if r.Name == "" {
+			r.Name = "r" + strconv.Itoa(i)
+			method.Results[i] = r
+		}
+		if r.Type == "error" {
+			errResult = r.Name
+		}
+		results = append(results, r.Name+" "+r.Type)
+	}
+	var b strings.Builder
+	for _, comment := range method.Comments {
+		b.WriteString("// " + comment + "\n")
+	}
+	fmt.Fprintf(&b, "func (receiver *%sGrpcClient) %s(%s) (%s) {\n", svcName, method.Name, strings.Join(params, ", "), strings.Join(results, ", "))
+	fail := func(err string) string {
+		if errResult != "" {
+			return errResult + " = " + err
+		}
+		return fmt.Sprintf("logger.Error().Err(%s).Msg(\"[go-doudou] call %s fail\")", err, rpc.Name)
+	}
+	if rpc.StreamType != 0 {
+		b.WriteString(fail(fmt.Sprintf("status.Error(codes.Unimplemented, \"streaming rpc %s should be called through Client()\")", rpc.Name)))
+		b.WriteString("\nreturn\n}")
+		return b.String()
+	}
+	if ctx == "_ctx" {
+		b.WriteString("_ctx := context.Background()\n")
+	}
+	params = params[:0]
+	var goTypes []string
+	for _, p := range method.Params {
+		if p.Name == ctx {
+			continue
+		}
+		params = append(params, p.Name)
+		goTypes = append(goTypes, qualify(strings.Replace(p.Type, "...", "[]", 1), alias))
+	}
+	fmt.Fprintf(&b, "_request := &%s{}\n", convert(rpc.Request))
+	switch {
+	case len(params) == 0:
+	case rpc.Request.Name == strcase.ToCamel(rpc.Name+"Request"):
+		for i, f := range rpc.Request.Fields {
+			b.WriteString(c.fieldToPb(f, goTypes[i], params[i], "_request") + "\n")
+		}
+	default:
+		code, ok := c.toPb(goTypes[0], rpc.Request.Name, params[0], func(e string) string {
+			return "_request = " + e
+		})
+		if !ok {
+			code = fmt.Sprintf("// parameter %s of type %s is not converted", params[0], goTypes[0])
+		}
+		b.WriteString(code + "\n")
+	}
+	results = results[:0]
+	goTypes = goTypes[:0]
+	for _, r := range method.Results {
+		if r.Name == errResult {
+			continue
+		}
+		results = append(results, r.Name)
+		goTypes = append(goTypes, qualify(r.Type, alias))
+	}
+	fmt.Fprintf(&b, "if _err := receiver.runner.Run(%s, func(ctx context.Context) error {\n", ctx)
+	response := "_response"
+	if len(results) == 0 {
+		response = "_"
+	}
+	fmt.Fprintf(&b, "%s, _err := receiver.client.%s(ctx, _request)\nif _err != nil {\nreturn _err\n}\n", response, rpc.Name)
+	switch {
+	case len(results) == 0:
+	case rpc.Response.Name == strcase.ToCamel(rpc.Name+"Response"):
+		for i, f := range rpc.Response.Fields {
+			b.WriteString(c.fieldFromPb(f, goTypes[i], "_response", results[i]) + "\n")
+		}
+	default:
+		code, ok := c.fromPb(goTypes[0], rpc.Response.Name, "_response", func(e string) string {
+			return results[0] + " = " + e
+		})
+		if !ok {
+			code = fmt.Sprintf("// result %s of type %s is not converted", results[0], goTypes[0])
+		}
+		b.WriteString(code + "\n")
+	}
+	b.WriteString("return nil\n}); _err != nil {\n" + fail("_err") + "\n}\nreturn\n}")
+	return b.String()
+}
+
+// svcImports returns import specs of svc.go except context, unused ones are removed by FixImport
+func svcImports(dir string) []string {
+	root, err := parser.ParseFile(token.NewFileSet(), filepath.Join(dir, "svc.go"), nil, parser.ImportsOnly)
+	if err != nil {
+		return nil
+	}
+	var ret []string
+	for _, spec := range root.Imports {
+		if spec.Path.Value == `"context"` {
+			continue
+		}
+		if spec.Name != nil {
+			ret = append(ret, spec.Name.Name+" "+spec.Path.Value)
+			continue
+		}
+		ret = append(ret, spec.Path.Value)
+	}
+	return ret
+}
+
+// GenGrpcClient generates client/grpcclient package implementing the service interface in svc.go by calling
+// the grpc service, so callers can swap rest and grpc transports
+func GenGrpcClient(dir string, ic astutils.InterfaceCollector, grpcSvc v3.Service) {
+	var (
+		err        error
+		clientDir  string
+		clientFile string
+		tpl        *template.Template
+		buf        bytes.Buffer
+	)
+	clientDir = filepath.Join(dir, "client", "grpcclient")
+	if err = MkdirAll(clientDir, os.ModePerm); err != nil {
+		panic(err)
+	}
+	clientFile = filepath.Join(clientDir, "grpcclient.go")
+	if _, err = Stat(clientFile); err == nil {
+		logrus.Warningln("file " + clientFile + " will be overwritten")
+	}
+	meta := ic.Interfaces[0]
+	alias := ic.Package.Name
+	c := newConverter(grpcSvc)
+	c.prefix = "pb."
+	rpcs := make(map[string]v3.Rpc)
+	for _, rpc := range grpcSvc.Rpcs {
+		rpcs[rpc.Name] = rpc
+	}
+	var methods []string
+	for _, method := range meta.Methods {
+		rpc, ok := rpcs[strcase.ToCamel(method.Name)+"Rpc"]
+		if !ok {
+			continue
+		}
+		methods = append(methods, grpcClientMethod(c, meta.Name, alias, method, rpc))
+	}
+	if tpl, err = template.New("grpcclient.go.tmpl").Parse(grpcClientTmpl); err != nil {
+		panic(err)
+	}
+	if err = tpl.Execute(&buf, struct {
+		Version        string
+		Meta           astutils.InterfaceMeta
+		GrpcSvc        v3.Service
+		ServiceAlias   string
+		ServicePackage string
+		PbPackage      string
+		Imports        []string
+		Methods        []string
+		Hedged         bool
+	}{
+		Version:        version.Release,
+		Meta:           meta,
+		GrpcSvc:        grpcSvc,
+		ServiceAlias:   alias,
+		ServicePackage: astutils.GetPkgPath(dir),
+		PbPackage:      astutils.GetPkgPath(filepath.Join(dir, "transport", "grpc")),
+		Imports:        svcImports(dir),
+		Methods:        methods,
+		Hedged:         hasHedged(meta.Methods),
+	}); err != nil {
+		panic(err)
+	}
+	astutils.FixImport(buf.Bytes(), clientFile)
+}
@@ -0,0 +1,577 @@
+package codegen
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/unionj-cloud/go-doudou/v2/toolkit/astutils"
+	v3 "github.com/unionj-cloud/go-doudou/v2/toolkit/protobuf/v3"
+	"github.com/unionj-cloud/go-doudou/v2/version"
+)
+
+// pbScalarGoTypes maps protobuf scalar types to go types generated by protoc-gen-go
+var pbScalarGoTypes = map[string]string{
+	"double": "float64",
+	"float":  "float32",
+	"int32":  "int32",
+	"int64":  "int64",
+	"uint32": "uint32",
+	"uint64": "uint64",
+	"bool":   "bool",
+	"string": "string",
+	"bytes":  "[]byte",
+}
+
+// pbWrapperTypes maps well-known wrapper types to wrapped scalar types and constructors in wrapperspb
+var pbWrapperTypes = map[string]struct {
+	scalar      string
+	constructor string
+}{
+	"google.protobuf.DoubleValue": {"double", "Double"},
+	"google.protobuf.FloatValue":  {"float", "Float"},
+	"google.protobuf.Int64Value":  {"int64", "Int64"},
+	"google.protobuf.UInt64Value": {"uint64", "UInt64"},
+	"google.protobuf.Int32Value":  {"int32", "Int32"},
+	"google.protobuf.UInt32Value": {"uint32", "UInt32"},
+	"google.protobuf.BoolValue":   {"bool", "Bool"},
+	"google.protobuf.StringValue": {"string", "String"},
+	"google.protobuf.BytesValue":  {"bytes", "Bytes"},
+}
+
+// converterImports are packages the generated converters may refer to
+var converterImports = map[string]string{
+	"time":        "time",
+	"decimal":     "github.com/shopspring/decimal",
+	"customtypes": "github.com/unionj-cloud/go-doudou/v2/toolkit/customtypes",
+	"copier":      "github.com/unionj-cloud/go-doudou/v2/toolkit/copier",
+	"gorm":        "gorm.io/gorm",
+	"durationpb":  "google.golang.org/protobuf/types/known/durationpb",
+	"wrapperspb":  "google.golang.org/protobuf/types/known/wrapperspb",
+}
+
+var goBuiltinTypes = map[string]struct{}{
+	"bool": {}, "string": {}, "error": {}, "byte": {}, "rune": {}, "uintptr": {},
+	"int": {}, "int8": {}, "int16": {}, "int32": {}, "int64": {},
+	"uint": {}, "uint8": {}, "uint16": {}, "uint32": {}, "uint64": {},
+	"float32": {}, "float64": {}, "complex64": {}, "complex128": {},
+	"interface{}": {},
+}
+
+// goCamelCase returns go identifier of protobuf name the same way as protoc-gen-go
+func goCamelCase(s string) string {
+	isLower := func(c byte) bool { return 'a' <= c && c <= 'z' }
+	var b []byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '.' && i+1 < len(s) && isLower(s[i+1]):
+		case c == '.':
+			b = append(b, '_')
+		case c == '_' && (i == 0 || s[i-1] == '.'):
+			b = append(b, 'X')
+		case c == '_' && i+1 < len(s) && isLower(s[i+1]):
+		case '0' <= c && c <= '9':
+			b = append(b, c)
+		default:
+			if isLower(c) {
+				c -= 'a' - 'A'
+			}
+			b = append(b, c)
+			for ; i+1 < len(s) && isLower(s[i+1]); i++ {
+				b = append(b, s[i+1])
+			}
+		}
+	}
+	return string(b)
+}
+
+// qualify prefixes types declared in package pkg with pkg, e.g. []*User to []*dto.User
+func qualify(t, pkg string) string {
+	switch {
+	case strings.HasPrefix(t, "*"):
+		return "*" + qualify(t[1:], pkg)
+	case strings.HasPrefix(t, "[]"):
+		return "[]" + qualify(t[2:], pkg)
+	case strings.HasPrefix(t, "map[string]"):
+		return "map[string]" + qualify(strings.TrimPrefix(t, "map[string]"), pkg)
+	case strings.HasPrefix(t, "["), strings.Contains(t, "."), strings.Contains(t, "«"):
+		return t
+	}
+	if _, ok := goBuiltinTypes[t]; ok {
+		return t
+	}
+	return pkg + "." + t
+}
+
+// mapTypes returns key and value types of protobuf map type
+func mapTypes(p string) (string, string) {
+	inner := p[len("map<") : len(p)-1]
+	i := strings.Index(inner, ",")
+	return strings.TrimSpace(inner[:i]), strings.TrimSpace(inner[i+1:])
+}
+
+// recv makes expression usable as method receiver
+func recv(expr string) string {
+	if strings.HasPrefix(expr, "*") {
+		return "(" + expr + ")"
+	}
+	return expr
+}
+
+type converter struct {
+	messages map[string]v3.Message
+	enums    map[string]v3.Enum
+	seq      int
+	// prefix qualifies go types and converters generated by protoc-gen-go, e.g. pb.
+	prefix string
+}
+
+func newConverter(grpcSvc v3.Service) *converter {
+	c := &converter{
+		messages: make(map[string]v3.Message),
+		enums:    make(map[string]v3.Enum),
+	}
+	for _, m := range grpcSvc.Messages {
+		if m.GoPackage != "" && !m.IsImported {
+			c.messages[m.Name] = m
+		}
+	}
+	for _, e := range grpcSvc.Enums {
+		c.enums[e.Name] = e
+	}
+	return c
+}
+
+func (c *converter) name(prefix string) string {
+	c.seq++
+	return prefix + strconv.Itoa(c.seq)
+}
+
+// pbGoType returns go type generated by protoc-gen-go for protobuf type p
+func (c *converter) pbGoType(p string) string {
+	switch {
+	case strings.HasPrefix(p, "repeated "):
+		return "[]" + c.pbGoType(strings.TrimPrefix(p, "repeated "))
+	case strings.HasPrefix(p, "map<"):
+		key, value := mapTypes(p)
+		return "map[" + c.pbGoType(key) + "]" + c.pbGoType(value)
+	}
+	if t, ok := pbScalarGoTypes[p]; ok {
+		return t
+	}
+	if _, ok := pbWrapperTypes[p]; ok {
+		return "*wrapperspb." + strings.TrimPrefix(p, "google.protobuf.")
+	}
+	if p == v3.Duration.Name {
+		return "*durationpb.Duration"
+	}
+	if _, ok := c.enums[p]; ok {
+		return c.prefix + goCamelCase(p)
+	}
+	return "*" + c.prefix + goCamelCase(p)
+}
+
+// pointerLike reports whether go type generated for protobuf type p is a pointer
+func (c *converter) pointerLike(p string) bool {
+	if _, ok := pbWrapperTypes[p]; ok {
+		return true
+	}
+	_, ok := c.messages[p]
+	return ok || p == v3.Duration.Name
+}
+
+// toPb returns statements converting src of go type g to protobuf type p, the result expression is
+// passed to assign. It returns false if the conversion is not supported.
+func (c *converter) toPb(g, p, src string, assign func(string) string) (string, bool) {
+	if g == c.pbGoType(p) {
+		return assign(src), true
+	}
+	switch {
+	case strings.HasPrefix(p, "repeated "):
+		if !strings.HasPrefix(g, "[]") {
+			return "", false
+		}
+		item, list := c.name("item"), c.name("list")
+		body, ok := c.toPb(g[2:], strings.TrimPrefix(p, "repeated "), item, func(e string) string {
+			return fmt.Sprintf("%s = append(%s, %s)", list, list, e)
+		})
+		if !ok {
+			return "", false
+		}
+		return fmt.Sprintf("if %s != nil {\n%s := make(%s, 0, len(%s))\nfor _, %s := range %s {\n%s\n}\n%s\n}",
+			src, list, c.pbGoType(p), src, item, src, body, assign(list)), true
+	case strings.HasPrefix(p, "map<"):
+		if !strings.HasPrefix(g, "map[string]") {
+			return "", false
+		}
+		_, value := mapTypes(p)
+		key, item, dict := c.name("key"), c.name("item"), c.name("dict")
+		body, ok := c.toPb(strings.TrimPrefix(g, "map[string]"), value, item, func(e string) string {
+			return fmt.Sprintf("%s[%s] = %s", dict, key, e)
+		})
+		if !ok {
+			return "", false
+		}
+		return fmt.Sprintf("if %s != nil {\n%s := make(%s, len(%s))\nfor %s, %s := range %s {\n%s\n}\n%s\n}",
+			src, dict, c.pbGoType(p), src, key, item, src, body, assign(dict)), true
+	case strings.HasPrefix(g, "*"):
+		body, ok := c.toPb(g[1:], p, "*"+src, assign)
+		if !ok {
+			return "", false
+		}
+		return fmt.Sprintf("if %s != nil {\n%s\n}", src, body), true
+	}
+	if w, ok := pbWrapperTypes[p]; ok {
+		return c.toPb(g, w.scalar, src, func(e string) string {
+			return assign(fmt.Sprintf("wrapperspb.%s(%s)", w.constructor, e))
+		})
+	}
+	if t, ok := pbScalarGoTypes[p]; ok {
+		switch g {
+		case "decimal.Decimal", "customtypes.Time":
+			return assign(recv(src) + ".String()"), true
+		case "time.Time":
+			return assign(recv(src) + ".Format(time.RFC3339Nano)"), true
+		case "gorm.DeletedAt":
+			return fmt.Sprintf("if %s.Valid {\n%s\n}", recv(src), assign(recv(src)+".Time.Format(time.RFC3339Nano)")), true
+		case "error", "interface{}", "v3.FileModel", "os.File":
+			return "", false
+		case t:
+			return assign(src), true
+		}
+		if strings.Contains(g, "«") || (strings.HasPrefix(g, "[") && g != "[]rune") {
+			return "", false
+		}
+		return assign(t + "(" + src + ")"), true
+	}
+	if _, ok := c.enums[p]; ok {
+		return assign(c.prefix + goCamelCase(p) + "FromDto(" + src + ")"), true
+	}
+	if p == v3.Duration.Name {
+		if g != "time.Duration" {
+			return "", false
+		}
+		return assign("durationpb.New(" + src + ")"), true
+	}
+	if _, ok := c.messages[p]; ok {
+		return assign(c.prefix + goCamelCase(p) + "FromDto(" + src + ")"), true
+	}
+	return "", false
+}
+
+// fromPb returns statements converting src of protobuf type p to go type g, the result expression is
+// passed to assign. It returns false if the conversion is not supported.
+func (c *converter) fromPb(g, p, src string, assign func(string) string) (string, bool) {
+	if g == c.pbGoType(p) {
+		return assign(src), true
+	}
+	switch {
+	case strings.HasPrefix(p, "repeated "):
+		if !strings.HasPrefix(g, "[]") {
+			return "", false
+		}
+		item, list := c.name("item"), c.name("list")
+		body, ok := c.fromPb(g[2:], strings.TrimPrefix(p, "repeated "), item, func(e string) string {
+			return fmt.Sprintf("%s = append(%s, %s)", list, list, e)
+		})
+		if !ok {
+			return "", false
+		}
+		return fmt.Sprintf("if %s != nil {\n%s := make(%s, 0, len(%s))\nfor _, %s := range %s {\n%s\n}\n%s\n}",
+			src, list, g, src, item, src, body, assign(list)), true
+	case strings.HasPrefix(p, "map<"):
+		if !strings.HasPrefix(g, "map[string]") {
+			return "", false
+		}
+		_, value := mapTypes(p)
+		key, item, dict := c.name("key"), c.name("item"), c.name("dict")
+		body, ok := c.fromPb(strings.TrimPrefix(g, "map[string]"), value, item, func(e string) string {
+			return fmt.Sprintf("%s[%s] = %s", dict, key, e)
+		})
+		if !ok {
+			return "", false
+		}
+		return fmt.Sprintf("if %s != nil {\n%s := make(%s, len(%s))\nfor %s, %s := range %s {\n%s\n}\n%s\n}",
+			src, dict, g, src, key, item, src, body, assign(dict)), true
+	case strings.HasPrefix(g, "*"):
+		value := c.name("value")
+		body, ok := c.fromPb(g[1:], p, src, func(e string) string {
+			return fmt.Sprintf("%s := %s\n%s", value, e, assign("&"+value))
+		})
+		if !ok {
+			return "", false
+		}
+		if c.pointerLike(p) {
+			return fmt.Sprintf("if %s != nil {\n%s\n}", src, body), true
+		}
+		return body, true
+	}
+	if w, ok := pbWrapperTypes[p]; ok {
+		return c.fromPb(g, w.scalar, recv(src)+".GetValue()", assign)
+	}
+	if t, ok := pbScalarGoTypes[p]; ok {
+		value := c.name("value")
+		switch g {
+		case "decimal.Decimal":
+			return fmt.Sprintf("if %s, err := decimal.NewFromString(%s); err == nil {\n%s\n}", value, src, assign(value)), true
+		case "time.Time":
+			return fmt.Sprintf("if %s, err := time.Parse(time.RFC3339Nano, %s); err == nil {\n%s\n}", value, src, assign(value)), true
+		case "customtypes.Time":
+			return fmt.Sprintf("if %s, err := time.ParseInLocation(customtypes.TimeLayout, %s, time.Local); err == nil {\n%s\n}",
+				value, src, assign("customtypes.Time("+value+")")), true
+		case "gorm.DeletedAt":
+			return fmt.Sprintf("if %s, err := time.Parse(time.RFC3339Nano, %s); err == nil {\n%s\n}",
+				value, src, assign("gorm.DeletedAt{Time: "+value+", Valid: true}")), true
+		case "error", "interface{}", "v3.FileModel", "os.File":
+			return "", false
+		case t:
+			return assign(src), true
+		}
+		if strings.Contains(g, "«") || (strings.HasPrefix(g, "[") && g != "[]rune") {
+			return "", false
+		}
+		return assign(g + "(" + src + ")"), true
+	}
+	if _, ok := c.enums[p]; ok {
+		return assign(recv(src) + ".ToDto()"), true
+	}
+	if p == v3.Duration.Name {
+		if g != "time.Duration" {
+			return "", false
+		}
+		return assign(recv(src) + ".AsDuration()"), true
+	}
+	if _, ok := c.messages[p]; ok {
+		return assign(recv(src) + ".ToDto()"), true
+	}
+	return "", false
+}
+
+// fieldToPb returns statements converting src of go type g to non-oneof field f of message m
+func (c *converter) fieldToPb(f v3.Field, g, src, m string) string {
+	dst := m + "." + goCamelCase(f.Name)
+	assign := func(e string) string {
+		return dst + " = " + e
+	}
+	if f.Optional {
+		assign = func(e string) string {
+			value := c.name("value")
+			return fmt.Sprintf("%s := %s\n%s = &%s", value, e, dst, value)
+		}
+	}
+	if !f.Type.Inner() {
+		if code, ok := c.toPb(g, f.Type.GetName(), src, assign); ok {
+			return code
+		}
+	}
+	return copyByJson(f, src, dst)
+}
+
+// copyByJson returns statements copying field f of types without converters, such as interface{} and anonymous
+// structs, from src to dst through json
+func copyByJson(f v3.Field, src, dst string) string {
+	logrus.Warnf("field %s of type %s is converted through json", f.GoName, f.GoType)
+	return fmt.Sprintf("// field %s of type %s is converted through json\n_ = copier.DeepCopy(%s, &%s)", f.GoName, f.GoType, src, dst)
+}
+
+// fieldFromPb returns statements converting non-oneof field f of message m to dst of go type g
+func (c *converter) fieldFromPb(f v3.Field, g, m, dst string) string {
+	src := m + "." + goCamelCase(f.Name)
+	assign := func(e string) string {
+		return dst + " = " + e
+	}
+	if !f.Type.Inner() {
+		if f.Optional {
+			if code, ok := c.fromPb(g, f.Type.GetName(), "*"+src, assign); ok {
+				return fmt.Sprintf("if %s != nil {\n%s\n}", src, code)
+			}
+		} else if code, ok := c.fromPb(g, f.Type.GetName(), src, assign); ok {
+			return code
+		}
+	}
+	return copyByJson(f, src, dst)
+}
+
+// oneofCases returns go types of a oneof field implementation in type switch, values of types
+// implementing the interface by value receivers may be pointers as well
+func oneofCases(g string) []string {
+	if strings.HasPrefix(g, "*") {
+		return []string{g}
+	}
+	return []string{g, "*" + g}
+}
+
+func (c *converter) messageFromDto(m v3.Message) string {
+	c.seq = 0
+	pkg := path.Base(m.GoPackage)
+	name := goCamelCase(m.Name)
+	var b strings.Builder
+	fmt.Fprintf(&b, "// %sFromDto converts %s.%s to %s\n", name, pkg, m.GoName, name)
+	fmt.Fprintf(&b, "func %sFromDto(d %s.%s) *%s {\nm := &%s{}\n", name, pkg, m.GoName, name, name)
+	for _, group := range m.FieldGroups() {
+		if group.Oneof != "" {
+			oneof := goCamelCase(group.Oneof)
+			var cases strings.Builder
+			for _, f := range group.Fields {
+				field := goCamelCase(f.Name)
+				for _, g := range oneofCases(qualify(f.GoType, pkg)) {
+					code, ok := c.toPb(g, f.Type.GetName(), "v", func(e string) string {
+						return fmt.Sprintf("m.%s = &%s_%s{%s: %s}", oneof, name, field, field, e)
+					})
+					if ok {
+						fmt.Fprintf(&cases, "case %s:\n%s\n", g, code)
+					}
+				}
+			}
+			if cases.Len() == 0 {
+				panic(errors.Errorf("oneof field %s of %s.%s can't be converted", group.Fields[0].GoName, pkg, m.GoName))
+			}
+			fmt.Fprintf(&b, "switch v := d.%s.(type) {\n%s}\n", group.Fields[0].GoName, cases.String())
+			continue
+		}
+		f := group.Fields[0]
+		b.WriteString(c.fieldToPb(f, qualify(f.GoType, pkg), "d."+f.GoName, "m") + "\n")
+	}
+	b.WriteString("return m\n}\n")
+	return b.String()
+}
+
+func (c *converter) messageToDto(m v3.Message) string {
+	c.seq = 0
+	pkg := path.Base(m.GoPackage)
+	name := goCamelCase(m.Name)
+	var b strings.Builder
+	fmt.Fprintf(&b, "// ToDto converts %s to %s.%s\n", name, pkg, m.GoName)
+	fmt.Fprintf(&b, "func (x *%s) ToDto() %s.%s {\nvar d %s.%s\nif x == nil {\nreturn d\n}\n", name, pkg, m.GoName, pkg, m.GoName)
+	for _, group := range m.FieldGroups() {
+		if group.Oneof != "" {
+			oneof := goCamelCase(group.Oneof)
+			var cases strings.Builder
+			for _, f := range group.Fields {
+				field := goCamelCase(f.Name)
+				code, ok := c.fromPb(qualify(f.GoType, pkg), f.Type.GetName(), "v."+field, func(e string) string {
+					return fmt.Sprintf("d.%s = %s", f.GoName, e)
+				})
+				if ok {
+					fmt.Fprintf(&cases, "case *%s_%s:\n%s\n", name, field, code)
+				}
+			}
+			if cases.Len() == 0 {
+				panic(errors.Errorf("oneof field %s of %s.%s can't be converted", group.Fields[0].GoName, pkg, m.GoName))
+			}
+			fmt.Fprintf(&b, "switch v := x.%s.(type) {\n%s}\n", oneof, cases.String())
+			continue
+		}
+		f := group.Fields[0]
+		b.WriteString(c.fieldFromPb(f, qualify(f.GoType, pkg), "x", "d."+f.GoName) + "\n")
+	}
+	b.WriteString("return d\n}\n")
+	return b.String()
+}
+
+func (c *converter) enumFromDto(e v3.Enum) string {
+	pkg := path.Base(e.GoPackage)
+	name := goCamelCase(e.Name)
+	var b strings.Builder
+	fmt.Fprintf(&b, "// %sFromDto converts %s.%s to %s\n", name, pkg, e.GoName, name)
+	fmt.Fprintf(&b, "func %sFromDto(v %s.%s) %s {\nswitch v {\n", name, pkg, e.GoName, name)
+	for _, f := range e.Fields {
+		if f.GoName == "" {
+			continue
+		}
+		fmt.Fprintf(&b, "case %s.%s:\nreturn %s_%s\n", pkg, f.GoName, name, f.Name)
+	}
+	b.WriteString("}\nreturn 0\n}\n")
+	return b.String()
+}
+
+func (c *converter) enumToDto(e v3.Enum) string {
+	pkg := path.Base(e.GoPackage)
+	name := goCamelCase(e.Name)
+	var b strings.Builder
+	fmt.Fprintf(&b, "// ToDto converts %s to %s.%s\n", name, pkg, e.GoName)
+	fmt.Fprintf(&b, "func (x %s) ToDto() %s.%s {\nswitch x {\n", name, pkg, e.GoName)
+	for _, f := range e.Fields {
+		if f.GoName == "" {
+			continue
+		}
+		fmt.Fprintf(&b, "case %s_%s:\nreturn %s.%s\n", name, f.Name, pkg, f.GoName)
+	}
+	fmt.Fprintf(&b, "}\nvar zero %s.%s\nreturn zero\n}\n", pkg, e.GoName)
+	return b.String()
+}
+
+// source returns converters of all messages and enums generated from vo and dto packages
+func (c *converter) source() string {
+	var body strings.Builder
+	packages := make(map[string]string)
+	for k, v := range converterImports {
+		packages[k] = v
+	}
+	names := make([]string, 0, len(c.enums))
+	for k, e := range c.enums {
+		if e.GoPackage == "" {
+			continue
+		}
+		packages[path.Base(e.GoPackage)] = e.GoPackage
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	for _, k := range names {
+		body.WriteString("\n" + c.enumFromDto(c.enums[k]) + "\n" + c.enumToDto(c.enums[k]))
+	}
+	names = names[:0]
+	for k, m := range c.messages {
+		packages[path.Base(m.GoPackage)] = m.GoPackage
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	for _, k := range names {
+		body.WriteString("\n" + c.messageFromDto(c.messages[k]) + "\n" + c.messageToDto(c.messages[k]))
+	}
+	var imports []string
+	for alias, pkgPath := range packages {
+		if regexp.MustCompile(`\b` + alias + `\.`).MatchString(body.String()) {
+			imports = append(imports, strconv.Quote(pkgPath))
+		}
+	}
+	sort.Strings(imports)
+	var b strings.Builder
+	fmt.Fprintf(&b, "/**\n* Generated by go-doudou %s.\n* Don't edit!\n*/\npackage grpc\n", version.Release)
+	if len(imports) > 0 {
+		fmt.Fprintf(&b, "\nimport (\n%s\n)\n", strings.Join(imports, "\n"))
+	}
+	b.WriteString(body.String())
+	return b.String()
+}
+
+// GenGrpcConverter generates functions converting structs and enums in vo and dto packages to messages and enums
+// generated by protoc-gen-go, named as XxxFromDto, and ToDto methods of the latter converting them back
+func GenGrpcConverter(dir string, grpcSvc v3.Service) {
+	var (
+		err           error
+		converterFile string
+		grpcDir       string
+	)
+	c := newConverter(grpcSvc)
+	if len(c.messages) == 0 && len(c.enums) == 0 {
+		return
+	}
+	grpcDir = filepath.Join(dir, "transport/grpc")
+	if err = os.MkdirAll(grpcDir, os.ModePerm); err != nil {
+		panic(err)
+	}
+	converterFile = filepath.Join(grpcDir, "converter.go")
+	if _, err = os.Stat(converterFile); err == nil {
+		logrus.Warningln("file " + converterFile + " will be overwritten")
+	}
+	astutils.FixImport([]byte(c.source()), converterFile)
+}
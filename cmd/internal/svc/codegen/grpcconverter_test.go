@@ -0,0 +1,162 @@
+package codegen
+
+import (
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/iancoleman/strcase"
+	"github.com/stretchr/testify/require"
+	"github.com/unionj-cloud/go-doudou/v2/toolkit/astutils"
+	v3 "github.com/unionj-cloud/go-doudou/v2/toolkit/protobuf/v3"
+)
+
+func TestGoCamelCase(t *testing.T) {
+	require.Equal(t, "UserId", goCamelCase("user_id"))
+	require.Equal(t, "UserId", goCamelCase("userId"))
+	require.Equal(t, "ScrapeURL", goCamelCase("scrapeURL"))
+	require.Equal(t, "XId", goCamelCase("_id"))
+	require.Equal(t, "Owner_Address", goCamelCase("Owner.Address"))
+}
+
+func zooService(t *testing.T) v3.Service {
+	t.Cleanup(func() {
+		v3.MessageStore = make(map[string]v3.Message)
+		v3.EnumStore = make(map[string]v3.Enum)
+		v3.ImportStore = make(map[string]struct{})
+		v3.OneofStore = make(map[string]v3.Oneof)
+		v3.MessageNames = nil
+	})
+	v3.MessageNames = []string{"Cat", "Dog", "Owner"}
+	v3.OneofStore["Animal"] = v3.Oneof{Name: "Animal", Members: []string{"Cat", "*Dog"}, GoPackage: "zoo/dto"}
+	color := v3.Enum{
+		Name:      "Color",
+		Fields:    []v3.EnumField{{Name: "RED", Number: 0, GoName: "Red"}, {Name: "GREEN", Number: 1, GoName: "Green"}},
+		GoPackage: "zoo/dto",
+		GoName:    "Color",
+	}
+	v3.EnumStore["Color"] = color
+	p := v3.NewProtoGenerator(v3.WithFieldNamingFunc(strcase.ToLowerCamel))
+	service := v3.Service{Name: "ZooService", Package: "zoo", Enums: []v3.Enum{color}}
+	for _, structmeta := range []astutils.StructMeta{
+		{Name: "Cat", Fields: []astutils.FieldMeta{{Name: "Name", Type: "string"}}},
+		{Name: "Dog", Fields: []astutils.FieldMeta{{Name: "Age", Type: "*int"}}},
+		{Name: "Owner", Fields: []astutils.FieldMeta{
+			{Name: "Name", Type: "*string"},
+			{Name: "Color", Type: "Color"},
+			{Name: "Pet", Type: "Animal"},
+			{Name: "Pets", Type: "map[string]Cat"},
+			{Name: "Dogs", Type: "[]*Dog"},
+			{Name: "Price", Type: "decimal.Decimal"},
+			{Name: "Timeout", Type: "time.Duration"},
+			{Name: "Tags", Type: "[]string"},
+			{Name: "Extra", Type: "interface{}"},
+		}},
+	} {
+		message := p.NewMessage(structmeta)
+		message.GoPackage = "zoo/dto"
+		service.Messages = append(service.Messages, message)
+	}
+	return service
+}
+
+func TestGenGrpcConverter(t *testing.T) {
+	dir := t.TempDir()
+	GenGrpcConverter(dir, zooService(t))
+	content, err := ioutil.ReadFile(filepath.Join(dir, "transport/grpc/converter.go"))
+	require.NoError(t, err)
+	source := string(content)
+	_, err = parser.ParseFile(token.NewFileSet(), "converter.go", content, 0)
+	require.NoError(t, err)
+
+	require.Contains(t, source, `"zoo/dto"`)
+	require.Contains(t, source, `"google.golang.org/protobuf/types/known/durationpb"`)
+	require.Contains(t, source, "func ColorFromDto(v dto.Color) Color {")
+	require.Contains(t, source, "\tcase Color_GREEN:\n\t\treturn dto.Green\n")
+	require.Contains(t, source, "func OwnerFromDto(d dto.Owner) *Owner {")
+	require.Contains(t, source, "func (x *Owner) ToDto() dto.Owner {")
+	// pointer fields are proto3 optional
+	require.Contains(t, source, "\tif d.Name != nil {\n\t\tvalue1 := *d.Name\n\t\tm.Name = &value1\n\t}\n")
+	require.Contains(t, source, "\tm.Color = ColorFromDto(d.Color)\n")
+	require.Contains(t, source, "\tcase *dto.Cat:\n\t\tif v != nil {\n\t\t\tm.Pet = &Owner_PetCat{PetCat: CatFromDto(*v)}\n\t\t}\n")
+	require.Contains(t, source, "\tcase *Owner_PetDog:\n\t\tif v.PetDog != nil {\n")
+	require.Contains(t, source, "\t\t\tdict4[key2] = CatFromDto(item3)\n")
+	require.Contains(t, source, "decimal.NewFromString(x.Price)")
+	require.Contains(t, source, "\tm.Timeout = durationpb.New(d.Timeout)\n")
+	require.Contains(t, source, "\tm.Tags = d.Tags\n")
+	// fields without converters are copied through json
+	require.Contains(t, source, "\t_ = copier.DeepCopy(d.Extra, &m.Extra)\n")
+	require.Contains(t, source, "\t_ = copier.DeepCopy(x.Extra, &d.Extra)\n")
+	require.Contains(t, source, `"github.com/unionj-cloud/go-doudou/v2/toolkit/copier"`)
+}
+
+func TestGenGrpcProtoOneof(t *testing.T) {
+	dir := t.TempDir()
+	service := zooService(t)
+	for _, m := range service.Messages {
+		v3.MessageStore[m.Name] = m
+	}
+	ic := astutils.InterfaceCollector{Interfaces: []astutils.InterfaceMeta{{Name: "Zoo"}}}
+	_, protoFile := GenGrpcProto(dir, ic, v3.NewProtoGenerator(v3.WithFieldNamingFunc(strcase.ToLowerCamel)))
+	content, err := ioutil.ReadFile(protoFile)
+	require.NoError(t, err)
+	proto := string(content)
+	require.Contains(t, proto, `  optional string name = 1 [json_name="name"];`)
+	require.Contains(t, proto, "  oneof pet {\n    Cat petCat = 3 [json_name=\"petCat\"];\n    Dog petDog = 4 [json_name=\"petDog\"];\n  }\n")
+	require.Contains(t, proto, `  google.protobuf.Duration timeout = 8 [json_name="timeout"];`)
+
+	schema, err := v3.ParseSchema(proto)
+	require.NoError(t, err)
+	require.Len(t, schema.Messages["Owner"].Fields, 10)
+}
+
+func TestGenGrpcClient(t *testing.T) {
+	dir := t.TempDir()
+	service := zooService(t)
+	svcfile := filepath.Join(dir, "svc.go")
+	require.NoError(t, ioutil.WriteFile(svcfile, []byte(`package zoo
+
+import (
+	"context"
+	"zoo/dto"
+)
+
+type Zoo interface {
+	// @hedge()
+	GetOwner(ctx context.Context, id int) (owner dto.Owner, err error)
+	SaveCat(ctx context.Context, cat *dto.Cat) error
+	Tag(ctx context.Context, name *string, colors ...dto.Color) (count int, err error)
+	Ping()
+	Feed(ctx context.Context, streamCats dto.Cat) error
+}
+`), 0644))
+	ic := astutils.BuildInterfaceCollector(svcfile, astutils.ExprString)
+	p := v3.NewProtoGenerator(v3.WithFieldNamingFunc(strcase.ToLowerCamel))
+	for _, method := range ic.Interfaces[0].Methods {
+		service.Rpcs = append(service.Rpcs, p.NewRpc(method))
+	}
+	GenGrpcClient(dir, ic, service)
+	content, err := ioutil.ReadFile(filepath.Join(dir, "client/grpcclient/grpcclient.go"))
+	require.NoError(t, err)
+	source := string(content)
+	_, err = parser.ParseFile(token.NewFileSet(), "grpcclient.go", content, 0)
+	require.NoError(t, err)
+
+	require.Equal(t, 1, strings.Count(source, `"context"`))
+	require.Contains(t, source, "var _ zoo.Zoo = (*ZooGrpcClient)(nil)")
+	require.Contains(t, source, "func NewZooGrpcClient(service string, opts ...GrpcClientOption) *ZooGrpcClient {")
+	require.Contains(t, source, "grpc.WithChainUnaryInterceptor(grpcx_hedging.UnaryClientInterceptor(pb.MethodAnnotationStore, nil))")
+	require.Contains(t, source, "\t_request := &pb.GetOwnerRpcRequest{}\n\t_request.Id = int32(id)\n")
+	require.Contains(t, source, "\t\towner = _response.ToDto()\n")
+	require.Contains(t, source, "\tif cat != nil {\n\t\t_request = pb.CatFromDto(*cat)\n\t}\n")
+	require.Contains(t, source, "\t\t_, _err := receiver.client.SaveCatRpc(ctx, _request)\n")
+	require.Contains(t, source, "\t\tvalue1 := *name\n\t\t_request.Name = &value1\n")
+	require.Contains(t, source, "list3 = append(list3, pb.ColorFromDto(item2))")
+	require.Contains(t, source, "\t\tcount = int(_response.Count)\n")
+	require.Contains(t, source, "\t_ctx := context.Background()\n\t_request := &emptypb.Empty{}\n")
+	require.Contains(t, source, `logger.Error().Err(_err).Msg("[go-doudou] call PingRpc fail")`)
+	require.Contains(t, source, `status.Error(codes.Unimplemented, "streaming rpc FeedRpc should be called through Client()")`)
+}
@@ -0,0 +1,193 @@
+package codegen
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/unionj-cloud/go-doudou/v2/toolkit/astutils"
+	"github.com/unionj-cloud/go-doudou/v2/toolkit/constants"
+	v3Helper "github.com/unionj-cloud/go-doudou/v2/toolkit/openapi/v3"
+	v3 "github.com/unionj-cloud/go-doudou/v2/toolkit/protobuf/v3"
+)
+
+var protoScalarSchemas = map[string]*v3Helper.Schema{
+	"double":                    v3Helper.Float64,
+	"float":                     v3Helper.Float32,
+	"int32":                     v3Helper.Int,
+	"uint32":                    v3Helper.Int,
+	"int64":                     {Type: v3Helper.StringT, Format: v3Helper.Int64F},
+	"uint64":                    {Type: v3Helper.StringT, Format: v3Helper.Int64F},
+	"bool":                      v3Helper.Bool,
+	"string":                    v3Helper.String,
+	"bytes":                     {Type: v3Helper.StringT, Format: "byte"},
+	"google.protobuf.Timestamp": v3Helper.Time,
+	"google.protobuf.Any":       v3Helper.Any,
+	"google.protobuf.Empty":     {Type: v3Helper.ObjectT},
+}
+
+// protoSchemaOf returns json schema of protobuf type as encoded by protojson
+func protoSchemaOf(t v3.ProtobufType) *v3Helper.Schema {
+	switch pt := t.(type) {
+	case v3.Enum:
+		schema := &v3Helper.Schema{Type: v3Helper.StringT}
+		for _, f := range pt.Fields {
+			schema.Enum = append(schema.Enum, f.Name)
+		}
+		return schema
+	case v3.Message:
+		if pt.Inner() {
+			return protoMessageSchema(pt)
+		}
+	}
+	return protoSchemaOfName(t.GetName())
+}
+
+func protoSchemaOfName(name string) *v3Helper.Schema {
+	name = strings.TrimPrefix(name, "stream ")
+	if strings.HasPrefix(name, "repeated ") {
+		return &v3Helper.Schema{
+			Type:  v3Helper.ArrayT,
+			Items: protoSchemaOfName(strings.TrimPrefix(name, "repeated ")),
+		}
+	}
+	if strings.HasPrefix(name, "map<") {
+		value := strings.TrimSpace(name[strings.Index(name, ",")+1 : len(name)-1])
+		return &v3Helper.Schema{
+			Type:                 v3Helper.ObjectT,
+			AdditionalProperties: protoSchemaOfName(value),
+		}
+	}
+	if schema, ok := protoScalarSchemas[name]; ok {
+		return schema
+	}
+	for _, e := range v3.EnumStore {
+		if e.Name == name {
+			return protoSchemaOf(e)
+		}
+	}
+	return &v3Helper.Schema{Ref: "#/components/schemas/" + name}
+}
+
+func protoMessageSchema(m v3.Message) *v3Helper.Schema {
+	schema := &v3Helper.Schema{
+		Type:        v3Helper.ObjectT,
+		Title:       m.Name,
+		Description: strings.Join(m.Comments, "\n"),
+		Properties:  make(map[string]*v3Helper.Schema),
+	}
+	for _, f := range m.Fields {
+		fs := protoSchemaOf(f.Type)
+		if len(f.Comments) > 0 {
+			copied := *fs
+			copied.Description = strings.Join(f.Comments, "\n")
+			fs = &copied
+		}
+		name := f.JsonName
+		if name == "" {
+			name = f.Name
+		}
+		schema.Properties[name] = fs
+	}
+	return schema
+}
+
+func protoJsonContent(m v3.Message) *v3Helper.Content {
+	return &v3Helper.Content{
+		JSON: &v3Helper.MediaType{
+			Schema: protoSchemaOfName(m.Name),
+		},
+	}
+}
+
+// transcodedOperationOf describes rpc served by transcoding.Transcoder
+func transcodedOperationOf(rpc v3.Rpc) v3Helper.Operation {
+	op := v3Helper.Operation{
+		OperationID: rpc.Name,
+		Description: strings.Join(rpc.Comments, "\n"),
+		Responses: &v3Helper.Responses{
+			Resp200: &v3Helper.Response{
+				Description: "OK",
+				Content:     protoJsonContent(rpc.Response),
+			},
+		},
+	}
+	request := rpc.Request
+	if m, ok := v3.MessageStore[request.Name]; ok {
+		request = m
+	}
+	pathVars := make(map[string]struct{})
+	for _, segment := range strings.Split(rpc.HttpRule.Path, "/") {
+		if strings.HasPrefix(segment, "{") {
+			pathVars[strings.Trim(segment, "{}")] = struct{}{}
+		}
+	}
+	for _, f := range request.Fields {
+		if _, ok := pathVars[f.Name]; ok {
+			op.Parameters = append(op.Parameters, v3Helper.Parameter{
+				Name:     f.Name,
+				In:       v3Helper.InPath,
+				Required: true,
+				Schema:   protoSchemaOf(f.Type),
+			})
+			continue
+		}
+		if rpc.HttpRule.Body != "" {
+			continue
+		}
+		// only scalars and repeated scalars can be set by query string
+		schema := protoSchemaOf(f.Type)
+		if schema.Type == v3Helper.ObjectT || schema.Ref != "" || (schema.Items != nil && (schema.Items.Type == v3Helper.ObjectT || schema.Items.Ref != "")) {
+			continue
+		}
+		op.Parameters = append(op.Parameters, v3Helper.Parameter{
+			Name:   f.JsonName,
+			In:     v3Helper.InQuery,
+			Schema: schema,
+		})
+	}
+	if rpc.HttpRule.Body != "" {
+		op.RequestBody = &v3Helper.RequestBody{
+			Content:  protoJsonContent(rpc.Request),
+			Required: true,
+		}
+	}
+	return op
+}
+
+// GenGrpcHttpDoc generates OpenAPI 3.0 description of the rpcs transcoded to HTTP/JSON according to
+// their google.api.http annotations
+func GenGrpcHttpDoc(dir string, ic astutils.InterfaceCollector, grpcSvc v3.Service) {
+	paths := make(map[string]v3Helper.Path)
+	for _, rpc := range grpcSvc.Rpcs {
+		if rpc.HttpRule == nil {
+			continue
+		}
+		op := transcodedOperationOf(rpc)
+		path := paths[rpc.HttpRule.Path]
+		reflect.ValueOf(&path).Elem().FieldByName(strings.Title(rpc.HttpRule.Method)).Set(reflect.ValueOf(&op))
+		paths[rpc.HttpRule.Path] = path
+	}
+	schemas := make(map[string]v3Helper.Schema)
+	for _, m := range grpcSvc.Messages {
+		schemas[m.Name] = *protoMessageSchema(m)
+	}
+	writeDoc(dir, ic, v3Helper.API{
+		Openapi: "3.0.2",
+		Info: &v3Helper.Info{
+			Title:       ic.Interfaces[0].Name,
+			Description: strings.Join(ic.Interfaces[0].Comments, "\n"),
+			Version:     fmt.Sprintf("v%s", time.Now().Local().Format(constants.FORMAT10)),
+		},
+		Servers: []v3Helper.Server{
+			{
+				URL: fmt.Sprintf("http://localhost:%d", 6060),
+			},
+		},
+		Paths: paths,
+		Components: &v3Helper.Components{
+			Schemas: schemas,
+		},
+	})
+}
@@ -16,6 +16,42 @@ import (
 	"text/template"
 )
 
+var grpcStreamInterceptors = `
+	grpc_ctxtags.StreamServerInterceptor(),
+	grpc_opentracing.StreamServerInterceptor(),
+	grpc_prometheus.StreamServerInterceptor,
+	tags.StreamServerInterceptor(tags.WithFieldExtractor(tags.CodeGenRequestFieldExtractor)),
+	logging.StreamServerInterceptor(grpczerolog.InterceptorLogger(zlogger.Logger)),
+	grpc_recovery.StreamServerInterceptor(),
+	grpcx_auth.StreamServerInterceptor(authorizer),
+	grpcx_validator.StreamServerInterceptor(pb.ValidationRules),
+	grpcx_errors.StreamServerInterceptor(),
+`
+
+var grpcUnaryInterceptors = `
+	grpc_ctxtags.UnaryServerInterceptor(),
+	grpc_opentracing.UnaryServerInterceptor(),
+	grpc_prometheus.UnaryServerInterceptor,
+	tags.UnaryServerInterceptor(tags.WithFieldExtractor(tags.CodeGenRequestFieldExtractor)),
+	logging.UnaryServerInterceptor(grpczerolog.InterceptorLogger(zlogger.Logger)),
+	grpc_recovery.UnaryServerInterceptor(),
+	grpcx_auth.UnaryServerInterceptor(authorizer),
+	grpcx_validator.UnaryServerInterceptor(pb.ValidationRules),
+	grpcx_errors.UnaryServerInterceptor(),
+`
+
+// grpcAuthorizerTmpl declares authorizer checking @role and @permission annotations of rpcs
+var grpcAuthorizerTmpl = `// rpcs annotated with @role or @permission are denied until roles and permissions of callers
+// are resolved by grpcx_auth.WithRoles and grpcx_auth.WithPermissions options
+authorizer := grpcx_auth.NewAnnotationAuthorizer(pb.MethodAnnotationStore)`
+
+var grpcServerTmpl = grpcAuthorizerTmpl + `
+grpcServer := grpcx.NewGrpcServer(
+	grpc.StreamInterceptor(grpc_middleware.ChainStreamServer(` + grpcStreamInterceptors + `)),
+	grpc.UnaryInterceptor(grpc_middleware.ChainUnaryServer(` + grpcUnaryInterceptors + `)),
+)
+pb.Register{{.GrpcSvcName}}Server(grpcServer, svc)`
+
 var mainTmplGrpc = `/**
 * Generated by go-doudou {{.Version}}.
 * You can edit it as your need.
@@ -29,54 +65,45 @@ import (
 func main() {
 	conf := config.LoadFromEnv()
 	svc := {{.ServiceAlias}}.New{{.SvcName}}(conf)
-	grpcServer := grpcx.NewGrpcServer(
-		grpc.StreamInterceptor(grpc_middleware.ChainStreamServer(
-			grpc_ctxtags.StreamServerInterceptor(),
-			grpc_opentracing.StreamServerInterceptor(),
-			grpc_prometheus.StreamServerInterceptor,
-			tags.StreamServerInterceptor(tags.WithFieldExtractor(tags.CodeGenRequestFieldExtractor)),
-			logging.StreamServerInterceptor(grpczerolog.InterceptorLogger(zlogger.Logger)),
-			grpc_recovery.StreamServerInterceptor(),
-		)),
-		grpc.UnaryInterceptor(grpc_middleware.ChainUnaryServer(
-			grpc_ctxtags.UnaryServerInterceptor(),
-			grpc_opentracing.UnaryServerInterceptor(),
-			grpc_prometheus.UnaryServerInterceptor,
-			tags.UnaryServerInterceptor(tags.WithFieldExtractor(tags.CodeGenRequestFieldExtractor)),
-			logging.UnaryServerInterceptor(grpczerolog.InterceptorLogger(zlogger.Logger)),
-			grpc_recovery.UnaryServerInterceptor(),
-		)),
+	{{- if .Http }}
+	// http and grpc servers run as one application, registered with service discovery
+	// together and shut down together
+	` + grpcAuthorizerTmpl + `
+	application := app.New(
+		app.WithStreamInterceptors(` + grpcStreamInterceptors + `),
+		app.WithUnaryInterceptors(` + grpcUnaryInterceptors + `),
 	)
-	pb.Register{{.GrpcSvcName}}Server(grpcServer, svc)
+	pb.Register{{.GrpcSvcName}}Server(application, svc)
+	// rpcs annotated with google.api.http option are served over HTTP/JSON as well,
+	// http server has its own tracing, metrics and logging middlewares
+	transcoder := transcoding.NewTranscoder()
+	pb.Register{{.GrpcSvcName}}Server(transcoder, svc)
+	application.AddRoute(transcoder.Routes()...)
+	if err := application.Run(context.Background()); err != nil {
+		zlogger.Error().Err(err).Msg("failed to run application")
+	}
+	{{- else }}
+	` + grpcServerTmpl + `
 	grpcServer.Run()
+	{{- end }}
 }
 `
 
 var appendMainTmplGrpc = `
-go func() {
-	grpcServer := grpcx.NewGrpcServer(
-		grpc.StreamInterceptor(grpc_middleware.ChainStreamServer(
-			grpc_ctxtags.StreamServerInterceptor(),
-			grpc_opentracing.StreamServerInterceptor(),
-			grpc_prometheus.StreamServerInterceptor,
-			tags.StreamServerInterceptor(tags.WithFieldExtractor(tags.CodeGenRequestFieldExtractor)),
-			logging.StreamServerInterceptor(grpczerolog.InterceptorLogger(zlogger.Logger)),
-			grpc_recovery.StreamServerInterceptor(),
-		)),
-		grpc.UnaryInterceptor(grpc_middleware.ChainUnaryServer(
-			grpc_ctxtags.UnaryServerInterceptor(),
-			grpc_opentracing.UnaryServerInterceptor(),
-			grpc_prometheus.UnaryServerInterceptor,
-			tags.UnaryServerInterceptor(tags.WithFieldExtractor(tags.CodeGenRequestFieldExtractor)),
-			logging.UnaryServerInterceptor(grpczerolog.InterceptorLogger(zlogger.Logger)),
-			grpc_recovery.UnaryServerInterceptor(),
-		)),
-	)
-	pb.Register{{.GrpcSvcName}}Server(grpcServer, svc)
-	grpcServer.Run()
-}()
+` + grpcServerTmpl + `
 `
 
+// appendRunTmplGrpc replaces srv.Run() of rest service to run http and grpc servers as one application
+var appendRunTmplGrpc = `application := app.New(app.WithRestServer(srv), app.WithGrpcServer(grpcServer))
+if err := application.Run(context.Background()); err != nil {
+	zlogger.Error().Err(err).Msg("failed to run application")
+}`
+
+// appendGoRunTmplGrpc starts grpc server in background if main function of rest service has been customized
+var appendGoRunTmplGrpc = `go func() {
+	grpcServer.Run()
+}()`
+
 var gRPCImportBlock = `
 	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
 	grpczerolog "github.com/grpc-ecosystem/go-grpc-middleware/providers/zerolog/v2"
@@ -89,6 +116,13 @@ var gRPCImportBlock = `
 	"github.com/unionj-cloud/go-doudou/v2/toolkit/zlogger"
 	"google.golang.org/grpc"
     "github.com/unionj-cloud/go-doudou/v2/framework/grpcx"
+	"github.com/unionj-cloud/go-doudou/v2/framework/grpcx/interceptors/grpcx_auth"
+	"github.com/unionj-cloud/go-doudou/v2/framework/grpcx/interceptors/grpcx_errors"
+	"github.com/unionj-cloud/go-doudou/v2/framework/grpcx/interceptors/grpcx_validator"
+	"github.com/unionj-cloud/go-doudou/v2/framework/grpcx/transcoding"
+	"github.com/unionj-cloud/go-doudou/v2/framework/rest"
+	"github.com/unionj-cloud/go-doudou/v2/framework/app"
+	"context"
 	{{.ServiceAlias}} "{{.ServicePackage}}"
     "{{.ConfigPackage}}"
 	pb "{{.PbPackage}}"
@@ -133,6 +167,7 @@ func GenMainGrpc(dir string, ic astutils.InterfaceCollector, grpcSvc v3.Service)
 			ServiceAlias   string
 			Version        string
 			GrpcSvcName    string
+			Http           bool
 		}{
 			ServicePackage: servicePkg,
 			ConfigPackage:  cfgPkg,
@@ -141,6 +176,7 @@ func GenMainGrpc(dir string, ic astutils.InterfaceCollector, grpcSvc v3.Service)
 			ServiceAlias:   alias,
 			Version:        version.Release,
 			GrpcSvcName:    grpcSvc.Name,
+			Http:           grpcSvc.HasHttpRule(),
 		}); err != nil {
 			panic(err)
 		}
@@ -174,11 +210,27 @@ func GenMainGrpc(dir string, ic astutils.InterfaceCollector, grpcSvc v3.Service)
 			}
 			fileContent := ""
 			reg := regexp.MustCompile(fmt.Sprintf(`\.New%s\(`, svcName))
+			runReg := regexp.MustCompile(`^\s*srv\.Run\(\)\s*$`)
+			var runApp bool
 			for _, line := range lines {
+				if runReg.MatchString(line) {
+					runApp = true
+					break
+				}
+			}
+			for _, line := range lines {
+				if runApp && runReg.MatchString(line) {
+					fileContent += appendRunTmplGrpc
+					fileContent += constants.LineBreak
+					continue
+				}
 				fileContent += line
 				fileContent += constants.LineBreak
 				if reg.MatchString(line) {
 					fileContent += buf.String()
+					if !runApp {
+						fileContent += appendGoRunTmplGrpc
+					}
 					fileContent += constants.LineBreak
 				}
 			}
@@ -2,6 +2,7 @@ package codegen
 
 import (
 	"fmt"
+	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"github.com/unionj-cloud/go-doudou/v2/toolkit/astutils"
 	v3Helper "github.com/unionj-cloud/go-doudou/v2/toolkit/openapi/v3"
@@ -10,9 +11,11 @@ import (
 	"go/ast"
 	"go/parser"
 	"go/token"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 	"text/template"
 )
@@ -35,6 +38,12 @@ enum {{$e.Name}} {
   {{- range $f := $e.Fields }}
   {{$f.Name}} = {{$f.Number}};
   {{- end }}
+  {{- if $e.Reserved }}
+  reserved {{ reservedNumbers $e.Reserved }};
+  {{- end }}
+  {{- if $e.ReservedNames }}
+  reserved {{ reservedNames $e.ReservedNames }};
+  {{- end }}
 }
 {{- end }}
 
@@ -47,14 +56,33 @@ enum {{$e.Name}} {
 {{ toComment .Comments }}
 {{- end }}
 message {{.Name}} {
-  {{- range $f := .Fields }}
+  {{- range $g := .FieldGroups }}
+  {{- if $g.Oneof }}
+  oneof {{$g.Oneof}} {
+    {{- range $f := $g.Fields }}
+    {{- if $f.Comments }}
+    {{ toComment $f.Comments }}
+    {{- end }}
+    {{$f.Type.GetName}} {{$f.Name}} = {{$f.Number}}{{if $f.JsonName}} [json_name="{{$f.JsonName}}"]{{end}};
+    {{- end }}
+  }
+  {{- else }}
+  {{- range $f := $g.Fields }}
   {{- if $f.Type.Inner}}
   {{ Eval "Message" $f.Type }}
   {{- end }}
   {{- if $f.Comments }}
   {{ toComment $f.Comments }}
   {{- end }}
-  {{$f.Type.GetName}} {{$f.Name}} = {{$f.Number}}{{if $f.JsonName}} [json_name="{{$f.JsonName}}"]{{end}};
+  {{if $f.Optional}}optional {{end}}{{$f.Type.GetName}} {{$f.Name}} = {{$f.Number}}{{if $f.JsonName}} [json_name="{{$f.JsonName}}"]{{end}};
+  {{- end }}
+  {{- end }}
+  {{- end }}
+  {{- if .Reserved }}
+  reserved {{ reservedNumbers .Reserved }};
+  {{- end }}
+  {{- if .ReservedNames }}
+  reserved {{ reservedNames .ReservedNames }};
   {{- end }}
 }
 {{- end}}
@@ -64,7 +92,16 @@ service {{.Name}} {
   {{- if $r.Comments }}
   {{ toComment $r.Comments }}
   {{- end }}
-  rpc {{$r.Name}}({{$r.Request.Name}}) returns ({{$r.Response.Name}});
+  rpc {{$r.Name}}({{$r.Request.Name}}) returns ({{$r.Response.Name}})
+  {{- if $r.HttpRule }} {
+    option (google.api.http) = {
+      {{$r.HttpRule.Method}}: "{{$r.HttpRule.Path}}"
+      {{- if $r.HttpRule.Body }}
+      body: "{{$r.HttpRule.Body}}"
+      {{- end }}
+    };
+  }
+  {{- else }};{{- end }}
   {{- end}}
 }
 `
@@ -80,33 +117,46 @@ func toComment(comments []string) string {
 	return strings.TrimSuffix(b.String(), "\n")
 }
 
-func GenGrpcProto(dir string, ic astutils.InterfaceCollector, p v3.ProtoGenerator) (service v3.Service, protoFile string) {
-	var (
-		err       error
-		svcname   string
-		fi        os.FileInfo
-		tpl       *template.Template
-		f         *os.File
-		grpcDir   string
-	)
-	grpcDir = filepath.Join(dir, "transport/grpc")
-	if err = os.MkdirAll(grpcDir, os.ModePerm); err != nil {
-		panic(err)
-	}
-	svcname = ic.Interfaces[0].Name
-	protoFile = filepath.Join(grpcDir, strings.ToLower(svcname)+".proto")
-	if fi, err = os.Stat(protoFile); err != nil && !os.IsNotExist(err) {
-		panic(err)
+func reservedNumbers(numbers []int) string {
+	items := make([]string, 0, len(numbers))
+	for _, n := range numbers {
+		items = append(items, strconv.Itoa(n))
 	}
-	if fi != nil {
-		logrus.Warningln("file " + protoFile + " will be overwritten")
+	return strings.Join(items, ", ")
+}
+
+func reservedNames(names []string) string {
+	items := make([]string, 0, len(names))
+	for _, name := range names {
+		items = append(items, strconv.Quote(name))
 	}
-	if f, err = os.Create(protoFile); err != nil {
+	return strings.Join(items, ", ")
+}
+
+func grpcProtoFile(dir string, ic astutils.InterfaceCollector) string {
+	return filepath.Join(dir, "transport/grpc", strings.ToLower(ic.Interfaces[0].Name)+".proto")
+}
+
+// loadSchema parses the proto file generated last time, returns nil if it doesn't exist
+func loadSchema(protoFile string) *v3.Schema {
+	content, err := ioutil.ReadFile(protoFile)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
 		panic(err)
 	}
-	defer f.Close()
+	schema, err := v3.ParseSchema(string(content))
+	if err != nil {
+		panic(errors.Wrapf(err, "failed to parse %s", protoFile))
+	}
+	return schema
+}
+
+func newGrpcService(dir string, ic astutils.InterfaceCollector, p v3.ProtoGenerator) v3.Service {
+	svcname := ic.Interfaces[0].Name
 	servicePkg := astutils.GetPkgPath(dir)
-	service = p.NewService(svcname, servicePkg+"/transport/grpc")
+	service := p.NewService(svcname, servicePkg+"/transport/grpc")
 	service.Comments = ic.Interfaces[0].Comments
 	for _, method := range ic.Interfaces[0].Methods {
 		service.Rpcs = append(service.Rpcs, p.NewRpc(method))
@@ -127,9 +177,39 @@ func GenGrpcProto(dir string, ic astutils.InterfaceCollector, p v3.ProtoGenerato
 	sort.SliceStable(service.Enums, func(i, j int) bool {
 		return service.Enums[i].Name < service.Enums[j].Name
 	})
+	return service
+}
+
+// GenGrpcProto generates proto file of the service. If the proto file exists, field numbers in it are reused,
+// and numbers of removed fields are reserved.
+func GenGrpcProto(dir string, ic astutils.InterfaceCollector, p v3.ProtoGenerator) (service v3.Service, protoFile string) {
+	var (
+		err error
+		tpl *template.Template
+		f   *os.File
+	)
+	if err = os.MkdirAll(filepath.Join(dir, "transport/grpc"), os.ModePerm); err != nil {
+		panic(err)
+	}
+	protoFile = grpcProtoFile(dir, ic)
+	service = newGrpcService(dir, ic, p)
+	if prev := loadSchema(protoFile); prev != nil {
+		logrus.Warningln("file " + protoFile + " will be overwritten")
+		if changes := prev.BreakingChanges(stabilized(prev, &service)); len(changes) > 0 {
+			for _, change := range changes {
+				logrus.Warningln("breaking change: " + change)
+			}
+		}
+	}
+	if f, err = os.Create(protoFile); err != nil {
+		panic(err)
+	}
+	defer f.Close()
 	tpl = template.New("proto.tmpl")
 	funcMap := make(map[string]interface{})
 	funcMap["toComment"] = toComment
+	funcMap["reservedNumbers"] = reservedNumbers
+	funcMap["reservedNames"] = reservedNames
 	funcMap["Eval"] = templateutils.Eval(tpl)
 	if tpl, err = tpl.Funcs(funcMap).Parse(protoTmpl); err != nil {
 		panic(err)
@@ -140,6 +220,22 @@ func GenGrpcProto(dir string, ic astutils.InterfaceCollector, p v3.ProtoGenerato
 	return
 }
 
+func stabilized(prev *v3.Schema, service *v3.Service) *v3.Schema {
+	prev.Stabilize(service)
+	return v3.SchemaOf(*service)
+}
+
+// CheckGrpcProto returns wire incompatible changes of the proto file to be generated
+// against the existing one, nothing is written
+func CheckGrpcProto(dir string, ic astutils.InterfaceCollector, p v3.ProtoGenerator) []string {
+	prev := loadSchema(grpcProtoFile(dir, ic))
+	if prev == nil {
+		return nil
+	}
+	service := newGrpcService(dir, ic, p)
+	return prev.BreakingChanges(stabilized(prev, &service))
+}
+
 func messagesOf(vofile string, p v3.ProtoGenerator) []v3.Message {
 	fset := token.NewFileSet()
 	root, err := parser.ParseFile(fset, vofile, nil, parser.ParseComments)
@@ -156,12 +252,70 @@ func messagesOf(vofile string, p v3.ProtoGenerator) []v3.Message {
 	return ret
 }
 
+// oneofsOf returns interfaces in package dir annotated by @oneof, e.g. @oneof(Cat,Dog). Methods of members
+// may be declared in any file of the package.
+func oneofsOf(dir string) ([]v3.Oneof, error) {
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, dir, func(info os.FileInfo) bool {
+		return !strings.HasSuffix(info.Name(), "_test.go")
+	}, parser.ParseComments)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to parse %s", dir)
+	}
+	var files []*ast.File
+	for _, pkg := range pkgs {
+		names := make([]string, 0, len(pkg.Files))
+		for name := range pkg.Files {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			files = append(files, pkg.Files[name])
+		}
+	}
+	pointers := make(map[string]bool)
+	for _, root := range files {
+		for _, decl := range root.Decls {
+			if fd, ok := decl.(*ast.FuncDecl); ok && fd.Recv != nil {
+				if star, ok := fd.Recv.List[0].Type.(*ast.StarExpr); ok {
+					pointers[astutils.ExprString(star.X)] = true
+				}
+			}
+		}
+	}
+	var ret []v3.Oneof
+	for _, root := range files {
+		ic := astutils.NewInterfaceCollector(astutils.ExprString)
+		ast.Walk(ic, root)
+		for _, item := range ic.Interfaces {
+			for _, annotation := range astutils.GetAnnotations(strings.Join(item.Comments, " ")) {
+				if annotation.Name != "@oneof" {
+					continue
+				}
+				oneof := v3.Oneof{
+					Name: item.Name,
+				}
+				for _, param := range annotation.Params {
+					member := strings.TrimSpace(param)
+					if pointers[member] {
+						member = "*" + member
+					}
+					oneof.Members = append(oneof.Members, member)
+				}
+				ret = append(ret, oneof)
+			}
+		}
+	}
+	return ret, nil
+}
+
 func ParseDtoGrpc(dir string, p v3.ProtoGenerator, dtoDir string) {
 	var (
 		err        error
 		messages   []v3.Message
 		allMethods map[string][]astutils.MethodMeta
 		allConsts  map[string][]string
+		pkgPaths   map[string]string
 	)
 	vodir := filepath.Join(dir, dtoDir)
 	if _, err = os.Stat(vodir); os.IsNotExist(err) {
@@ -172,11 +326,34 @@ func ParseDtoGrpc(dir string, p v3.ProtoGenerator, dtoDir string) {
 	if err != nil {
 		panic(err)
 	}
+	pkgPaths = make(map[string]string)
+	pkgPathOf := func(file string) string {
+		pkgDir := filepath.Dir(file)
+		if _, ok := pkgPaths[pkgDir]; !ok {
+			pkgPaths[pkgDir] = astutils.GetPkgPath(pkgDir)
+		}
+		return pkgPaths[pkgDir]
+	}
+	pkgDirs := make(map[string]struct{})
 	for _, file := range files {
 		v3.MessageNames = append(v3.MessageNames, getSchemaNames(file)...)
+		pkgDir := filepath.Dir(file)
+		if _, ok := pkgDirs[pkgDir]; ok {
+			continue
+		}
+		pkgDirs[pkgDir] = struct{}{}
+		oneofs, err := oneofsOf(pkgDir)
+		if err != nil {
+			panic(err)
+		}
+		for _, oneof := range oneofs {
+			oneof.GoPackage = pkgPathOf(file)
+			v3.OneofStore[oneof.Name] = oneof
+		}
 	}
 	allMethods = make(map[string][]astutils.MethodMeta)
 	allConsts = make(map[string][]string)
+	enumPkgPaths := make(map[string]string)
 	for _, file := range files {
 		sc := astutils.EnumsOf(file, ExprStringP)
 		for k, v := range sc.Methods {
@@ -184,18 +361,24 @@ func ParseDtoGrpc(dir string, p v3.ProtoGenerator, dtoDir string) {
 		}
 		for k, v := range sc.Consts {
 			allConsts[k] = append(allConsts[k], v...)
+			enumPkgPaths[k] = pkgPathOf(file)
 		}
 	}
 	for k, v := range allMethods {
 		if v3Helper.IsEnumType(v) {
-			v3.EnumStore[k] = p.NewEnum(astutils.EnumMeta{
+			e := p.NewEnum(astutils.EnumMeta{
 				Name:   k,
 				Values: allConsts[k],
 			})
+			e.GoPackage = enumPkgPaths[k]
+			v3.EnumStore[k] = e
 		}
 	}
 	for _, file := range files {
-		messages = append(messages, messagesOf(file, p)...)
+		for _, message := range messagesOf(file, p) {
+			message.GoPackage = pkgPathOf(file)
+			messages = append(messages, message)
+		}
 	}
 	for _, item := range messages {
 		v3.MessageStore[item.Name] = item
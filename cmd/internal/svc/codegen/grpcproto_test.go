@@ -4,8 +4,12 @@ import (
 	"fmt"
 	"github.com/iancoleman/strcase"
 	v3 "github.com/unionj-cloud/go-doudou/v2/toolkit/protobuf/v3"
+	"github.com/stretchr/testify/require"
 	"github.com/unionj-cloud/go-doudou/v2/toolkit/astutils"
+	"io/ioutil"
+	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -17,3 +21,95 @@ func TestGenGrpcProto(t *testing.T) {
 	_, gotProtoFile := GenGrpcProto(testDir, ic, p)
 	fmt.Println(gotProtoFile)
 }
+
+func TestCheckGrpcProto(t *testing.T) {
+	svcfile := filepath.Join(testDir, "svc.go")
+	ic := astutils.BuildInterfaceCollector(svcfile, astutils.ExprString)
+	p := v3.NewProtoGenerator(v3.WithFieldNamingFunc(strcase.ToLowerCamel))
+	ParseDtoGrpc(testDir, p, "dto")
+	_, protoFile := GenGrpcProto(testDir, ic, p)
+	require.Empty(t, CheckGrpcProto(testDir, ic, p))
+
+	// switching naming strategy keeps field numbers
+	snake := v3.NewProtoGenerator(v3.WithFieldNamingFunc(strcase.ToSnake))
+	require.Empty(t, CheckGrpcProto(testDir, ic, snake))
+
+	content, err := ioutil.ReadFile(protoFile)
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(protoFile, []byte(strings.Replace(string(content), "service ", "service Legacy {\n  rpc LegacyRpc(google.protobuf.Empty) returns (google.protobuf.Empty);\n}\n\nservice ", 1)), os.ModePerm))
+	require.Equal(t, []string{"rpc LegacyRpc is removed"}, CheckGrpcProto(testDir, ic, p))
+}
+
+func TestGenGrpcProtoHttp(t *testing.T) {
+	t.Cleanup(func() {
+		delete(v3.ImportStore, "google/api/annotations.proto")
+	})
+	svcfile := filepath.Join(testDir, "svc.go")
+	ic := astutils.BuildInterfaceCollector(svcfile, astutils.ExprString)
+	p := v3.NewProtoGenerator(v3.WithFieldNamingFunc(strcase.ToLowerCamel), v3.WithHttpAnnotation(true))
+	ParseDtoGrpc(testDir, p, "dto")
+	service, protoFile := GenGrpcProto(testDir, ic, p)
+	require.True(t, service.HasHttpRule())
+	content, err := ioutil.ReadFile(protoFile)
+	require.NoError(t, err)
+	require.Contains(t, string(content), `import "google/api/annotations.proto";`)
+	require.Contains(t, string(content), "option (google.api.http) = {\n      get: \"/user\"\n    };")
+	_, err = v3.ParseSchema(string(content))
+	require.NoError(t, err)
+
+	GenGrpcHttpDoc(testDir, ic, service)
+	doc, err := ioutil.ReadFile(filepath.Join(testDir, "usersvc_openapi3.json"))
+	require.NoError(t, err)
+	require.Contains(t, string(doc), `"operationId":"GetUserRpc","parameters":[{"name":"userId","in":"query"`)
+}
+
+func TestGenGrpcTs(t *testing.T) {
+	svcfile := filepath.Join(testDir, "svc.go")
+	ic := astutils.BuildInterfaceCollector(svcfile, astutils.ExprString)
+	p := v3.NewProtoGenerator(v3.WithFieldNamingFunc(strcase.ToLowerCamel))
+	ParseDtoGrpc(testDir, p, "dto")
+	service, _ := GenGrpcProto(testDir, ic, p)
+	GenGrpcTs(testDir, ic, service)
+	content, err := ioutil.ReadFile(filepath.Join(testDir, "transport", "grpc", "usersvc.ts"))
+	require.NoError(t, err)
+	require.Contains(t, string(content), "export class UsersvcServiceClient {")
+	require.Contains(t, string(content), "getUserRpc(request: GetUserRpcRequest, options?: CallOptions): Promise<GetUserRpcResponse> {")
+	require.Contains(t, string(content), "  // 用户ID\n  userId?: string;")
+}
+
+func TestOneofsOf(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "animal.go"), []byte(`package dto
+
+// Animal is a pet
+// @oneof(Cat, Dog)
+type Animal interface {
+	isAnimal()
+}
+
+type Plain interface {
+	Name() string
+}
+
+type Cat struct{}
+
+func (Cat) isAnimal() {}
+`), os.ModePerm))
+	// methods of members may be declared in other files
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "dog.go"), []byte(`package dto
+
+type Dog struct{}
+
+func (*Dog) isAnimal() {}
+`), os.ModePerm))
+	oneofs, err := oneofsOf(dir)
+	require.NoError(t, err)
+	require.Equal(t, []v3.Oneof{{Name: "Animal", Members: []string{"Cat", "*Dog"}}}, oneofs)
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "broken.go"), []byte(`package dto
+
+type Broken struct {
+`), os.ModePerm))
+	_, err = oneofsOf(dir)
+	require.Error(t, err)
+}
@@ -0,0 +1,284 @@
+package codegen
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/iancoleman/strcase"
+	"github.com/sirupsen/logrus"
+	"github.com/unionj-cloud/go-doudou/v2/toolkit/astutils"
+	v3 "github.com/unionj-cloud/go-doudou/v2/toolkit/protobuf/v3"
+)
+
+var tsTmpl = `/**
+ * Generated by go-doudou {{.Version}}.
+ * Don't edit!
+ *
+ * Client of {{.Package}}.{{.Name}} speaking Connect protocol with JSON encoding. It works with grpc servers
+ * started with GDD_GRPC_WEB_ENABLE=true and GDD_GRPC_HTTP_MODE set.
+ */
+{{- range $e := .Enums }}
+
+export type {{$e.Name}} = {{ tsEnum $e }};
+{{- end }}
+{{- range $m := .Messages }}
+{{- if not $m.IsImported }}
+{{ if $m.Comments }}
+{{ tsComment $m.Comments "" }}
+{{- end }}
+export interface {{$m.Name}} {
+  {{- range $f := $m.Fields }}
+  {{- if $f.Comments }}
+  {{ tsComment $f.Comments "  " }}
+  {{- end }}
+  {{ jsonName $f }}?: {{ tsType $f.Type }};
+  {{- end }}
+}
+{{- end }}
+{{- end }}
+
+export interface CallOptions {
+  headers?: Record<string, string>;
+  signal?: AbortSignal;
+  timeoutMs?: number;
+}
+
+export class ConnectError extends Error {
+  constructor(
+    readonly code: string,
+    message: string,
+    readonly details: { type: string; value: string }[] = [],
+    readonly metadata: Headers = new Headers(),
+  ) {
+    super(message);
+    this.name = "ConnectError";
+  }
+}
+
+function errorOf(data: any, metadata?: Headers): ConnectError {
+  return new ConnectError(data?.code ?? "unknown", data?.message ?? "", data?.details ?? [], metadata);
+}
+
+function envelope(data: Uint8Array, flags = 0): Uint8Array {
+  const frame = new Uint8Array(5 + data.length);
+  frame[0] = flags;
+  new DataView(frame.buffer).setUint32(1, data.length);
+  frame.set(data, 5);
+  return frame;
+}
+{{ if .Comments }}
+{{ tsComment .Comments "" }}
+{{- end }}
+export class {{.Name}}Client {
+  constructor(private readonly baseUrl: string, private readonly defaults: CallOptions = {}) {}
+  {{- range $r := .Rpcs }}
+  {{- if eq $r.StreamType 0 }}
+{{ if $r.Comments }}
+  {{ tsComment $r.Comments "  " }}
+{{- end }}
+  {{ rpcName $r }}(request: {{ tsType $r.Request }}, options?: CallOptions): Promise<{{ tsType $r.Response }}> {
+    return this.unary("{{$r.Name}}", request, options);
+  }
+  {{- else if eq $r.StreamType 3 }}
+{{ if $r.Comments }}
+  {{ tsComment $r.Comments "  " }}
+{{- end }}
+  {{ rpcName $r }}(request: {{ tsType $r.Request }}, options?: CallOptions): AsyncGenerator<{{ tsType $r.Response }}> {
+    return this.serverStream("{{$r.Name}}", request, options);
+  }
+  {{- else }}
+
+  // {{$r.Name}} is not generated, as browsers cannot stream request bodies
+  {{- end }}
+  {{- end }}
+
+  private init(contentType: string, body: BodyInit, options?: CallOptions): RequestInit {
+    const opts = { ...this.defaults, ...options };
+    const headers: Record<string, string> = {
+      ...this.defaults.headers,
+      ...options?.headers,
+      "Content-Type": contentType,
+      "Connect-Protocol-Version": "1",
+    };
+    if (opts.timeoutMs !== undefined) {
+      headers["Connect-Timeout-Ms"] = String(opts.timeoutMs);
+    }
+    return { method: "POST", headers, body, signal: opts.signal };
+  }
+
+  private async unary<I, O>(method: string, request: I, options?: CallOptions): Promise<O> {
+    const response = await fetch(
+      ` + "`${this.baseUrl}/{{.Package}}.{{.Name}}/${method}`" + `,
+      this.init("application/json", JSON.stringify(request), options),
+    );
+    const data = await response.json().catch(() => ({}));
+    if (!response.ok) {
+      throw errorOf(data, response.headers);
+    }
+    return data as O;
+  }
+
+  private async *serverStream<I, O>(method: string, request: I, options?: CallOptions): AsyncGenerator<O> {
+    const response = await fetch(
+      ` + "`${this.baseUrl}/{{.Package}}.{{.Name}}/${method}`" + `,
+      this.init("application/connect+json", envelope(new TextEncoder().encode(JSON.stringify(request))), options),
+    );
+    if (!response.ok || !response.body) {
+      throw errorOf(await response.json().catch(() => ({})), response.headers);
+    }
+    const reader = response.body.getReader();
+    const decoder = new TextDecoder();
+    let buffer = new Uint8Array(0);
+    for (;;) {
+      const { done, value } = await reader.read();
+      if (value) {
+        const merged = new Uint8Array(buffer.length + value.length);
+        merged.set(buffer);
+        merged.set(value, buffer.length);
+        buffer = merged;
+      }
+      while (buffer.length >= 5) {
+        const size = new DataView(buffer.buffer, buffer.byteOffset).getUint32(1);
+        if (buffer.length < 5 + size) {
+          break;
+        }
+        const flags = buffer[0];
+        const data = JSON.parse(decoder.decode(buffer.subarray(5, 5 + size)) || "{}");
+        buffer = buffer.subarray(5 + size);
+        if (flags & 0x02) {
+          if (data.error) {
+            throw errorOf(data.error, new Headers(data.metadata ?? {}));
+          }
+          return;
+        }
+        yield data as O;
+      }
+      if (done) {
+        throw new ConnectError("unknown", "stream ended without end-stream message");
+      }
+    }
+  }
+}
+`
+
+var tsScalarTypes = map[string]string{
+	"double":                      "number",
+	"float":                       "number",
+	"int32":                       "number",
+	"uint32":                      "number",
+	"int64":                       "string",
+	"uint64":                      "string",
+	"bool":                        "boolean",
+	"string":                      "string",
+	"bytes":                       "string",
+	"google.protobuf.Timestamp":   "string",
+	"google.protobuf.Duration":    "string",
+	"google.protobuf.DoubleValue": "number",
+	"google.protobuf.FloatValue":  "number",
+	"google.protobuf.Int32Value":  "number",
+	"google.protobuf.UInt32Value": "number",
+	"google.protobuf.Int64Value":  "string",
+	"google.protobuf.UInt64Value": "string",
+	"google.protobuf.BoolValue":   "boolean",
+	"google.protobuf.StringValue": "string",
+	"google.protobuf.BytesValue":  "string",
+	"google.protobuf.Any":         `{ "@type": string; [key: string]: unknown }`,
+	"google.protobuf.Empty":       "Record<string, never>",
+}
+
+// tsType returns TypeScript type of protobuf type as encoded by protojson
+func tsType(t v3.ProtobufType) string {
+	if m, ok := t.(v3.Message); ok && m.Inner() && !m.IsRepeated && !m.IsMap {
+		fields := make([]string, 0, len(m.Fields))
+		for _, f := range m.Fields {
+			fields = append(fields, fmt.Sprintf("%s?: %s", jsonName(f), tsType(f.Type)))
+		}
+		return "{ " + strings.Join(fields, "; ") + " }"
+	}
+	return tsTypeOfName(t.GetName())
+}
+
+func tsTypeOfName(name string) string {
+	name = strings.TrimPrefix(name, "stream ")
+	if strings.HasPrefix(name, "repeated ") {
+		return tsTypeOfName(strings.TrimPrefix(name, "repeated ")) + "[]"
+	}
+	if strings.HasPrefix(name, "map<") {
+		value := strings.TrimSpace(name[strings.Index(name, ",")+1 : len(name)-1])
+		return "{ [key: string]: " + tsTypeOfName(value) + " }"
+	}
+	if t, ok := tsScalarTypes[name]; ok {
+		return t
+	}
+	return name
+}
+
+func tsEnum(e v3.Enum) string {
+	values := make([]string, 0, len(e.Fields))
+	for _, f := range e.Fields {
+		values = append(values, fmt.Sprintf("%q", f.Name))
+	}
+	return strings.Join(values, " | ")
+}
+
+func jsonName(f v3.Field) string {
+	if f.JsonName != "" {
+		return f.JsonName
+	}
+	return f.Name
+}
+
+func tsComment(comments []string, indent string) string {
+	if len(comments) == 0 {
+		return ""
+	}
+	var b strings.Builder
+	for i := range comments {
+		if i > 0 {
+			b.WriteString("\n" + indent)
+		}
+		b.WriteString("// " + comments[i])
+	}
+	return b.String()
+}
+
+func rpcName(rpc v3.Rpc) string {
+	return strcase.ToLowerCamel(rpc.Name)
+}
+
+func grpcTsFile(dir string, ic astutils.InterfaceCollector) string {
+	return filepath.Join(dir, "transport/grpc", strings.ToLower(ic.Interfaces[0].Name)+".ts")
+}
+
+// GenGrpcTs generates TypeScript client stubs of unary and server streaming rpcs for browsers,
+// which call the service over Connect protocol served by grpcweb.Handler
+func GenGrpcTs(dir string, ic astutils.InterfaceCollector, grpcSvc v3.Service) {
+	var (
+		err error
+		tpl *template.Template
+		f   *os.File
+	)
+	tsFile := grpcTsFile(dir, ic)
+	if _, err = os.Stat(tsFile); err == nil {
+		logrus.Warningln("file " + tsFile + " will be overwritten")
+	}
+	if f, err = os.Create(tsFile); err != nil {
+		panic(err)
+	}
+	defer f.Close()
+	funcMap := make(map[string]interface{})
+	funcMap["tsType"] = tsType
+	funcMap["tsComment"] = tsComment
+	funcMap["tsEnum"] = tsEnum
+	funcMap["jsonName"] = jsonName
+	funcMap["rpcName"] = rpcName
+	if tpl, err = template.New("ts.tmpl").Funcs(funcMap).Parse(tsTmpl); err != nil {
+		panic(err)
+	}
+	if err = tpl.Execute(f, grpcSvc); err != nil {
+		panic(err)
+	}
+}
@@ -28,6 +28,7 @@ import (
 	"github.com/klauspost/compress/gzip"
 	"github.com/unionj-cloud/go-doudou/v2/toolkit/fileutils"
 	"github.com/unionj-cloud/go-doudou/v2/toolkit/stringutils"
+	"github.com/unionj-cloud/go-doudou/v2/framework/hedging"
 	"github.com/unionj-cloud/go-doudou/v2/framework/registry"
 	"github.com/unionj-cloud/go-doudou/v2/framework/restclient"
 	v3 "github.com/unionj-cloud/go-doudou/v2/toolkit/openapi/v3"
@@ -76,7 +77,11 @@ func (receiver *{{.Meta.Name}}Client) SetClient(client *resty.Client) {
 		if len(_headers) > 0 {
 			_req.SetHeaders(_headers)
 		}
+		{{- if isHedged $m }}
+		_req.SetContext(hedging.NewContext(ctx, "{{$.Meta.Name}}.{{$m.Name}}"))
+		{{- else }}
 		_req.SetContext(ctx)
+		{{- end }}
 		{{- range $p := $m.Params }}
 		{{- if $p.IsPathVariable }}
 		{{- if IsEnum $p }}
@@ -363,6 +368,13 @@ func New{{.Meta.Name}}Client(opts ...restclient.RestClientOption) *{{.Meta.Name}
 		opt(svcClient)
 	}
 
+	restclient.TrackLoad(svcClient.client, svcClient.provider)
+
+	{{- if hasHedged .Meta.Methods }}
+
+	restclient.HedgeRequests(svcClient.client, svcClient.provider)
+	{{- end }}
+
 	svcClient.client.OnBeforeRequest(func(_ *resty.Client, request *resty.Request) error {
 		request.URL = svcClient.provider.SelectServer() + svcClient.rootPath + request.URL
 		return nil
@@ -384,6 +396,29 @@ func New{{.Meta.Name}}Client(opts ...restclient.RestClientOption) *{{.Meta.Name}
 }
 `
 
+// hedgeAnnotation marks idempotent methods whose calls are hedged, see hedging.Annotation of framework
+const hedgeAnnotation = "@hedge"
+
+// isHedged checks if calls of the method are hedged
+func isHedged(method astutils.MethodMeta) bool {
+	for _, item := range method.Annotations {
+		if item.Name == hedgeAnnotation {
+			return true
+		}
+	}
+	return false
+}
+
+// hasHedged checks if calls of any method are hedged
+func hasHedged(methods []astutils.MethodMeta) bool {
+	for _, method := range methods {
+		if isHedged(method) {
+			return true
+		}
+	}
+	return false
+}
+
 func restyMethod(method string) string {
 	hm, _ := astutils.Pattern(method)
 	return strings.Title(strings.ToLower(hm))
@@ -446,6 +481,8 @@ func GenGoClient(dir string, ic astutils.InterfaceCollector, config GenGoClientC
 	funcMap["isSlice"] = v3helper.IsSlice
 	funcMap["isVarargs"] = v3helper.IsVarargs
 	funcMap["IsEnum"] = v3helper.IsEnum
+	funcMap["isHedged"] = isHedged
+	funcMap["hasHedged"] = hasHedged
 	if tpl, err = template.New("client.go.tmpl").Funcs(funcMap).Parse(clientTmpl); err != nil {
 		panic(err)
 	}
@@ -1,12 +1,15 @@
 package codegen
 
 import (
+	"bytes"
 	"github.com/iancoleman/strcase"
 	"github.com/pkg/errors"
 	. "github.com/smartystreets/goconvey/convey"
 	"github.com/unionj-cloud/go-doudou/v2/toolkit/astutils"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -45,6 +48,31 @@ func TestGenGoClient(t *testing.T) {
 	}
 }
 
+func TestGenGoClientHedged(t *testing.T) {
+	Convey("Should hedge calls of methods annotated by @hedge", t, func() {
+		dir := testDir + "clientHedged"
+		InitSvc(dir)
+		defer os.RemoveAll(dir)
+		svcfile := filepath.Join(dir, "svc.go")
+		content, err := ioutil.ReadFile(svcfile)
+		So(err, ShouldBeNil)
+		content = bytes.Replace(content, []byte("\tGetUser_Id("), []byte("\t// @hedge()\n\tGetUser_Id("), 1)
+		So(ioutil.WriteFile(svcfile, content, os.ModePerm), ShouldBeNil)
+		ic := astutils.BuildInterfaceCollector(svcfile, astutils.ExprString)
+		GenGoClient(dir, ic, GenGoClientConfig{
+			RoutePatternStrategy: 1,
+			CaseConvertor:        strcase.ToLowerCamel,
+		})
+		content, err = ioutil.ReadFile(filepath.Join(dir, "client", "client.go"))
+		So(err, ShouldBeNil)
+		source := string(content)
+		So(source, ShouldContainSubstring, `_req.SetContext(hedging.NewContext(ctx, "TestdataclientHedged.GetUser_Id"))`)
+		So(strings.Count(source, "hedging.NewContext"), ShouldEqual, 1)
+		So(source, ShouldContainSubstring, "restclient.TrackLoad(svcClient.client, svcClient.provider)")
+		So(source, ShouldContainSubstring, "restclient.HedgeRequests(svcClient.client, svcClient.provider)")
+	})
+}
+
 func TestGenGoClientPanic_Stat(t *testing.T) {
 	Convey("Test GenGoClient panic from Stat", t, func() {
 		MkdirAll = os.MkdirAll
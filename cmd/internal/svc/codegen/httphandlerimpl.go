@@ -7,6 +7,7 @@ import (
 	"github.com/unionj-cloud/go-doudou/v2/toolkit/astutils"
 	"github.com/unionj-cloud/go-doudou/v2/toolkit/copier"
 	v3helper "github.com/unionj-cloud/go-doudou/v2/toolkit/openapi/v3"
+	paginate "github.com/unionj-cloud/go-doudou/v2/toolkit/pagination/gorm"
 	"github.com/unionj-cloud/go-doudou/v2/version"
 	"io/ioutil"
 	"os"
@@ -313,6 +314,15 @@ var appendHttpHandlerImplTmpl = `
 		}{{- end }}
 		{{- end }}
 		{{- end }}
+		{{- if hasFilterSchema $m }}
+		{{- range $p := $m.Params }}
+		{{- if isPaginationParameter $p }}
+		if _err := paginate.ValidateFilters(RouteAnnotationStore, "{{$m.Name}}", {{ if and (eq $m.HttpMethod "GET") (not (isBuiltin $p)) }}{{ $p.Name }}Wrapper.{{ $p.Name | title }}{{ else }}{{ $p.Name }}{{ end }}); _err != nil {
+			panic(rest.NewBizError(_err, rest.WithStatusCode(http.StatusBadRequest), rest.WithDetails(_err.Violations)))
+		}
+		{{- end }}
+		{{- end }}
+		{{- end }}
 		{{ range $i, $r := $m.Results }}{{- if $i}},{{- end}}{{- $r.Name }}{{- end }} = receiver.{{$.Meta.Name | toLowerCamel}}.{{$m.Name}}(
 			{{- range $p := $m.Params }}
 			{{- if isVarargs $p.Type }}
@@ -382,6 +392,7 @@ var importTmpl = `
 	"github.com/unionj-cloud/go-doudou/v2/framework/rest"
 	"github.com/unionj-cloud/go-doudou/v2/framework/rest/httprouter"
 	"github.com/unionj-cloud/go-doudou/v2/toolkit/cast"
+	paginate "github.com/unionj-cloud/go-doudou/v2/toolkit/pagination/gorm"
 	{{.ServiceAlias}} "{{.ServicePackage}}"
 	"net/http"
 	"{{.DtoPackage}}"
@@ -482,6 +493,8 @@ func GenHttpHandlerImpl(dir string, ic astutils.InterfaceCollector, config GenHt
 	funcMap["TrimPrefix"] = strings.TrimPrefix
 	funcMap["ElementType"] = v3helper.ElementType
 	funcMap["title"] = strings.Title
+	funcMap["hasFilterSchema"] = hasFilterSchema
+	funcMap["isPaginationParameter"] = isPaginationParameter
 	if tpl, err = template.New("handlerimpl.go.tmpl").Funcs(funcMap).Parse(tmpl); err != nil {
 		panic(err)
 	}
@@ -528,6 +541,22 @@ func GenHttpHandlerImpl(dir string, ic astutils.InterfaceCollector, config GenHt
 	astutils.FixImport(original, handlerimplfile)
 }
 
+// hasFilterSchema checks if the method declares allowed pagination filters or sorts by annotations
+func hasFilterSchema(method astutils.MethodMeta) bool {
+	for _, item := range method.Annotations {
+		if item.Name == paginate.FilterAnnotation || item.Name == paginate.SortAnnotation {
+			return true
+		}
+	}
+	return false
+}
+
+// isPaginationParameter checks if the param is dto.Parameter or its pointer which can be converted to paginate.Parameter
+func isPaginationParameter(param astutils.FieldMeta) bool {
+	elem := strings.TrimPrefix(param.Type, "*")
+	return elem == "Parameter" || strings.HasSuffix(elem, ".Parameter")
+}
+
 func unimplementedMethods(meta *astutils.InterfaceMeta, httpDir string) {
 	sc := astutils.NewStructCollector(astutils.ExprString)
 	astutils.CollectStructsInFolder(httpDir, sc)
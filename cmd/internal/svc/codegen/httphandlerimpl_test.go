@@ -2,9 +2,14 @@ package codegen
 
 import (
 	"fmt"
+	"github.com/iancoleman/strcase"
+	"github.com/stretchr/testify/require"
 	"github.com/unionj-cloud/go-doudou/v2/toolkit/astutils"
 	"github.com/unionj-cloud/go-doudou/v2/toolkit/copier"
+	"io/ioutil"
+	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -15,3 +20,22 @@ func Test_unimplementedMethods(t *testing.T) {
 	unimplementedMethods(&meta, filepath.Join(testDir, "transport/httpsrv"))
 	fmt.Println(len(meta.Methods))
 }
+
+func TestGenHttpHandlerImplFilterSchema(t *testing.T) {
+	dir := testDir + "filterschema"
+	InitSvc(dir)
+	defer os.RemoveAll(dir)
+	svcfile := filepath.Join(dir, "svc.go")
+	source, err := ioutil.ReadFile(svcfile)
+	require.NoError(t, err)
+	source = []byte(strings.Replace(string(source), "	GetUsers(ctx", "	// @filter(name:string:=|like)@sort(name)\n	GetUsers(ctx", 1))
+	require.NoError(t, ioutil.WriteFile(svcfile, source, os.ModePerm))
+	ic := astutils.BuildInterfaceCollector(svcfile, astutils.ExprString)
+	GenHttpHandlerImpl(dir, ic, GenHttpHandlerImplConfig{
+		CaseConvertor: strcase.ToLowerCamel,
+	})
+	impl, err := ioutil.ReadFile(filepath.Join(dir, "transport/httpsrv/handlerimpl.go"))
+	require.NoError(t, err)
+	require.Contains(t, string(impl), `paginate.ValidateFilters(RouteAnnotationStore, "GetUsers", parameterWrapper.Parameter)`)
+	require.Equal(t, 1, strings.Count(string(impl), "paginate.ValidateFilters"))
+}
@@ -94,6 +94,16 @@ type Svc struct {
 	AllowGetWithReqBody bool
 
 	DbConfig *DbConfig
+
+	// GrpcCheck indicates whether only check the proto file to be generated against the existing one
+	// and fail on breaking changes, nothing is generated
+	GrpcCheck bool
+
+	// GrpcTs indicates whether generate TypeScript client stubs calling the grpc service over Connect protocol
+	GrpcTs bool
+
+	// GrpcClient indicates whether generate client package implementing the service interface by calling the grpc service
+	GrpcClient bool
 }
 
 type DbConfig struct {
@@ -227,6 +237,24 @@ func WithDbConfig(dbConfig *DbConfig) SvcOption {
 	}
 }
 
+func WithGrpcCheck(check bool) SvcOption {
+	return func(svc *Svc) {
+		svc.GrpcCheck = check
+	}
+}
+
+func WithGrpcTs(ts bool) SvcOption {
+	return func(svc *Svc) {
+		svc.GrpcTs = ts
+	}
+}
+
+func WithGrpcClient(client bool) SvcOption {
+	return func(svc *Svc) {
+		svc.GrpcClient = client
+	}
+}
+
 // NewSvc new Svc instance
 func NewSvc(dir string, opts ...SvcOption) ISvc {
 	ret := Svc{
@@ -473,9 +501,20 @@ func (receiver *Svc) Grpc(p v3.ProtoGenerator) {
 	validate.ValidateDataType(dir)
 	ic := astutils.BuildInterfaceCollector(filepath.Join(dir, "svc.go"), astutils.ExprString)
 	validate.ValidateRestApi(dir, ic)
-	codegen.GenConfig(dir)
 	codegen.ParseDtoGrpc(dir, p, "vo")
 	codegen.ParseDtoGrpc(dir, p, "dto")
+	// --check only parses and compares, it must not touch the working tree
+	if receiver.GrpcCheck {
+		changes := codegen.CheckGrpcProto(dir, ic, p)
+		for _, change := range changes {
+			logrus.Errorln(change)
+		}
+		if len(changes) > 0 {
+			panic(fmt.Errorf("found %d breaking changes in proto file", len(changes)))
+		}
+		return
+	}
+	codegen.GenConfig(dir)
 	grpcSvc, protoFile := codegen.GenGrpcProto(dir, ic, p)
 	// protoc --proto_path=. --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative transport/grpc/helloworld.proto
 	if err := receiver.runner.Run("protoc", "--proto_path=.",
@@ -486,8 +525,19 @@ func (receiver *Svc) Grpc(p v3.ProtoGenerator) {
 		protoFile); err != nil {
 		panic(err)
 	}
+	codegen.GenGrpcConverter(dir, grpcSvc)
 	codegen.GenSvcImplGrpc(dir, ic, grpcSvc)
 	codegen.GenMainGrpc(dir, ic, grpcSvc)
+	// services having http handlers are described by their own OpenAPI doc with the same routes
+	if _, err := os.Stat(filepath.Join(dir, "transport", "httpsrv", "handler.go")); os.IsNotExist(err) && grpcSvc.HasHttpRule() {
+		codegen.GenGrpcHttpDoc(dir, ic, grpcSvc)
+	}
+	if receiver.GrpcTs {
+		codegen.GenGrpcTs(dir, ic, grpcSvc)
+	}
+	if receiver.GrpcClient {
+		codegen.GenGrpcClient(dir, ic, grpcSvc)
+	}
 	codegen.FixModGrpc(dir)
 	codegen.GenMethodAnnotationStore(dir, ic)
 	runner := receiver.runner
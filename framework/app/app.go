@@ -0,0 +1,190 @@
+// Package app runs rest and grpc servers of a service as one application. App starts lifecycle hooks, serves http
+// routes on GDD_PORT and grpc services on GDD_GRPC_PORT, registers both with service discovery at once, and shuts
+// both down together on SIGINT, SIGTERM or cancellation of the context passed to Run. Framework config is loaded
+// from .env, yaml files and remote config centers once the package is imported.
+package app
+
+import (
+	"context"
+	"net/http"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/unionj-cloud/go-doudou/v2/framework/grpcx"
+	"github.com/unionj-cloud/go-doudou/v2/framework/internal/banner"
+	"github.com/unionj-cloud/go-doudou/v2/framework/lifecycle"
+	register "github.com/unionj-cloud/go-doudou/v2/framework/registry"
+	"github.com/unionj-cloud/go-doudou/v2/framework/rest"
+	logger "github.com/unionj-cloud/go-doudou/v2/toolkit/zlogger"
+	"google.golang.org/grpc"
+)
+
+var _ grpc.ServiceRegistrar = (*App)(nil)
+
+// App owns rest and grpc servers of a service
+type App struct {
+	data        map[string]interface{}
+	grpcOptions []grpc.ServerOption
+	unary       []grpc.UnaryServerInterceptor
+	stream      []grpc.StreamServerInterceptor
+	middlewares []func(http.Handler) http.Handler
+	manager     *lifecycle.Manager
+	rest        *rest.RestServer
+	grpc        *grpcx.GrpcServer
+	runOnce     sync.Once
+}
+
+// Option configures App
+type Option func(*App)
+
+// WithUserData sets metadata registered with service discovery for both servers
+func WithUserData(data map[string]interface{}) Option {
+	return func(a *App) {
+		a.data = data
+	}
+}
+
+// WithUnaryInterceptors chains unary server interceptors shared by all grpc services
+func WithUnaryInterceptors(interceptors ...grpc.UnaryServerInterceptor) Option {
+	return func(a *App) {
+		a.unary = append(a.unary, interceptors...)
+	}
+}
+
+// WithStreamInterceptors chains stream server interceptors shared by all grpc services
+func WithStreamInterceptors(interceptors ...grpc.StreamServerInterceptor) Option {
+	return func(a *App) {
+		a.stream = append(a.stream, interceptors...)
+	}
+}
+
+// WithGrpcServerOptions appends options of grpc server
+func WithGrpcServerOptions(opts ...grpc.ServerOption) Option {
+	return func(a *App) {
+		a.grpcOptions = append(a.grpcOptions, opts...)
+	}
+}
+
+// WithMiddlewares adds middlewares shared by all http routes, including routes transcoded to grpc services
+func WithMiddlewares(mwf ...func(http.Handler) http.Handler) Option {
+	return func(a *App) {
+		a.middlewares = append(a.middlewares, mwf...)
+	}
+}
+
+// WithLifecycle sets the lifecycle manager running hooks, lifecycle.Default() by default. A manager runs once,
+// so Run of another App sharing a stopped manager returns lifecycle.ErrStopped.
+func WithLifecycle(manager *lifecycle.Manager) Option {
+	return func(a *App) {
+		a.manager = manager
+	}
+}
+
+// WithRestServer sets the rest server instead of creating one
+func WithRestServer(srv *rest.RestServer) Option {
+	return func(a *App) {
+		a.rest = srv
+	}
+}
+
+// WithGrpcServer sets the grpc server instead of creating one, options and interceptors of grpc server set by
+// other options are ignored
+func WithGrpcServer(srv *grpcx.GrpcServer) Option {
+	return func(a *App) {
+		a.grpc = srv
+	}
+}
+
+// New creates an App
+func New(opts ...Option) *App {
+	a := &App{
+		manager: lifecycle.Default(),
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	if a.rest == nil {
+		a.rest = rest.NewRestServerWithOptions(rest.WithUserData(a.data))
+	}
+	a.rest.AddMiddleware(a.middlewares...)
+	if a.grpc == nil {
+		grpcOptions := a.grpcOptions
+		if len(a.unary) > 0 {
+			grpcOptions = append(grpcOptions, grpc.ChainUnaryInterceptor(a.unary...))
+		}
+		if len(a.stream) > 0 {
+			grpcOptions = append(grpcOptions, grpc.ChainStreamInterceptor(a.stream...))
+		}
+		a.grpc = grpcx.NewGrpcServerWithData(a.data, grpcOptions...)
+	}
+	return a
+}
+
+// Rest returns the rest server, e.g. for adding routes
+func (a *App) Rest() *rest.RestServer {
+	return a.rest
+}
+
+// Grpc returns the grpc server
+func (a *App) Grpc() *grpcx.GrpcServer {
+	return a.grpc
+}
+
+// AddRoute adds http routes
+func (a *App) AddRoute(route ...rest.Route) {
+	a.rest.AddRoute(route...)
+}
+
+// RegisterService registers grpc service, so that App can be passed to generated pb.RegisterXxxServer
+func (a *App) RegisterService(desc *grpc.ServiceDesc, impl interface{}) {
+	a.grpc.RegisterService(desc, impl)
+}
+
+// hasGrpc reports whether grpc services are registered, the grpc server isn't started otherwise
+func (a *App) hasGrpc() bool {
+	return len(a.grpc.GetServiceInfo()) > 0
+}
+
+// Run starts lifecycle hooks and servers, registers the service, then blocks until SIGINT or SIGTERM is received
+// or ctx is done, and shuts down gracefully. Errors of hooks and servers failing to start or stop are returned.
+// Run can be called only once.
+func (a *App) Run(ctx context.Context) error {
+	err := errors.New("app is already run")
+	a.runOnce.Do(func() {
+		err = a.run(ctx)
+	})
+	return err
+}
+
+func (a *App) run(ctx context.Context) error {
+	banner.Print()
+	if err := a.manager.Start(ctx); err != nil {
+		return err
+	}
+	restServer, err := a.rest.Start()
+	if err != nil {
+		a.manager.Shutdown(nil)
+		return err
+	}
+	servers := []lifecycle.Hook{restServer}
+	registerFn, deregisterFn := register.NewRest, register.ShutdownRest
+	if a.hasGrpc() {
+		grpcServers, err := a.grpc.Start("")
+		if err != nil {
+			a.manager.Shutdown(nil, servers...)
+			return err
+		}
+		servers = append(servers, grpcServers...)
+		registerFn, deregisterFn = register.NewRestGrpc, register.ShutdownRestGrpc
+	}
+	registerFn(a.data)
+	if sig := lifecycle.Wait(ctx); sig != nil {
+		logger.Info().Msgf("[go-doudou] received %s, shutting down", sig)
+	} else {
+		logger.Info().Msg("[go-doudou] context is done, shutting down")
+	}
+	return a.manager.Shutdown(func() {
+		deregisterFn()
+		a.grpc.HealthServer().Shutdown()
+	}, servers...)
+}
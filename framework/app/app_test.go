@@ -0,0 +1,106 @@
+package app
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/unionj-cloud/go-doudou/v2/framework/lifecycle"
+	"github.com/unionj-cloud/go-doudou/v2/framework/rest"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func freePort(t *testing.T) string {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer lis.Close()
+	return strconv.Itoa(lis.Addr().(*net.TCPAddr).Port)
+}
+
+func TestRun(t *testing.T) {
+	httpPort, grpcPort := freePort(t), freePort(t)
+	t.Setenv("GDD_HOST", "127.0.0.1")
+	t.Setenv("GDD_PORT", httpPort)
+	t.Setenv("GDD_GRPC_PORT", grpcPort)
+	t.Setenv("GDD_SERVICE_DISCOVERY_MODE", "")
+	t.Setenv("GDD_GRACE_TIMEOUT", "1s")
+
+	var intercepted, stopped bool
+	manager := lifecycle.New()
+	manager.Append(lifecycle.Hook{
+		Name: "db",
+		OnStop: func(ctx context.Context) error {
+			stopped = true
+			return nil
+		},
+	})
+	a := New(
+		WithLifecycle(manager),
+		WithMiddlewares(func(inner http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("X-App", "go-doudou")
+				inner.ServeHTTP(w, r)
+			})
+		}),
+		WithUnaryInterceptors(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			intercepted = true
+			return handler(ctx, req)
+		}),
+	)
+	a.AddRoute(rest.Route{
+		Name:    "GetHello",
+		Method:  http.MethodGet,
+		Pattern: "/hello",
+		HandlerFunc: func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, "hello")
+		},
+	})
+	grpc_health_v1.RegisterHealthServer(a, health.NewServer())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- a.Run(ctx)
+	}()
+
+	var resp *http.Response
+	require.Eventually(t, func() bool {
+		var err error
+		resp, err = http.Get("http://127.0.0.1:" + httpPort + "/hello")
+		return err == nil
+	}, 5*time.Second, 20*time.Millisecond)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.Equal(t, "hello", string(body))
+	require.Equal(t, "go-doudou", resp.Header.Get("X-App"))
+
+	conn, err := grpc.Dial("127.0.0.1:"+grpcPort, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+	check, err := grpc_health_v1.NewHealthClient(conn).Check(context.Background(), &grpc_health_v1.HealthCheckRequest{})
+	require.NoError(t, err)
+	require.Equal(t, grpc_health_v1.HealthCheckResponse_SERVING, check.Status)
+	require.True(t, intercepted)
+
+	cancel()
+	select {
+	case err = <-done:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("app is not stopped")
+	}
+	require.True(t, stopped)
+	_, err = http.Get("http://127.0.0.1:" + httpPort + "/hello")
+	require.Error(t, err)
+	require.EqualError(t, a.Run(context.Background()), "app is already run")
+	// hooks have been stopped, so another app can't run with them
+	require.ErrorIs(t, New(WithLifecycle(manager)).Run(context.Background()), lifecycle.ErrStopped)
+}
@@ -17,7 +17,7 @@ func NewLruCache(size int, ttl time.Duration) *LruCache {
 		panic(errors.Wrap(err, caller.NewCaller().String()))
 	}
 	return &LruCache{
-		newBase(&LruCacheAdapter{store}, ttl),
+		newBase(NewLruCacheAdapter(store), ttl),
 	}
 }
 
@@ -25,6 +25,11 @@ type LruCacheAdapter struct {
 	store *lru.Cache
 }
 
+// NewLruCacheAdapter adapts store to IStore
+func NewLruCacheAdapter(store *lru.Cache) *LruCacheAdapter {
+	return &LruCacheAdapter{store}
+}
+
 func (l *LruCacheAdapter) Get(key interface{}) (value interface{}, ok bool) {
 	return l.store.Get(key)
 }
@@ -169,6 +169,7 @@ func (m *NacosConfigMgr) CallbackOnChange(namespace, group, dataId, data, old st
 	}
 	changes := maputils.Diff(newData, oldData)
 	m.onChange("__"+dataId+"__"+"rest", group, namespace, changes)
+	m.onChange("__"+dataId+"__"+"router", group, namespace, changes)
 	m.onChange(dataId, group, namespace, changes)
 }
 
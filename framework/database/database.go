@@ -1,10 +1,15 @@
 package database
 
 import (
+	"context"
+	"github.com/pkg/errors"
 	"github.com/unionj-cloud/go-doudou/v2/framework/internal/config"
+	"github.com/unionj-cloud/go-doudou/v2/framework/lifecycle"
 	"github.com/unionj-cloud/go-doudou/v2/toolkit/cast"
 	"github.com/unionj-cloud/go-doudou/v2/toolkit/errorx"
+	"github.com/unionj-cloud/go-doudou/v2/toolkit/governance"
 	"github.com/unionj-cloud/go-doudou/v2/toolkit/stringutils"
+	"github.com/unionj-cloud/go-doudou/v2/toolkit/tenant"
 	"github.com/unionj-cloud/go-doudou/v2/toolkit/zlogger"
 	"gorm.io/driver/clickhouse"
 	"gorm.io/driver/mysql"
@@ -29,8 +34,19 @@ const (
 	driverClickhouse = "clickhouse"
 )
 
+const (
+	tenantSharedTable = "shared_table"
+	tenantSchema      = "schema"
+	tenantDatabase    = "database"
+	// tenantPlaceholder in GDD_DB_DSN is replaced by tenant id for database per tenant strategy
+	tenantPlaceholder = "{tenant}"
+)
+
 var Db *gorm.DB
 
+// TenantPool holds database of each tenant if GDD_DB_TENANT_STRATEGY is database, Db is nil in that case
+var TenantPool *tenant.Pool
+
 func init() {
 	if cast.ToBoolOrDefault(config.GddDBDisableAutoConfigure.Load(), config.DefaultGddDBDisableAutoConfigure) {
 		return
@@ -81,6 +97,47 @@ func init() {
 	if stringutils.IsEmpty(driver) {
 		errorx.Panic("Database driver is missing")
 	}
+	strategy := strings.ToLower(config.GddDBTenantStrategy.Load())
+	if strategy == tenantDatabase {
+		TenantPool = tenant.NewPool(func(id string) (*gorm.DB, error) {
+			return open(driver, strings.ReplaceAll(dsn, tenantPlaceholder, id), gormConf)
+		})
+		lifecycle.Append(lifecycle.Closer("database", lifecycle.PriorityResource, TenantPool))
+		return
+	}
+	if Db, err = open(driver, dsn, gormConf); err != nil {
+		errorx.Panic(err.Error())
+	}
+	if sqlDB, err := Db.DB(); err == nil {
+		lifecycle.Append(lifecycle.Closer("database", lifecycle.PriorityResource, sqlDB))
+	}
+	switch strategy {
+	case tenantSharedTable:
+		err = Db.Use(tenant.NewSharedTablePlugin(config.GddDBTenantColumn.LoadOrDefault(config.DefaultGddDBTenantColumn)))
+	case tenantSchema:
+		err = Db.Use(tenant.NewSchemaPlugin(config.GddDBTenantSchemaPattern.LoadOrDefault(config.DefaultGddDBTenantSchemaPattern)))
+	}
+	if err != nil {
+		errorx.Panic(err.Error())
+	}
+}
+
+// DB returns Db bound to ctx, or the database of the tenant in ctx if GDD_DB_TENANT_STRATEGY is database
+func DB(ctx context.Context) (*gorm.DB, error) {
+	if TenantPool != nil {
+		return TenantPool.DB(ctx)
+	}
+	if Db == nil {
+		return nil, errors.New("database is not configured")
+	}
+	return Db.WithContext(ctx), nil
+}
+
+func open(driver, dsn string, gormConf *gorm.Config) (*gorm.DB, error) {
+	var (
+		db  *gorm.DB
+		err error
+	)
 	switch driver {
 	case driverMysql, driverTidb:
 		conf := mysql.Config{
@@ -95,29 +152,39 @@ func init() {
 			DontSupportNullAsDefaultValue: cast.ToBoolOrDefault(config.GddDBMysqlDontSupportNullAsDefaultValue.Load(), config.DefaultGddDBMysqlDontSupportNullAsDefaultValue),
 			DontSupportRenameColumnUnique: cast.ToBoolOrDefault(config.GddDBMysqlDontSupportRenameColumnUnique.Load(), config.DefaultGddDBMysqlDontSupportRenameColumnUnique),
 		}
-		Db, err = gorm.Open(mysql.New(conf), gormConf)
+		db, err = gorm.Open(mysql.New(conf), gormConf)
 	case driverPostgres:
 		conf := postgres.Config{
 			DSN:                  dsn,
 			PreferSimpleProtocol: cast.ToBoolOrDefault(config.GddDBPostgresPreferSimpleProtocol.Load(), config.DefaultGddDBPostgresPreferSimpleProtocol),
 			WithoutReturning:     cast.ToBoolOrDefault(config.GddDBPostgresWithoutReturning.Load(), config.DefaultGddDBPostgresWithoutReturning),
 		}
-		Db, err = gorm.Open(postgres.New(conf), gormConf)
+		db, err = gorm.Open(postgres.New(conf), gormConf)
 	case driverSqlite:
-		Db, err = gorm.Open(sqlite.Open(dsn), gormConf)
+		db, err = gorm.Open(sqlite.Open(dsn), gormConf)
 	case driverSqlserver:
-		Db, err = gorm.Open(sqlserver.Open(dsn), gormConf)
+		db, err = gorm.Open(sqlserver.Open(dsn), gormConf)
 	case driverClickhouse:
-		Db, err = gorm.Open(clickhouse.Open(dsn), gormConf)
+		db, err = gorm.Open(clickhouse.Open(dsn), gormConf)
 	default:
-		errorx.Panic("Not support driver")
+		return nil, errors.New("Not support driver")
 	}
 	if err != nil {
-		errorx.Panic(err.Error())
+		return nil, err
 	}
-	sqlDB, err := Db.DB()
+	if cast.ToBoolOrDefault(config.GddDBGovernanceEnable.Load(), config.DefaultGddDBGovernanceEnable) {
+		plugin := governance.NewPlugin(governance.Columns{
+			CreatedBy: config.GddDBGovernanceCreatedBy.LoadOrDefault(config.DefaultGddDBGovernanceCreatedBy),
+			UpdatedBy: config.GddDBGovernanceUpdatedBy.LoadOrDefault(config.DefaultGddDBGovernanceUpdatedBy),
+			Version:   config.GddDBGovernanceVersion.LoadOrDefault(config.DefaultGddDBGovernanceVersion),
+		})
+		if err = db.Use(plugin); err != nil {
+			return nil, err
+		}
+	}
+	sqlDB, err := db.DB()
 	if err != nil {
-		errorx.Panic(err.Error())
+		return nil, err
 	}
 	// SetMaxIdleConns sets the maximum number of connections in the idle connection pool.
 	sqlDB.SetMaxIdleConns(cast.ToIntOrDefault(config.GddDBMaxIdleConns.Load(), config.DefaultGddDBMaxIdleConns))
@@ -139,4 +206,5 @@ func init() {
 		maxIdleTime = config.DefaultGddDBConnMaxIdleTime
 	}
 	sqlDB.SetConnMaxIdleTime(maxIdleTime)
+	return db, nil
 }
@@ -0,0 +1,90 @@
+package grpcweb
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// connectCodes maps grpc codes to Connect error codes and http status codes of unary responses
+var connectCodes = map[codes.Code]struct {
+	name       string
+	httpStatus int
+}{
+	codes.Canceled:           {"canceled", 499},
+	codes.Unknown:            {"unknown", http.StatusInternalServerError},
+	codes.InvalidArgument:    {"invalid_argument", http.StatusBadRequest},
+	codes.DeadlineExceeded:   {"deadline_exceeded", http.StatusGatewayTimeout},
+	codes.NotFound:           {"not_found", http.StatusNotFound},
+	codes.AlreadyExists:      {"already_exists", http.StatusConflict},
+	codes.PermissionDenied:   {"permission_denied", http.StatusForbidden},
+	codes.ResourceExhausted:  {"resource_exhausted", http.StatusTooManyRequests},
+	codes.FailedPrecondition: {"failed_precondition", http.StatusBadRequest},
+	codes.Aborted:            {"aborted", http.StatusConflict},
+	codes.OutOfRange:         {"out_of_range", http.StatusBadRequest},
+	codes.Unimplemented:      {"unimplemented", http.StatusNotImplemented},
+	codes.Internal:           {"internal", http.StatusInternalServerError},
+	codes.Unavailable:        {"unavailable", http.StatusServiceUnavailable},
+	codes.DataLoss:           {"data_loss", http.StatusInternalServerError},
+	codes.Unauthenticated:    {"unauthenticated", http.StatusUnauthorized},
+}
+
+type connectDetail struct {
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+type connectError struct {
+	Code    string          `json:"code"`
+	Message string          `json:"message,omitempty"`
+	Details []connectDetail `json:"details,omitempty"`
+}
+
+func connectErrorOf(st *status.Status) *connectError {
+	code, ok := connectCodes[st.Code()]
+	if !ok {
+		code = connectCodes[codes.Unknown]
+	}
+	e := &connectError{
+		Code:    code.name,
+		Message: st.Message(),
+	}
+	for _, detail := range st.Proto().GetDetails() {
+		e.Details = append(e.Details, connectDetail{
+			Type:  detail.GetTypeUrl()[strings.LastIndex(detail.GetTypeUrl(), "/")+1:],
+			Value: base64.RawStdEncoding.EncodeToString(detail.GetValue()),
+		})
+	}
+	return e
+}
+
+// writeConnectError writes error response of Connect unary rpc
+func writeConnectError(w http.ResponseWriter, st *status.Status) {
+	code, ok := connectCodes[st.Code()]
+	if !ok {
+		code = connectCodes[codes.Unknown]
+	}
+	data, _ := json.Marshal(connectErrorOf(st))
+	w.Header().Set("Content-Type", contentTypeJson)
+	w.WriteHeader(code.httpStatus)
+	w.Write(data)
+}
+
+// endStreamOf returns end-stream message of Connect streaming rpc, carrying error if any and trailers
+func endStreamOf(st *status.Status, trailer http.Header) []byte {
+	end := struct {
+		Error    *connectError `json:"error,omitempty"`
+		Metadata http.Header   `json:"metadata,omitempty"`
+	}{
+		Metadata: trailer,
+	}
+	if st.Code() != codes.OK {
+		end.Error = connectErrorOf(st)
+	}
+	data, _ := json.Marshal(end)
+	return data
+}
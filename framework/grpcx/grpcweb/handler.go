@@ -0,0 +1,459 @@
+// Package grpcweb serves grpc services to browser clients over gRPC-Web and Connect protocols. Requests are
+// translated to grpc requests and served by grpc.Server.ServeHTTP, so that registered services and interceptors
+// are shared with native grpc clients.
+package grpcweb
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/rs/cors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+const (
+	contentTypeGrpcWeb       = "application/grpc-web"
+	contentTypeGrpcWebText   = "application/grpc-web-text"
+	contentTypeConnectPrefix = "application/connect+"
+	contentTypeJson          = "application/json"
+	contentTypeProto         = "application/proto"
+	// defaultMaxRecvMsgSize is the default of grpc.MaxRecvMsgSize
+	defaultMaxRecvMsgSize = 1024 * 1024 * 4
+)
+
+// Handler serves gRPC-Web requests of any rpc type, and Connect requests of unary and server streaming rpcs.
+// Client streaming is supported by both protocols only as far as the whole request body is sent at once.
+type Handler struct {
+	server         *grpc.Server
+	files          *protoregistry.Files
+	marshal        protojson.MarshalOptions
+	unmarshal      protojson.UnmarshalOptions
+	allowedOrigins []string
+	exposedHeaders []string
+	cors           *cors.Cors
+	maxRecvMsgSize int
+	methodsOnce    sync.Once
+	methods        map[string]grpc.MethodInfo
+}
+
+type Option func(*Handler)
+
+// WithAllowedOrigins sets origins allowed by CORS, no cross-origin requests are allowed by default
+func WithAllowedOrigins(origins ...string) Option {
+	return func(h *Handler) {
+		h.allowedOrigins = origins
+	}
+}
+
+// WithExposedHeaders sets custom response headers readable by browser clients in addition to grpc status headers
+func WithExposedHeaders(headers ...string) Option {
+	return func(h *Handler) {
+		h.exposedHeaders = append(h.exposedHeaders, headers...)
+	}
+}
+
+// WithMaxRecvMsgSize sets max size of request body, which should be the same as grpc.MaxRecvMsgSize of the server,
+// 4MB by default
+func WithMaxRecvMsgSize(size int) Option {
+	return func(h *Handler) {
+		h.maxRecvMsgSize = size
+	}
+}
+
+// WithFiles sets registry in which method descriptors are looked up for json encoded Connect requests,
+// protoregistry.GlobalFiles by default
+func WithFiles(files *protoregistry.Files) Option {
+	return func(h *Handler) {
+		h.files = files
+	}
+}
+
+func WithMarshalOptions(options protojson.MarshalOptions) Option {
+	return func(h *Handler) {
+		h.marshal = options
+	}
+}
+
+func WithUnmarshalOptions(options protojson.UnmarshalOptions) Option {
+	return func(h *Handler) {
+		h.unmarshal = options
+	}
+}
+
+// NewHandler creates a Handler serving services registered to server
+func NewHandler(server *grpc.Server, opts ...Option) *Handler {
+	h := &Handler{
+		server:         server,
+		files:          protoregistry.GlobalFiles,
+		unmarshal:      protojson.UnmarshalOptions{DiscardUnknown: true},
+		exposedHeaders: []string{headerGrpcStatus, headerGrpcMessage, headerGrpcDetails},
+		maxRecvMsgSize: defaultMaxRecvMsgSize,
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	corsOptions := cors.Options{
+		AllowedOrigins: h.allowedOrigins,
+		AllowedMethods: []string{http.MethodPost},
+		AllowedHeaders: []string{"*"},
+		ExposedHeaders: h.exposedHeaders,
+		MaxAge:         7200,
+	}
+	if len(h.allowedOrigins) == 0 {
+		// cors allows all origins if none is set
+		corsOptions.AllowOriginFunc = func(string) bool {
+			return false
+		}
+	}
+	h.cors = cors.New(corsOptions)
+	return h
+}
+
+func mediaTypeOf(r *http.Request) string {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return ""
+	}
+	return mediaType
+}
+
+// method returns rpc info of path such as /grpc.health.v1.Health/Check. Services are collected at the first call,
+// by then all of them should have been registered.
+func (h *Handler) method(path string) (grpc.MethodInfo, bool) {
+	h.methodsOnce.Do(func() {
+		h.methods = make(map[string]grpc.MethodInfo)
+		for name, info := range h.server.GetServiceInfo() {
+			for _, m := range info.Methods {
+				h.methods["/"+name+"/"+m.Name] = m
+			}
+		}
+	})
+	info, ok := h.methods[path]
+	return info, ok
+}
+
+// Match reports whether r is a gRPC-Web or Connect request, or a CORS preflight request of them
+func (h *Handler) Match(r *http.Request) bool {
+	mediaType := mediaTypeOf(r)
+	if strings.HasPrefix(mediaType, contentTypeGrpcWeb) || strings.HasPrefix(mediaType, contentTypeConnectPrefix) {
+		return true
+	}
+	info, ok := h.method(r.URL.Path)
+	if !ok {
+		return false
+	}
+	switch r.Method {
+	case http.MethodOptions:
+		return r.Header.Get("Access-Control-Request-Method") != ""
+	case http.MethodPost:
+		return !info.IsClientStream && !info.IsServerStream && (mediaType == contentTypeJson || mediaType == contentTypeProto)
+	}
+	return false
+}
+
+// ServeHTTP answers CORS preflight requests and serves the others by protocol
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.cors.ServeHTTP(w, r, func(w http.ResponseWriter, r *http.Request) {
+		mediaType := mediaTypeOf(r)
+		switch {
+		case strings.HasPrefix(mediaType, contentTypeGrpcWeb):
+			h.serveGrpcWeb(w, r, mediaType)
+		case strings.HasPrefix(mediaType, contentTypeConnectPrefix):
+			h.serveConnectStream(w, r, mediaType)
+		default:
+			h.serveConnectUnary(w, r, mediaType)
+		}
+	})
+}
+
+// forward serves body of r as a grpc request, response is written to rec
+func (h *Handler) forward(rec *recorder, r *http.Request, body []byte) {
+	req := r.Clone(r.Context())
+	req.Method = http.MethodPost
+	req.Proto, req.ProtoMajor, req.ProtoMinor = "HTTP/2", 2, 0
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	req.ContentLength = int64(len(body))
+	req.Header.Del("Content-Length")
+	req.Header.Set("Content-Type", "application/grpc+proto")
+	if timeout := req.Header.Get("Connect-Timeout-Ms"); timeout != "" {
+		req.Header.Set("Grpc-Timeout", timeout+"m")
+	}
+	for k := range req.Header {
+		if strings.HasPrefix(k, "Connect-") || strings.HasPrefix(k, "X-Grpc-Web") {
+			req.Header.Del(k)
+		}
+	}
+	h.server.ServeHTTP(rec, req)
+}
+
+// readBody reads request body up to limit bytes, larger requests are rejected as grpc server does
+func readBody(w http.ResponseWriter, r *http.Request, limit int64) ([]byte, error) {
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, limit))
+	if err != nil {
+		if int64(len(body)) >= limit {
+			return nil, status.Errorf(codes.ResourceExhausted, "request body is larger than %d bytes", limit)
+		}
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	return body, nil
+}
+
+func flush(w http.ResponseWriter) {
+	if f, ok := w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func copyHeader(dst, src http.Header) {
+	for k, v := range src {
+		dst[k] = append(dst[k], v...)
+	}
+}
+
+// decodeBase64 decodes grpc-web-text body, which may be concatenated from separately padded chunks
+func decodeBase64(data []byte) ([]byte, error) {
+	data = bytes.Join(bytes.Fields(data), nil)
+	if len(data)%4 != 0 {
+		return nil, errors.New("malformed base64 encoded body")
+	}
+	decoded := make([]byte, 0, len(data)/4*3)
+	quad := make([]byte, 3)
+	for i := 0; i < len(data); i += 4 {
+		n, err := base64.StdEncoding.Decode(quad, data[i:i+4])
+		if err != nil {
+			return nil, errors.Wrap(err, "malformed base64 encoded body")
+		}
+		decoded = append(decoded, quad[:n]...)
+	}
+	return decoded, nil
+}
+
+func (h *Handler) serveGrpcWeb(w http.ResponseWriter, r *http.Request, mediaType string) {
+	text := strings.HasPrefix(mediaType, contentTypeGrpcWebText)
+	write := func(data []byte) {
+		if text {
+			data = []byte(base64.StdEncoding.EncodeToString(data))
+		}
+		w.Write(data)
+	}
+	rec := newRecorder(func(header http.Header) {
+		copyHeader(w.Header(), header)
+		w.Header().Set("Content-Type", mediaType)
+		w.WriteHeader(http.StatusOK)
+	}, func(flags byte, data []byte) {
+		write(envelope(flags, data))
+		flush(w)
+	})
+	// a message is enveloped with 5 bytes prefix, and grows by 4/3 if base64 encoded
+	limit := int64(h.maxRecvMsgSize) + 5
+	if text {
+		limit = (limit + 2) / 3 * 4
+	}
+	body, err := readBody(w, r, limit)
+	if err != nil {
+		code := http.StatusBadRequest
+		if status.Code(err) == codes.ResourceExhausted {
+			code = http.StatusRequestEntityTooLarge
+		}
+		http.Error(w, status.Convert(err).Message(), code)
+		return
+	}
+	if text {
+		if body, err = decodeBase64(body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	h.forward(rec, r, body)
+	rec.sendHeader()
+	var trailer bytes.Buffer
+	for k, v := range rec.header {
+		if k == headerGrpcStatus || k == headerGrpcMessage || k == headerGrpcDetails || strings.HasPrefix(k, http.TrailerPrefix) {
+			for _, item := range v {
+				trailer.WriteString(strings.ToLower(strings.TrimPrefix(k, http.TrailerPrefix)) + ": " + item + "\r\n")
+			}
+		}
+	}
+	if rec.header.Get(headerGrpcStatus) == "" {
+		st, _ := rec.status()
+		trailer.WriteString("grpc-status: " + strconv.Itoa(int(st.Code())) + "\r\ngrpc-message: " + url.PathEscape(st.Message()) + "\r\n")
+	}
+	// the most significant bit of flags marks trailers
+	write(envelope(0x80, trailer.Bytes()))
+	flush(w)
+}
+
+// converter transcodes messages of an rpc between protobuf binary and json
+type converter struct {
+	h      *Handler
+	method protoreflect.MethodDescriptor
+	json   bool
+}
+
+func (h *Handler) converter(path string, json bool) (*converter, error) {
+	c := &converter{h: h, json: json}
+	if !json {
+		return c, nil
+	}
+	name := strings.Replace(strings.TrimPrefix(path, "/"), "/", ".", 1)
+	d, err := h.files.FindDescriptorByName(protoreflect.FullName(name))
+	if err != nil {
+		return nil, status.Errorf(codes.Unimplemented, "rpc %s is not found", name)
+	}
+	method, ok := d.(protoreflect.MethodDescriptor)
+	if !ok {
+		return nil, status.Errorf(codes.Unimplemented, "%s is not an rpc", name)
+	}
+	c.method = method
+	return c, nil
+}
+
+func (c *converter) request(data []byte) ([]byte, error) {
+	if !c.json {
+		return data, nil
+	}
+	msg := dynamicpb.NewMessage(c.method.Input())
+	if err := c.h.unmarshal.Unmarshal(data, msg); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	return proto.Marshal(msg)
+}
+
+func (c *converter) response(data []byte) ([]byte, error) {
+	if !c.json {
+		return data, nil
+	}
+	msg := dynamicpb.NewMessage(c.method.Output())
+	if err := proto.Unmarshal(data, msg); err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return c.h.marshal.Marshal(msg)
+}
+
+func (h *Handler) serveConnectUnary(w http.ResponseWriter, r *http.Request, mediaType string) {
+	body, err := readBody(w, r, int64(h.maxRecvMsgSize))
+	if err != nil {
+		writeConnectError(w, status.Convert(err))
+		return
+	}
+	c, err := h.converter(r.URL.Path, mediaType == contentTypeJson)
+	if err == nil {
+		body, err = c.request(body)
+	}
+	if err != nil {
+		writeConnectError(w, status.Convert(err))
+		return
+	}
+	var (
+		header  http.Header
+		message []byte
+	)
+	rec := newRecorder(func(h http.Header) {
+		header = h
+	}, func(flags byte, data []byte) {
+		message = data
+	})
+	h.forward(rec, r, envelope(0, body))
+	st, trailer := rec.status()
+	copyHeader(w.Header(), header)
+	if st.Code() != codes.OK {
+		copyHeader(w.Header(), trailer)
+		writeConnectError(w, st)
+		return
+	}
+	if message, err = c.response(message); err != nil {
+		writeConnectError(w, status.Convert(err))
+		return
+	}
+	for k, v := range trailer {
+		w.Header()["Trailer-"+k] = v
+	}
+	w.Header().Set("Content-Type", mediaType)
+	w.WriteHeader(http.StatusOK)
+	w.Write(message)
+}
+
+func (h *Handler) serveConnectStream(w http.ResponseWriter, r *http.Request, mediaType string) {
+	sent := false
+	sendHeader := func(header http.Header) {
+		sent = true
+		copyHeader(w.Header(), header)
+		w.Header().Set("Content-Type", mediaType)
+		w.WriteHeader(http.StatusOK)
+	}
+	endStream := func(st *status.Status, trailer http.Header) {
+		if !sent {
+			sendHeader(nil)
+		}
+		w.Write(envelope(0x02, endStreamOf(st, trailer)))
+		flush(w)
+	}
+	c, err := h.converter(r.URL.Path, mediaType == contentTypeConnectPrefix+"json")
+	var body []byte
+	if err == nil {
+		body, err = readBody(w, r, int64(h.maxRecvMsgSize)+5)
+	}
+	if err == nil {
+		body, err = c.requests(body)
+	}
+	if err != nil {
+		endStream(status.Convert(err), nil)
+		return
+	}
+	var convertErr error
+	rec := newRecorder(sendHeader, func(flags byte, data []byte) {
+		if convertErr != nil {
+			return
+		}
+		if data, convertErr = c.response(data); convertErr == nil {
+			w.Write(envelope(0, data))
+			flush(w)
+		}
+	})
+	h.forward(rec, r, body)
+	st, trailer := rec.status()
+	if convertErr != nil {
+		st = status.Convert(convertErr)
+	}
+	endStream(st, trailer)
+}
+
+// requests converts enveloped request messages of Connect streaming body to grpc ones
+func (c *converter) requests(data []byte) ([]byte, error) {
+	var converted []byte
+	for len(data) > 0 {
+		if len(data) < 5 {
+			return nil, status.Error(codes.InvalidArgument, "incomplete envelope")
+		}
+		size := int(binary.BigEndian.Uint32(data[1:5]))
+		if len(data) < 5+size {
+			return nil, status.Error(codes.InvalidArgument, "incomplete envelope")
+		}
+		if data[0]&0x01 != 0 {
+			return nil, status.Error(codes.Unimplemented, "compressed messages are not supported")
+		}
+		msg, err := c.request(data[5 : 5+size])
+		if err != nil {
+			return nil, err
+		}
+		converted = append(converted, envelope(0, msg)...)
+		data = data[5+size:]
+	}
+	return converted, nil
+}
@@ -0,0 +1,215 @@
+package grpcweb
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/protobuf/proto"
+)
+
+func setup(t *testing.T) (*Handler, *httptest.Server) {
+	server := grpc.NewServer()
+	grpc_health_v1.RegisterHealthServer(server, health.NewServer())
+	h := NewHandler(server, WithAllowedOrigins("http://localhost:3000"))
+	ts := httptest.NewServer(h)
+	t.Cleanup(ts.Close)
+	return h, ts
+}
+
+func frames(t *testing.T, data []byte) [][]byte {
+	var ret [][]byte
+	for len(data) > 0 {
+		require.GreaterOrEqual(t, len(data), 5)
+		size := int(binary.BigEndian.Uint32(data[1:5]))
+		ret = append(ret, data[:5+size])
+		data = data[5+size:]
+	}
+	return ret
+}
+
+func TestMatch(t *testing.T) {
+	h, _ := setup(t)
+	newRequest := func(method, path, contentType string) *http.Request {
+		r := httptest.NewRequest(method, path, nil)
+		if contentType != "" {
+			r.Header.Set("Content-Type", contentType)
+		}
+		return r
+	}
+	require.True(t, h.Match(newRequest(http.MethodPost, "/grpc.health.v1.Health/Check", "application/grpc-web+proto")))
+	require.True(t, h.Match(newRequest(http.MethodPost, "/grpc.health.v1.Health/Watch", "application/connect+json")))
+	require.True(t, h.Match(newRequest(http.MethodPost, "/grpc.health.v1.Health/Check", "application/json; charset=utf-8")))
+	require.False(t, h.Match(newRequest(http.MethodPost, "/grpc.health.v1.Health/Watch", "application/json")))
+	require.False(t, h.Match(newRequest(http.MethodPost, "/user", "application/json")))
+	require.False(t, h.Match(newRequest(http.MethodGet, "/grpc.health.v1.Health/Check", "")))
+	preflight := newRequest(http.MethodOptions, "/grpc.health.v1.Health/Check", "")
+	preflight.Header.Set("Access-Control-Request-Method", http.MethodPost)
+	require.True(t, h.Match(preflight))
+}
+
+func TestGrpcWeb(t *testing.T) {
+	_, ts := setup(t)
+	data, _ := proto.Marshal(&grpc_health_v1.HealthCheckRequest{})
+	resp, err := http.Post(ts.URL+"/grpc.health.v1.Health/Check", "application/grpc-web+proto", bytes.NewReader(envelope(0, data)))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, "application/grpc-web+proto", resp.Header.Get("Content-Type"))
+	body, _ := ioutil.ReadAll(resp.Body)
+	fs := frames(t, body)
+	require.Len(t, fs, 2)
+	var reply grpc_health_v1.HealthCheckResponse
+	require.NoError(t, proto.Unmarshal(fs[0][5:], &reply))
+	require.Equal(t, grpc_health_v1.HealthCheckResponse_SERVING, reply.Status)
+	require.Equal(t, byte(0x80), fs[1][0])
+	require.Contains(t, string(fs[1][5:]), "grpc-status: 0\r\n")
+}
+
+func TestGrpcWebText(t *testing.T) {
+	_, ts := setup(t)
+	data, _ := proto.Marshal(&grpc_health_v1.HealthCheckRequest{Service: "unknown"})
+	payload := base64.StdEncoding.EncodeToString(envelope(0, data))
+	resp, err := http.Post(ts.URL+"/grpc.health.v1.Health/Check", "application/grpc-web-text", strings.NewReader(payload))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	body, _ := ioutil.ReadAll(resp.Body)
+	decoded, err := decodeBase64(body)
+	require.NoError(t, err)
+	fs := frames(t, decoded)
+	require.Len(t, fs, 1)
+	require.Equal(t, byte(0x80), fs[0][0])
+	require.Contains(t, string(fs[0][5:]), "grpc-status: 5\r\n")
+	require.Contains(t, string(fs[0][5:]), "grpc-message: unknown service\r\n")
+}
+
+func TestConnectUnary(t *testing.T) {
+	_, ts := setup(t)
+	resp, err := http.Post(ts.URL+"/grpc.health.v1.Health/Check", "application/json", strings.NewReader(`{}`))
+	require.NoError(t, err)
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+	require.JSONEq(t, `{"status":"SERVING"}`, string(body))
+
+	data, _ := proto.Marshal(&grpc_health_v1.HealthCheckRequest{})
+	resp, err = http.Post(ts.URL+"/grpc.health.v1.Health/Check", "application/proto", bytes.NewReader(data))
+	require.NoError(t, err)
+	body, _ = ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var reply grpc_health_v1.HealthCheckResponse
+	require.NoError(t, proto.Unmarshal(body, &reply))
+	require.Equal(t, grpc_health_v1.HealthCheckResponse_SERVING, reply.Status)
+}
+
+func TestConnectUnaryError(t *testing.T) {
+	_, ts := setup(t)
+	resp, err := http.Post(ts.URL+"/grpc.health.v1.Health/Check", "application/json", strings.NewReader(`{"service":"unknown"}`))
+	require.NoError(t, err)
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+	require.JSONEq(t, `{"code":"not_found","message":"unknown service"}`, string(body))
+
+	resp, err = http.Post(ts.URL+"/grpc.health.v1.Health/Check", "application/json", strings.NewReader(`{"service":1}`))
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
+func TestConnectServerStream(t *testing.T) {
+	_, ts := setup(t)
+	req, _ := http.NewRequest(http.MethodPost, ts.URL+"/grpc.health.v1.Health/Watch", bytes.NewReader(envelope(0, []byte(`{}`))))
+	req.Header.Set("Content-Type", "application/connect+json")
+	// Watch never ends by itself
+	req.Header.Set("Connect-Timeout-Ms", "200")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, "application/connect+json", resp.Header.Get("Content-Type"))
+	body, _ := ioutil.ReadAll(resp.Body)
+	fs := frames(t, body)
+	require.Len(t, fs, 2)
+	require.Equal(t, byte(0), fs[0][0])
+	require.JSONEq(t, `{"status":"SERVING"}`, string(fs[0][5:]))
+	require.Equal(t, byte(0x02), fs[1][0])
+	var end struct {
+		Error struct {
+			Code string `json:"code"`
+		} `json:"error"`
+	}
+	require.NoError(t, json.Unmarshal(fs[1][5:], &end))
+	// health server ends Watch with Canceled once the stream context is done
+	require.Equal(t, "canceled", end.Error.Code)
+}
+
+func TestPreflight(t *testing.T) {
+	_, ts := setup(t)
+	req, _ := http.NewRequest(http.MethodOptions, ts.URL+"/grpc.health.v1.Health/Check", nil)
+	req.Header.Set("Origin", "http://localhost:3000")
+	req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+	req.Header.Set("Access-Control-Request-Headers", "content-type,x-grpc-web")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, "http://localhost:3000", resp.Header.Get("Access-Control-Allow-Origin"))
+
+	req.Header.Set("Origin", "http://evil.com")
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Empty(t, resp.Header.Get("Access-Control-Allow-Origin"))
+}
+
+func TestPreflightWithoutAllowedOrigins(t *testing.T) {
+	server := grpc.NewServer()
+	grpc_health_v1.RegisterHealthServer(server, health.NewServer())
+	ts := httptest.NewServer(NewHandler(server))
+	defer ts.Close()
+	req, _ := http.NewRequest(http.MethodOptions, ts.URL+"/grpc.health.v1.Health/Check", nil)
+	req.Header.Set("Origin", "http://localhost:3000")
+	req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Empty(t, resp.Header.Get("Access-Control-Allow-Origin"))
+}
+
+func TestMaxRecvMsgSize(t *testing.T) {
+	server := grpc.NewServer()
+	grpc_health_v1.RegisterHealthServer(server, health.NewServer())
+	ts := httptest.NewServer(NewHandler(server, WithMaxRecvMsgSize(16)))
+	defer ts.Close()
+
+	resp, err := http.Post(ts.URL+"/grpc.health.v1.Health/Check", "application/json", strings.NewReader(`{"service":"`+strings.Repeat("a", 16)+`"}`))
+	require.NoError(t, err)
+	body, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	require.Contains(t, string(body), "resource_exhausted")
+
+	data, _ := proto.Marshal(&grpc_health_v1.HealthCheckRequest{Service: strings.Repeat("a", 16)})
+	resp, err = http.Post(ts.URL+"/grpc.health.v1.Health/Check", "application/grpc-web+proto", bytes.NewReader(envelope(0, data)))
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+
+	// requests within limit are served
+	data, _ = proto.Marshal(&grpc_health_v1.HealthCheckRequest{})
+	resp, err = http.Post(ts.URL+"/grpc.health.v1.Health/Check", "application/grpc-web-text", strings.NewReader(base64.StdEncoding.EncodeToString(envelope(0, data))))
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+}
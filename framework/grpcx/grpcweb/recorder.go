@@ -0,0 +1,135 @@
+package grpcweb
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	spb "google.golang.org/genproto/googleapis/rpc/status"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	headerGrpcStatus  = "Grpc-Status"
+	headerGrpcMessage = "Grpc-Message"
+	headerGrpcDetails = "Grpc-Status-Details-Bin"
+)
+
+// recorder is the http.ResponseWriter passed to grpc.Server.ServeHTTP. It splits response body into
+// length-prefixed messages, and tells headers from trailers which grpc sets after the first flush.
+type recorder struct {
+	header    http.Header
+	sent      bool
+	code      int
+	buf       []byte
+	onHeader  func(header http.Header)
+	onMessage func(flags byte, data []byte)
+}
+
+func newRecorder(onHeader func(header http.Header), onMessage func(flags byte, data []byte)) *recorder {
+	return &recorder{
+		header:    make(http.Header),
+		onHeader:  onHeader,
+		onMessage: onMessage,
+	}
+}
+
+func (rec *recorder) Header() http.Header {
+	return rec.header
+}
+
+func (rec *recorder) sendHeader() {
+	if rec.sent {
+		return
+	}
+	rec.sent = true
+	header := make(http.Header)
+	for k, v := range rec.header {
+		switch k {
+		case "Content-Type", "Content-Length", "Trailer", "Date", "Grpc-Encoding":
+			continue
+		}
+		header[k] = v
+	}
+	rec.onHeader(header)
+}
+
+func (rec *recorder) WriteHeader(code int) {
+	if rec.code == 0 {
+		rec.code = code
+	}
+	rec.sendHeader()
+}
+
+func (rec *recorder) Write(p []byte) (int, error) {
+	if rec.code == 0 {
+		rec.code = http.StatusOK
+	}
+	rec.sendHeader()
+	rec.buf = append(rec.buf, p...)
+	if rec.code != http.StatusOK {
+		// grpc server rejected the request by http.Error, body is plain text
+		return len(p), nil
+	}
+	for len(rec.buf) >= 5 {
+		size := int(binary.BigEndian.Uint32(rec.buf[1:5]))
+		if len(rec.buf) < 5+size {
+			break
+		}
+		rec.onMessage(rec.buf[0], rec.buf[5:5+size])
+		rec.buf = rec.buf[5+size:]
+	}
+	return len(p), nil
+}
+
+func (rec *recorder) Flush() {
+	rec.sendHeader()
+}
+
+// status returns status and custom trailers of the finished call
+func (rec *recorder) status() (*status.Status, http.Header) {
+	if rec.code != 0 && rec.code != http.StatusOK {
+		return status.New(codes.Internal, strings.TrimSpace(string(rec.buf))), make(http.Header)
+	}
+	trailer := make(http.Header)
+	for k, v := range rec.header {
+		if strings.HasPrefix(k, http.TrailerPrefix) {
+			trailer[http.CanonicalHeaderKey(strings.TrimPrefix(k, http.TrailerPrefix))] = v
+		}
+	}
+	code, err := strconv.Atoi(rec.header.Get(headerGrpcStatus))
+	if err != nil {
+		return status.New(codes.Internal, "missing grpc status"), trailer
+	}
+	if code == int(codes.OK) && len(rec.buf) > 0 {
+		return status.New(codes.Internal, "incomplete response message"), trailer
+	}
+	msg := rec.header.Get(headerGrpcMessage)
+	if decoded, err := url.PathUnescape(msg); err == nil {
+		msg = decoded
+	}
+	if details := rec.header.Get(headerGrpcDetails); details != "" {
+		data, err := base64.RawStdEncoding.DecodeString(strings.TrimRight(details, "="))
+		if err == nil {
+			var s spb.Status
+			if err = proto.Unmarshal(data, &s); err == nil {
+				return status.FromProto(&s), trailer
+			}
+		}
+	}
+	return status.New(codes.Code(code), msg), trailer
+}
+
+// envelope prefixes data with flags and length as both gRPC-Web and Connect streaming do
+func envelope(flags byte, data []byte) []byte {
+	frame := make([]byte, 5+len(data))
+	frame[0] = flags
+	binary.BigEndian.PutUint32(frame[1:5], uint32(len(data)))
+	copy(frame[5:], data)
+	return frame
+}
@@ -0,0 +1,103 @@
+package grpcx_auth
+
+import (
+	"context"
+	"strings"
+
+	"github.com/unionj-cloud/go-doudou/v2/framework"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	RoleAnnotation       = "@role"
+	PermissionAnnotation = "@permission"
+)
+
+// Grants returns roles or permissions held by caller of ctx, such as claims of a verified token
+type Grants func(ctx context.Context) ([]string, error)
+
+// AnnotationAuthorizer authorizes rpc calls by @role and @permission annotations of svc interface methods
+// stored in generated MethodAnnotationStore. Callers need any of annotated roles and all of annotated permissions.
+// Methods without annotations are allowed.
+type AnnotationAuthorizer struct {
+	store       framework.AnnotationStore
+	roles       Grants
+	permissions Grants
+}
+
+type AnnotationAuthorizerOption func(*AnnotationAuthorizer)
+
+// WithRoles sets how roles of caller are resolved
+func WithRoles(roles Grants) AnnotationAuthorizerOption {
+	return func(a *AnnotationAuthorizer) {
+		a.roles = roles
+	}
+}
+
+// WithPermissions sets how permissions of caller are resolved
+func WithPermissions(permissions Grants) AnnotationAuthorizerOption {
+	return func(a *AnnotationAuthorizer) {
+		a.permissions = permissions
+	}
+}
+
+func NewAnnotationAuthorizer(store framework.AnnotationStore, opts ...AnnotationAuthorizerOption) *AnnotationAuthorizer {
+	a := &AnnotationAuthorizer{
+		store: store,
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
+}
+
+func grantsOf(ctx context.Context, grants Grants, annotation string) (map[string]struct{}, error) {
+	if grants == nil {
+		return nil, status.Errorf(codes.PermissionDenied, "no way to resolve %s of caller", strings.TrimPrefix(annotation, "@"))
+	}
+	values, err := grants(ctx)
+	if err != nil {
+		if _, ok := status.FromError(err); ok {
+			return nil, err
+		}
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+	granted := make(map[string]struct{}, len(values))
+	for _, v := range values {
+		granted[v] = struct{}{}
+	}
+	return granted, nil
+}
+
+// Authorize implements Authorizer
+func (a *AnnotationAuthorizer) Authorize(ctx context.Context, fullMethod string) (context.Context, error) {
+	method := fullMethod[strings.LastIndex(fullMethod, "/")+1:]
+	if a.store.HasAnnotation(method, RoleAnnotation) {
+		granted, err := grantsOf(ctx, a.roles, RoleAnnotation)
+		if err != nil {
+			return nil, err
+		}
+		var ok bool
+		for _, role := range a.store.GetParams(method, RoleAnnotation) {
+			if _, ok = granted[role]; ok {
+				break
+			}
+		}
+		if !ok {
+			return nil, status.Errorf(codes.PermissionDenied, "%s requires one of roles %v", method, a.store.GetParams(method, RoleAnnotation))
+		}
+	}
+	if a.store.HasAnnotation(method, PermissionAnnotation) {
+		granted, err := grantsOf(ctx, a.permissions, PermissionAnnotation)
+		if err != nil {
+			return nil, err
+		}
+		for _, permission := range a.store.GetParams(method, PermissionAnnotation) {
+			if _, ok := granted[permission]; !ok {
+				return nil, status.Errorf(codes.PermissionDenied, "%s requires permission %s", method, permission)
+			}
+		}
+	}
+	return ctx, nil
+}
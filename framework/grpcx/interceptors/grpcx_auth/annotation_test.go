@@ -0,0 +1,49 @@
+package grpcx_auth
+
+import (
+	"context"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"github.com/unionj-cloud/go-doudou/v2/framework"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type grantsKey struct{}
+
+func TestAnnotationAuthorizer(t *testing.T) {
+	store := framework.AnnotationStore{
+		"GetUserRpc": {{Name: RoleAnnotation, Params: []string{"admin", "user"}}},
+		"SignUpRpc": {
+			{Name: PermissionAnnotation, Params: []string{"create", "update"}},
+			{Name: RoleAnnotation, Params: []string{"admin"}},
+		},
+	}
+	grants := func(ctx context.Context) ([]string, error) {
+		values, ok := ctx.Value(grantsKey{}).([]string)
+		if !ok {
+			return nil, errors.New("no token")
+		}
+		return values, nil
+	}
+	authorizer := NewAnnotationAuthorizer(store, WithRoles(grants), WithPermissions(grants))
+	authorize := func(method string, values ...string) codes.Code {
+		ctx := context.Background()
+		if values != nil {
+			ctx = context.WithValue(ctx, grantsKey{}, values)
+		}
+		_, err := authorizer.Authorize(ctx, "/usersvc.UsersvcService/"+method)
+		return status.Code(err)
+	}
+	require.Equal(t, codes.OK, authorize("PageUsersRpc"))
+	require.Equal(t, codes.Unauthenticated, authorize("GetUserRpc"))
+	require.Equal(t, codes.OK, authorize("GetUserRpc", "user"))
+	require.Equal(t, codes.PermissionDenied, authorize("GetUserRpc", "guest"))
+	require.Equal(t, codes.PermissionDenied, authorize("SignUpRpc", "admin", "create"))
+	require.Equal(t, codes.OK, authorize("SignUpRpc", "admin", "create", "update"))
+
+	_, err := NewAnnotationAuthorizer(store).Authorize(context.Background(), "/usersvc.UsersvcService/GetUserRpc")
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+}
@@ -0,0 +1,107 @@
+package grpcx_errors
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+
+	"github.com/pkg/errors"
+	"github.com/unionj-cloud/go-doudou/v2/framework/rest"
+	logger "github.com/unionj-cloud/go-doudou/v2/toolkit/zlogger"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type grpcStatus interface {
+	GRPCStatus() *status.Status
+}
+
+// ToStatus converts err to grpc status error. rest.BizError wrapped anywhere in the chain of err is sent with
+// code mapped from its StatusCode and ErrCode carried by details, other errors are returned as is
+func ToStatus(err error) error {
+	if err == nil {
+		return nil
+	}
+	if st, ok := status.FromError(err); ok {
+		return st.Err()
+	}
+	var st grpcStatus
+	if errors.As(err, &st) {
+		return st.GRPCStatus().Err()
+	}
+	return err
+}
+
+// FromStatus converts grpc status error returned by server to rest.BizError, so that callers get ErrCode back
+// by errors.As. Errors without grpc status such as context errors are returned as is.
+func FromStatus(err error) error {
+	if err == nil {
+		return nil
+	}
+	st, ok := status.FromError(err)
+	if !ok {
+		return err
+	}
+	bizError := rest.BizErrorFromStatus(st)
+	bizError.Cause = err
+	return bizError
+}
+
+// recoverFrom converts panic value to grpc status error, as generated http handlers panic with rest.BizError
+// on bad request, service implementation shared by rest and grpc may panic likewise
+func recoverFrom(p interface{}, fullMethod string) error {
+	if e, ok := p.(error); ok {
+		var st grpcStatus
+		if errors.As(e, &st) {
+			return st.GRPCStatus().Err()
+		}
+	}
+	logger.Error().Msgf("panic recovered from %s: %v\n%s", fullMethod, p, debug.Stack())
+	return status.Error(codes.Internal, fmt.Sprint(p))
+}
+
+// UnaryServerInterceptor returns a server interceptor function converting rest.BizError returned or panicked by
+// unary RPC to grpc status error. It should be the innermost interceptor, so that other interceptors observe
+// the converted status.
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (_ interface{}, err error) {
+		defer func() {
+			if p := recover(); p != nil {
+				err = recoverFrom(p, info.FullMethod)
+			}
+		}()
+		resp, err := handler(ctx, req)
+		return resp, ToStatus(err)
+	}
+}
+
+// StreamServerInterceptor returns a server interceptor function converting rest.BizError returned or panicked by
+// stream RPC to grpc status error
+func StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(
+		srv interface{},
+		stream grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) (err error) {
+		defer func() {
+			if p := recover(); p != nil {
+				err = recoverFrom(p, info.FullMethod)
+			}
+		}()
+		return ToStatus(handler(srv, stream))
+	}
+}
+
+// UnaryClientInterceptor returns a client interceptor function converting grpc status error to rest.BizError
+func UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		return FromStatus(invoker(ctx, method, req, reply, cc, opts...))
+	}
+}
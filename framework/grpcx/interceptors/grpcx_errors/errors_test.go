@@ -0,0 +1,73 @@
+package grpcx_errors
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"github.com/unionj-cloud/go-doudou/v2/framework/rest"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	interceptor := UnaryServerInterceptor()
+	info := &grpc.UnaryServerInfo{FullMethod: "/usersvc.UsersvcService/GetUserRpc"}
+	call := func(handler grpc.UnaryHandler) *status.Status {
+		_, err := interceptor(context.Background(), nil, info, handler)
+		st, ok := status.FromError(err)
+		require.True(t, ok)
+		return st
+	}
+	notFound := rest.NewBizError(errors.New("user not found"), rest.WithStatusCode(http.StatusNotFound), rest.WithErrCode(10404))
+
+	st := call(func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, errors.Wrap(notFound, "query user")
+	})
+	require.Equal(t, codes.NotFound, st.Code())
+	require.Equal(t, 10404, rest.BizErrorFromStatus(st).ErrCode)
+
+	st = call(func(ctx context.Context, req interface{}) (interface{}, error) {
+		panic(rest.NewBizError(errors.New("bad id"), rest.WithStatusCode(http.StatusBadRequest), rest.WithDetails([]string{"id"})))
+	})
+	require.Equal(t, codes.InvalidArgument, st.Code())
+	require.Equal(t, "bad id", st.Message())
+
+	st = call(func(ctx context.Context, req interface{}) (interface{}, error) {
+		panic("boom")
+	})
+	require.Equal(t, codes.Internal, st.Code())
+
+	st = call(func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, status.Error(codes.Unavailable, "try later")
+	})
+	require.Equal(t, codes.Unavailable, st.Code())
+
+	_, err := interceptor(context.Background(), nil, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return "ok", nil
+	})
+	require.NoError(t, err)
+}
+
+func TestUnaryClientInterceptor(t *testing.T) {
+	interceptor := UnaryClientInterceptor()
+	notFound := rest.NewBizError(errors.New("user not found"), rest.WithStatusCode(http.StatusNotFound), rest.WithErrCode(10404))
+	err := interceptor(context.Background(), "/usersvc.UsersvcService/GetUserRpc", nil, nil, nil,
+		func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+			return notFound.GRPCStatus().Err()
+		})
+	var bizError rest.BizError
+	require.True(t, errors.As(err, &bizError))
+	require.Equal(t, 10404, bizError.ErrCode)
+	require.Equal(t, http.StatusNotFound, bizError.StatusCode)
+	require.Equal(t, codes.NotFound, status.Code(err))
+
+	err = interceptor(context.Background(), "/usersvc.UsersvcService/GetUserRpc", nil, nil, nil,
+		func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+			return context.Canceled
+		})
+	require.Equal(t, context.Canceled, err)
+}
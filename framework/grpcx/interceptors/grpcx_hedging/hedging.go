@@ -0,0 +1,42 @@
+package grpcx_hedging
+
+import (
+	"context"
+	"strings"
+
+	"github.com/unionj-cloud/go-doudou/v2/framework"
+	"github.com/unionj-cloud/go-doudou/v2/framework/hedging"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+)
+
+// UnaryClientInterceptor returns a client interceptor function hedging unary calls of methods annotated by
+// @hedge() in generated MethodAnnotationStore, hedging.Default() is used if hedger is nil. Hedged requests are sent
+// to another instance by balancers of registry.NewGrpcClientConn using routing load balancing policies.
+func UnaryClientInterceptor(store framework.AnnotationStore, hedger *hedging.Hedger) grpc.UnaryClientInterceptor {
+	if hedger == nil {
+		hedger = hedging.Default()
+	}
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		out, ok := reply.(proto.Message)
+		if !ok || !store.HasAnnotation(method[strings.LastIndex(method, "/")+1:], hedging.Annotation) {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+		// each attempt gets its own reply message, so that the loser doesn't write to reply of the winner
+		value, done, err := hedger.Do(ctx, method, func(ctx context.Context, attempt int) (interface{}, error) {
+			attemptReply := proto.Clone(out)
+			proto.Reset(attemptReply)
+			if err := invoker(ctx, method, req, attemptReply, cc, opts...); err != nil {
+				return nil, err
+			}
+			return attemptReply, nil
+		}, nil)
+		if err != nil {
+			return err
+		}
+		done()
+		proto.Reset(out)
+		proto.Merge(out, value.(proto.Message))
+		return nil
+	}
+}
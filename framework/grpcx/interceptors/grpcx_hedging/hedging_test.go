@@ -0,0 +1,50 @@
+package grpcx_hedging
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/unionj-cloud/go-doudou/v2/framework"
+	"github.com/unionj-cloud/go-doudou/v2/framework/hedging"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestUnaryClientInterceptor(t *testing.T) {
+	store := framework.AnnotationStore{
+		"GetUserRpc": {{Name: hedging.Annotation}},
+	}
+	interceptor := UnaryClientInterceptor(store, hedging.New(hedging.Config{
+		Quantile:      0.95,
+		Delay:         10 * time.Millisecond,
+		BudgetPercent: 10,
+	}))
+	var calls int32
+	// the first request hangs until it is cancelled
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			<-ctx.Done()
+			reply.(*wrapperspb.StringValue).Value = "cancelled"
+			return ctx.Err()
+		}
+		reply.(*wrapperspb.StringValue).Value = "jack"
+		return nil
+	}
+
+	reply := &wrapperspb.StringValue{}
+	err := interceptor(context.Background(), "/usersvc.UsersvcService/GetUserRpc", &wrapperspb.StringValue{}, reply, nil, invoker)
+	require.NoError(t, err)
+	require.Equal(t, "jack", reply.Value)
+	require.EqualValues(t, 2, atomic.LoadInt32(&calls))
+
+	// methods without annotation are not hedged
+	atomic.StoreInt32(&calls, 0)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err = interceptor(ctx, "/usersvc.UsersvcService/DeleteUserRpc", &wrapperspb.StringValue{}, &wrapperspb.StringValue{}, nil, invoker)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.EqualValues(t, 1, atomic.LoadInt32(&calls))
+}
@@ -0,0 +1,87 @@
+package grpcx_mesh
+
+import (
+	"context"
+	"net/http"
+
+	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
+	"github.com/unionj-cloud/go-doudou/v2/framework/registry/mesh"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+func capture(ctx context.Context) context.Context {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ctx
+	}
+	header := make(http.Header)
+	for _, key := range mesh.TracingHeaders {
+		if values := md.Get(key); len(values) > 0 {
+			header.Set(key, values[0])
+		}
+	}
+	return mesh.NewContext(ctx, header)
+}
+
+func propagate(ctx context.Context) context.Context {
+	header, ok := mesh.FromContext(ctx)
+	if !ok {
+		return ctx
+	}
+	md, _ := metadata.FromOutgoingContext(ctx)
+	var kv []string
+	for _, key := range mesh.TracingHeaders {
+		if value := header.Get(key); value != "" && len(md.Get(key)) == 0 {
+			kv = append(kv, key, value)
+		}
+	}
+	if len(kv) == 0 {
+		return ctx
+	}
+	return metadata.AppendToOutgoingContext(ctx, kv...)
+}
+
+// UnaryServerInterceptor returns a server interceptor function storing mesh.TracingHeaders read from metadata
+// into context
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		return handler(capture(ctx), req)
+	}
+}
+
+// StreamServerInterceptor returns a server interceptor function storing mesh.TracingHeaders read from metadata
+// into context
+func StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(
+		srv interface{},
+		stream grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		wrapped := grpc_middleware.WrapServerStream(stream)
+		wrapped.WrappedContext = capture(stream.Context())
+		return handler(srv, wrapped)
+	}
+}
+
+// UnaryClientInterceptor returns a client interceptor function propagating mesh.TracingHeaders in context to
+// downstream services, so that sidecars join their spans into the same trace
+func UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		return invoker(propagate(ctx), method, req, reply, cc, opts...)
+	}
+}
+
+// StreamClientInterceptor returns a client interceptor function propagating mesh.TracingHeaders in context to
+// downstream services, so that sidecars join their spans into the same trace
+func StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return streamer(propagate(ctx), desc, cc, method, opts...)
+	}
+}
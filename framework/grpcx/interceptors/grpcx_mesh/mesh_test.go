@@ -0,0 +1,30 @@
+package grpcx_mesh
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestPropagation(t *testing.T) {
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+		"x-request-id", "abc",
+		"b3", "80f198ee56343ba864fe8b2a57d3eff7-e457b5a2e4d86bd1-1",
+		"authorization", "Bearer token",
+	))
+	var outgoing metadata.MD
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		outgoing, _ = metadata.FromOutgoingContext(ctx)
+		return nil
+	}
+	_, err := UnaryServerInterceptor()(ctx, nil, &grpc.UnaryServerInfo{}, func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, UnaryClientInterceptor()(ctx, "/usersvc.UsersvcService/GetUserRpc", nil, nil, nil, invoker)
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"abc"}, outgoing.Get("x-request-id"))
+	require.Equal(t, []string{"80f198ee56343ba864fe8b2a57d3eff7-e457b5a2e4d86bd1-1"}, outgoing.Get("b3"))
+	require.Empty(t, outgoing.Get("authorization"))
+}
@@ -0,0 +1,86 @@
+package grpcx_retry
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	grpc_retry "github.com/grpc-ecosystem/go-grpc-middleware/retry"
+	"github.com/grpc-ecosystem/go-grpc-middleware/util/backoffutils"
+	"github.com/unionj-cloud/go-doudou/v2/framework"
+	"github.com/unionj-cloud/go-doudou/v2/framework/hedging"
+	"github.com/unionj-cloud/go-doudou/v2/framework/internal/config"
+	"github.com/unionj-cloud/go-doudou/v2/framework/registry/mesh"
+	"github.com/unionj-cloud/go-doudou/v2/toolkit/cast"
+	"google.golang.org/grpc"
+)
+
+// Annotation marks idempotent methods of svc interface whose failed calls are retried, e.g. // @idempotent().
+// Methods annotated by @hedge() are idempotent as well.
+const Annotation = "@idempotent"
+
+const (
+	backoffScalar = 50 * time.Millisecond
+	backoffJitter = 0.2
+	// maxBackoff caps waiting between attempts as resty does for rest clients
+	maxBackoff = 2 * time.Second
+)
+
+// backoff waits exponentially longer for each attempt with jitter, up to maxBackoff
+func backoff(attempt uint) time.Duration {
+	wait := maxBackoff
+	if attempt < 16 {
+		wait = backoffScalar * time.Duration(backoffutils.ExponentBase2(attempt))
+	}
+	if wait > maxBackoff {
+		wait = maxBackoff
+	}
+	return backoffutils.JitterUp(wait, backoffJitter)
+}
+
+func defaultOptions() []grpc_retry.CallOption {
+	retryCnt := config.DefaultGddRetryCount
+	if cnt, err := cast.ToIntE(config.GddRetryCount.Load()); err == nil && cnt >= 0 {
+		retryCnt = cnt
+	}
+	if mesh.InMesh() {
+		// sidecars retry failed requests
+		retryCnt = 0
+	}
+	return []grpc_retry.CallOption{
+		// max of grpc_retry counts the first attempt as well
+		grpc_retry.WithMax(uint(retryCnt + 1)),
+		grpc_retry.WithBackoff(backoff),
+	}
+}
+
+func idempotent(store framework.AnnotationStore, fullMethod string) bool {
+	method := fullMethod[strings.LastIndex(fullMethod, "/")+1:]
+	return store.HasAnnotation(method, Annotation) || store.HasAnnotation(method, hedging.Annotation)
+}
+
+// UnaryClientInterceptor returns a client interceptor function retrying unary RPC of idempotent methods annotated in
+// generated MethodAnnotationStore failed with Unavailable or ResourceExhausted, with exponential backoff up to 2s.
+// Retry count is GDD_RETRY_COUNT as rest clients, 0 in mesh service discovery mode, opts override defaults and can be
+// passed as call options as well. Calls of other methods are sent once.
+func UnaryClientInterceptor(store framework.AnnotationStore, opts ...grpc_retry.CallOption) grpc.UnaryClientInterceptor {
+	retry := grpc_retry.UnaryClientInterceptor(append(defaultOptions(), opts...)...)
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, callOpts ...grpc.CallOption) error {
+		if !idempotent(store, method) {
+			return invoker(ctx, method, req, reply, cc, callOpts...)
+		}
+		return retry(ctx, method, req, reply, cc, invoker, callOpts...)
+	}
+}
+
+// StreamClientInterceptor returns a client interceptor function retrying server stream RPC before any message
+// is received, as UnaryClientInterceptor
+func StreamClientInterceptor(store framework.AnnotationStore, opts ...grpc_retry.CallOption) grpc.StreamClientInterceptor {
+	retry := grpc_retry.StreamClientInterceptor(append(defaultOptions(), opts...)...)
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, callOpts ...grpc.CallOption) (grpc.ClientStream, error) {
+		if !idempotent(store, method) {
+			return streamer(ctx, desc, cc, method, callOpts...)
+		}
+		return retry(ctx, desc, cc, method, streamer, callOpts...)
+	}
+}
@@ -0,0 +1,92 @@
+package grpcx_retry
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	grpc_retry "github.com/grpc-ecosystem/go-grpc-middleware/retry"
+	"github.com/stretchr/testify/require"
+	"github.com/unionj-cloud/go-doudou/v2/framework"
+	"github.com/unionj-cloud/go-doudou/v2/framework/hedging"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestUnaryClientInterceptor(t *testing.T) {
+	store := framework.AnnotationStore{
+		"GetUserRpc":  {{Name: Annotation}},
+		"PageUserRpc": {{Name: hedging.Annotation}},
+	}
+	var calls int
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		calls++
+		return status.Error(codes.Unavailable, "connection refused")
+	}
+	interceptor := UnaryClientInterceptor(store, grpc_retry.WithMax(3), grpc_retry.WithBackoff(grpc_retry.BackoffLinear(time.Millisecond)))
+
+	// max counts the first attempt
+	err := interceptor(context.Background(), "/usersvc.UsersvcService/GetUserRpc", nil, nil, nil, invoker)
+	require.Equal(t, codes.Unavailable, status.Code(err))
+	require.Equal(t, 3, calls)
+
+	calls = 0
+	err = interceptor(context.Background(), "/usersvc.UsersvcService/PageUserRpc", nil, nil, nil, invoker)
+	require.Equal(t, codes.Unavailable, status.Code(err))
+	require.Equal(t, 3, calls)
+
+	// methods not annotated as idempotent are not retried
+	calls = 0
+	err = interceptor(context.Background(), "/usersvc.UsersvcService/SignUpRpc", nil, nil, nil, invoker)
+	require.Equal(t, codes.Unavailable, status.Code(err))
+	require.Equal(t, 1, calls)
+
+	// other codes are not retried
+	calls = 0
+	err = interceptor(context.Background(), "/usersvc.UsersvcService/GetUserRpc", nil, nil, nil,
+		func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+			calls++
+			return status.Error(codes.InvalidArgument, "bad request")
+		})
+	require.Equal(t, codes.InvalidArgument, status.Code(err))
+	require.Equal(t, 1, calls)
+}
+
+func TestDefaultRetryCount(t *testing.T) {
+	t.Setenv("GDD_RETRY_COUNT", "2")
+	var calls int
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		calls++
+		return status.Error(codes.Unavailable, "connection refused")
+	}
+	interceptor := UnaryClientInterceptor(framework.AnnotationStore{"GetUserRpc": {{Name: Annotation}}})
+	start := time.Now()
+	err := interceptor(context.Background(), "/usersvc.UsersvcService/GetUserRpc", nil, nil, nil, invoker)
+	require.Equal(t, codes.Unavailable, status.Code(err))
+	// the first attempt and 2 retries waiting about 50ms and 100ms
+	require.Equal(t, 3, calls)
+	require.GreaterOrEqual(t, time.Since(start), 120*time.Millisecond)
+
+	t.Setenv("GDD_RETRY_COUNT", "0")
+	calls = 0
+	interceptor = UnaryClientInterceptor(framework.AnnotationStore{"GetUserRpc": {{Name: Annotation}}})
+	err = interceptor(context.Background(), "/usersvc.UsersvcService/GetUserRpc", nil, nil, nil, invoker)
+	require.Equal(t, codes.Unavailable, status.Code(err))
+	require.Equal(t, 1, calls)
+}
+
+func TestBackoff(t *testing.T) {
+	require.Zero(t, backoff(0))
+	for attempt := uint(1); attempt < 100; attempt++ {
+		wait := backoff(attempt)
+		require.LessOrEqual(t, wait, time.Duration(float64(maxBackoff)*(1+backoffJitter)))
+		if attempt < 7 {
+			expected := backoffScalar << (attempt - 1)
+			require.GreaterOrEqual(t, wait, time.Duration(float64(expected)*(1-backoffJitter)))
+			require.LessOrEqual(t, wait, time.Duration(float64(expected)*(1+backoffJitter)))
+		} else {
+			require.GreaterOrEqual(t, wait, time.Duration(float64(maxBackoff)*(1-backoffJitter)))
+		}
+	}
+}
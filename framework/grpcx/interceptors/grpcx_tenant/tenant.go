@@ -0,0 +1,95 @@
+package grpcx_tenant
+
+import (
+	"context"
+	"strings"
+
+	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
+	"github.com/unionj-cloud/go-doudou/v2/toolkit/stringutils"
+	"github.com/unionj-cloud/go-doudou/v2/toolkit/tenant"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func metadataKey(key string) string {
+	if stringutils.IsEmpty(key) {
+		key = tenant.DefaultHeader
+	}
+	return strings.ToLower(key)
+}
+
+// resolve rejects calls without tenant id or with malformed one
+func resolve(ctx context.Context, key string) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get(key)
+	if len(values) == 0 || stringutils.IsEmpty(values[0]) {
+		return nil, status.Error(codes.InvalidArgument, tenant.ErrMissingTenant.Error())
+	}
+	newCtx, err := tenant.WithTenant(ctx, values[0])
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	return newCtx, nil
+}
+
+// UnaryServerInterceptor returns a server interceptor function storing tenant id read from metadata key into context,
+// tenant.DefaultHeader is used if key is empty. Calls without tenant id are rejected with InvalidArgument
+func UnaryServerInterceptor(key string) grpc.UnaryServerInterceptor {
+	key = metadataKey(key)
+	return func(
+		ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		newCtx, err := resolve(ctx, key)
+		if err != nil {
+			return nil, err
+		}
+		return handler(newCtx, req)
+	}
+}
+
+// StreamServerInterceptor returns a server interceptor function storing tenant id read from metadata key into context,
+// tenant.DefaultHeader is used if key is empty. Calls without tenant id are rejected with InvalidArgument
+func StreamServerInterceptor(key string) grpc.StreamServerInterceptor {
+	key = metadataKey(key)
+	return func(
+		srv interface{},
+		stream grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		newCtx, err := resolve(stream.Context(), key)
+		if err != nil {
+			return err
+		}
+		wrapped := grpc_middleware.WrapServerStream(stream)
+		wrapped.WrappedContext = newCtx
+		return handler(srv, wrapped)
+	}
+}
+
+// UnaryClientInterceptor returns a client interceptor function propagating tenant id in context to downstream services
+func UnaryClientInterceptor(key string) grpc.UnaryClientInterceptor {
+	key = metadataKey(key)
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if id, ok := tenant.FromContext(ctx); ok {
+			ctx = metadata.AppendToOutgoingContext(ctx, key, id)
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// StreamClientInterceptor returns a client interceptor function propagating tenant id in context to downstream services
+func StreamClientInterceptor(key string) grpc.StreamClientInterceptor {
+	key = metadataKey(key)
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		if id, ok := tenant.FromContext(ctx); ok {
+			ctx = metadata.AppendToOutgoingContext(ctx, key, id)
+		}
+		return streamer(ctx, desc, cc, method, opts...)
+	}
+}
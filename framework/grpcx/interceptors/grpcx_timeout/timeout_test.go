@@ -0,0 +1,43 @@
+package grpcx_timeout
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+)
+
+func TestUnaryClientInterceptor(t *testing.T) {
+	var remaining time.Duration
+	var hasDeadline bool
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		var deadline time.Time
+		deadline, hasDeadline = ctx.Deadline()
+		remaining = time.Until(deadline)
+		return nil
+	}
+	interceptor := UnaryClientInterceptor(time.Second)
+
+	// no deadline
+	require.NoError(t, interceptor(context.Background(), "/usersvc.UsersvcService/GetUserRpc", nil, nil, nil, invoker))
+	require.True(t, hasDeadline)
+	require.InDelta(t, time.Second, remaining, float64(100*time.Millisecond))
+
+	// longer deadline is capped
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	require.NoError(t, interceptor(ctx, "/usersvc.UsersvcService/GetUserRpc", nil, nil, nil, invoker))
+	require.InDelta(t, time.Second, remaining, float64(100*time.Millisecond))
+
+	// shorter deadline is kept
+	ctx, cancel = context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	require.NoError(t, interceptor(ctx, "/usersvc.UsersvcService/GetUserRpc", nil, nil, nil, invoker))
+	require.InDelta(t, 200*time.Millisecond, remaining, float64(100*time.Millisecond))
+
+	// zero timeout leaves context as is
+	require.NoError(t, UnaryClientInterceptor(0)(context.Background(), "/usersvc.UsersvcService/GetUserRpc", nil, nil, nil, invoker))
+	require.False(t, hasDeadline)
+}
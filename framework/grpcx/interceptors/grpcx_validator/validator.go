@@ -0,0 +1,152 @@
+package grpcx_validator
+
+import (
+	"context"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/unionj-cloud/go-doudou/v2/framework/rest"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Rules maps rpc name to validation tags of request fields, tags follow https://github.com/go-playground/validator
+// as @validate annotations of svc interface method parameters. It is generated to transport/grpc/annotation.go.
+type Rules map[string]map[string]string
+
+// fieldKey normalizes field names, so that rules keyed by go parameter names match fields named by any naming strategy
+func fieldKey(name string) string {
+	return strings.ToLower(strings.ReplaceAll(name, "_", ""))
+}
+
+func rpcName(fullMethod string) string {
+	return fullMethod[strings.LastIndex(fullMethod, "/")+1:]
+}
+
+func valueOf(fd protoreflect.FieldDescriptor, v protoreflect.Value) interface{} {
+	switch {
+	case fd.IsList():
+		list := v.List()
+		values := make([]interface{}, 0, list.Len())
+		for i := 0; i < list.Len(); i++ {
+			values = append(values, scalarOf(fd, list.Get(i)))
+		}
+		return values
+	case fd.IsMap():
+		values := make(map[interface{}]interface{})
+		v.Map().Range(func(k protoreflect.MapKey, v protoreflect.Value) bool {
+			values[k.Interface()] = scalarOf(fd.MapValue(), v)
+			return true
+		})
+		return values
+	}
+	return scalarOf(fd, v)
+}
+
+func scalarOf(fd protoreflect.FieldDescriptor, v protoreflect.Value) interface{} {
+	switch fd.Kind() {
+	case protoreflect.EnumKind:
+		return int32(v.Enum())
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return v.Message().Interface()
+	}
+	return v.Interface()
+}
+
+// Validate validates fields of req against rules of rpc, violations are returned as InvalidArgument status
+// with errdetails.BadRequest details
+func (r Rules) Validate(rpc string, req interface{}) error {
+	tags, ok := r[rpc]
+	if !ok {
+		return nil
+	}
+	msg, ok := req.(proto.Message)
+	if !ok {
+		return nil
+	}
+	byKey := make(map[string]string, len(tags))
+	for name, tag := range tags {
+		byKey[fieldKey(name)] = tag
+	}
+	m := msg.ProtoReflect()
+	var violations []*errdetails.BadRequest_FieldViolation
+	fields := m.Descriptor().Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		tag, ok := byKey[fieldKey(string(fd.Name()))]
+		if !ok || tag == "" {
+			continue
+		}
+		var err error
+		if fd.Kind() == protoreflect.MessageKind && !fd.IsList() && !fd.IsMap() {
+			// nested messages are only checked for presence
+			if strings.Contains(tag, "required") && !m.Has(fd) {
+				err = errors.New("required")
+			}
+		} else {
+			err = rest.ValidateVar(valueOf(fd, m.Get(fd)), tag, "")
+		}
+		if err != nil {
+			violations = append(violations, &errdetails.BadRequest_FieldViolation{
+				Field:       fd.JSONName(),
+				Description: err.Error(),
+			})
+		}
+	}
+	if len(violations) == 0 {
+		return nil
+	}
+	var msgs []string
+	for _, v := range violations {
+		msgs = append(msgs, v.Field+": "+v.Description)
+	}
+	st := status.New(codes.InvalidArgument, strings.Join(msgs, ", "))
+	if withDetails, err := st.WithDetails(&errdetails.BadRequest{FieldViolations: violations}); err == nil {
+		st = withDetails
+	}
+	return st.Err()
+}
+
+// UnaryServerInterceptor returns a server interceptor function validating requests of unary RPC against rules
+func UnaryServerInterceptor(rules Rules) grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (interface{}, error) {
+		if err := rules.Validate(rpcName(info.FullMethod), req); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor returns a server interceptor function validating every message received by stream RPC
+func StreamServerInterceptor(rules Rules) grpc.StreamServerInterceptor {
+	return func(
+		srv interface{},
+		stream grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		return handler(srv, &validatingStream{ServerStream: stream, rules: rules, rpc: rpcName(info.FullMethod)})
+	}
+}
+
+type validatingStream struct {
+	grpc.ServerStream
+	rules Rules
+	rpc   string
+}
+
+func (s *validatingStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	return s.rules.Validate(s.rpc, m)
+}
@@ -0,0 +1,70 @@
+package grpcx_validator
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestValidate(t *testing.T) {
+	rules := Rules{
+		"CreateFieldRpc": {
+			"name":       "required,min=3",
+			"Number":     "gte=1",
+			"options":    "required",
+			"json_name":  "",
+			"unknownArg": "required",
+		},
+		"ListRpc": {
+			"values": "min=2",
+		},
+	}
+	interceptor := UnaryServerInterceptor(rules)
+	var called bool
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		called = true
+		return req, nil
+	}
+	info := &grpc.UnaryServerInfo{FullMethod: "/usersvc.UsersvcService/CreateFieldRpc"}
+
+	_, err := interceptor(context.Background(), &descriptorpb.FieldDescriptorProto{Name: proto.String("id")}, info, handler)
+	require.False(t, called)
+	st, _ := status.FromError(err)
+	require.Equal(t, codes.InvalidArgument, st.Code())
+	require.Len(t, st.Details(), 1)
+	violations := st.Details()[0].(*errdetails.BadRequest).FieldViolations
+	require.Len(t, violations, 3)
+	require.Equal(t, "name", violations[0].Field)
+	require.Equal(t, "number", violations[1].Field)
+	require.Equal(t, "options", violations[2].Field)
+
+	_, err = interceptor(context.Background(), &descriptorpb.FieldDescriptorProto{
+		Name:    proto.String("id"),
+		Number:  proto.Int32(1),
+		Options: &descriptorpb.FieldOptions{},
+	}, info, handler)
+	require.Error(t, err)
+	_, err = interceptor(context.Background(), &descriptorpb.FieldDescriptorProto{
+		Name:    proto.String("userId"),
+		Number:  proto.Int32(1),
+		Options: &descriptorpb.FieldOptions{},
+	}, info, handler)
+	require.NoError(t, err)
+	require.True(t, called)
+
+	list, _ := structpb.NewList([]interface{}{"a"})
+	require.Error(t, rules.Validate("ListRpc", list))
+	list, _ = structpb.NewList([]interface{}{"a", "b"})
+	require.NoError(t, rules.Validate("ListRpc", list))
+	// rpcs without rules and non protobuf requests are not validated
+	require.NoError(t, rules.Validate("GetRpc", list))
+	require.NoError(t, rules.Validate("ListRpc", "a"))
+}
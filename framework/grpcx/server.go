@@ -4,18 +4,30 @@ import (
 	"context"
 	"fmt"
 	"github.com/olekukonko/tablewriter"
+	"github.com/pkg/errors"
 	"github.com/unionj-cloud/go-doudou/v2/framework"
+	"github.com/unionj-cloud/go-doudou/v2/framework/grpcx/grpcweb"
+	"github.com/unionj-cloud/go-doudou/v2/framework/grpcx/interceptors/grpcx_mesh"
 	"github.com/unionj-cloud/go-doudou/v2/framework/internal/banner"
 	"github.com/unionj-cloud/go-doudou/v2/framework/internal/config"
+	"github.com/unionj-cloud/go-doudou/v2/framework/lifecycle"
 	register "github.com/unionj-cloud/go-doudou/v2/framework/registry"
+	"github.com/unionj-cloud/go-doudou/v2/framework/registry/mesh"
+	"github.com/unionj-cloud/go-doudou/v2/framework/rest"
+	"github.com/unionj-cloud/go-doudou/v2/framework/tlsx"
 	"github.com/unionj-cloud/go-doudou/v2/toolkit/cast"
+	"github.com/unionj-cloud/go-doudou/v2/toolkit/stringutils"
 	"github.com/unionj-cloud/go-doudou/v2/toolkit/timeutils"
 	logger "github.com/unionj-cloud/go-doudou/v2/toolkit/zlogger"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/grpc/reflection"
 	"net"
-	"os"
-	"os/signal"
+	"net/http"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -26,25 +38,93 @@ func init() {
 	startAt = time.Now()
 }
 
+const (
+	// HttpModeMux serves http requests on grpc port, requests are dispatched by content-type
+	HttpModeMux = "mux"
+	// HttpModePort serves http requests on a separate port configured by GDD_PORT
+	HttpModePort = "port"
+)
+
 type GrpcServer struct {
 	*grpc.Server
-	data map[string]interface{}
+	data   map[string]interface{}
+	health *health.Server
+	http   *rest.RestServer
+	web    *grpcweb.Handler
 }
 
 func NewGrpcServer(opt ...grpc.ServerOption) *GrpcServer {
-	server := GrpcServer{}
-	server.Server = grpc.NewServer(opt...)
+	server := GrpcServer{
+		health: health.NewServer(),
+	}
+	server.Server = grpc.NewServer(tlsx.ServerOptions(meshServerOptions(opt)...)...)
 	return &server
 }
 
 func NewGrpcServerWithData(data map[string]interface{}, opt ...grpc.ServerOption) *GrpcServer {
 	server := GrpcServer{
-		data: data,
+		data:   data,
+		health: health.NewServer(),
 	}
-	server.Server = grpc.NewServer(opt...)
+	server.Server = grpc.NewServer(tlsx.ServerOptions(meshServerOptions(opt)...)...)
 	return &server
 }
 
+// meshServerOptions prepends interceptors capturing tracing headers of sidecars in mesh service discovery mode
+func meshServerOptions(opt []grpc.ServerOption) []grpc.ServerOption {
+	if !mesh.InMesh() {
+		return opt
+	}
+	return append([]grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(grpcx_mesh.UnaryServerInterceptor()),
+		grpc.ChainStreamInterceptor(grpcx_mesh.StreamServerInterceptor()),
+	}, opt...)
+}
+
+// HealthServer returns grpc health service registered by Run, use it to report status of individual services
+func (srv *GrpcServer) HealthServer() *health.Server {
+	return srv.health
+}
+
+// AddRoute adds http routes served alongside grpc services together with management routes
+// when GDD_GRPC_HTTP_MODE is set, such as routes of transcoding.Transcoder
+func (srv *GrpcServer) AddRoute(route ...rest.Route) {
+	srv.httpServer().AddRoute(route...)
+}
+
+// AddMiddleware adds middlewares for http routes
+func (srv *GrpcServer) AddMiddleware(mwf ...func(http.Handler) http.Handler) {
+	srv.httpServer().AddMiddleware(mwf...)
+}
+
+func (srv *GrpcServer) httpServer() *rest.RestServer {
+	if srv.http == nil {
+		srv.http = rest.NewRestServer(srv.data)
+	}
+	return srv.http
+}
+
+// ServeHTTP dispatches grpc requests to grpc server, gRPC-Web and Connect requests to grpcweb.Handler
+// if GDD_GRPC_WEB_ENABLE is true, and others to http routes
+func (srv *GrpcServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if srv.web == nil || !srv.web.Match(r) {
+		if r.ProtoMajor == 2 && strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+			srv.Server.ServeHTTP(w, r)
+			return
+		}
+	}
+	srv.handleHttp(w, r)
+}
+
+// handleHttp dispatches gRPC-Web and Connect requests to grpcweb.Handler if enabled, and others to http routes
+func (srv *GrpcServer) handleHttp(w http.ResponseWriter, r *http.Request) {
+	if srv.web != nil && srv.web.Match(r) {
+		srv.web.ServeHTTP(w, r)
+		return
+	}
+	srv.httpServer().Handler().ServeHTTP(w, r)
+}
+
 func (srv *GrpcServer) printServices() {
 	if !framework.CheckDev() {
 		return
@@ -75,54 +155,138 @@ func (srv *GrpcServer) printServices() {
 	logger.Info().Msg("===================================================")
 }
 
-// Run runs grpc server
-func (srv *GrpcServer) Run() {
-	banner.Print()
-	register.NewGrpc(srv.data)
+func (srv *GrpcServer) registerBuiltin() {
+	if _, ok := srv.GetServiceInfo()["grpc.reflection.v1alpha.ServerReflection"]; !ok {
+		reflection.Register(srv)
+	}
+	if _, ok := srv.GetServiceInfo()[grpc_health_v1.Health_ServiceDesc.ServiceName]; !ok {
+		grpc_health_v1.RegisterHealthServer(srv, srv.health)
+	}
+}
+
+// newHttpServer creates http server serving on grpcLis if mode is mux, otherwise on a separate listener
+func (srv *GrpcServer) newHttpServer(mode string, host string, grpcLis net.Listener) (*http.Server, net.Listener, error) {
+	if cast.ToBoolOrDefault(config.GddGrpcWebEnable.Load(), config.DefaultGddGrpcWebEnable) {
+		var origins []string
+		for _, origin := range strings.Split(config.GddGrpcWebAllowedOrigins.LoadOrDefault(config.DefaultGddGrpcWebAllowedOrigins), ",") {
+			if origin = strings.TrimSpace(origin); origin != "" {
+				origins = append(origins, origin)
+			}
+		}
+		srv.web = grpcweb.NewHandler(srv.Server, grpcweb.WithAllowedOrigins(origins...))
+	}
+	tlsConfig := tlsx.ServerConfig()
+	httpServer := &http.Server{
+		Handler:           srv,
+		ReadHeaderTimeout: 10 * time.Second,
+		TLSConfig:         tlsConfig,
+	}
+	switch mode {
+	case HttpModeMux:
+		if tlsConfig == nil {
+			// grpc clients speak http/2 with prior knowledge on plaintext connections
+			httpServer.Handler = h2c.NewHandler(srv, &http2.Server{})
+		}
+		return httpServer, grpcLis, nil
+	case HttpModePort:
+		// grpc requests are served on grpc port only
+		httpServer.Handler = http.HandlerFunc(srv.handleHttp)
+		lis, err := net.Listen("tcp", net.JoinHostPort(host, strconv.FormatUint(config.GetPort(), 10)))
+		if err != nil {
+			return nil, nil, err
+		}
+		return httpServer, lis, nil
+	}
+	return nil, nil, fmt.Errorf("unknown http mode %s", mode)
+}
+
+func serveHttp(httpServer *http.Server, lis net.Listener) error {
+	if httpServer.TLSConfig != nil {
+		// certificates are served by TLSConfig.GetCertificate
+		return httpServer.ServeTLS(lis, "", "")
+	}
+	return httpServer.Serve(lis)
+}
+
+// Start serves grpc requests in the background without registering the service or waiting for signals, so that
+// it can be run with other servers, e.g. by app.App. http routes are served by httpMode, HttpModeMux, HttpModePort
+// or empty for none. It returns hooks draining the servers on shutdown.
+func (srv *GrpcServer) Start(httpMode string) ([]lifecycle.Hook, error) {
 	port := config.DefaultGddGrpcPort
 	if p, err := cast.ToIntE(config.GddGrpcPort.Load()); err == nil {
 		port = p
 	}
-	lis, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
+	host := config.DefaultGddHost
+	if stringutils.IsNotEmpty(config.GddHost.Load()) {
+		host = config.GddHost.Load()
+	}
+	lis, err := net.Listen("tcp", net.JoinHostPort(host, strconv.Itoa(port)))
 	if err != nil {
-		logger.Panic().Msgf("failed to listen: %v", err)
+		return nil, errors.Wrap(err, "failed to listen")
 	}
-	reflection.Register(srv)
+	srv.registerBuiltin()
 	srv.printServices()
-	go func() {
-		logger.Info().Msgf("Grpc server is listening at %v", lis.Addr())
-		logger.Info().Msgf("Grpc server started in %s", time.Since(startAt))
-		if err := srv.Serve(lis); err != nil {
-			logger.Error().Msgf("failed to serve: %v", err)
-		}
-	}()
-
-	defer func() {
-		register.ShutdownGrpc()
 
-		grace, err := time.ParseDuration(config.GddGraceTimeout.Load())
+	var httpServer *http.Server
+	if stringutils.IsNotEmpty(httpMode) {
+		var httpLis net.Listener
+		httpServer, httpLis, err = srv.newHttpServer(httpMode, host, lis)
 		if err != nil {
-			logger.Debug().Msgf("Parse %s %s as time.Duration failed: %s, use default %s instead.\n", string(config.GddGraceTimeout),
-				config.GddGraceTimeout.Load(), err.Error(), config.DefaultGddGraceTimeout)
-			grace, _ = time.ParseDuration(config.DefaultGddGraceTimeout)
+			lis.Close()
+			return nil, errors.Wrap(err, "failed to serve http")
 		}
-		logger.Info().Msgf("Grpc server is gracefully shutting down in %s", grace)
-
-		ctx, cancel := context.WithTimeout(context.Background(), grace)
-		defer cancel()
-		if err := timeutils.CallWithCtx(ctx, func() struct{} {
-			srv.GracefulStop()
-			return struct{}{}
-		}); err != nil {
-			logger.Error().Err(err).Msg("")
-		}
-	}()
+		go func() {
+			logger.Info().Msgf("Http server is listening at %v", httpLis.Addr())
+			if err := serveHttp(httpServer, httpLis); err != nil && err != http.ErrServerClosed {
+				logger.Error().Msgf("failed to serve http: %v", err)
+			}
+		}()
+	}
+	if httpMode != HttpModeMux {
+		go func() {
+			logger.Info().Msgf("Grpc server is listening at %v", lis.Addr())
+			if err := srv.Serve(lis); err != nil {
+				logger.Error().Msgf("failed to serve: %v", err)
+			}
+		}()
+	}
+	logger.Info().Msgf("Grpc server started in %s", time.Since(startAt))
 
-	c := make(chan os.Signal, 1)
-	// We'll accept graceful shutdowns when quit via SIGINT (Ctrl+C)
-	// SIGKILL, SIGQUIT or SIGTERM (Ctrl+/) will not be caught.
-	signal.Notify(c, os.Interrupt)
+	servers := []lifecycle.Hook{
+		{
+			Name: "grpc server",
+			OnStop: func(ctx context.Context) error {
+				return timeutils.CallWithCtx(ctx, func() struct{} {
+					srv.GracefulStop()
+					return struct{}{}
+				})
+			},
+		},
+	}
+	if httpServer != nil {
+		servers = append(servers, lifecycle.Hook{
+			Name:   "http server",
+			OnStop: httpServer.Shutdown,
+		})
+	}
+	return servers, nil
+}
 
-	// Block until we receive our signal.
-	<-c
+// Run runs grpc server until SIGINT or SIGTERM is received, then shuts down gracefully
+func (srv *GrpcServer) Run() {
+	banner.Print()
+	if err := lifecycle.Start(context.Background()); err != nil {
+		logger.Panic().Err(err).Msg("[go-doudou] failed to start")
+	}
+	servers, err := srv.Start(config.GddGrpcHttpMode.LoadOrDefault(config.DefaultGddGrpcHttpMode))
+	if err != nil {
+		logger.Panic().Err(err).Msg("")
+	}
+	register.NewGrpc(srv.data)
+	sig := lifecycle.WaitForSignal()
+	logger.Info().Msgf("[go-doudou] received %s, shutting down", sig)
+	lifecycle.Shutdown(func() {
+		register.ShutdownGrpc()
+		srv.health.Shutdown()
+	}, servers...)
 }
@@ -0,0 +1,131 @@
+package grpcx
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/unionj-cloud/go-doudou/v2/framework/rest"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func TestGrpcServerMux(t *testing.T) {
+	srv := NewGrpcServer()
+	srv.AddRoute(rest.Route{
+		Name:    "GetHello",
+		Method:  http.MethodGet,
+		Pattern: "/hello",
+		HandlerFunc: func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, "hello")
+		},
+	})
+	srv.registerBuiltin()
+	// registering twice must not panic
+	srv.registerBuiltin()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	httpServer, httpLis, err := srv.newHttpServer(HttpModeMux, "127.0.0.1", lis)
+	require.NoError(t, err)
+	require.Equal(t, lis, httpLis)
+	go serveHttp(httpServer, httpLis)
+	defer httpServer.Close()
+
+	conn, err := grpc.Dial(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	defer conn.Close()
+	resp, err := grpc_health_v1.NewHealthClient(conn).Check(context.Background(), &grpc_health_v1.HealthCheckRequest{})
+	require.NoError(t, err)
+	require.Equal(t, grpc_health_v1.HealthCheckResponse_SERVING, resp.Status)
+
+	r, err := http.Get("http://" + lis.Addr().String() + "/hello")
+	require.NoError(t, err)
+	body, _ := io.ReadAll(r.Body)
+	r.Body.Close()
+	require.Equal(t, "hello", string(body))
+
+	req, _ := http.NewRequest(http.MethodGet, "http://"+lis.Addr().String()+"/go-doudou/prometheus", nil)
+	req.SetBasicAuth("admin", "admin")
+	r, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	r.Body.Close()
+	require.Equal(t, http.StatusOK, r.StatusCode)
+
+	srv.HealthServer().Shutdown()
+	resp, err = grpc_health_v1.NewHealthClient(conn).Check(context.Background(), &grpc_health_v1.HealthCheckRequest{})
+	require.NoError(t, err)
+	require.Equal(t, grpc_health_v1.HealthCheckResponse_NOT_SERVING, resp.Status)
+}
+
+func TestGrpcServerWeb(t *testing.T) {
+	t.Setenv("GDD_GRPC_WEB_ENABLE", "true")
+	srv := NewGrpcServer()
+	srv.registerBuiltin()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	httpServer, httpLis, err := srv.newHttpServer(HttpModeMux, "127.0.0.1", lis)
+	require.NoError(t, err)
+	go serveHttp(httpServer, httpLis)
+	defer httpServer.Close()
+
+	r, err := http.Post("http://"+lis.Addr().String()+"/grpc.health.v1.Health/Check", "application/json", strings.NewReader(`{}`))
+	require.NoError(t, err)
+	body, _ := io.ReadAll(r.Body)
+	r.Body.Close()
+	require.Equal(t, http.StatusOK, r.StatusCode)
+	require.JSONEq(t, `{"status":"SERVING"}`, string(body))
+}
+
+func TestGrpcServerPort(t *testing.T) {
+	t.Setenv("GDD_GRPC_WEB_ENABLE", "true")
+	t.Setenv("GDD_PORT", "0")
+	srv := NewGrpcServer()
+	srv.AddRoute(rest.Route{
+		Name:    "GetHello",
+		Method:  http.MethodGet,
+		Pattern: "/hello",
+		HandlerFunc: func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, "hello")
+		},
+	})
+	srv.registerBuiltin()
+
+	httpServer, httpLis, err := srv.newHttpServer(HttpModePort, "127.0.0.1", nil)
+	require.NoError(t, err)
+	go serveHttp(httpServer, httpLis)
+	defer httpServer.Close()
+	addr := "http://" + httpLis.Addr().String()
+
+	r, err := http.Get(addr + "/hello")
+	require.NoError(t, err)
+	body, _ := io.ReadAll(r.Body)
+	r.Body.Close()
+	require.Equal(t, "hello", string(body))
+
+	r, err = http.Post(addr+"/grpc.health.v1.Health/Check", "application/json", strings.NewReader(`{}`))
+	require.NoError(t, err)
+	body, _ = io.ReadAll(r.Body)
+	r.Body.Close()
+	require.JSONEq(t, `{"status":"SERVING"}`, string(body))
+
+	// raw grpc requests are not served on http port
+	req := httptest.NewRequest(http.MethodPost, "/grpc.health.v1.Health/Check", nil)
+	req.ProtoMajor = 2
+	req.Header.Set("Content-Type", "application/grpc")
+	rec := httptest.NewRecorder()
+	httpServer.Handler.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestNewHttpServerUnknownMode(t *testing.T) {
+	_, _, err := NewGrpcServer().newHttpServer("h3", "", nil)
+	require.Error(t, err)
+}
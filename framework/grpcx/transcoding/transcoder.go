@@ -0,0 +1,415 @@
+package transcoding
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+
+	grpc_middleware "github.com/grpc-ecosystem/go-grpc-middleware"
+	"github.com/pkg/errors"
+	"github.com/unionj-cloud/go-doudou/v2/framework/rest"
+	"github.com/unionj-cloud/go-doudou/v2/framework/rest/httprouter"
+	logger "github.com/unionj-cloud/go-doudou/v2/toolkit/zlogger"
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+var _ grpc.ServiceRegistrar = (*Transcoder)(nil)
+
+// Transcoder serves unary rpcs of grpc services over HTTP/JSON according to their google.api.http annotations.
+// It implements grpc.ServiceRegistrar, so the same service implementation can be registered to both
+// grpcx.GrpcServer and Transcoder by the generated RegisterXxxServer function, then mounted on rest.RestServer
+// by AddRoute(transcoder.Routes()...).
+type Transcoder struct {
+	routes      []rest.Route
+	interceptor grpc.UnaryServerInterceptor
+	files       *protoregistry.Files
+	marshal     protojson.MarshalOptions
+	unmarshal   protojson.UnmarshalOptions
+}
+
+type TranscoderOption func(*Transcoder)
+
+// WithUnaryInterceptor sets interceptors applied to transcoded calls, usually the same ones as grpc server's
+func WithUnaryInterceptor(interceptors ...grpc.UnaryServerInterceptor) TranscoderOption {
+	return func(t *Transcoder) {
+		t.interceptor = grpc_middleware.ChainUnaryServer(interceptors...)
+	}
+}
+
+// WithFiles sets registry in which method descriptors are looked up, protoregistry.GlobalFiles by default
+func WithFiles(files *protoregistry.Files) TranscoderOption {
+	return func(t *Transcoder) {
+		t.files = files
+	}
+}
+
+func WithMarshalOptions(options protojson.MarshalOptions) TranscoderOption {
+	return func(t *Transcoder) {
+		t.marshal = options
+	}
+}
+
+func WithUnmarshalOptions(options protojson.UnmarshalOptions) TranscoderOption {
+	return func(t *Transcoder) {
+		t.unmarshal = options
+	}
+}
+
+// NewTranscoder creates a Transcoder
+func NewTranscoder(opts ...TranscoderOption) *Transcoder {
+	t := &Transcoder{
+		files:     protoregistry.GlobalFiles,
+		marshal:   protojson.MarshalOptions{EmitUnpopulated: true},
+		unmarshal: protojson.UnmarshalOptions{DiscardUnknown: true},
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
+}
+
+// Routes returns http routes of all registered rpcs having google.api.http annotation
+func (t *Transcoder) Routes() []rest.Route {
+	return t.routes
+}
+
+// RegisterService implements grpc.ServiceRegistrar interface. Streaming rpcs and rpcs
+// without google.api.http annotation are skipped. It panics on invalid path template.
+func (t *Transcoder) RegisterService(desc *grpc.ServiceDesc, impl interface{}) {
+	for i := range desc.Methods {
+		md := desc.Methods[i]
+		name := protoreflect.FullName(desc.ServiceName + "." + md.MethodName)
+		d, err := t.files.FindDescriptorByName(name)
+		if err != nil {
+			logger.Warn().Err(err).Msgf("rpc %s is not transcoded", name)
+			continue
+		}
+		method, ok := d.(protoreflect.MethodDescriptor)
+		if !ok {
+			continue
+		}
+		options, ok := method.Options().(*descriptorpb.MethodOptions)
+		if !ok || options == nil {
+			continue
+		}
+		rule, ok := proto.GetExtension(options, annotations.E_Http).(*annotations.HttpRule)
+		if !ok || rule == nil {
+			continue
+		}
+		fullMethod := fmt.Sprintf("/%s/%s", desc.ServiceName, md.MethodName)
+		for _, binding := range append([]*annotations.HttpRule{rule}, rule.AdditionalBindings...) {
+			httpMethod, template := patternOf(binding)
+			if template == "" {
+				continue
+			}
+			pattern, params, err := parseTemplate(template)
+			if err != nil {
+				panic(errors.Wrapf(err, "invalid google.api.http annotation of rpc %s", name))
+			}
+			t.routes = append(t.routes, rest.Route{
+				Name:        md.MethodName,
+				Method:      httpMethod,
+				Pattern:     pattern,
+				HandlerFunc: t.handler(impl, md.Handler, fullMethod, params, binding.Body),
+			})
+		}
+	}
+}
+
+func patternOf(rule *annotations.HttpRule) (string, string) {
+	switch p := rule.Pattern.(type) {
+	case *annotations.HttpRule_Get:
+		return http.MethodGet, p.Get
+	case *annotations.HttpRule_Put:
+		return http.MethodPut, p.Put
+	case *annotations.HttpRule_Post:
+		return http.MethodPost, p.Post
+	case *annotations.HttpRule_Delete:
+		return http.MethodDelete, p.Delete
+	case *annotations.HttpRule_Patch:
+		return http.MethodPatch, p.Patch
+	case *annotations.HttpRule_Custom:
+		return strings.ToUpper(p.Custom.Kind), p.Custom.Path
+	}
+	return "", ""
+}
+
+// pathParam maps a route parameter to a field path of request message
+type pathParam struct {
+	name  string
+	field string
+}
+
+// parseTemplate converts google.api.http path template to httprouter pattern, only {field}, {field=*}
+// and trailing {field=**} variables are supported
+func parseTemplate(template string) (string, []pathParam, error) {
+	if !strings.HasPrefix(template, "/") {
+		return "", nil, errors.Errorf("path template %s must start with /", template)
+	}
+	if i := strings.LastIndex(template, ":"); i > strings.LastIndex(template, "}") && i > strings.LastIndex(template, "/") {
+		return "", nil, errors.Errorf("verb of path template %s is not supported", template)
+	}
+	segments := strings.Split(strings.TrimPrefix(template, "/"), "/")
+	var params []pathParam
+	for i, segment := range segments {
+		if !strings.HasPrefix(segment, "{") {
+			if strings.ContainsAny(segment, "{}*") {
+				return "", nil, errors.Errorf("segment %s of path template %s is not supported", segment, template)
+			}
+			continue
+		}
+		if !strings.HasSuffix(segment, "}") {
+			return "", nil, errors.Errorf("segment %s of path template %s is not supported", segment, template)
+		}
+		field, sub := strings.TrimSuffix(strings.TrimPrefix(segment, "{"), "}"), "*"
+		if j := strings.Index(field, "="); j >= 0 {
+			field, sub = field[:j], field[j+1:]
+		}
+		name := strings.ReplaceAll(field, ".", "_")
+		switch {
+		case sub == "*":
+			segments[i] = ":" + name
+		case sub == "**" && i == len(segments)-1:
+			segments[i] = "*" + name
+		default:
+			return "", nil, errors.Errorf("segment %s of path template %s is not supported", segment, template)
+		}
+		params = append(params, pathParam{name: name, field: field})
+	}
+	return "/" + strings.Join(segments, "/"), params, nil
+}
+
+func (t *Transcoder) handler(impl interface{},
+	h func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error),
+	fullMethod string, params []pathParam, body string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		dec := func(in interface{}) error {
+			msg, ok := in.(proto.Message)
+			if !ok {
+				return status.Errorf(codes.Internal, "%T is not a proto message", in)
+			}
+			if err := t.decode(r, msg.ProtoReflect(), params, body); err != nil {
+				return status.Error(codes.InvalidArgument, err.Error())
+			}
+			return nil
+		}
+		ctx := metadata.NewIncomingContext(r.Context(), metadataOf(r))
+		ctx = grpc.NewContextWithServerTransportStream(ctx, &serverTransportStream{method: fullMethod})
+		resp, err := h(impl, ctx, dec, t.interceptor)
+		if err != nil {
+			panic(bizErrorOf(err))
+		}
+		data, err := t.marshal.Marshal(resp.(proto.Message))
+		if err != nil {
+			panic(rest.NewBizError(err))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	}
+}
+
+// bizErrorOf makes errors returned by grpc service implementation rendered by rest panic handler
+func bizErrorOf(err error) rest.BizError {
+	var bizError rest.BizError
+	if errors.As(err, &bizError) {
+		return bizError
+	}
+	st, _ := status.FromError(err)
+	return rest.BizErrorFromStatus(st)
+}
+
+// metadataOf forwards http headers as incoming grpc metadata, so that grpc interceptors
+// such as authentication work for transcoded calls as well
+func metadataOf(r *http.Request) metadata.MD {
+	md := metadata.MD{}
+	for k, v := range r.Header {
+		md.Append(strings.ToLower(k), v...)
+	}
+	if r.Host != "" {
+		md.Set(":authority", r.Host)
+	}
+	return md
+}
+
+// decode fills msg with request body, path parameters and query parameters in order
+func (t *Transcoder) decode(r *http.Request, msg protoreflect.Message, params []pathParam, body string) error {
+	if body != "" {
+		data, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			return err
+		}
+		if len(strings.TrimSpace(string(data))) > 0 {
+			target := msg
+			if body != "*" {
+				fd, err := fieldOf(msg, body)
+				if err != nil {
+					return err
+				}
+				if fd.Message() == nil || fd.IsList() || fd.IsMap() {
+					return errors.Errorf("body field %s must be a message", body)
+				}
+				target = msg.Mutable(fd).Message()
+			}
+			if err = t.unmarshal.Unmarshal(data, target.Interface()); err != nil {
+				return err
+			}
+		}
+	}
+	ps := httprouter.ParamsFromContext(r.Context())
+	for _, p := range params {
+		value := strings.TrimPrefix(ps.ByName(p.name), "/")
+		if err := setField(msg, p.field, []string{value}); err != nil {
+			return err
+		}
+	}
+	if body == "*" {
+		return nil
+	}
+	for key, values := range r.URL.Query() {
+		if err := setField(msg, key, values); err != nil {
+			if errors.Is(err, errUnknownField) {
+				continue
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+var errUnknownField = errors.New("unknown field")
+
+// fieldOf looks up field by proto name or json name
+func fieldOf(msg protoreflect.Message, name string) (protoreflect.FieldDescriptor, error) {
+	fields := msg.Descriptor().Fields()
+	fd := fields.ByName(protoreflect.Name(name))
+	if fd == nil {
+		fd = fields.ByJSONName(name)
+	}
+	if fd == nil {
+		return nil, errors.Wrapf(errUnknownField, "%s of message %s", name, msg.Descriptor().FullName())
+	}
+	return fd, nil
+}
+
+// setField sets values to field of msg at dot separated path
+func setField(msg protoreflect.Message, path string, values []string) error {
+	names := strings.Split(path, ".")
+	for _, name := range names[:len(names)-1] {
+		fd, err := fieldOf(msg, name)
+		if err != nil {
+			return err
+		}
+		if fd.Message() == nil || fd.IsList() || fd.IsMap() {
+			return errors.Errorf("field %s of path %s is not a message", name, path)
+		}
+		msg = msg.Mutable(fd).Message()
+	}
+	fd, err := fieldOf(msg, names[len(names)-1])
+	if err != nil {
+		return err
+	}
+	if fd.IsMap() {
+		return errors.Errorf("map field %s can't be set by parameter", path)
+	}
+	if fd.IsList() {
+		list := msg.Mutable(fd).List()
+		for _, item := range values {
+			v, err := valueOf(fd, msg.NewField(fd).List().NewElement(), item)
+			if err != nil {
+				return errors.Wrapf(err, "invalid value of field %s", path)
+			}
+			list.Append(v)
+		}
+		return nil
+	}
+	if len(values) == 0 {
+		return nil
+	}
+	v, err := valueOf(fd, msg.NewField(fd), values[len(values)-1])
+	if err != nil {
+		return errors.Wrapf(err, "invalid value of field %s", path)
+	}
+	msg.Set(fd, v)
+	return nil
+}
+
+func valueOf(fd protoreflect.FieldDescriptor, zero protoreflect.Value, s string) (protoreflect.Value, error) {
+	switch fd.Kind() {
+	case protoreflect.StringKind:
+		return protoreflect.ValueOfString(s), nil
+	case protoreflect.BoolKind:
+		v, err := strconv.ParseBool(s)
+		return protoreflect.ValueOfBool(v), err
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		v, err := strconv.ParseInt(s, 10, 32)
+		return protoreflect.ValueOfInt32(int32(v)), err
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		v, err := strconv.ParseInt(s, 10, 64)
+		return protoreflect.ValueOfInt64(v), err
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		v, err := strconv.ParseUint(s, 10, 32)
+		return protoreflect.ValueOfUint32(uint32(v)), err
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		v, err := strconv.ParseUint(s, 10, 64)
+		return protoreflect.ValueOfUint64(v), err
+	case protoreflect.FloatKind:
+		v, err := strconv.ParseFloat(s, 32)
+		return protoreflect.ValueOfFloat32(float32(v)), err
+	case protoreflect.DoubleKind:
+		v, err := strconv.ParseFloat(s, 64)
+		return protoreflect.ValueOfFloat64(v), err
+	case protoreflect.BytesKind:
+		v, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			v, err = base64.URLEncoding.DecodeString(s)
+		}
+		return protoreflect.ValueOfBytes(v), err
+	case protoreflect.EnumKind:
+		if ev := fd.Enum().Values().ByName(protoreflect.Name(s)); ev != nil {
+			return protoreflect.ValueOfEnum(ev.Number()), nil
+		}
+		v, err := strconv.ParseInt(s, 10, 32)
+		return protoreflect.ValueOfEnum(protoreflect.EnumNumber(v)), err
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		// well-known types such as google.protobuf.Timestamp have string json representation
+		m := zero.Message()
+		err := protojson.Unmarshal([]byte(strconv.Quote(s)), m.Interface())
+		return protoreflect.ValueOfMessage(m), err
+	}
+	return protoreflect.Value{}, errors.Errorf("unsupported kind %s", fd.Kind())
+}
+
+// serverTransportStream makes grpc.Method, grpc.SetHeader and grpc.SetTrailer work in service implementation,
+// headers and trailers are discarded
+type serverTransportStream struct {
+	method string
+}
+
+func (s *serverTransportStream) Method() string {
+	return s.method
+}
+
+func (s *serverTransportStream) SetHeader(metadata.MD) error {
+	return nil
+}
+
+func (s *serverTransportStream) SendHeader(metadata.MD) error {
+	return nil
+}
+
+func (s *serverTransportStream) SetTrailer(metadata.MD) error {
+	return nil
+}
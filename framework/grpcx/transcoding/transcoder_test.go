@@ -0,0 +1,218 @@
+package transcoding
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/unionj-cloud/go-doudou/v2/framework/rest"
+	"github.com/unionj-cloud/go-doudou/v2/framework/rest/httprouter"
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+func field(name string, number int32, kind descriptorpb.FieldDescriptorProto_Type, label descriptorpb.FieldDescriptorProto_Label) *descriptorpb.FieldDescriptorProto {
+	return &descriptorpb.FieldDescriptorProto{
+		Name:     proto.String(name),
+		JsonName: proto.String(name),
+		Number:   proto.Int32(number),
+		Type:     kind.Enum(),
+		Label:    label.Enum(),
+	}
+}
+
+func methodOf(name string, rule *annotations.HttpRule) *descriptorpb.MethodDescriptorProto {
+	options := &descriptorpb.MethodOptions{}
+	proto.SetExtension(options, annotations.E_Http, rule)
+	return &descriptorpb.MethodDescriptorProto{
+		Name:       proto.String(name),
+		InputType:  proto.String(".usersvc.UserRequest"),
+		OutputType: proto.String(".usersvc.UserReply"),
+		Options:    options,
+	}
+}
+
+func setupFiles(t *testing.T) *protoregistry.Files {
+	optional, repeated := descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL, descriptorpb.FieldDescriptorProto_LABEL_REPEATED
+	fdp := &descriptorpb.FileDescriptorProto{
+		Name:    proto.String("usersvc.proto"),
+		Package: proto.String("usersvc"),
+		Syntax:  proto.String("proto3"),
+		MessageType: []*descriptorpb.DescriptorProto{
+			{
+				Name: proto.String("UserRequest"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("id", 1, descriptorpb.FieldDescriptorProto_TYPE_INT64, optional),
+					field("name", 2, descriptorpb.FieldDescriptorProto_TYPE_STRING, optional),
+					field("tags", 3, descriptorpb.FieldDescriptorProto_TYPE_STRING, repeated),
+				},
+			},
+			{
+				Name: proto.String("UserReply"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("message", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, optional),
+				},
+			},
+		},
+		Service: []*descriptorpb.ServiceDescriptorProto{
+			{
+				Name: proto.String("UsersvcService"),
+				Method: []*descriptorpb.MethodDescriptorProto{
+					methodOf("GetUserRpc", &annotations.HttpRule{Pattern: &annotations.HttpRule_Get{Get: "/user/{id}"}}),
+					methodOf("PostUserRpc", &annotations.HttpRule{Pattern: &annotations.HttpRule_Post{Post: "/user"}, Body: "*"}),
+					{
+						Name:       proto.String("DeleteUserRpc"),
+						InputType:  proto.String(".usersvc.UserRequest"),
+						OutputType: proto.String(".usersvc.UserReply"),
+					},
+				},
+			},
+		},
+	}
+	fd, err := protodesc.NewFile(fdp, protoregistry.GlobalFiles)
+	require.NoError(t, err)
+	files := new(protoregistry.Files)
+	require.NoError(t, files.RegisterFile(fd))
+	return files
+}
+
+// handlerOf imitates method handler generated by protoc-gen-go-grpc
+func handlerOf(files *protoregistry.Files, fn func(ctx context.Context, in *dynamicpb.Message) (*dynamicpb.Message, error)) func(interface{}, context.Context, func(interface{}) error, grpc.UnaryServerInterceptor) (interface{}, error) {
+	return func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+		d, _ := files.FindDescriptorByName("usersvc.UserRequest")
+		in := dynamicpb.NewMessage(d.(protoreflect.MessageDescriptor))
+		if err := dec(in); err != nil {
+			return nil, err
+		}
+		if interceptor == nil {
+			return fn(ctx, in)
+		}
+		return interceptor(ctx, in, &grpc.UnaryServerInfo{Server: srv}, func(ctx context.Context, req interface{}) (interface{}, error) {
+			return fn(ctx, req.(*dynamicpb.Message))
+		})
+	}
+}
+
+func reply(files *protoregistry.Files, message string) *dynamicpb.Message {
+	d, _ := files.FindDescriptorByName("usersvc.UserReply")
+	out := dynamicpb.NewMessage(d.(protoreflect.MessageDescriptor))
+	out.Set(out.Descriptor().Fields().ByName("message"), protoreflect.ValueOfString(message))
+	return out
+}
+
+func TestTranscoder(t *testing.T) {
+	files := setupFiles(t)
+	var intercepted bool
+	transcoder := NewTranscoder(WithFiles(files), WithUnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		intercepted = true
+		return handler(ctx, req)
+	}))
+	get := func(ctx context.Context, in *dynamicpb.Message) (*dynamicpb.Message, error) {
+		fields := in.Descriptor().Fields()
+		id := in.Get(fields.ByName("id")).Int()
+		if id == 0 {
+			return nil, rest.NewBizError(status.Error(codes.NotFound, "user not found"), rest.WithStatusCode(http.StatusNotFound), rest.WithErrCode(10404))
+		}
+		if id < 0 {
+			return nil, status.Error(codes.PermissionDenied, "forbidden")
+		}
+		md, _ := metadata.FromIncomingContext(ctx)
+		method, _ := grpc.Method(ctx)
+		tags := in.Get(fields.ByName("tags")).List()
+		return reply(files, strings.Join([]string{
+			in.Get(fields.ByName("name")).String(), tags.Get(0).String(), tags.Get(1).String(), md.Get("x-tenant-id")[0], method,
+		}, ",")), nil
+	}
+	post := func(ctx context.Context, in *dynamicpb.Message) (*dynamicpb.Message, error) {
+		return reply(files, in.Get(in.Descriptor().Fields().ByName("name")).String()), nil
+	}
+	transcoder.RegisterService(&grpc.ServiceDesc{
+		ServiceName: "usersvc.UsersvcService",
+		Methods: []grpc.MethodDesc{
+			{MethodName: "GetUserRpc", Handler: handlerOf(files, get)},
+			{MethodName: "PostUserRpc", Handler: handlerOf(files, post)},
+			{MethodName: "DeleteUserRpc", Handler: handlerOf(files, post)},
+		},
+	}, nil)
+	routes := transcoder.Routes()
+	require.Len(t, routes, 2)
+	require.Equal(t, "/user/:id", routes[0].Pattern)
+	require.Equal(t, http.MethodPost, routes[1].Method)
+
+	router := httprouter.New()
+	for _, route := range routes {
+		router.Handler(route.Method, route.Pattern, recovery(route.HandlerFunc), route.Name)
+	}
+
+	call := func(method, url, body string) (int, map[string]interface{}) {
+		req := httptest.NewRequest(method, url, strings.NewReader(body))
+		req.Header.Set("X-Tenant-ID", "acme")
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		var ret map[string]interface{}
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &ret))
+		return rec.Code, ret
+	}
+
+	code, ret := call(http.MethodGet, "/user/1?name=jack&tags=a&tags=b&unknown=1", "")
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, "jack,a,b,acme,/usersvc.UsersvcService/GetUserRpc", ret["message"])
+	require.True(t, intercepted)
+
+	code, ret = call(http.MethodPost, "/user", `{"name":"rose"}`)
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, "rose", ret["message"])
+
+	code, ret = call(http.MethodGet, "/user/0", "")
+	require.Equal(t, http.StatusNotFound, code)
+	require.EqualValues(t, 10404, ret["code"])
+
+	code, ret = call(http.MethodGet, "/user/-1", "")
+	require.Equal(t, http.StatusForbidden, code)
+	require.EqualValues(t, codes.PermissionDenied, ret["code"])
+
+	code, _ = call(http.MethodGet, "/user/abc", "")
+	require.Equal(t, http.StatusBadRequest, code)
+}
+
+// recovery renders panics the same way as rest.RestServer
+func recovery(inner http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			if e := recover(); e != nil {
+				bizError := e.(rest.BizError)
+				w.WriteHeader(bizError.StatusCode)
+				json.NewEncoder(w).Encode(map[string]interface{}{
+					"code":    bizError.ErrCode,
+					"message": bizError.ErrMsg,
+				})
+			}
+		}()
+		inner.ServeHTTP(w, r)
+	})
+}
+
+func TestParseTemplate(t *testing.T) {
+	pattern, params, err := parseTemplate("/v1/shelves/{shelf}/books/{book.id=*}/{path=**}")
+	require.NoError(t, err)
+	require.Equal(t, "/v1/shelves/:shelf/books/:book_id/*path", pattern)
+	require.Equal(t, []pathParam{{"shelf", "shelf"}, {"book_id", "book.id"}, {"path", "path"}}, params)
+
+	for _, template := range []string{"v1/users", "/v1/users:batchGet", "/v1/{name=shelves/*}", "/v1/{path=**}/books"} {
+		_, _, err = parseTemplate(template)
+		require.Error(t, err, template)
+	}
+}
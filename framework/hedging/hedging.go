@@ -0,0 +1,290 @@
+package hedging
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/unionj-cloud/go-doudou/v2/framework/internal/config"
+	"github.com/unionj-cloud/go-doudou/v2/toolkit/cast"
+	logger "github.com/unionj-cloud/go-doudou/v2/toolkit/zlogger"
+)
+
+// Annotation marks idempotent methods of svc interface whose calls are hedged, e.g. // @hedge()
+const Annotation = "@hedge"
+
+const (
+	// windowSize is number of latest latencies of a method the quantile is computed from
+	windowSize = 256
+	// minSamples is number of latencies of a method observed before Config.Delay is replaced by the quantile
+	minSamples = 20
+	// maxTokens caps hedges sent in a burst after a quiet period
+	maxTokens = 10
+)
+
+var hedgeCount = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "go_doudou_hedging_count",
+	Help: "Number of hedged requests sent and won, i.e. responded before the original request.",
+}, []string{"method", "result"})
+
+// Config configures hedging
+type Config struct {
+	// Quantile of latencies of a method after which a second request is sent, e.g. 0.95
+	Quantile float64
+	// Delay is used instead of the quantile until enough latencies are observed
+	Delay time.Duration
+	// BudgetPercent limits hedged requests to the percentage of all hedgeable requests, so that a slow callee
+	// isn't flooded by twice the load
+	BudgetPercent int
+}
+
+// ConfigFromEnv returns Config from GDD_HEDGING_* environment variables
+func ConfigFromEnv() Config {
+	quantile := config.DefaultGddHedgingQuantile
+	if q, err := cast.ToFloat64E(config.GddHedgingQuantile.Load()); err == nil && q > 0 && q < 1 {
+		quantile = q
+	}
+	delay, err := time.ParseDuration(config.GddHedgingDelay.Load())
+	if err != nil {
+		delay, _ = time.ParseDuration(config.DefaultGddHedgingDelay)
+	}
+	return Config{
+		Quantile:      quantile,
+		Delay:         delay,
+		BudgetPercent: cast.ToIntOrDefault(config.GddHedgingBudgetPercent.Load(), config.DefaultGddHedgingBudgetPercent),
+	}
+}
+
+type window struct {
+	latencies []time.Duration
+	next      int
+	// delay caches the quantile until a new latency is observed
+	delay time.Duration
+	dirty bool
+}
+
+func (w *window) observe(d time.Duration) {
+	if len(w.latencies) < windowSize {
+		w.latencies = append(w.latencies, d)
+	} else {
+		w.latencies[w.next] = d
+		w.next = (w.next + 1) % windowSize
+	}
+	w.dirty = true
+}
+
+func (w *window) quantile(q float64) time.Duration {
+	if w.dirty {
+		sorted := make([]time.Duration, len(w.latencies))
+		copy(sorted, w.latencies)
+		sort.Slice(sorted, func(i, j int) bool {
+			return sorted[i] < sorted[j]
+		})
+		w.delay = sorted[int(q*float64(len(sorted)-1))]
+		w.dirty = false
+	}
+	return w.delay
+}
+
+// Hedger sends a second request of a call if the first one takes longer than the quantile of latencies of
+// the method, the response coming first wins and the other request is cancelled
+type Hedger struct {
+	conf    Config
+	lock    sync.Mutex
+	windows map[string]*window
+	tokens  float64
+}
+
+// New creates a Hedger
+func New(conf Config) *Hedger {
+	return &Hedger{
+		conf:    conf,
+		windows: make(map[string]*window),
+		tokens:  maxTokens,
+	}
+}
+
+var (
+	defaultHedger *Hedger
+	defaultOnce   sync.Once
+)
+
+// Default returns the Hedger configured by environment variables shared by rest clients and grpc interceptors
+func Default() *Hedger {
+	defaultOnce.Do(func() {
+		defaultHedger = New(ConfigFromEnv())
+		if err := prometheus.Register(hedgeCount); err != nil {
+			logger.Warn().Err(err).Msg("[go-doudou] failed to register hedging metrics")
+		}
+	})
+	return defaultHedger
+}
+
+// Delay returns time after which a second request of method is sent
+func (h *Hedger) Delay(method string) time.Duration {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	w, ok := h.windows[method]
+	if !ok || len(w.latencies) < minSamples {
+		return h.conf.Delay
+	}
+	return w.quantile(h.conf.Quantile)
+}
+
+func (h *Hedger) observe(method string, d time.Duration) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	w, ok := h.windows[method]
+	if !ok {
+		w = &window{}
+		h.windows[method] = w
+	}
+	w.observe(d)
+}
+
+// deposit earns a fraction of a hedge for each call, withdraw spends one
+func (h *Hedger) deposit() {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.tokens += float64(h.conf.BudgetPercent) / 100
+	if h.tokens > maxTokens {
+		h.tokens = maxTokens
+	}
+}
+
+func (h *Hedger) withdraw() bool {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if h.tokens < 1 {
+		return false
+	}
+	h.tokens--
+	return true
+}
+
+// Call sends a request of a hedged call, attempt is 0 for the original request and 1 for the hedged one
+type Call func(ctx context.Context, attempt int) (interface{}, error)
+
+type result struct {
+	value   interface{}
+	err     error
+	attempt int
+	elapsed time.Duration
+}
+
+// Do runs call and runs it again if it doesn't return within Delay of method, result of the first successful
+// attempt is returned and context of the other one is cancelled. Context of the winning attempt is cancelled by
+// calling done once the result is no longer used, e.g. after closing http response body. release is called with
+// result of the attempt succeeding too late and may be nil. Failures are not hedged, the error is returned once no
+// attempt is in flight, leaving retries to retry policies.
+func (h *Hedger) Do(ctx context.Context, method string, call Call, release func(interface{})) (value interface{}, done context.CancelFunc, err error) {
+	ctx = withTried(ctx)
+	results := make(chan result, 2)
+	var cancels []context.CancelFunc
+	winner := -1
+	defer func() {
+		for attempt, cancel := range cancels {
+			if attempt != winner {
+				cancel()
+			}
+		}
+	}()
+	launch := func(attempt int) {
+		attemptCtx, cancel := context.WithCancel(ctx)
+		cancels = append(cancels, cancel)
+		start := time.Now()
+		go func() {
+			value, err := call(attemptCtx, attempt)
+			results <- result{value: value, err: err, attempt: attempt, elapsed: time.Since(start)}
+		}()
+	}
+	h.deposit()
+	launch(0)
+	inflight := 1
+	timer := time.NewTimer(h.Delay(method))
+	defer timer.Stop()
+	for {
+		select {
+		case <-timer.C:
+			if ctx.Err() != nil || !h.withdraw() {
+				continue
+			}
+			launch(1)
+			inflight++
+			hedgeCount.WithLabelValues(method, "sent").Inc()
+		case r := <-results:
+			inflight--
+			if r.err == nil {
+				h.observe(method, r.elapsed)
+				if r.attempt > 0 {
+					hedgeCount.WithLabelValues(method, "won").Inc()
+				}
+				if inflight > 0 && release != nil {
+					go func() {
+						if late := <-results; late.err == nil {
+							release(late.value)
+						}
+					}()
+				}
+				winner = r.attempt
+				return r.value, cancels[r.attempt], nil
+			}
+			if inflight == 0 {
+				return nil, func() {}, r.err
+			}
+		}
+	}
+}
+
+type triedKey struct{}
+
+type tried struct {
+	lock  sync.Mutex
+	addrs map[string]struct{}
+}
+
+func withTried(ctx context.Context) context.Context {
+	if _, ok := ctx.Value(triedKey{}).(*tried); ok {
+		return ctx
+	}
+	return context.WithValue(ctx, triedKey{}, &tried{addrs: make(map[string]struct{})})
+}
+
+// MarkTried records that an attempt of the hedged call of ctx is sent to addr
+func MarkTried(ctx context.Context, addr string) {
+	t, ok := ctx.Value(triedKey{}).(*tried)
+	if !ok {
+		return
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.addrs[addr] = struct{}{}
+}
+
+// Tried reports whether an attempt of the hedged call of ctx is sent to addr, so that the hedged request
+// can be sent to another instance
+func Tried(ctx context.Context, addr string) bool {
+	t, ok := ctx.Value(triedKey{}).(*tried)
+	if !ok {
+		return false
+	}
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	_, ok = t.addrs[addr]
+	return ok
+}
+
+type methodKey struct{}
+
+// NewContext returns a copy of ctx marking the call as hedgeable, method identifies latencies of the call
+func NewContext(ctx context.Context, method string) context.Context {
+	return context.WithValue(ctx, methodKey{}, method)
+}
+
+// FromContext returns method stored by NewContext
+func FromContext(ctx context.Context) (string, bool) {
+	method, ok := ctx.Value(methodKey{}).(string)
+	return method, ok
+}
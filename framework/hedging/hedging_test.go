@@ -0,0 +1,139 @@
+package hedging
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDelay(t *testing.T) {
+	h := New(Config{Quantile: 0.95, Delay: 100 * time.Millisecond, BudgetPercent: 10})
+	require.Equal(t, 100*time.Millisecond, h.Delay("GetUser"))
+	for i := 1; i <= 100; i++ {
+		h.observe("GetUser", time.Duration(i)*time.Millisecond)
+	}
+	require.Equal(t, 95*time.Millisecond, h.Delay("GetUser"))
+	require.Equal(t, 100*time.Millisecond, h.Delay("ListUsers"))
+
+	// only the latest latencies count
+	for i := 0; i < windowSize; i++ {
+		h.observe("GetUser", time.Millisecond)
+	}
+	require.Equal(t, time.Millisecond, h.Delay("GetUser"))
+}
+
+func TestDoHedged(t *testing.T) {
+	h := New(Config{Quantile: 0.95, Delay: 10 * time.Millisecond, BudgetPercent: 10})
+	cancelled := make(chan struct{})
+	value, done, err := h.Do(context.Background(), "GetUser", func(ctx context.Context, attempt int) (interface{}, error) {
+		if attempt == 0 {
+			<-ctx.Done()
+			close(cancelled)
+			return nil, ctx.Err()
+		}
+		return "hedged", nil
+	}, nil)
+	require.NoError(t, err)
+	require.Equal(t, "hedged", value)
+	done()
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("loser is not cancelled")
+	}
+}
+
+func TestDoFast(t *testing.T) {
+	h := New(Config{Quantile: 0.95, Delay: time.Second, BudgetPercent: 10})
+	var attempts int32
+	value, done, err := h.Do(context.Background(), "GetUser", func(ctx context.Context, attempt int) (interface{}, error) {
+		atomic.AddInt32(&attempts, 1)
+		return "first", nil
+	}, nil)
+	require.NoError(t, err)
+	require.Equal(t, "first", value)
+	done()
+	require.EqualValues(t, 1, atomic.LoadInt32(&attempts))
+}
+
+func TestDoFailureNotHedged(t *testing.T) {
+	h := New(Config{Quantile: 0.95, Delay: 50 * time.Millisecond, BudgetPercent: 10})
+	var attempts int32
+	_, done, err := h.Do(context.Background(), "GetUser", func(ctx context.Context, attempt int) (interface{}, error) {
+		atomic.AddInt32(&attempts, 1)
+		return nil, errors.New("boom")
+	}, nil)
+	require.EqualError(t, err, "boom")
+	done()
+	time.Sleep(100 * time.Millisecond)
+	require.EqualValues(t, 1, atomic.LoadInt32(&attempts))
+}
+
+func TestDoReleaseLate(t *testing.T) {
+	h := New(Config{Quantile: 0.95, Delay: 10 * time.Millisecond, BudgetPercent: 10})
+	proceed := make(chan struct{})
+	released := make(chan interface{}, 1)
+	value, done, err := h.Do(context.Background(), "GetUser", func(ctx context.Context, attempt int) (interface{}, error) {
+		if attempt == 0 {
+			<-proceed
+			// ignores cancellation and succeeds too late
+			return "late", nil
+		}
+		close(proceed)
+		return "hedged", nil
+	}, func(v interface{}) {
+		released <- v
+	})
+	require.NoError(t, err)
+	require.Equal(t, "hedged", value)
+	done()
+	select {
+	case v := <-released:
+		require.Equal(t, "late", v)
+	case <-time.After(time.Second):
+		t.Fatal("late result is not released")
+	}
+}
+
+func TestDoBudget(t *testing.T) {
+	h := New(Config{Quantile: 0.95, Delay: time.Millisecond, BudgetPercent: 0})
+	var hedged int32
+	for i := 0; i < maxTokens+5; i++ {
+		_, done, err := h.Do(context.Background(), "GetUser", func(ctx context.Context, attempt int) (interface{}, error) {
+			if attempt > 0 {
+				atomic.AddInt32(&hedged, 1)
+				return nil, nil
+			}
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(20 * time.Millisecond):
+				return nil, nil
+			}
+		}, nil)
+		require.NoError(t, err)
+		done()
+	}
+	require.EqualValues(t, maxTokens, atomic.LoadInt32(&hedged))
+}
+
+func TestTried(t *testing.T) {
+	MarkTried(context.Background(), "10.0.0.1:6060")
+	require.False(t, Tried(context.Background(), "10.0.0.1:6060"))
+
+	ctx := withTried(context.Background())
+	MarkTried(ctx, "10.0.0.1:6060")
+	require.True(t, Tried(ctx, "10.0.0.1:6060"))
+	require.False(t, Tried(ctx, "10.0.0.2:6060"))
+	require.True(t, Tried(withTried(ctx), "10.0.0.1:6060"))
+
+	method, ok := FromContext(NewContext(context.Background(), "UserSvc.GetUser"))
+	require.True(t, ok)
+	require.Equal(t, "UserSvc.GetUser", method)
+	_, ok = FromContext(context.Background())
+	require.False(t, ok)
+}
@@ -123,6 +123,11 @@ const (
 	GddLogDiscard   envVariable = "GDD_LOG_DISCARD"
 	// GddGraceTimeout sets graceful shutdown timeout
 	GddGraceTimeout envVariable = "GDD_GRACE_TIMEOUT"
+	// GddShutdownDelay sets time waited after deregistering from service discovery before draining servers, so that
+	// clients and load balancers stop sending requests, e.g. 5s on kubernetes
+	GddShutdownDelay envVariable = "GDD_SHUTDOWN_DELAY"
+	// GddShutdownHookTimeout sets timeout of each OnStop hook of lifecycle manager unless set by the hook
+	GddShutdownHookTimeout envVariable = "GDD_SHUTDOWN_HOOK_TIMEOUT"
 	// GddWriteTimeout sets http connection write timeout
 	GddWriteTimeout envVariable = "GDD_WRITE_TIMEOUT"
 	// GddReadTimeout sets http connection read timeout
@@ -135,12 +140,54 @@ const (
 	GddServiceName    envVariable = "GDD_SERVICE_NAME"
 	GddServiceGroup   envVariable = "GDD_SERVICE_GROUP"
 	GddServiceVersion envVariable = "GDD_SERVICE_VERSION"
+	// GddServiceZone sets zone or availability zone the service instance is deployed in, published as metadata to registries
+	GddServiceZone envVariable = "GDD_SERVICE_ZONE"
+	// GddRouteRules sets json encoded routing rules keyed by service name for selecting instances of services
+	// by version, labels, zone and canary release, e.g. {"usersvc_rest":{"version":"v2","zoneAware":true}}
+	GddRouteRules envVariable = "GDD_ROUTE_RULES"
+	// GddGatewayEnable if true, http server forwards requests not matching its own routes by routes in GddGatewayRoutes
+	GddGatewayEnable envVariable = "GDD_GATEWAY_ENABLE"
+	// GddGatewayRoutes sets json encoded routes of api gateway, e.g. [{"path":"/api/users/","service":"usersvc_rest","stripPrefix":true}]
+	GddGatewayRoutes envVariable = "GDD_GATEWAY_ROUTES"
+	// GddOutlierDetectionEnable if true, instances failing consecutively or at high error rate are ejected from load
+	// balancing of service clients for a while
+	GddOutlierDetectionEnable envVariable = "GDD_OUTLIER_DETECTION_ENABLE"
+	// GddOutlierConsecutiveErrors sets number of consecutive failures ejecting an instance, 0 disables the check
+	GddOutlierConsecutiveErrors envVariable = "GDD_OUTLIER_CONSECUTIVE_ERRORS"
+	// GddOutlierErrorRate sets failure rate in GddOutlierInterval ejecting an instance, 0 disables the check
+	GddOutlierErrorRate envVariable = "GDD_OUTLIER_ERROR_RATE"
+	// GddOutlierMinRequests sets minimum requests in GddOutlierInterval for checking failure rate
+	GddOutlierMinRequests envVariable = "GDD_OUTLIER_MIN_REQUESTS"
+	// GddOutlierInterval sets time window of failure rate
+	GddOutlierInterval envVariable = "GDD_OUTLIER_INTERVAL"
+	// GddOutlierBaseEjectionTime sets ejection time of an instance, which doubles each time it is ejected again
+	GddOutlierBaseEjectionTime envVariable = "GDD_OUTLIER_BASE_EJECTION_TIME"
+	// GddOutlierMaxEjectionTime sets upper limit of ejection time
+	GddOutlierMaxEjectionTime envVariable = "GDD_OUTLIER_MAX_EJECTION_TIME"
+	// GddOutlierMaxEjectionPercent sets upper limit of percentage of instances of a service ejected at the same time
+	GddOutlierMaxEjectionPercent envVariable = "GDD_OUTLIER_MAX_EJECTION_PERCENT"
+	// GddClientTimeout sets request timeout of rest clients created by restclient.NewClient
+	GddClientTimeout envVariable = "GDD_CLIENT_TIMEOUT"
+	// GddHedgingQuantile sets quantile of latencies of a hedged method after which a second request is sent
+	GddHedgingQuantile envVariable = "GDD_HEDGING_QUANTILE"
+	// GddHedgingDelay sets time after which a second request is sent until enough latencies are observed
+	GddHedgingDelay envVariable = "GDD_HEDGING_DELAY"
+	// GddHedgingBudgetPercent limits hedged requests to the percentage of all requests of hedged methods
+	GddHedgingBudgetPercent envVariable = "GDD_HEDGING_BUDGET_PERCENT"
 	// GddHost sets bind host for http server
 	GddHost envVariable = "GDD_HOST"
 	// GddPort sets bind port for http server
 	GddPort envVariable = "GDD_PORT"
 	// GddGrpcPort sets bind port for grpc server
 	GddGrpcPort envVariable = "GDD_GRPC_PORT"
+	// GddGrpcHttpMode sets how grpc server serves management routes and http routes added to it.
+	// mux shares grpc port by dispatching on content-type, port listens on GddPort, and empty disables http serving
+	GddGrpcHttpMode envVariable = "GDD_GRPC_HTTP_MODE"
+	// GddGrpcWebEnable if true, grpc services are also served over gRPC-Web and Connect protocols for browser clients
+	// on the http server configured by GddGrpcHttpMode
+	GddGrpcWebEnable envVariable = "GDD_GRPC_WEB_ENABLE"
+	// GddGrpcWebAllowedOrigins sets comma separated origins allowed to call grpc services by CORS, none by default
+	GddGrpcWebAllowedOrigins envVariable = "GDD_GRPC_WEB_ALLOWED_ORIGINS"
 	// GddManage if true, it will add built-in apis with /go-doudou path prefix for online api document and service status monitor etc.
 	GddManage envVariable = "GDD_MANAGE_ENABLE"
 	// GddManageUser manage api endpoint http basic auth user
@@ -161,7 +208,21 @@ const (
 	GddRetryCount         envVariable = "GDD_RETRY_COUNT"
 	GddTracingMetricsRoot envVariable = "GDD_TRACING_METRICS_ROOT"
 
+	// GddServiceDiscoveryMode sets comma separated service discovery modes: nacos, etcd, zk, memberlist,
+	// or registry-less mesh and dns, in which services are called by dns names like http://<service>.<namespace>
 	GddServiceDiscoveryMode envVariable = "GDD_SERVICE_DISCOVERY_MODE"
+	// GddMeshNamespace sets namespace appended to service names in mesh and dns modes, services in the same
+	// namespace are resolved by dns search domains if empty
+	GddMeshNamespace envVariable = "GDD_MESH_NAMESPACE"
+	// GddMeshDomain sets domain appended to namespace in mesh and dns modes, e.g. svc.cluster.local
+	GddMeshDomain envVariable = "GDD_MESH_DOMAIN"
+	// GddMeshPort sets port of services in mesh and dns modes, 80 or 443 by scheme if 0
+	GddMeshPort envVariable = "GDD_MESH_PORT"
+	// GddMeshSidecar makes services wait for sidecar readiness before registration and serving, istio, linkerd
+	// or url of the readiness endpoint of sidecar
+	GddMeshSidecar envVariable = "GDD_MESH_SIDECAR"
+	// GddMeshSidecarTimeout sets how long to wait for sidecar readiness
+	GddMeshSidecarTimeout envVariable = "GDD_MESH_SIDECAR_TIMEOUT"
 
 	GddNacosNamespaceId         envVariable = "GDD_NACOS_NAMESPACE_ID"
 	GddNacosTimeoutMs           envVariable = "GDD_NACOS_TIMEOUT_MS"
@@ -250,6 +311,30 @@ const (
 	// GddMemCIDRsAllowed If not set, allow any connection (default), otherwise specify all networks
 	// allowed connecting (you must specify IPv6/IPv4 separately)
 	GddMemCIDRsAllowed envVariable = "GDD_MEM_CIDRS_ALLOWED"
+	// GddMemSecretKeys sets comma separated base64 encoded gossip encryption keys of 16, 24 or 32 bytes,
+	// the first one is primary key used for encrypting messages. If not set, gossip is not encrypted
+	GddMemSecretKeys envVariable = "GDD_MEM_SECRET_KEYS"
+	// GddMemKeyringFile sets path of json file holding base64 encoded gossip encryption keys, the first one is primary key.
+	// Keys in the file take precedence over GddMemSecretKeys, and the file is rewritten each time keys are rotated
+	GddMemKeyringFile envVariable = "GDD_MEM_KEYRING_FILE"
+	// GddMemClusterName sets cluster name, nodes of different cluster name cannot join each other
+	GddMemClusterName envVariable = "GDD_MEM_CLUSTER_NAME"
+	// GddMemSeedDNS sets comma separated dns names resolved to seeds, names starting with underscore are looked up
+	// as SRV records, e.g. _memberlist._tcp.seed-svc-headless.default.svc.cluster.local, others are looked up as
+	// A or AAAA records, e.g. seed-svc-headless.default.svc.cluster.local:7946
+	GddMemSeedDNS envVariable = "GDD_MEM_SEED_DNS"
+	// GddMemSeedFile sets path of file holding seeds, one or comma separated addresses per line
+	GddMemSeedFile envVariable = "GDD_MEM_SEED_FILE"
+	// GddMemSeedK8sSelector sets label selector of kubernetes pods as seeds, e.g. app=usersvc
+	GddMemSeedK8sSelector envVariable = "GDD_MEM_SEED_K8S_SELECTOR"
+	// GddMemSeedK8sNamespace sets namespace of kubernetes pods as seeds, namespace of the pod itself is used if not set
+	GddMemSeedK8sNamespace envVariable = "GDD_MEM_SEED_K8S_NAMESPACE"
+	// GddMemRejoinInterval sets interval of checking member count and rejoining cluster from seeds if less than
+	// GddMemRejoinMinMembers, interval doubles on each failure up to 10 times of it. 0 disables rejoining
+	GddMemRejoinInterval envVariable = "GDD_MEM_REJOIN_INTERVAL"
+	// GddMemRejoinMinMembers sets the member count including local node below which cluster is considered partitioned.
+	// 0 disables rejoining. Node registration panics if it fails to join cluster at startup unless rejoining is enabled
+	GddMemRejoinMinMembers envVariable = "GDD_MEM_REJOIN_MIN_MEMBERS"
 
 	GddDBDisableAutoConfigure envVariable = "GDD_DB_DISABLEAUTOCONFIGURE"
 	GddDBDriver               envVariable = "GDD_DB_DRIVER"
@@ -279,6 +364,41 @@ const (
 	GddDBPostgresPreferSimpleProtocol envVariable = "GDD_DB_POSTGRES_PREFERSIMPLEPROTOCOL"
 	GddDBPostgresWithoutReturning     envVariable = "GDD_DB_POSTGRES_WITHOUTRETURNING"
 
+	// GddDBGovernanceEnable enables audit columns and optimistic lock for models declaring the columns
+	GddDBGovernanceEnable    envVariable = "GDD_DB_GOVERNANCE_ENABLE"
+	GddDBGovernanceCreatedBy envVariable = "GDD_DB_GOVERNANCE_CREATEDBY"
+	GddDBGovernanceUpdatedBy envVariable = "GDD_DB_GOVERNANCE_UPDATEDBY"
+	GddDBGovernanceVersion   envVariable = "GDD_DB_GOVERNANCE_VERSION"
+
+	// GddDBTenantStrategy is one of shared_table, schema and database, multi-tenancy is disabled if empty
+	GddDBTenantStrategy envVariable = "GDD_DB_TENANT_STRATEGY"
+	// GddDBTenantColumn is tenant id column for shared_table strategy
+	GddDBTenantColumn envVariable = "GDD_DB_TENANT_COLUMN"
+	// GddDBTenantSchemaPattern is fmt pattern building schema name from tenant id for schema strategy
+	GddDBTenantSchemaPattern envVariable = "GDD_DB_TENANT_SCHEMA_PATTERN"
+
+	// GddTlsCert is certificate file for rest and grpc server, tls is disabled if empty
+	GddTlsCert envVariable = "GDD_TLS_CERT"
+	GddTlsKey  envVariable = "GDD_TLS_KEY"
+	// GddTlsClientCA is CA bundle verifying client certificates
+	GddTlsClientCA envVariable = "GDD_TLS_CLIENT_CA"
+	// GddTlsClientAuth accepts none, request, require, verify_if_given and require_and_verify.
+	// If empty, require_and_verify is used when GddTlsClientCA is set, otherwise none
+	GddTlsClientAuth envVariable = "GDD_TLS_CLIENT_AUTH"
+	// GddTlsMinVersion accepts 1.0, 1.1, 1.2 and 1.3
+	GddTlsMinVersion envVariable = "GDD_TLS_MIN_VERSION"
+	// GddTlsReloadInterval sets how often certificate files are checked for changes
+	GddTlsReloadInterval envVariable = "GDD_TLS_RELOAD_INTERVAL"
+	// GddTlsClientEnable enables tls for rest and grpc clients
+	GddTlsClientEnable envVariable = "GDD_TLS_CLIENT_ENABLE"
+	// GddTlsClientCert is certificate file presented by clients to servers requiring mTLS
+	GddTlsClientCert envVariable = "GDD_TLS_CLIENT_CERT"
+	GddTlsClientKey  envVariable = "GDD_TLS_CLIENT_KEY"
+	// GddTlsRootCA is CA bundle verifying server certificates, system roots are used if empty
+	GddTlsRootCA             envVariable = "GDD_TLS_ROOT_CA"
+	GddTlsServerName         envVariable = "GDD_TLS_SERVER_NAME"
+	GddTlsInsecureSkipVerify envVariable = "GDD_TLS_INSECURE_SKIP_VERIFY"
+
 	GddZkServers          envVariable = "GDD_ZK_SERVERS"
 	GddZkSequence         envVariable = "GDD_ZK_SEQUENCE"
 	GddZkDirectoryPattern envVariable = "GDD_ZK_DIRECTORY_PATTERN"
@@ -9,32 +9,58 @@ const FrameworkName = "go-doudou"
 
 const (
 	// Default configs for framework component
-	DefaultGddBanner             = true
-	DefaultGddBannerText         = FrameworkName
-	DefaultGddLogLevel           = "info"
-	DefaultGddLogFormat          = "text"
-	DefaultGddLogReqEnable       = false
-	DefaultGddLogCaller          = true
-	DefaultGddLogDiscard         = false
-	DefaultGddGraceTimeout       = "15s"
-	DefaultGddWriteTimeout       = "15s"
-	DefaultGddReadTimeout        = "15s"
-	DefaultGddIdleTimeout        = "60s"
-	DefaultGddServiceName        = ""
-	DefaultGddServiceGroup       = ""
-	DefaultGddServiceVersion     = ""
-	DefaultGddRouteRootPath      = ""
-	DefaultGddHost               = ""
-	DefaultGddPort               = 6060
-	DefaultGddGrpcPort           = 50051
-	DefaultGddRetryCount         = 0
-	DefaultGddManage             = true
-	DefaultGddManageUser         = "admin"
-	DefaultGddManagePass         = "admin"
-	DefaultGddTracingMetricsRoot = "tracing"
-	DefaultGddWeight             = 1
+	DefaultGddBanner                    = true
+	DefaultGddBannerText                = FrameworkName
+	DefaultGddLogLevel                  = "info"
+	DefaultGddLogFormat                 = "text"
+	DefaultGddLogReqEnable              = false
+	DefaultGddLogCaller                 = true
+	DefaultGddLogDiscard                = false
+	DefaultGddGraceTimeout              = "15s"
+	DefaultGddShutdownDelay             = "0s"
+	DefaultGddShutdownHookTimeout       = "5s"
+	DefaultGddWriteTimeout              = "15s"
+	DefaultGddReadTimeout               = "15s"
+	DefaultGddIdleTimeout               = "60s"
+	DefaultGddServiceName               = ""
+	DefaultGddServiceGroup              = ""
+	DefaultGddServiceVersion            = ""
+	DefaultGddServiceZone               = ""
+	DefaultGddRouteRules                = ""
+	DefaultGddGatewayEnable             = false
+	DefaultGddGatewayRoutes             = ""
+	DefaultGddOutlierDetectionEnable    = false
+	DefaultGddOutlierConsecutiveErrors  = 5
+	DefaultGddOutlierErrorRate          = 0.5
+	DefaultGddOutlierMinRequests        = 10
+	DefaultGddOutlierInterval           = "10s"
+	DefaultGddOutlierBaseEjectionTime   = "30s"
+	DefaultGddOutlierMaxEjectionTime    = "300s"
+	DefaultGddOutlierMaxEjectionPercent = 50
+	DefaultGddClientTimeout             = "1m"
+	DefaultGddHedgingQuantile           = 0.95
+	DefaultGddHedgingDelay              = "100ms"
+	DefaultGddHedgingBudgetPercent      = 10
+	DefaultGddRouteRootPath             = ""
+	DefaultGddHost                      = ""
+	DefaultGddPort                      = 6060
+	DefaultGddGrpcPort                  = 50051
+	DefaultGddGrpcHttpMode              = ""
+	DefaultGddGrpcWebEnable             = false
+	DefaultGddGrpcWebAllowedOrigins     = ""
+	DefaultGddRetryCount                = 0
+	DefaultGddManage                    = true
+	DefaultGddManageUser                = "admin"
+	DefaultGddManagePass                = "admin"
+	DefaultGddTracingMetricsRoot        = "tracing"
+	DefaultGddWeight                    = 1
 
 	DefaultGddServiceDiscoveryMode = ""
+	DefaultGddMeshNamespace        = ""
+	DefaultGddMeshDomain           = ""
+	DefaultGddMeshPort             = 0
+	DefaultGddMeshSidecar          = ""
+	DefaultGddMeshSidecarTimeout   = "60s"
 
 	DefaultGddNacosNamespaceId         = "public"
 	DefaultGddNacosTimeoutMs           = 10000
@@ -77,25 +103,34 @@ const (
 	DefaultGddEtcdLease     int64 = 5
 
 	// Default configs for memberlist component
-	DefaultGddMemSeed           = ""
-	DefaultGddMemPort           = 7946
-	DefaultGddMemDeadTimeout    = "60s"
-	DefaultGddMemSyncInterval   = "60s"
-	DefaultGddMemReclaimTimeout = "3s"
-	DefaultGddMemProbeInterval  = "5s"
-	DefaultGddMemProbeTimeout   = "3s"
-	DefaultGddMemSuspicionMult  = 6
-	DefaultGddMemRetransmitMult = 4
-	DefaultGddMemGossipNodes    = 4
-	DefaultGddMemGossipInterval = "500ms"
-	DefaultGddMemTCPTimeout     = "30s"
-	DefaultGddMemIndirectChecks = 3
-	DefaultGddMemWeight         = 1
-	DefaultGddMemWeightInterval = 0
-	DefaultGddMemName           = ""
-	DefaultGddMemHost           = ""
-	DefaultGddMemCIDRsAllowed   = ""
-	DefaultGddMemLogDisable     = false
+	DefaultGddMemSeed             = ""
+	DefaultGddMemPort             = 7946
+	DefaultGddMemDeadTimeout      = "60s"
+	DefaultGddMemSyncInterval     = "60s"
+	DefaultGddMemReclaimTimeout   = "3s"
+	DefaultGddMemProbeInterval    = "5s"
+	DefaultGddMemProbeTimeout     = "3s"
+	DefaultGddMemSuspicionMult    = 6
+	DefaultGddMemRetransmitMult   = 4
+	DefaultGddMemGossipNodes      = 4
+	DefaultGddMemGossipInterval   = "500ms"
+	DefaultGddMemTCPTimeout       = "30s"
+	DefaultGddMemIndirectChecks   = 3
+	DefaultGddMemWeight           = 1
+	DefaultGddMemWeightInterval   = 0
+	DefaultGddMemName             = ""
+	DefaultGddMemHost             = ""
+	DefaultGddMemCIDRsAllowed     = ""
+	DefaultGddMemSecretKeys       = ""
+	DefaultGddMemKeyringFile      = ""
+	DefaultGddMemClusterName      = ""
+	DefaultGddMemSeedDNS          = ""
+	DefaultGddMemSeedFile         = ""
+	DefaultGddMemSeedK8sSelector  = ""
+	DefaultGddMemSeedK8sNamespace = ""
+	DefaultGddMemRejoinInterval   = "30s"
+	DefaultGddMemRejoinMinMembers = 0
+	DefaultGddMemLogDisable       = false
 
 	DefaultGddDBDisableAutoConfigure = false
 	DefaultGddDBDriver               = ""
@@ -125,6 +160,28 @@ const (
 	DefaultGddDBPostgresPreferSimpleProtocol = false
 	DefaultGddDBPostgresWithoutReturning     = false
 
+	DefaultGddDBGovernanceEnable    = false
+	DefaultGddDBGovernanceCreatedBy = "created_by"
+	DefaultGddDBGovernanceUpdatedBy = "updated_by"
+	DefaultGddDBGovernanceVersion   = "version"
+
+	DefaultGddDBTenantStrategy      = ""
+	DefaultGddDBTenantColumn        = "tenant_id"
+	DefaultGddDBTenantSchemaPattern = "%s"
+
+	DefaultGddTlsCert               = ""
+	DefaultGddTlsKey                = ""
+	DefaultGddTlsClientCA           = ""
+	DefaultGddTlsClientAuth         = ""
+	DefaultGddTlsMinVersion         = "1.2"
+	DefaultGddTlsReloadInterval     = "10s"
+	DefaultGddTlsClientEnable       = false
+	DefaultGddTlsClientCert         = ""
+	DefaultGddTlsClientKey          = ""
+	DefaultGddTlsRootCA             = ""
+	DefaultGddTlsServerName         = ""
+	DefaultGddTlsInsecureSkipVerify = false
+
 	DefaultGddZkServers          = ""
 	DefaultGddZkSequence         = false
 	DefaultGddZkDirectoryPattern = "/registry/%s/providers"
@@ -0,0 +1,317 @@
+// Package lifecycle orchestrates startup and graceful shutdown of a service. Components register OnStart and OnStop
+// hooks with priorities, and servers run the shutdown sequence on SIGINT or SIGTERM: deregister from service
+// discovery, wait GDD_SHUTDOWN_DELAY for clients to notice, drain http and grpc servers in parallel within
+// GDD_GRACE_TIMEOUT, then stop hooks one by one, each within its own timeout, reporting hooks that didn't finish.
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/unionj-cloud/go-doudou/v2/framework/internal/config"
+	logger "github.com/unionj-cloud/go-doudou/v2/toolkit/zlogger"
+)
+
+const (
+	// PriorityTracing is priority of tracers, which are stopped after everything else to flush their spans
+	PriorityTracing = -200
+	// PriorityResource is priority of resources used by other components such as database pools and cache clients
+	PriorityResource = -100
+	// PriorityDefault is priority of user components
+	PriorityDefault = 0
+)
+
+// Hook is a pair of functions called on startup and shutdown, either may be nil
+type Hook struct {
+	Name string
+	// Priority orders hooks, OnStart runs in ascending and OnStop in descending priority, hooks of equal priority
+	// start in order of registration and stop in reverse order
+	Priority int
+	// Timeout of OnStop, GDD_SHUTDOWN_HOOK_TIMEOUT if zero
+	Timeout time.Duration
+	OnStart func(ctx context.Context) error
+	OnStop  func(ctx context.Context) error
+}
+
+// Closer returns Hook closing closer on shutdown
+func Closer(name string, priority int, closer io.Closer) Hook {
+	return Hook{
+		Name:     name,
+		Priority: priority,
+		OnStop: func(ctx context.Context) error {
+			return closer.Close()
+		},
+	}
+}
+
+// ErrStopped is returned by Start of a Manager already stopped, hooks run once per process
+var ErrStopped = errors.New("lifecycle manager is already stopped")
+
+// HookError is the error of a hook that failed or didn't finish in time
+type HookError struct {
+	Name string
+	Err  error
+}
+
+// ShutdownError reports hooks and servers that failed or didn't finish in time on shutdown
+type ShutdownError struct {
+	Errors []HookError
+}
+
+func (e *ShutdownError) Error() string {
+	var msgs []string
+	for _, item := range e.Errors {
+		msgs = append(msgs, fmt.Sprintf("%s: %s", item.Name, item.Err))
+	}
+	return "shutdown unfinished: " + strings.Join(msgs, "; ")
+}
+
+// Manager runs hooks in order of priority
+type Manager struct {
+	lock    sync.Mutex
+	hooks   []Hook
+	started []Hook
+	running bool
+	stopped bool
+}
+
+// New creates a Manager
+func New() *Manager {
+	return &Manager{}
+}
+
+var defaultManager = New()
+
+// Default returns the Manager servers run
+func Default() *Manager {
+	return defaultManager
+}
+
+// Append registers hook to the default Manager
+func Append(hook Hook) {
+	defaultManager.Append(hook)
+}
+
+// Start starts hooks of the default Manager
+func Start(ctx context.Context) error {
+	return defaultManager.Start(ctx)
+}
+
+// Shutdown runs shutdown sequence of the default Manager
+func Shutdown(deregister func(), servers ...Hook) error {
+	return defaultManager.Shutdown(deregister, servers...)
+}
+
+// Append registers hook, OnStart of hook is called at once if m is already started. Hooks appended after m is
+// stopped are logged and dropped, as they would never be stopped.
+func (m *Manager) Append(hook Hook) {
+	m.lock.Lock()
+	if m.stopped {
+		m.lock.Unlock()
+		logger.Error().Err(ErrStopped).Msgf("[go-doudou] failed to append %s", hook.Name)
+		return
+	}
+	if !m.running {
+		m.hooks = append(m.hooks, hook)
+		m.lock.Unlock()
+		return
+	}
+	m.lock.Unlock()
+	if hook.OnStart != nil {
+		if err := hook.OnStart(context.Background()); err != nil {
+			logger.Error().Err(err).Msgf("[go-doudou] failed to start %s", hook.Name)
+			return
+		}
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.started = append(m.started, hook)
+}
+
+// Start calls OnStart of hooks in ascending priority. If a hook fails, hooks already started are stopped and
+// the error is returned. Calling Start again is a no-op, ErrStopped is returned once m is stopped.
+func (m *Manager) Start(ctx context.Context) error {
+	m.lock.Lock()
+	if m.stopped {
+		m.lock.Unlock()
+		return ErrStopped
+	}
+	if m.running {
+		m.lock.Unlock()
+		return nil
+	}
+	m.running = true
+	hooks := m.hooks
+	m.hooks = nil
+	m.lock.Unlock()
+	sort.SliceStable(hooks, func(i, j int) bool {
+		return hooks[i].Priority < hooks[j].Priority
+	})
+	for _, hook := range hooks {
+		if hook.OnStart != nil {
+			if err := hook.OnStart(ctx); err != nil {
+				if stopErr := m.Stop(context.Background()); stopErr != nil {
+					logger.Error().Err(stopErr).Msg("[go-doudou] failed to stop started hooks")
+				}
+				return fmt.Errorf("start %s: %w", hook.Name, err)
+			}
+		}
+		m.lock.Lock()
+		m.started = append(m.started, hook)
+		m.lock.Unlock()
+	}
+	return nil
+}
+
+// Stop calls OnStop of started hooks in descending priority, each within its timeout. A hook timing out is
+// reported and left running, the next hook is stopped anyway. Hooks not started are skipped. Calling Stop again
+// is a no-op.
+func (m *Manager) Stop(ctx context.Context) error {
+	m.lock.Lock()
+	if m.stopped {
+		m.lock.Unlock()
+		return nil
+	}
+	m.stopped = true
+	m.running = false
+	hooks := make([]Hook, 0, len(m.started))
+	for i := len(m.started) - 1; i >= 0; i-- {
+		hooks = append(hooks, m.started[i])
+	}
+	m.started = nil
+	m.lock.Unlock()
+	sort.SliceStable(hooks, func(i, j int) bool {
+		return hooks[i].Priority > hooks[j].Priority
+	})
+	var errs []HookError
+	for _, hook := range hooks {
+		if hook.OnStop == nil {
+			continue
+		}
+		timeout := hook.Timeout
+		if timeout <= 0 {
+			timeout = hookTimeout()
+		}
+		if err := callWithTimeout(ctx, timeout, hook.OnStop); err != nil {
+			logger.Error().Err(err).Msgf("[go-doudou] failed to stop %s", hook.Name)
+			errs = append(errs, HookError{Name: hook.Name, Err: err})
+		}
+	}
+	if len(errs) > 0 {
+		return &ShutdownError{Errors: errs}
+	}
+	return nil
+}
+
+// Shutdown deregisters the service by deregister, waits GDD_SHUTDOWN_DELAY, calls OnStop of servers in parallel
+// within GDD_GRACE_TIMEOUT to drain them, then stops hooks. deregister may be nil. Hooks and servers that failed
+// or didn't finish in time are logged and returned as *ShutdownError.
+func (m *Manager) Shutdown(deregister func(), servers ...Hook) error {
+	if deregister != nil {
+		deregister()
+	}
+	if delay := parseDuration(string(config.GddShutdownDelay), config.GddShutdownDelay.Load(), config.DefaultGddShutdownDelay); delay > 0 {
+		logger.Info().Msgf("[go-doudou] waiting %s for deregistration to propagate", delay)
+		time.Sleep(delay)
+	}
+	grace := parseDuration(string(config.GddGraceTimeout), config.GddGraceTimeout.Load(), config.DefaultGddGraceTimeout)
+	logger.Info().Msgf("[go-doudou] servers are gracefully shutting down in %s", grace)
+	ctx, cancel := context.WithTimeout(context.Background(), grace)
+	defer cancel()
+	var (
+		wg   sync.WaitGroup
+		lock sync.Mutex
+		errs []HookError
+	)
+	for _, server := range servers {
+		if server.OnStop == nil {
+			continue
+		}
+		wg.Add(1)
+		go func(server Hook) {
+			defer wg.Done()
+			if err := callWithTimeout(ctx, grace, server.OnStop); err != nil {
+				logger.Error().Err(err).Msgf("[go-doudou] failed to drain %s", server.Name)
+				lock.Lock()
+				errs = append(errs, HookError{Name: server.Name, Err: err})
+				lock.Unlock()
+			}
+		}(server)
+	}
+	wg.Wait()
+	if err := m.Stop(context.Background()); err != nil {
+		errs = append(errs, err.(*ShutdownError).Errors...)
+	}
+	if len(errs) > 0 {
+		err := &ShutdownError{Errors: errs}
+		logger.Warn().Err(err).Msg("[go-doudou] shutdown finished with errors")
+		return err
+	}
+	logger.Info().Msg("[go-doudou] shutdown finished")
+	return nil
+}
+
+// WaitForSignal blocks until SIGINT or SIGTERM is received and returns it
+func WaitForSignal() os.Signal {
+	return Wait(context.Background())
+}
+
+// Wait blocks until SIGINT or SIGTERM is received or ctx is done, it returns the signal or nil if ctx is done
+func Wait(ctx context.Context) os.Signal {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(c)
+	select {
+	case sig := <-c:
+		return sig
+	case <-ctx.Done():
+		return nil
+	}
+}
+
+// callWithTimeout returns context.DeadlineExceeded if fn doesn't return within timeout, fn is left running
+func callWithTimeout(ctx context.Context, timeout time.Duration, fn func(ctx context.Context) error) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- fmt.Errorf("panic: %v", r)
+			}
+		}()
+		done <- fn(ctx)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func hookTimeout() time.Duration {
+	return parseDuration(string(config.GddShutdownHookTimeout), config.GddShutdownHookTimeout.Load(), config.DefaultGddShutdownHookTimeout)
+}
+
+func parseDuration(name, value, defaultValue string) time.Duration {
+	if value == "" {
+		value = defaultValue
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		logger.Debug().Msgf("Parse %s %s as time.Duration failed: %s, use default %s instead.\n", name,
+			value, err.Error(), defaultValue)
+		d, _ = time.ParseDuration(defaultValue)
+	}
+	return d
+}
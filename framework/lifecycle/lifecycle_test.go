@@ -0,0 +1,155 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type recorder struct {
+	lock   sync.Mutex
+	events []string
+}
+
+func (r *recorder) hook(name string, priority int) Hook {
+	return Hook{
+		Name:     name,
+		Priority: priority,
+		OnStart: func(ctx context.Context) error {
+			r.record("start " + name)
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			r.record("stop " + name)
+			return nil
+		},
+	}
+}
+
+func (r *recorder) record(event string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.events = append(r.events, event)
+}
+
+func TestOrder(t *testing.T) {
+	r := &recorder{}
+	m := New()
+	m.Append(r.hook("cache", PriorityResource))
+	m.Append(r.hook("worker", PriorityDefault))
+	m.Append(r.hook("tracer", PriorityTracing))
+	m.Append(r.hook("db", PriorityResource))
+	require.NoError(t, m.Start(context.Background()))
+	m.Append(r.hook("late", PriorityDefault))
+	require.NoError(t, m.Stop(context.Background()))
+	require.NoError(t, m.Stop(context.Background()))
+	require.Equal(t, []string{
+		"start tracer", "start cache", "start db", "start worker", "start late",
+		"stop late", "stop worker", "stop db", "stop cache", "stop tracer",
+	}, r.events)
+}
+
+func TestStopped(t *testing.T) {
+	r := &recorder{}
+	m := New()
+	m.Append(r.hook("db", PriorityResource))
+	require.NoError(t, m.Start(context.Background()))
+	require.NoError(t, m.Stop(context.Background()))
+
+	// a stopped manager is neither started again nor takes hooks
+	m.Append(r.hook("late", PriorityDefault))
+	require.ErrorIs(t, m.Start(context.Background()), ErrStopped)
+	require.NoError(t, m.Stop(context.Background()))
+	require.Equal(t, []string{"start db", "stop db"}, r.events)
+}
+
+func TestStartFailure(t *testing.T) {
+	r := &recorder{}
+	m := New()
+	m.Append(r.hook("db", PriorityResource))
+	m.Append(Hook{
+		Name: "broker",
+		OnStart: func(ctx context.Context) error {
+			return errors.New("connection refused")
+		},
+	})
+	m.Append(r.hook("worker", PriorityDefault))
+	err := m.Start(context.Background())
+	require.EqualError(t, err, "start broker: connection refused")
+	require.Equal(t, []string{"start db", "stop db"}, r.events)
+}
+
+func TestStopTimeout(t *testing.T) {
+	r := &recorder{}
+	m := New()
+	m.Append(r.hook("db", PriorityResource))
+	m.Append(Hook{
+		Name:    "stuck",
+		Timeout: 20 * time.Millisecond,
+		OnStop: func(ctx context.Context) error {
+			time.Sleep(time.Second)
+			return nil
+		},
+	})
+	m.Append(Hook{
+		Name: "panicky",
+		OnStop: func(ctx context.Context) error {
+			panic("boom")
+		},
+	})
+	require.NoError(t, m.Start(context.Background()))
+	start := time.Now()
+	err := m.Stop(context.Background())
+	require.Less(t, time.Since(start), 500*time.Millisecond)
+	var shutdownErr *ShutdownError
+	require.True(t, errors.As(err, &shutdownErr))
+	require.Len(t, shutdownErr.Errors, 2)
+	require.Equal(t, "panicky", shutdownErr.Errors[0].Name)
+	require.Equal(t, "stuck", shutdownErr.Errors[1].Name)
+	require.ErrorIs(t, shutdownErr.Errors[1].Err, context.DeadlineExceeded)
+	// hooks after the stuck one are stopped anyway
+	require.Equal(t, []string{"start db", "stop db"}, r.events)
+}
+
+func TestShutdown(t *testing.T) {
+	t.Setenv("GDD_SHUTDOWN_DELAY", "10ms")
+	t.Setenv("GDD_GRACE_TIMEOUT", "300ms")
+	r := &recorder{}
+	m := New()
+	m.Append(r.hook("db", PriorityResource))
+	require.NoError(t, m.Start(context.Background()))
+
+	inflight := make(chan struct{})
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		close(inflight)
+		time.Sleep(100 * time.Millisecond)
+		r.record("served")
+	}))
+	ts.Start()
+	go http.Get(ts.URL)
+	<-inflight
+
+	err := m.Shutdown(func() {
+		r.record("deregister")
+	}, Hook{
+		Name:   "http server",
+		OnStop: ts.Config.Shutdown,
+	}, Hook{
+		Name: "grpc server",
+		OnStop: func(ctx context.Context) error {
+			<-ctx.Done()
+			return ctx.Err()
+		},
+	})
+	var shutdownErr *ShutdownError
+	require.True(t, errors.As(err, &shutdownErr))
+	require.Len(t, shutdownErr.Errors, 1)
+	require.Equal(t, "grpc server", shutdownErr.Errors[0].Name)
+	require.Equal(t, []string{"start db", "deregister", "served", "stop db"}, r.events)
+}
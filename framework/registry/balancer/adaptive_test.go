@@ -0,0 +1,169 @@
+package balancer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/unionj-cloud/go-doudou/v2/framework/registry/interfaces"
+)
+
+func TestStartNoTracker(t *testing.T) {
+	done := Start(NewRoundRobin(), "10.0.0.1:6060")
+	done(nil)
+}
+
+func TestP2C(t *testing.T) {
+	b := NewP2C()
+	_, err := b.Pick(context.Background(), nil)
+	require.ErrorIs(t, err, ErrNoInstance)
+
+	// simulate a stuck backend holding many in-flight requests
+	var dones []func(error)
+	for i := 0; i < 10; i++ {
+		dones = append(dones, Start(b, "10.0.0.1:6060"))
+	}
+	counts := make(map[string]int)
+	for i := 0; i < 300; i++ {
+		instance, err := b.Pick(context.Background(), instances)
+		require.NoError(t, err)
+		counts[instance.Host]++
+	}
+	require.Zero(t, counts["10.0.0.1"])
+	require.Greater(t, counts["10.0.0.2"], 0)
+	require.Greater(t, counts["10.0.0.3"], 0)
+
+	for _, done := range dones {
+		done(nil)
+		// calling done more than once is harmless
+		done(nil)
+	}
+	counts = pickN(t, b, 300)
+	require.Len(t, counts, 3)
+}
+
+func TestEWMA(t *testing.T) {
+	b := NewEWMA(time.Second).(*ewma)
+	now := time.Now()
+	b.now = func() time.Time {
+		return now
+	}
+	// simulate backends with latency 100ms, 10ms and 10ms
+	latencies := map[string]time.Duration{
+		"10.0.0.1:6060": 100 * time.Millisecond,
+		"10.0.0.2:6060": 10 * time.Millisecond,
+		"10.0.0.3:6060": 10 * time.Millisecond,
+	}
+	counts := make(map[string]int)
+	for i := 0; i < 600; i++ {
+		instance, err := b.Pick(context.Background(), instances)
+		require.NoError(t, err)
+		counts[instance.Host]++
+		done := b.Start(instance.Addr())
+		now = now.Add(latencies[instance.Addr()])
+		done(nil)
+	}
+	require.Less(t, counts["10.0.0.1"], counts["10.0.0.2"])
+	require.Less(t, counts["10.0.0.1"], counts["10.0.0.3"])
+	require.Less(t, counts["10.0.0.1"], 100)
+}
+
+func TestEWMAPeakAndDecay(t *testing.T) {
+	b := NewEWMA(time.Second).(*ewma)
+	now := time.Now()
+	b.now = func() time.Time {
+		return now
+	}
+	observe := func(latency time.Duration) {
+		done := b.Start("10.0.0.1:6060")
+		now = now.Add(latency)
+		done(errors.New("mock error"))
+	}
+	observe(10 * time.Millisecond)
+	observe(time.Second)
+	stat := b.stat("10.0.0.1:6060")
+	require.Equal(t, float64(time.Second), stat.value)
+	now = now.Add(5 * time.Second)
+	observe(10 * time.Millisecond)
+	require.Less(t, stat.value, float64(100*time.Millisecond))
+	require.Zero(t, stat.inflight)
+}
+
+func TestPrune(t *testing.T) {
+	keys := func(stats *sync.Map) []string {
+		var result []string
+		stats.Range(func(key, _ interface{}) bool {
+			result = append(result, key.(string))
+			return true
+		})
+		return result
+	}
+	p2c := NewP2C().(*leastRequest)
+	ewma := NewEWMA(time.Second).(*ewma)
+	for _, b := range []Balancer{p2c, ewma} {
+		for _, instance := range instances {
+			Start(b, instance.Addr())(nil)
+		}
+		Prune(b, instances[1:])
+	}
+	require.ElementsMatch(t, []string{"10.0.0.1:6060", "10.0.0.2:6060"}, keys(&p2c.inflight))
+	require.ElementsMatch(t, []string{"10.0.0.1:6060", "10.0.0.2:6060"}, keys(&ewma.stats))
+	Prune(NewRoundRobin(), nil)
+}
+
+func TestConsistentHash(t *testing.T) {
+	b := NewConsistentHash(0)
+	_, err := b.Pick(context.Background(), nil)
+	require.ErrorIs(t, err, ErrNoInstance)
+
+	picked := make(map[string]string)
+	for i := 0; i < 100; i++ {
+		key := fmt.Sprintf("user-%d", i)
+		instance, err := b.Pick(WithHashKey(context.Background(), key), instances)
+		require.NoError(t, err)
+		again, err := b.Pick(WithHashKey(context.Background(), key), []interfaces.Instance{instances[2], instances[0], instances[1]})
+		require.NoError(t, err)
+		require.Equal(t, instance.Addr(), again.Addr())
+		picked[key] = instance.Addr()
+	}
+	// only keys of the removed instance move
+	remaining := []interfaces.Instance{instances[0], instances[2]}
+	for key, addr := range picked {
+		instance, err := b.Pick(WithHashKey(context.Background(), key), remaining)
+		require.NoError(t, err)
+		if addr != instances[1].Addr() {
+			require.Equal(t, addr, instance.Addr())
+		}
+	}
+
+	// picked in turn without key
+	require.Len(t, pickN(t, b, 3), 3)
+}
+
+func TestSubset(t *testing.T) {
+	var backends []interfaces.Instance
+	for i := 0; i < 12; i++ {
+		backends = append(backends, interfaces.Instance{Host: fmt.Sprintf("10.0.0.%d", i), Port: 6060})
+	}
+	require.Len(t, Subset(backends, 0, 0), 12)
+	require.Len(t, Subset(backends, 0, 20), 12)
+
+	counts := make(map[string]int)
+	for clientId := 0; clientId < 8; clientId++ {
+		subset := Subset(backends, clientId, 3)
+		require.Len(t, subset, 3)
+		require.Equal(t, subset, Subset(backends, clientId, 3))
+		for _, instance := range subset {
+			counts[instance.Addr()]++
+		}
+	}
+	// 8 clients of 4 subsets each cover all backends twice
+	require.Len(t, counts, 12)
+	for _, count := range counts {
+		require.Equal(t, 2, count)
+	}
+}
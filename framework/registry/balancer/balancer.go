@@ -0,0 +1,162 @@
+package balancer
+
+import (
+	"context"
+	"math/rand"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/unionj-cloud/go-doudou/v2/framework/registry/interfaces"
+)
+
+// ErrNoInstance is returned by balancers if there is no instance to pick
+var ErrNoInstance = errors.New("no available instance")
+
+// Balancer picks an instance from discovered instances of a service, it is independent of registries
+type Balancer interface {
+	Pick(ctx context.Context, instances []interfaces.Instance) (interfaces.Instance, error)
+}
+
+// BalancerFunc is an adapter to use ordinary functions as Balancer
+type BalancerFunc func(ctx context.Context, instances []interfaces.Instance) (interfaces.Instance, error)
+
+// Pick calls f(ctx, instances)
+func (f BalancerFunc) Pick(ctx context.Context, instances []interfaces.Instance) (interfaces.Instance, error) {
+	return f(ctx, instances)
+}
+
+// Tracker is implemented by balancers adapting to load of instances. Start is called right before sending
+// request to instance at addr, and done is called with error of the request once response is received.
+type Tracker interface {
+	Start(addr string) (done func(err error))
+}
+
+// Start tracks request to addr if b is a Tracker, the returned function must be called once request finishes
+func Start(b Balancer, addr string) (done func(err error)) {
+	if t, ok := b.(Tracker); ok {
+		return t.Start(addr)
+	}
+	return func(error) {}
+}
+
+// Pruner is implemented by balancers keeping stats of instances, Prune drops stats of instances not in
+// instances any more
+type Pruner interface {
+	Prune(instances []interfaces.Instance)
+}
+
+// Prune drops stats of instances gone if b is a Pruner, providers call it each time instances change
+func Prune(b Balancer, instances []interfaces.Instance) {
+	if p, ok := b.(Pruner); ok {
+		p.Prune(instances)
+	}
+}
+
+// pruneMap deletes keys of stats which are not addresses of instances
+func pruneMap(stats *sync.Map, instances []interfaces.Instance) {
+	addrs := make(map[string]struct{}, len(instances))
+	for _, instance := range instances {
+		addrs[instance.Addr()] = struct{}{}
+	}
+	stats.Range(func(key, _ interface{}) bool {
+		if _, ok := addrs[key.(string)]; !ok {
+			stats.Delete(key)
+		}
+		return true
+	})
+}
+
+// sorted returns a copy of instances sorted by address, so that picking in turn is stable while
+// registries return instances in arbitrary order
+func sorted(instances []interfaces.Instance) []interfaces.Instance {
+	ret := make([]interfaces.Instance, len(instances))
+	copy(ret, instances)
+	sort.SliceStable(ret, func(i, j int) bool {
+		return ret[i].Addr() < ret[j].Addr()
+	})
+	return ret
+}
+
+type roundRobin struct {
+	current uint64
+}
+
+func (r *roundRobin) Pick(_ context.Context, instances []interfaces.Instance) (interfaces.Instance, error) {
+	if len(instances) == 0 {
+		return interfaces.Instance{}, ErrNoInstance
+	}
+	instances = sorted(instances)
+	next := atomic.AddUint64(&r.current, 1) % uint64(len(instances))
+	return instances[next], nil
+}
+
+// NewRoundRobin returns a balancer picking instances in turn
+func NewRoundRobin() Balancer {
+	return &roundRobin{}
+}
+
+// smoothWeightedRoundRobin is nginx smooth weighted round-robin algo
+// https://github.com/nginx/nginx/commit/52327e0627f49dbda1e8db695e63a4b0af4448b1
+type smoothWeightedRoundRobin struct {
+	lock           sync.Mutex
+	currentWeights map[string]int
+}
+
+func (r *smoothWeightedRoundRobin) Pick(_ context.Context, instances []interfaces.Instance) (interfaces.Instance, error) {
+	if len(instances) == 0 {
+		return interfaces.Instance{}, ErrNoInstance
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	currentWeights := make(map[string]int, len(instances))
+	var selected *interfaces.Instance
+	total := 0
+	for i := range instances {
+		s := &instances[i]
+		weight := s.Weight
+		if weight <= 0 {
+			weight = 1
+		}
+		addr := s.Addr()
+		currentWeights[addr] = r.currentWeights[addr] + weight
+		total += weight
+		if selected == nil || currentWeights[addr] > currentWeights[selected.Addr()] {
+			selected = s
+		}
+	}
+	currentWeights[selected.Addr()] -= total
+	// instances gone are forgotten
+	r.currentWeights = currentWeights
+	return *selected, nil
+}
+
+// NewSmoothWeightedRoundRobin returns a balancer picking instances in turn by their weights
+func NewSmoothWeightedRoundRobin() Balancer {
+	return &smoothWeightedRoundRobin{
+		currentWeights: make(map[string]int),
+	}
+}
+
+type random struct {
+	lock sync.Mutex
+	rand *rand.Rand
+}
+
+func (r *random) Pick(_ context.Context, instances []interfaces.Instance) (interfaces.Instance, error) {
+	if len(instances) == 0 {
+		return interfaces.Instance{}, ErrNoInstance
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return instances[r.rand.Intn(len(instances))], nil
+}
+
+// NewRandom returns a balancer picking instances randomly
+func NewRandom() Balancer {
+	return &random{
+		rand: rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
@@ -0,0 +1,61 @@
+package balancer
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/unionj-cloud/go-doudou/v2/framework/registry/interfaces"
+)
+
+var instances = []interfaces.Instance{
+	{Host: "10.0.0.3", Port: 6060, Weight: 1},
+	{Host: "10.0.0.1", Port: 6060, Weight: 5},
+	{Host: "10.0.0.2", Port: 6060, Weight: 1},
+}
+
+func pickN(t *testing.T, b Balancer, n int) map[string]int {
+	counts := make(map[string]int)
+	for i := 0; i < n; i++ {
+		instance, err := b.Pick(context.Background(), instances)
+		require.NoError(t, err)
+		counts[instance.Host]++
+	}
+	return counts
+}
+
+func TestNoInstance(t *testing.T) {
+	for _, b := range []Balancer{NewRoundRobin(), NewSmoothWeightedRoundRobin(), NewRandom()} {
+		_, err := b.Pick(context.Background(), nil)
+		require.ErrorIs(t, err, ErrNoInstance)
+	}
+}
+
+func TestRoundRobin(t *testing.T) {
+	b := NewRoundRobin()
+	var hosts []string
+	for i := 0; i < 4; i++ {
+		instance, err := b.Pick(context.Background(), instances)
+		require.NoError(t, err)
+		hosts = append(hosts, instance.Host)
+	}
+	require.Equal(t, []string{"10.0.0.2", "10.0.0.3", "10.0.0.1", "10.0.0.2"}, hosts)
+}
+
+func TestSmoothWeightedRoundRobin(t *testing.T) {
+	b := NewSmoothWeightedRoundRobin()
+	var hosts []string
+	for i := 0; i < 7; i++ {
+		instance, err := b.Pick(context.Background(), instances)
+		require.NoError(t, err)
+		hosts = append(hosts, instance.Host)
+	}
+	// 5:1:1 interleaved rather than five in a row
+	require.Equal(t, []string{"10.0.0.1", "10.0.0.1", "10.0.0.3", "10.0.0.1", "10.0.0.2", "10.0.0.1", "10.0.0.1"}, hosts)
+	require.Equal(t, map[string]int{"10.0.0.1": 50, "10.0.0.2": 10, "10.0.0.3": 10}, pickN(t, b, 70))
+}
+
+func TestRandom(t *testing.T) {
+	counts := pickN(t, NewRandom(), 300)
+	require.Len(t, counts, 3)
+}
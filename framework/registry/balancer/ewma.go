@@ -0,0 +1,92 @@
+package balancer
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/unionj-cloud/go-doudou/v2/framework/registry/interfaces"
+)
+
+// DefaultEWMADecay is the default time window of latency average of NewEWMA
+const DefaultEWMADecay = 10 * time.Second
+
+// ewmaStat is peak EWMA of latency, it jumps to a higher latency at once and decays slowly to lower ones,
+// so that slow instances are avoided quickly
+type ewmaStat struct {
+	lock     sync.Mutex
+	value    float64
+	stamp    time.Time
+	inflight int64
+}
+
+type ewma struct {
+	*p2c
+	decay time.Duration
+	now   func() time.Time
+	stats sync.Map
+}
+
+func (e *ewma) stat(addr string) *ewmaStat {
+	v, _ := e.stats.LoadOrStore(addr, &ewmaStat{})
+	return v.(*ewmaStat)
+}
+
+func (e *ewma) cost(instance interfaces.Instance) float64 {
+	s := e.stat(instance.Addr())
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	// instances without latency yet cost nothing, so they are tried soon
+	return s.value * float64(s.inflight+1) / weightOf(instance)
+}
+
+func (e *ewma) Pick(_ context.Context, instances []interfaces.Instance) (interfaces.Instance, error) {
+	return e.pick(instances)
+}
+
+// Start tracks latency and in-flight requests of addr until done is called
+func (e *ewma) Start(addr string) (done func(err error)) {
+	s := e.stat(addr)
+	start := e.now()
+	s.lock.Lock()
+	s.inflight++
+	s.lock.Unlock()
+	var once sync.Once
+	return func(error) {
+		once.Do(func() {
+			now := e.now()
+			latency := float64(now.Sub(start))
+			s.lock.Lock()
+			defer s.lock.Unlock()
+			s.inflight--
+			if latency > s.value || s.stamp.IsZero() {
+				s.value = latency
+			} else {
+				w := math.Exp(-float64(now.Sub(s.stamp)) / float64(e.decay))
+				s.value = s.value*w + latency*(1-w)
+			}
+			s.stamp = now
+		})
+	}
+}
+
+// Prune drops latency stats of instances gone
+func (e *ewma) Prune(instances []interfaces.Instance) {
+	pruneMap(&e.stats, instances)
+}
+
+// NewEWMA returns a balancer picking the instance with lower peak EWMA latency multiplied by in-flight
+// requests relative to its weight out of two random ones, latency averages over time window decay,
+// DefaultEWMADecay is used if decay is not positive. Latency is tracked by Start.
+func NewEWMA(decay time.Duration) Balancer {
+	if decay <= 0 {
+		decay = DefaultEWMADecay
+	}
+	e := &ewma{
+		decay: decay,
+		now:   time.Now,
+	}
+	e.p2c = newP2C(e.cost)
+	return e
+}
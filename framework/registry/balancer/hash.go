@@ -0,0 +1,116 @@
+package balancer
+
+import (
+	"context"
+	"hash/crc32"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/unionj-cloud/go-doudou/v2/framework/registry/interfaces"
+)
+
+// DefaultReplicas is the default number of virtual nodes per instance of NewConsistentHash
+const DefaultReplicas = 100
+
+type hashKeyCtxKey struct{}
+
+// WithHashKey returns context carrying key for consistent hash balancer, e.g. user id for cache affinity
+func WithHashKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, hashKeyCtxKey{}, key)
+}
+
+// HashKeyFromContext returns key set by WithHashKey
+func HashKeyFromContext(ctx context.Context) (string, bool) {
+	if ctx == nil {
+		return "", false
+	}
+	key, ok := ctx.Value(hashKeyCtxKey{}).(string)
+	return key, ok
+}
+
+type hashRing struct {
+	hashes    []uint32
+	instances map[uint32]interfaces.Instance
+}
+
+func newHashRing(instances []interfaces.Instance, replicas int) *hashRing {
+	r := &hashRing{
+		instances: make(map[uint32]interfaces.Instance, len(instances)*replicas),
+	}
+	for _, instance := range instances {
+		// instances with higher weight own more of the ring
+		n := replicas * int(weightOf(instance))
+		for i := 0; i < n; i++ {
+			h := crc32.ChecksumIEEE([]byte(instance.Addr() + "#" + strconv.Itoa(i)))
+			if _, ok := r.instances[h]; ok {
+				continue
+			}
+			r.instances[h] = instance
+			r.hashes = append(r.hashes, h)
+		}
+	}
+	sort.Slice(r.hashes, func(i, j int) bool {
+		return r.hashes[i] < r.hashes[j]
+	})
+	return r
+}
+
+func (r *hashRing) get(key string) interfaces.Instance {
+	h := crc32.ChecksumIEEE([]byte(key))
+	i := sort.Search(len(r.hashes), func(i int) bool {
+		return r.hashes[i] >= h
+	})
+	if i == len(r.hashes) {
+		i = 0
+	}
+	return r.instances[r.hashes[i]]
+}
+
+type consistentHash struct {
+	replicas int
+	fallback Balancer
+	lock     sync.Mutex
+	ringKey  string
+	ring     *hashRing
+}
+
+func (c *consistentHash) Pick(ctx context.Context, instances []interfaces.Instance) (interfaces.Instance, error) {
+	if len(instances) == 0 {
+		return interfaces.Instance{}, ErrNoInstance
+	}
+	key, ok := HashKeyFromContext(ctx)
+	if !ok {
+		return c.fallback.Pick(ctx, instances)
+	}
+	instances = sorted(instances)
+	addrs := make([]string, 0, len(instances))
+	for _, instance := range instances {
+		addrs = append(addrs, instance.Addr()+"/"+strconv.Itoa(instance.Weight))
+	}
+	ringKey := strings.Join(addrs, ",")
+	c.lock.Lock()
+	// ring is rebuilt only when instances change
+	if c.ring == nil || c.ringKey != ringKey {
+		c.ring = newHashRing(instances, c.replicas)
+		c.ringKey = ringKey
+	}
+	ring := c.ring
+	c.lock.Unlock()
+	return ring.get(key), nil
+}
+
+// NewConsistentHash returns a balancer picking instance by consistent hashing of key set by WithHashKey,
+// so that requests of the same key go to the same instance and only keys of changed instances move.
+// Each instance has replicas virtual nodes multiplied by its weight, DefaultReplicas is used if replicas
+// is not positive. Requests without key are picked in turn.
+func NewConsistentHash(replicas int) Balancer {
+	if replicas <= 0 {
+		replicas = DefaultReplicas
+	}
+	return &consistentHash{
+		replicas: replicas,
+		fallback: NewRoundRobin(),
+	}
+}
@@ -0,0 +1,95 @@
+package balancer
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/unionj-cloud/go-doudou/v2/framework/registry/interfaces"
+)
+
+// p2c picks two instances randomly and chooses the one with lower cost, which avoids herding to the
+// single best instance as all clients would otherwise do
+type p2c struct {
+	lock sync.Mutex
+	rand *rand.Rand
+	cost func(instance interfaces.Instance) float64
+}
+
+func (p *p2c) pick(instances []interfaces.Instance) (interfaces.Instance, error) {
+	if len(instances) == 0 {
+		return interfaces.Instance{}, ErrNoInstance
+	}
+	if len(instances) == 1 {
+		return instances[0], nil
+	}
+	p.lock.Lock()
+	i := p.rand.Intn(len(instances))
+	j := p.rand.Intn(len(instances) - 1)
+	p.lock.Unlock()
+	if j >= i {
+		j++
+	}
+	a, b := instances[i], instances[j]
+	if p.cost(b) < p.cost(a) {
+		return b, nil
+	}
+	return a, nil
+}
+
+func newP2C(cost func(instance interfaces.Instance) float64) *p2c {
+	return &p2c{
+		rand: rand.New(rand.NewSource(time.Now().UnixNano())),
+		cost: cost,
+	}
+}
+
+func weightOf(instance interfaces.Instance) float64 {
+	if instance.Weight <= 0 {
+		return 1
+	}
+	return float64(instance.Weight)
+}
+
+type leastRequest struct {
+	*p2c
+	inflight sync.Map
+}
+
+func (l *leastRequest) counter(addr string) *int64 {
+	v, _ := l.inflight.LoadOrStore(addr, new(int64))
+	return v.(*int64)
+}
+
+func (l *leastRequest) Pick(_ context.Context, instances []interfaces.Instance) (interfaces.Instance, error) {
+	return l.pick(instances)
+}
+
+// Start increases in-flight requests of addr until done is called
+func (l *leastRequest) Start(addr string) (done func(err error)) {
+	counter := l.counter(addr)
+	atomic.AddInt64(counter, 1)
+	var once sync.Once
+	return func(error) {
+		once.Do(func() {
+			atomic.AddInt64(counter, -1)
+		})
+	}
+}
+
+// Prune drops in-flight counters of instances gone, requests still in flight to them are not affected
+func (l *leastRequest) Prune(instances []interfaces.Instance) {
+	pruneMap(&l.inflight, instances)
+}
+
+// NewP2C returns a balancer picking the instance with fewer in-flight requests relative to its weight
+// out of two random ones, in-flight requests are tracked by Start
+func NewP2C() Balancer {
+	l := &leastRequest{}
+	l.p2c = newP2C(func(instance interfaces.Instance) float64 {
+		return float64(atomic.LoadInt64(l.counter(instance.Addr()))) / weightOf(instance)
+	})
+	return l
+}
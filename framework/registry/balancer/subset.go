@@ -0,0 +1,28 @@
+package balancer
+
+import (
+	"github.com/unionj-cloud/go-doudou/v2/framework/registry/interfaces"
+	"github.com/unionj-cloud/go-doudou/v2/toolkit/loadbalance"
+)
+
+// Subset returns the deterministic subset of size instances for client of clientId, so that each client
+// only connects to a few instances of a large service while load still spreads evenly. All instances
+// are returned if size is not positive or not less than the number of instances.
+func Subset(instances []interfaces.Instance, clientId, size int) []interfaces.Instance {
+	if size <= 0 || size >= len(instances) {
+		return instances
+	}
+	instances = sorted(instances)
+	byAddr := make(map[string]interfaces.Instance, len(instances))
+	addrs := make([]string, 0, len(instances))
+	for _, instance := range instances {
+		byAddr[instance.Addr()] = instance
+		addrs = append(addrs, instance.Addr())
+	}
+	subset := loadbalance.Subset(addrs, clientId, size)
+	ret := make([]interfaces.Instance, 0, len(subset))
+	for _, addr := range subset {
+		ret = append(ret, byAddr[addr])
+	}
+	return ret
+}
@@ -5,6 +5,11 @@ const (
 	SD_ETCD       = "etcd"
 	SD_MEMBERLIST = "memberlist"
 	SD_ZK         = "zk"
+	// SD_MESH discovers nothing and registers nothing, services are called by dns names and sidecars of
+	// service mesh such as istio or linkerd take care of load balancing and retries
+	SD_MESH = "mesh"
+	// SD_DNS calls services by dns names like SD_MESH without sidecars, e.g. kubernetes services
+	SD_DNS = "dns"
 )
 
 type ServiceType string
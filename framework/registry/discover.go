@@ -0,0 +1,299 @@
+package registry
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/unionj-cloud/go-doudou/v2/framework/internal/config"
+	"github.com/unionj-cloud/go-doudou/v2/framework/registry/balancer"
+	"github.com/unionj-cloud/go-doudou/v2/framework/registry/constants"
+	"github.com/unionj-cloud/go-doudou/v2/framework/registry/etcd"
+	"github.com/unionj-cloud/go-doudou/v2/framework/registry/interfaces"
+	"github.com/unionj-cloud/go-doudou/v2/framework/registry/memberlist"
+	"github.com/unionj-cloud/go-doudou/v2/framework/registry/mesh"
+	"github.com/unionj-cloud/go-doudou/v2/framework/registry/nacos"
+	"github.com/unionj-cloud/go-doudou/v2/framework/registry/outlier"
+	"github.com/unionj-cloud/go-doudou/v2/framework/registry/router"
+	"github.com/unionj-cloud/go-doudou/v2/framework/registry/zk"
+	logger "github.com/unionj-cloud/go-doudou/v2/toolkit/zlogger"
+	"google.golang.org/grpc"
+)
+
+type discoveryConfig struct {
+	mode        string
+	modeSet     bool
+	lb          string
+	group       string
+	version     string
+	clusters    []string
+	balancer    balancer.Balancer
+	clientId    int
+	subsetSize  int
+	detector    *outlier.Detector
+	dialOptions []grpc.DialOption
+}
+
+// DiscoveryOption configures Discover and NewGrpcClientConn
+type DiscoveryOption func(*discoveryConfig)
+
+// WithDiscoveryMode only discovers instances from the registry of mode, one of constants.SD_NACOS, constants.SD_ETCD,
+// constants.SD_ZK and constants.SD_MEMBERLIST
+func WithDiscoveryMode(mode string) DiscoveryOption {
+	return func(c *discoveryConfig) {
+		c.mode = mode
+		c.modeSet = true
+	}
+}
+
+// WithGroup sets group of service, for nacos and zk only
+func WithGroup(group string) DiscoveryOption {
+	return func(c *discoveryConfig) {
+		c.group = group
+	}
+}
+
+// WithClusters sets clusters of service, for nacos only
+func WithClusters(clusters ...string) DiscoveryOption {
+	return func(c *discoveryConfig) {
+		c.clusters = clusters
+	}
+}
+
+// WithVersion sets version of service, for zk only
+func WithVersion(version string) DiscoveryOption {
+	return func(c *discoveryConfig) {
+		c.version = version
+	}
+}
+
+// WithBalancer sets balancer picking instance for Discover, round-robin by default
+func WithBalancer(b balancer.Balancer) DiscoveryOption {
+	return func(c *discoveryConfig) {
+		c.balancer = b
+	}
+}
+
+// WithSubset only keeps the deterministic subset of size instances for client of clientId, for both picking
+// and connecting by grpc clients. Clients of a service should have distinct consecutive ids from 0 for even spread.
+func WithSubset(clientId, size int) DiscoveryOption {
+	return func(c *discoveryConfig) {
+		c.clientId = clientId
+		c.subsetSize = size
+	}
+}
+
+// WithOutlierDetection ejects failing instances by d for Discover, outlier.Default() is used if
+// GDD_OUTLIER_DETECTION_ENABLE is true. Results of requests must be reported, e.g. by restclient.TrackLoad.
+func WithOutlierDetection(d *outlier.Detector) DiscoveryOption {
+	return func(c *discoveryConfig) {
+		c.detector = d
+	}
+}
+
+type watchFunc func(service string, conf discoveryConfig, fn func([]interfaces.Instance)) (stop func())
+
+var instanceWatchers = map[string]watchFunc{
+	constants.SD_ETCD: func(service string, conf discoveryConfig, fn func([]interfaces.Instance)) (stop func()) {
+		return etcd.WatchInstances(service, fn)
+	},
+	constants.SD_NACOS: func(service string, conf discoveryConfig, fn func([]interfaces.Instance)) (stop func()) {
+		return nacos.WatchInstances(service, fn, nacos.WithNacosClusters(conf.clusters), nacos.WithNacosGroupName(conf.group))
+	},
+	constants.SD_ZK: func(service string, conf discoveryConfig, fn func([]interfaces.Instance)) (stop func()) {
+		return zk.WatchInstances(zk.ServiceConfig{
+			Name:    service,
+			Group:   conf.group,
+			Version: conf.version,
+		}, fn)
+	},
+	constants.SD_MEMBERLIST: func(service string, conf discoveryConfig, fn func([]interfaces.Instance)) (stop func()) {
+		return memberlist.WatchInstances(service, fn)
+	},
+	constants.SD_MESH: func(service string, conf discoveryConfig, fn func([]interfaces.Instance)) (stop func()) {
+		return mesh.WatchInstances(service, fn)
+	},
+	constants.SD_DNS: func(service string, conf discoveryConfig, fn func([]interfaces.Instance)) (stop func()) {
+		return mesh.WatchInstances(service, fn)
+	},
+}
+
+var _ IDiscoveryProvider = (*discoveryProvider)(nil)
+var _ balancer.Tracker = (*discoveryProvider)(nil)
+
+type discoveryProvider struct {
+	service     string
+	balancer    balancer.Balancer
+	clientId    int
+	subsetSize  int
+	lock        sync.RWMutex
+	modes       []string
+	snapshots   map[string][]interfaces.Instance
+	instances   []interfaces.Instance
+	subscribers map[int]*subscriber
+	seq         int
+	version     int
+	stops       []func()
+}
+
+// subscriber skips snapshots older than the one delivered last, as updates from registries and
+// the first delivery of Subscribe run concurrently
+type subscriber struct {
+	lock      sync.Mutex
+	delivered int
+	fn        func([]interfaces.Instance)
+}
+
+func (s *subscriber) deliver(version int, instances []interfaces.Instance) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if version <= s.delivered {
+		return
+	}
+	s.delivered = version
+	s.fn(instances)
+}
+
+func (p *discoveryProvider) update(mode string, instances []interfaces.Instance) {
+	p.lock.Lock()
+	p.snapshots[mode] = instances
+	merged := make([]interfaces.Instance, 0, len(instances))
+	seen := make(map[string]struct{})
+	for _, m := range p.modes {
+		for _, instance := range p.snapshots[m] {
+			// the same instance registered with more than one registry is kept only once
+			if _, exists := seen[instance.Addr()]; exists {
+				continue
+			}
+			seen[instance.Addr()] = struct{}{}
+			merged = append(merged, instance)
+		}
+	}
+	merged = balancer.Subset(merged, p.clientId, p.subsetSize)
+	p.instances = merged
+	p.version++
+	version := p.version
+	subscribers := make([]*subscriber, 0, len(p.subscribers))
+	for _, s := range p.subscribers {
+		subscribers = append(subscribers, s)
+	}
+	p.lock.Unlock()
+	for _, s := range subscribers {
+		s.deliver(version, merged)
+	}
+}
+
+// Instances returns all discovered instances
+func (p *discoveryProvider) Instances() []interfaces.Instance {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return p.instances
+}
+
+// Subscribe calls fn with all discovered instances right away and each time they change
+func (p *discoveryProvider) Subscribe(fn func([]interfaces.Instance)) (unsubscribe func()) {
+	p.lock.Lock()
+	p.seq++
+	id := p.seq
+	s := &subscriber{delivered: -1, fn: fn}
+	p.subscribers[id] = s
+	version, instances := p.version, p.instances
+	p.lock.Unlock()
+	s.deliver(version, instances)
+	return func() {
+		p.lock.Lock()
+		defer p.lock.Unlock()
+		delete(p.subscribers, id)
+	}
+}
+
+// SelectInstance picks an instance by balancer from instances selected by route rule of the service
+func (p *discoveryProvider) SelectInstance(ctx context.Context) (interfaces.Instance, error) {
+	return p.balancer.Pick(ctx, router.Route(ctx, p.service, p.Instances()))
+}
+
+// Start tracks request to instance at addr for adaptive balancers such as balancer.NewP2C and balancer.NewEWMA,
+// done must be called once request finishes
+func (p *discoveryProvider) Start(addr string) (done func(err error)) {
+	return balancer.Start(p.balancer, addr)
+}
+
+// SelectServer returns base url of the instance picked by balancer
+func (p *discoveryProvider) SelectServer() string {
+	instance, err := p.SelectInstance(context.Background())
+	if err != nil {
+		logger.Error().Err(err).Msgf("[go-doudou] failed to select server of %s", p.service)
+		return ""
+	}
+	return instance.BaseUrl()
+}
+
+// Close stops watching registries
+func (p *discoveryProvider) Close() {
+	p.lock.Lock()
+	stops := p.stops
+	p.stops = nil
+	p.lock.Unlock()
+	for _, stop := range stops {
+		stop()
+	}
+}
+
+// Discover watches instances of service from all registries in GDD_SERVICE_DISCOVERY_MODE unless set by
+// WithDiscoveryMode, and picks instance by round-robin balancer unless set by WithBalancer after routing by
+// the rule of service in GDD_ROUTE_RULES.
+// service is the name server registered with, e.g. usersvc_rest or usersvc_grpc.
+func Discover(service string, opts ...DiscoveryOption) IDiscoveryProvider {
+	var conf discoveryConfig
+	for _, opt := range opts {
+		opt(&conf)
+	}
+	var modes []string
+	if conf.modeSet {
+		modes = append(modes, conf.mode)
+	} else {
+		for mode := range config.ServiceDiscoveryMap() {
+			modes = append(modes, mode)
+		}
+		sort.Strings(modes)
+	}
+	if conf.balancer == nil {
+		conf.balancer = balancer.NewRoundRobin()
+	}
+	if conf.detector == nil && outlier.Enabled() {
+		conf.detector = outlier.Default()
+	}
+	if conf.detector != nil {
+		conf.balancer = outlier.NewBalancer(conf.detector, conf.balancer)
+	}
+	p := &discoveryProvider{
+		service:     service,
+		balancer:    conf.balancer,
+		clientId:    conf.clientId,
+		subsetSize:  conf.subsetSize,
+		modes:       modes,
+		snapshots:   make(map[string][]interfaces.Instance),
+		subscribers: make(map[int]*subscriber),
+	}
+	p.Subscribe(func(instances []interfaces.Instance) {
+		if conf.detector != nil {
+			conf.detector.Track(service, instances)
+		}
+		balancer.Prune(p.balancer, instances)
+	})
+	for _, mode := range modes {
+		watch, ok := instanceWatchers[mode]
+		if !ok {
+			logger.Warn().Msgf("[go-doudou] unknown service discovery mode: %s", mode)
+			continue
+		}
+		mode := mode
+		stop := watch(service, conf, func(instances []interfaces.Instance) {
+			p.update(mode, instances)
+		})
+		p.lock.Lock()
+		p.stops = append(p.stops, stop)
+		p.lock.Unlock()
+	}
+	return p
+}
@@ -0,0 +1,226 @@
+package registry
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/unionj-cloud/go-doudou/v2/framework/internal/config"
+	"github.com/unionj-cloud/go-doudou/v2/framework/registry/balancer"
+	"github.com/unionj-cloud/go-doudou/v2/framework/registry/constants"
+	"github.com/unionj-cloud/go-doudou/v2/framework/registry/interfaces"
+	"github.com/unionj-cloud/go-doudou/v2/framework/registry/outlier"
+	"github.com/unionj-cloud/go-doudou/v2/framework/registry/router"
+)
+
+type fakeWatcher struct {
+	fn      func([]interfaces.Instance)
+	stopped bool
+}
+
+func stubWatchers(t *testing.T, modes ...string) map[string]*fakeWatcher {
+	origin := instanceWatchers
+	t.Cleanup(func() {
+		instanceWatchers = origin
+	})
+	instanceWatchers = make(map[string]watchFunc)
+	fakes := make(map[string]*fakeWatcher)
+	for _, mode := range modes {
+		w := &fakeWatcher{}
+		fakes[mode] = w
+		instanceWatchers[mode] = func(service string, conf discoveryConfig, fn func([]interfaces.Instance)) (stop func()) {
+			w.fn = fn
+			return func() {
+				w.stopped = true
+			}
+		}
+	}
+	return fakes
+}
+
+func TestDiscover(t *testing.T) {
+	t.Setenv(string(config.GddServiceDiscoveryMode), "etcd,nacos")
+	fakes := stubWatchers(t, constants.SD_ETCD, constants.SD_NACOS)
+	provider := Discover("usersvc_rest")
+	require.Empty(t, provider.Instances())
+	require.Equal(t, "", provider.SelectServer())
+
+	var notified []interfaces.Instance
+	unsubscribe := provider.Subscribe(func(instances []interfaces.Instance) {
+		notified = instances
+	})
+	fakes[constants.SD_ETCD].fn([]interfaces.Instance{
+		interfaces.NewInstance("usersvc_rest", "10.0.0.1", 6060, map[string]string{"rootPath": "/v1"}),
+	})
+	fakes[constants.SD_NACOS].fn([]interfaces.Instance{
+		interfaces.NewInstance("usersvc_rest", "10.0.0.1", 6060, nil),
+		interfaces.NewInstance("usersvc_rest", "10.0.0.2", 6060, map[string]string{"zone": "zone-a"}),
+	})
+	require.Len(t, provider.Instances(), 2)
+	require.Len(t, notified, 2)
+	require.Equal(t, "/v1", provider.Instances()[0].RootPath)
+	require.Equal(t, "zone-a", provider.Instances()[1].Zone)
+	require.ElementsMatch(t, []string{"http://10.0.0.1:6060/v1", "http://10.0.0.2:6060"},
+		[]string{provider.SelectServer(), provider.SelectServer()})
+
+	unsubscribe()
+	fakes[constants.SD_ETCD].fn(nil)
+	require.Len(t, provider.Instances(), 2)
+	require.Len(t, notified, 2)
+
+	provider.Close()
+	require.True(t, fakes[constants.SD_ETCD].stopped)
+	require.True(t, fakes[constants.SD_NACOS].stopped)
+}
+
+func TestDiscoverWithOptions(t *testing.T) {
+	t.Setenv(string(config.GddServiceDiscoveryMode), "etcd,nacos")
+	fakes := stubWatchers(t, constants.SD_ETCD, constants.SD_NACOS)
+	provider := Discover("usersvc_grpc", WithDiscoveryMode(constants.SD_NACOS),
+		WithBalancer(balancer.BalancerFunc(func(ctx context.Context, instances []interfaces.Instance) (interfaces.Instance, error) {
+			return instances[len(instances)-1], nil
+		})))
+	defer provider.Close()
+	require.Nil(t, fakes[constants.SD_ETCD].fn)
+	fakes[constants.SD_NACOS].fn([]interfaces.Instance{
+		interfaces.NewInstance("usersvc_grpc", "10.0.0.1", 50051, nil),
+		interfaces.NewInstance("usersvc_grpc", "10.0.0.2", 50051, nil),
+	})
+	instance, err := provider.SelectInstance(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "10.0.0.2:50051", instance.Addr())
+}
+
+func TestDiscoverWithSubsetAndP2C(t *testing.T) {
+	t.Setenv(string(config.GddServiceDiscoveryMode), "etcd")
+	fakes := stubWatchers(t, constants.SD_ETCD)
+	provider := Discover("usersvc_rest", WithSubset(1, 2), WithBalancer(balancer.NewP2C()))
+	defer provider.Close()
+	fakes[constants.SD_ETCD].fn([]interfaces.Instance{
+		interfaces.NewInstance("usersvc_rest", "10.0.0.1", 6060, nil),
+		interfaces.NewInstance("usersvc_rest", "10.0.0.2", 6060, nil),
+		interfaces.NewInstance("usersvc_rest", "10.0.0.3", 6060, nil),
+		interfaces.NewInstance("usersvc_rest", "10.0.0.4", 6060, nil),
+	})
+	subset := provider.Instances()
+	require.Len(t, subset, 2)
+
+	// the instance busy with requests is not picked
+	tracker := provider.(balancer.Tracker)
+	done := tracker.Start(subset[0].Addr())
+	for i := 0; i < 10; i++ {
+		instance, err := provider.SelectInstance(context.Background())
+		require.NoError(t, err)
+		require.Equal(t, subset[1].Addr(), instance.Addr())
+	}
+	done(nil)
+}
+
+func TestSubscribeInOrder(t *testing.T) {
+	t.Setenv(string(config.GddServiceDiscoveryMode), "etcd,nacos")
+	fakes := stubWatchers(t, constants.SD_ETCD, constants.SD_NACOS)
+	provider := Discover("usersvc_rest")
+	defer provider.Close()
+
+	var lock sync.Mutex
+	var notified []interfaces.Instance
+	provider.Subscribe(func(instances []interfaces.Instance) {
+		lock.Lock()
+		defer lock.Unlock()
+		notified = instances
+	})
+	var wg sync.WaitGroup
+	for _, mode := range []string{constants.SD_ETCD, constants.SD_NACOS} {
+		wg.Add(1)
+		go func(w *fakeWatcher) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				w.fn([]interfaces.Instance{
+					interfaces.NewInstance("usersvc_rest", fmt.Sprintf("10.0.0.%d", i), 6060, nil),
+				})
+			}
+		}(fakes[mode])
+	}
+	wg.Wait()
+	// the last snapshot delivered is the latest one
+	require.Equal(t, provider.Instances(), notified)
+}
+
+func TestSubscriberSkipStale(t *testing.T) {
+	var notified []int
+	s := &subscriber{delivered: -1, fn: func(instances []interfaces.Instance) {
+		notified = append(notified, len(instances))
+	}}
+	s.deliver(0, nil)
+	s.deliver(2, make([]interfaces.Instance, 2))
+	s.deliver(1, make([]interfaces.Instance, 1))
+	s.deliver(2, make([]interfaces.Instance, 2))
+	require.Equal(t, []int{0, 2}, notified)
+}
+
+type pruneRecorder struct {
+	balancer.Balancer
+	pruned [][]interfaces.Instance
+}
+
+func (r *pruneRecorder) Prune(instances []interfaces.Instance) {
+	r.pruned = append(r.pruned, instances)
+}
+
+func TestDiscoverPrune(t *testing.T) {
+	t.Setenv(string(config.GddServiceDiscoveryMode), "etcd")
+	t.Setenv(string(config.GddOutlierDetectionEnable), "false")
+	fakes := stubWatchers(t, constants.SD_ETCD)
+	recorder := &pruneRecorder{Balancer: balancer.NewRoundRobin()}
+	provider := Discover("usersvc_rest", WithBalancer(recorder))
+	defer provider.Close()
+	instances := []interfaces.Instance{
+		interfaces.NewInstance("usersvc_rest", "10.0.0.1", 6060, nil),
+	}
+	fakes[constants.SD_ETCD].fn(instances)
+	// stats of instances gone are dropped each time instances change
+	require.Len(t, recorder.pruned, 2)
+	require.Empty(t, recorder.pruned[0])
+	require.Equal(t, instances, recorder.pruned[1])
+}
+
+func TestDiscoverOutlierMembership(t *testing.T) {
+	t.Setenv(string(config.GddServiceDiscoveryMode), "etcd")
+	t.Setenv(string(config.GddRouteRules), `{"usersvc_rest":{"canary":{"labels":{"zone":"zone-b"},"header":"x-canary"}}}`)
+	fakes := stubWatchers(t, constants.SD_ETCD)
+	detector := outlier.NewDetector(outlier.Config{
+		ConsecutiveErrors:  1,
+		BaseEjectionTime:   time.Minute,
+		MaxEjectionTime:    time.Minute,
+		MaxEjectionPercent: 50,
+	})
+	provider := Discover("usersvc_rest", WithOutlierDetection(detector))
+	defer provider.Close()
+	fakes[constants.SD_ETCD].fn([]interfaces.Instance{
+		interfaces.NewInstance("usersvc_rest", "10.0.0.1", 6060, map[string]string{"zone": "zone-a"}),
+		interfaces.NewInstance("usersvc_rest", "10.0.0.2", 6060, map[string]string{"zone": "zone-a"}),
+		interfaces.NewInstance("usersvc_rest", "10.0.0.3", 6060, map[string]string{"zone": "zone-b"}),
+		interfaces.NewInstance("usersvc_rest", "10.0.0.4", 6060, map[string]string{"zone": "zone-b"}),
+	})
+	require.Len(t, detector.Statuses(), 4)
+	zoneA := context.Background()
+	zoneB := router.NewContext(context.Background(), http.Header{"X-Canary": []string{"true"}})
+	instance, err := provider.SelectInstance(zoneA)
+	require.NoError(t, err)
+	provider.(balancer.Tracker).Start(instance.Addr())(errors.New("connection refused"))
+
+	// requests routed to the other zone don't make detector forget the instance ejected
+	for i := 0; i < 4; i++ {
+		_, err = provider.SelectInstance(zoneB)
+		require.NoError(t, err)
+		picked, err := provider.SelectInstance(zoneA)
+		require.NoError(t, err)
+		require.NotEqual(t, instance.Addr(), picked.Addr())
+	}
+	require.Len(t, detector.Statuses(), 4)
+}
@@ -0,0 +1,63 @@
+package etcd
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"github.com/unionj-cloud/go-doudou/v2/framework/registry/interfaces"
+	"github.com/unionj-cloud/go-doudou/v2/toolkit/cast"
+	"github.com/unionj-cloud/go-doudou/v2/toolkit/zlogger"
+	"go.etcd.io/etcd/client/v3/naming/endpoints"
+)
+
+// WatchInstances calls fn with all instances of service each time they change, until stop is called
+func WatchInstances(service string, fn func([]interfaces.Instance)) (stop func()) {
+	onceEtcd.Do(func() {
+		InitEtcdCli()
+	})
+	em, err := endpoints.NewManager(EtcdCli, service)
+	if err != nil {
+		zlogger.Panic().Err(err).Msg("[go-doudou] failed to create endpoint manager")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	wch, err := em.NewWatchChannel(ctx)
+	if err != nil {
+		cancel()
+		zlogger.Panic().Err(err).Msg("[go-doudou] failed to create watch channel")
+	}
+	go func() {
+		allUps := make(map[string]*endpoints.Update)
+		for ups := range wch {
+			for _, up := range ups {
+				switch up.Op {
+				case endpoints.Add:
+					allUps[up.Key] = up
+				case endpoints.Delete:
+					delete(allUps, up.Key)
+				}
+			}
+			fn(convertToInstances(service, allUps))
+		}
+	}()
+	return cancel
+}
+
+func convertToInstances(service string, ups map[string]*endpoints.Update) []interfaces.Instance {
+	instances := make([]interfaces.Instance, 0, len(ups))
+	for _, up := range ups {
+		host, port, err := net.SplitHostPort(up.Endpoint.Addr)
+		if err != nil {
+			zlogger.Error().Err(err).Msgf("[go-doudou] invalid etcd endpoint address %s", up.Endpoint.Addr)
+			continue
+		}
+		metadata := make(map[string]string)
+		if m, ok := up.Endpoint.Metadata.(map[string]interface{}); ok {
+			for k, v := range m {
+				metadata[k] = fmt.Sprint(v)
+			}
+		}
+		instances = append(instances, interfaces.NewInstance(service, host, cast.ToIntOrDefault(port, 0), metadata))
+	}
+	return instances
+}
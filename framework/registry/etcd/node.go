@@ -8,6 +8,7 @@ import (
 	cons "github.com/unionj-cloud/go-doudou/v2/framework/registry/constants"
 	"github.com/unionj-cloud/go-doudou/v2/framework/registry/interfaces"
 	"github.com/unionj-cloud/go-doudou/v2/framework/registry/utils"
+	"github.com/unionj-cloud/go-doudou/v2/framework/tlsx"
 	"github.com/unionj-cloud/go-doudou/v2/toolkit/cast"
 	"github.com/unionj-cloud/go-doudou/v2/toolkit/constants"
 	"github.com/unionj-cloud/go-doudou/v2/toolkit/stringutils"
@@ -112,6 +113,12 @@ func populateMeta(meta map[string]interface{}, isGrpc bool, userData ...map[stri
 	meta["registerAt"] = time.Now().Local().Format(constants.FORMAT8)
 	meta["goVer"] = runtime.Version()
 	meta["weight"] = weight
+	if version := config.GddServiceVersion.LoadOrDefault(config.DefaultGddServiceVersion); stringutils.IsNotEmpty(version) {
+		meta["version"] = version
+	}
+	if zone := config.GddServiceZone.LoadOrDefault(config.DefaultGddServiceZone); stringutils.IsNotEmpty(zone) {
+		meta["zone"] = zone
+	}
 	if stringutils.IsNotEmpty(buildinfo.GddVer) {
 		meta["gddVer"] = buildinfo.GddVer
 	}
@@ -297,7 +304,7 @@ func (n *RRServiceProvider) SelectServer() string {
 	next := int(atomic.AddUint64(&n.current, uint64(1)) % uint64(len(instances)))
 	n.current = uint64(next)
 	selected := instances[next]
-	return fmt.Sprintf("http://%s%s", selected.addr, selected.rootPath)
+	return fmt.Sprintf("%s://%s%s", tlsx.Scheme(), selected.addr, selected.rootPath)
 }
 
 // NewRRServiceProvider creates new RRServiceProvider instance
@@ -353,7 +360,7 @@ func (n *SWRRServiceProvider) SelectServer() string {
 		}
 	}
 	selected.currentWeight -= total
-	return fmt.Sprintf("http://%s%s", selected.addr, selected.rootPath)
+	return fmt.Sprintf("%s://%s%s", tlsx.Scheme(), selected.addr, selected.rootPath)
 }
 
 // NewSWRRServiceProvider creates new SWRRServiceProvider instance
@@ -379,7 +386,7 @@ func NewGrpcClientConn(service string, lb string, dialOptions ...grpc.DialOption
 	if err != nil {
 		zlogger.Panic().Err(err).Msg("[go-doudou] failed to create etcd resolver")
 	}
-	dialOptions = append(dialOptions,
+	dialOptions = append(tlsx.DialOptions(dialOptions...),
 		grpc.WithBlock(),
 		grpc.WithResolvers(etcdResolver),
 		grpc.WithDefaultServiceConfig(`{"loadBalancingPolicy": "`+lb+`"}`),
@@ -0,0 +1,184 @@
+package registry
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/unionj-cloud/go-doudou/v2/framework/grpcx/interceptors/grpcx_mesh"
+	"github.com/unionj-cloud/go-doudou/v2/framework/internal/config"
+	"github.com/unionj-cloud/go-doudou/v2/framework/registry/constants"
+	"github.com/unionj-cloud/go-doudou/v2/framework/registry/etcd"
+	"github.com/unionj-cloud/go-doudou/v2/framework/registry/memberlist"
+	"github.com/unionj-cloud/go-doudou/v2/framework/registry/mesh"
+	"github.com/unionj-cloud/go-doudou/v2/framework/registry/nacos"
+	"github.com/unionj-cloud/go-doudou/v2/framework/registry/router"
+	"github.com/unionj-cloud/go-doudou/v2/framework/registry/zk"
+	"github.com/unionj-cloud/go-doudou/v2/framework/tlsx"
+	logger "github.com/unionj-cloud/go-doudou/v2/toolkit/zlogger"
+	"google.golang.org/grpc"
+)
+
+const (
+	// LB_ROUND_ROBIN picks server instances in turn
+	LB_ROUND_ROBIN = "round_robin"
+	// LB_WEIGHTED picks server instances by weight registered with, using the balancer of discovery mode
+	LB_WEIGHTED = "weighted"
+	// LB_ROUTING picks server instances in turn from those selected by the rule of service in GDD_ROUTE_RULES,
+	// instances are discovered from all registries by Discover
+	LB_ROUTING = router.Name
+	// LB_P2C routes like LB_ROUTING then picks the instance with fewer in-flight requests out of two random ones
+	LB_P2C = router.P2CName
+	// LB_EWMA routes like LB_ROUTING then picks the instance with lower latency and load out of two random ones
+	LB_EWMA = router.EWMAName
+	// LB_CONSISTENT_HASH routes like LB_ROUTING then picks instance by consistent hashing of key from balancer.WithHashKey
+	LB_CONSISTENT_HASH = router.ConsistentHashName
+)
+
+// routingBalancers are grpc balancers picking from instances discovered by Discover
+var routingBalancers = map[string]struct{}{
+	LB_ROUTING:         {},
+	LB_P2C:             {},
+	LB_EWMA:            {},
+	LB_CONSISTENT_HASH: {},
+}
+
+var weightedBalancers = map[string]string{
+	constants.SD_ETCD:       "etcd_weight_balancer",
+	constants.SD_NACOS:      "nacos_weight_balancer",
+	constants.SD_ZK:         "zk_weight_balancer",
+	constants.SD_MEMBERLIST: "memberlist_weight_balancer",
+}
+
+// GrpcClientOption configures grpc client connection created by NewGrpcClientConn
+type GrpcClientOption = DiscoveryOption
+
+// WithLoadBalancing sets load balancing policy of grpc client connection, LB_ROUND_ROBIN, LB_WEIGHTED, LB_ROUTING,
+// LB_P2C, LB_EWMA, LB_CONSISTENT_HASH or any registered grpc balancer name
+func WithLoadBalancing(lb string) GrpcClientOption {
+	return func(c *discoveryConfig) {
+		c.lb = lb
+	}
+}
+
+// WithDialOptions appends dial options of grpc client connection such as interceptors
+func WithDialOptions(dialOptions ...grpc.DialOption) GrpcClientOption {
+	return func(c *discoveryConfig) {
+		c.dialOptions = append(c.dialOptions, dialOptions...)
+	}
+}
+
+// defaultDiscoveryMode returns the first mode in GDD_SERVICE_DISCOVERY_MODE
+func defaultDiscoveryMode() string {
+	modeStr := config.GddServiceDiscoveryMode.LoadOrDefault(config.DefaultGddServiceDiscoveryMode)
+	return strings.TrimSpace(strings.Split(modeStr, ",")[0])
+}
+
+// NewGrpcClientConn creates grpc client connection to service registered with the discovery mode from
+// GDD_SERVICE_DISCOVERY_MODE unless set by WithDiscoveryMode, using round-robin load balancing by default.
+// service is the name grpc server registered with, i.e. its GDD_SERVICE_NAME suffixed by _grpc.
+func NewGrpcClientConn(service string, opts ...GrpcClientOption) *grpc.ClientConn {
+	conf := discoveryConfig{
+		lb: LB_ROUND_ROBIN,
+	}
+	for _, opt := range opts {
+		opt(&conf)
+	}
+	if !conf.modeSet {
+		conf.mode = defaultDiscoveryMode()
+	}
+	lb := conf.lb
+	if lb == LB_WEIGHTED {
+		if lb = weightedBalancers[conf.mode]; lb == "" {
+			lb = LB_ROUND_ROBIN
+		}
+	}
+	switch conf.mode {
+	case constants.SD_MESH, constants.SD_DNS:
+		return newMeshGrpcClientConn(service, conf)
+	}
+	if _, ok := routingBalancers[lb]; ok {
+		return newRoutingGrpcClientConn(service, lb, opts, conf.dialOptions)
+	}
+	switch conf.mode {
+	case constants.SD_ETCD:
+		return etcd.NewGrpcClientConn(service, lb, conf.dialOptions...)
+	case constants.SD_NACOS:
+		return nacos.NewGrpcClientConn(nacos.NacosConfig{
+			ServiceName: service,
+			Clusters:    conf.clusters,
+			GroupName:   conf.group,
+		}, lb, conf.dialOptions...)
+	case constants.SD_ZK:
+		return zk.NewGrpcClientConn(zk.ServiceConfig{
+			Name:    service,
+			Group:   conf.group,
+			Version: conf.version,
+		}, lb, conf.dialOptions...)
+	case constants.SD_MEMBERLIST:
+		return memberlist.NewGrpcClientConn(service, lb, conf.dialOptions...)
+	case "":
+	default:
+		logger.Warn().Msgf("[go-doudou] unknown service discovery mode: %s, dial %s directly", conf.mode, service)
+	}
+	dialOptions := append(tlsx.DialOptions(conf.dialOptions...),
+		grpc.WithBlock(),
+		grpc.WithDefaultServiceConfig(`{"loadBalancingPolicy": "`+lb+`"}`),
+	)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	grpcConn, err := grpc.DialContext(ctx, service, dialOptions...)
+	if err != nil {
+		logger.Panic().Err(err).Msgf("[go-doudou] failed to connect to server %s", service)
+	}
+	return grpcConn
+}
+
+// newMeshGrpcClientConn dials dns name of service resolved by mesh.Resolve. In mesh mode, the sidecar balances
+// requests over instances, so pick_first is used and tracing headers are propagated. In dns mode, the requested
+// load balancing policy applies to addresses of a headless service, routing balancers fall back to round-robin.
+func newMeshGrpcClientConn(service string, conf discoveryConfig) *grpc.ClientConn {
+	addr, err := mesh.Resolve(service)
+	if err != nil {
+		logger.Panic().Err(err).Msgf("[go-doudou] failed to resolve server %s", service)
+	}
+	lb := conf.lb
+	dialOptions := conf.dialOptions
+	if conf.mode == constants.SD_MESH {
+		lb = "pick_first"
+		dialOptions = append([]grpc.DialOption{
+			grpc.WithChainUnaryInterceptor(grpcx_mesh.UnaryClientInterceptor()),
+			grpc.WithChainStreamInterceptor(grpcx_mesh.StreamClientInterceptor()),
+		}, dialOptions...)
+	} else if _, ok := routingBalancers[lb]; ok || lb == LB_WEIGHTED {
+		lb = LB_ROUND_ROBIN
+	}
+	dialOptions = append(tlsx.DialOptions(dialOptions...),
+		grpc.WithBlock(),
+		grpc.WithDefaultServiceConfig(`{"loadBalancingPolicy": "`+lb+`"}`),
+	)
+	serverAddr := "dns:///" + addr
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	grpcConn, err := grpc.DialContext(ctx, serverAddr, dialOptions...)
+	if err != nil {
+		logger.Panic().Err(err).Msgf("[go-doudou] failed to connect to server %s", serverAddr)
+	}
+	return grpcConn
+}
+
+func newRoutingGrpcClientConn(service, lb string, opts []GrpcClientOption, dialOptions []grpc.DialOption) *grpc.ClientConn {
+	dialOptions = append(tlsx.DialOptions(dialOptions...),
+		grpc.WithBlock(),
+		grpc.WithResolvers(&discoverResolverBuilder{opts: opts}),
+		grpc.WithDefaultServiceConfig(`{"loadBalancingPolicy": "`+lb+`"}`),
+	)
+	serverAddr := discoverScheme + "://" + service
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	grpcConn, err := grpc.DialContext(ctx, serverAddr, dialOptions...)
+	if err != nil {
+		logger.Panic().Err(err).Msgf("[go-doudou] failed to connect to server %s", serverAddr)
+	}
+	return grpcConn
+}
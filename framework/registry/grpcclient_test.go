@@ -0,0 +1,92 @@
+package registry
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/unionj-cloud/go-doudou/v2/framework/internal/config"
+	"github.com/unionj-cloud/go-doudou/v2/framework/registry/constants"
+	"github.com/unionj-cloud/go-doudou/v2/framework/registry/interfaces"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestDefaultDiscoveryMode(t *testing.T) {
+	t.Setenv(string(config.GddServiceDiscoveryMode), "nacos,etcd")
+	require.Equal(t, "nacos", defaultDiscoveryMode())
+	t.Setenv(string(config.GddServiceDiscoveryMode), "")
+	require.Equal(t, "", defaultDiscoveryMode())
+}
+
+func TestNewGrpcClientConnDirect(t *testing.T) {
+	t.Setenv(string(config.GddServiceDiscoveryMode), "")
+	lis, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+	server := grpc.NewServer()
+	grpc_health_v1.RegisterHealthServer(server, health.NewServer())
+	go server.Serve(lis)
+	defer server.Stop()
+
+	conn := NewGrpcClientConn(lis.Addr().String(), WithLoadBalancing(LB_WEIGHTED),
+		WithDialOptions(grpc.WithTransportCredentials(insecure.NewCredentials())))
+	defer conn.Close()
+	reply, err := grpc_health_v1.NewHealthClient(conn).Check(context.Background(), &grpc_health_v1.HealthCheckRequest{})
+	require.NoError(t, err)
+	require.Equal(t, grpc_health_v1.HealthCheckResponse_SERVING, reply.Status)
+}
+
+func newHealthServer(t *testing.T, status grpc_health_v1.HealthCheckResponse_ServingStatus) (host string, port int) {
+	lis, err := net.Listen("tcp", "localhost:0")
+	require.NoError(t, err)
+	healthServer := health.NewServer()
+	healthServer.SetServingStatus("", status)
+	server := grpc.NewServer()
+	grpc_health_v1.RegisterHealthServer(server, healthServer)
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+	addr := lis.Addr().(*net.TCPAddr)
+	return addr.IP.String(), addr.Port
+}
+
+func TestNewGrpcClientConnRouting(t *testing.T) {
+	t.Setenv(string(config.GddServiceDiscoveryMode), constants.SD_ETCD)
+	t.Setenv(string(config.GddRouteRules), `{"usersvc_grpc":{"canary":{"labels":{"version":"v2"},"header":"x-canary"}}}`)
+	v1Host, v1Port := newHealthServer(t, grpc_health_v1.HealthCheckResponse_SERVING)
+	v2Host, v2Port := newHealthServer(t, grpc_health_v1.HealthCheckResponse_NOT_SERVING)
+	fakes := stubWatchers(t, constants.SD_ETCD)
+	instanceWatchers[constants.SD_ETCD] = func(service string, conf discoveryConfig, fn func([]interfaces.Instance)) (stop func()) {
+		fn([]interfaces.Instance{
+			interfaces.NewInstance(service, v1Host, v1Port, map[string]string{"version": "v1"}),
+			interfaces.NewInstance(service, v2Host, v2Port, map[string]string{"version": "v2"}),
+		})
+		return func() {
+			fakes[constants.SD_ETCD].stopped = true
+		}
+	}
+
+	conn := NewGrpcClientConn("usersvc_grpc", WithLoadBalancing(LB_ROUTING),
+		WithDialOptions(grpc.WithTransportCredentials(insecure.NewCredentials())))
+	client := grpc_health_v1.NewHealthClient(conn)
+	// picker routes among ready connections only, so wait for connection to v1 instance
+	require.Eventually(t, func() bool {
+		reply, err := client.Check(context.Background(), &grpc_health_v1.HealthCheckRequest{})
+		return err == nil && reply.Status == grpc_health_v1.HealthCheckResponse_SERVING
+	}, 5*time.Second, 10*time.Millisecond)
+	for i := 0; i < 4; i++ {
+		reply, err := client.Check(context.Background(), &grpc_health_v1.HealthCheckRequest{})
+		require.NoError(t, err)
+		require.Equal(t, grpc_health_v1.HealthCheckResponse_SERVING, reply.Status)
+	}
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "x-canary", "true")
+	reply, err := client.Check(ctx, &grpc_health_v1.HealthCheckRequest{}, grpc.WaitForReady(true))
+	require.NoError(t, err)
+	require.Equal(t, grpc_health_v1.HealthCheckResponse_NOT_SERVING, reply.Status)
+
+	require.NoError(t, conn.Close())
+}
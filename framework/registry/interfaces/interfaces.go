@@ -1,6 +1,71 @@
 package interfaces
 
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+
+	"github.com/unionj-cloud/go-doudou/v2/framework/tlsx"
+	"github.com/unionj-cloud/go-doudou/v2/toolkit/cast"
+)
+
 type IServiceProvider interface {
 	SelectServer() string
 	Close()
 }
+
+// Instance is a service instance discovered from registries
+type Instance struct {
+	// Service is the name instance registered with, e.g. usersvc_rest
+	Service  string
+	Host     string
+	Port     int
+	Weight   int
+	Version  string
+	Zone     string
+	RootPath string
+	// Metadata holds all metadata registered with the instance, including user data
+	Metadata map[string]string
+}
+
+// Addr returns host:port of the instance
+func (i Instance) Addr() string {
+	return net.JoinHostPort(i.Host, strconv.Itoa(i.Port))
+}
+
+// BaseUrl returns base url of the instance, e.g. http://192.168.1.10:6060/v1
+func (i Instance) BaseUrl() string {
+	return fmt.Sprintf("%s://%s%s", tlsx.Scheme(), i.Addr(), i.RootPath)
+}
+
+// IDiscoveryProvider is an IServiceProvider exposing discovered instances
+type IDiscoveryProvider interface {
+	IServiceProvider
+	// SelectInstance selects an instance by load balancing strategy, ctx is passed to the strategy,
+	// e.g. for hashing a request key
+	SelectInstance(ctx context.Context) (Instance, error)
+	// Instances returns all discovered instances
+	Instances() []Instance
+	// Subscribe calls fn with all instances right away and each time they change, until the returned
+	// function is called
+	Subscribe(fn func([]Instance)) (unsubscribe func())
+}
+
+// NewInstance returns instance with weight, version, zone and root path taken from metadata, weight
+// defaults to 1
+func NewInstance(service, host string, port int, metadata map[string]string) Instance {
+	if metadata == nil {
+		metadata = make(map[string]string)
+	}
+	return Instance{
+		Service:  service,
+		Host:     host,
+		Port:     port,
+		Weight:   cast.ToIntOrDefault(metadata["weight"], 1),
+		Version:  metadata["version"],
+		Zone:     metadata["zone"],
+		RootPath: metadata["rootPath"],
+		Metadata: metadata,
+	}
+}
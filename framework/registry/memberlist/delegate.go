@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"github.com/hashicorp/go-msgpack/codec"
 	"github.com/unionj-cloud/go-doudou/v2/framework/registry/constants"
+	"github.com/unionj-cloud/go-doudou/v2/framework/tlsx"
 	"github.com/unionj-cloud/go-doudou/v2/toolkit/memberlist"
 	logger "github.com/unionj-cloud/go-doudou/v2/toolkit/zlogger"
 	"sync"
@@ -26,7 +27,7 @@ func (receiver *Service) BaseUrl() string {
 	}
 	switch receiver.Type {
 	case constants.REST_TYPE:
-		return fmt.Sprintf("http://%s:%d%s", receiver.Host, receiver.Port, receiver.RouteRootPath)
+		return fmt.Sprintf("%s://%s:%d%s", tlsx.Scheme(), receiver.Host, receiver.Port, receiver.RouteRootPath)
 	case constants.GRPC_TYPE:
 		return fmt.Sprintf("%s:%d", receiver.Host, receiver.Port)
 	}
@@ -41,12 +42,43 @@ type NodeMeta struct {
 	BuildUser  string     `json:"buildUser"`
 	BuildTime  string     `json:"buildTime"`
 	Weight     int        `json:"weight"`
+	Version    string     `json:"version,omitempty"`
+	Zone       string     `json:"zone,omitempty"`
+	Cluster    string     `json:"cluster,omitempty"`
+}
+
+// messageType is the first byte of user messages sent between nodes
+type messageType uint8
+
+const (
+	keyRequestMsg messageType = iota + 1
+	keyResponseMsg
+	kvMsg
+	userEventMsg
+)
+
+func encodeMessage(t messageType, v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte(uint8(t))
+	enc := codec.NewEncoder(&buf, &codec.MsgpackHandle{})
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func decodeMessage(buf []byte, out interface{}) error {
+	dec := codec.NewDecoder(bytes.NewReader(buf), &codec.MsgpackHandle{})
+	return dec.Decode(out)
 }
 
 type delegate struct {
 	meta  NodeMeta
 	lock  sync.Mutex
 	queue *memberlist.TransmitLimitedQueue
+	keys  *keyManager
+	kv    *KVStore
+	ev    *eventBus
 }
 
 func (d *delegate) AddService(service Service) {
@@ -76,9 +108,30 @@ func (d *delegate) NodeMeta(limit int) []byte {
 
 // NotifyMsg callback function when received user data message from remote node
 func (d *delegate) NotifyMsg(msg []byte) {
-	d.lock.Lock()
-	defer d.lock.Unlock()
-	// TODO
+	if len(msg) == 0 {
+		return
+	}
+	switch messageType(msg[0]) {
+	case keyRequestMsg:
+		if d.keys != nil {
+			// responding sends message, which must not block memberlist from handling other messages
+			go d.keys.handleRequest(msg[1:])
+		}
+	case keyResponseMsg:
+		if d.keys != nil {
+			d.keys.handleResponse(msg[1:])
+		}
+	case kvMsg:
+		if d.kv != nil {
+			d.kv.handleMsg(msg[1:])
+		}
+	case userEventMsg:
+		if d.ev != nil {
+			d.ev.handleMsg(msg[1:])
+		}
+	default:
+		logger.Warn().Msgf("[go-doudou] unknown message type %d", msg[0])
+	}
 }
 
 // GetBroadcasts get a number of user data broadcasts
@@ -92,9 +145,54 @@ func (d *delegate) GetBroadcasts(overhead, limit int) [][]byte {
 
 // LocalState also sends user data, but by tcp connection when pushPull-ing state with other node
 func (d *delegate) LocalState(join bool) []byte {
-	return nil
+	if d.kv == nil {
+		return nil
+	}
+	buf, err := encodeMessage(kvMsg, d.kv.localState())
+	if err != nil {
+		logger.Error().Err(err).Msg("[go-doudou] failed to encode kv state")
+		return nil
+	}
+	return buf
 }
 
 // MergeRemoteState gets user data from remote node by tcp connection when pushPull-ing state with other node
 func (d *delegate) MergeRemoteState(s []byte, join bool) {
+	if d.kv == nil || len(s) == 0 || messageType(s[0]) != kvMsg {
+		return
+	}
+	var state kvState
+	if err := decodeMessage(s[1:], &state); err != nil {
+		logger.Error().Err(err).Msg("[go-doudou] failed to decode kv state")
+		return
+	}
+	d.kv.mergeState(state)
+}
+
+// clusterDelegate stops nodes of different cluster name from joining
+type clusterDelegate struct {
+	cluster string
+}
+
+func (c *clusterDelegate) check(node *memberlist.Node) error {
+	meta, _ := ParseMeta(node)
+	if meta.Cluster != c.cluster {
+		return fmt.Errorf("node %s belongs to cluster %q other than %q", node.Name, meta.Cluster, c.cluster)
+	}
+	return nil
+}
+
+// NotifyAlive rejects alive message of node from other cluster
+func (c *clusterDelegate) NotifyAlive(peer *memberlist.Node) error {
+	return c.check(peer)
+}
+
+// NotifyMerge cancels merging state of nodes from other cluster
+func (c *clusterDelegate) NotifyMerge(peers []*memberlist.Node) error {
+	for _, peer := range peers {
+		if err := c.check(peer); err != nil {
+			return err
+		}
+	}
+	return nil
 }
@@ -0,0 +1,120 @@
+package memberlist
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/unionj-cloud/go-doudou/v2/framework/registry/interfaces"
+	"github.com/unionj-cloud/go-doudou/v2/toolkit/memberlist"
+	"github.com/unionj-cloud/go-doudou/v2/toolkit/stringutils"
+)
+
+var _ IMemberlistServiceProvider = (*instanceWatcher)(nil)
+
+// instanceWatcher is an IMemberlistServiceProvider notifying all instances of a service on node changes
+type instanceWatcher struct {
+	name      string
+	lock      sync.Mutex
+	instances map[string]interfaces.Instance
+	fn        func([]interfaces.Instance)
+}
+
+func (w *instanceWatcher) notify() {
+	instances := make([]interfaces.Instance, 0, len(w.instances))
+	for _, instance := range w.instances {
+		instances = append(instances, instance)
+	}
+	sort.Slice(instances, func(i, j int) bool {
+		return instances[i].Addr() < instances[j].Addr()
+	})
+	w.fn(instances)
+}
+
+func (w *instanceWatcher) AddNode(node *memberlist.Node) {
+	meta, _ := ParseMeta(node)
+	var service Service
+	for _, item := range meta.Services {
+		if item.Name == w.name {
+			service = item
+			break
+		}
+	}
+	if stringutils.IsEmpty(service.Name) {
+		return
+	}
+	metadata := make(map[string]string)
+	for k, v := range service.Data {
+		if b, ok := v.([]byte); ok {
+			// msgpack decodes strings in interface{} as raw bytes
+			metadata[k] = string(b)
+			continue
+		}
+		metadata[k] = fmt.Sprint(v)
+	}
+	weight := meta.Weight
+	if weight <= 0 {
+		// weight is computed and gossiped by node itself
+		weight = node.Weight
+	}
+	metadata["weight"] = strconv.Itoa(weight)
+	metadata["rootPath"] = service.RouteRootPath
+	if stringutils.IsNotEmpty(meta.Version) {
+		metadata["version"] = meta.Version
+	}
+	if stringutils.IsNotEmpty(meta.Zone) {
+		metadata["zone"] = meta.Zone
+	}
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	w.instances[node.Name] = interfaces.NewInstance(w.name, service.Host, service.Port, metadata)
+	w.notify()
+}
+
+func (w *instanceWatcher) UpdateWeight(node *memberlist.Node) {
+	meta, _ := ParseMeta(node)
+	if meta.Weight > 0 {
+		return
+	}
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	instance, exists := w.instances[node.Name]
+	if !exists {
+		return
+	}
+	metadata := make(map[string]string, len(instance.Metadata))
+	for k, v := range instance.Metadata {
+		metadata[k] = v
+	}
+	metadata["weight"] = strconv.Itoa(node.Weight)
+	instance.Weight = node.Weight
+	instance.Metadata = metadata
+	w.instances[node.Name] = instance
+	w.notify()
+}
+
+func (w *instanceWatcher) RemoveNode(node *memberlist.Node) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if _, exists := w.instances[node.Name]; exists {
+		delete(w.instances, node.Name)
+		w.notify()
+	}
+}
+
+// WatchInstances calls fn with all instances of service each time they change, until stop is called
+func WatchInstances(service string, fn func([]interfaces.Instance)) (stop func()) {
+	w := &instanceWatcher{
+		name:      service,
+		instances: make(map[string]interfaces.Instance),
+		fn:        fn,
+	}
+	RegisterServiceProvider(w)
+	w.lock.Lock()
+	w.notify()
+	w.lock.Unlock()
+	return func() {
+		UnregisterServiceProvider(w)
+	}
+}
@@ -0,0 +1,52 @@
+package memberlist
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/unionj-cloud/go-doudou/v2/framework/registry/constants"
+	"github.com/unionj-cloud/go-doudou/v2/framework/registry/interfaces"
+	"github.com/unionj-cloud/go-doudou/v2/toolkit/memberlist"
+)
+
+func newNode(name string, weight int, meta NodeMeta) *memberlist.Node {
+	d := &delegate{meta: meta}
+	return &memberlist.Node{Name: name, Meta: d.NodeMeta(512), Weight: weight}
+}
+
+func TestWatchInstances(t *testing.T) {
+	var got []interfaces.Instance
+	stop := WatchInstances("usersvc_rest", func(instances []interfaces.Instance) {
+		got = instances
+	})
+	require.Empty(t, got)
+
+	node1 := newNode("node1", 3, NodeMeta{
+		Services: []Service{{Name: "usersvc_rest", Host: "10.0.0.1", Port: 6060, RouteRootPath: "/v1", Type: constants.REST_TYPE,
+			Data: map[string]interface{}{"env": "canary"}}},
+		Zone: "zone-a",
+	})
+	node2 := newNode("node2", 0, NodeMeta{
+		Services: []Service{{Name: "ordersvc_rest", Host: "10.0.0.2", Port: 6060, Type: constants.REST_TYPE}},
+		Weight:   5,
+	})
+	events.NotifyJoin(node1)
+	events.NotifyJoin(node2)
+	require.Len(t, got, 1)
+	require.Equal(t, "10.0.0.1:6060", got[0].Addr())
+	require.Equal(t, "/v1", got[0].RootPath)
+	require.Equal(t, "zone-a", got[0].Zone)
+	require.Equal(t, 3, got[0].Weight)
+	require.Equal(t, "canary", got[0].Metadata["env"])
+
+	node1.Weight = 8
+	events.NotifyWeight(node1)
+	require.Equal(t, 8, got[0].Weight)
+
+	events.NotifyLeave(node1)
+	require.Empty(t, got)
+
+	stop()
+	events.NotifyJoin(node1)
+	require.Empty(t, got)
+}
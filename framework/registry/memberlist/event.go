@@ -0,0 +1,141 @@
+package memberlist
+
+import (
+	"sync"
+
+	"github.com/unionj-cloud/go-doudou/v2/toolkit/memberlist"
+	logger "github.com/unionj-cloud/go-doudou/v2/toolkit/zlogger"
+)
+
+// recentEventSize is how many recently received events are remembered for dropping duplicates
+const recentEventSize = 512
+
+// UserEvent is a fire-and-forget message broadcast to all nodes, e.g. for invalidating cache
+type UserEvent struct {
+	Name    string
+	Payload []byte
+	LTime   uint64
+	// Node is the name of node sending the event
+	Node string
+}
+
+type eventId struct {
+	node  string
+	ltime uint64
+}
+
+type eventSubscriber struct {
+	name string
+	fn   func(UserEvent)
+}
+
+type eventBus struct {
+	node        func() string
+	queue       *memberlist.TransmitLimitedQueue
+	clock       lamportClock
+	lock        sync.Mutex
+	recent      [recentEventSize]eventId
+	recentIdx   int
+	seen        map[eventId]struct{}
+	subscribers map[int]eventSubscriber
+	seq         int
+}
+
+func newEventBus(node func() string, queue *memberlist.TransmitLimitedQueue) *eventBus {
+	return &eventBus{
+		node:        node,
+		queue:       queue,
+		seen:        make(map[eventId]struct{}),
+		subscribers: make(map[int]eventSubscriber),
+	}
+}
+
+func (b *eventBus) send(name string, payload []byte) error {
+	event := UserEvent{
+		Name:    name,
+		Payload: payload,
+		LTime:   b.clock.Increment(),
+		Node:    b.node(),
+	}
+	msg, err := encodeMessage(userEventMsg, event)
+	if err != nil {
+		return err
+	}
+	if len(msg) > maxUserMsgSize {
+		return ErrMsgTooLarge
+	}
+	b.deliver(event)
+	b.queue.QueueBroadcast(&userBroadcast{
+		msg: msg,
+	})
+	return nil
+}
+
+func (b *eventBus) subscribe(name string, fn func(UserEvent)) (unsubscribe func()) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.seq++
+	id := b.seq
+	b.subscribers[id] = eventSubscriber{
+		name: name,
+		fn:   fn,
+	}
+	return func() {
+		b.lock.Lock()
+		defer b.lock.Unlock()
+		delete(b.subscribers, id)
+	}
+}
+
+// deliver calls subscribers of event unless it has been delivered already, as gossip may deliver
+// an event more than once
+func (b *eventBus) deliver(event UserEvent) {
+	b.clock.Witness(event.LTime)
+	id := eventId{
+		node:  event.Node,
+		ltime: event.LTime,
+	}
+	b.lock.Lock()
+	if _, ok := b.seen[id]; ok {
+		b.lock.Unlock()
+		return
+	}
+	delete(b.seen, b.recent[b.recentIdx])
+	b.recent[b.recentIdx] = id
+	b.recentIdx = (b.recentIdx + 1) % recentEventSize
+	b.seen[id] = struct{}{}
+	var fns []func(UserEvent)
+	for _, s := range b.subscribers {
+		if s.name == "" || s.name == event.Name {
+			fns = append(fns, s.fn)
+		}
+	}
+	b.lock.Unlock()
+	for _, fn := range fns {
+		fn(event)
+	}
+}
+
+func (b *eventBus) handleMsg(msg []byte) {
+	var event UserEvent
+	if err := decodeMessage(msg, &event); err != nil {
+		logger.Error().Err(err).Msg("[go-doudou] failed to decode user event")
+		return
+	}
+	b.deliver(event)
+}
+
+var userEvents *eventBus
+
+// SendEvent broadcasts user event of name with payload to all nodes including local node
+func SendEvent(name string, payload []byte) error {
+	assertMlistNotNil()
+	return userEvents.send(name, payload)
+}
+
+// SubscribeEvent calls fn on each user event of name until unsubscribe is called, all events are passed
+// to fn if name is empty. fn must not block as it is called from gossip message handler.
+func SubscribeEvent(name string, fn func(UserEvent)) (unsubscribe func()) {
+	assertMlistNotNil()
+	return userEvents.subscribe(name, fn)
+}
@@ -0,0 +1,356 @@
+package memberlist
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/unionj-cloud/go-doudou/v2/framework/internal/config"
+	"github.com/unionj-cloud/go-doudou/v2/toolkit/memberlist"
+	"github.com/unionj-cloud/go-doudou/v2/toolkit/stringutils"
+	logger "github.com/unionj-cloud/go-doudou/v2/toolkit/zlogger"
+)
+
+const (
+	keyOpInstall = "install"
+	keyOpUse     = "use"
+	keyOpRemove  = "remove"
+)
+
+// ErrEncryptionDisabled is returned from key operations if gossip encryption is not enabled
+// by GDD_MEM_SECRET_KEYS or GDD_MEM_KEYRING_FILE
+var ErrEncryptionDisabled = errors.New("gossip encryption is not enabled")
+
+type keyRequest struct {
+	ID   uint64
+	Op   string
+	Key  []byte
+	From string
+}
+
+type keyResponse struct {
+	ID    uint64
+	Node  string
+	Error string
+}
+
+// KeyResponse is the result of a key operation over the cluster
+type KeyResponse struct {
+	// NumNodes is the number of nodes the operation was sent to, including local node
+	NumNodes int `json:"numNodes"`
+	// NumResp is the number of nodes responded
+	NumResp int `json:"numResp"`
+	// NumErr is the number of nodes failed or not responded in time
+	NumErr int `json:"numErr"`
+	// Messages holds error messages keyed by node name
+	Messages map[string]string `json:"messages,omitempty"`
+}
+
+// keyManager rotates gossip encryption keys of all nodes in the cluster
+type keyManager struct {
+	mlist   memberlist.IMemberlist
+	keyring *memberlist.Keyring
+	file    string
+	// opLock makes sure only one key operation is in progress
+	opLock  sync.Mutex
+	lock    sync.Mutex
+	seq     uint64
+	pending map[uint64]chan keyResponse
+}
+
+func newKeyManager(keyring *memberlist.Keyring, file string) *keyManager {
+	return &keyManager{
+		keyring: keyring,
+		file:    file,
+		pending: make(map[uint64]chan keyResponse),
+	}
+}
+
+func decodeKeys(encoded []string) ([][]byte, error) {
+	var keys [][]byte
+	for _, item := range encoded {
+		item = strings.TrimSpace(item)
+		if stringutils.IsEmpty(item) {
+			continue
+		}
+		key, err := base64.StdEncoding.DecodeString(item)
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid base64 encoded key")
+		}
+		if err = memberlist.ValidateKey(key); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// loadKeyring loads keys from GDD_MEM_KEYRING_FILE or GDD_MEM_SECRET_KEYS, nil is returned if no key set
+func loadKeyring() (*memberlist.Keyring, error) {
+	var encoded []string
+	file := config.GddMemKeyringFile.LoadOrDefault(config.DefaultGddMemKeyringFile)
+	if stringutils.IsNotEmpty(file) {
+		content, err := ioutil.ReadFile(file)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, errors.Wrapf(err, "failed to read keyring file %s", file)
+		}
+		if len(content) > 0 {
+			if err = json.Unmarshal(content, &encoded); err != nil {
+				return nil, errors.Wrapf(err, "failed to parse keyring file %s", file)
+			}
+		}
+	}
+	if len(encoded) == 0 {
+		encoded = strings.Split(config.GddMemSecretKeys.LoadOrDefault(config.DefaultGddMemSecretKeys), ",")
+	}
+	keys, err := decodeKeys(encoded)
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	keyring, err := memberlist.NewKeyring(keys[1:], keys[0])
+	if err != nil {
+		return nil, err
+	}
+	if stringutils.IsNotEmpty(file) {
+		if err = persistKeyring(keyring, file); err != nil {
+			return nil, err
+		}
+	}
+	return keyring, nil
+}
+
+func persistKeyring(keyring *memberlist.Keyring, file string) error {
+	var encoded []string
+	// primary key always comes first
+	for _, key := range keyring.GetKeys() {
+		encoded = append(encoded, base64.StdEncoding.EncodeToString(key))
+	}
+	content, _ := json.Marshal(encoded)
+	if err := ioutil.WriteFile(file, content, 0600); err != nil {
+		return errors.Wrapf(err, "failed to write keyring file %s", file)
+	}
+	return nil
+}
+
+func (m *keyManager) apply(op string, key []byte) error {
+	if m.keyring == nil {
+		return ErrEncryptionDisabled
+	}
+	var err error
+	switch op {
+	case keyOpInstall:
+		err = m.keyring.AddKey(key)
+	case keyOpUse:
+		err = m.keyring.UseKey(key)
+	case keyOpRemove:
+		err = m.keyring.RemoveKey(key)
+	default:
+		err = errors.Errorf("unknown key operation %s", op)
+	}
+	if err != nil {
+		return err
+	}
+	if stringutils.IsNotEmpty(m.file) {
+		return persistKeyring(m.keyring, m.file)
+	}
+	return nil
+}
+
+func (m *keyManager) handleRequest(msg []byte) {
+	var req keyRequest
+	if err := decodeMessage(msg, &req); err != nil {
+		logger.Error().Err(err).Msg("[go-doudou] failed to decode key request")
+		return
+	}
+	resp := keyResponse{
+		ID:   req.ID,
+		Node: m.mlist.LocalNode().Name,
+	}
+	if err := m.apply(req.Op, req.Key); err != nil {
+		resp.Error = err.Error()
+	}
+	out, err := encodeMessage(keyResponseMsg, resp)
+	if err != nil {
+		logger.Error().Err(err).Msg("[go-doudou] failed to encode key response")
+		return
+	}
+	for _, node := range m.mlist.Members() {
+		if node.Name == req.From {
+			if err = m.mlist.SendReliable(node, out); err != nil {
+				logger.Error().Err(err).Msgf("[go-doudou] failed to send key response to %s", req.From)
+			}
+			return
+		}
+	}
+}
+
+func (m *keyManager) handleResponse(msg []byte) {
+	var resp keyResponse
+	if err := decodeMessage(msg, &resp); err != nil {
+		logger.Error().Err(err).Msg("[go-doudou] failed to decode key response")
+		return
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if ch, ok := m.pending[resp.ID]; ok {
+		select {
+		case ch <- resp:
+		default:
+		}
+	}
+}
+
+// do applies op to local node, then sends it to all other nodes and waits for their responses until timeout
+func (m *keyManager) do(op string, encoded string, timeout time.Duration) (KeyResponse, error) {
+	decoded, err := decodeKeys([]string{encoded})
+	if err != nil {
+		return KeyResponse{}, err
+	}
+	if len(decoded) == 0 {
+		return KeyResponse{}, errors.New("key is required")
+	}
+	if m.keyring == nil {
+		return KeyResponse{}, ErrEncryptionDisabled
+	}
+	m.opLock.Lock()
+	defer m.opLock.Unlock()
+
+	local := m.mlist.LocalNode()
+	result := KeyResponse{
+		NumNodes: 1,
+		Messages: make(map[string]string),
+	}
+	if err = m.apply(op, decoded[0]); err != nil {
+		result.NumErr++
+		result.Messages[local.Name] = err.Error()
+	}
+	result.NumResp++
+
+	m.lock.Lock()
+	m.seq++
+	id := m.seq
+	members := m.mlist.Members()
+	ch := make(chan keyResponse, len(members))
+	m.pending[id] = ch
+	m.lock.Unlock()
+	defer func() {
+		m.lock.Lock()
+		delete(m.pending, id)
+		m.lock.Unlock()
+	}()
+
+	msg, err := encodeMessage(keyRequestMsg, keyRequest{
+		ID:   id,
+		Op:   op,
+		Key:  decoded[0],
+		From: local.Name,
+	})
+	if err != nil {
+		return result, err
+	}
+	waiting := make(map[string]struct{})
+	for _, node := range members {
+		if node.Name == local.Name {
+			continue
+		}
+		result.NumNodes++
+		if err = m.mlist.SendReliable(node, msg); err != nil {
+			result.NumErr++
+			result.Messages[node.Name] = err.Error()
+			continue
+		}
+		waiting[node.Name] = struct{}{}
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for len(waiting) > 0 {
+		select {
+		case resp := <-ch:
+			if _, ok := waiting[resp.Node]; !ok {
+				continue
+			}
+			delete(waiting, resp.Node)
+			result.NumResp++
+			if stringutils.IsNotEmpty(resp.Error) {
+				result.NumErr++
+				result.Messages[resp.Node] = resp.Error
+			}
+		case <-timer.C:
+			for node := range waiting {
+				result.NumErr++
+				result.Messages[node] = "no response in time"
+			}
+			waiting = nil
+		}
+	}
+	return result, nil
+}
+
+// fingerprints returns fingerprints of keys and primary key, see KeyFingerprint
+func (m *keyManager) fingerprints() (fingerprints []string, primary string, err error) {
+	if m.keyring == nil {
+		return nil, "", ErrEncryptionDisabled
+	}
+	for _, key := range m.keyring.GetKeys() {
+		fingerprints = append(fingerprints, fingerprint(key))
+	}
+	return fingerprints, fingerprint(m.keyring.GetPrimaryKey()), nil
+}
+
+func fingerprint(key []byte) string {
+	sum := sha256.Sum256(key)
+	return hex.EncodeToString(sum[:])[:8]
+}
+
+var keys *keyManager
+
+func keyOpTimeout() time.Duration {
+	return mlist.Config().TCPTimeout
+}
+
+// InstallKey installs base64 encoded key to keyring of all nodes. It is the first step of key rotation,
+// nodes are able to decrypt messages encrypted by the new key afterwards.
+func InstallKey(key string) (KeyResponse, error) {
+	assertMlistNotNil()
+	return keys.do(keyOpInstall, key, keyOpTimeout())
+}
+
+// UseKey makes installed base64 encoded key primary key of all nodes. It is the second step of key rotation,
+// nodes encrypt messages by the new key afterwards.
+func UseKey(key string) (KeyResponse, error) {
+	assertMlistNotNil()
+	return keys.do(keyOpUse, key, keyOpTimeout())
+}
+
+// RemoveKey removes base64 encoded key from keyring of all nodes. It is the last step of key rotation,
+// primary key cannot be removed.
+func RemoveKey(key string) (KeyResponse, error) {
+	assertMlistNotNil()
+	return keys.do(keyOpRemove, key, keyOpTimeout())
+}
+
+// ListKeyFingerprints returns fingerprints of keys and primary key in local keyring, keys themselves are
+// never exposed. Fingerprint of a base64 encoded key can be computed by KeyFingerprint to check it's installed.
+func ListKeyFingerprints() (fingerprints []string, primary string, err error) {
+	assertMlistNotNil()
+	return keys.fingerprints()
+}
+
+// KeyFingerprint returns the first 8 hex characters of sha256 of base64 encoded key
+func KeyFingerprint(key string) (string, error) {
+	raw, err := base64.StdEncoding.DecodeString(key)
+	if err != nil {
+		return "", errors.Wrap(err, "invalid key")
+	}
+	return fingerprint(raw), nil
+}
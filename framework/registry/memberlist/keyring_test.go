@@ -0,0 +1,166 @@
+package memberlist
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/unionj-cloud/go-doudou/v2/framework/internal/config"
+	"github.com/unionj-cloud/go-doudou/v2/toolkit/memberlist"
+)
+
+func encodedKey(b byte) string {
+	key := make([]byte, 16)
+	for i := range key {
+		key[i] = b
+	}
+	return base64.StdEncoding.EncodeToString(key)
+}
+
+// list returns raw keys encoded by base64 for assertions only, never expose them out of tests
+func (m *keyManager) list() (keys []string, primary string, err error) {
+	if m.keyring == nil {
+		return nil, "", ErrEncryptionDisabled
+	}
+	for _, key := range m.keyring.GetKeys() {
+		keys = append(keys, base64.StdEncoding.EncodeToString(key))
+	}
+	return keys, base64.StdEncoding.EncodeToString(m.keyring.GetPrimaryKey()), nil
+}
+
+func TestLoadKeyring(t *testing.T) {
+	t.Setenv(string(config.GddMemSecretKeys), "")
+	t.Setenv(string(config.GddMemKeyringFile), "")
+	keyring, err := loadKeyring()
+	require.NoError(t, err)
+	require.Nil(t, keyring)
+
+	t.Setenv(string(config.GddMemSecretKeys), "invalid")
+	_, err = loadKeyring()
+	require.Error(t, err)
+
+	t.Setenv(string(config.GddMemSecretKeys), encodedKey(1)+","+encodedKey(2))
+	keyring, err = loadKeyring()
+	require.NoError(t, err)
+	require.Len(t, keyring.GetKeys(), 2)
+	require.Equal(t, encodedKey(1), base64.StdEncoding.EncodeToString(keyring.GetPrimaryKey()))
+
+	file := filepath.Join(t.TempDir(), "keyring.json")
+	t.Setenv(string(config.GddMemKeyringFile), file)
+	_, err = loadKeyring()
+	require.NoError(t, err)
+	content, err := ioutil.ReadFile(file)
+	require.NoError(t, err)
+	require.JSONEq(t, fmt.Sprintf(`["%s","%s"]`, encodedKey(1), encodedKey(2)), string(content))
+
+	// keys in keyring file take precedence
+	content, _ = json.Marshal([]string{encodedKey(3)})
+	require.NoError(t, ioutil.WriteFile(file, content, 0600))
+	keyring, err = loadKeyring()
+	require.NoError(t, err)
+	require.Len(t, keyring.GetKeys(), 1)
+	require.Equal(t, encodedKey(3), base64.StdEncoding.EncodeToString(keyring.GetPrimaryKey()))
+}
+
+func newTestNode(t *testing.T, name, cluster string, keyring *memberlist.Keyring) (*memberlist.Memberlist, *delegate) {
+	conf := memberlist.DefaultLANConfig()
+	conf.Name = name
+	conf.BindAddr = "127.0.0.1"
+	conf.BindPort = 0
+	conf.GossipInterval = 20 * time.Millisecond
+	conf.LogOutput = ioutil.Discard
+	conf.Keyring = keyring
+	var m *memberlist.Memberlist
+	queue := &memberlist.TransmitLimitedQueue{
+		NumNodes: func() int {
+			return m.NumMembers()
+		},
+		RetransmitMult: conf.RetransmitMult,
+	}
+	localName := func() string {
+		return name
+	}
+	d := &delegate{
+		meta:  NodeMeta{Cluster: cluster},
+		queue: queue,
+		keys:  newKeyManager(keyring, ""),
+		kv:    newKVStore(localName, queue),
+		ev:    newEventBus(localName, queue),
+	}
+	conf.Delegate = d
+	cd := &clusterDelegate{cluster: cluster}
+	conf.Alive = cd
+	conf.Merge = cd
+	var err error
+	m, err = memberlist.Create(conf)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		m.Shutdown()
+	})
+	d.keys.mlist = m
+	return m, d
+}
+
+func TestClusterName(t *testing.T) {
+	m1, _ := newTestNode(t, "node1", "prod", nil)
+	m2, _ := newTestNode(t, "node2", "test", nil)
+	_, err := m2.Join([]string{m1.LocalNode().FullAddress().Addr})
+	require.Error(t, err)
+	require.Equal(t, 1, m1.NumMembers())
+
+	m3, _ := newTestNode(t, "node3", "prod", nil)
+	_, err = m3.Join([]string{m1.LocalNode().FullAddress().Addr})
+	require.NoError(t, err)
+	require.Equal(t, 2, m3.NumMembers())
+}
+
+func TestKeyRotation(t *testing.T) {
+	keyring1, _ := memberlist.NewKeyring(nil, []byte("0123456789abcdef"))
+	keyring2, _ := memberlist.NewKeyring(nil, []byte("0123456789abcdef"))
+	m1, d1 := newTestNode(t, "node1", "", keyring1)
+	m2, d2 := newTestNode(t, "node2", "", keyring2)
+	km1, km2 := d1.keys, d2.keys
+	_, err := m2.Join([]string{m1.LocalNode().FullAddress().Addr})
+	require.NoError(t, err)
+
+	oldKey := base64.StdEncoding.EncodeToString([]byte("0123456789abcdef"))
+	newKey := encodedKey(7)
+	resp, err := km1.do(keyOpInstall, newKey, 5*time.Second)
+	require.NoError(t, err)
+	require.Equal(t, KeyResponse{NumNodes: 2, NumResp: 2, Messages: map[string]string{}}, resp)
+	keys, _, _ := km2.list()
+	require.ElementsMatch(t, []string{oldKey, newKey}, keys)
+
+	resp, err = km1.do(keyOpUse, newKey, 5*time.Second)
+	require.NoError(t, err)
+	require.Zero(t, resp.NumErr)
+	_, primary, _ := km2.list()
+	require.Equal(t, newKey, primary)
+
+	resp, err = km1.do(keyOpRemove, newKey, 5*time.Second)
+	require.NoError(t, err)
+	require.Equal(t, 2, resp.NumErr)
+
+	resp, err = km1.do(keyOpRemove, oldKey, 5*time.Second)
+	require.NoError(t, err)
+	require.Zero(t, resp.NumErr)
+	keys, _, _ = km2.list()
+	require.Equal(t, []string{newKey}, keys)
+	require.Equal(t, 2, m1.NumMembers())
+
+	fingerprints, primary, err := km2.fingerprints()
+	require.NoError(t, err)
+	fp, err := KeyFingerprint(newKey)
+	require.NoError(t, err)
+	require.Len(t, fp, 8)
+	require.Equal(t, []string{fp}, fingerprints)
+	require.Equal(t, fp, primary)
+
+	_, err = newKeyManager(nil, "").do(keyOpInstall, newKey, time.Second)
+	require.ErrorIs(t, err, ErrEncryptionDisabled)
+}
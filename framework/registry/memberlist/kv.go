@@ -0,0 +1,287 @@
+package memberlist
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/unionj-cloud/go-doudou/v2/toolkit/memberlist"
+	logger "github.com/unionj-cloud/go-doudou/v2/toolkit/zlogger"
+)
+
+// maxUserMsgSize limits encoded size of kv entries and user events, so that they fit in a single gossip packet
+const maxUserMsgSize = 1024
+
+// kvTombstoneTTL is how long deleted keys are remembered for stopping stale replicas from bringing them back
+var kvTombstoneTTL = time.Hour
+
+// ErrMsgTooLarge is returned if encoded kv entry or user event exceeds the size limit of gossip message
+var ErrMsgTooLarge = errors.Errorf("message exceeds size limit of %d bytes", maxUserMsgSize)
+
+// lamportClock is a thread safe Lamport logical clock
+type lamportClock struct {
+	counter uint64
+}
+
+// Time returns current time of the clock
+func (l *lamportClock) Time() uint64 {
+	return atomic.LoadUint64(&l.counter)
+}
+
+// Increment increments and returns the time of the clock
+func (l *lamportClock) Increment() uint64 {
+	return atomic.AddUint64(&l.counter, 1)
+}
+
+// Witness updates the clock on receiving time v from other node
+func (l *lamportClock) Witness(v uint64) {
+	for {
+		cur := atomic.LoadUint64(&l.counter)
+		if v < cur {
+			return
+		}
+		if atomic.CompareAndSwapUint64(&l.counter, cur, v+1) {
+			return
+		}
+	}
+}
+
+type userBroadcast struct {
+	name string
+	msg  []byte
+}
+
+func (b *userBroadcast) Invalidates(other memberlist.Broadcast) bool {
+	if b.name == "" {
+		return false
+	}
+	ob, ok := other.(*userBroadcast)
+	return ok && ob.name == b.name
+}
+
+func (b *userBroadcast) Name() string {
+	return b.name
+}
+
+func (b *userBroadcast) Message() []byte {
+	return b.msg
+}
+
+func (b *userBroadcast) Finished() {}
+
+type kvEntry struct {
+	Key     string
+	Value   []byte
+	LTime   uint64
+	Node    string
+	Deleted bool
+	// ExpireAt is unix nano time after which the entry is gone, 0 means never
+	ExpireAt int64
+}
+
+func (e kvEntry) expired(now time.Time) bool {
+	return e.ExpireAt > 0 && now.UnixNano() >= e.ExpireAt
+}
+
+// newerThan resolves conflicts by last writer wins, ties are broken by node name
+func (e kvEntry) newerThan(o kvEntry) bool {
+	if e.LTime != o.LTime {
+		return e.LTime > o.LTime
+	}
+	return e.Node > o.Node
+}
+
+// KVEvent is passed to watchers on change of key
+type KVEvent struct {
+	Key     string
+	Value   []byte
+	Deleted bool
+}
+
+type kvWatcher struct {
+	prefix string
+	fn     func(KVEvent)
+}
+
+type kvState struct {
+	Clock   uint64
+	Entries []kvEntry
+}
+
+// KVStore is an eventually consistent key-value store replicated to all nodes by gossip. Conflicts are
+// resolved by last writer wins on Lamport clock, so it suits configuration like data rather than counters.
+type KVStore struct {
+	node     func() string
+	queue    *memberlist.TransmitLimitedQueue
+	clock    lamportClock
+	lock     sync.RWMutex
+	entries  map[string]kvEntry
+	watchers map[int]kvWatcher
+	seq      int
+}
+
+func newKVStore(node func() string, queue *memberlist.TransmitLimitedQueue) *KVStore {
+	return &KVStore{
+		node:     node,
+		queue:    queue,
+		entries:  make(map[string]kvEntry),
+		watchers: make(map[int]kvWatcher),
+	}
+}
+
+func (s *KVStore) write(entry kvEntry) error {
+	entry.LTime = s.clock.Increment()
+	entry.Node = s.node()
+	msg, err := encodeMessage(kvMsg, entry)
+	if err != nil {
+		return err
+	}
+	if len(msg) > maxUserMsgSize {
+		return ErrMsgTooLarge
+	}
+	s.merge(entry)
+	s.queue.QueueBroadcast(&userBroadcast{
+		name: "kv:" + entry.Key,
+		msg:  msg,
+	})
+	return nil
+}
+
+// Put sets value of key on all nodes. The key expires after ttl if ttl is greater than 0.
+func (s *KVStore) Put(key string, value []byte, ttl time.Duration) error {
+	entry := kvEntry{
+		Key:   key,
+		Value: value,
+	}
+	if ttl > 0 {
+		entry.ExpireAt = time.Now().Add(ttl).UnixNano()
+	}
+	return s.write(entry)
+}
+
+// Delete removes key from all nodes
+func (s *KVStore) Delete(key string) error {
+	return s.write(kvEntry{
+		Key:      key,
+		Deleted:  true,
+		ExpireAt: time.Now().Add(kvTombstoneTTL).UnixNano(),
+	})
+}
+
+// Get returns value of key
+func (s *KVStore) Get(key string) ([]byte, bool) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	entry, ok := s.entries[key]
+	if !ok || entry.Deleted || entry.expired(time.Now()) {
+		return nil, false
+	}
+	return entry.Value, true
+}
+
+// Keys returns all keys starting with prefix
+func (s *KVStore) Keys(prefix string) []string {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	now := time.Now()
+	var keys []string
+	for key, entry := range s.entries {
+		if entry.Deleted || entry.expired(now) || !strings.HasPrefix(key, prefix) {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// Watch calls fn each time a key starting with prefix is put or deleted until cancel is called.
+// Expiration is not notified. fn must not block as it is called from gossip message handler.
+func (s *KVStore) Watch(prefix string, fn func(KVEvent)) (cancel func()) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.seq++
+	id := s.seq
+	s.watchers[id] = kvWatcher{
+		prefix: prefix,
+		fn:     fn,
+	}
+	return func() {
+		s.lock.Lock()
+		defer s.lock.Unlock()
+		delete(s.watchers, id)
+	}
+}
+
+// merge applies entry if it is newer than local one, and notifies watchers
+func (s *KVStore) merge(entry kvEntry) {
+	s.clock.Witness(entry.LTime)
+	if entry.expired(time.Now()) {
+		return
+	}
+	s.lock.Lock()
+	if current, ok := s.entries[entry.Key]; ok && !entry.newerThan(current) {
+		s.lock.Unlock()
+		return
+	}
+	s.entries[entry.Key] = entry
+	var fns []func(KVEvent)
+	for _, w := range s.watchers {
+		if strings.HasPrefix(entry.Key, w.prefix) {
+			fns = append(fns, w.fn)
+		}
+	}
+	s.lock.Unlock()
+	event := KVEvent{
+		Key:     entry.Key,
+		Value:   entry.Value,
+		Deleted: entry.Deleted,
+	}
+	for _, fn := range fns {
+		fn(event)
+	}
+}
+
+func (s *KVStore) handleMsg(msg []byte) {
+	var entry kvEntry
+	if err := decodeMessage(msg, &entry); err != nil {
+		logger.Error().Err(err).Msg("[go-doudou] failed to decode kv entry")
+		return
+	}
+	s.merge(entry)
+}
+
+// localState returns all entries for push-pull anti-entropy, expired entries are dropped meanwhile
+func (s *KVStore) localState() kvState {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	now := time.Now()
+	state := kvState{
+		Clock:   s.clock.Time(),
+		Entries: make([]kvEntry, 0, len(s.entries)),
+	}
+	for key, entry := range s.entries {
+		if entry.expired(now) {
+			delete(s.entries, key)
+			continue
+		}
+		state.Entries = append(state.Entries, entry)
+	}
+	return state
+}
+
+func (s *KVStore) mergeState(state kvState) {
+	s.clock.Witness(state.Clock)
+	for _, entry := range state.Entries {
+		s.merge(entry)
+	}
+}
+
+var kv *KVStore
+
+// KV returns key-value store replicated to all nodes in the cluster
+func KV() *KVStore {
+	assertMlistNotNil()
+	return kv
+}
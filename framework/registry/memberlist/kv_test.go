@@ -0,0 +1,113 @@
+package memberlist
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLamportClock(t *testing.T) {
+	var clock lamportClock
+	require.Equal(t, uint64(1), clock.Increment())
+	clock.Witness(10)
+	require.Equal(t, uint64(11), clock.Time())
+	clock.Witness(5)
+	require.Equal(t, uint64(11), clock.Time())
+}
+
+func TestKVStore(t *testing.T) {
+	m1, d1 := newTestNode(t, "node1", "", nil)
+	m2, d2 := newTestNode(t, "node2", "", nil)
+	require.NoError(t, d1.kv.Put("before-join", []byte("a"), 0))
+	_, err := m2.Join([]string{m1.LocalNode().FullAddress().Addr})
+	require.NoError(t, err)
+	// entries written before joining are synchronized by push-pull
+	value, ok := d2.kv.Get("before-join")
+	require.True(t, ok)
+	require.Equal(t, []byte("a"), value)
+
+	var lock sync.Mutex
+	var watched []KVEvent
+	cancel := d2.kv.Watch("flags/", func(event KVEvent) {
+		lock.Lock()
+		defer lock.Unlock()
+		watched = append(watched, event)
+	})
+	require.NoError(t, d1.kv.Put("flags/dark-mode", []byte("on"), 0))
+	require.Eventually(t, func() bool {
+		value, ok := d2.kv.Get("flags/dark-mode")
+		return ok && string(value) == "on"
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, []string{"flags/dark-mode"}, d2.kv.Keys("flags/"))
+
+	require.NoError(t, d2.kv.Delete("flags/dark-mode"))
+	require.Eventually(t, func() bool {
+		_, ok := d1.kv.Get("flags/dark-mode")
+		return !ok
+	}, 5*time.Second, 10*time.Millisecond)
+	cancel()
+
+	lock.Lock()
+	require.Equal(t, []KVEvent{
+		{Key: "flags/dark-mode", Value: []byte("on")},
+		{Key: "flags/dark-mode", Deleted: true},
+	}, watched)
+	lock.Unlock()
+
+	require.NoError(t, d1.kv.Put("ttl", []byte("a"), 50*time.Millisecond))
+	_, ok = d1.kv.Get("ttl")
+	require.True(t, ok)
+	time.Sleep(60 * time.Millisecond)
+	_, ok = d1.kv.Get("ttl")
+	require.False(t, ok)
+
+	require.ErrorIs(t, d1.kv.Put("large", make([]byte, maxUserMsgSize), 0), ErrMsgTooLarge)
+}
+
+func TestKVStoreLastWriterWins(t *testing.T) {
+	s := newKVStore(func() string { return "node1" }, nil)
+	s.merge(kvEntry{Key: "k", Value: []byte("b"), LTime: 5, Node: "node2"})
+	s.merge(kvEntry{Key: "k", Value: []byte("a"), LTime: 4, Node: "node3"})
+	s.merge(kvEntry{Key: "k", Value: []byte("c"), LTime: 5, Node: "node1"})
+	value, _ := s.Get("k")
+	require.Equal(t, []byte("b"), value)
+	s.merge(kvEntry{Key: "k", Value: []byte("d"), LTime: 5, Node: "node3"})
+	value, _ = s.Get("k")
+	require.Equal(t, []byte("d"), value)
+	require.Equal(t, uint64(6), s.clock.Time())
+}
+
+func TestUserEvent(t *testing.T) {
+	m1, d1 := newTestNode(t, "node1", "", nil)
+	m2, d2 := newTestNode(t, "node2", "", nil)
+	_, err := m2.Join([]string{m1.LocalNode().FullAddress().Addr})
+	require.NoError(t, err)
+
+	var lock sync.Mutex
+	var received []UserEvent
+	unsubscribe := d2.ev.subscribe("invalidate-cache", func(event UserEvent) {
+		lock.Lock()
+		defer lock.Unlock()
+		received = append(received, event)
+	})
+	defer unsubscribe()
+	require.NoError(t, d1.ev.send("reload-flags", nil))
+	require.NoError(t, d1.ev.send("invalidate-cache", []byte("users")))
+	require.Eventually(t, func() bool {
+		lock.Lock()
+		defer lock.Unlock()
+		return len(received) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	lock.Lock()
+	require.Equal(t, []byte("users"), received[0].Payload)
+	require.Equal(t, "node1", received[0].Node)
+	lock.Unlock()
+
+	// duplicated delivery by gossip is dropped
+	d2.ev.deliver(received[0])
+	lock.Lock()
+	require.Len(t, received, 1)
+	lock.Unlock()
+}
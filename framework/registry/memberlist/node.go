@@ -2,6 +2,7 @@ package memberlist
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"github.com/apolloconfig/agollo/v4/storage"
 	"github.com/hashicorp/go-msgpack/codec"
@@ -10,6 +11,7 @@ import (
 	"github.com/unionj-cloud/go-doudou/v2/framework/buildinfo"
 	"github.com/unionj-cloud/go-doudou/v2/framework/configmgr"
 	"github.com/unionj-cloud/go-doudou/v2/framework/internal/config"
+	"github.com/unionj-cloud/go-doudou/v2/framework/lifecycle"
 	cons "github.com/unionj-cloud/go-doudou/v2/framework/registry/constants"
 	"github.com/unionj-cloud/go-doudou/v2/toolkit/cast"
 	"github.com/unionj-cloud/go-doudou/v2/toolkit/constants"
@@ -73,18 +75,56 @@ func init() {
 			BuildUser:  buildinfo.BuildUser,
 			BuildTime:  buildTime,
 			Weight:     weight,
+			Version:    config.GddServiceVersion.LoadOrDefault(config.DefaultGddServiceVersion),
+			Zone:       config.GddServiceZone.LoadOrDefault(config.DefaultGddServiceZone),
+			Cluster:    config.GddMemClusterName.LoadOrDefault(config.DefaultGddMemClusterName),
 		},
 		queue: queue,
 	}
+	keys = newKeyManager(mconf.Keyring, config.GddMemKeyringFile.LoadOrDefault(config.DefaultGddMemKeyringFile))
+	delegator.keys = keys
+	localName := func() string {
+		return mlist.LocalNode().Name
+	}
+	kv = newKVStore(localName, queue)
+	delegator.kv = kv
+	userEvents = newEventBus(localName, queue)
+	delegator.ev = userEvents
 	mconf.Delegate = delegator
 	mconf.Events = events
+	cluster := &clusterDelegate{
+		cluster: delegator.meta.Cluster,
+	}
+	mconf.Alive = cluster
+	mconf.Merge = cluster
 	var err error
 	if mlist, err = createMemberlist(mconf); err != nil {
 		panic(errors.Wrap(err, "[go-doudou] Failed to create memberlist"))
 	}
+	keys.mlist = mlist
+	interval, minMembers := rejoinInterval(), rejoinMinMembers()
+	rejoin = newRejoiner(mlist, configuredSeedProviders, interval, minMembers)
+	registerMetrics()
+	// rejoining is enabled only if GDD_MEM_REJOIN_MIN_MEMBERS is set explicitly
+	rejoinEnabled := interval > 0 && minMembers > 0
 	if err = join(); err != nil {
-		mlist.Shutdown()
-		panic(errors.Wrap(err, "[go-doudou] Node register failed"))
+		if !rejoinEnabled {
+			mlist.Shutdown()
+			panic(errors.Wrap(err, "[go-doudou] Node register failed"))
+		}
+		// seeds may be not ready yet, keep trying in background
+		logger.Error().Err(err).Msg("[go-doudou] Node register failed, will retry later")
+	}
+	if rejoinEnabled {
+		go rejoin.run()
+		lifecycle.Append(lifecycle.Hook{
+			Name:     "memberlist rejoin",
+			Priority: lifecycle.PriorityResource,
+			OnStop: func(ctx context.Context) error {
+				rejoin.close()
+				return nil
+			},
+		})
 	}
 	local := mlist.LocalNode()
 	logger.Info().Msgf("memberlist created. local node is Node %s, memberlist port %s", local.Name, fmt.Sprint(local.Port))
@@ -115,21 +155,7 @@ func seeds(seedstr string) []string {
 
 func join() error {
 	assertMlistNotNil()
-	seed := config.DefaultGddMemSeed
-	if stringutils.IsNotEmpty(config.GddMemSeed.Load()) {
-		seed = config.GddMemSeed.Load()
-	}
-	s := seeds(seed)
-	if len(s) == 0 {
-		logger.Warn().Msg("No seed found")
-		return nil
-	}
-	_, err := mlist.Join(s)
-	if err != nil {
-		return errors.Wrap(err, "[go-doudou] Failed to join cluster")
-	}
-	logger.Info().Msgf("Node %s joined cluster successfully", mlist.LocalNode().FullAddress())
-	return nil
+	return rejoin.join(context.Background())
 }
 
 // AllNodes return all memberlist nodes except dead and left nodes
@@ -164,6 +190,11 @@ func newConf() *memberlist.Config {
 		}
 	}
 	setGddMemIndirectChecks(cfg)
+	keyring, err := loadKeyring()
+	if err != nil {
+		panic(errors.Wrap(err, "[go-doudou] Failed to load gossip encryption keys"))
+	}
+	cfg.Keyring = keyring
 	minLevel := config.DefaultGddLogLevel
 	if stringutils.IsNotEmpty(config.GddLogLevel.Load()) {
 		minLevel = strings.ToUpper(config.GddLogLevel.Load())
@@ -262,51 +293,67 @@ func retransmitMultGetter() int {
 	return mconf.RetransmitMult
 }
 
-func NewRest(data ...map[string]interface{}) {
-	assertMlistNotNil()
-	service := config.GetServiceName() + "_" + string(cons.REST_TYPE)
-	httpPort := config.GetPort()
+func restService(data ...map[string]interface{}) Service {
 	rr := config.DefaultGddRouteRootPath
 	if stringutils.IsNotEmpty(config.GddRouteRootPath.Load()) {
 		rr = config.GddRouteRootPath.Load()
 	}
 	si := Service{
-		Name:          service,
+		Name:          config.GetServiceName() + "_" + string(cons.REST_TYPE),
 		Host:          mlist.AdvertiseAddr(),
-		Port:          int(httpPort),
+		Port:          int(config.GetPort()),
 		RouteRootPath: rr,
 		Type:          cons.REST_TYPE,
 	}
 	if len(data) > 0 {
 		si.Data = data[0]
 	}
-	delegator.AddService(si)
-	if err := mlist.UpdateNode(mlist.Config().TCPTimeout); err != nil {
-		panic(errors.Wrapf(err, "[go-doudou] failed to register %s service to memberlist", service))
-	}
-	logger.Info().Msgf("[go-doudou] registered %s service to memberlist successfully", service)
+	return si
 }
 
-func NewGrpc(data ...map[string]interface{}) {
-	assertMlistNotNil()
-	service := config.GetServiceName() + "_" + string(cons.GRPC_TYPE)
-	grpcPort := config.GetGrpcPort()
+func grpcService(data ...map[string]interface{}) Service {
 	si := Service{
-		Name: service,
+		Name: config.GetServiceName() + "_" + string(cons.GRPC_TYPE),
 		Host: mlist.AdvertiseAddr(),
-		Port: int(grpcPort),
+		Port: int(config.GetGrpcPort()),
 		Type: cons.GRPC_TYPE,
 	}
 	if len(data) > 0 {
 		si.Data = data[0]
 	}
-	delegator.AddService(si)
+	return si
+}
+
+// register advertises services in meta of the local node by a single update
+func register(services ...Service) {
+	var names []string
+	for _, si := range services {
+		delegator.AddService(si)
+		names = append(names, si.Name)
+	}
+	service := strings.Join(names, ", ")
 	if err := mlist.UpdateNode(mlist.Config().TCPTimeout); err != nil {
 		panic(errors.Wrapf(err, "[go-doudou] failed to register %s service to memberlist", service))
 	}
 	logger.Info().Msgf("[go-doudou] registered %s service to memberlist successfully", service)
 }
 
+func NewRest(data ...map[string]interface{}) {
+	assertMlistNotNil()
+	register(restService(data...))
+}
+
+func NewGrpc(data ...map[string]interface{}) {
+	assertMlistNotNil()
+	register(grpcService(data...))
+}
+
+// NewRestGrpc registers both rest and grpc services in meta of the local node at once
+func NewRestGrpc(data ...map[string]interface{}) {
+	assertMlistNotNil()
+	register(restService(data...), grpcService(data...))
+}
+
 type memConfigListener struct {
 	configmgr.BaseApolloListener
 	memConf *memberlist.Config
@@ -385,6 +432,9 @@ func registerConfigListener(memConf *memberlist.Config) {
 
 func Shutdown() {
 	shutdownOnce.Do(func() {
+		if rejoin != nil {
+			rejoin.close()
+		}
 		if mlist != nil {
 			_ = mlist.Shutdown()
 			mlist = nil
@@ -410,6 +460,16 @@ func RegisterServiceProvider(sp IMemberlistServiceProvider) {
 	events.ServiceProviders = append(events.ServiceProviders, sp)
 }
 
+// UnregisterServiceProvider stops notifying sp of node changes
+func UnregisterServiceProvider(sp IMemberlistServiceProvider) {
+	for i, item := range events.ServiceProviders {
+		if item == sp {
+			events.ServiceProviders = append(events.ServiceProviders[:i], events.ServiceProviders[i+1:]...)
+			return
+		}
+	}
+}
+
 func LocalNode() *memberlist.Node {
 	assertMlistNotNil()
 	return mlist.LocalNode()
@@ -0,0 +1,222 @@
+package memberlist
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/unionj-cloud/go-doudou/v2/framework/internal/config"
+	"github.com/unionj-cloud/go-doudou/v2/toolkit/cast"
+	"github.com/unionj-cloud/go-doudou/v2/toolkit/memberlist"
+	"github.com/unionj-cloud/go-doudou/v2/toolkit/stringutils"
+	logger "github.com/unionj-cloud/go-doudou/v2/toolkit/zlogger"
+)
+
+// maxMembershipEvents is how many recent membership events are kept for admin endpoint
+const maxMembershipEvents = 50
+
+// types of MembershipEvent
+const (
+	MembershipJoined      = "joined"
+	MembershipJoinFailed  = "join_failed"
+	MembershipPartitioned = "partitioned"
+	MembershipRecovered   = "recovered"
+)
+
+var (
+	rejoinCount = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "go_doudou_memberlist_join_count",
+		Help: "Number of attempts joining memberlist cluster from seeds.",
+	}, []string{"result"})
+	partitionCount = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "go_doudou_memberlist_partition_count",
+		Help: "Number of times member count dropped below GDD_MEM_REJOIN_MIN_MEMBERS.",
+	})
+)
+
+// MembershipEvent records joining and partition of local node
+type MembershipEvent struct {
+	Time    time.Time `json:"time"`
+	Type    string    `json:"type"`
+	Message string    `json:"message,omitempty"`
+}
+
+// MembershipStatus shows membership of local node for admin
+type MembershipStatus struct {
+	Members     int               `json:"members"`
+	MinMembers  int               `json:"minMembers"`
+	Partitioned bool              `json:"partitioned"`
+	Seeds       []string          `json:"seeds"`
+	Events      []MembershipEvent `json:"events"`
+}
+
+// rejoiner joins cluster from seeds and rejoins it with backoff when member count drops below minMembers
+type rejoiner struct {
+	mlist       memberlist.IMemberlist
+	providers   func() []SeedProvider
+	interval    time.Duration
+	maxInterval time.Duration
+	minMembers  int
+	lock        sync.Mutex
+	partitioned bool
+	seeds       []string
+	events      []MembershipEvent
+	// ctx is cancelled by close to stop run and abort resolving seeds and joining in progress
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func newRejoiner(ml memberlist.IMemberlist, providers func() []SeedProvider, interval time.Duration, minMembers int) *rejoiner {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &rejoiner{
+		mlist:       ml,
+		providers:   providers,
+		interval:    interval,
+		maxInterval: 10 * interval,
+		minMembers:  minMembers,
+		ctx:         ctx,
+		cancel:      cancel,
+	}
+}
+
+func (r *rejoiner) record(typ, message string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.events = append(r.events, MembershipEvent{
+		Time:    time.Now(),
+		Type:    typ,
+		Message: message,
+	})
+	if len(r.events) > maxMembershipEvents {
+		r.events = r.events[len(r.events)-maxMembershipEvents:]
+	}
+}
+
+// join joins cluster from seeds of all providers, nothing is done if there is no seed
+func (r *rejoiner) join(ctx context.Context) error {
+	s := resolveSeeds(ctx, r.providers())
+	r.lock.Lock()
+	r.seeds = s
+	r.lock.Unlock()
+	if len(s) == 0 {
+		logger.Warn().Msg("No seed found")
+		return nil
+	}
+	n, err := r.mlist.Join(s)
+	if err != nil {
+		rejoinCount.WithLabelValues("failure").Inc()
+		r.record(MembershipJoinFailed, err.Error())
+		return errors.Wrap(err, "[go-doudou] Failed to join cluster")
+	}
+	rejoinCount.WithLabelValues("success").Inc()
+	r.record(MembershipJoined, "contacted "+strconv.Itoa(n)+" nodes")
+	logger.Info().Msgf("Node %s joined cluster successfully", r.mlist.LocalNode().FullAddress())
+	return nil
+}
+
+// check rejoins cluster if member count is less than minMembers
+func (r *rejoiner) check(ctx context.Context) error {
+	members := r.mlist.NumMembers()
+	r.lock.Lock()
+	partitioned := r.partitioned
+	r.partitioned = members < r.minMembers
+	r.lock.Unlock()
+	if members >= r.minMembers {
+		if partitioned {
+			r.record(MembershipRecovered, strconv.Itoa(members)+" members")
+		}
+		return nil
+	}
+	if !partitioned {
+		partitionCount.Inc()
+		r.record(MembershipPartitioned, strconv.Itoa(members)+" members")
+		logger.Warn().Msgf("[go-doudou] only %d members in memberlist cluster, try to rejoin", members)
+	}
+	return r.join(ctx)
+}
+
+func (r *rejoiner) run() {
+	wait := r.interval
+	for {
+		select {
+		case <-r.ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+		if err := r.check(r.ctx); err != nil {
+			if r.ctx.Err() != nil {
+				return
+			}
+			logger.Error().Err(err).Msg("[go-doudou] failed to rejoin cluster")
+			if wait *= 2; wait > r.maxInterval {
+				wait = r.maxInterval
+			}
+			continue
+		}
+		wait = r.interval
+	}
+}
+
+func (r *rejoiner) close() {
+	r.cancel()
+}
+
+func (r *rejoiner) status() MembershipStatus {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	events := make([]MembershipEvent, len(r.events))
+	copy(events, r.events)
+	return MembershipStatus{
+		Members:     r.mlist.NumMembers(),
+		MinMembers:  r.minMembers,
+		Partitioned: r.partitioned,
+		Seeds:       r.seeds,
+		Events:      events,
+	}
+}
+
+func rejoinInterval() time.Duration {
+	intervalStr := config.GddMemRejoinInterval.LoadOrDefault(config.DefaultGddMemRejoinInterval)
+	if interval, err := strconv.Atoi(intervalStr); err == nil {
+		return time.Duration(interval) * time.Second
+	}
+	if duration, err := time.ParseDuration(intervalStr); err == nil {
+		return duration
+	}
+	duration, _ := time.ParseDuration(config.DefaultGddMemRejoinInterval)
+	return duration
+}
+
+func rejoinMinMembers() int {
+	if stringutils.IsNotEmpty(config.GddMemRejoinMinMembers.Load()) {
+		if n, err := cast.ToIntE(config.GddMemRejoinMinMembers.Load()); err == nil {
+			return n
+		}
+	}
+	return config.DefaultGddMemRejoinMinMembers
+}
+
+func registerMetrics() {
+	prometheus.Register(rejoinCount)
+	prometheus.Register(partitionCount)
+	prometheus.Register(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Name: "go_doudou_memberlist_members",
+		Help: "Number of alive members in memberlist cluster.",
+	}, func() float64 {
+		if mlist == nil {
+			return 0
+		}
+		return float64(mlist.NumMembers())
+	}))
+}
+
+var rejoin *rejoiner
+
+// Membership returns membership status of local node
+func Membership() MembershipStatus {
+	assertMlistNotNil()
+	return rejoin.status()
+}
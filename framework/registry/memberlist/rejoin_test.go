@@ -0,0 +1,83 @@
+package memberlist
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/unionj-cloud/go-doudou/v2/framework/internal/config"
+)
+
+func TestRejoiner(t *testing.T) {
+	m1, _ := newTestNode(t, "node1", "", nil)
+	m2, _ := newTestNode(t, "node2", "", nil)
+	seed := "127.0.0.1:1"
+	r := newRejoiner(m2, func() []SeedProvider {
+		return []SeedProvider{NewStaticSeedProvider(seed)}
+	}, time.Second, 2)
+
+	require.Error(t, r.check(context.Background()))
+	status := r.status()
+	require.True(t, status.Partitioned)
+	require.Equal(t, []string{seed}, status.Seeds)
+	require.Equal(t, MembershipPartitioned, status.Events[0].Type)
+	require.Equal(t, MembershipJoinFailed, status.Events[1].Type)
+
+	seed = m1.LocalNode().FullAddress().Addr
+	require.NoError(t, r.check(context.Background()))
+	require.Equal(t, 2, m2.NumMembers())
+	require.NoError(t, r.check(context.Background()))
+	status = r.status()
+	require.False(t, status.Partitioned)
+	require.Equal(t, []string{MembershipPartitioned, MembershipJoinFailed, MembershipJoined, MembershipRecovered},
+		[]string{status.Events[0].Type, status.Events[1].Type, status.Events[2].Type, status.Events[3].Type})
+}
+
+func TestRejoinerRun(t *testing.T) {
+	m1, _ := newTestNode(t, "node1", "", nil)
+	m2, _ := newTestNode(t, "node2", "", nil)
+	r := newRejoiner(m2, func() []SeedProvider {
+		return []SeedProvider{NewStaticSeedProvider(m1.LocalNode().FullAddress().Addr)}
+	}, 10*time.Millisecond, 2)
+	go r.run()
+	defer r.close()
+	require.Eventually(t, func() bool {
+		return m1.NumMembers() == 2
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestRejoinerClose(t *testing.T) {
+	m1, _ := newTestNode(t, "node1", "", nil)
+	resolving := make(chan struct{}, 1)
+	r := newRejoiner(m1, func() []SeedProvider {
+		return []SeedProvider{SeedProviderFunc(func(ctx context.Context) ([]string, error) {
+			select {
+			case resolving <- struct{}{}:
+			default:
+			}
+			<-ctx.Done()
+			return nil, ctx.Err()
+		})}
+	}, 10*time.Millisecond, 2)
+	done := make(chan struct{})
+	go func() {
+		r.run()
+		close(done)
+	}()
+	<-resolving
+	// resolving seeds in progress is aborted
+	r.close()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("rejoiner is still running after close")
+	}
+}
+
+func TestRejoinMinMembers(t *testing.T) {
+	t.Setenv(string(config.GddMemRejoinMinMembers), "")
+	require.Zero(t, rejoinMinMembers())
+	t.Setenv(string(config.GddMemRejoinMinMembers), "3")
+	require.Equal(t, 3, rejoinMinMembers())
+}
@@ -0,0 +1,285 @@
+package memberlist
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/unionj-cloud/go-doudou/v2/framework/internal/config"
+	"github.com/unionj-cloud/go-doudou/v2/toolkit/cast"
+	"github.com/unionj-cloud/go-doudou/v2/toolkit/stringutils"
+	logger "github.com/unionj-cloud/go-doudou/v2/toolkit/zlogger"
+)
+
+// SeedProvider provides addresses in host:port format of seed nodes for joining cluster
+type SeedProvider interface {
+	Seeds(ctx context.Context) ([]string, error)
+}
+
+// SeedProviderFunc is an adapter to use ordinary functions as SeedProvider
+type SeedProviderFunc func(ctx context.Context) ([]string, error)
+
+// Seeds calls f(ctx)
+func (f SeedProviderFunc) Seeds(ctx context.Context) ([]string, error) {
+	return f(ctx)
+}
+
+// NewStaticSeedProvider returns SeedProvider of comma separated addresses, default memberlist port is used
+// for addresses without port
+func NewStaticSeedProvider(seedstr string) SeedProvider {
+	return SeedProviderFunc(func(ctx context.Context) ([]string, error) {
+		return seeds(seedstr), nil
+	})
+}
+
+// NewFileSeedProvider returns SeedProvider of addresses in file, one or comma separated addresses per line,
+// lines starting with # are ignored. The file is read each time, so it can be updated by e.g. configmap.
+func NewFileSeedProvider(file string) SeedProvider {
+	return SeedProviderFunc(func(ctx context.Context) ([]string, error) {
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read seed file %s", file)
+		}
+		var items []string
+		for _, line := range strings.Split(string(content), "\n") {
+			line = strings.TrimSpace(line)
+			if stringutils.IsEmpty(line) || strings.HasPrefix(line, "#") {
+				continue
+			}
+			items = append(items, line)
+		}
+		return seeds(strings.Join(items, ",")), nil
+	})
+}
+
+// NewDNSSeedProvider returns SeedProvider resolving comma separated dns names. Names starting with underscore
+// such as _memberlist._tcp.seed-svc-headless.default.svc.cluster.local are looked up as SRV records, others
+// are looked up as A or AAAA records such as headless service seed-svc-headless.default.svc.cluster.local:7946.
+func NewDNSSeedProvider(names string) SeedProvider {
+	return &dnsSeedProvider{
+		names:    seeds(names),
+		resolver: net.DefaultResolver,
+	}
+}
+
+type dnsSeedProvider struct {
+	names    []string
+	resolver *net.Resolver
+}
+
+func (p *dnsSeedProvider) Seeds(ctx context.Context) ([]string, error) {
+	var result []string
+	var lastErr error
+	for _, name := range p.names {
+		host, port, _ := net.SplitHostPort(name)
+		if strings.HasPrefix(host, "_") {
+			_, srvs, err := p.resolver.LookupSRV(ctx, "", "", host)
+			if err != nil {
+				lastErr = err
+				continue
+			}
+			for _, srv := range srvs {
+				result = append(result, net.JoinHostPort(strings.TrimSuffix(srv.Target, "."), fmt.Sprint(srv.Port)))
+			}
+			continue
+		}
+		addrs, err := p.resolver.LookupHost(ctx, host)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		for _, addr := range addrs {
+			result = append(result, net.JoinHostPort(addr, port))
+		}
+	}
+	if len(result) == 0 && lastErr != nil {
+		return nil, lastErr
+	}
+	return result, nil
+}
+
+// PodLister lists ip addresses of running pods matching label selector in namespace
+type PodLister interface {
+	ListPodIPs(ctx context.Context, namespace, labelSelector string) ([]string, error)
+}
+
+const serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+// podListTimeout bounds listing pods, so an unresponsive api server doesn't block joining cluster
+const podListTimeout = 10 * time.Second
+
+type k8sPodLister struct {
+	baseUrl string
+	token   string
+	client  *http.Client
+}
+
+// NewInClusterPodLister returns PodLister calling kubernetes api server with service account of the pod,
+// which should be granted to list pods
+func NewInClusterPodLister() (PodLister, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if stringutils.IsEmpty(host) || stringutils.IsEmpty(port) {
+		return nil, errors.New("not running in kubernetes cluster")
+	}
+	token, err := ioutil.ReadFile(serviceAccountDir + "/token")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read service account token")
+	}
+	ca, err := ioutil.ReadFile(serviceAccountDir + "/ca.crt")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read service account ca certificate")
+	}
+	pool := x509.NewCertPool()
+	pool.AppendCertsFromPEM(ca)
+	return &k8sPodLister{
+		baseUrl: "https://" + net.JoinHostPort(host, port),
+		token:   strings.TrimSpace(string(token)),
+		client: &http.Client{
+			Timeout: podListTimeout,
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{RootCAs: pool},
+			},
+		},
+	}, nil
+}
+
+type podList struct {
+	Items []struct {
+		Metadata struct {
+			DeletionTimestamp *string `json:"deletionTimestamp"`
+		} `json:"metadata"`
+		Status struct {
+			Phase string `json:"phase"`
+			PodIP string `json:"podIP"`
+		} `json:"status"`
+	} `json:"items"`
+}
+
+func (l *k8sPodLister) ListPodIPs(ctx context.Context, namespace, labelSelector string) ([]string, error) {
+	u := fmt.Sprintf("%s/api/v1/namespaces/%s/pods?labelSelector=%s", l.baseUrl, url.PathEscape(namespace), url.QueryEscape(labelSelector))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+l.token)
+	resp, err := l.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return nil, errors.Errorf("failed to list pods: %s %s", resp.Status, string(body))
+	}
+	var pods podList
+	if err = json.NewDecoder(resp.Body).Decode(&pods); err != nil {
+		return nil, err
+	}
+	var ips []string
+	for _, pod := range pods.Items {
+		if pod.Status.Phase != "Running" || pod.Metadata.DeletionTimestamp != nil || stringutils.IsEmpty(pod.Status.PodIP) {
+			continue
+		}
+		ips = append(ips, pod.Status.PodIP)
+	}
+	return ips, nil
+}
+
+// NewK8sSeedProvider returns SeedProvider of running pods matching labelSelector in namespace listed by lister,
+// port is memberlist port of the pods
+func NewK8sSeedProvider(lister PodLister, namespace, labelSelector string, port int) SeedProvider {
+	return SeedProviderFunc(func(ctx context.Context) ([]string, error) {
+		ips, err := lister.ListPodIPs(ctx, namespace, labelSelector)
+		if err != nil {
+			return nil, err
+		}
+		result := make([]string, 0, len(ips))
+		for _, ip := range ips {
+			result = append(result, net.JoinHostPort(ip, fmt.Sprint(port)))
+		}
+		return result, nil
+	})
+}
+
+var seedProviders struct {
+	lock      sync.RWMutex
+	providers []SeedProvider
+}
+
+// AddSeedProvider adds custom seed provider for rejoining cluster
+func AddSeedProvider(provider SeedProvider) {
+	seedProviders.lock.Lock()
+	defer seedProviders.lock.Unlock()
+	seedProviders.providers = append(seedProviders.providers, provider)
+}
+
+func memPort() int {
+	port := config.DefaultGddMemPort
+	if m, err := cast.ToIntE(config.GddMemPort.Load()); err == nil {
+		port = m
+	}
+	return port
+}
+
+// configuredSeedProviders returns seed providers configured by GDD_MEM_SEED, GDD_MEM_SEED_DNS,
+// GDD_MEM_SEED_FILE and GDD_MEM_SEED_K8S_SELECTOR
+func configuredSeedProviders() []SeedProvider {
+	var providers []SeedProvider
+	if seedstr := config.GddMemSeed.LoadOrDefault(config.DefaultGddMemSeed); stringutils.IsNotEmpty(seedstr) {
+		providers = append(providers, NewStaticSeedProvider(seedstr))
+	}
+	if names := config.GddMemSeedDNS.LoadOrDefault(config.DefaultGddMemSeedDNS); stringutils.IsNotEmpty(names) {
+		providers = append(providers, NewDNSSeedProvider(names))
+	}
+	if file := config.GddMemSeedFile.LoadOrDefault(config.DefaultGddMemSeedFile); stringutils.IsNotEmpty(file) {
+		providers = append(providers, NewFileSeedProvider(file))
+	}
+	if selector := config.GddMemSeedK8sSelector.LoadOrDefault(config.DefaultGddMemSeedK8sSelector); stringutils.IsNotEmpty(selector) {
+		namespace := config.GddMemSeedK8sNamespace.LoadOrDefault(config.DefaultGddMemSeedK8sNamespace)
+		if stringutils.IsEmpty(namespace) {
+			if ns, err := ioutil.ReadFile(serviceAccountDir + "/namespace"); err == nil {
+				namespace = strings.TrimSpace(string(ns))
+			}
+		}
+		if lister, err := NewInClusterPodLister(); err != nil {
+			logger.Error().Err(err).Msg("[go-doudou] failed to create kubernetes seed provider")
+		} else {
+			providers = append(providers, NewK8sSeedProvider(lister, namespace, selector, memPort()))
+		}
+	}
+	seedProviders.lock.RLock()
+	defer seedProviders.lock.RUnlock()
+	return append(providers, seedProviders.providers...)
+}
+
+// resolveSeeds returns deduplicated addresses from all providers, errors of providers are logged and skipped
+func resolveSeeds(ctx context.Context, providers []SeedProvider) []string {
+	var result []string
+	seen := make(map[string]struct{})
+	for _, provider := range providers {
+		addrs, err := provider.Seeds(ctx)
+		if err != nil {
+			logger.Error().Err(err).Msg("[go-doudou] failed to get seeds")
+			continue
+		}
+		for _, addr := range addrs {
+			if _, ok := seen[addr]; ok {
+				continue
+			}
+			seen[addr] = struct{}{}
+			result = append(result, addr)
+		}
+	}
+	return result
+}
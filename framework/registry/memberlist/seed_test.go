@@ -0,0 +1,85 @@
+package memberlist
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStaticSeedProvider(t *testing.T) {
+	addrs, err := NewStaticSeedProvider("10.0.0.1,10.0.0.2:8000").Seeds(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []string{"10.0.0.1:7946", "10.0.0.2:8000"}, addrs)
+}
+
+func TestFileSeedProvider(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "seeds")
+	require.NoError(t, ioutil.WriteFile(file, []byte("# seeds\n10.0.0.1\n\n10.0.0.2:8000,10.0.0.3:8000\n"), 0644))
+	addrs, err := NewFileSeedProvider(file).Seeds(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []string{"10.0.0.1:7946", "10.0.0.2:8000", "10.0.0.3:8000"}, addrs)
+
+	_, err = NewFileSeedProvider(filepath.Join(t.TempDir(), "absent")).Seeds(context.Background())
+	require.Error(t, err)
+}
+
+func TestDNSSeedProvider(t *testing.T) {
+	addrs, err := NewDNSSeedProvider("127.0.0.1:8000").Seeds(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []string{"127.0.0.1:8000"}, addrs)
+}
+
+type fakePodLister struct {
+	ips []string
+	err error
+}
+
+func (f *fakePodLister) ListPodIPs(ctx context.Context, namespace, labelSelector string) ([]string, error) {
+	return f.ips, f.err
+}
+
+func TestK8sSeedProvider(t *testing.T) {
+	addrs, err := NewK8sSeedProvider(&fakePodLister{ips: []string{"10.0.0.1", "10.0.0.2"}}, "default", "app=usersvc", 7946).
+		Seeds(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []string{"10.0.0.1:7946", "10.0.0.2:7946"}, addrs)
+}
+
+func TestK8sPodLister(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.Equal(t, "/api/v1/namespaces/default/pods", r.URL.Path)
+		require.Equal(t, "app=usersvc", r.URL.Query().Get("labelSelector"))
+		require.Equal(t, "Bearer token", r.Header.Get("Authorization"))
+		w.Write([]byte(`{"items":[
+{"metadata":{},"status":{"phase":"Running","podIP":"10.0.0.1"}},
+{"metadata":{},"status":{"phase":"Pending","podIP":""}},
+{"metadata":{"deletionTimestamp":"2022-10-24T12:06:45Z"},"status":{"phase":"Running","podIP":"10.0.0.2"}}
+]}`))
+	}))
+	defer server.Close()
+	lister := &k8sPodLister{
+		baseUrl: server.URL,
+		token:   "token",
+		client:  server.Client(),
+	}
+	ips, err := lister.ListPodIPs(context.Background(), "default", "app=usersvc")
+	require.NoError(t, err)
+	require.Equal(t, []string{"10.0.0.1"}, ips)
+}
+
+func TestResolveSeeds(t *testing.T) {
+	addrs := resolveSeeds(context.Background(), []SeedProvider{
+		NewStaticSeedProvider("10.0.0.1:7946,10.0.0.2:7946"),
+		SeedProviderFunc(func(ctx context.Context) ([]string, error) {
+			return nil, errors.New("mock error")
+		}),
+		NewK8sSeedProvider(&fakePodLister{ips: []string{"10.0.0.2", "10.0.0.3"}}, "default", "app=usersvc", 7946),
+	})
+	require.Equal(t, []string{"10.0.0.1:7946", "10.0.0.2:7946", "10.0.0.3:7946"}, addrs)
+}
@@ -3,6 +3,7 @@ package memberlist
 import (
 	"context"
 	"fmt"
+	"github.com/unionj-cloud/go-doudou/v2/framework/tlsx"
 	"github.com/unionj-cloud/go-doudou/v2/toolkit/memberlist"
 	"github.com/unionj-cloud/go-doudou/v2/toolkit/stringutils"
 	logger "github.com/unionj-cloud/go-doudou/v2/toolkit/zlogger"
@@ -247,7 +248,7 @@ func NewRRGrpcClientConn(service string, dialOptions ...grpc.DialOption) *grpc.C
 
 func NewGrpcClientConn(service string, lb string, dialOptions ...grpc.DialOption) *grpc.ClientConn {
 	serverAddr := fmt.Sprintf(schemeName+"://%s/", service)
-	dialOptions = append(dialOptions, grpc.WithBlock(), grpc.WithDefaultServiceConfig(`{"loadBalancingPolicy": "`+lb+`"}`))
+	dialOptions = append(tlsx.DialOptions(dialOptions...), grpc.WithBlock(), grpc.WithDefaultServiceConfig(`{"loadBalancingPolicy": "`+lb+`"}`))
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 	grpcConn, err := grpc.DialContext(ctx, serverAddr, dialOptions...)
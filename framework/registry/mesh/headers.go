@@ -0,0 +1,56 @@
+package mesh
+
+import (
+	"context"
+	"net/http"
+)
+
+// TracingHeaders are headers sidecars use to join spans of a request into a trace, they must be copied from
+// incoming requests to outgoing requests by services as sidecars can't relate them
+var TracingHeaders = []string{
+	"x-request-id",
+	"x-b3-traceid",
+	"x-b3-spanid",
+	"x-b3-parentspanid",
+	"x-b3-sampled",
+	"x-b3-flags",
+	"b3",
+	"traceparent",
+	"tracestate",
+	"x-ot-span-context",
+}
+
+type headersKey struct{}
+
+// NewContext returns a copy of ctx carrying TracingHeaders found in header
+func NewContext(ctx context.Context, header http.Header) context.Context {
+	traced := make(http.Header)
+	for _, key := range TracingHeaders {
+		if value := header.Get(key); value != "" {
+			traced.Set(key, value)
+		}
+	}
+	if len(traced) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, headersKey{}, traced)
+}
+
+// FromContext returns TracingHeaders stored by NewContext
+func FromContext(ctx context.Context) (http.Header, bool) {
+	header, ok := ctx.Value(headersKey{}).(http.Header)
+	return header, ok
+}
+
+// Inject sets TracingHeaders stored in ctx to header, headers already set are kept
+func Inject(ctx context.Context, header http.Header) {
+	traced, ok := FromContext(ctx)
+	if !ok {
+		return
+	}
+	for key, values := range traced {
+		if header.Get(key) == "" && len(values) > 0 {
+			header.Set(key, values[0])
+		}
+	}
+}
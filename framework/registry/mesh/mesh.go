@@ -0,0 +1,142 @@
+// Package mesh implements registry-less mesh and dns service discovery modes. Services register nothing and are
+// called by dns names like http://<service>.<namespace>, leaving load balancing and retries to sidecars of
+// service mesh such as istio or linkerd in mesh mode, or to kube-proxy in dns mode. Set GDD_SERVICE_DISCOVERY_MODE
+// to mesh or dns, and GDD_MESH_NAMESPACE, GDD_MESH_DOMAIN and GDD_MESH_PORT to build dns names, or plug in
+// another Resolver by SetResolver. In mesh mode, services wait for sidecar readiness by GDD_MESH_SIDECAR before
+// serving, restclient sends no retries and tracing headers of sidecars are propagated.
+package mesh
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/unionj-cloud/go-doudou/v2/framework/internal/config"
+	"github.com/unionj-cloud/go-doudou/v2/framework/registry/constants"
+	"github.com/unionj-cloud/go-doudou/v2/framework/registry/interfaces"
+	"github.com/unionj-cloud/go-doudou/v2/framework/tlsx"
+	"github.com/unionj-cloud/go-doudou/v2/toolkit/cast"
+	"github.com/unionj-cloud/go-doudou/v2/toolkit/stringutils"
+	logger "github.com/unionj-cloud/go-doudou/v2/toolkit/zlogger"
+)
+
+// Resolver resolves address host:port service is called by
+type Resolver interface {
+	Resolve(service string) (string, error)
+}
+
+// ResolverFunc is an adapter to allow the use of ordinary functions as Resolver
+type ResolverFunc func(service string) (string, error)
+
+// Resolve calls f(service)
+func (f ResolverFunc) Resolve(service string) (string, error) {
+	return f(service)
+}
+
+// DNSResolver resolves service to <service>.<namespace>.<domain>:<port>, underscores of service are replaced by
+// hyphens as dns labels don't allow them, e.g. usersvc_rest is resolved to usersvc-rest. Services containing dots
+// are taken as qualified names.
+type DNSResolver struct {
+	Namespace string
+	Domain    string
+	// Port is 80 or 443 by scheme if 0
+	Port int
+}
+
+// NewDNSResolver creates DNSResolver from GDD_MESH_* environment variables
+func NewDNSResolver() *DNSResolver {
+	return &DNSResolver{
+		Namespace: config.GddMeshNamespace.LoadOrDefault(config.DefaultGddMeshNamespace),
+		Domain:    config.GddMeshDomain.LoadOrDefault(config.DefaultGddMeshDomain),
+		Port:      cast.ToIntOrDefault(config.GddMeshPort.Load(), config.DefaultGddMeshPort),
+	}
+}
+
+// Resolve implements Resolver
+func (r *DNSResolver) Resolve(service string) (string, error) {
+	if stringutils.IsEmpty(service) {
+		return "", errors.New("service name is empty")
+	}
+	host := strings.ToLower(strings.ReplaceAll(service, "_", "-"))
+	if !strings.Contains(host, ".") {
+		for _, label := range []string{r.Namespace, r.Domain} {
+			if stringutils.IsNotEmpty(label) {
+				host += "." + label
+			}
+		}
+	}
+	port := r.Port
+	if port == 0 {
+		port = 80
+		if tlsx.Scheme() == "https" {
+			port = 443
+		}
+	}
+	return net.JoinHostPort(host, strconv.Itoa(port)), nil
+}
+
+var (
+	resolverMu sync.RWMutex
+	resolver   Resolver
+)
+
+// SetResolver replaces the default DNSResolver from environment variables
+func SetResolver(r Resolver) {
+	resolverMu.Lock()
+	defer resolverMu.Unlock()
+	resolver = r
+}
+
+// Resolve resolves address of service by the Resolver set by SetResolver, or NewDNSResolver
+func Resolve(service string) (string, error) {
+	resolverMu.RLock()
+	r := resolver
+	resolverMu.RUnlock()
+	if r == nil {
+		r = NewDNSResolver()
+	}
+	return r.Resolve(service)
+}
+
+// BaseUrl returns base url of service, e.g. http://usersvc.prod:80
+func BaseUrl(service string) (string, error) {
+	addr, err := Resolve(service)
+	if err != nil {
+		return "", err
+	}
+	return tlsx.Scheme() + "://" + addr, nil
+}
+
+// Enabled reports whether mesh or dns mode is in GDD_SERVICE_DISCOVERY_MODE
+func Enabled() bool {
+	modes := config.ServiceDiscoveryMap()
+	_, mesh := modes[constants.SD_MESH]
+	_, dns := modes[constants.SD_DNS]
+	return mesh || dns
+}
+
+// InMesh reports whether mesh mode is in GDD_SERVICE_DISCOVERY_MODE, i.e. requests go through sidecars
+func InMesh() bool {
+	_, ok := config.ServiceDiscoveryMap()[constants.SD_MESH]
+	return ok
+}
+
+// WatchInstances calls fn with the only instance resolved for service, which stands for all instances behind
+// the dns name. fn is not called if service can't be resolved.
+func WatchInstances(service string, fn func([]interfaces.Instance)) (stop func()) {
+	addr, err := Resolve(service)
+	if err != nil {
+		logger.Error().Err(err).Msgf("[go-doudou] failed to resolve %s", service)
+		return func() {}
+	}
+	host, portStr, err := net.SplitHostPort(addr)
+	if err != nil {
+		logger.Error().Err(err).Msgf("[go-doudou] invalid address %s of %s", addr, service)
+		return func() {}
+	}
+	port, _ := strconv.Atoi(portStr)
+	fn([]interfaces.Instance{interfaces.NewInstance(service, host, port, nil)})
+	return func() {}
+}
@@ -0,0 +1,110 @@
+package mesh
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/unionj-cloud/go-doudou/v2/framework/registry/interfaces"
+)
+
+func TestDNSResolver(t *testing.T) {
+	r := &DNSResolver{Namespace: "prod", Domain: "svc.cluster.local"}
+	addr, err := r.Resolve("usersvc_grpc")
+	require.NoError(t, err)
+	require.Equal(t, "usersvc-grpc.prod.svc.cluster.local:80", addr)
+
+	r = &DNSResolver{Port: 6060}
+	addr, err = r.Resolve("UserSvc")
+	require.NoError(t, err)
+	require.Equal(t, "usersvc:6060", addr)
+
+	r = &DNSResolver{Namespace: "prod"}
+	addr, err = r.Resolve("usersvc.staging")
+	require.NoError(t, err)
+	require.Equal(t, "usersvc.staging:80", addr)
+
+	_, err = r.Resolve("")
+	require.Error(t, err)
+}
+
+func TestSetResolver(t *testing.T) {
+	SetResolver(ResolverFunc(func(service string) (string, error) {
+		return service + ".mesh.local:8080", nil
+	}))
+	defer SetResolver(nil)
+	url, err := BaseUrl("usersvc")
+	require.NoError(t, err)
+	require.Equal(t, "http://usersvc.mesh.local:8080", url)
+
+	var instances []interfaces.Instance
+	WatchInstances("usersvc", func(i []interfaces.Instance) {
+		instances = i
+	})()
+	require.Len(t, instances, 1)
+	require.Equal(t, "usersvc.mesh.local", instances[0].Host)
+	require.Equal(t, 8080, instances[0].Port)
+}
+
+func TestModes(t *testing.T) {
+	t.Setenv("GDD_SERVICE_DISCOVERY_MODE", "mesh")
+	require.True(t, Enabled())
+	require.True(t, InMesh())
+	t.Setenv("GDD_SERVICE_DISCOVERY_MODE", "dns")
+	require.True(t, Enabled())
+	require.False(t, InMesh())
+	t.Setenv("GDD_SERVICE_DISCOVERY_MODE", "nacos")
+	require.False(t, Enabled())
+}
+
+func TestSidecarReadinessUrl(t *testing.T) {
+	t.Setenv("GDD_MESH_SIDECAR", "Istio")
+	require.Equal(t, "http://127.0.0.1:15021/healthz/ready", SidecarReadinessUrl())
+	t.Setenv("GDD_MESH_SIDECAR", "http://127.0.0.1:9901/ready")
+	require.Equal(t, "http://127.0.0.1:9901/ready", SidecarReadinessUrl())
+}
+
+func TestWaitForSidecar(t *testing.T) {
+	var calls int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+	t.Setenv("GDD_SERVICE_DISCOVERY_MODE", "mesh")
+	t.Setenv("GDD_MESH_SIDECAR", ts.URL)
+	WaitForSidecar(context.Background())
+	require.EqualValues(t, 2, atomic.LoadInt32(&calls))
+
+	// gives up after timeout
+	t.Setenv("GDD_MESH_SIDECAR", "http://127.0.0.1:1/ready")
+	t.Setenv("GDD_MESH_SIDECAR_TIMEOUT", "100ms")
+	start := time.Now()
+	WaitForSidecar(context.Background())
+	require.Less(t, time.Since(start), 2*time.Second)
+}
+
+func TestInject(t *testing.T) {
+	incoming := http.Header{}
+	incoming.Set("X-Request-Id", "abc")
+	incoming.Set("Traceparent", "00-0af7651916cd43dd8448eb211c80319c-b7ad6b7169203331-01")
+	incoming.Set("Authorization", "Bearer token")
+	ctx := NewContext(context.Background(), incoming)
+
+	outgoing := http.Header{}
+	outgoing.Set("X-Request-Id", "kept")
+	Inject(ctx, outgoing)
+	require.Equal(t, "kept", outgoing.Get("X-Request-Id"))
+	require.Equal(t, incoming.Get("Traceparent"), outgoing.Get("Traceparent"))
+	require.Empty(t, outgoing.Get("Authorization"))
+
+	_, ok := FromContext(NewContext(context.Background(), http.Header{}))
+	require.False(t, ok)
+}
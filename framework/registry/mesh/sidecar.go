@@ -0,0 +1,83 @@
+package mesh
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/unionj-cloud/go-doudou/v2/framework/internal/config"
+	"github.com/unionj-cloud/go-doudou/v2/toolkit/stringutils"
+	logger "github.com/unionj-cloud/go-doudou/v2/toolkit/zlogger"
+)
+
+const (
+	// SidecarIstio is value of GDD_MESH_SIDECAR waiting for istio-proxy
+	SidecarIstio = "istio"
+	// SidecarLinkerd is value of GDD_MESH_SIDECAR waiting for linkerd-proxy
+	SidecarLinkerd = "linkerd"
+)
+
+// sidecarReadiness maps known sidecars to their readiness endpoints
+var sidecarReadiness = map[string]string{
+	SidecarIstio:   "http://127.0.0.1:15021/healthz/ready",
+	SidecarLinkerd: "http://127.0.0.1:4191/ready",
+}
+
+const sidecarPollInterval = 500 * time.Millisecond
+
+// SidecarReadinessUrl returns readiness endpoint of the sidecar configured by GDD_MESH_SIDECAR, which is istio,
+// linkerd or any readiness url. It returns empty string if no sidecar is configured.
+func SidecarReadinessUrl() string {
+	sidecar := strings.TrimSpace(config.GddMeshSidecar.LoadOrDefault(config.DefaultGddMeshSidecar))
+	if url, ok := sidecarReadiness[strings.ToLower(sidecar)]; ok {
+		return url
+	}
+	return sidecar
+}
+
+// WaitForSidecar blocks until the sidecar configured by GDD_MESH_SIDECAR is ready, so that the service doesn't
+// take traffic or call other services before its sidecar proxies them. It gives up with a warning after
+// GDD_MESH_SIDECAR_TIMEOUT or once ctx is done. It returns immediately if mesh mode is off or no sidecar is
+// configured.
+func WaitForSidecar(ctx context.Context) {
+	url := SidecarReadinessUrl()
+	if !InMesh() || stringutils.IsEmpty(url) {
+		return
+	}
+	timeout, err := time.ParseDuration(config.GddMeshSidecarTimeout.LoadOrDefault(config.DefaultGddMeshSidecarTimeout))
+	if err != nil {
+		logger.Warn().Err(err).Msgf("[go-doudou] invalid %s, use default %s", string(config.GddMeshSidecarTimeout), config.DefaultGddMeshSidecarTimeout)
+		timeout, _ = time.ParseDuration(config.DefaultGddMeshSidecarTimeout)
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	if err = waitReady(ctx, url); err != nil {
+		logger.Warn().Err(err).Msgf("[go-doudou] sidecar is not ready at %s, go on anyway", url)
+		return
+	}
+	logger.Info().Msgf("[go-doudou] sidecar is ready at %s", url)
+}
+
+func waitReady(ctx context.Context, url string) error {
+	client := &http.Client{Timeout: sidecarPollInterval}
+	ticker := time.NewTicker(sidecarPollInterval)
+	defer ticker.Stop()
+	for {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		if resp, err := client.Do(req); err == nil {
+			resp.Body.Close()
+			if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+				return nil
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package nacos
+
+import (
+	"github.com/unionj-cloud/go-doudou/v2/framework/registry/interfaces"
+	logger "github.com/unionj-cloud/go-doudou/v2/toolkit/zlogger"
+	"github.com/wubin1989/nacos-sdk-go/v2/model"
+	"github.com/wubin1989/nacos-sdk-go/v2/vo"
+)
+
+type instanceWatcher struct {
+	nacosBase
+}
+
+func convertToInstances(serviceName string, hosts []model.Instance) []interfaces.Instance {
+	instances := make([]interfaces.Instance, 0, len(hosts))
+	for _, host := range hosts {
+		if !host.Enable || !host.Healthy {
+			continue
+		}
+		metadata := make(map[string]string, len(host.Metadata))
+		for k, v := range host.Metadata {
+			metadata[k] = v
+		}
+		instance := interfaces.NewInstance(serviceName, host.Ip, int(host.Port), metadata)
+		if host.Weight > 0 {
+			// weight may be changed from nacos console
+			instance.Weight = int(host.Weight)
+		}
+		instances = append(instances, instance)
+	}
+	return instances
+}
+
+// WatchInstances calls fn with all healthy instances of service each time they change, until stop is called
+func WatchInstances(serviceName string, fn func([]interfaces.Instance), opts ...NacosProviderOption) (stop func()) {
+	onceNacos.Do(func() {
+		InitialiseNacosNamingClient()
+	})
+	w := &instanceWatcher{
+		nacosBase{
+			serviceName:  serviceName,
+			namingClient: NamingClient,
+		},
+	}
+	for _, opt := range opts {
+		opt(w)
+	}
+	if w.namingClient == nil {
+		logger.Error().Msg("[go-doudou] nacos discovery client has not been initialized")
+		return func() {}
+	}
+	hosts, err := w.namingClient.SelectInstances(vo.SelectInstancesParam{
+		Clusters:    w.clusters,
+		ServiceName: w.serviceName,
+		GroupName:   w.groupName,
+		HealthyOnly: true,
+	})
+	if err != nil {
+		logger.Error().Err(err).Msgf("[go-doudou] failed to select instances of %s", w.serviceName)
+	}
+	fn(convertToInstances(w.serviceName, hosts))
+	param := &vo.SubscribeParam{
+		ServiceName: w.serviceName,
+		Clusters:    w.clusters,
+		GroupName:   w.groupName,
+		SubscribeCallback: func(services []model.Instance, err error) {
+			if err != nil {
+				logger.Error().Err(err).Msgf("[go-doudou] failed to subscribe %s", w.serviceName)
+				return
+			}
+			fn(convertToInstances(w.serviceName, services))
+		},
+	}
+	if err = w.namingClient.Subscribe(param); err != nil {
+		logger.Error().Err(err).Msgf("[go-doudou] failed to subscribe %s", w.serviceName)
+	}
+	return func() {
+		if err := w.namingClient.Unsubscribe(param); err != nil {
+			logger.Error().Err(err).Msgf("[go-doudou] failed to unsubscribe %s", w.serviceName)
+		}
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"github.com/unionj-cloud/go-doudou/v2/framework/internal/config"
 	cons "github.com/unionj-cloud/go-doudou/v2/framework/registry/constants"
 	"github.com/unionj-cloud/go-doudou/v2/framework/registry/utils"
+	"github.com/unionj-cloud/go-doudou/v2/framework/tlsx"
 	"github.com/unionj-cloud/go-doudou/v2/toolkit/cast"
 	"github.com/unionj-cloud/go-doudou/v2/toolkit/constants"
 	"github.com/unionj-cloud/go-doudou/v2/toolkit/stringutils"
@@ -38,6 +39,16 @@ func InitialiseNacosNamingClient() {
 	}
 }
 
+// populateMeta sets version and zone metadata if configured
+func populateMeta(metadata map[string]string) {
+	if version := config.GddServiceVersion.LoadOrDefault(config.DefaultGddServiceVersion); stringutils.IsNotEmpty(version) {
+		metadata["version"] = version
+	}
+	if zone := config.GddServiceZone.LoadOrDefault(config.DefaultGddServiceZone); stringutils.IsNotEmpty(zone) {
+		metadata["zone"] = zone
+	}
+}
+
 func NewRest(data ...map[string]interface{}) {
 	onceNacos.Do(func() {
 		InitialiseNacosNamingClient()
@@ -68,6 +79,7 @@ func NewRest(data ...map[string]interface{}) {
 	metadata["buildUser"] = buildinfo.BuildUser
 	metadata["buildTime"] = buildTime
 	metadata["weight"] = strconv.Itoa(weight)
+	populateMeta(metadata)
 	metadata["rootPath"] = rr
 	for _, item := range data {
 		for k, v := range item {
@@ -120,6 +132,7 @@ func NewGrpc(data ...map[string]interface{}) {
 	metadata["buildUser"] = buildinfo.BuildUser
 	metadata["buildTime"] = buildTime
 	metadata["weight"] = strconv.Itoa(weight)
+	populateMeta(metadata)
 	for _, item := range data {
 		for k, v := range item {
 			metadata[k] = fmt.Sprint(v)
@@ -295,7 +308,7 @@ func (n *RRServiceProvider) SelectServer() string {
 	next := int(atomic.AddUint64(&n.current, uint64(1)) % uint64(len(instances)))
 	n.current = uint64(next)
 	selected := instances[next]
-	return fmt.Sprintf("http://%s:%d%s", selected.Ip, selected.Port, selected.Metadata["rootPath"])
+	return fmt.Sprintf("%s://%s:%d%s", tlsx.Scheme(), selected.Ip, selected.Port, selected.Metadata["rootPath"])
 }
 
 func (n *RRServiceProvider) Close() {
@@ -340,7 +353,7 @@ func (n *WRRServiceProvider) SelectServer() string {
 		logger.Error().Err(err).Msgf("[go-doudou] %s server not found", n.serviceName)
 		return ""
 	}
-	return fmt.Sprintf("http://%s:%d%s", instance.Ip, instance.Port, instance.Metadata["rootPath"])
+	return fmt.Sprintf("%s://%s:%d%s", tlsx.Scheme(), instance.Ip, instance.Port, instance.Metadata["rootPath"])
 }
 
 func (n *WRRServiceProvider) Close() {
@@ -389,7 +402,7 @@ func NewGrpcClientConn(config NacosConfig, lb string, dialOptions ...grpc.DialOp
 		NacosClient: NamingClient,
 	})
 	serverAddr := fmt.Sprintf("nacos://%s/", config.ServiceName)
-	dialOptions = append(dialOptions, grpc.WithBlock(), grpc.WithDefaultServiceConfig(`{"loadBalancingPolicy": "`+lb+`"}`))
+	dialOptions = append(tlsx.DialOptions(dialOptions...), grpc.WithBlock(), grpc.WithDefaultServiceConfig(`{"loadBalancingPolicy": "`+lb+`"}`))
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 	grpcConn, err := grpc.DialContext(ctx, serverAddr, dialOptions...)
@@ -8,6 +8,7 @@ import (
 	"github.com/stretchr/testify/require"
 	"github.com/unionj-cloud/go-doudou/v2/framework/buildinfo"
 	"github.com/unionj-cloud/go-doudou/v2/framework/internal/config"
+	"github.com/unionj-cloud/go-doudou/v2/framework/registry/interfaces"
 	"github.com/unionj-cloud/go-doudou/v2/framework/registry/nacos"
 	"github.com/unionj-cloud/go-doudou/v2/framework/registry/nacos/mock"
 	"github.com/wubin1989/nacos-sdk-go/v2/clients/naming_client"
@@ -297,3 +298,47 @@ func TestNacosWRRServiceProvider_SelectServer(t *testing.T) {
 	got := n.SelectServer()
 	require.Equal(t, got, "http://10.10.10.10:80/api")
 }
+
+func TestWatchInstances(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	namingClient := mock.NewMockINamingClient(ctrl)
+	namingClient.
+		EXPECT().
+		SelectInstances(vo.SelectInstancesParam{
+			Clusters:    []string{"a"},
+			ServiceName: "testsvc",
+			HealthyOnly: true,
+		}).
+		Return(services.Hosts[:2], nil)
+	setup()
+	nacos.NewNamingClient = func(param vo.NacosClientParam) (iClient naming_client.INamingClient, err error) {
+		return namingClient, nil
+	}
+	var param *vo.SubscribeParam
+	namingClient.
+		EXPECT().
+		Subscribe(gomock.Any()).
+		DoAndReturn(func(p *vo.SubscribeParam) error {
+			param = p
+			return nil
+		})
+
+	var got []interfaces.Instance
+	stop := nacos.WatchInstances("testsvc", func(instances []interfaces.Instance) {
+		got = instances
+	}, nacos.WithNacosNamingClient(namingClient), nacos.WithNacosClusters([]string{"a"}))
+	require.Len(t, got, 2)
+	require.Equal(t, "10.10.10.10:80", got[0].Addr())
+	require.Equal(t, "/api", got[0].RootPath)
+	require.Equal(t, 10, got[0].Weight)
+
+	// unhealthy and disabled instances are skipped
+	param.SubscribeCallback(services.Hosts, nil)
+	require.Len(t, got, 3)
+	require.Equal(t, "10.10.10.14", got[2].Host)
+
+	namingClient.EXPECT().Unsubscribe(param).Return(nil)
+	stop()
+}
@@ -1,21 +1,30 @@
 package registry
 
 import (
+	"context"
+
 	"github.com/unionj-cloud/go-doudou/v2/framework/internal/config"
 	"github.com/unionj-cloud/go-doudou/v2/framework/registry/constants"
 	"github.com/unionj-cloud/go-doudou/v2/framework/registry/etcd"
+	"github.com/unionj-cloud/go-doudou/v2/framework/registry/interfaces"
 	"github.com/unionj-cloud/go-doudou/v2/framework/registry/memberlist"
+	"github.com/unionj-cloud/go-doudou/v2/framework/registry/mesh"
 	"github.com/unionj-cloud/go-doudou/v2/framework/registry/nacos"
 	"github.com/unionj-cloud/go-doudou/v2/framework/registry/zk"
 	logger "github.com/unionj-cloud/go-doudou/v2/toolkit/zlogger"
 )
 
-type IServiceProvider interface {
-	SelectServer() string
-	Close()
-}
+// IServiceProvider selects base url of a server instance for http clients
+type IServiceProvider = interfaces.IServiceProvider
+
+// IDiscoveryProvider is IServiceProvider exposing discovered instances with metadata
+type IDiscoveryProvider = interfaces.IDiscoveryProvider
+
+// Instance is a discovered server instance
+type Instance = interfaces.Instance
 
 func NewRest(data ...map[string]interface{}) {
+	mesh.WaitForSidecar(context.Background())
 	for mode, _ := range config.ServiceDiscoveryMap() {
 		switch mode {
 		case constants.SD_NACOS:
@@ -26,6 +35,8 @@ func NewRest(data ...map[string]interface{}) {
 			memberlist.NewRest(data...)
 		case constants.SD_ZK:
 			zk.NewRest(data...)
+		case constants.SD_MESH, constants.SD_DNS:
+			// instances are resolved by dns names, nothing to register
 		default:
 			logger.Warn().Msgf("[go-doudou] unknown service discovery mode: %s", mode)
 		}
@@ -33,6 +44,7 @@ func NewRest(data ...map[string]interface{}) {
 }
 
 func NewGrpc(data ...map[string]interface{}) {
+	mesh.WaitForSidecar(context.Background())
 	for mode, _ := range config.ServiceDiscoveryMap() {
 		switch mode {
 		case constants.SD_NACOS:
@@ -43,6 +55,33 @@ func NewGrpc(data ...map[string]interface{}) {
 			memberlist.NewGrpc(data...)
 		case constants.SD_ZK:
 			zk.NewGrpc(data...)
+		case constants.SD_MESH, constants.SD_DNS:
+			// instances are resolved by dns names, nothing to register
+		default:
+			logger.Warn().Msgf("[go-doudou] unknown service discovery mode: %s", mode)
+		}
+	}
+}
+
+// NewRestGrpc registers both rest and grpc services of an application serving both, memberlist advertises them
+// in the same node entry
+func NewRestGrpc(data ...map[string]interface{}) {
+	mesh.WaitForSidecar(context.Background())
+	for mode, _ := range config.ServiceDiscoveryMap() {
+		switch mode {
+		case constants.SD_NACOS:
+			nacos.NewRest(data...)
+			nacos.NewGrpc(data...)
+		case constants.SD_ETCD:
+			etcd.NewRest(data...)
+			etcd.NewGrpc(data...)
+		case constants.SD_MEMBERLIST:
+			memberlist.NewRestGrpc(data...)
+		case constants.SD_ZK:
+			zk.NewRest(data...)
+			zk.NewGrpc(data...)
+		case constants.SD_MESH, constants.SD_DNS:
+			// instances are resolved by dns names, nothing to register
 		default:
 			logger.Warn().Msgf("[go-doudou] unknown service discovery mode: %s", mode)
 		}
@@ -60,6 +99,7 @@ func ShutdownRest() {
 			memberlist.Shutdown()
 		case constants.SD_ZK:
 			zk.ShutdownRest()
+		case constants.SD_MESH, constants.SD_DNS:
 		default:
 			logger.Warn().Msgf("[go-doudou] unknown service discovery mode: %s", mode)
 		}
@@ -77,6 +117,29 @@ func ShutdownGrpc() {
 			memberlist.Shutdown()
 		case constants.SD_ZK:
 			zk.ShutdownGrpc()
+		case constants.SD_MESH, constants.SD_DNS:
+		default:
+			logger.Warn().Msgf("[go-doudou] unknown service discovery mode: %s", mode)
+		}
+	}
+}
+
+// ShutdownRestGrpc deregisters both rest and grpc services registered by NewRestGrpc
+func ShutdownRestGrpc() {
+	for mode, _ := range config.ServiceDiscoveryMap() {
+		switch mode {
+		case constants.SD_NACOS:
+			nacos.ShutdownRest()
+			nacos.ShutdownGrpc()
+		case constants.SD_ETCD:
+			etcd.ShutdownRest()
+			etcd.ShutdownGrpc()
+		case constants.SD_MEMBERLIST:
+			memberlist.Shutdown()
+		case constants.SD_ZK:
+			zk.ShutdownRest()
+			zk.ShutdownGrpc()
+		case constants.SD_MESH, constants.SD_DNS:
 		default:
 			logger.Warn().Msgf("[go-doudou] unknown service discovery mode: %s", mode)
 		}
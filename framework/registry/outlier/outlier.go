@@ -0,0 +1,380 @@
+package outlier
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/unionj-cloud/go-doudou/v2/framework/internal/config"
+	"github.com/unionj-cloud/go-doudou/v2/framework/registry/balancer"
+	"github.com/unionj-cloud/go-doudou/v2/framework/registry/interfaces"
+	"github.com/unionj-cloud/go-doudou/v2/toolkit/cast"
+	logger "github.com/unionj-cloud/go-doudou/v2/toolkit/zlogger"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var ejectionCount = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "go_doudou_outlier_ejection_count",
+	Help: "Number of times instances are ejected from load balancing by outlier detection.",
+}, []string{"service"})
+
+// Config configures outlier detection, checks are disabled by zero values
+type Config struct {
+	// ConsecutiveErrors is number of consecutive failures ejecting an instance
+	ConsecutiveErrors int
+	// ErrorRate is failure rate in Interval ejecting an instance, checked once there are MinRequests requests
+	ErrorRate   float64
+	MinRequests int
+	Interval    time.Duration
+	// BaseEjectionTime doubles each time an instance is ejected again, up to MaxEjectionTime
+	BaseEjectionTime time.Duration
+	MaxEjectionTime  time.Duration
+	// MaxEjectionPercent limits percentage of instances of a service ejected at the same time,
+	// though one instance can always be ejected
+	MaxEjectionPercent int
+}
+
+func loadDuration(value, defaultValue string) time.Duration {
+	if d, err := time.ParseDuration(value); err == nil {
+		return d
+	}
+	d, _ := time.ParseDuration(defaultValue)
+	return d
+}
+
+// ConfigFromEnv returns Config from GDD_OUTLIER_* environment variables
+func ConfigFromEnv() Config {
+	errorRate := config.DefaultGddOutlierErrorRate
+	if rate, err := cast.ToFloat64E(config.GddOutlierErrorRate.Load()); err == nil {
+		errorRate = rate
+	}
+	return Config{
+		ConsecutiveErrors:  cast.ToIntOrDefault(config.GddOutlierConsecutiveErrors.Load(), config.DefaultGddOutlierConsecutiveErrors),
+		ErrorRate:          errorRate,
+		MinRequests:        cast.ToIntOrDefault(config.GddOutlierMinRequests.Load(), config.DefaultGddOutlierMinRequests),
+		Interval:           loadDuration(config.GddOutlierInterval.Load(), config.DefaultGddOutlierInterval),
+		BaseEjectionTime:   loadDuration(config.GddOutlierBaseEjectionTime.Load(), config.DefaultGddOutlierBaseEjectionTime),
+		MaxEjectionTime:    loadDuration(config.GddOutlierMaxEjectionTime.Load(), config.DefaultGddOutlierMaxEjectionTime),
+		MaxEjectionPercent: cast.ToIntOrDefault(config.GddOutlierMaxEjectionPercent.Load(), config.DefaultGddOutlierMaxEjectionPercent),
+	}
+}
+
+// Status is outlier detection state of an instance
+type Status struct {
+	Addr              string    `json:"addr"`
+	Service           string    `json:"service"`
+	Ejected           bool      `json:"ejected"`
+	EjectedUntil      time.Time `json:"ejectedUntil"`
+	EjectionCount     int       `json:"ejectionCount"`
+	ConsecutiveErrors int       `json:"consecutiveErrors"`
+	Requests          int       `json:"requests"`
+	Failures          int       `json:"failures"`
+}
+
+type hostStat struct {
+	service       string
+	consecutive   int
+	windowStart   time.Time
+	requests      int
+	failures      int
+	ejectionCount int
+	ejectedUntil  time.Time
+}
+
+func (h *hostStat) ejected(now time.Time) bool {
+	return now.Before(h.ejectedUntil)
+}
+
+// Detector ejects instances by results of requests reported to it. It can be shared by clients of many services,
+// as instances are told apart by address.
+type Detector struct {
+	conf    Config
+	now     func() time.Time
+	lock    sync.Mutex
+	hosts   map[string]*hostStat
+	members map[string]map[string]struct{}
+}
+
+// NewDetector creates Detector
+func NewDetector(conf Config) *Detector {
+	return &Detector{
+		conf:    conf,
+		now:     time.Now,
+		hosts:   make(map[string]*hostStat),
+		members: make(map[string]map[string]struct{}),
+	}
+}
+
+func (d *Detector) host(addr string) *hostStat {
+	h, ok := d.hosts[addr]
+	if !ok {
+		h = &hostStat{
+			windowStart: d.now(),
+		}
+		d.hosts[addr] = h
+	}
+	return h
+}
+
+// Filter returns instances not ejected, all instances are returned if all of them are ejected. Instances are
+// often routed subsets, so membership only grows here, it is replaced by Track.
+func (d *Detector) Filter(instances []interfaces.Instance) []interfaces.Instance {
+	if len(instances) == 0 {
+		return instances
+	}
+	now := d.now()
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	ret := make([]interfaces.Instance, 0, len(instances))
+	for _, instance := range instances {
+		addr := instance.Addr()
+		members, ok := d.members[instance.Service]
+		if !ok {
+			members = make(map[string]struct{})
+			d.members[instance.Service] = members
+		}
+		members[addr] = struct{}{}
+		h := d.host(addr)
+		h.service = instance.Service
+		if h.ejected(now) {
+			continue
+		}
+		ret = append(ret, instance)
+	}
+	if len(ret) == 0 {
+		return instances
+	}
+	return ret
+}
+
+// Track sets all instances of service, stats of instances left are dropped. Providers call it each time
+// instances change, e.g. by Subscribe of registry.Discover.
+func (d *Detector) Track(service string, instances []interfaces.Instance) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	members := make(map[string]struct{}, len(instances))
+	for _, instance := range instances {
+		addr := instance.Addr()
+		members[addr] = struct{}{}
+		d.host(addr).service = service
+	}
+	old := d.members[service]
+	d.members[service] = members
+	for addr := range old {
+		if _, ok := members[addr]; !ok {
+			d.prune()
+			break
+		}
+	}
+}
+
+// prune drops stats of instances no longer in member set of any service
+func (d *Detector) prune() {
+	for addr := range d.hosts {
+		var found bool
+		for _, members := range d.members {
+			if _, found = members[addr]; found {
+				break
+			}
+		}
+		if !found {
+			delete(d.hosts, addr)
+		}
+	}
+}
+
+// IsFailure tells whether err means the instance is unhealthy. Client cancellation and grpc errors other
+// than Unavailable, DeadlineExceeded, Internal, Unknown and ResourceExhausted are not failures.
+func IsFailure(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	if s, ok := status.FromError(err); ok {
+		switch s.Code() {
+		case codes.Unavailable, codes.DeadlineExceeded, codes.Internal, codes.Unknown, codes.ResourceExhausted:
+			return true
+		}
+		return false
+	}
+	return true
+}
+
+// Report records result of request to instance at addr, it may eject the instance. Results of instances
+// not returned by Filter are ignored.
+func (d *Detector) Report(addr string, err error) {
+	now := d.now()
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	h, ok := d.hosts[addr]
+	if !ok {
+		// instance has left since it was picked
+		return
+	}
+	if h.ejected(now) {
+		// results of requests sent before ejection are ignored
+		return
+	}
+	if d.conf.Interval > 0 && now.Sub(h.windowStart) >= d.conf.Interval {
+		h.windowStart = now
+		h.requests = 0
+		h.failures = 0
+	}
+	h.requests++
+	if !IsFailure(err) {
+		h.consecutive = 0
+		return
+	}
+	h.failures++
+	h.consecutive++
+	var reason string
+	switch {
+	case d.conf.ConsecutiveErrors > 0 && h.consecutive >= d.conf.ConsecutiveErrors:
+		reason = "consecutive errors"
+	case d.conf.ErrorRate > 0 && h.requests >= d.conf.MinRequests && float64(h.failures)/float64(h.requests) >= d.conf.ErrorRate:
+		reason = "error rate"
+	default:
+		return
+	}
+	if !d.canEject(h, now) {
+		return
+	}
+	d.eject(addr, h, now, reason)
+}
+
+// canEject checks MaxEjectionPercent of the service of h, one instance can always be ejected
+func (d *Detector) canEject(h *hostStat, now time.Time) bool {
+	members := d.members[h.service]
+	ejected := 0
+	for addr := range members {
+		if other, ok := d.hosts[addr]; ok && other.ejected(now) {
+			ejected++
+		}
+	}
+	if ejected == 0 {
+		return true
+	}
+	return (ejected+1)*100 <= len(members)*d.conf.MaxEjectionPercent
+}
+
+func (d *Detector) eject(addr string, h *hostStat, now time.Time, reason string) {
+	// instances healthy for long since last ejection start over from base ejection time
+	if !h.ejectedUntil.IsZero() && now.Sub(h.ejectedUntil) > d.conf.MaxEjectionTime {
+		h.ejectionCount = 0
+	}
+	duration := d.conf.BaseEjectionTime
+	for i := 0; i < h.ejectionCount && duration < d.conf.MaxEjectionTime; i++ {
+		duration *= 2
+	}
+	if d.conf.MaxEjectionTime > 0 && duration > d.conf.MaxEjectionTime {
+		duration = d.conf.MaxEjectionTime
+	}
+	h.ejectionCount++
+	h.ejectedUntil = now.Add(duration)
+	h.consecutive = 0
+	h.requests = 0
+	h.failures = 0
+	h.windowStart = h.ejectedUntil
+	ejectionCount.WithLabelValues(h.service).Inc()
+	logger.Warn().Msgf("[go-doudou] instance %s of %s ejected for %s by %s", addr, h.service, duration, reason)
+}
+
+// Statuses returns outlier detection state of all instances sorted by address
+func (d *Detector) Statuses() []Status {
+	now := d.now()
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	ret := make([]Status, 0, len(d.hosts))
+	for addr, h := range d.hosts {
+		ret = append(ret, Status{
+			Addr:              addr,
+			Service:           h.service,
+			Ejected:           h.ejected(now),
+			EjectedUntil:      h.ejectedUntil,
+			EjectionCount:     h.ejectionCount,
+			ConsecutiveErrors: h.consecutive,
+			Requests:          h.requests,
+			Failures:          h.failures,
+		})
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Addr < ret[j].Addr
+	})
+	return ret
+}
+
+func (d *Detector) ejectedCount() int {
+	now := d.now()
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	n := 0
+	for _, h := range d.hosts {
+		if h.ejected(now) {
+			n++
+		}
+	}
+	return n
+}
+
+type outlierBalancer struct {
+	detector *Detector
+	balancer balancer.Balancer
+}
+
+func (b *outlierBalancer) Pick(ctx context.Context, instances []interfaces.Instance) (interfaces.Instance, error) {
+	return b.balancer.Pick(ctx, b.detector.Filter(instances))
+}
+
+// Start reports result of request to detector, and to the wrapped balancer if it tracks load
+func (b *outlierBalancer) Start(addr string) (done func(err error)) {
+	next := balancer.Start(b.balancer, addr)
+	var once sync.Once
+	return func(err error) {
+		once.Do(func() {
+			next(err)
+			b.detector.Report(addr, err)
+		})
+	}
+}
+
+// Prune drops stats of instances gone kept by the wrapped balancer
+func (b *outlierBalancer) Prune(instances []interfaces.Instance) {
+	balancer.Prune(b.balancer, instances)
+}
+
+// NewBalancer returns balancer picking by b from instances not ejected by d, results of requests must be
+// reported by balancer.Start
+func NewBalancer(d *Detector, b balancer.Balancer) balancer.Balancer {
+	return &outlierBalancer{
+		detector: d,
+		balancer: b,
+	}
+}
+
+// Enabled tells whether outlier detection is enabled by GDD_OUTLIER_DETECTION_ENABLE
+func Enabled() bool {
+	return cast.ToBoolOrDefault(config.GddOutlierDetectionEnable.Load(), config.DefaultGddOutlierDetectionEnable)
+}
+
+var (
+	defaultDetector *Detector
+	defaultOnce     sync.Once
+)
+
+// Default returns the Detector configured by environment variables shared by all service clients
+func Default() *Detector {
+	defaultOnce.Do(func() {
+		defaultDetector = NewDetector(ConfigFromEnv())
+		prometheus.Register(ejectionCount)
+		prometheus.Register(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Name: "go_doudou_outlier_ejected_instances",
+			Help: "Number of instances ejected from load balancing by outlier detection.",
+		}, func() float64 {
+			return float64(defaultDetector.ejectedCount())
+		}))
+	})
+	return defaultDetector
+}
@@ -0,0 +1,219 @@
+package outlier
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/unionj-cloud/go-doudou/v2/framework/registry/balancer"
+	"github.com/unionj-cloud/go-doudou/v2/framework/registry/interfaces"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var errMock = errors.New("mock error")
+
+func newInstances(n int) []interfaces.Instance {
+	var instances []interfaces.Instance
+	for i := 0; i < n; i++ {
+		instances = append(instances, interfaces.NewInstance("usersvc_rest", "10.0.0.1", 6060+i, nil))
+	}
+	return instances
+}
+
+func newTestDetector(conf Config) (*Detector, *time.Time) {
+	d := NewDetector(conf)
+	now := time.Now()
+	d.now = func() time.Time {
+		return now
+	}
+	return d, &now
+}
+
+func addrs(instances []interfaces.Instance) []string {
+	var ret []string
+	for _, instance := range instances {
+		ret = append(ret, instance.Addr())
+	}
+	return ret
+}
+
+func TestIsFailure(t *testing.T) {
+	require.False(t, IsFailure(nil))
+	require.False(t, IsFailure(context.Canceled))
+	require.False(t, IsFailure(status.Error(codes.NotFound, "not found")))
+	require.True(t, IsFailure(status.Error(codes.Unavailable, "unavailable")))
+	require.True(t, IsFailure(context.DeadlineExceeded))
+	require.True(t, IsFailure(errMock))
+}
+
+func TestConsecutiveErrors(t *testing.T) {
+	d, now := newTestDetector(Config{
+		ConsecutiveErrors:  3,
+		BaseEjectionTime:   time.Second,
+		MaxEjectionTime:    3 * time.Second,
+		MaxEjectionPercent: 50,
+	})
+	instances := newInstances(4)
+	d.Filter(instances)
+	addr := instances[0].Addr()
+
+	d.Report(addr, errMock)
+	d.Report(addr, errMock)
+	d.Report(addr, nil)
+	d.Report(addr, errMock)
+	d.Report(addr, errMock)
+	require.Len(t, d.Filter(instances), 4)
+	d.Report(addr, errMock)
+	require.Equal(t, addrs(instances[1:]), addrs(d.Filter(instances)))
+
+	// ejection time doubles each time up to max ejection time
+	for _, ejection := range []time.Duration{time.Second, 2 * time.Second, 3 * time.Second, 3 * time.Second} {
+		status := d.Statuses()[0]
+		require.True(t, status.Ejected)
+		require.Equal(t, now.Add(ejection), status.EjectedUntil)
+		*now = now.Add(ejection)
+		require.Len(t, d.Filter(instances), 4)
+		for i := 0; i < 3; i++ {
+			d.Report(addr, errMock)
+		}
+	}
+	require.Equal(t, 5, d.Statuses()[0].EjectionCount)
+
+	// healthy for long, start over from base ejection time
+	*now = now.Add(10 * time.Second)
+	for i := 0; i < 3; i++ {
+		d.Report(addr, errMock)
+	}
+	require.Equal(t, now.Add(time.Second), d.Statuses()[0].EjectedUntil)
+}
+
+func TestErrorRate(t *testing.T) {
+	d, now := newTestDetector(Config{
+		ErrorRate:          0.5,
+		MinRequests:        4,
+		Interval:           time.Second,
+		BaseEjectionTime:   time.Second,
+		MaxEjectionTime:    time.Minute,
+		MaxEjectionPercent: 50,
+	})
+	instances := newInstances(2)
+	d.Filter(instances)
+	addr := instances[0].Addr()
+
+	d.Report(addr, errMock)
+	d.Report(addr, nil)
+	d.Report(addr, errMock)
+	// failures of last window are forgotten
+	*now = now.Add(time.Second)
+	d.Report(addr, nil)
+	d.Report(addr, errMock)
+	d.Report(addr, nil)
+	require.False(t, d.Statuses()[0].Ejected)
+	d.Report(addr, errMock)
+	require.True(t, d.Statuses()[0].Ejected)
+}
+
+func TestMaxEjectionPercent(t *testing.T) {
+	d, _ := newTestDetector(Config{
+		ConsecutiveErrors:  1,
+		BaseEjectionTime:   time.Second,
+		MaxEjectionTime:    time.Minute,
+		MaxEjectionPercent: 50,
+	})
+	instances := newInstances(4)
+	d.Filter(instances)
+	for _, instance := range instances {
+		d.Report(instance.Addr(), errMock)
+	}
+	require.Equal(t, addrs(instances[2:]), addrs(d.Filter(instances)))
+
+	// all instances are returned rather than none
+	single := newInstances(1)
+	d, _ = newTestDetector(Config{
+		ConsecutiveErrors: 1,
+		BaseEjectionTime:  time.Second,
+		MaxEjectionTime:   time.Minute,
+	})
+	d.Filter(single)
+	d.Report(single[0].Addr(), errMock)
+	require.True(t, d.Statuses()[0].Ejected)
+	require.Len(t, d.Filter(single), 1)
+}
+
+func TestBalancer(t *testing.T) {
+	d, _ := newTestDetector(Config{
+		ConsecutiveErrors:  2,
+		BaseEjectionTime:   time.Minute,
+		MaxEjectionTime:    time.Minute,
+		MaxEjectionPercent: 50,
+	})
+	b := NewBalancer(d, balancer.NewP2C())
+	instances := newInstances(3)
+	// simulate backend at instances[0] failing all requests
+	for i := 0; i < 100; i++ {
+		instance, err := b.Pick(context.Background(), instances)
+		require.NoError(t, err)
+		done := balancer.Start(b, instance.Addr())
+		if instance.Addr() == instances[0].Addr() {
+			require.Less(t, i, 50)
+			done(status.Error(codes.Unavailable, "unavailable"))
+			continue
+		}
+		done(nil)
+	}
+	require.True(t, d.Statuses()[0].Ejected)
+	require.Equal(t, 1, d.Statuses()[0].EjectionCount)
+}
+
+func TestPrune(t *testing.T) {
+	d, _ := newTestDetector(Config{
+		ConsecutiveErrors:  1,
+		BaseEjectionTime:   time.Second,
+		MaxEjectionTime:    time.Minute,
+		MaxEjectionPercent: 50,
+	})
+	instances := newInstances(3)
+	other := interfaces.NewInstance("ordersvc_rest", "10.0.0.2", 6060, nil)
+	d.Filter(instances)
+	d.Filter([]interfaces.Instance{other})
+	d.Report(instances[0].Addr(), errMock)
+	require.Len(t, d.Statuses(), 4)
+
+	// stats of instances left are dropped, other services are kept
+	d.Filter(instances)
+	require.Len(t, d.Statuses(), 4)
+	d.Track("usersvc_rest", instances[1:])
+	require.Equal(t, []string{instances[1].Addr(), instances[2].Addr(), other.Addr()}, statusAddrs(d.Statuses()))
+	d.Report(instances[0].Addr(), errMock)
+	require.Len(t, d.Statuses(), 3)
+}
+
+func TestAlternatingSubsets(t *testing.T) {
+	d, _ := newTestDetector(Config{
+		ConsecutiveErrors:  1,
+		BaseEjectionTime:   time.Minute,
+		MaxEjectionTime:    time.Minute,
+		MaxEjectionPercent: 50,
+	})
+	instances := newInstances(4)
+	d.Track("usersvc_rest", instances)
+	d.Filter(instances[:2])
+	d.Report(instances[0].Addr(), errMock)
+
+	// picking from another routed subset keeps ejection of the first one
+	require.Equal(t, addrs(instances[2:]), addrs(d.Filter(instances[2:])))
+	require.Equal(t, addrs(instances[1:2]), addrs(d.Filter(instances[:2])))
+	require.Len(t, d.Statuses(), 4)
+	require.True(t, d.Statuses()[0].Ejected)
+}
+
+func statusAddrs(statuses []Status) []string {
+	var ret []string
+	for _, item := range statuses {
+		ret = append(ret, item.Addr)
+	}
+	return ret
+}
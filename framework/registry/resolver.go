@@ -0,0 +1,47 @@
+package registry
+
+import (
+	"github.com/unionj-cloud/go-doudou/v2/framework/registry/interfaces"
+	"github.com/unionj-cloud/go-doudou/v2/framework/registry/router"
+	gresolver "google.golang.org/grpc/resolver"
+)
+
+const discoverScheme = "discover"
+
+var _ gresolver.Builder = (*discoverResolverBuilder)(nil)
+var _ gresolver.Resolver = (*discoverResolver)(nil)
+
+// discoverResolverBuilder builds resolver updating addresses carrying instance metadata from Discover
+type discoverResolverBuilder struct {
+	opts []DiscoveryOption
+}
+
+func (b *discoverResolverBuilder) Scheme() string {
+	return discoverScheme
+}
+
+func (b *discoverResolverBuilder) Build(target gresolver.Target, cc gresolver.ClientConn, opts gresolver.BuildOptions) (gresolver.Resolver, error) {
+	r := &discoverResolver{
+		provider: Discover(target.URL.Host, b.opts...),
+	}
+	r.unsubscribe = r.provider.Subscribe(func(instances []interfaces.Instance) {
+		addrs := make([]gresolver.Address, 0, len(instances))
+		for _, instance := range instances {
+			addrs = append(addrs, router.WithInstance(gresolver.Address{Addr: instance.Addr()}, instance))
+		}
+		cc.UpdateState(gresolver.State{Addresses: addrs})
+	})
+	return r, nil
+}
+
+type discoverResolver struct {
+	provider    IDiscoveryProvider
+	unsubscribe func()
+}
+
+func (r *discoverResolver) ResolveNow(gresolver.ResolveNowOptions) {}
+
+func (r *discoverResolver) Close() {
+	r.unsubscribe()
+	r.provider.Close()
+}
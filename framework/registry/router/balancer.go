@@ -0,0 +1,137 @@
+package router
+
+import (
+	"context"
+
+	"github.com/unionj-cloud/go-doudou/v2/framework/hedging"
+	lb "github.com/unionj-cloud/go-doudou/v2/framework/registry/balancer"
+	"github.com/unionj-cloud/go-doudou/v2/framework/registry/interfaces"
+	"github.com/unionj-cloud/go-doudou/v2/framework/registry/outlier"
+	"github.com/unionj-cloud/go-doudou/v2/toolkit/zlogger"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// Name is the name of grpc balancer routing by rules in GDD_ROUTE_RULES then picking by round-robin
+	Name = "router_balancer"
+	// P2CName is the name of grpc balancer routing by rules then picking by balancer.NewP2C
+	P2CName = "router_p2c_balancer"
+	// EWMAName is the name of grpc balancer routing by rules then picking by balancer.NewEWMA
+	EWMAName = "router_ewma_balancer"
+	// ConsistentHashName is the name of grpc balancer routing by rules then picking by balancer.NewConsistentHash
+	// with key from balancer.WithHashKey
+	ConsistentHashName = "router_hash_balancer"
+)
+
+type instanceAttributeKey struct{}
+
+// WithInstance returns addr carrying instance for router_balancer
+func WithInstance(addr resolver.Address, instance interfaces.Instance) resolver.Address {
+	// attributes are compared by ==, so pointer is stored as Instance holds a map
+	addr.BalancerAttributes = addr.BalancerAttributes.WithValue(instanceAttributeKey{}, &instance)
+	return addr
+}
+
+func instanceFromAddress(addr resolver.Address) (interfaces.Instance, bool) {
+	instance, ok := addr.BalancerAttributes.Value(instanceAttributeKey{}).(*interfaces.Instance)
+	if !ok {
+		return interfaces.Instance{}, false
+	}
+	return *instance, true
+}
+
+// NewBuilder returns grpc balancer builder of name routing by rules in GDD_ROUTE_RULES then picking by b,
+// which is shared by all client connections using the balancer. Failing instances are ejected by
+// outlier.Default() if GDD_OUTLIER_DETECTION_ENABLE is true.
+func NewBuilder(name string, b lb.Balancer) balancer.Builder {
+	return base.NewBalancerBuilder(name, &pickerBuilder{name: name, balancer: b}, base.Config{HealthCheck: true})
+}
+
+func init() {
+	balancer.Register(NewBuilder(Name, lb.NewRoundRobin()))
+	balancer.Register(NewBuilder(P2CName, lb.NewP2C()))
+	balancer.Register(NewBuilder(EWMAName, lb.NewEWMA(lb.DefaultEWMADecay)))
+	balancer.Register(NewBuilder(ConsistentHashName, lb.NewConsistentHash(lb.DefaultReplicas)))
+}
+
+var _ balancer.Picker = (*picker)(nil)
+
+type pickerBuilder struct {
+	name     string
+	balancer lb.Balancer
+}
+
+func (pb *pickerBuilder) Build(info base.PickerBuildInfo) balancer.Picker {
+	zlogger.Debug().Msgf("[go-doudou] %s Picker: Build called with info: %v", pb.name, info)
+	if len(info.ReadySCs) == 0 {
+		return base.NewErrPicker(balancer.ErrNoSubConnAvailable)
+	}
+	p := &picker{
+		subConns: make(map[string]balancer.SubConn, len(info.ReadySCs)),
+	}
+	for sc, v := range info.ReadySCs {
+		instance, ok := instanceFromAddress(v.Address)
+		if !ok {
+			// addresses from resolvers other than registry.Discover carry no metadata to route by
+			zlogger.Warn().Msgf("[go-doudou] %s: no instance metadata in address %s", pb.name, v.Address.Addr)
+			continue
+		}
+		p.service = instance.Service
+		p.instances = append(p.instances, instance)
+		p.subConns[instance.Addr()] = sc
+	}
+	if len(p.instances) == 0 {
+		return base.NewErrPicker(balancer.ErrNoSubConnAvailable)
+	}
+	p.balancer = pb.balancer
+	if outlier.Enabled() {
+		// pickers are built with all ready instances, while they pick from routed subsets
+		outlier.Default().Track(p.service, p.instances)
+		p.balancer = outlier.NewBalancer(outlier.Default(), p.balancer)
+	}
+	return p
+}
+
+type picker struct {
+	service   string
+	balancer  lb.Balancer
+	instances []interfaces.Instance
+	subConns  map[string]balancer.SubConn
+}
+
+func (p *picker) Pick(info balancer.PickInfo) (balancer.PickResult, error) {
+	candidates := Route(info.Ctx, p.service, p.instances)
+	if len(candidates) == 0 {
+		return balancer.PickResult{}, status.Errorf(codes.Unavailable, "no instance of %s matches route rule", p.service)
+	}
+	instance, err := p.balancer.Pick(info.Ctx, untried(info.Ctx, candidates))
+	if err != nil {
+		return balancer.PickResult{}, status.Error(codes.Unavailable, err.Error())
+	}
+	hedging.MarkTried(info.Ctx, instance.Addr())
+	done := lb.Start(p.balancer, instance.Addr())
+	return balancer.PickResult{
+		SubConn: p.subConns[instance.Addr()],
+		Done: func(info balancer.DoneInfo) {
+			done(info.Err)
+		},
+	}, nil
+}
+
+// untried leaves out instances an attempt of the same hedged call is sent to, unless all of them are tried
+func untried(ctx context.Context, instances []interfaces.Instance) []interfaces.Instance {
+	var result []interfaces.Instance
+	for _, instance := range instances {
+		if !hedging.Tried(ctx, instance.Addr()) {
+			result = append(result, instance)
+		}
+	}
+	if len(result) == 0 {
+		return instances
+	}
+	return result
+}
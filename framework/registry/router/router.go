@@ -0,0 +1,249 @@
+package router
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/apolloconfig/agollo/v4/storage"
+	"github.com/unionj-cloud/go-doudou/v2/framework/configmgr"
+	"github.com/unionj-cloud/go-doudou/v2/framework/internal/config"
+	"github.com/unionj-cloud/go-doudou/v2/framework/registry/interfaces"
+	"github.com/unionj-cloud/go-doudou/v2/toolkit/stringutils"
+	logger "github.com/unionj-cloud/go-doudou/v2/toolkit/zlogger"
+	"google.golang.org/grpc/metadata"
+)
+
+// Rule selects instances of a service by metadata
+type Rule struct {
+	// Version only selects instances of the version
+	Version string `json:"version,omitempty"`
+	// Labels only selects instances having all the metadata
+	Labels map[string]string `json:"labels,omitempty"`
+	// ZoneAware prefers instances in the same zone as GDD_SERVICE_ZONE, falls back to instances
+	// in other zones if there is none
+	ZoneAware bool `json:"zoneAware,omitempty"`
+	// Canary splits traffic between canary instances and the others
+	Canary *CanaryRule `json:"canary,omitempty"`
+}
+
+// CanaryRule routes requests having the header or a percentage of traffic to canary instances
+type CanaryRule struct {
+	// Labels identifies canary instances by metadata, e.g. {"version": "v2"}
+	Labels map[string]string `json:"labels"`
+	// Percent is the percentage of traffic routed to canary instances, from 0 to 100
+	Percent int `json:"percent,omitempty"`
+	// Header routes requests having the header to canary instances, e.g. x-canary
+	Header string `json:"header,omitempty"`
+	// HeaderValue is the header value routing to canary instances, any non-empty value if not set
+	HeaderValue string `json:"headerValue,omitempty"`
+}
+
+type ruleCache struct {
+	lock  sync.Mutex
+	raw   string
+	rules map[string]Rule
+}
+
+var cache ruleCache
+
+// Rules returns routing rules keyed by service name from GDD_ROUTE_RULES
+func Rules() map[string]Rule {
+	raw := config.GddRouteRules.LoadOrDefault(config.DefaultGddRouteRules)
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+	if raw == cache.raw {
+		return cache.rules
+	}
+	rules := make(map[string]Rule)
+	if stringutils.IsNotEmpty(raw) {
+		if err := json.Unmarshal([]byte(raw), &rules); err != nil {
+			logger.Error().Err(err).Msgf("[go-doudou] failed to parse %s, keep using previous rules", string(config.GddRouteRules))
+			return cache.rules
+		}
+	}
+	cache.raw = raw
+	cache.rules = rules
+	return rules
+}
+
+func match(instance interfaces.Instance, labels map[string]string) bool {
+	for k, v := range labels {
+		var value string
+		switch k {
+		case "version":
+			value = instance.Version
+		case "zone":
+			value = instance.Zone
+		default:
+			value = instance.Metadata[k]
+		}
+		if value != v {
+			return false
+		}
+	}
+	return true
+}
+
+func filter(instances []interfaces.Instance, fn func(interfaces.Instance) bool) []interfaces.Instance {
+	var result []interfaces.Instance
+	for _, instance := range instances {
+		if fn(instance) {
+			result = append(result, instance)
+		}
+	}
+	return result
+}
+
+type headerKey struct{}
+
+// NewContext returns a context carrying http request header for routing by header, gRPC metadata is looked up
+// without it
+func NewContext(ctx context.Context, header http.Header) context.Context {
+	return context.WithValue(ctx, headerKey{}, header)
+}
+
+func headerFromContext(ctx context.Context, key string) string {
+	if ctx == nil {
+		return ""
+	}
+	if md, ok := metadata.FromOutgoingContext(ctx); ok {
+		if values := md.Get(key); len(values) > 0 {
+			return values[0]
+		}
+	}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(key); len(values) > 0 {
+			return values[0]
+		}
+	}
+	if header, ok := ctx.Value(headerKey{}).(http.Header); ok {
+		return header.Get(key)
+	}
+	return ""
+}
+
+func (c *CanaryRule) hit(ctx context.Context) bool {
+	if stringutils.IsNotEmpty(c.Header) {
+		value := headerFromContext(ctx, c.Header)
+		if stringutils.IsNotEmpty(value) && (stringutils.IsEmpty(c.HeaderValue) || strings.EqualFold(value, c.HeaderValue)) {
+			return true
+		}
+	}
+	return c.Percent > 0 && rand.Intn(100) < c.Percent
+}
+
+// Apply returns instances selected by the rule for the request of ctx
+func (r Rule) Apply(ctx context.Context, instances []interfaces.Instance) []interfaces.Instance {
+	labels := make(map[string]string, len(r.Labels)+1)
+	for k, v := range r.Labels {
+		labels[k] = v
+	}
+	if stringutils.IsNotEmpty(r.Version) {
+		labels["version"] = r.Version
+	}
+	candidates := filter(instances, func(instance interfaces.Instance) bool {
+		return match(instance, labels)
+	})
+	if r.Canary != nil && len(r.Canary.Labels) > 0 {
+		canary := filter(candidates, func(instance interfaces.Instance) bool {
+			return match(instance, r.Canary.Labels)
+		})
+		stable := filter(candidates, func(instance interfaces.Instance) bool {
+			return !match(instance, r.Canary.Labels)
+		})
+		if len(canary) > 0 && (len(stable) == 0 || r.Canary.hit(ctx)) {
+			candidates = canary
+		} else {
+			candidates = stable
+		}
+	}
+	if r.ZoneAware {
+		zone := config.GddServiceZone.LoadOrDefault(config.DefaultGddServiceZone)
+		sameZone := filter(candidates, func(instance interfaces.Instance) bool {
+			return instance.Zone == zone
+		})
+		if stringutils.IsNotEmpty(zone) && len(sameZone) > 0 {
+			candidates = sameZone
+		}
+	}
+	return candidates
+}
+
+// Route returns instances of service selected by its rule in GDD_ROUTE_RULES for the request of ctx,
+// all instances are returned if there is no rule for service
+func Route(ctx context.Context, service string, instances []interfaces.Instance) []interfaces.Instance {
+	rule, ok := Rules()[service]
+	if !ok {
+		return instances
+	}
+	return rule.Apply(ctx, instances)
+}
+
+type routerConfigListener struct {
+	configmgr.BaseApolloListener
+}
+
+func (c *routerConfigListener) OnChange(event *storage.ChangeEvent) {
+	c.Lock.Lock()
+	defer c.Lock.Unlock()
+	if !c.SkippedFirstEvent {
+		c.SkippedFirstEvent = true
+		return
+	}
+	for key, value := range event.Changes {
+		upperKey := strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+		if upperKey == string(config.GddRouteRules) {
+			_ = os.Setenv(upperKey, fmt.Sprint(value.NewValue))
+		}
+	}
+}
+
+func callbackOnChange(listener *routerConfigListener) func(event *configmgr.NacosChangeEvent) {
+	return func(event *configmgr.NacosChangeEvent) {
+		changes := make(map[string]*storage.ConfigChange)
+		for k, v := range event.Changes {
+			changes[k] = &storage.ConfigChange{
+				OldValue:   v.OldValue,
+				NewValue:   v.NewValue,
+				ChangeType: storage.ConfigChangeType(v.ChangeType),
+			}
+		}
+		listener.OnChange(&storage.ChangeEvent{
+			Changes: changes,
+		})
+	}
+}
+
+// InitialiseRemoteConfigListener reloads routing rules on change from config center
+func InitialiseRemoteConfigListener() {
+	listener := &routerConfigListener{}
+	configType := config.GddConfigRemoteType.LoadOrDefault(config.DefaultGddConfigRemoteType)
+	switch configType {
+	case "":
+		return
+	case config.NacosConfigType:
+		dataIdStr := config.GddNacosConfigDataid.LoadOrDefault(config.DefaultGddNacosConfigDataid)
+		dataIds := strings.Split(dataIdStr, ",")
+		listener.SkippedFirstEvent = true
+		for _, dataId := range dataIds {
+			configmgr.NacosClient.AddChangeListener(configmgr.NacosConfigListenerParam{
+				DataId:   "__" + dataId + "__" + "router",
+				OnChange: callbackOnChange(listener),
+			})
+		}
+	case config.ApolloConfigType:
+		configmgr.ApolloClient.AddChangeListener(listener)
+	default:
+		logger.Warn().Msgf("[go-doudou] unknown config type: %s\n", configType)
+	}
+}
+
+func init() {
+	InitialiseRemoteConfigListener()
+}
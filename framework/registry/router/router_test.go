@@ -0,0 +1,79 @@
+package router
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/unionj-cloud/go-doudou/v2/framework/internal/config"
+	"github.com/unionj-cloud/go-doudou/v2/framework/registry/interfaces"
+	"google.golang.org/grpc/metadata"
+)
+
+func newInstances() []interfaces.Instance {
+	return []interfaces.Instance{
+		interfaces.NewInstance("usersvc_rest", "10.0.0.1", 6060, map[string]string{"version": "v1", "zone": "zone-a"}),
+		interfaces.NewInstance("usersvc_rest", "10.0.0.2", 6060, map[string]string{"version": "v1", "zone": "zone-b"}),
+		interfaces.NewInstance("usersvc_rest", "10.0.0.3", 6060, map[string]string{"version": "v2", "zone": "zone-b", "env": "canary"}),
+	}
+}
+
+func addrs(instances []interfaces.Instance) []string {
+	var result []string
+	for _, instance := range instances {
+		result = append(result, instance.Addr())
+	}
+	return result
+}
+
+func TestRouteWithoutRule(t *testing.T) {
+	t.Setenv(string(config.GddRouteRules), "")
+	require.Len(t, Route(context.Background(), "usersvc_rest", newInstances()), 3)
+}
+
+func TestRouteByVersionAndLabels(t *testing.T) {
+	t.Setenv(string(config.GddRouteRules), `{"usersvc_rest":{"version":"v1"},"ordersvc_rest":{"labels":{"env":"canary"}}}`)
+	require.Equal(t, []string{"10.0.0.1:6060", "10.0.0.2:6060"}, addrs(Route(context.Background(), "usersvc_rest", newInstances())))
+	require.Equal(t, []string{"10.0.0.3:6060"}, addrs(Route(context.Background(), "ordersvc_rest", newInstances())))
+}
+
+func TestRouteZoneAware(t *testing.T) {
+	rule := Rule{ZoneAware: true}
+	t.Setenv(string(config.GddServiceZone), "zone-a")
+	require.Equal(t, []string{"10.0.0.1:6060"}, addrs(rule.Apply(context.Background(), newInstances())))
+	t.Setenv(string(config.GddServiceZone), "zone-c")
+	require.Len(t, rule.Apply(context.Background(), newInstances()), 3)
+}
+
+func TestRouteCanaryByHeader(t *testing.T) {
+	rule := Rule{Canary: &CanaryRule{Labels: map[string]string{"version": "v2"}, Header: "x-canary", HeaderValue: "true"}}
+	require.Equal(t, []string{"10.0.0.1:6060", "10.0.0.2:6060"}, addrs(rule.Apply(context.Background(), newInstances())))
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "x-canary", "true")
+	require.Equal(t, []string{"10.0.0.3:6060"}, addrs(rule.Apply(ctx, newInstances())))
+
+	ctx = metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-canary", "false"))
+	require.Len(t, rule.Apply(ctx, newInstances()), 2)
+
+	header := http.Header{}
+	header.Set("X-Canary", "TRUE")
+	require.Equal(t, []string{"10.0.0.3:6060"}, addrs(rule.Apply(NewContext(context.Background(), header), newInstances())))
+}
+
+func TestRouteCanaryByPercent(t *testing.T) {
+	rule := Rule{Canary: &CanaryRule{Labels: map[string]string{"env": "canary"}, Percent: 100}}
+	require.Equal(t, []string{"10.0.0.3:6060"}, addrs(rule.Apply(context.Background(), newInstances())))
+	rule.Canary.Percent = 0
+	require.Len(t, rule.Apply(context.Background(), newInstances()), 2)
+	rule.Version = "v2"
+	// canary instances take all traffic if there is no stable one
+	require.Equal(t, []string{"10.0.0.3:6060"}, addrs(rule.Apply(context.Background(), newInstances())))
+}
+
+func TestRulesKeepPreviousOnError(t *testing.T) {
+	t.Setenv(string(config.GddRouteRules), `{"usersvc_rest":{"version":"v2"}}`)
+	require.Equal(t, "v2", Rules()["usersvc_rest"].Version)
+	t.Setenv(string(config.GddRouteRules), `{"usersvc_rest":`)
+	require.Equal(t, "v2", Rules()["usersvc_rest"].Version)
+}
@@ -275,6 +275,9 @@ func (ss *ServerSet) registerEndpoint(connection *zk.Conn, meta map[string]inter
 	if meta["version"] != nil {
 		querystring.Set("version", meta["version"].(string))
 	}
+	if meta["zone"] != nil {
+		querystring.Set("zone", meta["zone"].(string))
+	}
 	if meta["weight"] != nil {
 		querystring.Set("weight", strconv.Itoa(meta["weight"].(int)))
 	}
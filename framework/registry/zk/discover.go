@@ -0,0 +1,52 @@
+package zk
+
+import (
+	"net/url"
+
+	"github.com/unionj-cloud/go-doudou/v2/framework/registry/interfaces"
+	"github.com/unionj-cloud/go-doudou/v2/toolkit/cast"
+	"github.com/unionj-cloud/go-doudou/v2/toolkit/errorx"
+)
+
+func convertToInstances(conf ServiceConfig, ups []string) []interfaces.Instance {
+	instances := make([]interfaces.Instance, 0, len(ups))
+	for _, up := range ups {
+		unescaped, _ := url.QueryUnescape(up)
+		u, err := url.Parse(unescaped)
+		if err != nil {
+			continue
+		}
+		query := u.Query()
+		if query.Get("group") != conf.Group || query.Get("version") != conf.Version {
+			continue
+		}
+		metadata := make(map[string]string, len(query))
+		for k := range query {
+			metadata[k] = query.Get(k)
+		}
+		instances = append(instances, interfaces.NewInstance(conf.Name, u.Hostname(), cast.ToIntOrDefault(u.Port(), 0), metadata))
+	}
+	return instances
+}
+
+func watchInstances(conf ServiceConfig, watcher Watcher, fn func([]interfaces.Instance)) {
+	fn(convertToInstances(conf, watcher.Endpoints()))
+	for range watcher.Event() {
+		if watcher.IsClosed() {
+			return
+		}
+		fn(convertToInstances(conf, watcher.Endpoints()))
+	}
+}
+
+// WatchInstances calls fn with all instances of service in the same group and version as conf each time
+// they change, until stop is called
+func WatchInstances(conf ServiceConfig, fn func([]interfaces.Instance)) (stop func()) {
+	serverSet := newServerSet(conf.Name)
+	watcher, err := serverSet.Watch()
+	if err != nil {
+		errorx.Panic(err.Error())
+	}
+	go watchInstances(conf, watcher, fn)
+	return watcher.Close
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/unionj-cloud/go-doudou/v2/framework/registry/interfaces"
 	"github.com/unionj-cloud/go-doudou/v2/framework/registry/serversets"
 	"github.com/unionj-cloud/go-doudou/v2/framework/registry/utils"
+	"github.com/unionj-cloud/go-doudou/v2/framework/tlsx"
 	"github.com/unionj-cloud/go-doudou/v2/toolkit/cast"
 	"github.com/unionj-cloud/go-doudou/v2/toolkit/constants"
 	"github.com/unionj-cloud/go-doudou/v2/toolkit/errorx"
@@ -81,6 +82,9 @@ func populateMeta(meta map[string]interface{}, userData ...map[string]interface{
 	version := config.GddServiceVersion.LoadOrDefault(config.DefaultGddServiceVersion)
 	meta["group"] = group
 	meta["version"] = version
+	if zone := config.GddServiceZone.LoadOrDefault(config.DefaultGddServiceZone); stringutils.IsNotEmpty(zone) {
+		meta["zone"] = zone
+	}
 	meta["registerAt"] = time.Now().Local().Format(constants.FORMAT8)
 	meta["goVer"] = runtime.Version()
 	meta["weight"] = weight
@@ -104,7 +108,11 @@ func populateMeta(meta map[string]interface{}, userData ...map[string]interface{
 func NewRest(data ...map[string]interface{}) {
 	service := config.GetServiceName() + "_" + string(cons.REST_TYPE)
 	httpPort := config.GetPort()
-	restEndpoint = registerService(service, httpPort, "http", data...)
+	scheme := "http"
+	if tlsx.ServerEnabled() {
+		scheme = "https"
+	}
+	restEndpoint = registerService(service, httpPort, scheme, data...)
 	zlogger.Info().Msgf("[go-doudou] %s registered to zookeeper successfully", service)
 }
 
@@ -220,7 +228,7 @@ func (n *RRServiceProvider) SelectServer() string {
 	next := int(atomic.AddUint64(&n.current, uint64(1)) % uint64(len(instances)))
 	n.current = uint64(next)
 	selected := instances[next]
-	return fmt.Sprintf("http://%s%s", selected.addr, selected.rootPath)
+	return fmt.Sprintf("%s://%s%s", tlsx.Scheme(), selected.addr, selected.rootPath)
 }
 
 func (r *RRServiceProvider) Close() {
@@ -282,7 +290,7 @@ func (n *SWRRServiceProvider) SelectServer() string {
 		}
 	}
 	selected.currentWeight -= total
-	return fmt.Sprintf("http://%s%s", selected.addr, selected.rootPath)
+	return fmt.Sprintf("%s://%s%s", tlsx.Scheme(), selected.addr, selected.rootPath)
 }
 
 // NewSWRRServiceProvider creates new SWRRServiceProvider instance
@@ -316,7 +324,7 @@ func NewGrpcClientConn(conf ServiceConfig, lb string, dialOptions ...grpc.DialOp
 		Version:     conf.Version,
 	})
 	serverAddr := fmt.Sprintf("zk://%s/", conf.Name)
-	dialOptions = append(dialOptions, grpc.WithBlock(), grpc.WithDefaultServiceConfig(`{"loadBalancingPolicy": "`+lb+`"}`))
+	dialOptions = append(tlsx.DialOptions(dialOptions...), grpc.WithBlock(), grpc.WithDefaultServiceConfig(`{"loadBalancingPolicy": "`+lb+`"}`))
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 	grpcConn, err := grpc.DialContext(ctx, serverAddr, dialOptions...)
@@ -3,17 +3,24 @@ package rest
 import (
 	"fmt"
 	"net/http"
+	"strconv"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 // BizError is used for business error implemented error interface
 // StatusCode will be set to http response status code
 // ErrCode is used for business error code
 // ErrMsg is custom error message
+// Details is optional structured data such as validation violations, it will be written to response body as details
 type BizError struct {
 	StatusCode int
 	ErrCode    int
 	ErrMsg     string
 	Cause      error
+	Details    interface{}
 }
 
 type BizErrorOption func(bizError *BizError)
@@ -36,6 +43,12 @@ func WithCause(cause error) BizErrorOption {
 	}
 }
 
+func WithDetails(details interface{}) BizErrorOption {
+	return func(bizError *BizError) {
+		bizError.Details = details
+	}
+}
+
 // NewBizError is factory function for creating an instance of BizError struct
 func NewBizError(err error, opts ...BizErrorOption) BizError {
 	bz := BizError{
@@ -69,3 +82,103 @@ func HandleBadRequestErr(err error) {
 func HandleInternalServerError(err error) {
 	panic(NewBizError(err))
 }
+
+// errorInfoDomain is domain of errdetails.ErrorInfo carrying ErrCode in grpc status
+const errorInfoDomain = "go-doudou"
+
+// GRPCStatus makes BizError returned from grpc service implementation be sent as grpc status
+// with code mapped from StatusCode, ErrCode is carried by an errdetails.ErrorInfo
+func (b BizError) GRPCStatus() *status.Status {
+	st := status.New(CodeFromHTTPStatus(b.StatusCode), b.ErrMsg)
+	if withDetails, err := st.WithDetails(&errdetails.ErrorInfo{
+		Reason:   strconv.Itoa(b.ErrCode),
+		Domain:   errorInfoDomain,
+		Metadata: map[string]string{"errCode": strconv.Itoa(b.ErrCode)},
+	}); err == nil {
+		st = withDetails
+	}
+	return st
+}
+
+// BizErrorFromStatus converts grpc status to BizError, ErrCode is restored if st is returned by BizError.GRPCStatus,
+// otherwise grpc code is used as ErrCode
+func BizErrorFromStatus(st *status.Status) BizError {
+	bz := BizError{
+		StatusCode: HTTPStatusFromCode(st.Code()),
+		ErrCode:    int(st.Code()),
+		ErrMsg:     st.Message(),
+	}
+	for _, detail := range st.Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok && info.Domain == errorInfoDomain {
+			if errCode, err := strconv.Atoi(info.Metadata["errCode"]); err == nil {
+				bz.ErrCode = errCode
+			}
+		}
+	}
+	return bz
+}
+
+// HTTPStatusFromCode maps grpc code to http status code following
+// https://github.com/googleapis/googleapis/blob/master/google/rpc/code.proto
+func HTTPStatusFromCode(code codes.Code) int {
+	switch code {
+	case codes.OK:
+		return http.StatusOK
+	case codes.Canceled:
+		return 499
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return http.StatusBadRequest
+	case codes.DeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case codes.NotFound:
+		return http.StatusNotFound
+	case codes.AlreadyExists, codes.Aborted:
+		return http.StatusConflict
+	case codes.PermissionDenied:
+		return http.StatusForbidden
+	case codes.Unauthenticated:
+		return http.StatusUnauthorized
+	case codes.ResourceExhausted:
+		return http.StatusTooManyRequests
+	case codes.Unimplemented:
+		return http.StatusNotImplemented
+	case codes.Unavailable:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// CodeFromHTTPStatus maps http status code to grpc code, it is the reverse of HTTPStatusFromCode
+func CodeFromHTTPStatus(statusCode int) codes.Code {
+	switch statusCode {
+	case http.StatusOK:
+		return codes.OK
+	case 499:
+		return codes.Canceled
+	case http.StatusBadRequest:
+		return codes.InvalidArgument
+	case http.StatusGatewayTimeout, http.StatusRequestTimeout:
+		return codes.DeadlineExceeded
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusConflict:
+		return codes.Aborted
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	case http.StatusNotImplemented:
+		return codes.Unimplemented
+	case http.StatusServiceUnavailable:
+		return codes.Unavailable
+	}
+	switch {
+	case statusCode >= 400 && statusCode < 500:
+		return codes.FailedPrecondition
+	default:
+		return codes.Internal
+	}
+}
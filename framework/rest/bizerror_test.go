@@ -4,6 +4,8 @@ import (
 	"github.com/pkg/errors"
 	. "github.com/smartystreets/goconvey/convey"
 	"github.com/unionj-cloud/go-doudou/v2/framework/rest"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	"testing"
 )
 
@@ -30,3 +32,33 @@ func TestWithErrCode(t *testing.T) {
 		})
 	})
 }
+
+func TestWithDetails(t *testing.T) {
+	Convey("Create a BizError with structured details", t, func() {
+		details := []string{"sorting by age is not allowed"}
+		bizError := rest.NewBizError(errors.New("invalid parameter"), rest.WithStatusCode(400), rest.WithDetails(details))
+		So(bizError.StatusCode, ShouldEqual, 400)
+		So(bizError.Details, ShouldResemble, details)
+	})
+}
+
+func TestBizErrorGRPCStatus(t *testing.T) {
+	Convey("BizError should be converted to grpc status and back", t, func() {
+		bizError := rest.NewBizError(errors.New("user not found"), rest.WithStatusCode(404), rest.WithErrCode(10404))
+		st, ok := status.FromError(bizError)
+		So(ok, ShouldBeTrue)
+		So(st.Code(), ShouldEqual, codes.NotFound)
+		So(st.Message(), ShouldEqual, "user not found")
+
+		restored := rest.BizErrorFromStatus(st)
+		So(restored.StatusCode, ShouldEqual, 404)
+		So(restored.ErrCode, ShouldEqual, 10404)
+		So(restored.ErrMsg, ShouldEqual, "user not found")
+
+		Convey("Plain grpc status should use grpc code as error code", func() {
+			restored = rest.BizErrorFromStatus(status.New(codes.Unauthenticated, "token expired"))
+			So(restored.StatusCode, ShouldEqual, 401)
+			So(restored.ErrCode, ShouldEqual, int(codes.Unauthenticated))
+		})
+	})
+}
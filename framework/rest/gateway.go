@@ -4,21 +4,15 @@ import (
 	"fmt"
 	lru "github.com/hashicorp/golang-lru"
 	"github.com/unionj-cloud/go-doudou/v2/framework/cache"
-	"github.com/unionj-cloud/go-doudou/v2/framework/internal/config"
 	"github.com/unionj-cloud/go-doudou/v2/framework/registry"
-	"github.com/unionj-cloud/go-doudou/v2/framework/registry/constants"
-	"github.com/unionj-cloud/go-doudou/v2/framework/registry/etcd"
-	"github.com/unionj-cloud/go-doudou/v2/framework/registry/nacos"
-	"github.com/unionj-cloud/go-doudou/v2/framework/registry/zk"
-	"github.com/wubin1989/nacos-sdk-go/v2/vo"
-	"go.etcd.io/etcd/client/v3"
+	"github.com/unionj-cloud/go-doudou/v2/toolkit/stringutils"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
-	"os"
 	"regexp"
 	"strconv"
 	"strings"
+	"sync"
 )
 
 // Headers borrowed from labstack/echo
@@ -78,7 +72,11 @@ type ProxyTarget struct {
 }
 
 type ProxyConfig struct {
+	// ProviderStore caches service providers by service name, a lru store of 128 providers closing evicted
+	// ones by default
 	ProviderStore cache.IStore
+	// Discover creates provider of service, registry.Discover by default
+	Discover func(service string) registry.IServiceProvider
 	// To customize the transport to remote.
 	// Examples: If custom TLS certificates are required.
 	Transport http.RoundTripper
@@ -110,87 +108,66 @@ func getPath(r *http.Request) string {
 	return path
 }
 
-func isWebSocket(r *http.Request) bool {
-	upgrade := r.Header.Get(HeaderUpgrade)
-	return strings.ToLower(upgrade) == "websocket"
+// newProviderStore returns store closing service providers evicted from it
+func newProviderStore(size int) cache.IStore {
+	store, _ := lru.NewWithEvict(size, func(key interface{}, value interface{}) {
+		if provider, ok := value.(registry.IServiceProvider); ok {
+			provider.Close()
+		}
+	})
+	return cache.NewLruCacheAdapter(store)
 }
 
+// Proxy forwards requests with path /<service name>/... to instances of the service discovered by registry.Discover.
+// See NewGateway for declarative routes.
 func Proxy(proxyConfig ProxyConfig) func(inner http.Handler) http.Handler {
 	if proxyConfig.ProviderStore == nil {
-		arc, _ := lru.NewARC(128)
-		proxyConfig.ProviderStore = arc
+		proxyConfig.ProviderStore = newProviderStore(128)
 	}
 	if proxyConfig.Transport == nil {
 		proxyConfig.Transport = http.DefaultTransport
 	}
+	if proxyConfig.Discover == nil {
+		proxyConfig.Discover = func(service string) registry.IServiceProvider {
+			return registry.Discover(service)
+		}
+	}
+	var lock sync.Mutex
+	// selectServer caches provider of the service even if it has no instance yet, as registries fill providers
+	// asynchronously. Providers of arbitrary path segments are evicted by the bounded store.
+	selectServer := func(serviceName string) string {
+		lock.Lock()
+		if value, ok := proxyConfig.ProviderStore.Get(serviceName); ok {
+			if provider, ok := value.(registry.IServiceProvider); ok {
+				lock.Unlock()
+				return provider.SelectServer()
+			}
+		}
+		lock.Unlock()
+		provider := proxyConfig.Discover(serviceName)
+		lock.Lock()
+		if value, ok := proxyConfig.ProviderStore.Get(serviceName); ok {
+			if cached, ok := value.(registry.IServiceProvider); ok {
+				// cached by concurrent request
+				lock.Unlock()
+				provider.Close()
+				return cached.SelectServer()
+			}
+		}
+		proxyConfig.ProviderStore.Add(serviceName, provider)
+		lock.Unlock()
+		return provider.SelectServer()
+	}
 	return func(inner http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			if isWebSocket(r) || r.Header.Get(HeaderAccept) == "text/event-stream" {
-				http.Error(w, fmt.Sprintf("not support"), http.StatusBadGateway)
-				return
-			}
 			parts := strings.Split(r.URL.Path, "/")
-			if len(parts) <= 1 {
+			if len(parts) <= 1 || stringutils.IsEmpty(parts[1]) {
 				http.Error(w, fmt.Sprintf("request url must be prefixed / + service name"), http.StatusBadGateway)
 				return
 			}
 			serviceName := parts[1]
-			modes := strings.Split(os.Getenv("GDD_SERVICE_DISCOVERY_MODE"), ",")
-			// TODO call Close method to release resource
-			var provider registry.IServiceProvider
-			for _, mode := range modes {
-				switch mode {
-				case constants.SD_NACOS:
-					cluster := config.GddNacosClusterName.LoadOrDefault(config.DefaultGddNacosClusterName)
-					group := config.GddNacosGroupName.LoadOrDefault(config.DefaultGddNacosGroupName)
-					_, err := nacos.NamingClient.GetService(vo.GetServiceParam{
-						Clusters:    []string{cluster},
-						ServiceName: serviceName,
-						GroupName:   group,
-					})
-					if err != nil {
-						continue
-					}
-					if value, ok := proxyConfig.ProviderStore.Get(serviceName); ok {
-						if provider, ok = value.(*nacos.WRRServiceProvider); ok {
-							break
-						}
-					}
-					provider = nacos.NewWRRServiceProvider(serviceName, nacos.WithNacosClusters([]string{cluster}), nacos.WithNacosGroupName(group))
-					proxyConfig.ProviderStore.Add(serviceName, provider)
-				case constants.SD_ETCD:
-					getResponse, err := etcd.EtcdCli.Get(r.Context(), serviceName+"/", clientv3.WithPrefix())
-					if err != nil || getResponse.Count == 0 {
-						continue
-					}
-					if value, ok := proxyConfig.ProviderStore.Get(serviceName); ok {
-						if provider, ok = value.(*etcd.SWRRServiceProvider); ok {
-							break
-						}
-					}
-					provider = etcd.NewSWRRServiceProvider(serviceName)
-					proxyConfig.ProviderStore.Add(serviceName, provider)
-				case constants.SD_ZK:
-					if value, ok := proxyConfig.ProviderStore.Get(serviceName); ok {
-						if provider, ok = value.(*zk.SWRRServiceProvider); ok {
-							break
-						}
-					}
-					group := config.GddServiceGroup.LoadOrDefault(config.DefaultGddServiceGroup)
-					version := config.GddServiceVersion.LoadOrDefault(config.DefaultGddServiceVersion)
-					provider = zk.NewSWRRServiceProvider(zk.ServiceConfig{
-						Name:    serviceName,
-						Group:   group,
-						Version: version,
-					})
-					proxyConfig.ProviderStore.Add(serviceName, provider)
-				default:
-				}
-				if provider != nil {
-					break
-				}
-			}
-			if provider == nil {
+			server := selectServer(serviceName)
+			if stringutils.IsEmpty(server) {
 				http.Error(w, fmt.Sprintf("available server for service %s not found", serviceName), http.StatusBadGateway)
 				return
 			}
@@ -199,7 +176,7 @@ func Proxy(proxyConfig ProxyConfig) func(inner http.Handler) http.Handler {
 			if replacer != nil {
 				r.URL.Path = replacer.Replace("/$1")
 			}
-			parsed, err := url.Parse(provider.SelectServer())
+			parsed, err := url.Parse(server)
 			if err != nil {
 				http.Error(w, fmt.Sprintf("available server for service %s not found with error: %s", serviceName, err), http.StatusBadGateway)
 				return
@@ -244,7 +221,8 @@ func proxyHTTP(tgt *ProxyTarget, config ProxyConfig) http.Handler {
 			req.Header.Set("User-Agent", "")
 		}
 	}
-	proxy := &httputil.ReverseProxy{Director: director}
+	// flush at once, so that streaming responses such as server-sent events pass through
+	proxy := &httputil.ReverseProxy{Director: director, FlushInterval: -1}
 	proxy.ErrorHandler = func(w http.ResponseWriter, req *http.Request, err error) {
 		desc := target.String()
 		if tgt.Name != "" {
@@ -0,0 +1,366 @@
+package rest_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru"
+	"github.com/stretchr/testify/require"
+	"github.com/unionj-cloud/go-doudou/v2/framework/cache"
+	"github.com/unionj-cloud/go-doudou/v2/framework/internal/config"
+	"github.com/unionj-cloud/go-doudou/v2/framework/registry"
+	"github.com/unionj-cloud/go-doudou/v2/framework/rest"
+)
+
+// newBackend starts in-process backend echoing its name, request path and headers
+func newBackend(t *testing.T, name string) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Backend", name)
+		w.Header().Set("X-Internal", "secret")
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"backend": name,
+			"path":    r.URL.Path,
+			"query":   r.URL.RawQuery,
+			"tenant":  r.Header.Get("X-Tenant"),
+		})
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func get(t *testing.T, handler http.Handler, req *http.Request) (*httptest.ResponseRecorder, map[string]string) {
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	var body map[string]string
+	_ = json.Unmarshal(w.Body.Bytes(), &body)
+	return w, body
+}
+
+type fakeProvider struct {
+	lock    sync.Mutex
+	servers []string
+	next    int
+	closed  bool
+}
+
+func (p *fakeProvider) SelectServer() string {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	if len(p.servers) == 0 {
+		return ""
+	}
+	server := p.servers[p.next%len(p.servers)]
+	p.next++
+	return server
+}
+
+func (p *fakeProvider) Close() {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.closed = true
+}
+
+func TestGatewayMatchAndRewrite(t *testing.T) {
+	users := newBackend(t, "users")
+	admin := newBackend(t, "admin")
+	gw := rest.NewGateway(rest.WithGatewayRoutes(
+		rest.GatewayRoute{
+			Name:     "admin",
+			Path:     "/api/users",
+			Hosts:    []string{"*.admin.example.com"},
+			Headers:  map[string]string{"X-Role": "^admin$"},
+			Upstream: admin.URL,
+		},
+		rest.GatewayRoute{
+			Name:        "users",
+			Path:        "/api/users/",
+			Methods:     []string{http.MethodGet},
+			Upstream:    users.URL,
+			StripPrefix: true,
+			RequestHeaders: rest.GatewayHeaderTransform{
+				Set: map[string]string{"X-Tenant": "t1"},
+			},
+			ResponseHeaders: rest.GatewayHeaderTransform{
+				Remove: []string{"X-Internal"},
+				Add:    map[string]string{"X-Gateway": "go-doudou"},
+			},
+		},
+		rest.GatewayRoute{
+			Name:         "legacy",
+			Path:         "/v1",
+			Upstream:     users.URL + "/root",
+			RewriteRegex: "^/v1/(.*)$",
+			Rewrite:      "/api/$1",
+		},
+	))
+	defer gw.Close()
+
+	w, body := get(t, gw, httptest.NewRequest(http.MethodGet, "/api/users/1?verbose=true", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, map[string]string{"backend": "users", "path": "/1", "query": "verbose=true", "tenant": "t1"}, body)
+	require.Empty(t, w.Header().Get("X-Internal"))
+	require.Equal(t, "go-doudou", w.Header().Get("X-Gateway"))
+
+	req := httptest.NewRequest(http.MethodGet, "http://api.admin.example.com/api/users/1", nil)
+	req.Header.Set("X-Role", "admin")
+	_, body = get(t, gw, req)
+	require.Equal(t, "admin", body["backend"])
+	require.Equal(t, "/api/users/1", body["path"])
+
+	_, body = get(t, gw, httptest.NewRequest(http.MethodGet, "/v1/users", nil))
+	require.Equal(t, "/root/api/users", body["path"])
+
+	w, _ = get(t, gw, httptest.NewRequest(http.MethodPost, "/api/users/1", nil))
+	require.Equal(t, http.StatusNotFound, w.Code)
+	w, _ = get(t, gw, httptest.NewRequest(http.MethodGet, "/api/usersx", nil))
+	require.Equal(t, http.StatusNotFound, w.Code)
+
+	// unmatched requests are passed on by middleware
+	handler := gw.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+	w, _ = get(t, handler, httptest.NewRequest(http.MethodGet, "/other", nil))
+	require.Equal(t, http.StatusTeapot, w.Code)
+}
+
+func TestGatewayServiceRetries(t *testing.T) {
+	var failures int32
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&failures, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+	healthy := newBackend(t, "healthy")
+	provider := &fakeProvider{servers: []string{failing.URL, healthy.URL}}
+	gw := rest.NewGateway(
+		rest.WithGatewayRoutes(rest.GatewayRoute{Path: "/users", Service: "usersvc_rest", Retries: 1, RetryNonIdempotent: true}),
+		rest.WithGatewayDiscovery(func(service string) registry.IServiceProvider {
+			require.Equal(t, "usersvc_rest", service)
+			return provider
+		}),
+	)
+	for i := 0; i < 4; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(`{"name":"jack"}`))
+		w, body := get(t, gw, req)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Equal(t, "healthy", body["backend"])
+	}
+	// round-robin picks the failing backend first for each request, then retries on the healthy one
+	require.Equal(t, int32(4), atomic.LoadInt32(&failures))
+	gw.Close()
+	require.True(t, provider.closed)
+
+	provider = &fakeProvider{}
+	gw = rest.NewGateway(
+		rest.WithGatewayRoutes(rest.GatewayRoute{Path: "/users", Service: "usersvc_rest"}),
+		rest.WithGatewayDiscovery(func(service string) registry.IServiceProvider {
+			return provider
+		}),
+	)
+	defer gw.Close()
+	w, _ := get(t, gw, httptest.NewRequest(http.MethodGet, "/users", nil))
+	require.Equal(t, http.StatusServiceUnavailable, w.Code)
+}
+
+func TestGatewayRetryIdempotent(t *testing.T) {
+	var failures int32
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&failures, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+	healthy := newBackend(t, "healthy")
+	provider := &fakeProvider{servers: []string{failing.URL, healthy.URL}}
+	gw := rest.NewGateway(
+		rest.WithGatewayRoutes(rest.GatewayRoute{Path: "/users", Service: "usersvc_rest", Retries: 1}),
+		rest.WithGatewayDiscovery(func(service string) registry.IServiceProvider {
+			return provider
+		}),
+	)
+	defer gw.Close()
+	// the failing backend is picked first for each request
+	w, body := get(t, gw, httptest.NewRequest(http.MethodGet, "/users", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "healthy", body["backend"])
+
+	// non-idempotent methods are not retried without opt-in
+	provider.next = 0
+	w, _ = get(t, gw, httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(`{"name":"jack"}`)))
+	require.Equal(t, http.StatusServiceUnavailable, w.Code)
+
+	// requests with body too large to buffer are not retried
+	provider.next = 0
+	req := httptest.NewRequest(http.MethodPut, "/users", strings.NewReader(strings.Repeat("a", 2<<20)))
+	req.ContentLength = -1
+	w, _ = get(t, gw, req)
+	require.Equal(t, http.StatusServiceUnavailable, w.Code)
+	require.Equal(t, int32(3), atomic.LoadInt32(&failures))
+}
+
+func TestGatewayAuthAndRateLimit(t *testing.T) {
+	backend := newBackend(t, "users")
+	gw := rest.NewGateway(
+		rest.WithGatewayAuth("apikey", rest.NewAPIKeyAuth("X-API-Key", "k1", "k2")),
+		rest.WithGatewayAuth("basic", rest.NewBasicAuth(map[string]string{"admin": "admin"})),
+		rest.WithGatewayRoutes(
+			rest.GatewayRoute{Path: "/admin", Upstream: backend.URL, Auth: []string{"apikey", "basic"}},
+			rest.GatewayRoute{Path: "/limited", Upstream: backend.URL, RateLimit: "1-M", RateLimitBy: "header:X-User"},
+		),
+	)
+	defer gw.Close()
+
+	req := httptest.NewRequest(http.MethodGet, "/admin", nil)
+	req.Header.Set("X-API-Key", "k2")
+	w, _ := get(t, gw, req)
+	require.Equal(t, http.StatusUnauthorized, w.Code)
+	req.SetBasicAuth("admin", "admin")
+	w, _ = get(t, gw, req)
+	require.Equal(t, http.StatusOK, w.Code)
+
+	for _, user := range []string{"jack", "rose"} {
+		req = httptest.NewRequest(http.MethodGet, "/limited", nil)
+		req.Header.Set("X-User", user)
+		w, _ = get(t, gw, req)
+		require.Equal(t, http.StatusOK, w.Code)
+		w, _ = get(t, gw, req)
+		require.Equal(t, http.StatusTooManyRequests, w.Code)
+	}
+
+	require.Panics(t, func() {
+		rest.NewGateway(rest.WithGatewayRoutes(rest.GatewayRoute{Path: "/admin", Upstream: backend.URL, Auth: []string{"jwt"}}))
+	})
+}
+
+func TestGatewayTimeout(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-time.After(time.Second):
+		case <-r.Context().Done():
+		}
+	}))
+	defer slow.Close()
+	gw := rest.NewGateway(rest.WithGatewayRoutes(rest.GatewayRoute{Path: "/slow", Upstream: slow.URL, Timeout: "50ms"}))
+	defer gw.Close()
+	w, _ := get(t, gw, httptest.NewRequest(http.MethodGet, "/slow", nil))
+	require.Equal(t, http.StatusGatewayTimeout, w.Code)
+}
+
+func TestGatewayAggregate(t *testing.T) {
+	users := newBackend(t, "users")
+	orders := newBackend(t, "orders")
+	gw := rest.NewGateway(rest.WithGatewayRoutes(rest.GatewayRoute{
+		Path: "/dashboard",
+		Aggregate: []rest.GatewayAggregate{
+			{Name: "user", Upstream: users.URL, Path: "/users/1"},
+			{Name: "orders", Upstream: orders.URL, Path: "/orders"},
+			{Name: "coupons", Upstream: "http://127.0.0.1:1", Path: "/coupons"},
+		},
+	}))
+	defer gw.Close()
+	w := httptest.NewRecorder()
+	gw.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/dashboard?uid=1", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "coupons", w.Header().Get(rest.HeaderXGatewayFailed))
+	var body map[string]map[string]string
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+	require.Equal(t, "users", body["user"]["backend"])
+	require.Equal(t, "/users/1", body["user"]["path"])
+	require.Equal(t, "uid=1", body["orders"]["query"])
+	require.Nil(t, body["coupons"])
+}
+
+func TestGatewayStreaming(t *testing.T) {
+	release := make(chan struct{})
+	sse := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, "data: first\n\n")
+		w.(http.Flusher).Flush()
+		<-release
+		fmt.Fprint(w, "data: second\n\n")
+	}))
+	defer sse.Close()
+	defer close(release)
+	gw := rest.NewGateway(rest.WithGatewayRoutes(rest.GatewayRoute{Path: "/events", Upstream: sse.URL}))
+	defer gw.Close()
+	server := httptest.NewServer(gw)
+	defer server.Close()
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL+"/events", nil)
+	req.Header.Set(rest.HeaderAccept, "text/event-stream")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	// the first event arrives before backend finishes response
+	line, err := bufio.NewReader(resp.Body).ReadString('\n')
+	require.NoError(t, err)
+	require.Equal(t, "data: first\n", line)
+}
+
+func TestGatewayReloadRoutes(t *testing.T) {
+	users := newBackend(t, "users")
+	orders := newBackend(t, "orders")
+	t.Setenv(string(config.GddGatewayRoutes), fmt.Sprintf(`[{"path":"/api","upstream":"%s"}]`, users.URL))
+	gw := rest.NewGateway()
+	defer gw.Close()
+	_, body := get(t, gw, httptest.NewRequest(http.MethodGet, "/api", nil))
+	require.Equal(t, "users", body["backend"])
+
+	t.Setenv(string(config.GddGatewayRoutes), fmt.Sprintf(`[{"path":"/api","upstream":"%s"}]`, orders.URL))
+	_, body = get(t, gw, httptest.NewRequest(http.MethodGet, "/api", nil))
+	require.Equal(t, "orders", body["backend"])
+
+	// invalid routes are ignored
+	t.Setenv(string(config.GddGatewayRoutes), `[{"path":"/api"}]`)
+	_, body = get(t, gw, httptest.NewRequest(http.MethodGet, "/api", nil))
+	require.Equal(t, "orders", body["backend"])
+}
+
+func TestProxyServiceNotFound(t *testing.T) {
+	t.Setenv(string(config.GddServiceDiscoveryMode), "")
+	handler := rest.Proxy(rest.ProxyConfig{})(http.NotFoundHandler())
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/usersvc/users", nil))
+	require.Equal(t, http.StatusBadGateway, w.Code)
+	body, _ := ioutil.ReadAll(w.Body)
+	require.Contains(t, string(body), "usersvc")
+
+	// providers are cached even without instance, as registries fill them asynchronously
+	store, _ := lru.New(8)
+	handler = rest.Proxy(rest.ProxyConfig{ProviderStore: cache.NewLruCacheAdapter(store)})(http.NotFoundHandler())
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/usersvc/users", nil))
+	require.Equal(t, 1, store.Len())
+}
+
+func TestProxyAsyncProvider(t *testing.T) {
+	users := newBackend(t, "users")
+	// providers have no instance until registries respond
+	var providers []*fakeProvider
+	handler := rest.Proxy(rest.ProxyConfig{
+		Discover: func(service string) registry.IServiceProvider {
+			provider := &fakeProvider{}
+			providers = append(providers, provider)
+			return provider
+		},
+	})(http.NotFoundHandler())
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/usersvc/users", nil))
+	require.Equal(t, http.StatusBadGateway, w.Code)
+
+	// the provider filled later is used rather than a new one
+	providers[0].lock.Lock()
+	providers[0].servers = []string{users.URL}
+	providers[0].lock.Unlock()
+	_, body := get(t, handler, httptest.NewRequest(http.MethodGet, "/usersvc/users", nil))
+	require.Equal(t, "users", body["backend"])
+	require.Len(t, providers, 1)
+	require.False(t, providers[0].closed)
+}
@@ -0,0 +1,86 @@
+package rest
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	logger "github.com/unionj-cloud/go-doudou/v2/toolkit/zlogger"
+)
+
+// HeaderXGatewayFailed lists names of aggregated backends failed to respond
+const HeaderXGatewayFailed = "X-Gateway-Failed"
+
+func (g *Gateway) fetch(r *gatewayRoute, a GatewayAggregate, req *http.Request) (json.RawMessage, error) {
+	out, err := http.NewRequestWithContext(req.Context(), http.MethodGet, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	out.URL.Path = a.Path
+	out.URL.RawQuery = req.URL.RawQuery
+	out.Header = req.Header.Clone()
+	out.Header.Del(HeaderContentLength)
+	transport := &gatewayTransport{
+		gateway:  g,
+		service:  a.Service,
+		upstream: a.Upstream,
+		retries:  r.Retries,
+	}
+	resp, err := transport.RoundTrip(out)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, errors.Errorf("status %d", resp.StatusCode)
+	}
+	if !json.Valid(body) {
+		return nil, errors.New("invalid json response")
+	}
+	return body, nil
+}
+
+// aggregate sends GET requests to backends of route concurrently and responds json object of their responses
+// keyed by names, responses of failed backends are null and their names are listed in X-Gateway-Failed header
+func (g *Gateway) aggregate(r *gatewayRoute, w http.ResponseWriter, req *http.Request) {
+	result := make(map[string]json.RawMessage, len(r.Aggregate))
+	var failed []string
+	var lock sync.Mutex
+	var wg sync.WaitGroup
+	for _, a := range r.Aggregate {
+		wg.Add(1)
+		go func(a GatewayAggregate) {
+			defer wg.Done()
+			body, err := g.fetch(r, a, req)
+			lock.Lock()
+			defer lock.Unlock()
+			if err != nil {
+				logger.Error().Err(err).Msgf("[go-doudou] failed to aggregate %s of route %s", a.Name, r.Name)
+				failed = append(failed, a.Name)
+				result[a.Name] = json.RawMessage("null")
+				return
+			}
+			result[a.Name] = body
+		}(a)
+	}
+	wg.Wait()
+	if len(failed) == len(r.Aggregate) {
+		http.Error(w, "all aggregated backends failed", http.StatusBadGateway)
+		return
+	}
+	header := w.Header()
+	header.Set(HeaderContentType, "application/json; charset=UTF-8")
+	if len(failed) > 0 {
+		header.Set(HeaderXGatewayFailed, strings.Join(failed, ","))
+	}
+	r.ResponseHeaders.apply(header)
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,69 @@
+package rest
+
+import (
+	"crypto/subtle"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// gatewayRateLimitKeys is how many clients of a route are rate limited separately at most
+const gatewayRateLimitKeys = 4096
+
+// GatewayAuthPlugin authenticates requests of gateway routes, requests are rejected with 401 if error is
+// returned. Plugins may change request headers, e.g. for passing user id to backends.
+type GatewayAuthPlugin interface {
+	Authenticate(r *http.Request) error
+}
+
+// GatewayAuthFunc is an adapter to use ordinary functions as GatewayAuthPlugin
+type GatewayAuthFunc func(r *http.Request) error
+
+// Authenticate calls f(r)
+func (f GatewayAuthFunc) Authenticate(r *http.Request) error {
+	return f(r)
+}
+
+// NewAPIKeyAuth returns auth plugin accepting requests with one of keys in header
+func NewAPIKeyAuth(header string, keys ...string) GatewayAuthPlugin {
+	return GatewayAuthFunc(func(r *http.Request) error {
+		key := r.Header.Get(header)
+		for _, k := range keys {
+			if subtle.ConstantTimeCompare([]byte(key), []byte(k)) == 1 {
+				return nil
+			}
+		}
+		return errors.New("invalid api key")
+	})
+}
+
+// NewBasicAuth returns auth plugin accepting requests with http basic auth of users, users is keyed by
+// username with password as value
+func NewBasicAuth(users map[string]string) GatewayAuthPlugin {
+	return GatewayAuthFunc(func(r *http.Request) error {
+		user, pass, ok := r.BasicAuth()
+		if ok {
+			if expected, exists := users[user]; exists && subtle.ConstantTimeCompare([]byte(pass), []byte(expected)) == 1 {
+				return nil
+			}
+		}
+		return errors.New("invalid username or password")
+	})
+}
+
+// rateLimitKey returns key of request for rate limiting by RateLimitBy
+func (r *gatewayRoute) rateLimitKey(req *http.Request) string {
+	switch {
+	case r.RateLimitBy == "route":
+		return ""
+	case strings.HasPrefix(r.RateLimitBy, "header:"):
+		return req.Header.Get(strings.TrimPrefix(r.RateLimitBy, "header:"))
+	}
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,602 @@
+package rest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/unionj-cloud/go-doudou/v2/framework/internal/config"
+	"github.com/unionj-cloud/go-doudou/v2/framework/ratelimit"
+	"github.com/unionj-cloud/go-doudou/v2/framework/ratelimit/memrate"
+	"github.com/unionj-cloud/go-doudou/v2/framework/registry"
+	"github.com/unionj-cloud/go-doudou/v2/framework/registry/balancer"
+	"github.com/unionj-cloud/go-doudou/v2/toolkit/deadline"
+	"github.com/unionj-cloud/go-doudou/v2/toolkit/stringutils"
+	logger "github.com/unionj-cloud/go-doudou/v2/toolkit/zlogger"
+)
+
+// errNoGatewayInstance is returned if no instance of the service of gateway route is available
+var errNoGatewayInstance = errors.New("no available instance")
+
+// gatewayMaxRetryBody is max size of request body buffered for retries, larger requests are not retried
+const gatewayMaxRetryBody = 1 << 20
+
+// GatewayHeaderTransform changes headers of requests or responses passing gateway, headers are removed
+// first, then set, then added
+type GatewayHeaderTransform struct {
+	Set    map[string]string `json:"set,omitempty"`
+	Add    map[string]string `json:"add,omitempty"`
+	Remove []string          `json:"remove,omitempty"`
+}
+
+func (t GatewayHeaderTransform) apply(header http.Header) {
+	for _, k := range t.Remove {
+		header.Del(k)
+	}
+	for k, v := range t.Set {
+		header.Set(k, v)
+	}
+	for k, v := range t.Add {
+		header.Add(k, v)
+	}
+}
+
+// GatewayAggregate is one of backends whose json responses are merged into one json object keyed by Name
+type GatewayAggregate struct {
+	Name string `json:"name"`
+	// Service is name of the service discovered by registry.Discover, e.g. usersvc_rest
+	Service string `json:"service,omitempty"`
+	// Upstream is static base url of the backend, e.g. http://10.0.0.1:6060
+	Upstream string `json:"upstream,omitempty"`
+	// Path is request path of the backend, query of gateway request is passed on
+	Path string `json:"path"`
+}
+
+// GatewayRoute declares which requests are matched and how they are forwarded. A request matches a route if
+// all of Path, Hosts, Methods and Headers match it, empty ones match any request.
+type GatewayRoute struct {
+	Name string `json:"name,omitempty"`
+	// Path matches request path by prefix at path segment boundary, e.g. /api/users matches /api/users and
+	// /api/users/1 but not /api/usersx
+	Path string `json:"path,omitempty"`
+	// Hosts matches host of request, e.g. api.example.com or *.example.com
+	Hosts []string `json:"hosts,omitempty"`
+	// Methods matches http methods of request
+	Methods []string `json:"methods,omitempty"`
+	// Headers matches request headers by regular expressions
+	Headers map[string]string `json:"headers,omitempty"`
+	// Service is name of the service discovered by registry.Discover, e.g. usersvc_rest
+	Service string `json:"service,omitempty"`
+	// Upstream is static base url requests are forwarded to if Service is empty, e.g. http://10.0.0.1:6060
+	Upstream string `json:"upstream,omitempty"`
+	// StripPrefix removes Path from request path before forwarding
+	StripPrefix bool `json:"stripPrefix,omitempty"`
+	// RewriteRegex and Rewrite replace request path, e.g. ^/v1/(.*) and /api/$1
+	RewriteRegex string `json:"rewriteRegex,omitempty"`
+	Rewrite      string `json:"rewrite,omitempty"`
+	// Timeout limits time of forwarding a request, e.g. 5s. Streaming responses are cut off by it as well.
+	Timeout string `json:"timeout,omitempty"`
+	// Retries is number of retries on another instance if connection fails or 502, 503 or 504 is responded.
+	// Only requests of idempotent methods with body up to 1MB are retried.
+	Retries int `json:"retries,omitempty"`
+	// RetryNonIdempotent retries requests of non-idempotent methods such as POST and PATCH as well
+	RetryNonIdempotent bool `json:"retryNonIdempotent,omitempty"`
+	// Auth is names of auth plugins registered by WithGatewayAuth, requests must pass all of them
+	Auth []string `json:"auth,omitempty"`
+	// RateLimit limits rate of requests in format of ratelimit.Parse, e.g. 10-S-20
+	RateLimit string `json:"rateLimit,omitempty"`
+	// RateLimitBy is what requests are limited by, ip by default, route or header:<name>
+	RateLimitBy string `json:"rateLimitBy,omitempty"`
+	// RequestHeaders changes request headers before forwarding
+	RequestHeaders GatewayHeaderTransform `json:"requestHeaders,omitempty"`
+	// ResponseHeaders changes response headers before responding
+	ResponseHeaders GatewayHeaderTransform `json:"responseHeaders,omitempty"`
+	// Aggregate sends requests to all the backends concurrently and merges their json responses,
+	// Service and Upstream of the route are not used if it is set
+	Aggregate []GatewayAggregate `json:"aggregate,omitempty"`
+}
+
+type gatewayRoute struct {
+	GatewayRoute
+	headers map[string]*regexp.Regexp
+	rewrite *regexp.Regexp
+	timeout time.Duration
+	auth    []GatewayAuthPlugin
+	limits  *memrate.MemoryStore
+	proxy   http.Handler
+}
+
+func (r *gatewayRoute) matchPath(path string) bool {
+	prefix := strings.TrimSuffix(r.Path, "/")
+	return stringutils.IsEmpty(prefix) || path == prefix || strings.HasPrefix(path, prefix+"/")
+}
+
+func (r *gatewayRoute) matchHost(host string) bool {
+	if len(r.Hosts) == 0 {
+		return true
+	}
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	for _, pattern := range r.Hosts {
+		if strings.HasPrefix(pattern, "*.") && strings.HasSuffix(host, pattern[1:]) {
+			return true
+		}
+		if strings.EqualFold(pattern, host) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *gatewayRoute) match(req *http.Request) bool {
+	if !r.matchPath(req.URL.Path) || !r.matchHost(req.Host) {
+		return false
+	}
+	if len(r.Methods) > 0 {
+		matched := false
+		for _, method := range r.Methods {
+			if strings.EqualFold(method, req.Method) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	for k, re := range r.headers {
+		if !re.MatchString(req.Header.Get(k)) {
+			return false
+		}
+	}
+	return true
+}
+
+// rewritePath returns path forwarded to backend
+func (r *gatewayRoute) rewritePath(path string) string {
+	if r.StripPrefix {
+		path = strings.TrimPrefix(path, strings.TrimSuffix(r.Path, "/"))
+		if !strings.HasPrefix(path, "/") {
+			path = "/" + path
+		}
+	}
+	if r.rewrite != nil {
+		path = r.rewrite.ReplaceAllString(path, r.Rewrite)
+	}
+	return path
+}
+
+// Gateway forwards requests to services discovered from registries or static upstreams by declarative routes
+type Gateway struct {
+	static    bool
+	transport http.RoundTripper
+	discover  func(service string) registry.IServiceProvider
+	auth      map[string]GatewayAuthPlugin
+	lock      sync.Mutex
+	raw       string
+	routes    []*gatewayRoute
+	declared  []GatewayRoute
+	providers map[string]registry.IServiceProvider
+	closed    bool
+}
+
+// GatewayOption configures Gateway
+type GatewayOption func(*Gateway)
+
+// WithGatewayRoutes sets routes of gateway instead of loading them from GDD_GATEWAY_ROUTES
+func WithGatewayRoutes(routes ...GatewayRoute) GatewayOption {
+	return func(g *Gateway) {
+		g.static = true
+		g.declared = routes
+	}
+}
+
+// WithGatewayAuth registers auth plugin by name for routes
+func WithGatewayAuth(name string, plugin GatewayAuthPlugin) GatewayOption {
+	return func(g *Gateway) {
+		g.auth[name] = plugin
+	}
+}
+
+// WithGatewayTransport sets transport to backends, http.DefaultTransport by default
+func WithGatewayTransport(transport http.RoundTripper) GatewayOption {
+	return func(g *Gateway) {
+		g.transport = transport
+	}
+}
+
+// WithGatewayDiscovery sets how service providers are created for services of routes, registry.Discover by default
+func WithGatewayDiscovery(discover func(service string) registry.IServiceProvider) GatewayOption {
+	return func(g *Gateway) {
+		g.discover = discover
+	}
+}
+
+// NewGateway creates Gateway. Routes are loaded from GDD_GATEWAY_ROUTES unless set by WithGatewayRoutes, and
+// reloaded once it is changed, e.g. by config center. Close should be called to release service providers.
+func NewGateway(opts ...GatewayOption) *Gateway {
+	g := &Gateway{
+		transport: http.DefaultTransport,
+		discover: func(service string) registry.IServiceProvider {
+			return registry.Discover(service)
+		},
+		auth:      make(map[string]GatewayAuthPlugin),
+		providers: make(map[string]registry.IServiceProvider),
+	}
+	for _, opt := range opts {
+		opt(g)
+	}
+	if g.static {
+		routes, err := g.compile(g.declared)
+		if err != nil {
+			logger.Panic().Err(err).Msg("[go-doudou] invalid gateway routes")
+		}
+		g.routes = routes
+	}
+	return g
+}
+
+func (g *Gateway) compile(declared []GatewayRoute) ([]*gatewayRoute, error) {
+	routes := make([]*gatewayRoute, 0, len(declared))
+	for i, item := range declared {
+		r := &gatewayRoute{
+			GatewayRoute: item,
+			headers:      make(map[string]*regexp.Regexp, len(item.Headers)),
+		}
+		name := item.Name
+		if stringutils.IsEmpty(name) {
+			name = fmt.Sprintf("#%d", i)
+		}
+		if len(item.Aggregate) == 0 && stringutils.IsEmpty(item.Service) && stringutils.IsEmpty(item.Upstream) {
+			return nil, errors.Errorf("route %s: one of service, upstream and aggregate is required", name)
+		}
+		if stringutils.IsNotEmpty(item.Upstream) {
+			if _, err := url.Parse(item.Upstream); err != nil {
+				return nil, errors.Wrapf(err, "route %s: invalid upstream", name)
+			}
+		}
+		for k, v := range item.Headers {
+			re, err := regexp.Compile(v)
+			if err != nil {
+				return nil, errors.Wrapf(err, "route %s: invalid header pattern", name)
+			}
+			r.headers[k] = re
+		}
+		if stringutils.IsNotEmpty(item.RewriteRegex) {
+			re, err := regexp.Compile(item.RewriteRegex)
+			if err != nil {
+				return nil, errors.Wrapf(err, "route %s: invalid rewrite regex", name)
+			}
+			r.rewrite = re
+		}
+		if stringutils.IsNotEmpty(item.Timeout) {
+			timeout, err := time.ParseDuration(item.Timeout)
+			if err != nil {
+				return nil, errors.Wrapf(err, "route %s: invalid timeout", name)
+			}
+			r.timeout = timeout
+		}
+		for _, authName := range item.Auth {
+			plugin, ok := g.auth[authName]
+			if !ok {
+				return nil, errors.Errorf("route %s: auth plugin %s not found", name, authName)
+			}
+			r.auth = append(r.auth, plugin)
+		}
+		if stringutils.IsNotEmpty(item.RateLimit) {
+			limit, err := ratelimit.Parse(item.RateLimit)
+			if err != nil {
+				return nil, errors.Wrapf(err, "route %s: invalid rate limit", name)
+			}
+			r.limits = memrate.NewMemoryStore(func(_ context.Context, store *memrate.MemoryStore, key string) ratelimit.Limiter {
+				return memrate.NewLimiterLimit(limit)
+			}, memrate.WithMaxKeys(gatewayRateLimitKeys))
+		}
+		for _, a := range item.Aggregate {
+			if stringutils.IsEmpty(a.Name) || (stringutils.IsEmpty(a.Service) && stringutils.IsEmpty(a.Upstream)) {
+				return nil, errors.Errorf("route %s: name and one of service and upstream of aggregate are required", name)
+			}
+		}
+		r.proxy = g.newProxy(r)
+		routes = append(routes, r)
+	}
+	return routes, nil
+}
+
+// loadRoutes returns routes from GDD_GATEWAY_ROUTES, previous routes are kept if it is invalid
+func (g *Gateway) loadRoutes() []*gatewayRoute {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if g.static {
+		return g.routes
+	}
+	raw := config.GddGatewayRoutes.LoadOrDefault(config.DefaultGddGatewayRoutes)
+	if raw == g.raw && g.routes != nil {
+		return g.routes
+	}
+	var declared []GatewayRoute
+	if stringutils.IsNotEmpty(raw) {
+		if err := json.Unmarshal([]byte(raw), &declared); err != nil {
+			logger.Error().Err(err).Msgf("[go-doudou] failed to parse %s, keep using previous routes", string(config.GddGatewayRoutes))
+			g.raw = raw
+			return g.routes
+		}
+	}
+	routes, err := g.compile(declared)
+	g.raw = raw
+	if err != nil {
+		logger.Error().Err(err).Msgf("[go-doudou] invalid %s, keep using previous routes", string(config.GddGatewayRoutes))
+		return g.routes
+	}
+	g.routes = routes
+	g.declared = declared
+	g.closeUnusedProviders()
+	return routes
+}
+
+// closeUnusedProviders releases providers of services no longer in routes
+func (g *Gateway) closeUnusedProviders() {
+	used := make(map[string]struct{})
+	for _, r := range g.routes {
+		used[r.Service] = struct{}{}
+		for _, a := range r.Aggregate {
+			used[a.Service] = struct{}{}
+		}
+	}
+	for service, provider := range g.providers {
+		if _, ok := used[service]; !ok {
+			provider.Close()
+			delete(g.providers, service)
+		}
+	}
+}
+
+func (g *Gateway) provider(service string) (registry.IServiceProvider, error) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	if g.closed {
+		return nil, errors.New("gateway closed")
+	}
+	provider, ok := g.providers[service]
+	if !ok {
+		provider = g.discover(service)
+		g.providers[service] = provider
+	}
+	return provider, nil
+}
+
+// pick returns base url of backend, and done reporting result of request to the service provider
+func (g *Gateway) pick(service, upstream string) (*url.URL, func(error), error) {
+	noop := func(error) {}
+	if stringutils.IsEmpty(service) {
+		target, err := url.Parse(upstream)
+		return target, noop, err
+	}
+	provider, err := g.provider(service)
+	if err != nil {
+		return nil, noop, err
+	}
+	server := provider.SelectServer()
+	if stringutils.IsEmpty(server) {
+		return nil, noop, errors.Wrapf(errNoGatewayInstance, "service %s", service)
+	}
+	target, err := url.Parse(server)
+	if err != nil {
+		return nil, noop, err
+	}
+	if tracker, ok := provider.(balancer.Tracker); ok {
+		return target, tracker.Start(target.Host), nil
+	}
+	return target, noop, nil
+}
+
+func retryableStatus(code int) bool {
+	return code == http.StatusBadGateway || code == http.StatusServiceUnavailable || code == http.StatusGatewayTimeout
+}
+
+func idempotentMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// gatewayTransport sends request to backend picked for each attempt
+type gatewayTransport struct {
+	gateway            *Gateway
+	service            string
+	upstream           string
+	retries            int
+	retryNonIdempotent bool
+}
+
+func (t *gatewayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	retries := t.retries
+	if !t.retryNonIdempotent && !idempotentMethod(req.Method) {
+		retries = 0
+	}
+	var (
+		body    []byte
+		reqBody io.ReadCloser
+	)
+	if retries > 0 && req.Body != nil && req.Body != http.NoBody {
+		if req.ContentLength > gatewayMaxRetryBody {
+			retries = 0
+		} else {
+			// body is buffered for sending it again on retry
+			buf, err := ioutil.ReadAll(io.LimitReader(req.Body, gatewayMaxRetryBody+1))
+			if err != nil {
+				return nil, err
+			}
+			if len(buf) > gatewayMaxRetryBody {
+				// too large to buffer, send it once
+				retries = 0
+				reqBody = readCloser{io.MultiReader(bytes.NewReader(buf), req.Body), req.Body}
+			} else {
+				body = buf
+				req.Body.Close()
+			}
+		}
+	}
+	for attempt := 0; ; attempt++ {
+		target, done, err := t.gateway.pick(t.service, t.upstream)
+		if err != nil {
+			return nil, err
+		}
+		out := req.Clone(req.Context())
+		out.URL.Scheme = target.Scheme
+		out.URL.Host = target.Host
+		out.URL.Path = singleJoiningSlash(target.Path, req.URL.Path)
+		out.URL.RawPath = ""
+		out.Host = target.Host
+		if body != nil {
+			out.Body = ioutil.NopCloser(bytes.NewReader(body))
+			out.ContentLength = int64(len(body))
+		} else if reqBody != nil {
+			out.Body = reqBody
+		}
+		if budget, ok := deadline.Budget(out.Context(), 0); ok {
+			out.Header.Set(deadline.Header, deadline.Format(budget))
+		}
+		resp, err := t.gateway.transport.RoundTrip(out)
+		if err == nil && !retryableStatus(resp.StatusCode) {
+			done(nil)
+			return resp, nil
+		}
+		if err == nil {
+			done(errors.Errorf("server error %d", resp.StatusCode))
+		} else {
+			done(err)
+		}
+		if attempt >= retries || req.Context().Err() != nil {
+			return resp, err
+		}
+		if resp != nil {
+			_, _ = io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+		}
+	}
+}
+
+func (g *Gateway) newProxy(r *gatewayRoute) http.Handler {
+	proxy := &httputil.ReverseProxy{
+		Director: func(req *http.Request) {
+			if _, ok := req.Header["User-Agent"]; !ok {
+				// explicitly disable User-Agent so it's not set to default value
+				req.Header.Set("User-Agent", "")
+			}
+		},
+		Transport: &gatewayTransport{
+			gateway:            g,
+			service:            r.Service,
+			upstream:           r.Upstream,
+			retries:            r.Retries,
+			retryNonIdempotent: r.RetryNonIdempotent,
+		},
+		// flush at once, so that streaming responses such as server-sent events pass through
+		FlushInterval: -1,
+		ModifyResponse: func(resp *http.Response) error {
+			r.ResponseHeaders.apply(resp.Header)
+			return nil
+		},
+		ErrorHandler: func(w http.ResponseWriter, req *http.Request, err error) {
+			status := http.StatusBadGateway
+			switch {
+			case errors.Is(err, context.DeadlineExceeded):
+				status = http.StatusGatewayTimeout
+			case errors.Is(err, errNoGatewayInstance):
+				status = http.StatusServiceUnavailable
+			}
+			http.Error(w, fmt.Sprintf("remote %s%s unreachable, could not forward: %v", r.Service, r.Upstream, err), status)
+		},
+	}
+	return proxy
+}
+
+func (g *Gateway) match(req *http.Request) *gatewayRoute {
+	for _, r := range g.loadRoutes() {
+		if r.match(req) {
+			return r
+		}
+	}
+	return nil
+}
+
+func (g *Gateway) serve(r *gatewayRoute, w http.ResponseWriter, req *http.Request) {
+	for _, plugin := range r.auth {
+		if err := plugin.Authenticate(req); err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+	}
+	if r.limits != nil && !r.limits.GetLimiter(r.rateLimitKey(req)).Allow() {
+		http.Error(w, "too many requests", http.StatusTooManyRequests)
+		return
+	}
+	if r.timeout > 0 {
+		ctx, cancel := context.WithTimeout(req.Context(), r.timeout)
+		defer cancel()
+		req = req.WithContext(ctx)
+	}
+	req.URL.Path = r.rewritePath(req.URL.Path)
+	req.URL.RawPath = ""
+	r.RequestHeaders.apply(req.Header)
+	if len(r.Aggregate) > 0 {
+		g.aggregate(r, w, req)
+		return
+	}
+	r.proxy.ServeHTTP(w, req)
+}
+
+// ServeHTTP forwards request by the first matched route, or responds 404 if no route matches
+func (g *Gateway) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r := g.match(req)
+	if r == nil {
+		http.NotFound(w, req)
+		return
+	}
+	g.serve(r, w, req)
+}
+
+// Middleware forwards request by the first matched route, requests matching no route are passed to inner,
+// so that gateway can be added to RestServer by AddMiddleware
+func (g *Gateway) Middleware(inner http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		r := g.match(req)
+		if r == nil {
+			inner.ServeHTTP(w, req)
+			return
+		}
+		g.serve(r, w, req)
+	})
+}
+
+// Close releases service providers of all services
+func (g *Gateway) Close() {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.closed = true
+	for service, provider := range g.providers {
+		provider.Close()
+		delete(g.providers, service)
+	}
+}
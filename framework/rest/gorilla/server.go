@@ -13,16 +13,17 @@ import (
 	"github.com/unionj-cloud/go-doudou/v2/framework"
 	"github.com/unionj-cloud/go-doudou/v2/framework/internal/banner"
 	"github.com/unionj-cloud/go-doudou/v2/framework/internal/config"
+	"github.com/unionj-cloud/go-doudou/v2/framework/lifecycle"
 	register "github.com/unionj-cloud/go-doudou/v2/framework/registry"
 	"github.com/unionj-cloud/go-doudou/v2/framework/registry/constants"
+	"github.com/unionj-cloud/go-doudou/v2/framework/registry/mesh"
+	"github.com/unionj-cloud/go-doudou/v2/framework/registry/outlier"
 	"github.com/unionj-cloud/go-doudou/v2/framework/rest"
 	"github.com/unionj-cloud/go-doudou/v2/toolkit/cast"
 	"github.com/unionj-cloud/go-doudou/v2/toolkit/stringutils"
 	logger "github.com/unionj-cloud/go-doudou/v2/toolkit/zlogger"
 	"net/http"
 	"net/http/pprof"
-	"os"
-	"os/signal"
 	"path"
 	"strconv"
 	"strings"
@@ -107,7 +108,11 @@ func NewRestServer(data ...map[string]interface{}) *RestServer {
 	srv.Middlewares = append(srv.Middlewares,
 		rest.Tracing,
 		rest.Metrics,
+		rest.Deadline,
 	)
+	if mesh.InMesh() {
+		srv.Middlewares = append(srv.Middlewares, rest.MeshHeaders)
+	}
 	if cast.ToBoolOrDefault(config.GddEnableResponseGzip.Load(), config.DefaultGddEnableResponseGzip) {
 		gzipMiddleware, err := gzhttp.NewWrapper(gzhttp.ContentTypes(contentTypeShouldbeGzip))
 		if err != nil {
@@ -240,6 +245,9 @@ func (srv *RestServer) newHttpServer() *http.Server {
 // Run runs http server
 func (srv *RestServer) Run() {
 	banner.Print()
+	if err := lifecycle.Start(context.Background()); err != nil {
+		logger.Panic().Err(err).Msg("[go-doudou] failed to start")
+	}
 	register.NewRest(srv.data)
 	manage := cast.ToBoolOrDefault(config.GddManage.Load(), config.DefaultGddManage)
 	if manage {
@@ -275,6 +283,10 @@ func (srv *RestServer) Run() {
 		srv.gddRoutes = append(srv.gddRoutes, rest.ConfigRoutes()...)
 		if _, ok := config.ServiceDiscoveryMap()[constants.SD_MEMBERLIST]; ok {
 			srv.gddRoutes = append(srv.gddRoutes, rest.MemberlistUIRoutes()...)
+			srv.gddRoutes = append(srv.gddRoutes, rest.MemberlistKeyRoutes()...)
+		}
+		if outlier.Enabled() {
+			srv.gddRoutes = append(srv.gddRoutes, rest.OutlierRoutes()...)
 		}
 		for _, item := range srv.gddRoutes {
 			gddRouter.
@@ -368,28 +380,12 @@ func (srv *RestServer) Run() {
 	}
 	srv.printRoutes()
 	httpServer := srv.newHttpServer()
-	defer func() {
-		register.ShutdownRest()
-		grace, err := time.ParseDuration(config.GddGraceTimeout.Load())
-		if err != nil {
-			logger.Debug().Msgf("Parse %s %s as time.Duration failed: %s, use default %s instead.\n", string(config.GddGraceTimeout),
-				config.GddGraceTimeout.Load(), err.Error(), config.DefaultGddGraceTimeout)
-			grace, _ = time.ParseDuration(config.DefaultGddGraceTimeout)
-		}
-		logger.Info().Msgf("Http server is gracefully shutting down in %s", grace)
-
-		ctx, cancel := context.WithTimeout(context.Background(), grace)
-		defer cancel()
+	sig := lifecycle.WaitForSignal()
+	logger.Info().Msgf("[go-doudou] received %s, shutting down", sig)
+	lifecycle.Shutdown(register.ShutdownRest, lifecycle.Hook{
+		Name: "http server",
 		// Doesn't block if no connections, but will otherwise wait
 		// until the timeout deadline.
-		httpServer.Shutdown(ctx)
-	}()
-
-	c := make(chan os.Signal, 1)
-	// We'll accept graceful shutdowns when quit via SIGINT (Ctrl+C)
-	// SIGKILL, SIGQUIT or SIGTERM (Ctrl+/) will not be caught.
-	signal.Notify(c, os.Interrupt)
-
-	// Block until we receive our signal.
-	<-c
+		OnStop: httpServer.Shutdown,
+	})
 }
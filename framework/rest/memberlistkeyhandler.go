@@ -0,0 +1,96 @@
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/pkg/errors"
+	registry "github.com/unionj-cloud/go-doudou/v2/framework/registry/memberlist"
+)
+
+type keyRequest struct {
+	Key string `json:"key"`
+}
+
+// keyListResponse identifies keys by fingerprints, raw keys would let anyone reaching the admin port
+// join the cluster or decrypt gossip
+type keyListResponse struct {
+	Count        int      `json:"count"`
+	Fingerprints []string `json:"fingerprints"`
+	Primary      string   `json:"primary"`
+}
+
+func writeKeyJson(writer http.ResponseWriter, status int, data interface{}) {
+	writer.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	writer.WriteHeader(status)
+	_ = json.NewEncoder(writer).Encode(data)
+}
+
+func keyHandler(op func(key string) (registry.KeyResponse, error)) http.HandlerFunc {
+	return func(writer http.ResponseWriter, request *http.Request) {
+		var req keyRequest
+		if err := json.NewDecoder(request.Body).Decode(&req); err != nil {
+			http.Error(writer, err.Error(), http.StatusBadRequest)
+			return
+		}
+		resp, err := op(req.Key)
+		if err != nil {
+			status := http.StatusBadRequest
+			if errors.Is(err, registry.ErrEncryptionDisabled) {
+				status = http.StatusConflict
+			}
+			http.Error(writer, err.Error(), status)
+			return
+		}
+		status := http.StatusOK
+		if resp.NumErr > 0 {
+			// some nodes failed, so caller should retry before going on to the next step of key rotation
+			status = http.StatusInternalServerError
+		}
+		writeKeyJson(writer, status, resp)
+	}
+}
+
+// MemberlistKeyRoutes returns routes for rotating gossip encryption keys of all nodes in memberlist cluster.
+// Installed keys are listed by fingerprints, the first 8 hex characters of sha256 of each key.
+// Rotate key by installing new key, then using it as primary key, then removing old key, all with request
+// body like {"key": "base64 encoded key"}
+func MemberlistKeyRoutes() []Route {
+	return []Route{
+		{
+			Name:    "GetRegistryKeys",
+			Method:  http.MethodGet,
+			Pattern: "/go-doudou/registry/keys",
+			HandlerFunc: func(writer http.ResponseWriter, request *http.Request) {
+				fingerprints, primary, err := registry.ListKeyFingerprints()
+				if err != nil {
+					http.Error(writer, err.Error(), http.StatusConflict)
+					return
+				}
+				writeKeyJson(writer, http.StatusOK, keyListResponse{
+					Count:        len(fingerprints),
+					Fingerprints: fingerprints,
+					Primary:      primary,
+				})
+			},
+		},
+		{
+			Name:        "PostRegistryKeys",
+			Method:      http.MethodPost,
+			Pattern:     "/go-doudou/registry/keys",
+			HandlerFunc: keyHandler(registry.InstallKey),
+		},
+		{
+			Name:        "PutRegistryKeys",
+			Method:      http.MethodPut,
+			Pattern:     "/go-doudou/registry/keys",
+			HandlerFunc: keyHandler(registry.UseKey),
+		},
+		{
+			Name:        "DeleteRegistryKeys",
+			Method:      http.MethodDelete,
+			Pattern:     "/go-doudou/registry/keys",
+			HandlerFunc: keyHandler(registry.RemoveKey),
+		},
+	}
+}
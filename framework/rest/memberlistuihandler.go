@@ -100,5 +100,14 @@ func MemberlistUIRoutes() []Route {
 				writer.Write(buf.Bytes())
 			},
 		},
+		{
+			Name:    "GetRegistryMembership",
+			Method:  "GET",
+			Pattern: "/go-doudou/registry/membership",
+			HandlerFunc: func(writer http.ResponseWriter, request *http.Request) {
+				writer.Header().Set("Content-Type", "application/json; charset=UTF-8")
+				json.NewEncoder(writer).Encode(registry.Membership())
+			},
+		},
 	}
 }
@@ -17,7 +17,12 @@ import (
 	"github.com/uber/jaeger-client-go"
 	"github.com/unionj-cloud/go-doudou/v2/framework/configmgr"
 	"github.com/unionj-cloud/go-doudou/v2/framework/internal/config"
+	"github.com/unionj-cloud/go-doudou/v2/framework/registry/mesh"
+	"github.com/unionj-cloud/go-doudou/v2/framework/tlsx"
+	"github.com/unionj-cloud/go-doudou/v2/toolkit/deadline"
+	paginate "github.com/unionj-cloud/go-doudou/v2/toolkit/pagination/gorm"
 	"github.com/unionj-cloud/go-doudou/v2/toolkit/stringutils"
+	"github.com/unionj-cloud/go-doudou/v2/toolkit/tenant"
 	logger "github.com/unionj-cloud/go-doudou/v2/toolkit/zlogger"
 	"io"
 	"net/http"
@@ -36,6 +41,8 @@ var (
 	FallbackContentType = fallbackContentType
 	BasicAuth           = basicAuth
 	Recovery            = recovery
+	Deadline            = propagatedDeadline
+	MeshHeaders         = meshHeaders
 )
 
 type httpConfigListener struct {
@@ -55,7 +62,7 @@ func (c *httpConfigListener) OnChange(event *storage.ChangeEvent) {
 	}
 	for key, value := range event.Changes {
 		upperKey := strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
-		if strings.HasPrefix(upperKey, "GDD_MANAGE_") {
+		if strings.HasPrefix(upperKey, "GDD_MANAGE_") || upperKey == string(config.GddGatewayRoutes) {
 			_ = os.Setenv(upperKey, fmt.Sprint(value.NewValue))
 		}
 	}
@@ -235,16 +242,24 @@ func recovery(inner http.Handler) http.Handler {
 				statusCode := http.StatusInternalServerError
 				errCode := 1 // 1 indicates there is an error
 				message := fmt.Sprintf("%v", e)
+				var details interface{}
 				if err, ok := e.(error); ok {
 					switch {
 					case errors.Is(err, context.Canceled):
 						statusCode = http.StatusBadRequest
 					default:
 						var bizError BizError
+						var filterError *paginate.FilterError
 						if errors.As(err, &bizError) {
 							statusCode = bizError.StatusCode
 							errCode = bizError.ErrCode
 							message = bizError.Error()
+							details = bizError.Details
+						} else if errors.As(err, &filterError) {
+							// paginate.Response panics with FilterError for parameters violating FilterSchema
+							statusCode = http.StatusBadRequest
+							message = filterError.Error()
+							details = filterError.Violations
 						}
 					}
 				}
@@ -254,11 +269,13 @@ func recovery(inner http.Handler) http.Handler {
 				}
 				logger.Error().Msgf("panic: %+v\n\nstacktrace from panic: %s\n", e, string(debug.Stack()))
 				if _err := json.NewEncoder(w).Encode(struct {
-					Code    int    `json:"code"`
-					Message string `json:"message"`
+					Code    int         `json:"code"`
+					Message string      `json:"message"`
+					Details interface{} `json:"details,omitempty"`
 				}{
 					Code:    errCode,
 					Message: message,
+					Details: details,
 				}); _err != nil {
 					http.Error(w, _err.Error(), http.StatusInternalServerError)
 					return
@@ -330,3 +347,70 @@ func BodyMaxBytes(n int64) func(inner http.Handler) http.Handler {
 		})
 	}
 }
+
+// TenantResolver returns a middleware storing tenant id read from request header into request context,
+// tenant.DefaultHeader is used if header is empty. Requests without tenant id or with malformed one are
+// rejected with 400, built-in /go-doudou/ routes are not affected.
+func TenantResolver(header string) func(inner http.Handler) http.Handler {
+	if stringutils.IsEmpty(header) {
+		header = tenant.DefaultHeader
+	}
+	return func(inner http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get(header)
+			if stringutils.IsEmpty(id) {
+				http.Error(w, tenant.ErrMissingTenant.Error(), http.StatusBadRequest)
+				return
+			}
+			ctx, err := tenant.WithTenant(r.Context(), id)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			inner.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// peerIdentity stores identity of client authenticated by mTLS into request context,
+// use tlsx.FromContext to retrieve it
+func peerIdentity(inner http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if id, ok := tlsx.IdentityOf(r.TLS); ok {
+			r = r.WithContext(tlsx.NewContext(r.Context(), id))
+		}
+		inner.ServeHTTP(w, r)
+	})
+}
+
+// propagatedDeadline sets deadline of request context by header deadline.Header sent by rest clients of upstream
+// services, so that work is abandoned once the caller stops waiting. Requests whose caller has already given up
+// are rejected with 504.
+func propagatedDeadline(inner http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		value := r.Header.Get(deadline.Header)
+		if stringutils.IsEmpty(value) {
+			inner.ServeHTTP(w, r)
+			return
+		}
+		ctx, cancel, err := deadline.WithHeader(r.Context(), value)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer cancel()
+		if ctx.Err() != nil {
+			http.Error(w, ctx.Err().Error(), http.StatusGatewayTimeout)
+			return
+		}
+		inner.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// meshHeaders stores mesh.TracingHeaders of request into request context, so that rest clients and grpc client
+// interceptors propagate them to downstream services and sidecars join spans into the same trace
+func meshHeaders(inner http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		inner.ServeHTTP(w, r.WithContext(mesh.NewContext(r.Context(), r.Header)))
+	})
+}
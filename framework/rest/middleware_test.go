@@ -14,18 +14,24 @@ import (
 	"github.com/pkg/errors"
 	"github.com/slok/goresilience"
 	. "github.com/smartystreets/goconvey/convey"
+	"github.com/stretchr/testify/require"
 	"github.com/unionj-cloud/go-doudou/v2/framework/configmgr"
 	"github.com/unionj-cloud/go-doudou/v2/framework/configmgr/mock"
 	"github.com/unionj-cloud/go-doudou/v2/framework/internal/config"
 	"github.com/unionj-cloud/go-doudou/v2/framework/registry"
+	"github.com/unionj-cloud/go-doudou/v2/framework/registry/mesh"
 	"github.com/unionj-cloud/go-doudou/v2/framework/rest"
 	httpMock "github.com/unionj-cloud/go-doudou/v2/framework/rest/mock"
 	"github.com/unionj-cloud/go-doudou/v2/framework/restclient"
+	"github.com/unionj-cloud/go-doudou/v2/toolkit/deadline"
 	"github.com/unionj-cloud/go-doudou/v2/toolkit/maputils"
+	paginate "github.com/unionj-cloud/go-doudou/v2/toolkit/pagination/gorm"
+	"github.com/unionj-cloud/go-doudou/v2/toolkit/tenant"
 	"github.com/wubin1989/nacos-sdk-go/v2/clients/cache"
 	"github.com/wubin1989/nacos-sdk-go/v2/clients/config_client"
 	"github.com/wubin1989/nacos-sdk-go/v2/vo"
 	"net/http"
+	"net/http/httptest"
 	"os"
 	"testing"
 	"time"
@@ -532,6 +538,16 @@ func Test_recovery(t *testing.T) {
 	})
 }
 
+func TestRecoveryFilterError(t *testing.T) {
+	handler := rest.Recovery(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(&paginate.FilterError{Violations: []paginate.FilterViolation{{Param: "sort", Field: "age", Reason: "sorting by age is not allowed"}}})
+	}))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users", nil))
+	require.Equal(t, http.StatusBadRequest, w.Code)
+	require.JSONEq(t, `{"code":1,"message":"invalid pagination parameter: sorting by age is not allowed","details":[{"param":"sort","field":"age","reason":"sorting by age is not allowed"}]}`, w.Body.String())
+}
+
 func Test_bulkhead(t *testing.T) {
 	Convey("Should work with bulkhead", t, func() {
 		config.GddPort.Write("6068")
@@ -582,3 +598,85 @@ func Test_bulkhead_fail(t *testing.T) {
 		So(err.Error(), ShouldEqual, "too many requests")
 	})
 }
+
+func Test_tenantResolver(t *testing.T) {
+	Convey("Should store tenant id into request context", t, func() {
+		var got string
+		handler := rest.TenantResolver("")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got, _ = tenant.FromContext(r.Context())
+		}))
+
+		req := httptest.NewRequest(http.MethodGet, "/users", nil)
+		req.Header.Set(tenant.DefaultHeader, "acme")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		So(rr.Code, ShouldEqual, http.StatusOK)
+		So(got, ShouldEqual, "acme")
+
+		got = ""
+		rr = httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/users", nil))
+		So(rr.Code, ShouldEqual, http.StatusBadRequest)
+		So(got, ShouldBeEmpty)
+
+		req = httptest.NewRequest(http.MethodGet, "/users", nil)
+		req.Header.Set(tenant.DefaultHeader, "acme' or 1=1")
+		rr = httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		So(rr.Code, ShouldEqual, http.StatusBadRequest)
+	})
+}
+
+func Test_deadline(t *testing.T) {
+	Convey("Should set deadline of request context by header", t, func() {
+		var (
+			got time.Time
+			has bool
+		)
+		handler := rest.Deadline(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got, has = r.Context().Deadline()
+		}))
+
+		req := httptest.NewRequest(http.MethodGet, "/users", nil)
+		req.Header.Set(deadline.Header, "1500")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		So(rr.Code, ShouldEqual, http.StatusOK)
+		So(has, ShouldBeTrue)
+		So(got, ShouldHappenWithin, 100*time.Millisecond, time.Now().Add(1500*time.Millisecond))
+
+		has = false
+		rr = httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/users", nil))
+		So(rr.Code, ShouldEqual, http.StatusOK)
+		So(has, ShouldBeFalse)
+
+		req = httptest.NewRequest(http.MethodGet, "/users", nil)
+		req.Header.Set(deadline.Header, "0")
+		rr = httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		So(rr.Code, ShouldEqual, http.StatusGatewayTimeout)
+		So(has, ShouldBeFalse)
+
+		req = httptest.NewRequest(http.MethodGet, "/users", nil)
+		req.Header.Set(deadline.Header, "soon")
+		rr = httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		So(rr.Code, ShouldEqual, http.StatusBadRequest)
+	})
+}
+
+func Test_meshHeaders(t *testing.T) {
+	Convey("Should store tracing headers of sidecars into request context", t, func() {
+		var got http.Header
+		handler := rest.MeshHeaders(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got, _ = mesh.FromContext(r.Context())
+		}))
+		req := httptest.NewRequest(http.MethodGet, "/users", nil)
+		req.Header.Set("X-B3-TraceId", "80f198ee56343ba864fe8b2a57d3eff7")
+		req.Header.Set("Cookie", "session=1")
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+		So(got.Get("x-b3-traceid"), ShouldEqual, "80f198ee56343ba864fe8b2a57d3eff7")
+		So(got.Get("Cookie"), ShouldBeEmpty)
+	})
+}
@@ -0,0 +1,23 @@
+package rest
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/unionj-cloud/go-doudou/v2/framework/registry/outlier"
+)
+
+// OutlierRoutes returns routes showing ejection state of instances of services called by this service
+func OutlierRoutes() []Route {
+	return []Route{
+		{
+			Name:    "GetRegistryOutliers",
+			Method:  http.MethodGet,
+			Pattern: "/go-doudou/registry/outliers",
+			HandlerFunc: func(writer http.ResponseWriter, request *http.Request) {
+				writer.Header().Set("Content-Type", "application/json; charset=UTF-8")
+				_ = json.NewEncoder(writer).Encode(outlier.Default().Statuses())
+			},
+		},
+	}
+}
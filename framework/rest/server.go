@@ -8,23 +8,28 @@ import (
 	"github.com/gorilla/handlers"
 	"github.com/klauspost/compress/gzhttp"
 	"github.com/olekukonko/tablewriter"
+	"github.com/pkg/errors"
 	"github.com/rs/cors"
 	"github.com/unionj-cloud/go-doudou/v2/framework"
 	"github.com/unionj-cloud/go-doudou/v2/framework/internal/banner"
 	"github.com/unionj-cloud/go-doudou/v2/framework/internal/config"
+	"github.com/unionj-cloud/go-doudou/v2/framework/lifecycle"
 	register "github.com/unionj-cloud/go-doudou/v2/framework/registry"
 	"github.com/unionj-cloud/go-doudou/v2/framework/registry/constants"
+	"github.com/unionj-cloud/go-doudou/v2/framework/registry/mesh"
+	"github.com/unionj-cloud/go-doudou/v2/framework/registry/outlier"
 	"github.com/unionj-cloud/go-doudou/v2/framework/rest/httprouter"
+	"github.com/unionj-cloud/go-doudou/v2/framework/tlsx"
 	"github.com/unionj-cloud/go-doudou/v2/toolkit/cast"
 	"github.com/unionj-cloud/go-doudou/v2/toolkit/stringutils"
 	logger "github.com/unionj-cloud/go-doudou/v2/toolkit/zlogger"
+	"net"
 	"net/http"
 	"net/http/pprof"
-	"os"
-	"os/signal"
 	"path"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -94,6 +99,8 @@ type RestServer struct {
 	middlewares  []MiddlewareFunc
 	data         map[string]interface{}
 	panicHandler func(inner http.Handler) http.Handler
+	gateway      *Gateway
+	buildOnce    sync.Once
 }
 
 func (srv *RestServer) printRoutes() {
@@ -152,7 +159,11 @@ func NewRestServer(data ...map[string]interface{}) *RestServer {
 		tracing,
 		metrics,
 		gzipBody,
+		propagatedDeadline,
 	)
+	if mesh.InMesh() {
+		srv.middlewares = append(srv.middlewares, meshHeaders)
+	}
 	if cast.ToBoolOrDefault(config.GddEnableResponseGzip.Load(), config.DefaultGddEnableResponseGzip) {
 		gzipMiddleware, err := gzhttp.NewWrapper(gzhttp.ContentTypes(contentTypeShouldbeGzip))
 		if err != nil {
@@ -211,7 +222,11 @@ func NewRestServerWithOptions(options ...ServerOption) *RestServer {
 		tracing,
 		metrics,
 		gzipBody,
+		propagatedDeadline,
 	)
+	if mesh.InMesh() {
+		srv.middlewares = append(srv.middlewares, meshHeaders)
+	}
 	if cast.ToBoolOrDefault(config.GddEnableResponseGzip.Load(), config.DefaultGddEnableResponseGzip) {
 		gzipMiddleware, err := gzhttp.NewWrapper(gzhttp.ContentTypes(contentTypeShouldbeGzip))
 		if err != nil {
@@ -288,24 +303,43 @@ func (srv *RestServer) newHttpServer() *http.Server {
 		ReadTimeout:  read,
 		IdleTimeout:  idle,
 		Handler:      srv.rootRouter, // Pass our instance of httprouter.Router in.
+		TLSConfig:    tlsx.ServerConfig(),
 	}
 
-	// Run our server in a goroutine so that it doesn't block.
+	return httpServer
+}
+
+// serve listens on address of httpServer and serves it in a goroutine so that it doesn't block
+func serve(httpServer *http.Server) error {
+	lis, err := net.Listen("tcp", httpServer.Addr)
+	if err != nil {
+		return errors.Wrapf(err, "[go-doudou] failed to listen on %s", httpServer.Addr)
+	}
 	go func() {
-		logger.Info().Msgf("Http server is listening at %v", httpServer.Addr)
+		logger.Info().Msgf("Http server is listening at %v", lis.Addr())
 		logger.Info().Msgf("Http server started in %s", time.Since(startAt))
-		if err := httpServer.ListenAndServe(); err != nil {
+		var err error
+		if httpServer.TLSConfig != nil {
+			// certificates are served by TLSConfig.GetCertificate
+			err = httpServer.ServeTLS(lis, "", "")
+		} else {
+			err = httpServer.Serve(lis)
+		}
+		if err != nil && err != http.ErrServerClosed {
 			logger.Error().Err(err).Msg("")
 		}
 	}()
+	return nil
+}
 
-	return httpServer
+// Handler registers all routes with middlewares applied and returns the root router, so that the routes can be
+// served by a listener not owned by RestServer. Routes and middlewares added after the first call are ignored.
+func (srv *RestServer) Handler() http.Handler {
+	srv.buildOnce.Do(srv.build)
+	return srv.rootRouter
 }
 
-// Run runs http server
-func (srv *RestServer) Run() {
-	banner.Print()
-	register.NewRest(srv.data)
+func (srv *RestServer) build() {
 	manage := cast.ToBoolOrDefault(config.GddManage.Load(), config.DefaultGddManage)
 	if manage {
 		srv.middlewares = append([]MiddlewareFunc{PrometheusMiddleware}, srv.middlewares...)
@@ -339,6 +373,10 @@ func (srv *RestServer) Run() {
 		srv.gddRoutes = append(srv.gddRoutes, configRoutes()...)
 		if _, ok := config.ServiceDiscoveryMap()[constants.SD_MEMBERLIST]; ok {
 			srv.gddRoutes = append(srv.gddRoutes, MemberlistUIRoutes()...)
+			srv.gddRoutes = append(srv.gddRoutes, MemberlistKeyRoutes()...)
+		}
+		if outlier.Enabled() {
+			srv.gddRoutes = append(srv.gddRoutes, OutlierRoutes()...)
 		}
 		freq, err := time.ParseDuration(config.GddStatsFreq.Load())
 		if err != nil {
@@ -433,6 +471,9 @@ func (srv *RestServer) Run() {
 			debugRouter.Handler(item.Method, "/"+strings.TrimPrefix(item.Pattern, debugPathPrefix), h, item.Name)
 		}
 	}
+	if tlsx.ServerEnabled() {
+		srv.middlewares = append(srv.middlewares, peerIdentity)
+	}
 	srv.middlewares = append(srv.middlewares, srv.panicHandler)
 	for _, item := range srv.bizRoutes {
 		h := http.Handler(item.HandlerFunc)
@@ -442,6 +483,11 @@ func (srv *RestServer) Run() {
 		srv.bizRouter.Handler(item.Method, item.Pattern, h, item.Name)
 	}
 	srv.rootRouter.NotFound = http.HandlerFunc(http.NotFound)
+	if cast.ToBoolOrDefault(config.GddGatewayEnable.Load(), config.DefaultGddGatewayEnable) {
+		// requests not matching routes of the server are forwarded by gateway routes
+		srv.gateway = NewGateway()
+		srv.rootRouter.NotFound = srv.gateway.Middleware(srv.rootRouter.NotFound)
+	}
 	srv.rootRouter.MethodNotAllowed = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusMethodNotAllowed)
 		w.Write([]byte("405 method not allowed"))
@@ -450,30 +496,43 @@ func (srv *RestServer) Run() {
 		srv.rootRouter.NotFound = srv.middlewares[i].Middleware(srv.rootRouter.NotFound)
 		srv.rootRouter.MethodNotAllowed = srv.middlewares[i].Middleware(srv.rootRouter.MethodNotAllowed)
 	}
+}
+
+// Start serves http requests in the background without registering the service or waiting for signals, so that
+// it can be run with other servers, e.g. by app.App. It returns the hook draining the server on shutdown.
+func (srv *RestServer) Start() (lifecycle.Hook, error) {
+	srv.Handler()
 	srv.printRoutes()
 	httpServer := srv.newHttpServer()
-	defer func() {
-		register.ShutdownRest()
-		grace, err := time.ParseDuration(config.GddGraceTimeout.Load())
-		if err != nil {
-			logger.Debug().Msgf("Parse %s %s as time.Duration failed: %s, use default %s instead.\n", string(config.GddGraceTimeout),
-				config.GddGraceTimeout.Load(), err.Error(), config.DefaultGddGraceTimeout)
-			grace, _ = time.ParseDuration(config.DefaultGddGraceTimeout)
-		}
-		logger.Info().Msgf("Http server is gracefully shutting down in %s", grace)
-
-		ctx, cancel := context.WithTimeout(context.Background(), grace)
-		defer cancel()
-		// Doesn't block if no connections, but will otherwise wait
-		// until the timeout deadline.
-		httpServer.Shutdown(ctx)
-	}()
-
-	c := make(chan os.Signal, 1)
-	// We'll accept graceful shutdowns when quit via SIGINT (Ctrl+C)
-	// SIGKILL, SIGQUIT or SIGTERM (Ctrl+/) will not be caught.
-	signal.Notify(c, os.Interrupt)
+	if err := serve(httpServer); err != nil {
+		return lifecycle.Hook{}, err
+	}
+	return lifecycle.Hook{
+		Name: "http server",
+		OnStop: func(ctx context.Context) error {
+			// Doesn't block if no connections, but will otherwise wait
+			// until the timeout deadline.
+			err := httpServer.Shutdown(ctx)
+			if srv.gateway != nil {
+				srv.gateway.Close()
+			}
+			return err
+		},
+	}, nil
+}
 
-	// Block until we receive our signal.
-	<-c
+// Run runs http server until SIGINT or SIGTERM is received, then shuts down gracefully
+func (srv *RestServer) Run() {
+	banner.Print()
+	if err := lifecycle.Start(context.Background()); err != nil {
+		logger.Panic().Err(err).Msg("[go-doudou] failed to start")
+	}
+	server, err := srv.Start()
+	if err != nil {
+		logger.Error().Err(err).Msg("")
+	}
+	register.NewRest(srv.data)
+	sig := lifecycle.WaitForSignal()
+	logger.Info().Msgf("[go-doudou] received %s, shutting down", sig)
+	lifecycle.Shutdown(register.ShutdownRest, server)
 }
@@ -1,16 +1,29 @@
 package restclient
 
 import (
+	"context"
 	"github.com/go-resty/resty/v2"
 	"github.com/klauspost/compress/gzhttp"
 	"github.com/opentracing-contrib/go-stdlib/nethttp"
+	"github.com/pkg/errors"
+	"github.com/unionj-cloud/go-doudou/v2/framework/hedging"
 	"github.com/unionj-cloud/go-doudou/v2/framework/internal/config"
 	"github.com/unionj-cloud/go-doudou/v2/framework/registry"
+	"github.com/unionj-cloud/go-doudou/v2/framework/registry/balancer"
+	"github.com/unionj-cloud/go-doudou/v2/framework/registry/mesh"
+	"github.com/unionj-cloud/go-doudou/v2/framework/tlsx"
 	"github.com/unionj-cloud/go-doudou/v2/toolkit/cast"
+	"github.com/unionj-cloud/go-doudou/v2/toolkit/deadline"
+	logger "github.com/unionj-cloud/go-doudou/v2/toolkit/zlogger"
+	"io"
+	"io/ioutil"
 	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"runtime"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -58,17 +71,33 @@ func (s *ServiceProvider) SelectServer() string {
 	return s.server
 }
 
-// NewServiceProvider creates new ServiceProvider instance
+// NewServiceProvider creates new ServiceProvider instance selecting base url from environment variable env. In mesh
+// or dns service discovery mode, base url falls back to dns name of service env in lower case resolved by
+// mesh.BaseUrl if env is not set, e.g. http://usersvc.prod:80 for USERSVC.
 func NewServiceProvider(env string) *ServiceProvider {
+	server := os.Getenv(env)
+	if server == "" && mesh.Enabled() {
+		var err error
+		if server, err = mesh.BaseUrl(strings.ToLower(env)); err != nil {
+			logger.Error().Err(err).Msgf("[go-doudou] failed to resolve %s", env)
+		}
+	}
 	return &ServiceProvider{
-		server: os.Getenv(env),
+		server: server,
 	}
 }
 
-// NewClient creates new resty Client instance
+// NewClient creates new resty Client instance. Its timeout is set by GDD_CLIENT_TIMEOUT, and time left before
+// the shorter of timeout and deadline of request context is sent in header deadline.Header, so that callee
+// stops working on requests the caller no longer waits for. In mesh service discovery mode, requests are not
+// retried as sidecars retry them, and tracing headers stored by mesh.NewContext are propagated.
 func NewClient() *resty.Client {
 	client := resty.New()
-	client.SetTimeout(1 * time.Minute)
+	timeout, err := time.ParseDuration(config.GddClientTimeout.Load())
+	if err != nil {
+		timeout, _ = time.ParseDuration(config.DefaultGddClientTimeout)
+	}
+	client.SetTimeout(timeout)
 	dialer := &net.Dialer{
 		Timeout:   30 * time.Second,
 		KeepAlive: 30 * time.Second,
@@ -85,12 +114,159 @@ func NewClient() *resty.Client {
 			ExpectContinueTimeout: 1 * time.Second,
 			MaxIdleConnsPerHost:   runtime.GOMAXPROCS(0) + 1,
 			MaxConnsPerHost:       10000,
+			TLSClientConfig:       tlsx.ClientConfig(),
 		},
 	}))
 	retryCnt := config.DefaultGddRetryCount
 	if cnt, err := cast.ToIntE(config.GddRetryCount.Load()); err == nil {
 		retryCnt = cnt
 	}
+	if mesh.InMesh() {
+		retryCnt = 0
+	}
 	client.SetRetryCount(retryCnt)
+	client.OnBeforeRequest(propagateDeadline)
+	client.OnBeforeRequest(propagateTracingHeaders)
 	return client
 }
+
+func propagateTracingHeaders(c *resty.Client, r *resty.Request) error {
+	mesh.Inject(r.Context(), r.Header)
+	return nil
+}
+
+// propagateDeadline runs before each attempt including retries, so budget sent is always up to date
+func propagateDeadline(c *resty.Client, r *resty.Request) error {
+	budget, ok := deadline.Budget(r.Context(), c.GetClient().Timeout)
+	if !ok {
+		return nil
+	}
+	if budget <= 0 {
+		return context.DeadlineExceeded
+	}
+	r.SetHeader(deadline.Header, deadline.Format(budget))
+	return nil
+}
+
+type trackingTransport struct {
+	next    http.RoundTripper
+	tracker balancer.Tracker
+}
+
+func (t *trackingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	done := t.tracker.Start(req.URL.Host)
+	resp, err := t.next.RoundTrip(req)
+	if err == nil && resp.StatusCode >= http.StatusInternalServerError {
+		done(errors.New("server error " + strconv.Itoa(resp.StatusCode)))
+		return resp, err
+	}
+	done(err)
+	return resp, err
+}
+
+// TrackLoad reports in-flight requests and latency of requests sent by client to instances picked by provider,
+// which adaptive balancers such as balancer.NewP2C and balancer.NewEWMA of registry.Discover rely on.
+// Nothing is done if provider does not track load.
+func TrackLoad(client *resty.Client, provider registry.IServiceProvider) {
+	tracker, ok := provider.(balancer.Tracker)
+	if !ok {
+		return
+	}
+	next := client.GetClient().Transport
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	client.SetTransport(&trackingTransport{
+		next:    next,
+		tracker: tracker,
+	})
+}
+
+type hedgingTransport struct {
+	next     http.RoundTripper
+	provider registry.IServiceProvider
+	hedger   *hedging.Hedger
+}
+
+func (t *hedgingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	method, ok := hedging.FromContext(req.Context())
+	if !ok || (req.Body != nil && req.Body != http.NoBody && req.GetBody == nil) {
+		return t.next.RoundTrip(req)
+	}
+	value, done, err := t.hedger.Do(req.Context(), method, func(ctx context.Context, attempt int) (interface{}, error) {
+		out := req.Clone(ctx)
+		if attempt > 0 {
+			if req.GetBody != nil {
+				body, err := req.GetBody()
+				if err != nil {
+					return nil, errors.WithStack(err)
+				}
+				out.Body = body
+			}
+			t.redirect(ctx, out)
+		}
+		hedging.MarkTried(ctx, out.URL.Host)
+		resp, err := t.next.RoundTrip(out)
+		if err != nil {
+			return nil, err
+		}
+		return resp, nil
+	}, func(late interface{}) {
+		resp := late.(*http.Response)
+		_, _ = io.Copy(ioutil.Discard, resp.Body)
+		resp.Body.Close()
+	})
+	if err != nil {
+		return nil, err
+	}
+	resp := value.(*http.Response)
+	resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: done}
+	return resp, nil
+}
+
+// maxRedirectTries is how many times provider is asked for an instance the hedged call is not sent to yet
+const maxRedirectTries = 3
+
+// redirect sends hedged request to another instance if provider selects one
+func (t *hedgingTransport) redirect(ctx context.Context, req *http.Request) {
+	for i := 0; i < maxRedirectTries; i++ {
+		target, err := url.Parse(t.provider.SelectServer())
+		if err != nil || target.Host == "" {
+			return
+		}
+		if !hedging.Tried(ctx, target.Host) {
+			req.URL.Scheme = target.Scheme
+			req.URL.Host = target.Host
+			req.Host = ""
+			return
+		}
+	}
+}
+
+// cancelOnClose releases context of the winning request of a hedged call once its response body is closed
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
+
+// HedgeRequests makes client send a second request to another instance picked by provider if a request takes
+// longer than the quantile of latencies of its method configured by GDD_HEDGING_*, whichever responds first wins
+// and the other one is cancelled. Only requests with context from hedging.NewContext are hedged, which generated
+// clients do for methods annotated by @hedge(), as hedging is safe for idempotent methods only.
+func HedgeRequests(client *resty.Client, provider registry.IServiceProvider) {
+	next := client.GetClient().Transport
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	client.SetTransport(&hedgingTransport{
+		next:     next,
+		provider: provider,
+		hedger:   hedging.Default(),
+	})
+}
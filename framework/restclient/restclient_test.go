@@ -1,14 +1,24 @@
 package restclient_test
 
 import (
+	"context"
+	"errors"
 	"github.com/go-resty/resty/v2"
 	. "github.com/smartystreets/goconvey/convey"
+	"github.com/unionj-cloud/go-doudou/v2/framework/hedging"
 	"github.com/unionj-cloud/go-doudou/v2/framework/internal/config"
 	"github.com/unionj-cloud/go-doudou/v2/framework/registry"
+	"github.com/unionj-cloud/go-doudou/v2/framework/registry/mesh"
 	"github.com/unionj-cloud/go-doudou/v2/framework/restclient"
+	"github.com/unionj-cloud/go-doudou/v2/toolkit/deadline"
 	"github.com/wubin1989/nacos-sdk-go/v2/common/constant"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"sync"
 	"testing"
+	"time"
 )
 
 var clientConfigTest = *constant.NewClientConfig(
@@ -86,3 +96,150 @@ func setup() {
 	_ = config.GddPort.Write("8088")
 	_ = config.GddRouteRootPath.Write("/v1")
 }
+
+type mockTracker struct {
+	registry.IServiceProvider
+	started []string
+	errs    []error
+}
+
+func (m *mockTracker) Start(addr string) func(err error) {
+	m.started = append(m.started, addr)
+	return func(err error) {
+		m.errs = append(m.errs, err)
+	}
+}
+
+func TestTrackLoad(t *testing.T) {
+	Convey("Should report each request to tracker", t, func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/fail" {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+		}))
+		defer server.Close()
+		tracker := &mockTracker{}
+		client := restclient.NewClient()
+		client.SetRetryCount(0)
+		restclient.TrackLoad(client, tracker)
+		_, err := client.R().Get(server.URL + "/ok")
+		So(err, ShouldBeNil)
+		_, err = client.R().Get(server.URL + "/fail")
+		So(err, ShouldBeNil)
+		So(tracker.started, ShouldResemble, []string{server.Listener.Addr().String(), server.Listener.Addr().String()})
+		So(tracker.errs[0], ShouldBeNil)
+		So(tracker.errs[1], ShouldNotBeNil)
+	})
+}
+
+func TestPropagateDeadline(t *testing.T) {
+	Convey("Should send time left before deadline to callee", t, func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(r.Header.Get(deadline.Header)))
+		}))
+		defer server.Close()
+		client := restclient.NewClient()
+
+		resp, err := client.R().Get(server.URL)
+		So(err, ShouldBeNil)
+		So(resp.String(), ShouldEqual, "60000")
+
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		resp, err = client.R().SetContext(ctx).Get(server.URL)
+		So(err, ShouldBeNil)
+		budget, err := deadline.Parse(resp.String())
+		So(err, ShouldBeNil)
+		So(budget, ShouldBeLessThanOrEqualTo, 2*time.Second)
+		So(budget, ShouldBeGreaterThan, time.Second)
+
+		expired, cancelExpired := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+		defer cancelExpired()
+		_, err = client.R().SetContext(expired).Get(server.URL)
+		So(errors.Is(err, context.DeadlineExceeded), ShouldBeTrue)
+	})
+}
+
+func TestMeshMode(t *testing.T) {
+	Convey("Should call services by dns names without retries and propagate tracing headers in mesh mode", t, func() {
+		t.Setenv("GDD_SERVICE_DISCOVERY_MODE", "mesh")
+		t.Setenv("GDD_MESH_NAMESPACE", "prod")
+		t.Setenv("GDD_RETRY_COUNT", "10")
+		So(restclient.NewServiceProvider("USERSVC").SelectServer(), ShouldEqual, "http://usersvc.prod:80")
+		t.Setenv("USERSVC", "http://localhost:6060")
+		So(restclient.NewServiceProvider("USERSVC").SelectServer(), ShouldEqual, "http://localhost:6060")
+
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(r.Header.Get("x-request-id")))
+		}))
+		defer server.Close()
+		client := restclient.NewClient()
+		So(client.RetryCount, ShouldEqual, 0)
+		header := http.Header{}
+		header.Set("x-request-id", "abc")
+		resp, err := client.R().SetContext(mesh.NewContext(context.Background(), header)).Get(server.URL)
+		So(err, ShouldBeNil)
+		So(resp.String(), ShouldEqual, "abc")
+	})
+}
+
+type mockProvider struct {
+	lock    sync.Mutex
+	servers []string
+	next    int
+}
+
+func (m *mockProvider) SelectServer() string {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	server := m.servers[m.next%len(m.servers)]
+	m.next++
+	return server
+}
+
+func (m *mockProvider) Close() {
+}
+
+func TestHedgeRequests(t *testing.T) {
+	Convey("Should send hedged request to another instance and cancel the slow one", t, func() {
+		cancelled := make(chan struct{})
+		slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// server notices cancelled request only after request body is read
+			_, _ = ioutil.ReadAll(r.Body)
+			select {
+			case <-r.Context().Done():
+				close(cancelled)
+			case <-time.After(5 * time.Second):
+			}
+		}))
+		defer slow.Close()
+		fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			body, _ := ioutil.ReadAll(r.Body)
+			_, _ = w.Write(append([]byte("fast "), body...))
+		}))
+		defer fast.Close()
+		provider := &mockProvider{servers: []string{slow.URL, slow.URL, fast.URL}}
+		client := restclient.NewClient()
+		client.SetRetryCount(0)
+		restclient.HedgeRequests(client, provider)
+
+		start := time.Now()
+		resp, err := client.R().
+			SetContext(hedging.NewContext(context.Background(), "MockSvc.Search")).
+			SetBody("jack").
+			Post(slow.URL)
+		So(err, ShouldBeNil)
+		So(resp.String(), ShouldEqual, "fast jack")
+		So(time.Since(start), ShouldBeLessThan, 2*time.Second)
+		select {
+		case <-cancelled:
+		case <-time.After(2 * time.Second):
+			So("slow request is not cancelled", ShouldBeEmpty)
+		}
+
+		// requests without hedging context are sent once
+		resp, err = client.R().Get(fast.URL)
+		So(err, ShouldBeNil)
+		So(resp.String(), ShouldEqual, "fast")
+	})
+}
@@ -0,0 +1,222 @@
+package tlsx
+
+import (
+	"crypto/tls"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/unionj-cloud/go-doudou/v2/framework/internal/config"
+	"github.com/unionj-cloud/go-doudou/v2/toolkit/cast"
+	"github.com/unionj-cloud/go-doudou/v2/toolkit/stringutils"
+	logger "github.com/unionj-cloud/go-doudou/v2/toolkit/zlogger"
+)
+
+// ClientAuth is mTLS mode of server
+type ClientAuth string
+
+const (
+	NoClientCert               ClientAuth = "none"
+	RequestClientCert          ClientAuth = "request"
+	RequireAnyClientCert       ClientAuth = "require"
+	VerifyClientCertIfGiven    ClientAuth = "verify_if_given"
+	RequireAndVerifyClientCert ClientAuth = "require_and_verify"
+)
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// Settings describes where certificates come from and how they are verified
+type Settings struct {
+	CertFile string
+	KeyFile  string
+	// CAFile verifies client certificates on server side and server certificates on client side
+	CAFile             string
+	ClientAuth         ClientAuth
+	MinVersion         string
+	ReloadInterval     time.Duration
+	ServerName         string
+	InsecureSkipVerify bool
+}
+
+func minVersion(version string) (uint16, error) {
+	if stringutils.IsEmpty(version) {
+		version = config.DefaultGddTlsMinVersion
+	}
+	v, ok := tlsVersions[strings.TrimPrefix(strings.ToLower(version), "tls")]
+	if !ok {
+		return 0, errors.Errorf("unknown tls version %s", version)
+	}
+	return v, nil
+}
+
+func reloadInterval() time.Duration {
+	interval, err := time.ParseDuration(config.GddTlsReloadInterval.Load())
+	if err != nil {
+		logger.Debug().Msgf("Parse %s %s as time.Duration failed: %s, use default %s instead.\n", string(config.GddTlsReloadInterval),
+			config.GddTlsReloadInterval.Load(), err.Error(), config.DefaultGddTlsReloadInterval)
+		interval, _ = time.ParseDuration(config.DefaultGddTlsReloadInterval)
+	}
+	return interval
+}
+
+// ServerSettings loads server side settings from GDD_TLS_* environment variables
+func ServerSettings() Settings {
+	return Settings{
+		CertFile:       config.GddTlsCert.LoadOrDefault(config.DefaultGddTlsCert),
+		KeyFile:        config.GddTlsKey.LoadOrDefault(config.DefaultGddTlsKey),
+		CAFile:         config.GddTlsClientCA.LoadOrDefault(config.DefaultGddTlsClientCA),
+		ClientAuth:     ClientAuth(config.GddTlsClientAuth.LoadOrDefault(config.DefaultGddTlsClientAuth)),
+		MinVersion:     config.GddTlsMinVersion.LoadOrDefault(config.DefaultGddTlsMinVersion),
+		ReloadInterval: reloadInterval(),
+	}
+}
+
+// ClientSettings loads client side settings from GDD_TLS_* environment variables
+func ClientSettings() Settings {
+	return Settings{
+		CertFile:           config.GddTlsClientCert.LoadOrDefault(config.DefaultGddTlsClientCert),
+		KeyFile:            config.GddTlsClientKey.LoadOrDefault(config.DefaultGddTlsClientKey),
+		CAFile:             config.GddTlsRootCA.LoadOrDefault(config.DefaultGddTlsRootCA),
+		MinVersion:         config.GddTlsMinVersion.LoadOrDefault(config.DefaultGddTlsMinVersion),
+		ReloadInterval:     reloadInterval(),
+		ServerName:         config.GddTlsServerName.LoadOrDefault(config.DefaultGddTlsServerName),
+		InsecureSkipVerify: cast.ToBoolOrDefault(config.GddTlsInsecureSkipVerify.Load(), config.DefaultGddTlsInsecureSkipVerify),
+	}
+}
+
+// ServerEnabled returns true if server certificate is configured
+func ServerEnabled() bool {
+	return stringutils.IsNotEmpty(config.GddTlsCert.Load())
+}
+
+// ClientEnabled returns true if clients should dial with tls
+func ClientEnabled() bool {
+	return cast.ToBoolOrDefault(config.GddTlsClientEnable.Load(), config.DefaultGddTlsClientEnable) ||
+		stringutils.IsNotEmpty(config.GddTlsRootCA.Load()) || stringutils.IsNotEmpty(config.GddTlsClientCert.Load())
+}
+
+// NewServerConfig creates tls.Config serving certificate from s.CertFile. Client certificates are verified
+// against s.CAFile according to s.ClientAuth, and both of them are reloaded once changed on disk.
+func NewServerConfig(s Settings) (*tls.Config, error) {
+	if stringutils.IsEmpty(s.CertFile) || stringutils.IsEmpty(s.KeyFile) {
+		return nil, errors.New("both certificate and key files are required")
+	}
+	version, err := minVersion(s.MinVersion)
+	if err != nil {
+		return nil, err
+	}
+	reloader, err := NewReloader(s.CertFile, s.KeyFile, s.CAFile, s.ReloadInterval)
+	if err != nil {
+		return nil, err
+	}
+	mode := s.ClientAuth
+	if stringutils.IsEmpty(string(mode)) {
+		mode = NoClientCert
+		if stringutils.IsNotEmpty(s.CAFile) {
+			mode = RequireAndVerifyClientCert
+		}
+	}
+	conf := &tls.Config{
+		MinVersion:     version,
+		GetCertificate: reloader.GetCertificate,
+	}
+	var verify bool
+	switch mode {
+	case NoClientCert:
+		conf.ClientAuth = tls.NoClientCert
+	case RequestClientCert:
+		conf.ClientAuth = tls.RequestClientCert
+	case RequireAnyClientCert:
+		conf.ClientAuth = tls.RequireAnyClientCert
+	case VerifyClientCertIfGiven:
+		conf.ClientAuth = tls.VerifyClientCertIfGiven
+		verify = true
+	case RequireAndVerifyClientCert:
+		conf.ClientAuth = tls.RequireAndVerifyClientCert
+		verify = true
+	default:
+		return nil, errors.Errorf("unknown client auth mode %s", mode)
+	}
+	if !verify {
+		return conf, nil
+	}
+	if stringutils.IsEmpty(s.CAFile) {
+		return nil, errors.Errorf("client CA file is required by client auth mode %s", mode)
+	}
+	// ClientCAs is set per handshake rather than once, so that renewed CA bundle takes effect
+	// for new connections without rebuilding the config.
+	base := conf.Clone()
+	conf.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		c := base.Clone()
+		c.ClientCAs = reloader.CertPool()
+		return c, nil
+	}
+	return conf, nil
+}
+
+// NewClientConfig creates tls.Config verifying server certificates against s.CAFile, or system roots if empty.
+// Certificate from s.CertFile is presented to servers requiring mTLS and reloaded once changed on disk.
+func NewClientConfig(s Settings) (*tls.Config, error) {
+	version, err := minVersion(s.MinVersion)
+	if err != nil {
+		return nil, err
+	}
+	reloader, err := NewReloader(s.CertFile, s.KeyFile, s.CAFile, s.ReloadInterval)
+	if err != nil {
+		return nil, err
+	}
+	conf := &tls.Config{
+		MinVersion:         version,
+		ServerName:         s.ServerName,
+		InsecureSkipVerify: s.InsecureSkipVerify,
+	}
+	if stringutils.IsNotEmpty(s.CertFile) {
+		conf.GetClientCertificate = reloader.GetClientCertificate
+	}
+	if stringutils.IsNotEmpty(s.CAFile) && !s.InsecureSkipVerify {
+		// Server certificates are verified against current CA bundle in VerifyConnection rather than
+		// by setting RootCAs, so that renewed CA bundle takes effect for new connections.
+		conf.InsecureSkipVerify = true
+		conf.VerifyConnection = reloader.verifyServer
+	}
+	return conf, nil
+}
+
+// ServerConfig creates server side tls.Config from environment variables, nil is returned if tls is disabled.
+// It panics if certificates cannot be loaded.
+func ServerConfig() *tls.Config {
+	if !ServerEnabled() {
+		return nil
+	}
+	conf, err := NewServerConfig(ServerSettings())
+	if err != nil {
+		logger.Panic().Err(err).Msg("[go-doudou] failed to create server tls config")
+	}
+	return conf
+}
+
+// ClientConfig creates client side tls.Config from environment variables, nil is returned if tls is disabled.
+// It panics if certificates cannot be loaded.
+func ClientConfig() *tls.Config {
+	if !ClientEnabled() {
+		return nil
+	}
+	conf, err := NewClientConfig(ClientSettings())
+	if err != nil {
+		logger.Panic().Err(err).Msg("[go-doudou] failed to create client tls config")
+	}
+	return conf
+}
+
+// Scheme returns scheme of urls built by service providers for rest services
+func Scheme() string {
+	if ClientEnabled() {
+		return "https"
+	}
+	return "http"
+}
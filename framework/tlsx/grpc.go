@@ -0,0 +1,25 @@
+package tlsx
+
+import (
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// ServerOptions prepends transport credentials to opt if server tls is enabled
+func ServerOptions(opt ...grpc.ServerOption) []grpc.ServerOption {
+	conf := ServerConfig()
+	if conf == nil {
+		return opt
+	}
+	return append([]grpc.ServerOption{grpc.Creds(credentials.NewTLS(conf))}, opt...)
+}
+
+// DialOptions prepends transport credentials to dialOptions if client tls is enabled, so that
+// credentials explicitly passed by caller still take precedence
+func DialOptions(dialOptions ...grpc.DialOption) []grpc.DialOption {
+	conf := ClientConfig()
+	if conf == nil {
+		return dialOptions
+	}
+	return append([]grpc.DialOption{grpc.WithTransportCredentials(credentials.NewTLS(conf))}, dialOptions...)
+}
@@ -0,0 +1,62 @@
+package tlsx
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+)
+
+// Identity is identity of peer authenticated by mTLS
+type Identity struct {
+	CommonName   string
+	Organization []string
+	DNSNames     []string
+	// URIs contains SPIFFE ids if any
+	URIs        []string
+	Certificate *x509.Certificate
+}
+
+type identityKey struct{}
+
+// IdentityOf returns identity from leaf certificate of the verified chain presented by peer.
+// Certificates accepted without verification are not taken as identity.
+func IdentityOf(state *tls.ConnectionState) (Identity, bool) {
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return Identity{}, false
+	}
+	cert := state.VerifiedChains[0][0]
+	id := Identity{
+		CommonName:   cert.Subject.CommonName,
+		Organization: cert.Subject.Organization,
+		DNSNames:     cert.DNSNames,
+		Certificate:  cert,
+	}
+	for _, uri := range cert.URIs {
+		id.URIs = append(id.URIs, uri.String())
+	}
+	return id, true
+}
+
+// NewContext returns a new context carrying peer identity
+func NewContext(ctx context.Context, id Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, id)
+}
+
+// FromContext returns peer identity put by rest server, or taken from grpc peer info
+func FromContext(ctx context.Context) (Identity, bool) {
+	if id, ok := ctx.Value(identityKey{}).(Identity); ok {
+		return id, true
+	}
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return Identity{}, false
+	}
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok {
+		return Identity{}, false
+	}
+	return IdentityOf(&info.State)
+}
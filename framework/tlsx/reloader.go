@@ -0,0 +1,173 @@
+package tlsx
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	logger "github.com/unionj-cloud/go-doudou/v2/toolkit/zlogger"
+)
+
+// Reloader keeps certificate and CA bundle loaded from disk up to date. Files are checked for changes
+// at most once per interval on handshake, so renewed certificates take effect without restart.
+type Reloader struct {
+	certFile, keyFile, caFile string
+	interval                  time.Duration
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	pool    *x509.CertPool
+	modTime time.Time
+	checked time.Time
+}
+
+// NewReloader loads certFile and keyFile as key pair and caFile as CA bundle. Both of key pair and
+// CA bundle are optional.
+func NewReloader(certFile, keyFile, caFile string, interval time.Duration) (*Reloader, error) {
+	r := &Reloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+		caFile:   caFile,
+		interval: interval,
+	}
+	modTime, err := r.lastModified()
+	if err != nil {
+		return nil, err
+	}
+	if err = r.load(modTime); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *Reloader) files() []string {
+	var files []string
+	for _, file := range []string{r.certFile, r.keyFile, r.caFile} {
+		if file != "" {
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
+func (r *Reloader) lastModified() (time.Time, error) {
+	var modTime time.Time
+	for _, file := range r.files() {
+		info, err := os.Stat(file)
+		if err != nil {
+			return modTime, errors.WithStack(err)
+		}
+		if info.ModTime().After(modTime) {
+			modTime = info.ModTime()
+		}
+	}
+	return modTime, nil
+}
+
+func (r *Reloader) load(modTime time.Time) error {
+	var cert *tls.Certificate
+	if r.certFile != "" {
+		pair, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+		if err != nil {
+			return errors.Wrapf(err, "failed to load key pair %s and %s", r.certFile, r.keyFile)
+		}
+		cert = &pair
+	}
+	var pool *x509.CertPool
+	if r.caFile != "" {
+		pem, err := os.ReadFile(r.caFile)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return errors.Errorf("no certificate found in %s", r.caFile)
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cert, r.pool, r.modTime, r.checked = cert, pool, modTime, time.Now()
+	return nil
+}
+
+// maybeReload reloads files if they changed since last load. Failures are logged and the previously
+// loaded certificates keep being served, for files may be observed in the middle of being replaced.
+func (r *Reloader) maybeReload() {
+	r.mu.RLock()
+	due := time.Since(r.checked) >= r.interval
+	r.mu.RUnlock()
+	if !due {
+		return
+	}
+	r.mu.Lock()
+	r.checked = time.Now()
+	loaded := r.modTime
+	r.mu.Unlock()
+	modTime, err := r.lastModified()
+	if err != nil {
+		logger.Error().Err(err).Msg("[go-doudou] failed to check certificate files")
+		return
+	}
+	if !modTime.After(loaded) {
+		return
+	}
+	if err = r.load(modTime); err != nil {
+		logger.Error().Err(err).Msg("[go-doudou] failed to reload certificates")
+		return
+	}
+	logger.Info().Msgf("[go-doudou] certificates reloaded from %v", r.files())
+}
+
+// Certificate returns current key pair
+func (r *Reloader) Certificate() *tls.Certificate {
+	r.maybeReload()
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert
+}
+
+// CertPool returns current CA bundle
+func (r *Reloader) CertPool() *x509.CertPool {
+	r.maybeReload()
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.pool
+}
+
+// GetCertificate is for tls.Config GetCertificate
+func (r *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	if cert := r.Certificate(); cert != nil {
+		return cert, nil
+	}
+	return nil, errors.New("no server certificate configured")
+}
+
+// GetClientCertificate is for tls.Config GetClientCertificate
+func (r *Reloader) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	if cert := r.Certificate(); cert != nil {
+		return cert, nil
+	}
+	// sending no certificate lets server decide whether it is acceptable
+	return &tls.Certificate{}, nil
+}
+
+// verifyServer verifies certificate chain and host name presented by server against current CA bundle
+func (r *Reloader) verifyServer(state tls.ConnectionState) error {
+	if len(state.PeerCertificates) == 0 {
+		return errors.New("no server certificate presented")
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range state.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err := state.PeerCertificates[0].Verify(x509.VerifyOptions{
+		Roots:         r.CertPool(),
+		DNSName:       state.ServerName,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+	return errors.WithStack(err)
+}
@@ -0,0 +1,341 @@
+package tlsx
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	"google.golang.org/grpc/health/grpc_health_v1"
+)
+
+type authority struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+var serial int64
+
+// newCert issues a certificate signed by ca, or a self-signed CA certificate if ca is nil
+func newCert(t *testing.T, ca *authority, cn string, usage x509.ExtKeyUsage) (*authority, []byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	serial++
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: cn, Organization: []string{"go-doudou"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+	}
+	parent, signer := template, key
+	if ca == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		template.KeyUsage |= x509.KeyUsageCertSign
+	} else {
+		parent, signer = ca.cert, ca.key
+		template.ExtKeyUsage = []x509.ExtKeyUsage{usage}
+		template.DNSNames = []string{"localhost"}
+		template.IPAddresses = []net.IP{net.ParseIP("127.0.0.1")}
+		spiffe, _ := url.Parse("spiffe://go-doudou/" + cn)
+		template.URIs = []*url.URL{spiffe}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, signer)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	return &authority{cert: cert, key: key},
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+}
+
+// writeFile writes content and moves modification time forward, for files may be rewritten within the same tick
+func writeFile(t *testing.T, file string, content []byte) {
+	require.NoError(t, os.WriteFile(file, content, 0600))
+	modTime := time.Now().Add(time.Duration(serial) * time.Second)
+	require.NoError(t, os.Chtimes(file, modTime, modTime))
+}
+
+type pki struct {
+	dir                           string
+	ca                            *authority
+	caFile, serverCert, serverKey string
+	clientCert, clientKey         string
+}
+
+func setupPKI(t *testing.T) *pki {
+	dir := t.TempDir()
+	p := &pki{
+		dir:        dir,
+		caFile:     filepath.Join(dir, "ca.pem"),
+		serverCert: filepath.Join(dir, "server.pem"),
+		serverKey:  filepath.Join(dir, "server-key.pem"),
+		clientCert: filepath.Join(dir, "client.pem"),
+		clientKey:  filepath.Join(dir, "client-key.pem"),
+	}
+	ca, caPem, _ := newCert(t, nil, "test-ca", 0)
+	p.ca = ca
+	writeFile(t, p.caFile, caPem)
+	_, certPem, keyPem := newCert(t, ca, "usersvc", x509.ExtKeyUsageServerAuth)
+	writeFile(t, p.serverCert, certPem)
+	writeFile(t, p.serverKey, keyPem)
+	_, certPem, keyPem = newCert(t, ca, "ordersvc", x509.ExtKeyUsageClientAuth)
+	writeFile(t, p.clientCert, certPem)
+	writeFile(t, p.clientKey, keyPem)
+	return p
+}
+
+type httpsServer struct {
+	*httptest.Server
+	URL string
+}
+
+// newHttpsServer serves with conf as is, httptest.Server.StartTLS would add its own certificate to conf
+func newHttpsServer(t *testing.T, conf *tls.Config) *httpsServer {
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, ok := IdentityOf(r.TLS)
+		if !ok {
+			io.WriteString(w, "anonymous")
+			return
+		}
+		io.WriteString(w, id.CommonName+" "+id.URIs[0])
+	}))
+	ts.Listener = tls.NewListener(ts.Listener, conf)
+	ts.Start()
+	t.Cleanup(ts.Close)
+	return &httpsServer{Server: ts, URL: "https://" + ts.Listener.Addr().String()}
+}
+
+func get(conf *tls.Config, url string) (string, error) {
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: conf}}
+	resp, err := client.Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	return string(body), err
+}
+
+func TestMutualTLS(t *testing.T) {
+	p := setupPKI(t)
+	serverConf, err := NewServerConfig(Settings{CertFile: p.serverCert, KeyFile: p.serverKey, CAFile: p.caFile})
+	require.NoError(t, err)
+	ts := newHttpsServer(t, serverConf)
+
+	clientConf, err := NewClientConfig(Settings{CertFile: p.clientCert, KeyFile: p.clientKey, CAFile: p.caFile})
+	require.NoError(t, err)
+	body, err := get(clientConf, ts.URL)
+	require.NoError(t, err)
+	require.Equal(t, "ordersvc spiffe://go-doudou/ordersvc", body)
+
+	// client without certificate is rejected in default mode once client CA is set
+	anonymous, err := NewClientConfig(Settings{CAFile: p.caFile})
+	require.NoError(t, err)
+	_, err = get(anonymous, ts.URL)
+	require.Error(t, err)
+
+	// client certificate issued by unknown CA is rejected
+	other, _, _ := newCert(t, nil, "other-ca", 0)
+	_, certPem, keyPem := newCert(t, other, "intruder", x509.ExtKeyUsageClientAuth)
+	writeFile(t, filepath.Join(p.dir, "intruder.pem"), certPem)
+	writeFile(t, filepath.Join(p.dir, "intruder-key.pem"), keyPem)
+	intruder, err := NewClientConfig(Settings{CertFile: filepath.Join(p.dir, "intruder.pem"), KeyFile: filepath.Join(p.dir, "intruder-key.pem"), CAFile: p.caFile})
+	require.NoError(t, err)
+	_, err = get(intruder, ts.URL)
+	require.Error(t, err)
+}
+
+func TestVerifyClientCertIfGiven(t *testing.T) {
+	p := setupPKI(t)
+	serverConf, err := NewServerConfig(Settings{CertFile: p.serverCert, KeyFile: p.serverKey, CAFile: p.caFile, ClientAuth: VerifyClientCertIfGiven})
+	require.NoError(t, err)
+	ts := newHttpsServer(t, serverConf)
+
+	anonymous, err := NewClientConfig(Settings{CAFile: p.caFile})
+	require.NoError(t, err)
+	body, err := get(anonymous, ts.URL)
+	require.NoError(t, err)
+	require.Equal(t, "anonymous", body)
+
+	clientConf, err := NewClientConfig(Settings{CertFile: p.clientCert, KeyFile: p.clientKey, CAFile: p.caFile})
+	require.NoError(t, err)
+	body, err = get(clientConf, ts.URL)
+	require.NoError(t, err)
+	require.Equal(t, "ordersvc spiffe://go-doudou/ordersvc", body)
+}
+
+func TestReload(t *testing.T) {
+	p := setupPKI(t)
+	serverConf, err := NewServerConfig(Settings{CertFile: p.serverCert, KeyFile: p.serverKey, CAFile: p.caFile})
+	require.NoError(t, err)
+	ts := newHttpsServer(t, serverConf)
+
+	servedSerial := func(conf *tls.Config) *big.Int {
+		conn, err := tls.Dial("tcp", ts.Listener.Addr().String(), conf)
+		require.NoError(t, err)
+		defer conn.Close()
+		return conn.ConnectionState().PeerCertificates[0].SerialNumber
+	}
+	clientConf, err := NewClientConfig(Settings{CertFile: p.clientCert, KeyFile: p.clientKey, CAFile: p.caFile})
+	require.NoError(t, err)
+	before := servedSerial(clientConf)
+
+	// renew server certificate
+	renewed, certPem, keyPem := newCert(t, p.ca, "usersvc", x509.ExtKeyUsageServerAuth)
+	writeFile(t, p.serverCert, certPem)
+	writeFile(t, p.serverKey, keyPem)
+	// zero ReloadInterval checks files on every handshake
+	after := servedSerial(clientConf)
+	require.NotEqual(t, before, after)
+	require.Equal(t, renewed.cert.SerialNumber, after)
+
+	// rotate CA, clients holding certificates of new CA are accepted without rebuilding server config
+	ca, caPem, _ := newCert(t, nil, "rotated-ca", 0)
+	_, certPem, keyPem = newCert(t, ca, "ordersvc", x509.ExtKeyUsageClientAuth)
+	writeFile(t, p.clientCert, certPem)
+	writeFile(t, p.clientKey, keyPem)
+	rotated, err := NewClientConfig(Settings{CertFile: p.clientCert, KeyFile: p.clientKey, CAFile: p.caFile})
+	require.NoError(t, err)
+	_, err = get(rotated, ts.URL)
+	require.Error(t, err)
+	bundle, err := os.ReadFile(p.caFile)
+	require.NoError(t, err)
+	writeFile(t, p.caFile, append(bundle, caPem...))
+	body, err := get(rotated, ts.URL)
+	require.NoError(t, err)
+	require.Equal(t, "ordersvc spiffe://go-doudou/ordersvc", body)
+}
+
+func TestClientReloadRootCA(t *testing.T) {
+	p := setupPKI(t)
+	clientConf, err := NewClientConfig(Settings{CAFile: p.caFile})
+	require.NoError(t, err)
+
+	// server certificate issued by a CA not trusted yet is rejected
+	ca, caPem, _ := newCert(t, nil, "rotated-ca", 0)
+	_, certPem, keyPem := newCert(t, ca, "usersvc", x509.ExtKeyUsageServerAuth)
+	writeFile(t, p.serverCert, certPem)
+	writeFile(t, p.serverKey, keyPem)
+	serverConf, err := NewServerConfig(Settings{CertFile: p.serverCert, KeyFile: p.serverKey})
+	require.NoError(t, err)
+	ts := newHttpsServer(t, serverConf)
+	_, err = get(clientConf, ts.URL)
+	require.Error(t, err)
+
+	// renewed CA bundle is picked up without rebuilding client config
+	bundle, err := os.ReadFile(p.caFile)
+	require.NoError(t, err)
+	writeFile(t, p.caFile, append(bundle, caPem...))
+	body, err := get(clientConf, ts.URL)
+	require.NoError(t, err)
+	require.Equal(t, "anonymous", body)
+
+	// host name is still verified
+	mismatched, err := NewClientConfig(Settings{CAFile: p.caFile, ServerName: "ordersvc"})
+	require.NoError(t, err)
+	_, err = get(mismatched, ts.URL)
+	require.ErrorContains(t, err, "ordersvc")
+}
+
+func TestUnverifiedIdentity(t *testing.T) {
+	p := setupPKI(t)
+	serverConf, err := NewServerConfig(Settings{CertFile: p.serverCert, KeyFile: p.serverKey, ClientAuth: RequireAnyClientCert})
+	require.NoError(t, err)
+	ts := newHttpsServer(t, serverConf)
+
+	// certificate accepted without verification is not taken as identity
+	other, _, _ := newCert(t, nil, "other-ca", 0)
+	_, certPem, keyPem := newCert(t, other, "intruder", x509.ExtKeyUsageClientAuth)
+	writeFile(t, filepath.Join(p.dir, "intruder.pem"), certPem)
+	writeFile(t, filepath.Join(p.dir, "intruder-key.pem"), keyPem)
+	intruder, err := NewClientConfig(Settings{CertFile: filepath.Join(p.dir, "intruder.pem"), KeyFile: filepath.Join(p.dir, "intruder-key.pem"), CAFile: p.caFile})
+	require.NoError(t, err)
+	body, err := get(intruder, ts.URL)
+	require.NoError(t, err)
+	require.Equal(t, "anonymous", body)
+}
+
+func TestReloaderInterval(t *testing.T) {
+	p := setupPKI(t)
+	r, err := NewReloader(p.serverCert, p.serverKey, "", time.Hour)
+	require.NoError(t, err)
+	before := r.Certificate()
+	_, certPem, keyPem := newCert(t, p.ca, "usersvc", x509.ExtKeyUsageServerAuth)
+	writeFile(t, p.serverCert, certPem)
+	writeFile(t, p.serverKey, keyPem)
+	require.Same(t, before, r.Certificate())
+
+	r.checked = time.Time{}
+	require.NotSame(t, before, r.Certificate())
+
+	// broken files are ignored and previous certificate keeps being served
+	current := r.Certificate()
+	writeFile(t, p.serverKey, []byte("broken"))
+	r.checked = time.Time{}
+	require.Same(t, current, r.Certificate())
+}
+
+func TestGrpcMutualTLS(t *testing.T) {
+	p := setupPKI(t)
+	serverConf, err := NewServerConfig(Settings{CertFile: p.serverCert, KeyFile: p.serverKey, CAFile: p.caFile})
+	require.NoError(t, err)
+	var peerId Identity
+	server := grpc.NewServer(grpc.Creds(credentials.NewTLS(serverConf)), grpc.UnaryInterceptor(
+		func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+			peerId, _ = FromContext(ctx)
+			return handler(ctx, req)
+		}))
+	grpc_health_v1.RegisterHealthServer(server, health.NewServer())
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go server.Serve(lis)
+	defer server.Stop()
+
+	clientConf, err := NewClientConfig(Settings{CertFile: p.clientCert, KeyFile: p.clientKey, CAFile: p.caFile})
+	require.NoError(t, err)
+	conn, err := grpc.Dial(lis.Addr().String(), grpc.WithTransportCredentials(credentials.NewTLS(clientConf)))
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = grpc_health_v1.NewHealthClient(conn).Check(context.Background(), &grpc_health_v1.HealthCheckRequest{})
+	require.NoError(t, err)
+	require.Equal(t, "ordersvc", peerId.CommonName)
+	require.Equal(t, []string{"spiffe://go-doudou/ordersvc"}, peerId.URIs)
+}
+
+func TestNewServerConfigError(t *testing.T) {
+	p := setupPKI(t)
+	_, err := NewServerConfig(Settings{CertFile: p.serverCert})
+	require.Error(t, err)
+	_, err = NewServerConfig(Settings{CertFile: p.serverCert, KeyFile: p.serverKey, ClientAuth: "always"})
+	require.Error(t, err)
+	_, err = NewServerConfig(Settings{CertFile: p.serverCert, KeyFile: p.serverKey, ClientAuth: RequireAndVerifyClientCert})
+	require.Error(t, err)
+	_, err = NewServerConfig(Settings{CertFile: p.serverCert, KeyFile: p.serverKey, MinVersion: "2.0"})
+	require.Error(t, err)
+	conf, err := NewServerConfig(Settings{CertFile: p.serverCert, KeyFile: p.serverKey, MinVersion: "TLS1.3"})
+	require.NoError(t, err)
+	require.Equal(t, uint16(tls.VersionTLS13), conf.MinVersion)
+	require.Equal(t, tls.NoClientCert, conf.ClientAuth)
+}
@@ -9,12 +9,15 @@ import (
 	"github.com/uber/jaeger-lib/metrics"
 	jprom "github.com/uber/jaeger-lib/metrics/prometheus"
 	ddconfig "github.com/unionj-cloud/go-doudou/v2/framework/internal/config"
+	"github.com/unionj-cloud/go-doudou/v2/framework/lifecycle"
 	"github.com/unionj-cloud/go-doudou/v2/toolkit/stringutils"
 	logger "github.com/unionj-cloud/go-doudou/v2/toolkit/zlogger"
 	"io"
+	"sync"
 )
 
-// Init returns an instance of Jaeger Tracer.
+// Init returns an instance of Jaeger Tracer. The closer is closed on shutdown by lifecycle after everything else,
+// closing it again is a no-op.
 func Init() (opentracing.Tracer, io.Closer) {
 	cfg := &config.Configuration{
 		Sampler:  &config.SamplerConfig{},
@@ -46,7 +49,22 @@ func Init() (opentracing.Tracer, io.Closer) {
 	if err != nil {
 		logger.Panic().Err(errors.Wrap(err, "[go-doudou] cannot initialize Jaeger Tracer")).Msg("")
 	}
-	return tracer, closer
+	once := &onceCloser{closer: closer}
+	lifecycle.Append(lifecycle.Closer("tracer", lifecycle.PriorityTracing, once))
+	return tracer, once
+}
+
+type onceCloser struct {
+	closer io.Closer
+	once   sync.Once
+	err    error
+}
+
+func (c *onceCloser) Close() error {
+	c.once.Do(func() {
+		c.err = c.closer.Close()
+	})
+	return c.err
 }
 
 type jaegerLoggerAdapter struct {
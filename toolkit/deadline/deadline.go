@@ -0,0 +1,59 @@
+package deadline
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Header is http header carrying time in milliseconds the caller waits for the response. Time left is sent
+// instead of an absolute deadline, so that clock skew between hosts doesn't matter, like grpc-timeout of grpc.
+const Header = "X-Gdd-Deadline"
+
+// ErrInvalidDeadline is returned for header value not being a non-negative integer
+var ErrInvalidDeadline = errors.New("invalid deadline")
+
+// Budget returns time left before deadline of ctx, or timeout if it is positive and shorter.
+// ok is false if neither ctx has deadline nor timeout is set.
+func Budget(ctx context.Context, timeout time.Duration) (budget time.Duration, ok bool) {
+	if d, has := ctx.Deadline(); has {
+		budget, ok = time.Until(d), true
+	}
+	if timeout > 0 && (!ok || timeout < budget) {
+		budget, ok = timeout, true
+	}
+	return
+}
+
+// Format encodes budget as header value, partial milliseconds are rounded up so that short budget isn't sent as 0
+func Format(budget time.Duration) string {
+	if budget <= 0 {
+		return "0"
+	}
+	return strconv.FormatInt(int64((budget+time.Millisecond-1)/time.Millisecond), 10)
+}
+
+// Parse decodes header value
+func Parse(value string) (time.Duration, error) {
+	ms, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || ms < 0 {
+		return 0, errors.Wrap(ErrInvalidDeadline, value)
+	}
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
+// WithHeader returns a copy of ctx whose deadline is set by header value, an existing earlier deadline is kept.
+// ctx is returned as is for empty value.
+func WithHeader(ctx context.Context, value string) (context.Context, context.CancelFunc, error) {
+	if value == "" {
+		return ctx, func() {}, nil
+	}
+	budget, err := Parse(value)
+	if err != nil {
+		return ctx, func() {}, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, budget)
+	return ctx, cancel, nil
+}
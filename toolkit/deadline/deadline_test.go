@@ -0,0 +1,70 @@
+package deadline
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBudget(t *testing.T) {
+	_, ok := Budget(context.Background(), 0)
+	require.False(t, ok)
+
+	budget, ok := Budget(context.Background(), time.Minute)
+	require.True(t, ok)
+	require.Equal(t, time.Minute, budget)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	budget, ok = Budget(ctx, time.Minute)
+	require.True(t, ok)
+	require.LessOrEqual(t, budget, time.Second)
+	require.Greater(t, budget, 500*time.Millisecond)
+
+	budget, _ = Budget(ctx, 10*time.Millisecond)
+	require.Equal(t, 10*time.Millisecond, budget)
+}
+
+func TestFormatParse(t *testing.T) {
+	require.Equal(t, "0", Format(-time.Second))
+	require.Equal(t, "1", Format(time.Microsecond))
+	require.Equal(t, "1500", Format(1500*time.Millisecond))
+
+	budget, err := Parse("1500")
+	require.NoError(t, err)
+	require.Equal(t, 1500*time.Millisecond, budget)
+	_, err = Parse("-1")
+	require.ErrorIs(t, err, ErrInvalidDeadline)
+	_, err = Parse("2024-01-01T00:00:00Z")
+	require.ErrorIs(t, err, ErrInvalidDeadline)
+}
+
+func TestWithHeader(t *testing.T) {
+	ctx, cancel, err := WithHeader(context.Background(), "")
+	require.NoError(t, err)
+	cancel()
+	_, ok := ctx.Deadline()
+	require.False(t, ok)
+
+	ctx, cancel, err = WithHeader(context.Background(), "200")
+	require.NoError(t, err)
+	defer cancel()
+	d, ok := ctx.Deadline()
+	require.True(t, ok)
+	require.WithinDuration(t, time.Now().Add(200*time.Millisecond), d, 50*time.Millisecond)
+
+	// an earlier deadline of the server side is kept
+	parent, cancelParent := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancelParent()
+	ctx, cancel, err = WithHeader(parent, "60000")
+	require.NoError(t, err)
+	defer cancel()
+	d2, _ := ctx.Deadline()
+	pd, _ := parent.Deadline()
+	require.Equal(t, pd, d2)
+
+	_, _, err = WithHeader(context.Background(), "abc")
+	require.ErrorIs(t, err, ErrInvalidDeadline)
+}
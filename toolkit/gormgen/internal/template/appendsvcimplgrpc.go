@@ -4,9 +4,7 @@ const AppendSvcImplGrpc = `
 // Post{{.ModelStructName}}Rpc {{.StructComment}}
 ` + NotEditMarkForGDDShort + `
 func (receiver *{{.InterfaceName}}Impl) Post{{.ModelStructName}}Rpc(ctx context.Context, request *pb.{{.ModelStructName}}) (*pb.Post{{.ModelStructName}}RpcResponse, error) {
-	var body dto.{{.ModelStructName}}
-	jsoncopier.DeepCopy(request, &body)
-	data, err := receiver.Post{{.ModelStructName}}(ctx, body)
+	data, err := receiver.Post{{.ModelStructName}}(ctx, request.ToDto())
 	return &pb.Post{{.ModelStructName}}RpcResponse{
 		Data: data,
 	}, errors.WithStack(err)
@@ -17,9 +15,7 @@ func (receiver *{{.InterfaceName}}Impl) Post{{.ModelStructName}}Rpc(ctx context.
 func (receiver *{{.InterfaceName}}Impl) Post{{.ModelStructName}}sRpc(ctx context.Context, request *pb.Post{{.ModelStructName}}sRpcRequest) (*pb.Post{{.ModelStructName}}sRpcResponse, error) {
 	list := make([]dto.{{.ModelStructName}}, 0, len(request.Body))
 	for _, item := range request.Body {
-		var d dto.{{.ModelStructName}}
-		jsoncopier.DeepCopy(item, &d)
-		list = append(list, d)
+		list = append(list, item.ToDto())
 	}
 	data, err := receiver.Post{{.ModelStructName}}s(ctx, list)
 	return &pb.Post{{.ModelStructName}}sRpcResponse{
@@ -34,17 +30,13 @@ func (receiver *{{.InterfaceName}}Impl) Get{{.ModelStructName}}IdRpc(ctx context
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
-	var ret pb.{{.ModelStructName}}
-	jsoncopier.DeepCopy(data, &ret)
-	return &ret, nil
+	return pb.{{.ModelStructName}}FromDto(data), nil
 }
 
 // Put{{.ModelStructName}}Rpc {{.StructComment}}
 ` + NotEditMarkForGDDShort + `
 func (receiver *{{.InterfaceName}}Impl) Put{{.ModelStructName}}Rpc(ctx context.Context, request *pb.{{.ModelStructName}}) (*emptypb.Empty, error) {
-	var body dto.{{.ModelStructName}}
-	jsoncopier.DeepCopy(request, &body)
-	return &emptypb.Empty{}, errors.WithStack(receiver.Put{{.ModelStructName}}(ctx, body))
+	return &emptypb.Empty{}, errors.WithStack(receiver.Put{{.ModelStructName}}(ctx, request.ToDto()))
 }
 
 // Delete{{.ModelStructName}}IdRpc {{.StructComment}}
@@ -64,8 +56,7 @@ func (receiver *{{.InterfaceName}}Impl) Get{{.ModelStructName}}sRpc(ctx context.
 		}
 		filters = append(filters, str.Value)
 	}
-	var parameter dto.Parameter
-	jsoncopier.DeepCopy(request, &parameter)
+	parameter := request.ToDto()
 	parameter.Filters = filters
 	data, err := receiver.Get{{.ModelStructName}}s(ctx, parameter)
 	if err != nil {
@@ -74,18 +65,15 @@ func (receiver *{{.InterfaceName}}Impl) Get{{.ModelStructName}}sRpc(ctx context.
 	items := make([]*anypb.Any, 0, len(data.Items))
 	for _, item := range data.Items {
 		d := dto.{{.ModelStructName}}(item.(model.{{.ModelStructName}}))
-		var msg pb.{{.ModelStructName}}
-		jsoncopier.DeepCopy(d, &msg)
-		a, err := anypb.New(&msg)
+		a, err := anypb.New(pb.{{.ModelStructName}}FromDto(d))
 		if err != nil {
 			return nil, errors.WithStack(err)
 		}
 		items = append(items, a)
 	}
-	var ret pb.Page
-	jsoncopier.DeepCopy(data, &ret)
+	ret := pb.PageFromDto(data)
 	ret.Items = items
-	return &ret, nil
+	return ret, nil
 }
 
 `
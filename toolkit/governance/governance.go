@@ -0,0 +1,81 @@
+package governance
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+// Columns names the columns governed by this package. A column is only governed
+// if the table has it, so a zero value column name disables the feature.
+type Columns struct {
+	// SoftDelete is a nullable time column, rows having non-null value are treated as deleted
+	SoftDelete string
+	// CreatedBy is filled with context principal when a row is created
+	CreatedBy string
+	// UpdatedBy is filled with context principal when a row is created or updated
+	UpdatedBy string
+	// Version is an integer column used as optimistic lock
+	Version string
+}
+
+// DefaultColumns is used by go-doudou generated code if not specified
+var DefaultColumns = Columns{
+	SoftDelete: "deleted_at",
+	CreatedBy:  "created_by",
+	UpdatedBy:  "updated_by",
+	Version:    "version",
+}
+
+// ErrConflict is matched by errors.Is for every ConflictError
+var ErrConflict = errors.New("optimistic lock conflict")
+
+// ConflictError is returned when an update is applied to a stale version of a row
+type ConflictError struct {
+	Table   string
+	Version interface{}
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("%s: row of table %s has been modified or deleted since version %v", ErrConflict, e.Table, e.Version)
+}
+
+// Is makes errors.Is(err, ErrConflict) work
+func (e *ConflictError) Is(target error) bool {
+	return target == ErrConflict
+}
+
+type principalKey struct{}
+
+type unscopedKey struct{}
+
+// WithPrincipal returns a copy of ctx carrying principal who performs the database operations,
+// usually called by an authentication middleware
+func WithPrincipal(ctx context.Context, principal string) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// PrincipalFromContext returns the principal stored by WithPrincipal
+func PrincipalFromContext(ctx context.Context) (string, bool) {
+	if ctx == nil {
+		return "", false
+	}
+	principal, ok := ctx.Value(principalKey{}).(string)
+	return principal, ok && principal != ""
+}
+
+// Unscoped returns a copy of ctx in which soft deleted rows are visible to queries,
+// and deletes remove rows physically
+func Unscoped(ctx context.Context) context.Context {
+	return context.WithValue(ctx, unscopedKey{}, true)
+}
+
+// IsUnscoped reports whether ctx is returned by Unscoped
+func IsUnscoped(ctx context.Context) bool {
+	if ctx == nil {
+		return false
+	}
+	unscoped, _ := ctx.Value(unscopedKey{}).(bool)
+	return unscoped
+}
@@ -0,0 +1,265 @@
+package governance
+
+import (
+	"reflect"
+
+	"github.com/unionj-cloud/go-doudou/v2/toolkit/stringutils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+const (
+	versionSettingKey    = "gdd:governance:version"
+	softDeleteSettingKey = "gdd:governance:soft_delete"
+)
+
+// Plugin is a gorm plugin applying Columns rules to models declaring the columns.
+// Soft delete scoping is done by gorm itself for gorm.DeletedAt typed fields, Plugin makes it follow
+// Unscoped context as well, and scopes queries, updates and deletes by soft delete columns of other types,
+// e.g. *time.Time. Deletes of such models remain physical, only live rows are deleted though.
+type Plugin struct {
+	columns Columns
+}
+
+// NewPlugin creates a Plugin, DefaultColumns is used if columns is not specified
+func NewPlugin(columns ...Columns) *Plugin {
+	p := &Plugin{columns: DefaultColumns}
+	if len(columns) > 0 {
+		p.columns = columns[0]
+	}
+	return p
+}
+
+// Name implements gorm.Plugin interface
+func (p *Plugin) Name() string {
+	return "gdd:governance"
+}
+
+// Initialize implements gorm.Plugin interface
+func (p *Plugin) Initialize(db *gorm.DB) error {
+	callback := db.Callback()
+	if err := callback.Query().Before("gorm:query").Register("gdd:governance:unscoped", p.unscoped); err != nil {
+		return err
+	}
+	if err := callback.Query().After("gdd:governance:unscoped").Before("gorm:query").Register("gdd:governance:soft_delete", p.softDeleteQuery); err != nil {
+		return err
+	}
+	if err := callback.Row().Before("gorm:row").Register("gdd:governance:unscoped", p.unscoped); err != nil {
+		return err
+	}
+	if err := callback.Row().After("gdd:governance:unscoped").Before("gorm:row").Register("gdd:governance:soft_delete", p.softDeleteQuery); err != nil {
+		return err
+	}
+	if err := callback.Delete().Before("gorm:delete").Register("gdd:governance:unscoped", p.unscoped); err != nil {
+		return err
+	}
+	if err := callback.Delete().After("gdd:governance:unscoped").Before("gorm:delete").Register("gdd:governance:soft_delete", p.softDeleteWrite); err != nil {
+		return err
+	}
+	if err := callback.Update().Before("gorm:update").Register("gdd:governance:unscoped", p.unscoped); err != nil {
+		return err
+	}
+	if err := callback.Update().After("gdd:governance:unscoped").Before("gorm:update").Register("gdd:governance:soft_delete", p.softDeleteWrite); err != nil {
+		return err
+	}
+	if err := callback.Create().Before("gorm:create").Register("gdd:governance:before_create", p.beforeCreate); err != nil {
+		return err
+	}
+	if err := callback.Update().Before("gorm:update").Register("gdd:governance:before_update", p.beforeUpdate); err != nil {
+		return err
+	}
+	return callback.Update().After("gorm:update").Register("gdd:governance:after_update", p.afterUpdate)
+}
+
+func (p *Plugin) unscoped(db *gorm.DB) {
+	if IsUnscoped(db.Statement.Context) {
+		db.Statement.Unscoped = true
+	}
+}
+
+// softDeleteField returns SoftDelete field of the model if it is not scoped by gorm itself
+func (p *Plugin) softDeleteField(stmt *gorm.Statement) *schema.Field {
+	field := p.lookUpField(stmt, p.columns.SoftDelete)
+	if field == nil {
+		return nil
+	}
+	if _, ok := reflect.New(field.IndirectFieldType).Interface().(schema.QueryClausesInterface); ok {
+		return nil
+	}
+	return field
+}
+
+func (p *Plugin) scopeSoftDelete(stmt *gorm.Statement) {
+	if stmt.Schema == nil || stmt.Unscoped || stmt.SQL.Len() > 0 {
+		return
+	}
+	field := p.softDeleteField(stmt)
+	if field == nil {
+		return
+	}
+	if _, ok := stmt.Settings.LoadOrStore(softDeleteSettingKey, true); ok {
+		return
+	}
+	stmt.AddClause(clause.Where{Exprs: []clause.Expression{
+		clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName}, Value: nil},
+	}})
+}
+
+func (p *Plugin) softDeleteQuery(db *gorm.DB) {
+	if db.Error == nil {
+		p.scopeSoftDelete(db.Statement)
+	}
+}
+
+// softDeleteWrite scopes updates and deletes targeting specific rows, so that statements
+// without conditions are still rejected by gorm unless global update is allowed
+func (p *Plugin) softDeleteWrite(db *gorm.DB) {
+	if db.Error != nil || db.Statement.Schema == nil {
+		return
+	}
+	if db.AllowGlobalUpdate || hasConditions(db.Statement) {
+		p.scopeSoftDelete(db.Statement)
+	}
+}
+
+func (p *Plugin) beforeCreate(db *gorm.DB) {
+	if db.Error != nil || db.Statement.Schema == nil {
+		return
+	}
+	// rows start from version 1, so that they are locked by their first update
+	if field := p.lookUpField(db.Statement, p.columns.Version); field != nil {
+		initVersion(db.Statement, field)
+	}
+	principal, ok := PrincipalFromContext(db.Statement.Context)
+	if !ok {
+		return
+	}
+	for _, column := range []string{p.columns.CreatedBy, p.columns.UpdatedBy} {
+		if p.lookUpField(db.Statement, column) != nil {
+			db.Statement.SetColumn(column, principal, true)
+		}
+	}
+}
+
+// initVersion sets zero version of rows to be created to 1
+func initVersion(stmt *gorm.Statement, field *schema.Field) {
+	switch dest := stmt.Dest.(type) {
+	case map[string]interface{}:
+		if _, ok := dest[field.DBName]; !ok {
+			if _, ok = dest[field.Name]; !ok {
+				dest[field.DBName] = 1
+			}
+		}
+		return
+	case []map[string]interface{}:
+		for _, item := range dest {
+			if _, ok := item[field.DBName]; !ok {
+				if _, ok = item[field.Name]; !ok {
+					item[field.DBName] = 1
+				}
+			}
+		}
+		return
+	}
+	rv := reflect.Indirect(stmt.ReflectValue)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			row := reflect.Indirect(rv.Index(i))
+			if _, isZero := field.ValueOf(stmt.Context, row); isZero {
+				_ = field.Set(stmt.Context, row, 1)
+			}
+		}
+	case reflect.Struct:
+		if _, isZero := field.ValueOf(stmt.Context, rv); isZero {
+			_ = field.Set(stmt.Context, rv, 1)
+		}
+	}
+}
+
+func (p *Plugin) beforeUpdate(db *gorm.DB) {
+	stmt := db.Statement
+	if db.Error != nil || stmt.Schema == nil {
+		return
+	}
+	if principal, ok := PrincipalFromContext(stmt.Context); ok && p.lookUpField(stmt, p.columns.UpdatedBy) != nil {
+		stmt.SetColumn(p.columns.UpdatedBy, principal, true)
+	}
+	field := p.lookUpField(stmt, p.columns.Version)
+	if field == nil || !hasConditions(stmt) {
+		return
+	}
+	current, ok := versionOf(stmt, field)
+	if !ok {
+		return
+	}
+	stmt.AddClause(clause.Where{Exprs: []clause.Expression{
+		clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName}, Value: current},
+	}})
+	stmt.SetColumn(field.DBName, current+1, true)
+	stmt.Settings.Store(versionSettingKey, current)
+}
+
+func (p *Plugin) afterUpdate(db *gorm.DB) {
+	current, ok := db.Statement.Settings.LoadAndDelete(versionSettingKey)
+	if !ok || db.Error != nil || db.Statement.DryRun {
+		return
+	}
+	if db.RowsAffected == 0 {
+		_ = db.AddError(&ConflictError{Table: db.Statement.Table, Version: current})
+	}
+}
+
+func (p *Plugin) lookUpField(stmt *gorm.Statement, column string) *schema.Field {
+	if stringutils.IsEmpty(column) {
+		return nil
+	}
+	return stmt.Schema.LookUpField(column)
+}
+
+// hasConditions reports whether the update targets specific rows, either by where
+// conditions or by primary key of the model, so that a version condition is meaningful
+func hasConditions(stmt *gorm.Statement) bool {
+	if c, ok := stmt.Clauses["WHERE"]; ok {
+		if where, ok := c.Expression.(clause.Where); ok && len(where.Exprs) > 0 {
+			return true
+		}
+	}
+	if stmt.Schema.PrioritizedPrimaryField == nil {
+		return false
+	}
+	rv := reflect.Indirect(stmt.ReflectValue)
+	if rv.Kind() != reflect.Struct || rv.Type() != stmt.Schema.ModelType {
+		return false
+	}
+	_, isZero := stmt.Schema.PrioritizedPrimaryField.ValueOf(stmt.Context, rv)
+	return !isZero
+}
+
+// versionOf returns non-zero version value carried by the update destination
+func versionOf(stmt *gorm.Statement, field *schema.Field) (int64, bool) {
+	var value interface{}
+	switch dest := stmt.Dest.(type) {
+	case map[string]interface{}:
+		if v, ok := dest[field.DBName]; ok {
+			value = v
+		} else if v, ok = dest[field.Name]; ok {
+			value = v
+		}
+	default:
+		rv := reflect.Indirect(reflect.ValueOf(stmt.Dest))
+		if rv.Kind() != reflect.Struct || rv.Type() != stmt.Schema.ModelType {
+			return 0, false
+		}
+		value, _ = field.ValueOf(stmt.Context, rv)
+	}
+	rv := reflect.Indirect(reflect.ValueOf(value))
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int(), rv.Int() != 0
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(rv.Uint()), rv.Uint() != 0
+	}
+	return 0, false
+}
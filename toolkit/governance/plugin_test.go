@@ -0,0 +1,148 @@
+package governance
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+type book struct {
+	ID        int64 `gorm:"primaryKey"`
+	Title     string
+	CreatedBy string
+	UpdatedBy string
+	Version   int
+	DeletedAt gorm.DeletedAt
+}
+
+func setupDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	require.NoError(t, db.Use(NewPlugin()))
+	require.NoError(t, db.AutoMigrate(&book{}))
+	return db
+}
+
+func TestPluginAudit(t *testing.T) {
+	db := setupDB(t)
+	ctx := WithPrincipal(context.Background(), "jack")
+	b := book{Title: "go", Version: 1}
+	require.NoError(t, db.WithContext(ctx).Create(&b).Error)
+	require.Equal(t, "jack", b.CreatedBy)
+	require.Equal(t, "jack", b.UpdatedBy)
+
+	ctx = WithPrincipal(context.Background(), "rose")
+	require.NoError(t, db.WithContext(ctx).Model(&book{}).Where("id = ?", b.ID).Updates(map[string]interface{}{"title": "gorm"}).Error)
+	var got book
+	require.NoError(t, db.First(&got, b.ID).Error)
+	require.Equal(t, "jack", got.CreatedBy)
+	require.Equal(t, "rose", got.UpdatedBy)
+	require.Equal(t, "gorm", got.Title)
+}
+
+func TestPluginOptimisticLock(t *testing.T) {
+	db := setupDB(t)
+	b := book{Title: "go", Version: 1}
+	require.NoError(t, db.Create(&b).Error)
+
+	stale := b
+	b.Title = "gorm"
+	require.NoError(t, db.Model(&b).Updates(b).Error)
+	require.Equal(t, 2, b.Version)
+
+	stale.Title = "sqlx"
+	err := db.Save(&stale).Error
+	require.True(t, errors.Is(err, ErrConflict))
+	var conflict *ConflictError
+	require.ErrorAs(t, err, &conflict)
+	require.EqualValues(t, 1, conflict.Version)
+
+	var got book
+	require.NoError(t, db.First(&got, b.ID).Error)
+	require.Equal(t, "gorm", got.Title)
+	require.Equal(t, 2, got.Version)
+
+	require.NoError(t, db.Model(&book{}).Where("id = ?", b.ID).Updates(map[string]interface{}{"title": "ent", "version": 2}).Error)
+	require.Error(t, db.Model(&book{}).Where("id = ?", b.ID).Updates(map[string]interface{}{"title": "xorm", "version": 2}).Error)
+}
+
+func TestPluginUnscoped(t *testing.T) {
+	db := setupDB(t)
+	b := book{Title: "go"}
+	require.NoError(t, db.Create(&b).Error)
+	require.NoError(t, db.Delete(&book{}, b.ID).Error)
+
+	var count int64
+	require.NoError(t, db.Model(&book{}).Count(&count).Error)
+	require.EqualValues(t, 0, count)
+
+	ctx := Unscoped(context.Background())
+	require.NoError(t, db.WithContext(ctx).Model(&book{}).Count(&count).Error)
+	require.EqualValues(t, 1, count)
+
+	require.NoError(t, db.WithContext(ctx).Delete(&book{}, b.ID).Error)
+	require.NoError(t, db.Unscoped().Model(&book{}).Count(&count).Error)
+	require.EqualValues(t, 0, count)
+}
+
+func TestPluginVersionOnCreate(t *testing.T) {
+	db := setupDB(t)
+	b := book{Title: "go"}
+	require.NoError(t, db.Create(&b).Error)
+	require.Equal(t, 1, b.Version)
+	books := []book{{Title: "gorm"}, {Title: "ent", Version: 3}}
+	require.NoError(t, db.Create(&books).Error)
+	require.Equal(t, 1, books[0].Version)
+	require.Equal(t, 3, books[1].Version)
+
+	// rows just created are locked by their first update
+	stale := b
+	b.Title = "gorm"
+	require.NoError(t, db.Model(&b).Updates(b).Error)
+	stale.Title = "sqlx"
+	require.ErrorIs(t, db.Save(&stale).Error, ErrConflict)
+}
+
+type article struct {
+	ID        int64 `gorm:"primaryKey"`
+	Title     string
+	DeletedAt *time.Time
+}
+
+func TestPluginSoftDeleteColumn(t *testing.T) {
+	db := setupDB(t)
+	require.NoError(t, db.AutoMigrate(&article{}))
+	now := time.Now()
+	live, deleted := article{Title: "live"}, article{Title: "deleted", DeletedAt: &now}
+	require.NoError(t, db.Create(&live).Error)
+	require.NoError(t, db.Create(&deleted).Error)
+
+	var articles []article
+	require.NoError(t, db.Find(&articles).Error)
+	require.Len(t, articles, 1)
+	require.Equal(t, live.ID, articles[0].ID)
+
+	result := db.Model(&article{}).Where("id = ?", deleted.ID).Update("title", "updated")
+	require.NoError(t, result.Error)
+	require.Zero(t, result.RowsAffected)
+	require.ErrorIs(t, db.Model(&article{}).Update("title", "all").Error, gorm.ErrMissingWhereClause)
+
+	result = db.Delete(&article{}, deleted.ID)
+	require.NoError(t, result.Error)
+	require.Zero(t, result.RowsAffected)
+
+	ctx := Unscoped(context.Background())
+	require.NoError(t, db.WithContext(ctx).Find(&articles).Error)
+	require.Len(t, articles, 2)
+	result = db.WithContext(ctx).Delete(&article{}, deleted.ID)
+	require.NoError(t, result.Error)
+	require.EqualValues(t, 1, result.RowsAffected)
+}
@@ -5,14 +5,24 @@ import (
 	"math/rand"
 )
 
+// Subset returns the subset of backends for client of clientId, each subset has subsetSize backends
+// except the last one. Clients with consecutive ids spread evenly over backends. backends is not modified.
 func Subset(backends []string, clientId int, subsetSize int) []string {
-	subsetCount := int(math.Ceil(float64(len(backends)) / float64(subsetSize)))
+	if subsetSize <= 0 || subsetSize >= len(backends) {
+		return append([]string(nil), backends...)
+	}
+	shuffled := append([]string(nil), backends...)
+	subsetCount := int(math.Ceil(float64(len(shuffled)) / float64(subsetSize)))
 	round := int64(clientId / subsetCount)
-	rand.Seed(round)
-	rand.Shuffle(len(backends), func(i, j int) {
-		backends[i], backends[j] = backends[j], backends[i]
+	r := rand.New(rand.NewSource(round))
+	r.Shuffle(len(shuffled), func(i, j int) {
+		shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
 	})
 	subsetId := clientId % subsetCount
 	start := subsetId * subsetSize
-	return backends[start : start+subsetSize]
+	end := start + subsetSize
+	if end > len(shuffled) {
+		end = len(shuffled)
+	}
+	return shuffled[start:end]
 }
@@ -57,7 +57,7 @@ func SchemaOf(field astutils.FieldMeta) *Schema {
 	switch ft {
 	case "int", "int8", "int16", "int32", "uint", "uint8", "uint16", "uint32", "byte", "rune", "complex64", "complex128":
 		return Int
-	case "int64", "uint64", "uintptr":
+	case "int64", "uint64", "uintptr", "time.Duration":
 		return Int64
 	case "bool":
 		return Bool
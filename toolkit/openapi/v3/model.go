@@ -171,6 +171,8 @@ type Operation struct {
 	Callbacks    map[string]Callback `json:"callbacks,omitempty"`
 	Security     []Security          `json:"security,omitempty"`
 	Servers      []Server            `json:"servers,omitempty"`
+	// XFilterSchema describes allowed filters and sorts of a paginated endpoint
+	XFilterSchema interface{} `json:"x-filter-schema,omitempty"`
 }
 
 // Path https://spec.openapis.org/oas/v3.0.3#path-item-object
@@ -0,0 +1,474 @@
+package gorm
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/morkid/gocache"
+	"github.com/pkg/errors"
+	"github.com/unionj-cloud/go-doudou/v2/toolkit/sliceutils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+var (
+	// ErrMissingCursorSecret is returned by CursorResponse when Config.CursorSecret is empty
+	ErrMissingCursorSecret = errors.New("paginate: cursor secret is required for cursor pagination")
+	// ErrInvalidCursor is returned when a cursor token is malformed, has a bad signature
+	// or was issued for a different sort order
+	ErrInvalidCursor = errors.New("paginate: invalid cursor")
+)
+
+var schemaCache = &sync.Map{}
+
+// CursorPage result wrapper for keyset pagination
+type CursorPage struct {
+	Items   []interface{} `json:"items"`
+	Size    int64         `json:"size"`
+	Next    string        `json:"next,omitempty"`
+	Prev    string        `json:"prev,omitempty"`
+	HasNext bool          `json:"has_next"`
+	HasPrev bool          `json:"has_prev"`
+	Total   *int64        `json:"total,omitempty"`
+	Visible int64         `json:"visible"`
+}
+
+// cursorToken is the signed payload of a cursor. Columns holds "column direction" pairs
+// so that a token can't be replayed against a different sort order.
+type cursorToken struct {
+	Columns  []string      `json:"c"`
+	Values   []cursorValue `json:"v"`
+	Backward bool          `json:"b,omitempty"`
+}
+
+type cursorValue struct {
+	Type  string      `json:"t,omitempty"`
+	Value interface{} `json:"v"`
+}
+
+const (
+	cursorTimeType  = "time"
+	cursorIntType   = "int"
+	cursorUintType  = "uint"
+	cursorFloatType = "float"
+)
+
+// Cursor sets the cursor token returned as CursorPage.Next or CursorPage.Prev by a previous request.
+// An empty token means the first page.
+func (r *resContext) Cursor(token string) ResponseContext {
+	r.cursor = token
+	return r
+}
+
+// WithTotal makes CursorResponse run a COUNT query and fill CursorPage.Total
+func (r *resContext) WithTotal() ResponseContext {
+	r.withTotal = true
+	return r
+}
+
+// CursorResponse paginates by keyset instead of offset. Sort columns come from the sort query string
+// parameter and the primary key is always appended as tie-breaker, so every sort column must be NOT NULL.
+// res must be a pointer to a slice of structs or maps.
+func (r resContext) CursorResponse(res interface{}) (CursorPage, error) {
+	p := r.Pagination
+	query := r.Statement
+	r.prepareConfig()
+	page := CursorPage{}
+	if len(p.Config.CursorSecret) == 0 {
+		return page, ErrMissingCursorSecret
+	}
+	rv := reflect.ValueOf(res)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Slice {
+		return page, errors.Errorf("paginate: CursorResponse expects a pointer to slice, got %T", res)
+	}
+	if nil != p.Config.FilterSchema {
+		if err := p.Config.FilterSchema.Validate(r.Parameter); err != nil {
+			return page, err
+		}
+	}
+
+	param := parameter(r.Parameter)
+	pr := parseRequest(&param, *p.Config)
+	causes := createCauses(pr)
+	sorts := r.cursorSorts(pr)
+
+	var token *cursorToken
+	if r.cursor != "" {
+		t, err := decodeCursor(r.cursor, p.Config.CursorSecret)
+		if err != nil {
+			return page, err
+		}
+		if !reflect.DeepEqual(t.Columns, sortSignature(sorts)) || len(t.Values) != len(sorts) {
+			return page, ErrInvalidCursor
+		}
+		token = &t
+	}
+
+	cKey := ""
+	var adapter gocache.AdapterInterface
+	if nil != p.Config.CacheAdapter {
+		cKey = r.createCursorCacheKey(pr)
+		adapter = *p.Config.CacheAdapter
+		if cKey != "" && adapter.IsValid(cKey) {
+			if cache, err := adapter.Get(cKey); nil == err {
+				page.Items, _ = sliceutils.ConvertAny2Interface(res)
+				if err := p.Config.JSONUnmarshal([]byte(cache), &page); nil == err {
+					return page, nil
+				}
+			}
+		}
+	}
+
+	selects := r.selectFields(pr)
+	if len(selects) > 0 {
+		for _, so := range sorts {
+			fname := query.Statement.Quote("s." + so.Column)
+			if !contains(selects, fname) {
+				selects = append(selects, fname)
+			}
+		}
+	}
+	base := func() *gorm.DB {
+		result := query.Statement.DB.Session(&gorm.Session{NewDB: true}).
+			Unscoped().
+			Table("(?) AS s", query)
+		if len(selects) > 0 {
+			result = result.Select(selects)
+		}
+		if len(causes.Params) > 0 || len(causes.WhereString) > 0 {
+			result = result.Where(causes.WhereString, causes.Params...)
+		}
+		return result
+	}
+
+	if r.withTotal {
+		var total int64
+		if err := base().Count(&total).Error; err != nil {
+			return page, errors.WithStack(err)
+		}
+		page.Total = &total
+	}
+
+	backward := token != nil && token.Backward
+	result := base()
+	if token != nil {
+		where, params := keysetCauses(sorts, token, query.Statement)
+		result = result.Where(where, params...)
+	}
+	for _, so := range sorts {
+		direction := so.Direction
+		if backward {
+			direction = reverseDirection(direction)
+		}
+		result = result.Order(query.Statement.Quote(so.Column) + " " + direction)
+	}
+	if nil != query.Statement.Preloads {
+		for table, args := range query.Statement.Preloads {
+			result = result.Preload(table, args...)
+		}
+	}
+	if err := result.Limit(causes.Limit + 1).Find(res).Error; err != nil {
+		return page, errors.WithStack(err)
+	}
+
+	rows := rv.Elem()
+	hasMore := rows.Len() > causes.Limit
+	if hasMore {
+		rows.Set(rows.Slice(0, causes.Limit))
+	}
+	if backward {
+		for i, j := 0, rows.Len()-1; i < j; i, j = i+1, j-1 {
+			tmp := reflect.ValueOf(rows.Index(i).Interface())
+			rows.Index(i).Set(rows.Index(j))
+			rows.Index(j).Set(tmp)
+		}
+		page.HasPrev = hasMore
+		page.HasNext = true
+	} else {
+		page.HasNext = hasMore
+		page.HasPrev = token != nil
+	}
+
+	if rows.Len() > 0 {
+		s := r.rowSchema(rows.Type().Elem())
+		var err error
+		if page.HasNext {
+			if page.Next, err = r.encodeRowCursor(rows.Index(rows.Len()-1), s, sorts, false); err != nil {
+				return page, err
+			}
+		}
+		if page.HasPrev {
+			if page.Prev, err = r.encodeRowCursor(rows.Index(0), s, sorts, true); err != nil {
+				return page, err
+			}
+		}
+	}
+
+	page.Items, _ = sliceutils.ConvertAny2Interface(rows.Interface())
+	page.Size = int64(pr.Size)
+	page.Visible = int64(rows.Len())
+
+	if cKey != "" {
+		if cache, err := p.Config.JSONMarshal(page); nil == err {
+			if err := adapter.Set(cKey, string(cache)); err != nil {
+				log.Println(err)
+			}
+		}
+	}
+
+	return page, nil
+}
+
+// cursorSorts returns requested sorts with unquoted column names and the primary key appended as tie-breaker
+func (r resContext) cursorSorts(pr pageRequest) []sortOrder {
+	pk := r.Pagination.Config.PrimaryKey
+	if pk == "" {
+		pk = "id"
+		if model := r.Statement.Statement.Model; model != nil {
+			if s, err := schema.Parse(model, schemaCache, r.Statement.NamingStrategy); err == nil && s.PrioritizedPrimaryField != nil {
+				pk = s.PrioritizedPrimaryField.DBName
+			}
+		}
+	}
+	var sorts []sortOrder
+	direction := "ASC"
+	hasPk := false
+	for _, so := range pr.Sorts {
+		so.Column = fieldName(so.Column)
+		if so.Column == pk {
+			hasPk = true
+		}
+		direction = so.Direction
+		sorts = append(sorts, so)
+	}
+	if !hasPk {
+		sorts = append(sorts, sortOrder{Column: pk, Direction: direction})
+	}
+	return sorts
+}
+
+func (r resContext) rowSchema(elemType reflect.Type) *schema.Schema {
+	for elemType.Kind() == reflect.Ptr {
+		elemType = elemType.Elem()
+	}
+	if elemType.Kind() != reflect.Struct {
+		return nil
+	}
+	s, err := schema.Parse(reflect.New(elemType).Interface(), schemaCache, r.Statement.NamingStrategy)
+	if err != nil {
+		return nil
+	}
+	return s
+}
+
+func (r resContext) encodeRowCursor(row reflect.Value, s *schema.Schema, sorts []sortOrder, backward bool) (string, error) {
+	token := cursorToken{
+		Columns:  sortSignature(sorts),
+		Backward: backward,
+	}
+	for _, so := range sorts {
+		value, err := columnValue(row, s, so.Column)
+		if err != nil {
+			return "", err
+		}
+		token.Values = append(token.Values, newCursorValue(value))
+	}
+	return encodeCursor(token, r.Pagination.Config.CursorSecret)
+}
+
+func (r resContext) createCursorCacheKey(pr pageRequest) string {
+	key := ""
+	if bte, err := pr.Config.JSONMarshal(struct {
+		Request   pageRequest
+		Cursor    string
+		WithTotal bool
+	}{pr, r.cursor, r.withTotal}); nil == err && r.cachePrefix != "" {
+		key = fmt.Sprintf("%scursor:%x", r.cachePrefix, md5.Sum(bte))
+	}
+	return key
+}
+
+func columnValue(row reflect.Value, s *schema.Schema, column string) (interface{}, error) {
+	for row.Kind() == reflect.Ptr || row.Kind() == reflect.Interface {
+		row = row.Elem()
+	}
+	switch row.Kind() {
+	case reflect.Map:
+		if v := row.MapIndex(reflect.ValueOf(column)); v.IsValid() {
+			return v.Interface(), nil
+		}
+	case reflect.Struct:
+		if s != nil {
+			if field := s.LookUpField(column); field != nil {
+				value, _ := field.ValueOf(context.Background(), row)
+				return value, nil
+			}
+		}
+	}
+	return nil, errors.Errorf("paginate: cursor column %s not found in result", column)
+}
+
+func newCursorValue(value interface{}) cursorValue {
+	if valuer, ok := value.(driver.Valuer); ok {
+		if v, err := valuer.Value(); err == nil {
+			value = v
+		}
+	}
+	switch v := value.(type) {
+	case time.Time:
+		return cursorValue{Type: cursorTimeType, Value: v.Format(time.RFC3339Nano)}
+	case *time.Time:
+		if v != nil {
+			return cursorValue{Type: cursorTimeType, Value: v.Format(time.RFC3339Nano)}
+		}
+	case []byte:
+		return cursorValue{Value: string(v)}
+	}
+	// numbers are tagged with their kind, so that they are decoded back exactly, e.g. snowflake ids above 2^53
+	if value != nil {
+		switch reflect.ValueOf(value).Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return cursorValue{Type: cursorIntType, Value: value}
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			return cursorValue{Type: cursorUintType, Value: value}
+		case reflect.Float32, reflect.Float64:
+			return cursorValue{Type: cursorFloatType, Value: value}
+		}
+	}
+	return cursorValue{Value: value}
+}
+
+func (v cursorValue) param() (interface{}, error) {
+	if v.Type == cursorTimeType {
+		str, ok := v.Value.(string)
+		if !ok {
+			return nil, ErrInvalidCursor
+		}
+		t, err := time.Parse(time.RFC3339Nano, str)
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+		return t, nil
+	}
+	n, ok := v.Value.(json.Number)
+	if !ok {
+		return v.Value, nil
+	}
+	var (
+		value interface{}
+		err   error
+	)
+	switch v.Type {
+	case cursorIntType:
+		value, err = n.Int64()
+	case cursorUintType:
+		value, err = strconv.ParseUint(n.String(), 10, 64)
+	case cursorFloatType:
+		value, err = n.Float64()
+	default:
+		if value, err = n.Int64(); err != nil {
+			value, err = n.Float64()
+		}
+	}
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return value, nil
+}
+
+// keysetCauses builds (c1 > v1) OR (c1 = v1 AND c2 > v2) OR ... which also works for mixed directions
+func keysetCauses(sorts []sortOrder, token *cursorToken, stmt *gorm.Statement) (string, []interface{}) {
+	var ors []string
+	var params []interface{}
+	for i := range sorts {
+		var ands []string
+		for j := 0; j < i; j++ {
+			ands = append(ands, stmt.Quote(sorts[j].Column)+" = ?")
+			v, _ := token.Values[j].param()
+			params = append(params, v)
+		}
+		direction := sorts[i].Direction
+		if token.Backward {
+			direction = reverseDirection(direction)
+		}
+		op := ">"
+		if direction == "DESC" {
+			op = "<"
+		}
+		ands = append(ands, stmt.Quote(sorts[i].Column)+" "+op+" ?")
+		v, _ := token.Values[i].param()
+		params = append(params, v)
+		ors = append(ors, "("+strings.Join(ands, " AND ")+")")
+	}
+	return "(" + strings.Join(ors, " OR ") + ")", params
+}
+
+func reverseDirection(direction string) string {
+	if direction == "DESC" {
+		return "ASC"
+	}
+	return "DESC"
+}
+
+func sortSignature(sorts []sortOrder) []string {
+	var columns []string
+	for _, so := range sorts {
+		columns = append(columns, so.Column+" "+so.Direction)
+	}
+	return columns
+}
+
+func encodeCursor(token cursorToken, secret []byte) (string, error) {
+	payload, err := json.Marshal(token)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(payload)
+	return base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+func decodeCursor(cursor string, secret []byte) (cursorToken, error) {
+	var token cursorToken
+	parts := strings.Split(cursor, ".")
+	if len(parts) != 2 {
+		return token, ErrInvalidCursor
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return token, ErrInvalidCursor
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return token, ErrInvalidCursor
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(payload)
+	if !hmac.Equal(sig, mac.Sum(nil)) {
+		return token, ErrInvalidCursor
+	}
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	decoder.UseNumber()
+	if err = decoder.Decode(&token); err != nil {
+		return token, ErrInvalidCursor
+	}
+	for _, v := range token.Values {
+		if _, err = v.param(); err != nil {
+			return token, err
+		}
+	}
+	return token, nil
+}
@@ -0,0 +1,151 @@
+package gorm
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+type cursorUser struct {
+	ID   int64 `gorm:"primaryKey"`
+	Name string
+	Age  int
+}
+
+func setupCursorDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	require.NoError(t, db.AutoMigrate(&cursorUser{}))
+	for i := 1; i <= 25; i++ {
+		require.NoError(t, db.Create(&cursorUser{ID: int64(i), Name: fmt.Sprintf("user%02d", i), Age: 20 + i%3}).Error)
+	}
+	return db
+}
+
+func ids(users []cursorUser) []int64 {
+	var result []int64
+	for _, u := range users {
+		result = append(result, u.ID)
+	}
+	return result
+}
+
+func TestCursorResponse(t *testing.T) {
+	db := setupCursorDB(t)
+	pg := New(&Config{CursorSecret: []byte("secret")})
+	param := Parameter{Size: "10", Sort: "-age"}
+
+	var seen []int64
+	cursor := ""
+	var pages []CursorPage
+	for {
+		var users []cursorUser
+		page, err := pg.With(db.Model(&cursorUser{})).Request(param).Cursor(cursor).CursorResponse(&users)
+		require.NoError(t, err)
+		require.Nil(t, page.Total)
+		seen = append(seen, ids(users)...)
+		pages = append(pages, page)
+		if !page.HasNext {
+			break
+		}
+		cursor = page.Next
+	}
+	require.Len(t, pages, 3)
+	require.Len(t, seen, 25)
+	require.False(t, pages[0].HasPrev)
+	require.True(t, pages[2].HasPrev)
+
+	var all []cursorUser
+	require.NoError(t, db.Order("age DESC, id DESC").Find(&all).Error)
+	require.Equal(t, ids(all), seen)
+
+	var users []cursorUser
+	page, err := pg.With(db.Model(&cursorUser{})).Request(param).Cursor(pages[2].Prev).WithTotal().CursorResponse(&users)
+	require.NoError(t, err)
+	require.Equal(t, ids(all)[10:20], ids(users))
+	require.True(t, page.HasPrev)
+	require.True(t, page.HasNext)
+	require.EqualValues(t, 25, *page.Total)
+
+	page, err = pg.With(db.Model(&cursorUser{})).Request(param).Cursor(page.Prev).CursorResponse(&users)
+	require.NoError(t, err)
+	require.Equal(t, ids(all)[:10], ids(users))
+	require.False(t, page.HasPrev)
+}
+
+func TestCursorResponseFilters(t *testing.T) {
+	db := setupCursorDB(t)
+	pg := New(&Config{CursorSecret: []byte("secret")})
+	param := Parameter{Size: "3", Sort: "name", Filters: []interface{}{"age", "=", 21}}
+
+	var users []cursorUser
+	page, err := pg.With(db.Model(&cursorUser{})).Request(param).WithTotal().CursorResponse(&users)
+	require.NoError(t, err)
+	require.Equal(t, []int64{1, 4, 7}, ids(users))
+	require.EqualValues(t, 9, *page.Total)
+
+	page, err = pg.With(db.Model(&cursorUser{})).Request(param).Cursor(page.Next).CursorResponse(&users)
+	require.NoError(t, err)
+	require.Equal(t, []int64{10, 13, 16}, ids(users))
+}
+
+func TestCursorResponseInvalidCursor(t *testing.T) {
+	db := setupCursorDB(t)
+	pg := New(&Config{CursorSecret: []byte("secret")})
+	var users []cursorUser
+	page, err := pg.With(db.Model(&cursorUser{})).Request(Parameter{Size: "5", Sort: "name"}).CursorResponse(&users)
+	require.NoError(t, err)
+
+	_, err = pg.With(db.Model(&cursorUser{})).Request(Parameter{Size: "5", Sort: "-name"}).Cursor(page.Next).CursorResponse(&users)
+	require.ErrorIs(t, err, ErrInvalidCursor)
+
+	_, err = pg.With(db.Model(&cursorUser{})).Request(Parameter{Size: "5", Sort: "name"}).Cursor(page.Next + "x").CursorResponse(&users)
+	require.ErrorIs(t, err, ErrInvalidCursor)
+
+	other := New(&Config{CursorSecret: []byte("other")})
+	_, err = other.With(db.Model(&cursorUser{})).Request(Parameter{Size: "5", Sort: "name"}).Cursor(page.Next).CursorResponse(&users)
+	require.ErrorIs(t, err, ErrInvalidCursor)
+
+	_, err = New().With(db.Model(&cursorUser{})).Request(Parameter{Size: "5"}).CursorResponse(&users)
+	require.ErrorIs(t, err, ErrMissingCursorSecret)
+}
+
+func TestCursorResponseLargeIDs(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open("file::memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	require.NoError(t, db.AutoMigrate(&cursorUser{}))
+	// snowflake style ids above 2^53 which float64 can't represent exactly
+	const base = int64(1234567890123456789)
+	var want []int64
+	for i := 0; i < 7; i++ {
+		id := base + int64(i)
+		want = append(want, id)
+		require.NoError(t, db.Create(&cursorUser{ID: id, Name: fmt.Sprintf("user%02d", i)}).Error)
+	}
+	pg := New(&Config{CursorSecret: []byte("secret")})
+	param := Parameter{Size: "3", Sort: "id"}
+
+	var seen []int64
+	cursor := ""
+	for {
+		var users []cursorUser
+		page, err := pg.With(db.Model(&cursorUser{})).Request(param).Cursor(cursor).CursorResponse(&users)
+		require.NoError(t, err)
+		seen = append(seen, ids(users)...)
+		require.LessOrEqual(t, len(seen), len(want), "rows are repeated")
+		if !page.HasNext {
+			break
+		}
+		cursor = page.Next
+	}
+	require.Equal(t, want, seen)
+}
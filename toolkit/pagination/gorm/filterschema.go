@@ -0,0 +1,351 @@
+package gorm
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/unionj-cloud/go-doudou/v2/toolkit/stringutils"
+)
+
+const (
+	// FilterAnnotation declares filterable fields on a service method, e.g. @filter(name:string:=|LIKE,age:int:>|<|BETWEEN)
+	FilterAnnotation = "@filter"
+	// SortAnnotation declares sortable fields on a service method, e.g. @sort(name,age)
+	SortAnnotation = "@sort"
+	// FilterDepthAnnotation limits nesting of filter groups on a service method, e.g. @filterdepth(2)
+	FilterDepthAnnotation = "@filterdepth"
+)
+
+// FilterType is value type of a filterable field
+type FilterType string
+
+const (
+	FilterString FilterType = "string"
+	FilterInt    FilterType = "int"
+	FilterFloat  FilterType = "float"
+	FilterBool   FilterType = "bool"
+	FilterTime   FilterType = "time"
+)
+
+var filterTypes = []FilterType{FilterString, FilterInt, FilterFloat, FilterBool, FilterTime}
+
+var filterOperators = []string{"=", "!=", "<>", ">", ">=", "<", "<=", "LIKE", "NOT LIKE", "ILIKE", "NOT ILIKE",
+	"IN", "NOT IN", "BETWEEN", "IS", "IS NOT"}
+
+// FilterField declares value type and allowed operators of a filterable field
+type FilterField struct {
+	Type      FilterType `json:"type"`
+	Operators []string   `json:"operators"`
+}
+
+// FilterSchema is an allow-list for filters and sort query string parameters of an endpoint
+type FilterSchema struct {
+	Fields   map[string]FilterField `json:"fields,omitempty"`
+	Sorts    []string               `json:"sorts,omitempty"`
+	MaxDepth int                    `json:"maxDepth,omitempty"`
+}
+
+// FilterViolation describes why a parameter is rejected
+type FilterViolation struct {
+	Param    string `json:"param"`
+	Field    string `json:"field,omitempty"`
+	Operator string `json:"operator,omitempty"`
+	Reason   string `json:"reason"`
+}
+
+// FilterError is returned when a request violates FilterSchema
+type FilterError struct {
+	Violations []FilterViolation `json:"violations"`
+}
+
+func (e *FilterError) Error() string {
+	var reasons []string
+	for _, v := range e.Violations {
+		reasons = append(reasons, v.Reason)
+	}
+	return "invalid pagination parameter: " + strings.Join(reasons, "; ")
+}
+
+// NewFilterSchema creates FilterSchema from @filter, @sort and @filterdepth annotation params.
+// Each filter spec is in format of field:type:op1|op2, operators are optional and default to "=".
+func NewFilterSchema(filters []string, sorts []string, maxDepth int) (*FilterSchema, error) {
+	schema := &FilterSchema{
+		Fields:   make(map[string]FilterField),
+		MaxDepth: maxDepth,
+	}
+	for _, spec := range filters {
+		spec = strings.TrimSpace(spec)
+		if stringutils.IsEmpty(spec) {
+			continue
+		}
+		parts := strings.SplitN(spec, ":", 3)
+		if len(parts) < 2 {
+			return nil, errors.Errorf("invalid filter spec %s, should be in format of field:type:op1|op2", spec)
+		}
+		field := FilterField{
+			Type:      FilterType(strings.ToLower(strings.TrimSpace(parts[1]))),
+			Operators: []string{"="},
+		}
+		if !containsFilterType(field.Type) {
+			return nil, errors.Errorf("invalid filter spec %s, unknown type %s", spec, parts[1])
+		}
+		if len(parts) == 3 {
+			field.Operators = nil
+			for _, op := range strings.Split(parts[2], "|") {
+				op = normalizeOperator(op)
+				if !contains(filterOperators, op) {
+					return nil, errors.Errorf("invalid filter spec %s, unknown operator %s", spec, op)
+				}
+				field.Operators = append(field.Operators, op)
+			}
+		}
+		schema.Fields[strings.TrimSpace(parts[0])] = field
+	}
+	for _, item := range sorts {
+		if item = strings.TrimSpace(item); stringutils.IsNotEmpty(item) {
+			schema.Sorts = append(schema.Sorts, item)
+		}
+	}
+	return schema, nil
+}
+
+// AnnotationGetter is implemented by framework.AnnotationStore
+type AnnotationGetter interface {
+	GetParams(key string, annotationName string) []string
+}
+
+// FilterSchemaOf creates FilterSchema from annotations of the method named key.
+// It returns nil if the method has neither @filter nor @sort annotation.
+func FilterSchemaOf(store AnnotationGetter, key string) (*FilterSchema, error) {
+	filters := store.GetParams(key, FilterAnnotation)
+	sorts := store.GetParams(key, SortAnnotation)
+	if len(filters) == 0 && len(sorts) == 0 {
+		return nil, nil
+	}
+	var maxDepth int
+	if depth := store.GetParams(key, FilterDepthAnnotation); len(depth) > 0 {
+		var err error
+		if maxDepth, err = strconv.Atoi(strings.TrimSpace(depth[0])); err != nil {
+			return nil, errors.Wrapf(err, "invalid %s annotation of %s", FilterDepthAnnotation, key)
+		}
+	}
+	return NewFilterSchema(filters, sorts, maxDepth)
+}
+
+// ValidateFilters validates param against the schema declared by annotations of the method named key.
+// param can be Parameter or any struct having the same fields, such as dto.Parameter generated by go-doudou.
+func ValidateFilters(store AnnotationGetter, key string, param interface{}) *FilterError {
+	schema, err := FilterSchemaOf(store, key)
+	if err != nil {
+		return &FilterError{Violations: []FilterViolation{{Param: "filters", Reason: err.Error()}}}
+	}
+	if schema == nil {
+		return nil
+	}
+	return schema.Validate(param)
+}
+
+// Validate checks sort and filters of param against the schema
+func (s *FilterSchema) Validate(param interface{}) *FilterError {
+	var p Parameter
+	switch v := param.(type) {
+	case Parameter:
+		p = v
+	case *Parameter:
+		p = *v
+	default:
+		b, err := json.Marshal(param)
+		if err == nil {
+			err = json.Unmarshal(b, &p)
+		}
+		if err != nil {
+			return &FilterError{Violations: []FilterViolation{{Param: "filters", Reason: err.Error()}}}
+		}
+	}
+	var violations []FilterViolation
+	if stringutils.IsNotEmpty(p.Sort) {
+		for _, col := range strings.Split(p.Sort, ",") {
+			col = strings.TrimPrefix(strings.TrimSpace(col), "-")
+			if stringutils.IsEmpty(col) {
+				continue
+			}
+			if !contains(s.Sorts, col) {
+				violations = append(violations, FilterViolation{
+					Param:  "sort",
+					Field:  col,
+					Reason: fmt.Sprintf("sorting by %s is not allowed", col),
+				})
+			}
+		}
+	}
+	if len(p.Filters) > 0 {
+		violations = append(violations, s.validateFilters(p.Filters, 1)...)
+	}
+	if len(violations) > 0 {
+		return &FilterError{Violations: violations}
+	}
+	return nil
+}
+
+func (s *FilterSchema) validateFilters(arr []interface{}, depth int) []FilterViolation {
+	var violations []FilterViolation
+	if len(arr) == 0 {
+		return nil
+	}
+	if _, isCondition := arr[0].(string); isCondition {
+		return s.validateCondition(arr)
+	}
+	if s.MaxDepth > 0 && depth > s.MaxDepth {
+		return []FilterViolation{{
+			Param:  "filters",
+			Reason: fmt.Sprintf("filters are nested deeper than %d levels", s.MaxDepth),
+		}}
+	}
+	for _, item := range arr {
+		sub, ok := item.([]interface{})
+		if !ok {
+			violations = append(violations, FilterViolation{
+				Param:  "filters",
+				Reason: fmt.Sprintf("unexpected filter element %v", item),
+			})
+			continue
+		}
+		violations = append(violations, s.validateFilters(sub, depth+1)...)
+	}
+	return violations
+}
+
+func (s *FilterSchema) validateCondition(arr []interface{}) []FilterViolation {
+	var (
+		column   string
+		operator = "="
+		value    interface{}
+		ok       bool
+	)
+	switch len(arr) {
+	case 1:
+		op, _ := arr[0].(string)
+		if op = normalizeOperator(op); op != "AND" && op != "OR" {
+			return []FilterViolation{{Param: "filters", Operator: op, Reason: fmt.Sprintf("logical operator %v is not allowed", arr[0])}}
+		}
+		return nil
+	case 2:
+		value = arr[1]
+		if value == nil {
+			operator = "IS"
+		}
+	case 3:
+		if operator, ok = arr[1].(string); !ok {
+			return []FilterViolation{{Param: "filters", Reason: fmt.Sprintf("operator %v should be string", arr[1])}}
+		}
+		operator = normalizeOperator(operator)
+		value = arr[2]
+	default:
+		return []FilterViolation{{Param: "filters", Reason: fmt.Sprintf("malformed filter %v", arr)}}
+	}
+	if column, ok = arr[0].(string); !ok {
+		return []FilterViolation{{Param: "filters", Reason: fmt.Sprintf("field name %v should be string", arr[0])}}
+	}
+	field, exists := s.Fields[column]
+	if !exists {
+		return []FilterViolation{{Param: "filters", Field: column, Reason: fmt.Sprintf("filtering by %s is not allowed", column)}}
+	}
+	if !contains(field.Operators, operator) {
+		return []FilterViolation{{
+			Param:    "filters",
+			Field:    column,
+			Operator: operator,
+			Reason:   fmt.Sprintf("operator %s is not allowed on %s", operator, column),
+		}}
+	}
+	var values []interface{}
+	switch operator {
+	case "IN", "NOT IN", "BETWEEN":
+		if values, ok = value.([]interface{}); !ok || (operator == "BETWEEN" && len(values) != 2) {
+			return []FilterViolation{{
+				Param:    "filters",
+				Field:    column,
+				Operator: operator,
+				Reason:   fmt.Sprintf("operator %s on %s requires an array value", operator, column),
+			}}
+		}
+	case "IS", "IS NOT":
+		if str, isStr := value.(string); value == nil || (isStr && strings.ToLower(str) == "null") {
+			return nil
+		}
+		values = []interface{}{value}
+	default:
+		values = []interface{}{value}
+	}
+	for _, v := range values {
+		if !field.Type.accepts(v) {
+			return []FilterViolation{{
+				Param:    "filters",
+				Field:    column,
+				Operator: operator,
+				Reason:   fmt.Sprintf("value %v of %s should be %s", v, column, field.Type),
+			}}
+		}
+	}
+	return nil
+}
+
+func (t FilterType) accepts(value interface{}) bool {
+	switch t {
+	case FilterString:
+		_, ok := value.(string)
+		return ok
+	case FilterInt:
+		switch v := value.(type) {
+		case float64:
+			return v == float64(int64(v))
+		case int, int32, int64:
+			return true
+		case string:
+			_, err := strconv.ParseInt(v, 10, 64)
+			return err == nil
+		}
+	case FilterFloat:
+		switch v := value.(type) {
+		case float64, float32, int, int32, int64:
+			return true
+		case string:
+			_, err := strconv.ParseFloat(v, 64)
+			return err == nil
+		}
+	case FilterBool:
+		switch v := value.(type) {
+		case bool:
+			return true
+		case string:
+			_, err := strconv.ParseBool(v)
+			return err == nil
+		}
+	case FilterTime:
+		if v, ok := value.(string); ok {
+			for _, layout := range []string{time.RFC3339Nano, "2006-01-02 15:04:05", "2006-01-02"} {
+				if _, err := time.Parse(layout, v); err == nil {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func containsFilterType(t FilterType) bool {
+	for _, item := range filterTypes {
+		if item == t {
+			return true
+		}
+	}
+	return false
+}
+
+func normalizeOperator(op string) string {
+	return strings.Join(strings.Fields(strings.ToUpper(op)), " ")
+}
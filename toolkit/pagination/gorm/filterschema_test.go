@@ -0,0 +1,151 @@
+package gorm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type annotationStore map[string]map[string][]string
+
+func (a annotationStore) GetParams(key string, annotationName string) []string {
+	return a[key][annotationName]
+}
+
+func TestNewFilterSchema(t *testing.T) {
+	schema, err := NewFilterSchema([]string{"name:string:=|like|not in", " age:int:>|<|BETWEEN", "active:bool"}, []string{"name", " age"}, 2)
+	require.NoError(t, err)
+	require.Equal(t, FilterField{Type: FilterString, Operators: []string{"=", "LIKE", "NOT IN"}}, schema.Fields["name"])
+	require.Equal(t, FilterField{Type: FilterInt, Operators: []string{">", "<", "BETWEEN"}}, schema.Fields["age"])
+	require.Equal(t, FilterField{Type: FilterBool, Operators: []string{"="}}, schema.Fields["active"])
+	require.Equal(t, []string{"name", "age"}, schema.Sorts)
+
+	_, err = NewFilterSchema([]string{"name"}, nil, 0)
+	require.Error(t, err)
+	_, err = NewFilterSchema([]string{"name:uuid"}, nil, 0)
+	require.Error(t, err)
+	_, err = NewFilterSchema([]string{"name:string:; DROP TABLE"}, nil, 0)
+	require.Error(t, err)
+}
+
+func TestFilterSchema_Validate(t *testing.T) {
+	schema, err := NewFilterSchema([]string{"name:string:=|LIKE|IN", "age:int:>|BETWEEN|IS", "created_at:time:>"}, []string{"name"}, 2)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		param      Parameter
+		violations []FilterViolation
+	}{
+		{
+			name:  "valid",
+			param: Parameter{Sort: "-name", Filters: []interface{}{[]interface{}{"name", "like", "jack"}, []interface{}{"and"}, []interface{}{"age", "between", []interface{}{float64(18), float64(30)}}}},
+		},
+		{
+			name:  "single",
+			param: Parameter{Filters: []interface{}{"name", "jack"}},
+		},
+		{
+			name:  "null",
+			param: Parameter{Filters: []interface{}{"age", nil}},
+		},
+		{
+			name:  "time",
+			param: Parameter{Filters: []interface{}{"created_at", ">", "2023-01-02"}},
+		},
+		{
+			name:       "sort",
+			param:      Parameter{Sort: "name,-age"},
+			violations: []FilterViolation{{Param: "sort", Field: "age", Reason: "sorting by age is not allowed"}},
+		},
+		{
+			name:       "field",
+			param:      Parameter{Filters: []interface{}{"password", "=", "123"}},
+			violations: []FilterViolation{{Param: "filters", Field: "password", Reason: "filtering by password is not allowed"}},
+		},
+		{
+			name:       "operator",
+			param:      Parameter{Filters: []interface{}{"age", "<", float64(1)}},
+			violations: []FilterViolation{{Param: "filters", Field: "age", Operator: "<", Reason: "operator < is not allowed on age"}},
+		},
+		{
+			name:       "type",
+			param:      Parameter{Filters: []interface{}{"age", ">", "old"}},
+			violations: []FilterViolation{{Param: "filters", Field: "age", Operator: ">", Reason: "value old of age should be int"}},
+		},
+		{
+			name:       "in",
+			param:      Parameter{Filters: []interface{}{"name", "in", "jack"}},
+			violations: []FilterViolation{{Param: "filters", Field: "name", Operator: "IN", Reason: "operator IN on name requires an array value"}},
+		},
+		{
+			name:       "logical",
+			param:      Parameter{Filters: []interface{}{[]interface{}{"name", "jack"}, []interface{}{"xor"}, []interface{}{"name", "rose"}}},
+			violations: []FilterViolation{{Param: "filters", Operator: "XOR", Reason: "logical operator xor is not allowed"}},
+		},
+		{
+			name: "depth",
+			param: Parameter{Filters: []interface{}{
+				[]interface{}{[]interface{}{[]interface{}{"name", "jack"}, []interface{}{"name", "rose"}}},
+			}},
+			violations: []FilterViolation{{Param: "filters", Reason: "filters are nested deeper than 2 levels"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := schema.Validate(tt.param)
+			if tt.violations == nil {
+				require.Nil(t, err)
+				return
+			}
+			require.NotNil(t, err)
+			require.Equal(t, tt.violations, err.Violations)
+		})
+	}
+}
+
+func TestValidateFilters(t *testing.T) {
+	type dtoParameter struct {
+		Page    string
+		Size    string
+		Sort    string
+		Order   string
+		Fields  string
+		Filters []interface{}
+	}
+	store := annotationStore{
+		"GetUsers": {
+			FilterAnnotation:      {"name:string:=|LIKE"},
+			SortAnnotation:        {"name"},
+			FilterDepthAnnotation: {"1"},
+		},
+	}
+	require.Nil(t, ValidateFilters(store, "GetUsers", dtoParameter{Sort: "name", Filters: []interface{}{"name", "jack"}}))
+	err := ValidateFilters(store, "GetUsers", dtoParameter{Sort: "id"})
+	require.NotNil(t, err)
+	require.Equal(t, "invalid pagination parameter: sorting by id is not allowed", err.Error())
+	require.Nil(t, ValidateFilters(store, "GetBooks", dtoParameter{Sort: "id"}))
+}
+
+func TestResponseFilterSchema(t *testing.T) {
+	db := setupCursorDB(t)
+	schema, err := NewFilterSchema([]string{"age:int"}, []string{"name"}, 0)
+	require.NoError(t, err)
+	pg := New(&Config{CursorSecret: []byte("secret"), FilterSchema: schema})
+
+	defer func() {
+		r := recover()
+		require.NotNil(t, r)
+		filterErr, ok := r.(*FilterError)
+		require.True(t, ok)
+		require.Equal(t, []FilterViolation{{Param: "sort", Field: "age", Reason: "sorting by age is not allowed"}}, filterErr.Violations)
+	}()
+
+	page := pg.With(db.Model(&cursorUser{})).Request(Parameter{Sort: "name", Filters: []interface{}{"age", float64(21)}}).Response(&[]cursorUser{})
+	require.EqualValues(t, 9, page.Total)
+
+	_, err = pg.With(db.Model(&cursorUser{})).Request(Parameter{Filters: []interface{}{"name", "user01"}}).CursorResponse(&[]cursorUser{})
+	require.IsType(t, &FilterError{}, err)
+
+	pg.With(db.Model(&cursorUser{})).Request(Parameter{Sort: "age"}).Response(&[]cursorUser{})
+}
@@ -22,6 +22,9 @@ type ResponseContext interface {
 	Cache(string) ResponseContext
 	Fields([]string) ResponseContext
 	Response(interface{}) Page
+	Cursor(string) ResponseContext
+	WithTotal() ResponseContext
+	CursorResponse(interface{}) (CursorPage, error)
 }
 
 // RequestContext interface
@@ -85,6 +88,8 @@ type resContext struct {
 	Parameter   Parameter
 	cachePrefix string
 	fieldList   []string
+	cursor      string
+	withTotal   bool
 }
 
 func (r *resContext) Cache(prefix string) ResponseContext {
@@ -97,29 +102,19 @@ func (r *resContext) Fields(fields []string) ResponseContext {
 	return r
 }
 
+// Response paginates by offset. If the request violates Config.FilterSchema, it panics with *FilterError,
+// which is responded as 400 with the violations as details by the recovery middleware of rest server.
 func (r resContext) Response(res interface{}) Page {
 	p := r.Pagination
 	query := r.Statement
-	p.Config = defaultConfig(p.Config)
-	p.Config.Statement = query.Statement
-	if p.Config.DefaultSize == 0 {
-		p.Config.DefaultSize = 10
-	}
+	r.prepareConfig()
 
-	if p.Config.FieldWrapper == "" && p.Config.ValueWrapper == "" {
-		defaultWrapper := "LOWER(%s)"
-		wrappers := map[string]string{
-			"sqlite":   defaultWrapper,
-			"mysql":    defaultWrapper,
-			"postgres": "LOWER((%s)::text)",
-		}
-		p.Config.FieldWrapper = defaultWrapper
-		if wrapper, ok := wrappers[query.Dialector.Name()]; ok {
-			p.Config.FieldWrapper = wrapper
+	page := Page{}
+	if nil != p.Config.FilterSchema {
+		if err := p.Config.FilterSchema.Validate(r.Parameter); err != nil {
+			panic(err)
 		}
 	}
-
-	page := Page{}
 	param := parameter(r.Parameter)
 	pr := parseRequest(&param, *p.Config)
 	causes := createCauses(pr)
@@ -142,36 +137,7 @@ func (r resContext) Response(res interface{}) Page {
 	}
 
 	dbs := query.Statement.DB.Session(&gorm.Session{NewDB: true})
-	var selects []string
-	if len(r.fieldList) > 0 {
-		if len(pr.Fields) > 0 && p.Config.FieldSelectorEnabled {
-			for i := range pr.Fields {
-				for j := range r.fieldList {
-					if r.fieldList[j] == pr.Fields[i] {
-						fname := query.Statement.Quote("s." + fieldName(pr.Fields[i]))
-						if !contains(selects, fname) {
-							selects = append(selects, fname)
-						}
-						break
-					}
-				}
-			}
-		} else {
-			for i := range r.fieldList {
-				fname := query.Statement.Quote("s." + fieldName(r.fieldList[i]))
-				if !contains(selects, fname) {
-					selects = append(selects, fname)
-				}
-			}
-		}
-	} else if len(pr.Fields) > 0 && p.Config.FieldSelectorEnabled {
-		for i := range pr.Fields {
-			fname := query.Statement.Quote("s." + fieldName(pr.Fields[i]))
-			if !contains(selects, fname) {
-				selects = append(selects, fname)
-			}
-		}
-	}
+	selects := r.selectFields(pr)
 
 	result := dbs.
 		Unscoped().
@@ -236,6 +202,65 @@ func (r resContext) Response(res interface{}) Page {
 	return page
 }
 
+func (r resContext) prepareConfig() {
+	p := r.Pagination
+	query := r.Statement
+	p.Config = defaultConfig(p.Config)
+	p.Config.Statement = query.Statement
+	if p.Config.DefaultSize == 0 {
+		p.Config.DefaultSize = 10
+	}
+
+	if p.Config.FieldWrapper == "" && p.Config.ValueWrapper == "" {
+		defaultWrapper := "LOWER(%s)"
+		wrappers := map[string]string{
+			"sqlite":   defaultWrapper,
+			"mysql":    defaultWrapper,
+			"postgres": "LOWER((%s)::text)",
+		}
+		p.Config.FieldWrapper = defaultWrapper
+		if wrapper, ok := wrappers[query.Dialector.Name()]; ok {
+			p.Config.FieldWrapper = wrapper
+		}
+	}
+}
+
+func (r resContext) selectFields(pr pageRequest) []string {
+	p := r.Pagination
+	query := r.Statement
+	var selects []string
+	if len(r.fieldList) > 0 {
+		if len(pr.Fields) > 0 && p.Config.FieldSelectorEnabled {
+			for i := range pr.Fields {
+				for j := range r.fieldList {
+					if r.fieldList[j] == pr.Fields[i] {
+						fname := query.Statement.Quote("s." + fieldName(pr.Fields[i]))
+						if !contains(selects, fname) {
+							selects = append(selects, fname)
+						}
+						break
+					}
+				}
+			}
+		} else {
+			for i := range r.fieldList {
+				fname := query.Statement.Quote("s." + fieldName(r.fieldList[i]))
+				if !contains(selects, fname) {
+					selects = append(selects, fname)
+				}
+			}
+		}
+	} else if len(pr.Fields) > 0 && p.Config.FieldSelectorEnabled {
+		for i := range pr.Fields {
+			fname := query.Statement.Quote("s." + fieldName(pr.Fields[i]))
+			if !contains(selects, fname) {
+				selects = append(selects, fname)
+			}
+		}
+	}
+	return selects
+}
+
 // New Pagination instance
 func New(params ...interface{}) *Pagination {
 	if len(params) >= 1 {
@@ -668,6 +693,9 @@ type Config struct {
 	FilterParams         []string
 	FieldsParams         []string
 	FieldSelectorEnabled bool
+	CursorSecret         []byte `json:"-"`
+	PrimaryKey           string
+	FilterSchema         *FilterSchema                          `json:"-"`
 	CacheAdapter         *gocache.AdapterInterface              `json:"-"`
 	JSONMarshal          func(v interface{}) ([]byte, error)    `json:"-"`
 	JSONUnmarshal        func(data []byte, v interface{}) error `json:"-"`
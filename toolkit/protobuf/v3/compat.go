@@ -0,0 +1,589 @@
+package v3
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/iancoleman/strcase"
+	"github.com/pkg/errors"
+)
+
+// Schema is the wire relevant part of a proto file: field numbers and types of messages,
+// values of enums and signatures of rpcs. It is used to keep field numbers stable across
+// regenerations and to detect breaking changes.
+type Schema struct {
+	// Messages is keyed by message name, nested messages are qualified by parent name, e.g. Outer.Inner
+	Messages map[string]*MessageSchema
+	Enums    map[string]*EnumSchema
+	Rpcs     map[string]RpcSchema
+}
+
+type MessageSchema struct {
+	Fields        []FieldSchema
+	Reserved      []int
+	ReservedNames []string
+}
+
+type FieldSchema struct {
+	Name   string
+	Type   string
+	Number int
+}
+
+type EnumSchema struct {
+	Values        map[string]int
+	Reserved      []int
+	ReservedNames []string
+}
+
+type RpcSchema struct {
+	Request  string
+	Response string
+}
+
+func newSchema() *Schema {
+	return &Schema{
+		Messages: make(map[string]*MessageSchema),
+		Enums:    make(map[string]*EnumSchema),
+		Rpcs:     make(map[string]RpcSchema),
+	}
+}
+
+var (
+	commentre  = regexp.MustCompile(`(?s)/\*.*?\*/|//[^\n]*`)
+	optionre   = regexp.MustCompile(`\[[^\]]*\]`)
+	fieldre    = regexp.MustCompile(`^(.+?)\s+(\w+)\s*=\s*(\d+)$`)
+	enumValre  = regexp.MustCompile(`^(\w+)\s*=\s*(-?\d+)$`)
+	rpcre      = regexp.MustCompile(`^rpc\s+(\w+)\s*\(\s*(.+?)\s*\)\s*returns\s*\(\s*(.+?)\s*\)$`)
+	spaceAfter = regexp.MustCompile(`\s*([<>,])\s*`)
+)
+
+// normalizeType makes type names comparable regardless of whitespace, e.g. map<string,int32>.
+// Label optional is dropped, as adding or removing it is wire compatible.
+func normalizeType(t string) string {
+	t = strings.Join(strings.Fields(t), " ")
+	t = strings.TrimPrefix(t, "optional ")
+	return spaceAfter.ReplaceAllString(t, "$1")
+}
+
+// fieldKey matches fields across naming strategies, e.g. userId and user_id
+func fieldKey(name string) string {
+	return strings.ToLower(strings.ReplaceAll(name, "_", ""))
+}
+
+type scope struct {
+	kind string
+	name string
+}
+
+// ParseSchema parses a proto3 file content generated by go-doudou into Schema.
+// Options, imports and comments are ignored, oneof fields belong to the enclosing message.
+func ParseSchema(content string) (*Schema, error) {
+	schema := newSchema()
+	content = commentre.ReplaceAllString(content, "")
+	var (
+		stack []scope
+		buf   strings.Builder
+	)
+	current := func() scope {
+		if len(stack) == 0 {
+			return scope{}
+		}
+		return stack[len(stack)-1]
+	}
+	// message returns the innermost message scope, oneof is transparent
+	message := func() string {
+		for i := len(stack) - 1; i >= 0; i-- {
+			if stack[i].kind == "message" {
+				return stack[i].name
+			}
+			if stack[i].kind != "oneof" {
+				return ""
+			}
+		}
+		return ""
+	}
+	inString := false
+	for _, r := range content {
+		if r == '"' {
+			inString = !inString
+		}
+		if inString || (r != '{' && r != '}' && r != ';') {
+			buf.WriteRune(r)
+			continue
+		}
+		stmt := strings.Join(strings.Fields(optionre.ReplaceAllString(buf.String(), "")), " ")
+		buf.Reset()
+		switch r {
+		case '{':
+			words := strings.Fields(stmt)
+			if len(words) < 2 {
+				stack = append(stack, scope{kind: "other"})
+				continue
+			}
+			switch words[0] {
+			case "message":
+				name := words[1]
+				if parent := message(); parent != "" {
+					name = parent + "." + name
+				}
+				schema.Messages[name] = &MessageSchema{}
+				stack = append(stack, scope{kind: "message", name: name})
+			case "enum":
+				schema.Enums[words[1]] = &EnumSchema{Values: make(map[string]int)}
+				stack = append(stack, scope{kind: "enum", name: words[1]})
+			case "oneof", "service":
+				stack = append(stack, scope{kind: words[0], name: words[1]})
+			case "rpc":
+				if err := parseRpc(schema, stmt); err != nil {
+					return nil, err
+				}
+				stack = append(stack, scope{kind: "other"})
+			default:
+				stack = append(stack, scope{kind: "other"})
+			}
+		case '}':
+			if len(stack) == 0 {
+				return nil, errors.New("unbalanced braces")
+			}
+			stack = stack[:len(stack)-1]
+		case ';':
+			if stmt == "" {
+				continue
+			}
+			var err error
+			switch sc := current(); sc.kind {
+			case "message", "oneof":
+				if name := message(); name != "" {
+					err = parseField(schema.Messages[name], stmt)
+				}
+			case "enum":
+				err = parseEnumValue(schema.Enums[sc.name], stmt)
+			case "service":
+				err = parseRpc(schema, stmt)
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	if len(stack) > 0 {
+		return nil, errors.New("unbalanced braces")
+	}
+	return schema, nil
+}
+
+func parseReserved(stmt string) (numbers []int, names []string, err error) {
+	for _, item := range strings.Split(strings.TrimPrefix(stmt, "reserved"), ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if strings.HasPrefix(item, `"`) {
+			names = append(names, strings.Trim(item, `"`))
+			continue
+		}
+		if bounds := strings.Split(item, " to "); len(bounds) == 2 {
+			from, err := strconv.Atoi(strings.TrimSpace(bounds[0]))
+			if err != nil {
+				return nil, nil, errors.Errorf("invalid reserved range %q", item)
+			}
+			to, err := strconv.Atoi(strings.TrimSpace(bounds[1]))
+			if err != nil {
+				return nil, nil, errors.Errorf("invalid reserved range %q", item)
+			}
+			for i := from; i <= to; i++ {
+				numbers = append(numbers, i)
+			}
+			continue
+		}
+		n, err := strconv.Atoi(item)
+		if err != nil {
+			return nil, nil, errors.Errorf("invalid reserved number %q", item)
+		}
+		numbers = append(numbers, n)
+	}
+	return
+}
+
+func parseField(m *MessageSchema, stmt string) error {
+	if strings.HasPrefix(stmt, "reserved ") {
+		numbers, names, err := parseReserved(stmt)
+		if err != nil {
+			return err
+		}
+		m.Reserved = append(m.Reserved, numbers...)
+		m.ReservedNames = append(m.ReservedNames, names...)
+		return nil
+	}
+	if strings.HasPrefix(stmt, "option ") {
+		return nil
+	}
+	matches := fieldre.FindStringSubmatch(stmt)
+	if matches == nil {
+		return errors.Errorf("invalid field definition %q", stmt)
+	}
+	number, _ := strconv.Atoi(matches[3])
+	m.Fields = append(m.Fields, FieldSchema{
+		Name:   matches[2],
+		Type:   normalizeType(matches[1]),
+		Number: number,
+	})
+	return nil
+}
+
+func parseEnumValue(e *EnumSchema, stmt string) error {
+	if strings.HasPrefix(stmt, "reserved ") {
+		numbers, names, err := parseReserved(stmt)
+		if err != nil {
+			return err
+		}
+		e.Reserved = append(e.Reserved, numbers...)
+		e.ReservedNames = append(e.ReservedNames, names...)
+		return nil
+	}
+	if strings.HasPrefix(stmt, "option ") {
+		return nil
+	}
+	matches := enumValre.FindStringSubmatch(stmt)
+	if matches == nil {
+		return errors.Errorf("invalid enum value definition %q", stmt)
+	}
+	number, _ := strconv.Atoi(matches[2])
+	e.Values[matches[1]] = number
+	return nil
+}
+
+func parseRpc(schema *Schema, stmt string) error {
+	if strings.HasPrefix(stmt, "option ") {
+		return nil
+	}
+	matches := rpcre.FindStringSubmatch(stmt)
+	if matches == nil {
+		return errors.Errorf("invalid rpc definition %q", stmt)
+	}
+	schema.Rpcs[matches[1]] = RpcSchema{
+		Request:  normalizeType(matches[2]),
+		Response: normalizeType(matches[3]),
+	}
+	return nil
+}
+
+// SchemaOf returns Schema of service to be generated
+func SchemaOf(service Service) *Schema {
+	schema := newSchema()
+	for _, m := range service.Messages {
+		messageSchemaOf(schema, m, m.Name)
+	}
+	for _, e := range service.Enums {
+		es := &EnumSchema{
+			Values:        make(map[string]int),
+			Reserved:      e.Reserved,
+			ReservedNames: e.ReservedNames,
+		}
+		for _, f := range e.Fields {
+			es.Values[f.Name] = f.Number
+		}
+		schema.Enums[e.Name] = es
+	}
+	for _, r := range service.Rpcs {
+		schema.Rpcs[r.Name] = RpcSchema{
+			Request:  normalizeType(r.Request.Name),
+			Response: normalizeType(r.Response.Name),
+		}
+	}
+	return schema
+}
+
+func messageSchemaOf(schema *Schema, m Message, name string) {
+	ms := &MessageSchema{
+		Reserved:      m.Reserved,
+		ReservedNames: m.ReservedNames,
+	}
+	for _, f := range m.Fields {
+		ms.Fields = append(ms.Fields, FieldSchema{
+			Name:   f.Name,
+			Type:   normalizeType(f.Type.GetName()),
+			Number: f.Number,
+		})
+		if f.Type.Inner() {
+			inner := f.Type.(Message)
+			messageSchemaOf(schema, inner, name+"."+inner.Name)
+		}
+	}
+	schema.Messages[name] = ms
+}
+
+// Stabilize renumbers fields and enum values of service to the numbers recorded in previous schema,
+// matching fields by name. New fields take numbers never used before, and numbers and names of
+// removed fields are reserved, so that the generated proto stays wire compatible with deployed clients.
+func (s *Schema) Stabilize(service *Service) {
+	if s == nil {
+		return
+	}
+	for i := range service.Messages {
+		s.stabilizeMessage(&service.Messages[i], service.Messages[i].Name)
+	}
+	for i := range service.Enums {
+		s.stabilizeEnum(&service.Enums[i])
+	}
+}
+
+func (s *Schema) stabilizeMessage(m *Message, name string) {
+	for i := range m.Fields {
+		if m.Fields[i].Type.Inner() {
+			inner := m.Fields[i].Type.(Message)
+			s.stabilizeMessage(&inner, name+"."+inner.Name)
+			m.Fields[i].Type = inner
+		}
+	}
+	prev, ok := s.Messages[name]
+	if !ok {
+		return
+	}
+	numbers := make(map[string]int)
+	next := 1
+	for _, f := range prev.Fields {
+		numbers[fieldKey(f.Name)] = f.Number
+		if f.Number >= next {
+			next = f.Number + 1
+		}
+	}
+	for _, n := range prev.Reserved {
+		if n >= next {
+			next = n + 1
+		}
+	}
+	present := make(map[string]struct{})
+	for i := range m.Fields {
+		key := fieldKey(m.Fields[i].Name)
+		present[key] = struct{}{}
+		if n, ok := numbers[key]; ok {
+			m.Fields[i].Number = n
+			continue
+		}
+		m.Fields[i].Number = next
+		next++
+	}
+	reserved := append([]int(nil), prev.Reserved...)
+	var reservedNames []string
+	for _, item := range prev.ReservedNames {
+		// a removed field is added back, it gets a new number as its type may be different
+		if _, ok := present[fieldKey(item)]; !ok {
+			reservedNames = append(reservedNames, item)
+		}
+	}
+	for _, f := range prev.Fields {
+		if _, ok := present[fieldKey(f.Name)]; !ok {
+			reserved = append(reserved, f.Number)
+			reservedNames = append(reservedNames, f.Name)
+		}
+	}
+	m.Reserved = uniqueInts(reserved)
+	m.ReservedNames = uniqueStrings(reservedNames)
+}
+
+func (s *Schema) stabilizeEnum(e *Enum) {
+	prev, ok := s.Enums[e.Name]
+	if !ok {
+		return
+	}
+	next := 0
+	for _, n := range prev.Values {
+		if n >= next {
+			next = n + 1
+		}
+	}
+	for _, n := range prev.Reserved {
+		if n >= next {
+			next = n + 1
+		}
+	}
+	present := make(map[string]struct{})
+	for i := range e.Fields {
+		present[e.Fields[i].Name] = struct{}{}
+		if n, ok := prev.Values[e.Fields[i].Name]; ok {
+			e.Fields[i].Number = n
+			continue
+		}
+		e.Fields[i].Number = next
+		next++
+	}
+	if !hasZeroValue(e.Fields) {
+		// the zero value is removed, keep an unspecified placeholder in its place
+		placeholder := strings.ToUpper(strcase.ToSnake(e.Name)) + "_UNSPECIFIED"
+		present[placeholder] = struct{}{}
+		e.Fields = append(e.Fields, EnumField{Name: placeholder})
+	}
+	var reserved []int
+	for _, n := range prev.Reserved {
+		if n != 0 {
+			reserved = append(reserved, n)
+		}
+	}
+	var reservedNames []string
+	for _, item := range prev.ReservedNames {
+		if _, ok := present[item]; !ok {
+			reservedNames = append(reservedNames, item)
+		}
+	}
+	for name, n := range prev.Values {
+		if _, ok := present[name]; !ok {
+			if n != 0 {
+				reserved = append(reserved, n)
+			}
+			reservedNames = append(reservedNames, name)
+		}
+	}
+	// the first value of proto3 enum must be zero
+	sort.SliceStable(e.Fields, func(i, j int) bool {
+		return e.Fields[i].Number < e.Fields[j].Number
+	})
+	e.Reserved = uniqueInts(reserved)
+	e.ReservedNames = uniqueStrings(reservedNames)
+}
+
+func hasZeroValue(fields []EnumField) bool {
+	for _, f := range fields {
+		if f.Number == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func uniqueInts(items []int) []int {
+	if len(items) == 0 {
+		return nil
+	}
+	sort.Ints(items)
+	ret := items[:1]
+	for _, item := range items[1:] {
+		if item != ret[len(ret)-1] {
+			ret = append(ret, item)
+		}
+	}
+	return ret
+}
+
+func uniqueStrings(items []string) []string {
+	if len(items) == 0 {
+		return nil
+	}
+	sort.Strings(items)
+	ret := items[:1]
+	for _, item := range items[1:] {
+		if item != ret[len(ret)-1] {
+			ret = append(ret, item)
+		}
+	}
+	return ret
+}
+
+// BreakingChanges returns wire incompatible changes from s to next, such as renumbered or retyped fields,
+// reused field numbers, and removed or changed rpcs. Removed messages and fields whose numbers
+// are reserved are not breaking.
+func (s *Schema) BreakingChanges(next *Schema) []string {
+	var changes []string
+	for name, prev := range s.Messages {
+		cur, ok := next.Messages[name]
+		if !ok {
+			continue
+		}
+		changes = append(changes, messageChanges(name, prev, cur)...)
+	}
+	for name, prev := range s.Enums {
+		cur, ok := next.Enums[name]
+		if !ok {
+			continue
+		}
+		changes = append(changes, enumChanges(name, prev, cur)...)
+	}
+	for name, prev := range s.Rpcs {
+		cur, ok := next.Rpcs[name]
+		if !ok {
+			changes = append(changes, fmt.Sprintf("rpc %s is removed", name))
+			continue
+		}
+		if cur.Request != prev.Request {
+			changes = append(changes, fmt.Sprintf("request of rpc %s is changed from %s to %s", name, prev.Request, cur.Request))
+		}
+		if cur.Response != prev.Response {
+			changes = append(changes, fmt.Sprintf("response of rpc %s is changed from %s to %s", name, prev.Response, cur.Response))
+		}
+	}
+	sort.Strings(changes)
+	return changes
+}
+
+func messageChanges(name string, prev, cur *MessageSchema) []string {
+	var changes []string
+	byKey := make(map[string]FieldSchema)
+	byNumber := make(map[int]FieldSchema)
+	for _, f := range cur.Fields {
+		byKey[fieldKey(f.Name)] = f
+		byNumber[f.Number] = f
+	}
+	reserved := make(map[int]struct{})
+	for _, n := range cur.Reserved {
+		reserved[n] = struct{}{}
+	}
+	for _, f := range prev.Fields {
+		if c, ok := byKey[fieldKey(f.Name)]; ok {
+			if c.Number != f.Number {
+				changes = append(changes, fmt.Sprintf("field %s.%s is renumbered from %d to %d", name, f.Name, f.Number, c.Number))
+			}
+			if c.Type != f.Type {
+				changes = append(changes, fmt.Sprintf("type of field %s.%s is changed from %s to %s", name, f.Name, f.Type, c.Type))
+			}
+			continue
+		}
+		if c, ok := byNumber[f.Number]; ok {
+			changes = append(changes, fmt.Sprintf("number %d of removed field %s.%s is reused by field %s", f.Number, name, f.Name, c.Name))
+			continue
+		}
+		if _, ok := reserved[f.Number]; !ok {
+			changes = append(changes, fmt.Sprintf("field %s.%s is removed without reserving number %d", name, f.Name, f.Number))
+		}
+	}
+	for _, n := range prev.Reserved {
+		if c, ok := byNumber[n]; ok {
+			changes = append(changes, fmt.Sprintf("reserved number %d of message %s is reused by field %s", n, name, c.Name))
+		}
+	}
+	return changes
+}
+
+func enumChanges(name string, prev, cur *EnumSchema) []string {
+	var changes []string
+	byNumber := make(map[int]string)
+	for value, n := range cur.Values {
+		byNumber[n] = value
+	}
+	reserved := make(map[int]struct{})
+	for _, n := range cur.Reserved {
+		reserved[n] = struct{}{}
+	}
+	for value, n := range prev.Values {
+		if c, ok := cur.Values[value]; ok {
+			if c != n {
+				changes = append(changes, fmt.Sprintf("value %s.%s is renumbered from %d to %d", name, value, n, c))
+			}
+			continue
+		}
+		if c, ok := byNumber[n]; ok {
+			changes = append(changes, fmt.Sprintf("number %d of removed value %s.%s is reused by value %s", n, name, value, c))
+			continue
+		}
+		if _, ok := reserved[n]; !ok {
+			changes = append(changes, fmt.Sprintf("value %s.%s is removed without reserving number %d", name, value, n))
+		}
+	}
+	if _, ok := byNumber[0]; !ok && len(cur.Values) > 0 {
+		changes = append(changes, fmt.Sprintf("enum %s has no zero value", name))
+	}
+	return changes
+}
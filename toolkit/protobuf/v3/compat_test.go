@@ -0,0 +1,172 @@
+package v3
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const previousProto = `/**
+* Generated by go-doudou v2.0.0.
+* Don't edit!
+*/
+syntax = "proto3";
+
+package usersvc;
+option go_package = "testsvc/transport/grpc";
+
+import "google/protobuf/empty.proto";
+
+enum Status {
+  ACTIVE = 0;
+  LOCKED = 1;
+  reserved 2;
+  reserved "DELETED";
+}
+
+// User is a user
+message User {
+  int32 id = 1 [json_name="id"];
+  string name = 2 [json_name="name"];
+  map<string, int32> scores = 4 [json_name="scores"];
+  message Address {
+    string city = 1 [json_name="city"];
+  }
+  Address address = 5 [json_name="address"];
+  reserved 3;
+  reserved "age";
+}
+
+service UsersvcService {
+  // GetUserRpc gets user
+  rpc GetUserRpc(User) returns (User);
+  rpc DeleteUserRpc(User) returns (google.protobuf.Empty);
+}
+`
+
+func TestParseSchema(t *testing.T) {
+	schema, err := ParseSchema(previousProto)
+	require.NoError(t, err)
+	require.Equal(t, &MessageSchema{
+		Fields: []FieldSchema{
+			{Name: "id", Type: "int32", Number: 1},
+			{Name: "name", Type: "string", Number: 2},
+			{Name: "scores", Type: "map<string,int32>", Number: 4},
+			{Name: "address", Type: "Address", Number: 5},
+		},
+		Reserved:      []int{3},
+		ReservedNames: []string{"age"},
+	}, schema.Messages["User"])
+	require.Equal(t, []FieldSchema{{Name: "city", Type: "string", Number: 1}}, schema.Messages["User.Address"].Fields)
+	require.Equal(t, map[string]int{"ACTIVE": 0, "LOCKED": 1}, schema.Enums["Status"].Values)
+	require.Equal(t, RpcSchema{Request: "User", Response: "google.protobuf.Empty"}, schema.Rpcs["DeleteUserRpc"])
+
+	_, err = ParseSchema("message User { int32 id = 1;")
+	require.Error(t, err)
+
+	schema, err = ParseSchema(`message Owner {
+  optional string name = 1;
+  oneof pet {
+    Cat pet_cat = 2;
+    Dog pet_dog = 3;
+  }
+}`)
+	require.NoError(t, err)
+	require.Equal(t, []FieldSchema{
+		{Name: "name", Type: "string", Number: 1},
+		{Name: "pet_cat", Type: "Cat", Number: 2},
+		{Name: "pet_dog", Type: "Dog", Number: 3},
+	}, schema.Messages["Owner"].Fields)
+}
+
+func TestStabilize(t *testing.T) {
+	prev, err := ParseSchema(previousProto)
+	require.NoError(t, err)
+	address := Message{Name: "Address", IsInner: true, Fields: []Field{
+		{Name: "street", Type: String, Number: 1},
+		{Name: "city", Type: String, Number: 2},
+	}}
+	user := Message{Name: "User", IsTopLevel: true, Fields: []Field{
+		// fields are reordered, renamed to snake case, removed and added
+		{Name: "address", Type: address, Number: 1},
+		{Name: "email", Type: String, Number: 2},
+		{Name: "ID", Type: Int32, Number: 3},
+		{Name: "age", Type: Int32, Number: 4},
+	}}
+	service := Service{
+		Messages: []Message{user},
+		Enums: []Enum{{Name: "Status", Fields: []EnumField{
+			{Name: "LOCKED", Number: 0},
+			{Name: "ACTIVE", Number: 1},
+			{Name: "BANNED", Number: 2},
+		}}},
+		Rpcs: []Rpc{{Name: "GetUserRpc", Request: user, Response: user}},
+	}
+	prev.Stabilize(&service)
+
+	got := service.Messages[0]
+	numbers := make(map[string]int)
+	for _, f := range got.Fields {
+		numbers[f.Name] = f.Number
+	}
+	require.Equal(t, map[string]int{"address": 5, "email": 6, "ID": 1, "age": 7}, numbers)
+	require.Equal(t, []int{2, 3, 4}, got.Reserved)
+	require.Equal(t, []string{"name", "scores"}, got.ReservedNames)
+	inner := got.Fields[0].Type.(Message)
+	require.Equal(t, 2, inner.Fields[0].Number)
+	require.Equal(t, 1, inner.Fields[1].Number)
+
+	require.Equal(t, []EnumField{{Name: "ACTIVE", Number: 0}, {Name: "LOCKED", Number: 1}, {Name: "BANNED", Number: 3}}, service.Enums[0].Fields)
+	require.Equal(t, []int{2}, service.Enums[0].Reserved)
+	require.Equal(t, []string{"DELETED"}, service.Enums[0].ReservedNames)
+
+	require.Equal(t, []string{"rpc DeleteUserRpc is removed"}, prev.BreakingChanges(SchemaOf(service)))
+}
+
+func TestStabilizeZeroValueRemoved(t *testing.T) {
+	prev, err := ParseSchema(previousProto)
+	require.NoError(t, err)
+	service := Service{
+		Enums: []Enum{{Name: "Status", Fields: []EnumField{
+			{Name: "LOCKED", Number: 0},
+		}}},
+	}
+	prev.Stabilize(&service)
+
+	require.Equal(t, []EnumField{{Name: "STATUS_UNSPECIFIED", Number: 0}, {Name: "LOCKED", Number: 1}}, service.Enums[0].Fields)
+	require.Equal(t, []int{2}, service.Enums[0].Reserved)
+	require.Equal(t, []string{"ACTIVE", "DELETED"}, service.Enums[0].ReservedNames)
+}
+
+func TestBreakingChanges(t *testing.T) {
+	prev, err := ParseSchema(previousProto)
+	require.NoError(t, err)
+	next, err := ParseSchema(`
+enum Status {
+  LOCKED = 0;
+  ACTIVE = 1;
+}
+message User {
+  int64 id = 1;
+  string name = 3;
+  string email = 2;
+  message Address {
+    string city = 1;
+  }
+  Address address = 5;
+}
+service UsersvcService {
+  rpc GetUserRpc(User) returns (stream User);
+  rpc DeleteUserRpc(User) returns (google.protobuf.Empty);
+}`)
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"field User.name is renumbered from 2 to 3",
+		"field User.scores is removed without reserving number 4",
+		"reserved number 3 of message User is reused by field name",
+		"response of rpc GetUserRpc is changed from User to stream User",
+		"type of field User.id is changed from int32 to int64",
+		"value Status.ACTIVE is renumbered from 0 to 1",
+		"value Status.LOCKED is renumbered from 1 to 0",
+	}, prev.BreakingChanges(next))
+}
@@ -30,21 +30,42 @@ var ImportStore = make(map[string]struct{})
 
 var MessageNames []string
 
+// OneofStore holds sealed interfaces annotated by @oneof, keyed by interface name
+var OneofStore = make(map[string]Oneof)
+
+// Oneof represents a sealed interface, fields of which are generated as oneof of its implementations
+type Oneof struct {
+	Name string
+	// Members are go types of implementations, prefixed by * if they implement the interface by pointer receivers
+	Members []string
+	// GoPackage is import path of the package the interface is declared in
+	GoPackage string
+}
+
 type EnumField struct {
 	Name   string
 	Number int
+	// GoName is name of the go constant the value is generated from, empty for the placeholder of a removed zero value
+	GoName string
 }
 
 func (receiver ProtoGenerator) newEnumField(field string, index int) EnumField {
 	return EnumField{
 		Name:   strings.ToUpper(strcase.ToSnake(field)),
 		Number: index,
+		GoName: field,
 	}
 }
 
 type Enum struct {
 	Name   string
 	Fields []EnumField
+	// Reserved and ReservedNames are numbers and names of removed values
+	Reserved      []int
+	ReservedNames []string
+	// GoPackage and GoName locate the go type the enum is generated from
+	GoPackage string
+	GoName    string
 }
 
 func (e Enum) Inner() bool {
@@ -67,6 +88,7 @@ func (receiver ProtoGenerator) NewEnum(enumMeta astutils.EnumMeta) Enum {
 	return Enum{
 		Name:   strcase.ToCamel(enumMeta.Name),
 		Fields: fields,
+		GoName: enumMeta.Name,
 	}
 }
 
@@ -82,6 +104,35 @@ type Message struct {
 	IsTopLevel bool
 	// IsImported denotes the message will be imported from third-party, such as from google/protobuf
 	IsImported bool
+	// Reserved and ReservedNames are numbers and names of removed fields
+	Reserved      []int
+	ReservedNames []string
+	// GoPackage and GoName locate the go struct the message is generated from,
+	// they are empty for messages not generated from structs in vo and dto packages
+	GoPackage string
+	GoName    string
+}
+
+// FieldGroup is either fields of a oneof or a single field not in any oneof
+type FieldGroup struct {
+	Oneof  string
+	Fields []Field
+}
+
+// FieldGroups groups fields of the same oneof in declaration order
+func (m Message) FieldGroups() []FieldGroup {
+	var groups []FieldGroup
+	for _, f := range m.Fields {
+		if f.Oneof != "" && len(groups) > 0 && groups[len(groups)-1].Oneof == f.Oneof {
+			groups[len(groups)-1].Fields = append(groups[len(groups)-1].Fields, f)
+			continue
+		}
+		groups = append(groups, FieldGroup{
+			Oneof:  f.Oneof,
+			Fields: []Field{f},
+		})
+	}
+	return groups
 }
 
 func (m Message) Inner() bool {
@@ -106,14 +157,23 @@ func (m Message) String() string {
 // NewMessage returns message instance from astutils.StructMeta
 func (receiver ProtoGenerator) NewMessage(structmeta astutils.StructMeta) Message {
 	var fields []Field
-	for i, field := range structmeta.Fields {
-		fields = append(fields, receiver.newField(field, i+1))
+	number := 1
+	for _, field := range structmeta.Fields {
+		if oneof, ok := oneofOf(field.Type); ok {
+			members := receiver.newOneofFields(field, oneof, number)
+			fields = append(fields, members...)
+			number += len(members)
+			continue
+		}
+		fields = append(fields, receiver.newField(field, number))
+		number++
 	}
 	return Message{
 		Name:       strcase.ToCamel(structmeta.Name),
 		Fields:     fields,
 		Comments:   structmeta.Comments,
 		IsTopLevel: true,
+		GoName:     structmeta.Name,
 	}
 }
 
@@ -124,6 +184,14 @@ type Field struct {
 	Number   int
 	Comments []string
 	JsonName string
+	// Optional denotes proto3 optional field generated from pointer to scalar or enum
+	Optional bool
+	// Oneof is name of the oneof the field belongs to
+	Oneof string
+	// GoName and GoType are name and type of the go struct field the proto field is generated from,
+	// GoType of oneof fields is the implementation type
+	GoName string
+	GoType string
 }
 
 func (receiver ProtoGenerator) newField(field astutils.FieldMeta, index int) Field {
@@ -134,13 +202,63 @@ func (receiver ProtoGenerator) newField(field astutils.FieldMeta, index int) Fie
 		t = message
 	}
 	fieldName := receiver.fieldNamingFunc(field.Name)
-	return Field{
+	f := Field{
 		Name:     fieldName,
 		Type:     t,
 		Number:   index,
 		Comments: field.Comments,
 		JsonName: fieldName,
+		GoName:   field.Name,
+		GoType:   field.Type,
+	}
+	if strings.HasPrefix(field.Type, "*") {
+		// keep nil distinguishable from zero value
+		switch pt := t.(type) {
+		case Message:
+			if wrapper, ok := wrapperTypes[pt.Name]; ok {
+				if receiver.wrapperTypes {
+					ImportStore["google/protobuf/wrappers.proto"] = struct{}{}
+					f.Type = wrapper
+				} else {
+					f.Optional = true
+				}
+			}
+		case Enum:
+			f.Optional = true
+		}
 	}
+	return f
+}
+
+// oneofOf returns the sealed interface of field type if any
+func oneofOf(ft string) (Oneof, bool) {
+	ft = strings.TrimLeft(ft, "*")
+	oneof, ok := OneofStore[ft[strings.LastIndex(ft, ".")+1:]]
+	return oneof, ok
+}
+
+// newOneofFields returns a field for each implementation of the sealed interface, all of them belong to
+// the oneof named after the go struct field
+func (receiver ProtoGenerator) newOneofFields(field astutils.FieldMeta, oneof Oneof, index int) []Field {
+	var fields []Field
+	for i, member := range oneof.Members {
+		name := strings.TrimPrefix(member, "*")
+		fieldName := receiver.fieldNamingFunc(field.Name + strcase.ToCamel(name))
+		f := Field{
+			Name:     fieldName,
+			Type:     receiver.MessageOf(name),
+			Number:   index + i,
+			JsonName: fieldName,
+			Oneof:    receiver.fieldNamingFunc(field.Name),
+			GoName:   field.Name,
+			GoType:   member,
+		}
+		if i == 0 {
+			f.Comments = field.Comments
+		}
+		fields = append(fields, f)
+	}
+	return fields
 }
 
 var (
@@ -194,8 +312,24 @@ var (
 		Name:     "google.protobuf.Timestamp",
 		IsScalar: true,
 	}
+	Duration = Message{
+		Name: "google.protobuf.Duration",
+	}
 )
 
+// wrapperTypes maps scalar types to corresponding well-known wrapper types
+var wrapperTypes = map[string]Message{
+	Double.Name: {Name: "google.protobuf.DoubleValue"},
+	Float.Name:  {Name: "google.protobuf.FloatValue"},
+	Int64.Name:  {Name: "google.protobuf.Int64Value"},
+	Uint64.Name: {Name: "google.protobuf.UInt64Value"},
+	Int32.Name:  {Name: "google.protobuf.Int32Value"},
+	Uint32.Name: {Name: "google.protobuf.UInt32Value"},
+	Bool.Name:   {Name: "google.protobuf.BoolValue"},
+	String.Name: {Name: "google.protobuf.StringValue"},
+	Bytes.Name:  {Name: "google.protobuf.BytesValue"},
+}
+
 func (receiver ProtoGenerator) MessageOf(ft string) ProtobufType {
 	if astutils.IsVarargs(ft) {
 		ft = astutils.ToSlice(ft)
@@ -224,6 +358,9 @@ func (receiver ProtoGenerator) MessageOf(ft string) ProtobufType {
 		//ImportStore["google/protobuf/timestamp.proto"] = struct{}{}
 		//return Time
 		return String
+	case "time.Duration":
+		ImportStore["google/protobuf/duration.proto"] = struct{}{}
+		return Duration
 	default:
 		return receiver.handleDefaultCase(ft)
 	}
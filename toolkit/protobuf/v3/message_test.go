@@ -0,0 +1,67 @@
+package v3
+
+import (
+	"testing"
+
+	"github.com/iancoleman/strcase"
+	"github.com/stretchr/testify/require"
+	"github.com/unionj-cloud/go-doudou/v2/toolkit/astutils"
+)
+
+func resetStores(t *testing.T) {
+	t.Cleanup(func() {
+		MessageStore = make(map[string]Message)
+		EnumStore = make(map[string]Enum)
+		ImportStore = make(map[string]struct{})
+		OneofStore = make(map[string]Oneof)
+		MessageNames = nil
+	})
+}
+
+func TestNewMessage(t *testing.T) {
+	resetStores(t)
+	MessageNames = []string{"Cat", "Dog"}
+	EnumStore["Color"] = Enum{Name: "Color"}
+	OneofStore["Animal"] = Oneof{Name: "Animal", Members: []string{"Cat", "*Dog"}}
+	p := NewProtoGenerator(WithFieldNamingFunc(strcase.ToLowerCamel))
+	message := p.NewMessage(astutils.StructMeta{
+		Name: "Owner",
+		Fields: []astutils.FieldMeta{
+			{Name: "Name", Type: "*string"},
+			{Name: "Pet", Type: "Animal", Comments: []string{"Pet is a cat or a dog"}},
+			{Name: "Color", Type: "*Color"},
+			{Name: "Timeout", Type: "time.Duration"},
+			{Name: "Friend", Type: "*Cat"},
+		},
+	})
+	require.Equal(t, []Field{
+		{Name: "name", Type: String, Number: 1, JsonName: "name", Optional: true, GoName: "Name", GoType: "*string"},
+		{Name: "petCat", Type: Message{Name: "Cat", IsTopLevel: true}, Number: 2, JsonName: "petCat", Comments: []string{"Pet is a cat or a dog"}, Oneof: "pet", GoName: "Pet", GoType: "Cat"},
+		{Name: "petDog", Type: Message{Name: "Dog", IsTopLevel: true}, Number: 3, JsonName: "petDog", Oneof: "pet", GoName: "Pet", GoType: "*Dog"},
+		{Name: "color", Type: Enum{Name: "Color"}, Number: 4, JsonName: "color", Optional: true, GoName: "Color", GoType: "*Color"},
+		{Name: "timeout", Type: Duration, Number: 5, JsonName: "timeout", GoName: "Timeout", GoType: "time.Duration"},
+		{Name: "friend", Type: Message{Name: "Cat", IsTopLevel: true}, Number: 6, JsonName: "friend", GoName: "Friend", GoType: "*Cat"},
+	}, message.Fields)
+	require.Contains(t, ImportStore, "google/protobuf/duration.proto")
+
+	groups := message.FieldGroups()
+	require.Len(t, groups, 5)
+	require.Equal(t, "pet", groups[1].Oneof)
+	require.Len(t, groups[1].Fields, 2)
+}
+
+func TestNewMessageWrapperTypes(t *testing.T) {
+	resetStores(t)
+	p := NewProtoGenerator(WithFieldNamingFunc(strcase.ToLowerCamel), WithWrapperTypes(true))
+	message := p.NewMessage(astutils.StructMeta{
+		Name: "Owner",
+		Fields: []astutils.FieldMeta{
+			{Name: "Age", Type: "*int"},
+			{Name: "Tags", Type: "[]*string"},
+		},
+	})
+	require.Equal(t, "google.protobuf.Int32Value", message.Fields[0].Type.GetName())
+	require.False(t, message.Fields[0].Optional)
+	require.Equal(t, "repeated string", message.Fields[1].Type.GetName())
+	require.Contains(t, ImportStore, "google/protobuf/wrappers.proto")
+}
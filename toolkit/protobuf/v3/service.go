@@ -6,6 +6,7 @@ import (
 	"github.com/unionj-cloud/go-doudou/v2/toolkit/astutils"
 	"github.com/unionj-cloud/go-doudou/v2/toolkit/constants"
 	"github.com/unionj-cloud/go-doudou/v2/version"
+	"net/http"
 	"reflect"
 	"strings"
 	"time"
@@ -13,6 +14,8 @@ import (
 
 type ProtoGenerator struct {
 	fieldNamingFunc func(string) string
+	httpAnnotation  bool
+	wrapperTypes    bool
 }
 
 type ProtoGeneratorOption func(*ProtoGenerator)
@@ -23,6 +26,22 @@ func WithFieldNamingFunc(fn func(string) string) ProtoGeneratorOption {
 	}
 }
 
+// WithHttpAnnotation makes unary rpcs annotated with google.api.http option derived from the same
+// route patterns as http handlers, so that they can be transcoded to HTTP/JSON
+func WithHttpAnnotation(enable bool) ProtoGeneratorOption {
+	return func(p *ProtoGenerator) {
+		p.httpAnnotation = enable
+	}
+}
+
+// WithWrapperTypes makes pointer to scalar fields generated as well-known wrapper types, such as
+// google.protobuf.StringValue, instead of proto3 optional fields
+func WithWrapperTypes(enable bool) ProtoGeneratorOption {
+	return func(p *ProtoGenerator) {
+		p.wrapperTypes = enable
+	}
+}
+
 func NewProtoGenerator(options ...ProtoGeneratorOption) ProtoGenerator {
 	var p ProtoGenerator
 	for _, opt := range options {
@@ -73,6 +92,28 @@ type Rpc struct {
 	Response   Message
 	Comments   []string
 	StreamType StreamType
+	// HttpRule is google.api.http annotation of the rpc, nil if not annotated
+	HttpRule *HttpRule
+}
+
+// HttpRule maps an rpc to http method and path template
+type HttpRule struct {
+	// Method is lower case http method, e.g. get
+	Method string
+	// Path is path template, e.g. /user/{id}
+	Path string
+	// Body is "*" if request message is decoded from request body, empty if from query string
+	Body string
+}
+
+// HasHttpRule reports whether any rpc of the service is annotated with google.api.http option
+func (s Service) HasHttpRule() bool {
+	for _, rpc := range s.Rpcs {
+		if rpc.HttpRule != nil {
+			return true
+		}
+	}
+	return false
 }
 
 func (receiver ProtoGenerator) NewRpc(method astutils.MethodMeta) Rpc {
@@ -103,13 +144,55 @@ func (receiver ProtoGenerator) NewRpc(method astutils.MethodMeta) Rpc {
 	} else if strings.HasPrefix(rpcResponse.Name, "stream ") {
 		st = serverStream
 	}
+	var rule *HttpRule
+	if receiver.httpAnnotation && st == 0 {
+		rule = receiver.newHttpRule(method, rpcRequest)
+	}
 	return Rpc{
 		Name:       rpcName,
 		Request:    rpcRequest,
 		Response:   rpcResponse,
 		Comments:   method.Comments,
 		StreamType: st,
+		HttpRule:   rule,
+	}
+}
+
+// newHttpRule derives http rule from method name in the same way as http routes, returns nil if
+// a path variable has no corresponding field in request message
+func (receiver ProtoGenerator) newHttpRule(method astutils.MethodMeta, request Message) *HttpRule {
+	httpMethod, endpoint := astutils.Pattern(method.Name)
+	fields := request.Fields
+	if m, ok := MessageStore[request.Name]; ok {
+		fields = m.Fields
+	}
+	segments := strings.Split(endpoint, "/")
+	for i, segment := range segments {
+		if !strings.HasPrefix(segment, ":") {
+			continue
+		}
+		name := receiver.fieldNamingFunc(strings.TrimPrefix(segment, ":"))
+		found := false
+		for _, field := range fields {
+			if field.Name == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil
+		}
+		segments[i] = "{" + name + "}"
+	}
+	rule := &HttpRule{
+		Method: strings.ToLower(httpMethod),
+		Path:   "/" + strings.Join(segments, "/"),
+	}
+	if (httpMethod == http.MethodPost || httpMethod == http.MethodPut) && !reflect.DeepEqual(request, Empty) {
+		rule.Body = "*"
 	}
+	ImportStore["google/api/annotations.proto"] = struct{}{}
+	return rule
 }
 
 func (receiver ProtoGenerator) newRequest(rpcName string, params []astutils.FieldMeta) Message {
@@ -16,10 +16,51 @@ import (
 	"os"
 	"regexp"
 	"strings"
+	"sync/atomic"
 )
 
 type SqlLogger struct {
 	Logger zerolog.Logger
+	stats  *CacheStats
+}
+
+// CacheStats counts query cache lookups reported to SqlLogger
+type CacheStats struct {
+	hits   uint64
+	misses uint64
+}
+
+// Hits returns the number of queries served from cache
+func (s *CacheStats) Hits() uint64 {
+	return atomic.LoadUint64(&s.hits)
+}
+
+// Misses returns the number of queries sent to database because of a cache miss
+func (s *CacheStats) Misses() uint64 {
+	return atomic.LoadUint64(&s.misses)
+}
+
+// HitRatio returns hits / (hits + misses), 0 if nothing has been looked up yet
+func (s *CacheStats) HitRatio() float64 {
+	hits, misses := s.Hits(), s.Misses()
+	if hits+misses == 0 {
+		return 0
+	}
+	return float64(hits) / float64(hits+misses)
+}
+
+func (s *CacheStats) record(hit bool) {
+	if hit {
+		atomic.AddUint64(&s.hits, 1)
+		return
+	}
+	atomic.AddUint64(&s.misses, 1)
+}
+
+// CacheStats returns cache lookup counters shared by all copies of the logger,
+// nil if the logger is not created by NewSqlLogger
+func (receiver SqlLogger) CacheStats() *CacheStats {
+	return receiver.stats
 }
 
 func (receiver SqlLogger) Enable() bool {
@@ -44,6 +85,7 @@ func WithLogger(logger zerolog.Logger) SqlLoggerOption {
 func NewSqlLogger(opts ...SqlLoggerOption) SqlLogger {
 	sqlLogger := SqlLogger{
 		Logger: zlogger.Logger,
+		stats:  &CacheStats{},
 	}
 	for _, item := range opts {
 		item(&sqlLogger)
@@ -80,6 +122,9 @@ func PopulatedSql(query string, args ...interface{}) string {
 }
 
 func (receiver SqlLogger) LogWithErr(ctx context.Context, err error, hit *bool, query string, args ...interface{}) {
+	if hit != nil && receiver.stats != nil {
+		receiver.stats.record(*hit)
+	}
 	if !receiver.Enable() {
 		return
 	}
@@ -98,6 +143,9 @@ func (receiver SqlLogger) LogWithErr(ctx context.Context, err error, hit *bool,
 	sb.WriteString(fmt.Sprintf("SQL: %s", PopulatedSql(query, args...)))
 	if hit != nil {
 		sb.WriteString(fmt.Sprintf("\tHIT: %t", *hit))
+		if receiver.stats != nil {
+			sb.WriteString(fmt.Sprintf("\tHIT RATIO: %.2f", receiver.stats.HitRatio()))
+		}
 	}
 	if err != nil {
 		sb.WriteString(fmt.Sprintf("\tERR: %s", errors.Wrap(err, caller.NewCaller().String())))
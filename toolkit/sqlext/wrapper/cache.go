@@ -0,0 +1,385 @@
+package wrapper
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/go-redis/cache/v8"
+	"github.com/go-redis/redis/v8"
+	"github.com/lithammer/shortuuid/v4"
+	"github.com/pkg/errors"
+	"github.com/unionj-cloud/go-doudou/v2/toolkit/sqlext/logger"
+)
+
+// TagStore keeps a version for each table tag. Cache keys of read queries contain versions of
+// the tables they touch, so bumping a version invalidates all cached results of the table at once.
+type TagStore interface {
+	// Versions returns current versions of tags in the same order
+	Versions(ctx context.Context, tags ...string) ([]int64, error)
+	// Invalidate bumps versions of tags
+	Invalidate(ctx context.Context, tags ...string) error
+}
+
+// RedisTagStore stores tag versions in redis, so that invalidation is visible to every instance
+type RedisTagStore struct {
+	rdb    redis.Cmdable
+	prefix string
+}
+
+// NewRedisTagStore creates a RedisTagStore, tag keys are prefixed with "gdd:sqlcache:tag:" if prefix is empty
+func NewRedisTagStore(rdb redis.Cmdable, prefix string) *RedisTagStore {
+	if prefix == "" {
+		prefix = "gdd:sqlcache:tag:"
+	}
+	return &RedisTagStore{rdb: rdb, prefix: prefix}
+}
+
+// Versions implements TagStore interface
+func (s *RedisTagStore) Versions(ctx context.Context, tags ...string) ([]int64, error) {
+	versions := make([]int64, len(tags))
+	if len(tags) == 0 {
+		return versions, nil
+	}
+	keys := make([]string, len(tags))
+	for i, tag := range tags {
+		keys[i] = s.prefix + tag
+	}
+	values, err := s.rdb.MGet(ctx, keys...).Result()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	for i, value := range values {
+		if str, ok := value.(string); ok {
+			versions[i], _ = strconv.ParseInt(str, 10, 64)
+		}
+	}
+	return versions, nil
+}
+
+// Invalidate implements TagStore interface
+func (s *RedisTagStore) Invalidate(ctx context.Context, tags ...string) error {
+	if len(tags) == 0 {
+		return nil
+	}
+	pipe := s.rdb.Pipeline()
+	for _, tag := range tags {
+		pipe.Incr(ctx, s.prefix+tag)
+	}
+	_, err := pipe.Exec(ctx)
+	return errors.WithStack(err)
+}
+
+// LocalTagStore stores tag versions in memory, it is only suitable for single instance deployment
+// or cache stores without redis
+type LocalTagStore struct {
+	mu       sync.RWMutex
+	versions map[string]int64
+}
+
+// NewLocalTagStore creates a LocalTagStore
+func NewLocalTagStore() *LocalTagStore {
+	return &LocalTagStore{versions: make(map[string]int64)}
+}
+
+// Versions implements TagStore interface
+func (s *LocalTagStore) Versions(_ context.Context, tags ...string) ([]int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	versions := make([]int64, len(tags))
+	for i, tag := range tags {
+		versions[i] = s.versions[tag]
+	}
+	return versions, nil
+}
+
+// Invalidate implements TagStore interface
+func (s *LocalTagStore) Invalidate(_ context.Context, tags ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, tag := range tags {
+		s.versions[tag]++
+	}
+	return nil
+}
+
+type cacheTTLKey struct{}
+
+type noCacheKey struct{}
+
+type cacheTablesKey struct{}
+
+// WithCacheTTL returns a copy of ctx in which query results are cached for ttl instead of the default ttl
+func WithCacheTTL(ctx context.Context, ttl time.Duration) context.Context {
+	return context.WithValue(ctx, cacheTTLKey{}, ttl)
+}
+
+// WithoutCache returns a copy of ctx in which queries bypass the cache
+func WithoutCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, noCacheKey{}, true)
+}
+
+// WithTables returns a copy of ctx declaring tables touched by the statement, which takes precedence
+// over tables parsed from sql. Use it for statements the parser can't understand, e.g. calling
+// stored procedures or views.
+func WithTables(ctx context.Context, tables ...string) context.Context {
+	return context.WithValue(ctx, cacheTablesKey{}, normalizeTables(tables))
+}
+
+func cacheTTL(ctx context.Context, ttl time.Duration) time.Duration {
+	if v, ok := ctx.Value(cacheTTLKey{}).(time.Duration); ok && v > 0 {
+		return v
+	}
+	return ttl
+}
+
+func isCacheBypassed(ctx context.Context) bool {
+	bypass, _ := ctx.Value(noCacheKey{}).(bool)
+	return bypass
+}
+
+// tablesOf returns tables declared by WithTables or parsed from query
+func tablesOf(ctx context.Context, query string) []string {
+	if tables, ok := ctx.Value(cacheTablesKey{}).([]string); ok {
+		return tables
+	}
+	return Tables(query)
+}
+
+func normalizeTables(tables []string) []string {
+	set := make(map[string]struct{}, len(tables))
+	for _, table := range tables {
+		table = strings.ToLower(strings.Trim(table, "`\"[] "))
+		if i := strings.LastIndex(table, "."); i >= 0 {
+			table = strings.Trim(table[i+1:], "`\"[] ")
+		}
+		if table != "" {
+			set[table] = struct{}{}
+		}
+	}
+	result := make([]string, 0, len(set))
+	for table := range set {
+		result = append(result, table)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// Tables returns lower-cased names of tables referenced by query after from, join, into, update
+// and table keywords, sorted and deduplicated. Schema qualifiers are dropped. It is a lexical
+// best effort rather than a sql parser, use WithTables to declare tables explicitly.
+func Tables(query string) []string {
+	tokens := tokenize(query)
+	var tables []string
+	for i := 0; i < len(tokens); i++ {
+		keyword := strings.ToLower(tokens[i])
+		switch keyword {
+		case "from", "join", "into", "update", "table":
+		default:
+			continue
+		}
+		if keyword == "update" && i > 0 {
+			// ON DUPLICATE KEY UPDATE and SELECT ... FOR UPDATE
+			if prev := strings.ToLower(tokens[i-1]); prev == "key" || prev == "for" {
+				continue
+			}
+		}
+		for j := i + 1; j < len(tokens); {
+			if !isIdentifier(tokens[j]) {
+				break
+			}
+			tables = append(tables, tokens[j])
+			j++
+			// skip alias
+			if j < len(tokens) && strings.EqualFold(tokens[j], "as") {
+				j++
+			}
+			if j < len(tokens) && isIdentifier(tokens[j]) && !isKeyword(tokens[j]) {
+				j++
+			}
+			if j >= len(tokens) || tokens[j] != "," {
+				break
+			}
+			j++
+		}
+	}
+	return normalizeTables(tables)
+}
+
+var keywords = map[string]struct{}{
+	"where": {}, "set": {}, "values": {}, "value": {}, "select": {}, "on": {}, "using": {},
+	"left": {}, "right": {}, "inner": {}, "outer": {}, "cross": {}, "full": {}, "natural": {}, "join": {},
+	"group": {}, "order": {}, "limit": {}, "having": {}, "union": {}, "for": {}, "lock": {},
+	"straight_join": {}, "partition": {}, "default": {}, "returning": {}, "offset": {}, "window": {},
+	"ignore": {}, "low_priority": {}, "quick": {}, "if": {}, "exists": {}, "only": {},
+}
+
+func isKeyword(token string) bool {
+	_, ok := keywords[strings.ToLower(token)]
+	return ok
+}
+
+func isIdentifier(token string) bool {
+	if token == "" {
+		return false
+	}
+	r := rune(token[0])
+	return r == '`' || r == '"' || r == '_' || unicode.IsLetter(r)
+}
+
+// tokenize splits query into identifiers (possibly quoted and schema qualified), commas and other symbols,
+// string literals are dropped
+func tokenize(query string) []string {
+	var tokens []string
+	runes := []rune(query)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '\'':
+			i++
+			for i < len(runes) {
+				if runes[i] == '\\' {
+					i += 2
+					continue
+				}
+				if runes[i] == '\'' {
+					i++
+					break
+				}
+				i++
+			}
+		case r == '`' || r == '"' || r == '_' || unicode.IsLetter(r):
+			start := i
+			for i < len(runes) {
+				c := runes[i]
+				if c == '`' || c == '"' {
+					end := i + 1
+					for end < len(runes) && runes[end] != c {
+						end++
+					}
+					i = end + 1
+					continue
+				}
+				if c == '.' || c == '_' || c == '$' || unicode.IsLetter(c) || unicode.IsDigit(c) {
+					i++
+					continue
+				}
+				break
+			}
+			if i > len(runes) {
+				i = len(runes)
+			}
+			tokens = append(tokens, string(runes[start:i]))
+		default:
+			tokens = append(tokens, string(r))
+			i++
+		}
+	}
+	return tokens
+}
+
+// queryCache caches read query results, keyed by populated sql and versions of touched tables
+type queryCache struct {
+	store *cache.Cache
+	tags  TagStore
+	ttl   time.Duration
+}
+
+func (c queryCache) enabled(ctx context.Context) bool {
+	return c.store != nil && !isCacheBypassed(ctx)
+}
+
+// key returns cache key of query, tables are versioned only when a TagStore is configured
+func (c queryCache) key(ctx context.Context, query string, args ...interface{}) (string, error) {
+	populated := logger.PopulatedSql(query, args...)
+	if c.tags == nil {
+		return shortuuid.NewWithNamespace(populated), nil
+	}
+	tables := tablesOf(ctx, query)
+	versions, err := c.tags.Versions(ctx, tables...)
+	if err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+	sb.WriteString(populated)
+	for i, table := range tables {
+		sb.WriteString(fmt.Sprintf("|%s:%d", table, versions[i]))
+	}
+	return shortuuid.NewWithNamespace(sb.String()), nil
+}
+
+// once loads dest from cache, or fills it by fetch and caches it. hit reports whether dest is
+// loaded from cache.
+func (c queryCache) once(ctx context.Context, dest interface{}, fetch func() error, query string, args ...interface{}) (hit bool, err error) {
+	key, err := c.key(ctx, query, args...)
+	if err != nil {
+		return false, err
+	}
+	hit = true
+	err = c.store.Once(&cache.Item{
+		Ctx:   ctx,
+		Key:   key,
+		Value: dest,
+		TTL:   cacheTTL(ctx, c.ttl),
+		Do: func(*cache.Item) (interface{}, error) {
+			hit = false
+			return dest, fetch()
+		},
+	})
+	return hit, err
+}
+
+// invalidate bumps versions of tables touched by a write statement
+func (c queryCache) invalidate(ctx context.Context, tables []string) error {
+	if c.tags == nil || len(tables) == 0 {
+		return nil
+	}
+	return c.tags.Invalidate(ctx, tables...)
+}
+
+// pendingTables collects tables written in a transaction which are invalidated on commit
+type pendingTables struct {
+	mu     sync.Mutex
+	tables map[string]struct{}
+}
+
+func (p *pendingTables) add(tables []string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.tables == nil {
+		p.tables = make(map[string]struct{})
+	}
+	for _, table := range tables {
+		p.tables[table] = struct{}{}
+	}
+}
+
+func (p *pendingTables) touches(tables []string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, table := range tables {
+		if _, ok := p.tables[table]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *pendingTables) drain() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	tables := make([]string, 0, len(p.tables))
+	for table := range p.tables {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+	p.tables = nil
+	return tables
+}
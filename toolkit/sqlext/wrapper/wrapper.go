@@ -4,8 +4,8 @@ import (
 	"context"
 	"database/sql"
 	"github.com/go-redis/cache/v8"
+	"github.com/go-redis/redis/v8"
 	"github.com/jmoiron/sqlx"
-	"github.com/lithammer/shortuuid/v4"
 	"github.com/pkg/errors"
 	"github.com/unionj-cloud/go-doudou/v2/toolkit/caller"
 	"github.com/unionj-cloud/go-doudou/v2/toolkit/sqlext/logger"
@@ -39,9 +39,8 @@ type Querier interface {
 // GddDB wraps sqlx.DB
 type GddDB struct {
 	*sqlx.DB
-	logger      logger.SqlLogger
-	cacheStore  *cache.Cache
-	redisKeyTTL time.Duration
+	logger     logger.SqlLogger
+	queryCache queryCache
 }
 
 type GddDBOption func(*GddDB)
@@ -52,30 +51,67 @@ func WithLogger(logger logger.SqlLogger) GddDBOption {
 	}
 }
 
+// WithCache caches read query results in store. Cached results are invalidated on writes by a LocalTagStore
+// unless WithTagStore is set, use WithRedisCache instead for a cache shared by multiple instances.
 func WithCache(store *cache.Cache) GddDBOption {
 	return func(g *GddDB) {
-		g.cacheStore = store
+		g.queryCache.store = store
+	}
+}
+
+// WithRedisCache caches read query results in rdb, with localCache in front of it if not nil. Table versions
+// are kept in the same rdb, so that writes on any instance invalidate cached results of every instance.
+func WithRedisCache(rdb redis.Cmdable, localCache cache.LocalCache) GddDBOption {
+	return func(g *GddDB) {
+		g.queryCache.store = cache.New(&cache.Options{
+			Redis:      rdb,
+			LocalCache: localCache,
+		})
+		g.queryCache.tags = NewRedisTagStore(rdb, "")
 	}
 }
 
 func WithRedisKeyTTL(ttl time.Duration) GddDBOption {
 	return func(g *GddDB) {
-		g.redisKeyTTL = ttl
+		g.queryCache.ttl = ttl
+	}
+}
+
+// WithTagStore sets the store of table versions used to invalidate cached query results. Use a RedisTagStore
+// if the cache store is shared by multiple instances, a LocalTagStore is only correct for caches in memory
+// of a single instance.
+func WithTagStore(store TagStore) GddDBOption {
+	return func(g *GddDB) {
+		g.queryCache.tags = store
 	}
 }
 
 func NewGddDB(db *sqlx.DB, options ...GddDBOption) GddDB {
 	g := &GddDB{
-		DB:          db,
-		logger:      logger.NewSqlLogger(),
-		redisKeyTTL: time.Hour,
+		DB:     db,
+		logger: logger.NewSqlLogger(),
+		queryCache: queryCache{
+			ttl: time.Hour,
+		},
 	}
 	for _, opt := range options {
 		opt(g)
 	}
+	if g.queryCache.store != nil && g.queryCache.tags == nil {
+		g.logger.Logger.Warn().Msg("[go-doudou] query cache has no tag store, writes only invalidate cached results of this instance, use WithRedisCache or WithTagStore if the cache is shared")
+		g.queryCache.tags = NewLocalTagStore()
+	}
 	return *g
 }
 
+// invalidate invalidates cached results of tables written by query. Failure is only logged
+// as the write itself has succeeded.
+func invalidate(ctx context.Context, l logger.SqlLogger, c queryCache, tables []string) {
+	if err := c.invalidate(ctx, tables); err != nil {
+		l.Logger.Error().Err(err).Msgf("failed to invalidate query cache of tables %v", tables)
+	}
+}
+
 func (g GddDB) NamedExecContext(ctx context.Context, query string, arg interface{}) (ret sql.Result, err error) {
 	var (
 		q    string
@@ -91,6 +127,9 @@ func (g GddDB) NamedExecContext(ctx context.Context, query string, arg interface
 	}
 	ret, err = g.DB.NamedExecContext(ctx, query, arg)
 	err = errors.Wrap(err, caller.NewCaller().String())
+	if err == nil {
+		invalidate(ctx, g.logger, g.queryCache, tablesOf(ctx, q))
+	}
 	return
 }
 
@@ -100,56 +139,47 @@ func (g GddDB) ExecContext(ctx context.Context, query string, args ...interface{
 	}()
 	ret, err = g.DB.ExecContext(ctx, query, args...)
 	err = errors.Wrap(err, caller.NewCaller().String())
+	if err == nil {
+		invalidate(ctx, g.logger, g.queryCache, tablesOf(ctx, query))
+	}
 	return
 }
 
 func (g GddDB) GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) (err error) {
-	hit := true
+	// hit is only recorded for queries consulting cache
+	var hit *bool
 	defer func() {
-		g.logger.LogWithErr(ctx, err, &hit, query, args...)
+		g.logger.LogWithErr(ctx, err, hit, query, args...)
 	}()
-	if g.cacheStore != nil {
-		err = g.cacheStore.Once(&cache.Item{
-			Key:   shortuuid.NewWithNamespace(logger.PopulatedSql(query, args...)),
-			Value: dest,
-			TTL:   g.redisKeyTTL,
-			Do: func(*cache.Item) (interface{}, error) {
-				hit = false
-				err = g.DB.GetContext(ctx, dest, query, args...)
-				err = errors.Wrap(err, caller.NewCaller().String())
-				return dest, err
-			},
-		})
+	fetch := func() error {
+		return errors.Wrap(g.DB.GetContext(ctx, dest, query, args...), caller.NewCaller().String())
+	}
+	if g.queryCache.enabled(ctx) {
+		var cached bool
+		cached, err = g.queryCache.once(ctx, dest, fetch, query, args...)
+		hit = &cached
 		return
 	}
-	hit = false
-	err = g.DB.GetContext(ctx, dest, query, args...)
-	err = errors.Wrap(err, caller.NewCaller().String())
+	err = fetch()
 	return
 }
 
 func (g GddDB) SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) (err error) {
-	hit := true
+	// hit is only recorded for queries consulting cache
+	var hit *bool
 	defer func() {
-		g.logger.LogWithErr(ctx, err, &hit, query, args...)
+		g.logger.LogWithErr(ctx, err, hit, query, args...)
 	}()
-	if g.cacheStore != nil {
-		err = g.cacheStore.Once(&cache.Item{
-			Key:   shortuuid.NewWithNamespace(logger.PopulatedSql(query, args...)),
-			Value: dest,
-			TTL:   g.redisKeyTTL,
-			Do: func(*cache.Item) (interface{}, error) {
-				hit = false
-				err = g.DB.SelectContext(ctx, dest, query, args...)
-				err = errors.Wrap(err, caller.NewCaller().String())
-				return dest, err
-			},
-		})
+	fetch := func() error {
+		return errors.Wrap(g.DB.SelectContext(ctx, dest, query, args...), caller.NewCaller().String())
+	}
+	if g.queryCache.enabled(ctx) {
+		var cached bool
+		cached, err = g.queryCache.once(ctx, dest, fetch, query, args...)
+		hit = &cached
 		return
 	}
-	hit = false
-	err = g.DB.SelectContext(ctx, dest, query, args...)
-	err = errors.Wrap(err, caller.NewCaller().String())
+	err = fetch()
 	return
 }
 
@@ -159,15 +189,16 @@ func (g GddDB) BeginTxx(ctx context.Context, opts *sql.TxOptions) (GddTx, error)
 	if err != nil {
 		return GddTx{}, err
 	}
-	return GddTx{tx, g.logger, g.cacheStore, g.redisKeyTTL}, nil
+	return GddTx{tx, g.logger, g.queryCache, &pendingTables{}}, nil
 }
 
-// GddTx wraps sqlx.Tx
+// GddTx wraps sqlx.Tx. Tables written in the transaction are invalidated on commit,
+// and reads of them bypass cache until then.
 type GddTx struct {
 	*sqlx.Tx
-	logger      logger.SqlLogger
-	cacheStore  *cache.Cache
-	redisKeyTTL time.Duration
+	logger     logger.SqlLogger
+	queryCache queryCache
+	pending    *pendingTables
 }
 
 func (g GddTx) NamedExecContext(ctx context.Context, query string, arg interface{}) (ret sql.Result, err error) {
@@ -183,6 +214,7 @@ func (g GddTx) NamedExecContext(ctx context.Context, query string, arg interface
 	if err != nil {
 		return nil, err
 	}
+	g.pending.add(tablesOf(ctx, q))
 	ret, err = g.Tx.NamedExecContext(ctx, query, arg)
 	err = errors.Wrap(err, caller.NewCaller().String())
 	return
@@ -192,57 +224,67 @@ func (g GddTx) ExecContext(ctx context.Context, query string, args ...interface{
 	defer func() {
 		g.logger.LogWithErr(ctx, err, nil, query, args...)
 	}()
+	g.pending.add(tablesOf(ctx, query))
 	ret, err = g.Tx.ExecContext(ctx, query, args...)
 	err = errors.Wrap(err, caller.NewCaller().String())
 	return
 }
 
+// cacheable reports whether query may be served from cache, it is not if it reads tables
+// written by the transaction
+func (g GddTx) cacheable(ctx context.Context, query string) bool {
+	return g.queryCache.enabled(ctx) && !g.pending.touches(tablesOf(ctx, query))
+}
+
 func (g GddTx) GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) (err error) {
-	hit := true
+	// hit is only recorded for queries consulting cache
+	var hit *bool
 	defer func() {
-		g.logger.LogWithErr(ctx, err, &hit, query, args...)
+		g.logger.LogWithErr(ctx, err, hit, query, args...)
 	}()
-	if g.cacheStore != nil {
-		err = g.cacheStore.Once(&cache.Item{
-			Key:   shortuuid.NewWithNamespace(logger.PopulatedSql(query, args...)),
-			Value: dest,
-			TTL:   g.redisKeyTTL,
-			Do: func(*cache.Item) (interface{}, error) {
-				hit = false
-				err = g.Tx.GetContext(ctx, dest, query, args...)
-				err = errors.Wrap(err, caller.NewCaller().String())
-				return dest, err
-			},
-		})
+	fetch := func() error {
+		return errors.Wrap(g.Tx.GetContext(ctx, dest, query, args...), caller.NewCaller().String())
+	}
+	if g.cacheable(ctx, query) {
+		var cached bool
+		cached, err = g.queryCache.once(ctx, dest, fetch, query, args...)
+		hit = &cached
 		return
 	}
-	hit = false
-	err = g.Tx.GetContext(ctx, dest, query, args...)
-	err = errors.Wrap(err, caller.NewCaller().String())
+	err = fetch()
 	return
 }
 
 func (g GddTx) SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) (err error) {
-	hit := true
+	// hit is only recorded for queries consulting cache
+	var hit *bool
 	defer func() {
-		g.logger.LogWithErr(ctx, err, &hit, query, args...)
+		g.logger.LogWithErr(ctx, err, hit, query, args...)
 	}()
-	if g.cacheStore != nil {
-		err = g.cacheStore.Once(&cache.Item{
-			Key:   shortuuid.NewWithNamespace(logger.PopulatedSql(query, args...)),
-			Value: dest,
-			TTL:   g.redisKeyTTL,
-			Do: func(*cache.Item) (interface{}, error) {
-				hit = false
-				err = g.Tx.SelectContext(ctx, dest, query, args...)
-				err = errors.Wrap(err, caller.NewCaller().String())
-				return dest, err
-			},
-		})
+	fetch := func() error {
+		return errors.Wrap(g.Tx.SelectContext(ctx, dest, query, args...), caller.NewCaller().String())
+	}
+	if g.cacheable(ctx, query) {
+		var cached bool
+		cached, err = g.queryCache.once(ctx, dest, fetch, query, args...)
+		hit = &cached
 		return
 	}
-	hit = false
-	err = g.Tx.SelectContext(ctx, dest, query, args...)
-	err = errors.Wrap(err, caller.NewCaller().String())
+	err = fetch()
 	return
 }
+
+// Commit commits the transaction and invalidates cached results of tables written in it
+func (g GddTx) Commit() error {
+	if err := g.Tx.Commit(); err != nil {
+		return err
+	}
+	invalidate(context.Background(), g.logger, g.queryCache, g.pending.drain())
+	return nil
+}
+
+// Rollback aborts the transaction, nothing is invalidated
+func (g GddTx) Rollback() error {
+	g.pending.drain()
+	return g.Tx.Rollback()
+}
@@ -0,0 +1,146 @@
+package wrapper
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/go-redis/cache/v8"
+	"github.com/go-redis/redis/v8"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/require"
+	"github.com/unionj-cloud/go-doudou/v2/toolkit/sqlext/logger"
+)
+
+func TestTables(t *testing.T) {
+	cases := map[string][]string{
+		"select * from ddl_user where id = ?":                                                            {"ddl_user"},
+		"SELECT u.name FROM `test`.`ddl_user` u LEFT JOIN ddl_book AS b ON u.id = b.uid":                 {"ddl_book", "ddl_user"},
+		"select * from a, b x, `c` where a.id = x.id":                                                    {"a", "b", "c"},
+		"insert into ddl_user (`name`) values ('from fake') on duplicate key update name = values(name)": {"ddl_user"},
+		"UPDATE ddl_user SET name = ? WHERE id = ?":                                                      {"ddl_user"},
+		"delete from ddl_user where id in (select uid from ddl_book)":                                    {"ddl_book", "ddl_user"},
+		"select * from ddl_user where id = ? for update":                                                 {"ddl_user"},
+		"truncate table ddl_user":                                                                        {"ddl_user"},
+		"select 1":                                                                                       {},
+	}
+	for query, want := range cases {
+		require.Equal(t, want, Tables(query), query)
+	}
+}
+
+type user struct {
+	ID   int64  `db:"id"`
+	Name string `db:"name"`
+}
+
+func setupDB(t *testing.T) GddDB {
+	db, err := sqlx.Open("sqlite3", "file::memory:")
+	require.NoError(t, err)
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() {
+		_ = db.Close()
+	})
+	_, err = db.Exec("create table ddl_user (id integer primary key, name text)")
+	require.NoError(t, err)
+	_, err = db.Exec("insert into ddl_user (id, name) values (1, 'jack')")
+	require.NoError(t, err)
+	return NewGddDB(db, WithCache(cache.New(&cache.Options{
+		LocalCache: cache.NewTinyLFU(100, time.Minute),
+	})), WithTagStore(NewLocalTagStore()))
+}
+
+func TestGddDBInvalidation(t *testing.T) {
+	g := setupDB(t)
+	ctx := context.Background()
+	var u user
+	require.NoError(t, g.GetContext(ctx, &u, "select * from ddl_user where id = ?", 1))
+	require.Equal(t, "jack", u.Name)
+
+	// bypass the wrapper, cached result is stale
+	_, err := g.DB.ExecContext(ctx, "update ddl_user set name = 'rose' where id = 1")
+	require.NoError(t, err)
+	require.NoError(t, g.GetContext(ctx, &u, "select * from ddl_user where id = ?", 1))
+	require.Equal(t, "jack", u.Name)
+	require.NoError(t, g.GetContext(WithoutCache(ctx), &u, "select * from ddl_user where id = ?", 1))
+	require.Equal(t, "rose", u.Name)
+
+	_, err = g.NamedExecContext(ctx, "update ddl_user set name = :name where id = :id", user{ID: 1, Name: "lily"})
+	require.NoError(t, err)
+	require.NoError(t, g.GetContext(ctx, &u, "select * from ddl_user where id = ?", 1))
+	require.Equal(t, "lily", u.Name)
+
+	var users []user
+	require.NoError(t, g.SelectContext(ctx, &users, "select * from ddl_user"))
+	require.Len(t, users, 1)
+	_, err = g.ExecContext(ctx, "insert into ddl_user (id, name) values (2, 'tom')")
+	require.NoError(t, err)
+	require.NoError(t, g.SelectContext(ctx, &users, "select * from ddl_user"))
+	require.Len(t, users, 2)
+
+	// declared tables take precedence over parsed ones
+	_, err = g.ExecContext(WithTables(ctx, "ddl_book"), "delete from ddl_user where id = 2")
+	require.NoError(t, err)
+	require.NoError(t, g.SelectContext(ctx, &users, "select * from ddl_user"))
+	require.Len(t, users, 2)
+}
+
+func TestGddTxInvalidation(t *testing.T) {
+	g := setupDB(t)
+	ctx := context.Background()
+	var u user
+	require.NoError(t, g.GetContext(ctx, &u, "select * from ddl_user where id = ?", 1))
+
+	tx, err := g.BeginTxx(ctx, nil)
+	require.NoError(t, err)
+	_, err = tx.ExecContext(ctx, "update ddl_user set name = 'rose' where id = 1")
+	require.NoError(t, err)
+	// reads of tables written in transaction bypass cache
+	require.NoError(t, tx.GetContext(ctx, &u, "select * from ddl_user where id = ?", 1))
+	require.Equal(t, "rose", u.Name)
+	require.NoError(t, tx.Commit())
+
+	require.NoError(t, g.GetContext(ctx, &u, "select * from ddl_user where id = ?", 1))
+	require.Equal(t, "rose", u.Name)
+}
+
+func TestCacheStats(t *testing.T) {
+	g := setupDB(t)
+	ctx := context.Background()
+	var u user
+	for i := 0; i < 4; i++ {
+		require.NoError(t, g.GetContext(ctx, &u, "select * from ddl_user where id = ?", 1))
+	}
+	stats := g.logger.CacheStats()
+	require.EqualValues(t, 3, stats.Hits())
+	require.EqualValues(t, 1, stats.Misses())
+	require.Equal(t, 0.75, stats.HitRatio())
+	// queries not consulting cache are not counted
+	require.NoError(t, g.GetContext(WithoutCache(ctx), &u, "select * from ddl_user where id = ?", 1))
+	require.EqualValues(t, 4, stats.Hits()+stats.Misses())
+	require.Nil(t, logger.SqlLogger{}.CacheStats())
+}
+
+func TestWithCacheTTL(t *testing.T) {
+	require.Equal(t, time.Hour, cacheTTL(context.Background(), time.Hour))
+	require.Equal(t, time.Minute, cacheTTL(WithCacheTTL(context.Background(), time.Minute), time.Hour))
+}
+
+func TestNewGddDBTagStore(t *testing.T) {
+	db, err := sqlx.Open("sqlite3", "file::memory:")
+	require.NoError(t, err)
+	defer db.Close()
+
+	g := NewGddDB(db, WithCache(cache.New(&cache.Options{
+		LocalCache: cache.NewTinyLFU(100, time.Minute),
+	})))
+	require.IsType(t, &LocalTagStore{}, g.queryCache.tags)
+
+	rdb := redis.NewClient(&redis.Options{Addr: "127.0.0.1:0"})
+	defer rdb.Close()
+	g = NewGddDB(db, WithRedisCache(rdb, nil))
+	require.NotNil(t, g.queryCache.store)
+	require.IsType(t, &RedisTagStore{}, g.queryCache.tags)
+	require.Equal(t, rdb, g.queryCache.tags.(*RedisTagStore).rdb)
+}
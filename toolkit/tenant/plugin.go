@@ -0,0 +1,199 @@
+package tenant
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/unionj-cloud/go-doudou/v2/toolkit/stringutils"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// register adds callbacks before the main callback of the named kinds of statement
+func register(db *gorm.DB, name string, callbacks map[string]func(*gorm.DB)) error {
+	callback := db.Callback()
+	for kind, fn := range callbacks {
+		var err error
+		switch kind {
+		case "query":
+			err = callback.Query().Before("gorm:query").Register(name, fn)
+		case "row":
+			err = callback.Row().Before("gorm:row").Register(name, fn)
+		case "create":
+			err = callback.Create().Before("gorm:create").Register(name, fn)
+		case "update":
+			err = callback.Update().Before("gorm:update").Register(name, fn)
+		case "delete":
+			err = callback.Delete().Before("gorm:delete").Register(name, fn)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SharedTablePlugin isolates tenants sharing the same tables by a tenant id column.
+// Every statement on a model having the column is restricted to the tenant in context,
+// and the column is filled with the tenant on create and update, statements on such models fail with
+// ErrMissingTenant if there is no tenant in context. Raw sql and statements without model can't be
+// restricted, they always fail with ErrUnscopedStatement. Use Ignore to run statements unscoped on purpose.
+type SharedTablePlugin struct {
+	column string
+}
+
+// NewSharedTablePlugin creates a SharedTablePlugin, DefaultColumn is used if column is empty
+func NewSharedTablePlugin(column string) *SharedTablePlugin {
+	if stringutils.IsEmpty(column) {
+		column = DefaultColumn
+	}
+	return &SharedTablePlugin{column: column}
+}
+
+// Name implements gorm.Plugin interface
+func (p *SharedTablePlugin) Name() string {
+	return "gdd:tenant:shared_table"
+}
+
+// Initialize implements gorm.Plugin interface
+func (p *SharedTablePlugin) Initialize(db *gorm.DB) error {
+	return register(db, "gdd:tenant:shared_table", map[string]func(*gorm.DB){
+		"query":  p.filter,
+		"row":    p.filter,
+		"delete": p.filter,
+		"update": p.update,
+		"create": p.create,
+	})
+}
+
+// tenantOf returns the tenant column and the tenant in context if statement should be scoped
+func (p *SharedTablePlugin) tenantOf(db *gorm.DB) (string, string, bool) {
+	stmt := db.Statement
+	if db.Error != nil || IsIgnored(stmt.Context) {
+		return "", "", false
+	}
+	if stmt.Schema == nil || stmt.SQL.Len() > 0 {
+		_ = db.AddError(fmt.Errorf("%w: %s", ErrUnscopedStatement, describe(stmt)))
+		return "", "", false
+	}
+	field := stmt.Schema.LookUpField(p.column)
+	if field == nil {
+		return "", "", false
+	}
+	id, ok := FromContext(stmt.Context)
+	if !ok {
+		_ = db.AddError(fmt.Errorf("%w: table %s is tenant scoped", ErrMissingTenant, stmt.Schema.Table))
+		return "", "", false
+	}
+	return field.DBName, id, true
+}
+
+// describe returns table or raw sql of stmt for error messages
+func describe(stmt *gorm.Statement) string {
+	if stmt.SQL.Len() > 0 {
+		return "raw sql " + stmt.SQL.String()
+	}
+	if stringutils.IsNotEmpty(stmt.Table) {
+		return "table " + stmt.Table
+	}
+	return "statement without model"
+}
+
+// scope restricts stmt to tenant id. Existing conditions are grouped first if any of them is an OR,
+// otherwise a OR b AND tenant = id would match rows of other tenants.
+func scope(stmt *gorm.Statement, column, id string) {
+	if c, ok := stmt.Clauses["WHERE"]; ok {
+		if where, ok := c.Expression.(clause.Where); ok && len(where.Exprs) > 0 {
+			for _, expr := range where.Exprs {
+				if _, ok := expr.(clause.OrConditions); ok {
+					where.Exprs = []clause.Expression{clause.And(where.Exprs...)}
+					c.Expression = where
+					stmt.Clauses["WHERE"] = c
+					break
+				}
+			}
+		}
+	}
+	stmt.AddClause(clause.Where{Exprs: []clause.Expression{
+		clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: column}, Value: id},
+	}})
+}
+
+func (p *SharedTablePlugin) filter(db *gorm.DB) {
+	if column, id, ok := p.tenantOf(db); ok {
+		scope(db.Statement, column, id)
+	}
+}
+
+func (p *SharedTablePlugin) create(db *gorm.DB) {
+	if column, id, ok := p.tenantOf(db); ok {
+		db.Statement.SetColumn(column, id, true)
+	}
+}
+
+func (p *SharedTablePlugin) update(db *gorm.DB) {
+	if column, id, ok := p.tenantOf(db); ok {
+		// rows can't be moved to another tenant
+		db.Statement.SetColumn(column, id, true)
+		scope(db.Statement, column, id)
+	}
+}
+
+// SchemaPlugin isolates tenants by qualifying table names with a per-tenant schema (database in mysql),
+// the schema name is built by formatting pattern with tenant id, e.g. tenant_%s
+type SchemaPlugin struct {
+	pattern string
+}
+
+// NewSchemaPlugin creates a SchemaPlugin, tenant id itself is used as schema name if pattern is empty
+func NewSchemaPlugin(pattern string) *SchemaPlugin {
+	if stringutils.IsEmpty(pattern) {
+		pattern = "%s"
+	}
+	return &SchemaPlugin{pattern: pattern}
+}
+
+// Name implements gorm.Plugin interface
+func (p *SchemaPlugin) Name() string {
+	return "gdd:tenant:schema"
+}
+
+// Initialize implements gorm.Plugin interface
+func (p *SchemaPlugin) Initialize(db *gorm.DB) error {
+	return register(db, "gdd:tenant:schema", map[string]func(*gorm.DB){
+		"query":  p.switchSchema,
+		"row":    p.switchSchema,
+		"delete": p.switchSchema,
+		"update": p.switchSchema,
+		"create": p.switchSchema,
+	})
+}
+
+// Schema returns schema name of tenant id
+func (p *SchemaPlugin) Schema(id string) string {
+	return fmt.Sprintf(p.pattern, id)
+}
+
+func (p *SchemaPlugin) switchSchema(db *gorm.DB) {
+	stmt := db.Statement
+	if db.Error != nil || stmt.TableExpr != nil || IsIgnored(stmt.Context) {
+		return
+	}
+	table := stmt.Table
+	if stringutils.IsEmpty(table) && stmt.Schema != nil {
+		table = stmt.Schema.Table
+	}
+	if stringutils.IsEmpty(table) {
+		return
+	}
+	id, ok := FromContext(stmt.Context)
+	if !ok {
+		_ = db.AddError(fmt.Errorf("%w: table %s is tenant scoped", ErrMissingTenant, table))
+		return
+	}
+	// replace schema prefix set by GDD_DB_TABLE_PREFIX naming strategy
+	if i := strings.LastIndex(table, "."); i >= 0 {
+		table = table[i+1:]
+	}
+	stmt.Table = p.Schema(id) + "." + table
+}
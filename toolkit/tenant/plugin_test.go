@@ -0,0 +1,183 @@
+package tenant
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+type order struct {
+	ID       int64 `gorm:"primaryKey"`
+	TenantID string
+	Item     string
+}
+
+type product struct {
+	ID   int64 `gorm:"primaryKey"`
+	Name string
+}
+
+func openDB(t *testing.T, name string) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(fmt.Sprintf("file:%s?mode=memory&cache=shared", name)), &gorm.Config{})
+	require.NoError(t, err)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	t.Cleanup(func() {
+		_ = sqlDB.Close()
+	})
+	return db
+}
+
+func tenantCtx(t *testing.T, id string) context.Context {
+	ctx, err := WithTenant(context.Background(), id)
+	require.NoError(t, err)
+	return ctx
+}
+
+func TestSharedTablePlugin(t *testing.T) {
+	db := openDB(t, t.Name())
+	require.NoError(t, db.AutoMigrate(&order{}, &product{}))
+	require.NoError(t, db.Use(NewSharedTablePlugin("")))
+	ctxA, ctxB := tenantCtx(t, "a"), tenantCtx(t, "b")
+
+	require.NoError(t, db.WithContext(ctxA).Create(&[]order{{Item: "apple"}, {Item: "avocado"}}).Error)
+	// tenant column set by client is overwritten by tenant in context
+	require.NoError(t, db.WithContext(ctxB).Create(&order{Item: "banana", TenantID: "a"}).Error)
+
+	var orders []order
+	require.NoError(t, db.WithContext(ctxA).Find(&orders).Error)
+	require.Len(t, orders, 2)
+	require.NoError(t, db.WithContext(ctxB).Find(&orders).Error)
+	require.Len(t, orders, 1)
+	require.Equal(t, "b", orders[0].TenantID)
+	banana := orders[0]
+
+	var count int64
+	require.NoError(t, db.WithContext(ctxA).Model(&order{}).Where("item = ?", "banana").Count(&count).Error)
+	require.EqualValues(t, 0, count)
+	require.ErrorIs(t, db.WithContext(ctxA).First(&order{}, banana.ID).Error, gorm.ErrRecordNotFound)
+
+	result := db.WithContext(ctxA).Model(&order{}).Where("id = ?", banana.ID).Update("item", "stolen")
+	require.NoError(t, result.Error)
+	require.EqualValues(t, 0, result.RowsAffected)
+	result = db.WithContext(ctxA).Model(&order{}).Where("id = ?", orders[0].ID).Update("tenant_id", "a")
+	require.NoError(t, result.Error)
+	require.EqualValues(t, 0, result.RowsAffected)
+	result = db.WithContext(ctxA).Delete(&order{}, banana.ID)
+	require.NoError(t, result.Error)
+	require.EqualValues(t, 0, result.RowsAffected)
+
+	require.ErrorIs(t, db.Find(&orders).Error, ErrMissingTenant)
+	require.NoError(t, db.WithContext(Ignore(context.Background())).Find(&orders).Error)
+	require.Len(t, orders, 3)
+
+	// models without tenant column are not affected
+	require.NoError(t, db.Create(&product{Name: "fruit"}).Error)
+	require.NoError(t, db.Model(&product{}).Count(&count).Error)
+	require.EqualValues(t, 1, count)
+}
+
+func TestSharedTablePluginOr(t *testing.T) {
+	db := openDB(t, t.Name())
+	require.NoError(t, db.AutoMigrate(&order{}))
+	require.NoError(t, db.Use(NewSharedTablePlugin("")))
+	ctxA, ctxB := tenantCtx(t, "a"), tenantCtx(t, "b")
+	require.NoError(t, db.WithContext(ctxA).Create(&order{Item: "apple"}).Error)
+	require.NoError(t, db.WithContext(ctxB).Create(&order{Item: "banana"}).Error)
+
+	var orders []order
+	require.NoError(t, db.WithContext(ctxA).Where("item = ?", "apple").Or("item = ?", "banana").Find(&orders).Error)
+	require.Len(t, orders, 1)
+	require.Equal(t, "apple", orders[0].Item)
+
+	result := db.WithContext(ctxA).Model(&order{}).Where("item = ?", "apple").Or("item = ?", "banana").Update("item", "stolen")
+	require.NoError(t, result.Error)
+	require.EqualValues(t, 1, result.RowsAffected)
+
+	result = db.WithContext(ctxA).Where("item = ?", "stolen").Or("item = ?", "banana").Delete(&order{})
+	require.NoError(t, result.Error)
+	require.EqualValues(t, 1, result.RowsAffected)
+
+	require.NoError(t, db.WithContext(ctxB).Find(&orders).Error)
+	require.Len(t, orders, 1)
+	require.Equal(t, "banana", orders[0].Item)
+}
+
+func TestSharedTablePluginUnscoped(t *testing.T) {
+	db := openDB(t, t.Name())
+	require.NoError(t, db.AutoMigrate(&order{}))
+	require.NoError(t, db.Use(NewSharedTablePlugin("")))
+	ctxA := tenantCtx(t, "a")
+
+	var rows []map[string]interface{}
+	require.ErrorIs(t, db.WithContext(ctxA).Table("orders").Find(&rows).Error, ErrUnscopedStatement)
+	var count int64
+	require.ErrorIs(t, db.WithContext(ctxA).Raw("SELECT count(1) FROM orders").Scan(&count).Error, ErrUnscopedStatement)
+	var orders []order
+	require.ErrorIs(t, db.WithContext(ctxA).Raw("SELECT * FROM orders").Scan(&orders).Error, ErrUnscopedStatement)
+
+	// without tenant in context as well, only Ignore runs statements as they are
+	require.ErrorIs(t, db.Table("orders").Find(&rows).Error, ErrUnscopedStatement)
+	require.ErrorIs(t, db.Raw("SELECT count(1) FROM orders").Scan(&count).Error, ErrUnscopedStatement)
+	require.NoError(t, db.WithContext(Ignore(context.Background())).Table("orders").Find(&rows).Error)
+	require.NoError(t, db.WithContext(Ignore(ctxA)).Raw("SELECT count(1) FROM orders").Scan(&count).Error)
+}
+
+func TestSchemaPlugin(t *testing.T) {
+	db := openDB(t, t.Name())
+	for _, id := range []string{"a", "b"} {
+		require.NoError(t, db.Exec(fmt.Sprintf("ATTACH DATABASE 'file:%s_%s?mode=memory&cache=shared' AS tenant_%s", t.Name(), id, id)).Error)
+		require.NoError(t, db.Exec(fmt.Sprintf("CREATE TABLE tenant_%s.products (id integer primary key, name text)", id)).Error)
+	}
+	require.NoError(t, db.Use(NewSchemaPlugin("tenant_%s")))
+	ctxA, ctxB := tenantCtx(t, "a"), tenantCtx(t, "b")
+
+	require.NoError(t, db.WithContext(ctxA).Create(&product{Name: "apple"}).Error)
+	require.NoError(t, db.WithContext(ctxB).Create(&[]product{{Name: "banana"}, {Name: "blueberry"}}).Error)
+
+	var products []product
+	require.NoError(t, db.WithContext(ctxA).Find(&products).Error)
+	require.Len(t, products, 1)
+	require.Equal(t, "apple", products[0].Name)
+	var count int64
+	require.NoError(t, db.WithContext(ctxB).Model(&product{}).Count(&count).Error)
+	require.EqualValues(t, 2, count)
+
+	require.ErrorIs(t, db.Find(&products).Error, ErrMissingTenant)
+}
+
+func TestPool(t *testing.T) {
+	var opened []string
+	pool := NewPool(func(id string) (*gorm.DB, error) {
+		opened = append(opened, id)
+		db := openDB(t, t.Name()+id)
+		return db, db.AutoMigrate(&product{})
+	})
+	defer pool.Close()
+
+	ctxA, ctxB := tenantCtx(t, "a"), tenantCtx(t, "b")
+	dbA, err := pool.DB(ctxA)
+	require.NoError(t, err)
+	require.NoError(t, dbA.Create(&product{Name: "apple"}).Error)
+	dbB, err := pool.DB(ctxB)
+	require.NoError(t, err)
+
+	var count int64
+	require.NoError(t, dbB.Model(&product{}).Count(&count).Error)
+	require.EqualValues(t, 0, count)
+	dbA, err = pool.DB(ctxA)
+	require.NoError(t, err)
+	require.NoError(t, dbA.Model(&product{}).Count(&count).Error)
+	require.EqualValues(t, 1, count)
+	require.Equal(t, []string{"a", "b"}, opened)
+
+	_, err = pool.DB(context.Background())
+	require.ErrorIs(t, err, ErrMissingTenant)
+	_, err = pool.Get("a;DROP")
+	require.ErrorIs(t, err, ErrInvalidTenant)
+}
@@ -0,0 +1,76 @@
+package tenant
+
+import (
+	"context"
+	"sync"
+
+	"github.com/pkg/errors"
+	"gorm.io/gorm"
+)
+
+// Opener opens a database connection pool dedicated to tenant id
+type Opener func(id string) (*gorm.DB, error)
+
+// Pool manages connection pools for database per tenant strategy.
+// A pool is opened lazily for the first request of a tenant and reused afterwards.
+type Pool struct {
+	open Opener
+	mu   sync.Mutex
+	dbs  sync.Map
+}
+
+// NewPool creates a Pool
+func NewPool(open Opener) *Pool {
+	return &Pool{open: open}
+}
+
+// DB returns the connection pool of the tenant in ctx, bound to ctx
+func (p *Pool) DB(ctx context.Context) (*gorm.DB, error) {
+	id, ok := FromContext(ctx)
+	if !ok {
+		return nil, ErrMissingTenant
+	}
+	db, err := p.Get(id)
+	if err != nil {
+		return nil, err
+	}
+	return db.WithContext(ctx), nil
+}
+
+// Get returns the connection pool of tenant id
+func (p *Pool) Get(id string) (*gorm.DB, error) {
+	if db, ok := p.dbs.Load(id); ok {
+		return db.(*gorm.DB), nil
+	}
+	if !Valid(id) {
+		return nil, errors.Wrap(ErrInvalidTenant, id)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if db, ok := p.dbs.Load(id); ok {
+		return db.(*gorm.DB), nil
+	}
+	db, err := p.open(id)
+	if err != nil {
+		return nil, errors.Wrapf(err, "open database of tenant %s", id)
+	}
+	p.dbs.Store(id, db)
+	return db, nil
+}
+
+// Close closes all opened connection pools
+func (p *Pool) Close() error {
+	var result error
+	p.dbs.Range(func(key, value interface{}) bool {
+		p.dbs.Delete(key)
+		sqlDB, err := value.(*gorm.DB).DB()
+		if err == nil {
+			err = sqlDB.Close()
+		}
+		if err != nil && result == nil {
+			result = err
+		}
+		return true
+	})
+	return result
+}
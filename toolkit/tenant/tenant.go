@@ -0,0 +1,69 @@
+package tenant
+
+import (
+	"context"
+	"regexp"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultHeader is http header and grpc metadata key carrying tenant id
+	DefaultHeader = "X-Tenant-ID"
+	// DefaultColumn is the column storing tenant id for shared table strategy
+	DefaultColumn = "tenant_id"
+)
+
+var (
+	// ErrMissingTenant is returned when a tenant scoped operation is performed without tenant in context
+	ErrMissingTenant = errors.New("tenant is missing in context")
+	// ErrInvalidTenant is returned for tenant id not matching [A-Za-z0-9_-]{1,64}
+	ErrInvalidTenant = errors.New("invalid tenant id")
+	// ErrUnscopedStatement is returned when a statement can't be restricted to the tenant in context, such as
+	// raw sql or statements on tables without model, use Ignore to run them on purpose
+	ErrUnscopedStatement = errors.New("statement can't be scoped to tenant")
+)
+
+// tenant ids are used to build schema names and dsn, so only safe characters are accepted
+var tenantPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+type tenantKey struct{}
+
+type ignoreKey struct{}
+
+// Valid reports whether id is a well-formed tenant id
+func Valid(id string) bool {
+	return tenantPattern.MatchString(id)
+}
+
+// WithTenant returns a copy of ctx carrying tenant id
+func WithTenant(ctx context.Context, id string) (context.Context, error) {
+	if !Valid(id) {
+		return ctx, errors.Wrap(ErrInvalidTenant, id)
+	}
+	return context.WithValue(ctx, tenantKey{}, id), nil
+}
+
+// FromContext returns tenant id stored by WithTenant
+func FromContext(ctx context.Context) (string, bool) {
+	if ctx == nil {
+		return "", false
+	}
+	id, ok := ctx.Value(tenantKey{}).(string)
+	return id, ok
+}
+
+// Ignore returns a copy of ctx in which database operations are not scoped to any tenant,
+// it is meant for system jobs such as migrations and cross tenant reports
+func Ignore(ctx context.Context) context.Context {
+	return context.WithValue(ctx, ignoreKey{}, true)
+}
+
+// IsIgnored reports whether ctx is returned by Ignore
+func IsIgnored(ctx context.Context) bool {
+	if ctx == nil {
+		return false
+	}
+	ignored, _ := ctx.Value(ignoreKey{}).(bool)
+	return ignored
+}
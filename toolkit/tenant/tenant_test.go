@@ -0,0 +1,47 @@
+package tenant
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/unionj-cloud/go-doudou/v2/toolkit/sqlext/query"
+)
+
+func TestWithTenant(t *testing.T) {
+	_, err := WithTenant(context.Background(), "a' OR '1'='1")
+	require.ErrorIs(t, err, ErrInvalidTenant)
+	_, err = WithTenant(context.Background(), "")
+	require.ErrorIs(t, err, ErrInvalidTenant)
+
+	ctx, err := WithTenant(context.Background(), "acme_01")
+	require.NoError(t, err)
+	id, ok := FromContext(ctx)
+	require.True(t, ok)
+	require.Equal(t, "acme_01", id)
+	require.False(t, IsIgnored(ctx))
+	require.True(t, IsIgnored(Ignore(ctx)))
+}
+
+func TestWhere(t *testing.T) {
+	_, err := Where(context.Background(), query.C().Col("name").Eq("jack").ToWhere(), "")
+	require.ErrorIs(t, err, ErrMissingTenant)
+
+	ctx, err := WithTenant(context.Background(), "acme")
+	require.NoError(t, err)
+	where, err := Where(ctx, query.C().Col("name").Eq("jack").Or(query.C().Col("age").Gt(18)), "")
+	require.NoError(t, err)
+	sql, args := where.Sql()
+	require.Equal(t, "(`tenant_id` = ? and (`name` = ? or `age` > ?))", sql)
+	require.Equal(t, []interface{}{"acme", "jack", 18}, args)
+
+	where, err = Where(ctx, query.Where{}, "org_id")
+	require.NoError(t, err)
+	sql, args = where.Sql()
+	require.Equal(t, "`org_id` = ?", sql)
+	require.Equal(t, []interface{}{"acme"}, args)
+
+	where, err = Where(Ignore(context.Background()), query.Where{}, "")
+	require.NoError(t, err)
+	require.True(t, where.IsEmpty())
+}
@@ -0,0 +1,24 @@
+package tenant
+
+import (
+	"context"
+
+	"github.com/unionj-cloud/go-doudou/v2/toolkit/sqlext/query"
+	"github.com/unionj-cloud/go-doudou/v2/toolkit/stringutils"
+)
+
+// Where restricts where to the tenant in ctx for dao code based on toolkit/sqlext,
+// DefaultColumn is used if column is empty
+func Where(ctx context.Context, where query.Where, column string) (query.Where, error) {
+	if IsIgnored(ctx) {
+		return where, nil
+	}
+	id, ok := FromContext(ctx)
+	if !ok {
+		return where, ErrMissingTenant
+	}
+	if stringutils.IsEmpty(column) {
+		column = DefaultColumn
+	}
+	return query.C().Col(column).Eq(id).And(where), nil
+}